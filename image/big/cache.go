@@ -0,0 +1,299 @@
+// Copyright 2014 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package big
+
+import (
+	"container/list"
+	"fmt"
+	"image"
+	"image/draw"
+	"sync"
+
+	"code.google.com/p/snappy-go/snappy"
+	image_ext "github.com/chai2010/gopkg/image"
+)
+
+// DefaultCacheSize is the default max number of the tiles which are kept
+// in memory by the images opened from a TileStore.
+const DefaultCacheSize = 1024
+
+// minCacheSize is the min cache size, the pyramid updating uses two tiles
+// at the same time.
+const minCacheSize = 4
+
+type tileKey struct {
+	Level, Col, Row int
+}
+
+type tileEntry struct {
+	Key   tileKey
+	Tile  draw.Image
+	Dirty bool
+	Refs  int           // the pinned tiles are not evicted or flushed
+	busy  chan struct{} // not nil while the tile is loading or saving
+}
+
+// storeTiles loads the tiles from a TileStore lazily and keeps the hot
+// tiles in a LRU cache, the dirty tiles are saved when they are evicted
+// or flushed. The tiles in use are pinned by acquire, the cache may grow
+// over the size if there are too many pinned tiles.
+//
+// The TileStore is read and written with mu unlocked, the tile is busy
+// during the I/O and the other users of the tile wait for it.
+type storeTiles struct {
+	mu      sync.Mutex
+	store   TileStore
+	newTile func() draw.Image
+	size    int
+	lru     *list.List // *tileEntry, the front is the most recently used
+	tiles   map[tileKey]*list.Element
+	err     error // the first error of the lazy loading and saving
+}
+
+func newStoreTiles(store TileStore, newTile func() draw.Image) *storeTiles {
+	return &storeTiles{
+		store:   store,
+		newTile: newTile,
+		size:    DefaultCacheSize,
+		lru:     list.New(),
+		tiles:   make(map[tileKey]*list.Element),
+	}
+}
+
+// setCacheSize sets the max number of the cached tiles.
+func (p *storeTiles) setCacheSize(n int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if n < minCacheSize {
+		n = minCacheSize
+	}
+	p.size = n
+	p.evict()
+}
+
+// getTile returns the tile, a new tile is returned if the tile is not
+// saved. The dirty tile will be saved.
+func (p *storeTiles) getTile(key tileKey, dirty bool) draw.Image {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.loadTile(key, dirty, 0).Tile
+}
+
+// acquire returns the pinned tile, the tile must be released by release.
+func (p *storeTiles) acquire(key tileKey, dirty bool) draw.Image {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.loadTile(key, dirty, 1).Tile
+}
+
+func (p *storeTiles) release(key tileKey) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if e, ok := p.tiles[key]; ok {
+		e.Value.(*tileEntry).Refs--
+	}
+	p.evict()
+}
+
+// entry returns the cached tile, or nil if the tile is not cached. If the
+// tile is busy, it waits for the tile with mu unlocked.
+func (p *storeTiles) entry(key tileKey) *tileEntry {
+	for {
+		e, ok := p.tiles[key]
+		if !ok {
+			return nil
+		}
+		v := e.Value.(*tileEntry)
+		if v.busy == nil {
+			p.lru.MoveToFront(e)
+			return v
+		}
+		busy := v.busy
+		p.mu.Unlock()
+		<-busy
+		p.mu.Lock()
+	}
+}
+
+func (p *storeTiles) loadTile(key tileKey, dirty bool, refs int) *tileEntry {
+	if v := p.entry(key); v != nil {
+		v.Dirty = v.Dirty || dirty
+		v.Refs += refs
+		return v
+	}
+
+	v := &tileEntry{Key: key, Tile: p.newTile(), Dirty: dirty, Refs: refs, busy: make(chan struct{})}
+	p.tiles[key] = p.lru.PushFront(v)
+	p.mu.Unlock()
+	data, err := p.store.ReadTile(key.Level, key.Col, key.Row)
+	if err == nil && data != nil {
+		err = decodeTile(v.Tile, data)
+	}
+	p.mu.Lock()
+	if err != nil && p.err == nil {
+		p.err = err
+	}
+	close(v.busy)
+	v.busy = nil
+	p.evict()
+	return v
+}
+
+// setTile replaces the tile, the tile will be saved.
+func (p *storeTiles) setTile(key tileKey, m draw.Image) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if v := p.entry(key); v != nil {
+		v.Tile, v.Dirty = m, true
+		return
+	}
+	p.tiles[key] = p.lru.PushFront(&tileEntry{Key: key, Tile: m, Dirty: true})
+	p.evict()
+}
+
+// evict removes the least recently used tiles which are not pinned or
+// busy. The dirty tiles are saved first, and they are dropped even if the
+// saving fails.
+func (p *storeTiles) evict() {
+	for {
+		var dirty []*tileEntry
+		n := p.lru.Len()
+		for e := p.lru.Back(); e != nil && n > p.size; {
+			v := e.Value.(*tileEntry)
+			if e = e.Prev(); v.Refs > 0 || v.busy != nil {
+				continue
+			}
+			if n--; v.Dirty {
+				dirty = append(dirty, v)
+				continue
+			}
+			p.lru.Remove(p.tiles[v.Key])
+			delete(p.tiles, v.Key)
+		}
+		if len(dirty) == 0 {
+			return
+		}
+		// the saved tiles are removed by the next loop, unless they
+		// are used again during the saving
+		p.saveTiles(dirty)
+		for _, v := range dirty {
+			v.Dirty = false
+		}
+	}
+}
+
+// saveTiles saves the dirty tiles with mu unlocked, the tiles are busy
+// during the saving. The saved tiles are not dirty.
+func (p *storeTiles) saveTiles(tiles []*tileEntry) {
+	for _, v := range tiles {
+		v.busy = make(chan struct{})
+	}
+	p.mu.Unlock()
+	errs := make([]error, len(tiles))
+	for i, v := range tiles {
+		errs[i] = p.saveTile(v)
+	}
+	p.mu.Lock()
+	for i, v := range tiles {
+		if errs[i] == nil {
+			v.Dirty = false
+		} else if p.err == nil {
+			p.err = errs[i]
+		}
+		close(v.busy)
+		v.busy = nil
+	}
+}
+
+func (p *storeTiles) saveTile(v *tileEntry) (err error) {
+	data, err := encodeTile(v.Tile)
+	if err != nil {
+		return
+	}
+	return p.store.WriteTile(v.Key.Level, v.Key.Col, v.Key.Row, data)
+}
+
+// flush saves the dirty tiles which are not pinned and returns the first
+// error since the last flush.
+func (p *storeTiles) flush() (err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	var dirty []*tileEntry
+	var busy []chan struct{}
+	for e := p.lru.Front(); e != nil; e = e.Next() {
+		if v := e.Value.(*tileEntry); v.busy != nil {
+			busy = append(busy, v.busy)
+		} else if v.Dirty && v.Refs == 0 {
+			dirty = append(dirty, v)
+		}
+	}
+	p.saveTiles(dirty)
+	p.mu.Unlock()
+	// the tiles saved by the concurrent evicting are synced too
+	for _, c := range busy {
+		<-c
+	}
+	err = p.store.Sync()
+	p.mu.Lock()
+	if err != nil && p.err == nil {
+		p.err = err
+	}
+	err, p.err = p.err, nil
+	return
+}
+
+// encodeTile returns the snappy compressed pixels of the tile.
+func encodeTile(m draw.Image) (data []byte, err error) {
+	pix, err := tilePix(m)
+	if err != nil {
+		return
+	}
+	if data, err = snappy.Encode(nil, pix); err != nil {
+		err = fmt.Errorf("image/big: encodeTile, snappy err: %v", err)
+		return
+	}
+	return
+}
+
+// decodeTile decodes the data of encodeTile into the tile m.
+func decodeTile(m draw.Image, data []byte) (err error) {
+	pix, err := tilePix(m)
+	if err != nil {
+		return
+	}
+	v, err := snappy.Decode(nil, data)
+	if err != nil {
+		err = fmt.Errorf("image/big: decodeTile, snappy err: %v", err)
+		return
+	}
+	if len(v) != len(pix) {
+		err = fmt.Errorf("image/big: decodeTile, bad data size: %d, want %d", len(v), len(pix))
+		return
+	}
+	copy(pix, v)
+	return
+}
+
+// tilePix returns the pixels of the tiles made by newImageTile and
+// newDemTile.
+func tilePix(m draw.Image) ([]byte, error) {
+	switch m := m.(type) {
+	case *image.Gray:
+		return m.Pix, nil
+	case *image.Gray16:
+		return m.Pix, nil
+	case *image_ext.Gray32f:
+		return m.Pix, nil
+	case *image.RGBA:
+		return m.Pix, nil
+	case *image.RGBA64:
+		return m.Pix, nil
+	case *image_ext.RGBA128f:
+		return m.Pix, nil
+	case *image_ext.MultiBand:
+		return m.Pix, nil
+	}
+	return nil, fmt.Errorf("image/big: tilePix, unsupported tile type: %T", m)
+}
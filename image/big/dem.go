@@ -8,6 +8,8 @@ import (
 	"fmt"
 	"image"
 	"image/color"
+	"image/draw"
+	"math"
 
 	image_ext "github.com/chai2010/gopkg/image"
 	color_ext "github.com/chai2010/gopkg/image/color"
@@ -19,6 +21,15 @@ type Dem struct {
 	TileSize  image.Point
 	Rect      image.Rectangle
 	ZeroValue color_ext.Gray32f
+	NoData    color.Color // the nodata value, may be nil
+
+	// GeoTransform is the pixel to world transform of the max level, the
+	// SubLevels have the scaled GeoTransform. It is zero if the Dem is not
+	// georeferenced.
+	GeoTransform image_ext.GeoTransform
+	CRS          string // the CRS identifier, such as "EPSG:4326", may be empty
+
+	store *storeTiles // the lazy loaded tiles, see CreateDem
 }
 
 func NewDem(r image.Rectangle, tileSize image.Point, zeroValue color_ext.Gray32f) *Dem {
@@ -46,6 +57,12 @@ func (p *Dem) SubLevels(levels int) *Dem {
 		TileSize:  p.TileSize,
 		Rect:      r,
 		ZeroValue: p.ZeroValue,
+		NoData:    p.NoData,
+
+		GeoTransform: p.GeoTransform.Scale(math.Ldexp(1, p.Levels()-levels)),
+		CRS:          p.CRS,
+
+		store: p.store,
 	}
 }
 
@@ -59,12 +76,32 @@ func (p *Dem) At(x, y int) color.Color {
 
 func (p *Dem) Gray32fAt(x, y int) color_ext.Gray32f {
 	level, col, row := p.Levels()-1, x/p.TileSize.X, y/p.TileSize.Y
+	if p.store != nil {
+		m := p.getTile(level, col, row, false)
+		return m.Gray32fAt(x%p.TileSize.X, y%p.TileSize.Y)
+	}
 	if m := p.TileMap[level][col][row]; m != nil {
 		return m.At(x%p.TileSize.X, y%p.TileSize.Y).(color_ext.Gray32f)
 	}
 	return color_ext.Gray32f{}
 }
 
+// HasNoData reports whether the Dem has a nodata value.
+func (p *Dem) HasNoData() bool {
+	return p.NoData != nil
+}
+
+// IsNoData reports whether the cell at (x, y) is the nodata value, the
+// nodata cells are skipped when the pyramid is updated.
+func (p *Dem) IsNoData(x, y int) bool {
+	if p.NoData == nil {
+		return false
+	}
+	v := p.Gray32fAt(x, y).Y
+	nodata := color_ext.Gray32fModel.Convert(p.NoData).(color_ext.Gray32f).Y
+	return v == nodata || math.IsNaN(float64(v)) && math.IsNaN(float64(nodata))
+}
+
 func (p *Dem) Set(x, y int, c color.Color) {
 	if !(image.Point{x, y}.In(p.Rect)) {
 		return
@@ -94,6 +131,30 @@ func (p *Dem) adjustLevel(level int) int {
 	return level
 }
 
+// LevelGeoTransform returns the GeoTransform of the level, the pixel size
+// is doubled for each level below the max level.
+func (p *Dem) LevelGeoTransform(level int) image_ext.GeoTransform {
+	level = p.adjustLevel(level)
+	return p.GeoTransform.Scale(math.Ldexp(1, p.Levels()-1-level))
+}
+
+// Resolution returns the pixel size of the level in the world units.
+func (p *Dem) Resolution(level int) (dx, dy float64) {
+	return p.LevelGeoTransform(level).PixelSize()
+}
+
+// PixelToWorld converts the pixel coordinates of the max level to the
+// world coordinates.
+func (p *Dem) PixelToWorld(x, y float64) (wx, wy float64) {
+	return p.GeoTransform.PixelToWorld(x, y)
+}
+
+// WorldToPixel converts the world coordinates to the pixel coordinates of
+// the max level, ok is false if the Dem is not georeferenced.
+func (p *Dem) WorldToPixel(wx, wy float64) (x, y float64, ok bool) {
+	return p.GeoTransform.WorldToPixel(wx, wy)
+}
+
 func (p *Dem) TilesAcross(level int) int {
 	level = p.adjustLevel(level)
 	v := len(p.TileMap[level])
@@ -106,8 +167,17 @@ func (p *Dem) TilesDown(level int) int {
 	return v
 }
 
+// GetTile returns the tile, a new tile is made if it does not exist, see
+// Image.GetTile.
 func (p *Dem) GetTile(level, col, row int) (m *image_ext.Gray32f) {
+	return p.getTile(level, col, row, true)
+}
+
+func (p *Dem) getTile(level, col, row int, dirty bool) (m *image_ext.Gray32f) {
 	level = p.adjustLevel(level)
+	if p.store != nil {
+		return p.store.getTile(tileKey{level, col, row}, dirty).(*image_ext.Gray32f)
+	}
 	if m = p.TileMap[level][col][row]; m != nil {
 		return
 	}
@@ -122,6 +192,12 @@ func (p *Dem) SetTile(level, col, row int, m *image_ext.Gray32f) (err error) {
 		err = fmt.Errorf("image/big: Dem.SetTile, bad bound size: %v", m.Bounds())
 		return
 	}
+	if p.store != nil {
+		tile := p.store.newTile()
+		draw_ext.Draw(tile, tile.Bounds(), m, image.Pt(0, 0))
+		p.store.setTile(tileKey{level, col, row}, tile)
+		return
+	}
 	p.TileMap[level][col][row] = m
 	return
 }
@@ -152,7 +228,7 @@ func (p *Dem) ReadRect(level int, r image.Rectangle, buf *image_ext.Gray32f) (m
 	m = newDemTile(r.Size(), p.ZeroValue)
 	for col := tMinX; col < tMaxX; col++ {
 		for row := tMinY; row < tMaxY; row++ {
-			p.readRectFromTile(m, p.GetTile(level, col, row), r.Min.X, r.Min.Y, r.Dx(), r.Dy(), col, row)
+			p.readRectFromTile(m, p.getTile(level, col, row, false), r.Min.X, r.Min.Y, r.Dx(), r.Dy(), col, row)
 		}
 	}
 	return
@@ -181,7 +257,7 @@ func (p *Dem) readRectFromTile(dst, tile *image_ext.Gray32f, x, y, dx, dy, col,
 	draw_ext.Draw(
 		dst, image.Rect(
 			zMinX-bMinX,
-			zMinY-bMinX,
+			zMinY-bMinY,
 			zMaxX-bMinX,
 			zMaxY-bMinY,
 		),
@@ -194,6 +270,14 @@ func (p *Dem) readRectFromTile(dst, tile *image_ext.Gray32f, x, y, dx, dy, col,
 }
 
 func (p *Dem) WriteRect(level int, r image.Rectangle, m *image_ext.Gray32f) (err error) {
+	return p.WriteRectProgress(level, r, m, nil)
+}
+
+// WriteRectProgress is like WriteRect, but it reports the progress of the
+// tile writing and the pyramid updating to fn, and returns
+// image_ext.ErrCanceled if fn returns false. The Dem has no dirty tiles,
+// the pyramid of a canceled rectangle is updated by writing it again.
+func (p *Dem) WriteRectProgress(level int, r image.Rectangle, m *image_ext.Gray32f, fn image_ext.ProgressFunc) (err error) {
 	level = p.adjustLevel(level)
 	if !r.In(p.Bounds()) || level < 0 || level >= p.Levels() {
 		err = fmt.Errorf("image/big: Dem.WriteRect, r = %v, level = %v", r, level)
@@ -212,13 +296,23 @@ func (p *Dem) WriteRect(level int, r image.Rectangle, m *image_ext.Gray32f) (err
 		tMaxY = max
 	}
 
+	pyramid := p.rectPyramidKeys(level, r.Min.X, r.Min.Y, r.Dx(), r.Dy())
+	steps := (tMaxX - tMinX) * (tMaxY - tMinY)
+	for _, v := range pyramid {
+		steps += len(v)
+	}
+	progress := image_ext.NewProgress(fn, steps)
+
 	for col := tMinX; col < tMaxX; col++ {
 		for row := tMinY; row < tMaxY; row++ {
 			p.writeRectToTile(m, p.GetTile(level, col, row), r.Min.X, r.Min.Y, r.Dx(), r.Dy(), col, row)
+			if !progress.Step(1) {
+				return image_ext.ErrCanceled
+			}
 		}
 	}
 
-	err = p.updateRectPyramid(level, r.Min.X, r.Min.Y, r.Dx(), r.Dy())
+	err = p.updateRectPyramid(pyramid, progress)
 	return
 }
 
@@ -257,7 +351,9 @@ func (p *Dem) writeRectToTile(src, tile *image_ext.Gray32f, x, y, dx, dy, col, r
 	return
 }
 
-func (p *Dem) updateRectPyramid(level, x, y, dx, dy int) (err error) {
+// rectPyramidKeys returns the tiles whose parents are changed by the
+// writing of the rectangle of the level, from the bottom level up.
+func (p *Dem) rectPyramidKeys(level, x, y, dx, dy int) (keys [][]tileKey) {
 	for level > 0 && dx > 0 && dy > 0 {
 		minX, minY := x, y
 		maxX, maxY := x+dx-1, y+dy-1
@@ -267,6 +363,7 @@ func (p *Dem) updateRectPyramid(level, x, y, dx, dy int) (err error) {
 		tMaxCol := maxX / p.TileSize.X
 		tMaxRow := maxY / p.TileSize.Y
 
+		var v []tileKey
 		for row := tMinRow; row <= tMaxRow; row++ {
 			if row >= p.TilesDown(level) {
 				continue
@@ -275,11 +372,10 @@ func (p *Dem) updateRectPyramid(level, x, y, dx, dy int) (err error) {
 				if col >= p.TilesAcross(level) {
 					continue
 				}
-				if err = p.updateParentTile(level, col, row); err != nil {
-					return
-				}
+				v = append(v, tileKey{level, col, row})
 			}
 		}
+		keys = append(keys, v)
 
 		x, dx = minX/2, maxX/2-minX/2
 		y, dy = minY/2, maxY/2-minY/2
@@ -288,33 +384,32 @@ func (p *Dem) updateRectPyramid(level, x, y, dx, dy int) (err error) {
 	return
 }
 
+func (p *Dem) updateRectPyramid(keys [][]tileKey, progress *image_ext.Progress) (err error) {
+	for _, v := range keys {
+		for _, key := range v {
+			if err = p.updateParentTile(key.Level, key.Col, key.Row); err != nil {
+				return
+			}
+			if !progress.Step(1) {
+				return image_ext.ErrCanceled
+			}
+		}
+	}
+	return
+}
+
 func (p *Dem) updateParentTile(level, col, row int) (err error) {
-	parent, child := p.GetTile(level-1, col/2, row/2), p.GetTile(level, col, row)
-	switch {
-	case col%2 == 0 && row%2 == 0:
-		draw_ext.DrawPyrDown(
-			parent, image.Rect((p.TileSize.X/2)*0, (p.TileSize.Y/2)*0, p.TileSize.X/2, p.TileSize.Y/2),
-			child, image.Pt(0, 0),
-			draw_ext.Filter_Average,
-		)
-	case col%2 == 0 && row%2 == 1:
-		draw_ext.DrawPyrDown(
-			parent, image.Rect((p.TileSize.X/2)*0, (p.TileSize.Y/2)*1, p.TileSize.X/2, p.TileSize.Y/2),
-			child, image.Pt(0, 0),
-			draw_ext.Filter_Average,
-		)
-	case col%2 == 1 && row%2 == 1:
-		draw_ext.DrawPyrDown(
-			parent, image.Rect((p.TileSize.X/2)*1, (p.TileSize.Y/2)*1, p.TileSize.X/2, p.TileSize.Y/2),
-			child, image.Pt(0, 0),
-			draw_ext.Filter_Average,
-		)
-	case col%2 == 1 && row%2 == 0:
-		draw_ext.DrawPyrDown(
-			parent, image.Rect((p.TileSize.X/2)*1, (p.TileSize.Y/2)*0, p.TileSize.X/2, p.TileSize.Y/2),
-			child, image.Pt(0, 0),
-			draw_ext.Filter_Average,
-		)
+	var parent draw.Image = p.GetTile(level-1, col/2, row/2)
+	var child image.Image = p.getTile(level, col, row, false)
+	if p.NoData != nil {
+		parent = image_ext.NewMaskedImage(parent, p.NoData, nil)
+		child = image_ext.NewMaskedImage(child.(draw.Image), p.NoData, nil)
 	}
+	dx, dy := p.TileSize.X/2, p.TileSize.Y/2
+	draw_ext.DrawPyrDown(
+		parent, image.Rect(0, 0, dx, dy).Add(image.Pt((col%2)*dx, (row%2)*dy)),
+		child, image.Pt(0, 0),
+		draw_ext.Filter_Average,
+	)
 	return
 }
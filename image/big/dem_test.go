@@ -5,9 +5,99 @@
 package big
 
 import (
+	"image"
+	"math"
 	"testing"
+
+	image_ext "github.com/chai2010/gopkg/image"
+	color_ext "github.com/chai2010/gopkg/image/color"
 )
 
 func TestDem(t *testing.T) {
 	//
 }
+
+func TestDem_geoTransform(t *testing.T) {
+	dem := NewDem(image.Rect(0, 0, 1000, 600), image.Pt(128, 128), color_ext.Gray32f{})
+	dem.GeoTransform = image_ext.NewGeoTransform(500000, 4200000, 30, 30)
+	dem.CRS = "EPSG:32650"
+
+	if dx, dy := dem.Resolution(-1); dx != 30 || dy != 30 {
+		t.Fatalf("bad resolution of max level: (%v, %v)", dx, dy)
+	}
+	for level := 0; level < dem.Levels(); level++ {
+		sub := dem.SubLevels(level + 1)
+		want := 30 * math.Ldexp(1, dem.Levels()-1-level)
+		if dx, dy := sub.Resolution(-1); dx != want || dy != want {
+			t.Fatalf("level %d: bad resolution; got (%v, %v), want %v", level, dx, dy, want)
+		}
+		if dx, _ := dem.Resolution(level); dx != want {
+			t.Fatalf("level %d: bad Resolution; got %v, want %v", level, dx, want)
+		}
+		if sub.CRS != dem.CRS {
+			t.Fatalf("level %d: bad CRS: %q", level, sub.CRS)
+		}
+		// the corners of the levels are the same place
+		b := sub.Bounds()
+		x0, y0 := sub.PixelToWorld(0, 0)
+		x1, y1 := dem.PixelToWorld(float64(b.Max.X)*want/30, float64(b.Max.Y)*want/30)
+		if x, y := sub.PixelToWorld(float64(b.Max.X), float64(b.Max.Y)); x != x1 || y != y1 || x0 != 500000 || y0 != 4200000 {
+			t.Fatalf("level %d: bad corners: (%v, %v) - (%v, %v)", level, x0, y0, x, y)
+		}
+	}
+	if x, y, ok := dem.WorldToPixel(500000+30*10, 4200000-30*20); !ok || x != 10 || y != 20 {
+		t.Fatalf("bad WorldToPixel: (%v, %v, %v)", x, y, ok)
+	}
+}
+
+func TestDem_WriteRectProgress(t *testing.T) {
+	dem := NewDem(image.Rect(0, 0, 512, 512), image.Pt(64, 64), color_ext.Gray32f{})
+	m := image_ext.NewGray32f(dem.Bounds())
+
+	var last float64
+	if err := dem.WriteRectProgress(-1, m.Bounds(), m, tProgress(t, 1<<30, &last)); err != nil {
+		t.Fatal(err)
+	}
+	if last != 1 {
+		t.Fatalf("bad progress: %v", last)
+	}
+	if err := dem.WriteRectProgress(-1, m.Bounds(), m, tProgress(t, 10, new(float64))); err != image_ext.ErrCanceled {
+		t.Fatalf("expect ErrCanceled, got %v", err)
+	}
+}
+
+func TestDem_noData(t *testing.T) {
+	nodata := color_ext.Gray32f{Y: -9999}
+	dem := NewDem(image.Rect(0, 0, 512, 512), image.Pt(256, 256), nodata)
+	dem.NoData = nodata
+
+	for i, v := range []struct {
+		Pt     image.Point
+		Values [4]float32
+		Want   float32
+	}{
+		{image.Pt(0, 0), [4]float32{10, -9999, 20, -9999}, 15},
+		{image.Pt(4, 0), [4]float32{-9999, -9999, -9999, -9999}, -9999},
+		{image.Pt(256, 0), [4]float32{8, 8, 8, -9999}, 8},
+		{image.Pt(256, 256), [4]float32{1, 2, 3, 6}, 3},
+	} {
+		m := image_ext.NewGray32f(image.Rect(0, 0, 2, 2))
+		for k, y := range v.Values {
+			m.SetGray32f(k%2, k/2, color_ext.Gray32f{Y: y})
+		}
+		if err := dem.WriteRect(-1, image.Rect(0, 0, 2, 2).Add(v.Pt), m); err != nil {
+			t.Fatalf("%d: WriteRect: %v", i, err)
+		}
+		pt := v.Pt.Div(2)
+		tile := dem.GetTile(-2, 0, 0)
+		if got := tile.Gray32fAt(pt.X, pt.Y).Y; got != v.Want {
+			t.Fatalf("%d: bad parent value at %v; got %v, want %v", i, pt, got, v.Want)
+		}
+	}
+	if !dem.IsNoData(4, 0) || dem.IsNoData(0, 0) {
+		t.Fatalf("bad IsNoData")
+	}
+	if sub := dem.SubLevels(1); sub.NoData != dem.NoData {
+		t.Fatalf("SubLevels: bad nodata; got %v, want %v", sub.NoData, dem.NoData)
+	}
+}
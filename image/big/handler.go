@@ -0,0 +1,424 @@
+// Copyright 2014 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package big
+
+import (
+	"bytes"
+	"container/list"
+	"fmt"
+	"hash/crc64"
+	"image/draw"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	image_ext "github.com/chai2010/gopkg/image"
+)
+
+// TileScheme is the tile row order of TileHandler.
+type TileScheme int
+
+const (
+	TileScheme_XYZ TileScheme = iota // the row 0 is the top row, like OpenStreetMap
+	TileScheme_TMS                   // the row 0 is the bottom row
+)
+
+// DefaultTileCRS is the WMTS CRS of TileHandler, the unknown engineering
+// CRS. The coordinates are the pixel coordinates of the max level, and
+// the y axis is upward.
+const DefaultTileCRS = "urn:ogc:def:crs:EPSG::404000"
+
+// TileHandler is a http.Handler which serves the tiles of an Image for
+// the web maps. The paths are relative to Prefix:
+//
+//	/{z}/{x}/{y}.{png|jpg|webp}                  the XYZ or TMS tiles
+//	/wmts/{TileMatrix}/{TileCol}/{TileRow}.{ext} the WMTS RESTful tiles
+//	/wmts/1.0.0/WMTSCapabilities.xml             the WMTS capabilities
+//	/wmts?SERVICE=WMTS&REQUEST=GetCapabilities   the WMTS KVP requests
+//
+// The level z is the pyramid level of Image, the level 0 is the smallest.
+// The tiles are encoded by the registered image formats, so the format
+// packages, such as image/png, must be imported.
+//
+// The encoded tiles are cached, the ETag is the checksum of the tile
+// pixels, so the changed tiles are encoded again. It can be added to the
+// web package server like this:
+//
+//	h := big.NewTileHandler(m, "/tiles")
+//	web.Handler("/tiles/.*", "GET", h)
+//
+// A TileHandler literal with Image may be used too, the cache is created
+// with DefaultTileCacheSize by the first request.
+type TileHandler struct {
+	Image   *Image
+	Prefix  string             // the URL path prefix, such as "/tiles"
+	Scheme  TileScheme         // the row order of the /{z}/{x}/{y} tiles
+	Title   string             // the WMTS layer title
+	CRS     string             // the WMTS CRS, DefaultTileCRS if empty
+	Options *image_ext.Options // the encoding options, may be nil
+	MaxAge  time.Duration      // the max-age of Cache-Control, 0 means no-cache
+
+	cache     *encodedTiles
+	cacheOnce sync.Once
+}
+
+// DefaultTileCacheSize is the default max number of the encoded tiles
+// which are cached by TileHandler.
+const DefaultTileCacheSize = 256
+
+// NewTileHandler returns a TileHandler of m.
+func NewTileHandler(m *Image, prefix string) *TileHandler {
+	return &TileHandler{
+		Image:  m,
+		Prefix: strings.TrimSuffix(prefix, "/"),
+		Title:  "big",
+	}
+}
+
+// tileCache returns the cache of the encoded tiles.
+func (p *TileHandler) tileCache() *encodedTiles {
+	p.cacheOnce.Do(func() {
+		p.cache = newEncodedTiles(DefaultTileCacheSize)
+	})
+	return p.cache
+}
+
+func (p *TileHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" && r.Method != "HEAD" {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !strings.HasPrefix(r.URL.Path, p.Prefix+"/") {
+		http.NotFound(w, r)
+		return
+	}
+	path := strings.TrimPrefix(r.URL.Path, p.Prefix)
+
+	switch {
+	case path == "/wmts" || path == "/wmts/":
+		p.serveWMTS(w, r)
+	case path == "/wmts/1.0.0/WMTSCapabilities.xml":
+		p.serveCapabilities(w, r)
+	case strings.HasPrefix(path, "/wmts/"):
+		p.servePath(w, r, strings.TrimPrefix(path, "/wmts"), TileScheme_XYZ)
+	default:
+		p.servePath(w, r, path, p.Scheme)
+	}
+}
+
+// servePath serves the tile of the path "/{z}/{x}/{y}.{ext}".
+func (p *TileHandler) servePath(w http.ResponseWriter, r *http.Request, path string, scheme TileScheme) {
+	v := strings.Split(strings.TrimPrefix(path, "/"), "/")
+	if len(v) != 3 {
+		http.NotFound(w, r)
+		return
+	}
+	idx := strings.LastIndex(v[2], ".")
+	if idx < 0 {
+		http.NotFound(w, r)
+		return
+	}
+	ext := v[2][idx:]
+	v[2] = v[2][:idx]
+
+	var key [3]int
+	for i := range key {
+		n, err := strconv.Atoi(v[i])
+		if err != nil {
+			http.NotFound(w, r)
+			return
+		}
+		key[i] = n
+	}
+	p.serveTile(w, r, key[0], key[1], key[2], scheme, ext)
+}
+
+// serveWMTS serves the WMTS KVP requests.
+func (p *TileHandler) serveWMTS(w http.ResponseWriter, r *http.Request) {
+	q := make(map[string]string)
+	for k, v := range r.URL.Query() {
+		q[strings.ToUpper(k)] = v[0]
+	}
+	if !strings.EqualFold(q["SERVICE"], "WMTS") {
+		http.Error(w, "bad SERVICE", http.StatusBadRequest)
+		return
+	}
+	switch strings.ToUpper(q["REQUEST"]) {
+	case "GETCAPABILITIES":
+		p.serveCapabilities(w, r)
+	case "GETTILE":
+		level, err0 := strconv.Atoi(q["TILEMATRIX"])
+		col, err1 := strconv.Atoi(q["TILECOL"])
+		row, err2 := strconv.Atoi(q["TILEROW"])
+		if err0 != nil || err1 != nil || err2 != nil {
+			http.Error(w, "bad TILEMATRIX, TILECOL or TILEROW", http.StatusBadRequest)
+			return
+		}
+		ext := "." + strings.TrimPrefix(strings.ToLower(q["FORMAT"]), "image/")
+		p.serveTile(w, r, level, col, row, TileScheme_XYZ, ext)
+	default:
+		http.Error(w, "bad REQUEST", http.StatusBadRequest)
+	}
+}
+
+func (p *TileHandler) serveTile(w http.ResponseWriter, r *http.Request, level, col, row int, scheme TileScheme, ext string) {
+	m := p.Image
+	if level < 0 || level >= m.Levels() {
+		http.NotFound(w, r)
+		return
+	}
+	if col < 0 || col >= m.TilesAcross(level) || row < 0 || row >= m.TilesDown(level) {
+		http.NotFound(w, r)
+		return
+	}
+	if scheme == TileScheme_TMS {
+		row = m.TilesDown(level) - 1 - row
+	}
+	format := image_ext.FormatByExtension(ext)
+	if format == "" {
+		http.NotFound(w, r)
+		return
+	}
+
+	data, etag, err := p.encodeTile(tileKey{level, col, row}, format)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("ETag", etag)
+	if p.MaxAge > 0 {
+		w.Header().Set("Cache-Control", fmt.Sprintf("max-age=%d", int(p.MaxAge/time.Second)))
+	} else {
+		w.Header().Set("Cache-Control", "no-cache")
+	}
+	if match := r.Header.Get("If-None-Match"); match != "" {
+		for _, v := range strings.Split(match, ",") {
+			if v = strings.TrimSpace(v); v == etag || v == "*" {
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+		}
+	}
+	w.Header().Set("Content-Type", tileContentType(format))
+	w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+	if r.Method != "HEAD" {
+		w.Write(data)
+	}
+}
+
+// encodeTile returns the encoded tile and the ETag. The tile is copied
+// with the read lock, and encoded if it is not in the cache.
+func (p *TileHandler) encodeTile(key tileKey, format string) (data []byte, etag string, err error) {
+	var tile draw.Image
+	p.Image.readTile(key, func(m draw.Image) {
+		pix, err1 := tilePix(m)
+		if err1 != nil {
+			err = err1
+			return
+		}
+		etag = fmt.Sprintf(`"%s-%016x"`, format, crc64.Checksum(pix, tileCRCTable))
+		if data = p.tileCache().get(key, etag); data != nil {
+			return
+		}
+		tile = newImageTile(p.Image.TileSize, p.Image.Model)
+		clone, _ := tilePix(tile)
+		copy(clone, pix)
+	})
+	if err != nil || data != nil {
+		return
+	}
+
+	var buf bytes.Buffer
+	if err = image_ext.Encode(format, &buf, tile, p.Options); err != nil {
+		err = fmt.Errorf("image/big: TileHandler, encode %s: %v", format, err)
+		return
+	}
+	data = buf.Bytes()
+	p.tileCache().add(key, etag, data)
+	return
+}
+
+var tileCRCTable = crc64.MakeTable(crc64.ECMA)
+
+func tileContentType(format string) string {
+	switch format {
+	case "jpeg":
+		return "image/jpeg"
+	case "png":
+		return "image/png"
+	case "webp":
+		return "image/webp"
+	}
+	return "application/octet-stream"
+}
+
+// serveCapabilities serves the WMTS capabilities document.
+func (p *TileHandler) serveCapabilities(w http.ResponseWriter, r *http.Request) {
+	m := p.Image
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	v := &tileCapabilities{
+		URL:   scheme + "://" + r.Host + p.Prefix,
+		Title: p.Title,
+		CRS:   p.CRS,
+	}
+	if v.CRS == "" {
+		v.CRS = DefaultTileCRS
+	}
+	for _, ext := range []string{".png", ".jpg", ".webp"} {
+		if format := image_ext.FormatByExtension(ext); format != "" {
+			v.Formats = append(v.Formats, tileFormat{tileContentType(format), ext})
+		}
+	}
+	for level := 0; level < m.Levels(); level++ {
+		res := math.Ldexp(1, m.Levels()-1-level)
+		v.Matrixes = append(v.Matrixes, tileMatrix{
+			Level:        level,
+			Scale:        res / 0.00028,
+			Left:         float64(m.Rect.Min.X),
+			Top:          -float64(m.Rect.Min.Y),
+			TileWidth:    m.TileSize.X,
+			TileHeight:   m.TileSize.Y,
+			MatrixWidth:  m.TilesAcross(level),
+			MatrixHeight: m.TilesDown(level),
+		})
+	}
+
+	var buf bytes.Buffer
+	if err := tileCapabilitiesTemplate.Execute(&buf, v); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+	w.Write(buf.Bytes())
+}
+
+type tileFormat struct {
+	MimeType string
+	Ext      string
+}
+
+type tileMatrix struct {
+	Level                     int
+	Scale                     float64
+	Left, Top                 float64
+	TileWidth, TileHeight     int
+	MatrixWidth, MatrixHeight int
+}
+
+type tileCapabilities struct {
+	URL      string
+	Title    string
+	CRS      string
+	Formats  []tileFormat
+	Matrixes []tileMatrix
+}
+
+var tileCapabilitiesTemplate = template.Must(template.New("wmts").Funcs(template.FuncMap{
+	"xml": func(s string) string {
+		var buf bytes.Buffer
+		template.HTMLEscape(&buf, []byte(s))
+		return buf.String()
+	},
+}).Parse(`<?xml version="1.0" encoding="UTF-8"?>
+<Capabilities xmlns="http://www.opengis.net/wmts/1.0" xmlns:ows="http://www.opengis.net/ows/1.1" xmlns:xlink="http://www.w3.org/1999/xlink" version="1.0.0">
+  <ows:ServiceIdentification>
+    <ows:Title>{{xml .Title}}</ows:Title>
+    <ows:ServiceType>OGC WMTS</ows:ServiceType>
+    <ows:ServiceTypeVersion>1.0.0</ows:ServiceTypeVersion>
+  </ows:ServiceIdentification>
+  <ows:OperationsMetadata>
+    <ows:Operation name="GetCapabilities">
+      <ows:DCP><ows:HTTP><ows:Get xlink:href="{{xml .URL}}/wmts?"/></ows:HTTP></ows:DCP>
+    </ows:Operation>
+    <ows:Operation name="GetTile">
+      <ows:DCP><ows:HTTP><ows:Get xlink:href="{{xml .URL}}/wmts?"/></ows:HTTP></ows:DCP>
+    </ows:Operation>
+  </ows:OperationsMetadata>
+  <Contents>
+    <Layer>
+      <ows:Title>{{xml .Title}}</ows:Title>
+      <ows:Identifier>{{xml .Title}}</ows:Identifier>
+      <Style isDefault="true"><ows:Identifier>default</ows:Identifier></Style>
+{{- range .Formats}}
+      <Format>{{.MimeType}}</Format>
+{{- end}}
+      <TileMatrixSetLink><TileMatrixSet>{{xml .Title}}</TileMatrixSet></TileMatrixSetLink>
+{{- $url := .URL}}
+{{- range .Formats}}
+      <ResourceURL format="{{.MimeType}}" resourceType="tile" template="{{xml $url}}/wmts/{TileMatrix}/{TileCol}/{TileRow}{{.Ext}}"/>
+{{- end}}
+    </Layer>
+    <TileMatrixSet>
+      <ows:Identifier>{{xml .Title}}</ows:Identifier>
+      <ows:SupportedCRS>{{xml .CRS}}</ows:SupportedCRS>
+{{- range .Matrixes}}
+      <TileMatrix>
+        <ows:Identifier>{{.Level}}</ows:Identifier>
+        <ScaleDenominator>{{.Scale}}</ScaleDenominator>
+        <TopLeftCorner>{{.Left}} {{.Top}}</TopLeftCorner>
+        <TileWidth>{{.TileWidth}}</TileWidth>
+        <TileHeight>{{.TileHeight}}</TileHeight>
+        <MatrixWidth>{{.MatrixWidth}}</MatrixWidth>
+        <MatrixHeight>{{.MatrixHeight}}</MatrixHeight>
+      </TileMatrix>
+{{- end}}
+    </TileMatrixSet>
+  </Contents>
+</Capabilities>
+`))
+
+// encodedTiles is a LRU cache of the encoded tiles.
+type encodedTiles struct {
+	mu    sync.Mutex
+	size  int
+	lru   *list.List // *encodedTile, the front is the most recently used
+	tiles map[string]*list.Element
+}
+
+type encodedTile struct {
+	Key  string
+	Data []byte
+}
+
+func newEncodedTiles(size int) *encodedTiles {
+	return &encodedTiles{
+		size:  size,
+		lru:   list.New(),
+		tiles: make(map[string]*list.Element),
+	}
+}
+
+func (p *encodedTiles) get(key tileKey, etag string) []byte {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if e, ok := p.tiles[fmt.Sprint(key, etag)]; ok {
+		p.lru.MoveToFront(e)
+		return e.Value.(*encodedTile).Data
+	}
+	return nil
+}
+
+func (p *encodedTiles) add(key tileKey, etag string, data []byte) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	k := fmt.Sprint(key, etag)
+	if _, ok := p.tiles[k]; ok {
+		return
+	}
+	p.tiles[k] = p.lru.PushFront(&encodedTile{Key: k, Data: data})
+	for p.lru.Len() > p.size {
+		e := p.lru.Back()
+		p.lru.Remove(e)
+		delete(p.tiles, e.Value.(*encodedTile).Key)
+	}
+}
@@ -0,0 +1,129 @@
+// Copyright 2014 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package big
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	image_ext "github.com/chai2010/gopkg/image"
+	_ "github.com/chai2010/gopkg/image/png"
+)
+
+func tGetTile(t *testing.T, h http.Handler, path, etag string) (code int, header http.Header, body []byte) {
+	req, err := http.NewRequest("GET", "http://example.com"+path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if etag != "" {
+		req.Header.Set("If-None-Match", etag)
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	body, _ = ioutil.ReadAll(w.Body)
+	return w.Code, w.Header(), body
+}
+
+func TestTileHandler(t *testing.T) {
+	m := NewImage(image.Rect(0, 0, 300, 200), image.Pt(64, 64), color.RGBAModel)
+	m.WriteRect(-1, image.Rect(0, 0, 64, 64), image.NewUniform(color.RGBA{255, 0, 0, 255}))
+	h := NewTileHandler(m, "/tiles/")
+
+	code, header, body := tGetTile(t, h, "/tiles/2/0/0.png", "")
+	if code != http.StatusOK {
+		t.Fatalf("bad status: %d, %s", code, body)
+	}
+	if v := header.Get("Content-Type"); v != "image/png" {
+		t.Fatalf("bad Content-Type: %q", v)
+	}
+	tile, format, err := image_ext.Decode(bytes.NewReader(body), nil)
+	if err != nil || format != "png" {
+		t.Fatalf("bad tile: %q, %v", format, err)
+	}
+	if tile.Bounds() != image.Rect(0, 0, 64, 64) {
+		t.Fatalf("bad tile bounds: %v", tile.Bounds())
+	}
+	if _, _, _, a := tile.At(0, 0).RGBA(); a == 0 {
+		t.Fatalf("bad tile color: %v", tile.At(0, 0))
+	}
+
+	// ETag
+	etag := header.Get("ETag")
+	if code, _, _ = tGetTile(t, h, "/tiles/2/0/0.png", etag); code != http.StatusNotModified {
+		t.Fatalf("bad status with If-None-Match: %d", code)
+	}
+	m.WriteRect(-1, image.Rect(0, 0, 1, 1), image.NewUniform(color.RGBA{0, 255, 0, 255}))
+	if code, header, _ = tGetTile(t, h, "/tiles/2/0/0.png", etag); code != http.StatusOK {
+		t.Fatalf("changed tile: bad status: %d", code)
+	}
+	if header.Get("ETag") == etag {
+		t.Fatalf("changed tile: ETag is not changed")
+	}
+
+	// TMS
+	h.Scheme = TileScheme_TMS
+	_, _, tms := tGetTile(t, h, "/tiles/2/1/0.png", "")
+	h.Scheme = TileScheme_XYZ
+	_, _, xyz := tGetTile(t, h, fmt.Sprintf("/tiles/2/1/%d.png", m.TilesDown(2)-1), "")
+	if !bytes.Equal(tms, xyz) {
+		t.Fatalf("TMS and XYZ tiles are different")
+	}
+
+	// WMTS
+	_, _, wmts := tGetTile(t, h, fmt.Sprintf("/tiles/wmts?SERVICE=WMTS&REQUEST=GetTile&TILEMATRIX=2&TILECOL=1&TILEROW=%d&FORMAT=image/png", m.TilesDown(2)-1), "")
+	if !bytes.Equal(wmts, xyz) {
+		t.Fatalf("WMTS GetTile and XYZ tiles are different")
+	}
+	_, _, rest := tGetTile(t, h, fmt.Sprintf("/tiles/wmts/2/1/%d.png", m.TilesDown(2)-1), "")
+	if !bytes.Equal(rest, xyz) {
+		t.Fatalf("WMTS RESTful and XYZ tiles are different")
+	}
+	code, header, body = tGetTile(t, h, "/tiles/wmts/1.0.0/WMTSCapabilities.xml", "")
+	if code != http.StatusOK || !strings.HasPrefix(header.Get("Content-Type"), "application/xml") {
+		t.Fatalf("bad capabilities: %d, %q", code, header.Get("Content-Type"))
+	}
+	if n := strings.Count(string(body), "<TileMatrix>"); n != m.Levels() {
+		t.Fatalf("bad TileMatrix number: %d, want %d", n, m.Levels())
+	}
+	if !strings.Contains(string(body), `template="http://example.com/tiles/wmts/{TileMatrix}/{TileCol}/{TileRow}.png"`) {
+		t.Fatalf("bad capabilities: %s", body)
+	}
+
+	for _, path := range []string{
+		"/tiles/9/0/0.png",
+		"/tiles/2/5/0.png",
+		"/tiles/2/0/0.gif2",
+		"/tiles/2/0.png",
+		"/tiles/a/0/0.png",
+		"/other/2/0/0.png",
+	} {
+		if code, _, _ := tGetTile(t, h, path, ""); code != http.StatusNotFound {
+			t.Fatalf("%s: bad status: %d", path, code)
+		}
+	}
+}
+
+func TestTileHandler_literal(t *testing.T) {
+	m := NewImage(image.Rect(0, 0, 300, 200), image.Pt(64, 64), color.RGBAModel)
+	h := &TileHandler{Image: m, Prefix: "/tiles"}
+
+	code, header, body := tGetTile(t, h, "/tiles/2/0/0.png", "")
+	if code != http.StatusOK {
+		t.Fatalf("bad status: %d, %s", code, body)
+	}
+	if code, _, _ = tGetTile(t, h, "/tiles/2/0/0.png", header.Get("ETag")); code != http.StatusNotModified {
+		t.Fatalf("bad status with If-None-Match: %d", code)
+	}
+	if _, _, cached := tGetTile(t, h, "/tiles/2/0/0.png", ""); !bytes.Equal(cached, body) {
+		t.Fatalf("cached tile is different")
+	}
+}
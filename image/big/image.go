@@ -9,18 +9,28 @@ import (
 	"image"
 	"image/color"
 	"image/draw"
+	"runtime"
 	"sync"
 
 	image_ext "github.com/chai2010/gopkg/image"
 	draw_ext "github.com/chai2010/gopkg/image/draw"
 )
 
+// Image is a big pyramid image. The methods are safe for concurrent use,
+// the tiles are locked one by one, so many goroutines can read and write
+// the disjoint rectangles at the same time.
 type Image struct {
 	TileSize image.Point
-	Model    color.Model // Gray/Gray16/Gray32f/RGBA/RGBA64/RGBA128f
+	Model    color.Model // Gray/Gray16/Gray32f/RGBA/RGBA64/RGBA128f/*MultiBandModel
 	Rect     image.Rectangle
-	tileMap  [][][]draw.Image // m.tileMap[level][col][row]
-	mu       sync.Mutex
+
+	// DeferPyramid defers the pyramid updating of WriteRect, the parent
+	// tiles are updated by FlushPyramid.
+	DeferPyramid bool
+
+	tileMap [][][]draw.Image // m.tileMap[level][col][row]
+	locks   *imageLocks
+	store   *storeTiles // the lazy loaded tiles, see Create
 }
 
 func NewImage(r image.Rectangle, tileSize image.Point, model color.Model) *Image {
@@ -35,6 +45,7 @@ func NewImage(r image.Rectangle, tileSize image.Point, model color.Model) *Image
 		TileSize: tileSize,
 		Rect:     r,
 		Model:    model,
+		locks:    newImageLocks(),
 	}
 }
 
@@ -47,11 +58,13 @@ func (p *Image) SubLevels(levels int) *Image {
 		r.Max.Y /= 2
 	}
 	return &Image{
-		tileMap:  p.tileMap[:levels],
-		TileSize: p.TileSize,
-		Rect:     r,
-		Model:    p.Model,
-		mu:       p.mu,
+		tileMap:      p.tileMap[:levels],
+		TileSize:     p.TileSize,
+		Rect:         r,
+		Model:        p.Model,
+		DeferPyramid: p.DeferPyramid,
+		locks:        p.locks,
+		store:        p.store,
 	}
 }
 
@@ -63,8 +76,10 @@ func (p *Image) At(x, y int) color.Color {
 	if !(image.Point{x, y}.In(p.Rect)) {
 		return color.Gray{}
 	}
-	m := p.GetTile(p.Levels()-1, x/p.TileSize.X, y/p.TileSize.Y)
-	c := m.At(x%p.TileSize.X, y%p.TileSize.Y)
+	var c color.Color
+	p.readTile(tileKey{p.Levels() - 1, x / p.TileSize.X, y / p.TileSize.Y}, func(m draw.Image) {
+		c = m.At(x%p.TileSize.X, y%p.TileSize.Y)
+	})
 	return c
 }
 
@@ -72,8 +87,9 @@ func (p *Image) Set(x, y int, c color.Color) {
 	if !(image.Point{x, y}.In(p.Rect)) {
 		return
 	}
-	m := p.GetTile(p.Levels()-1, x/p.TileSize.X, y/p.TileSize.Y)
-	m.Set(x%p.TileSize.X, y%p.TileSize.Y, c)
+	p.writeTile(tileKey{p.Levels() - 1, x / p.TileSize.X, y / p.TileSize.Y}, func(m draw.Image) {
+		m.Set(x%p.TileSize.X, y%p.TileSize.Y, c)
+	})
 	return
 }
 
@@ -100,10 +116,25 @@ func (p *Image) TilesDown(level int) int {
 	return v
 }
 
+// GetTile returns the tile, a new tile is made if it does not exist. The
+// tile is not locked, it should not be used with the concurrent writing.
+//
+// If the image is backed by a TileStore, the tile will be saved, and the
+// tile may be evicted from the cache by the later tile loading, then the
+// later changes of the evicted tile are lost.
 func (p *Image) GetTile(level, col, row int) (m draw.Image) {
-	p.mu.Lock()
-	defer p.mu.Unlock()
+	return p.getTile(level, col, row, true)
+}
+
+// getTile returns the tile, the tile is not saved to the TileStore if it
+// is not dirty.
+func (p *Image) getTile(level, col, row int, dirty bool) (m draw.Image) {
 	level = p.adjustLevel(level)
+	if p.store != nil {
+		return p.store.getTile(tileKey{level, col, row}, dirty)
+	}
+	p.locks.mu.Lock()
+	defer p.locks.mu.Unlock()
 	if m = p.tileMap[level][col][row]; m != nil {
 		return
 	}
@@ -112,9 +143,49 @@ func (p *Image) GetTile(level, col, row int) (m draw.Image) {
 	return
 }
 
+// acquireTile returns the tile, which is pinned in the cache of TileStore
+// until releaseTile is called.
+func (p *Image) acquireTile(key tileKey, dirty bool) draw.Image {
+	if p.store != nil {
+		return p.store.acquire(key, dirty)
+	}
+	return p.getTile(key.Level, key.Col, key.Row, dirty)
+}
+
+func (p *Image) releaseTile(key tileKey) {
+	if p.store != nil {
+		p.store.release(key)
+	}
+}
+
+// readTile calls fn with the tile locked for reading.
+func (p *Image) readTile(key tileKey, fn func(m draw.Image)) {
+	mu := &p.locks.tiles[p.locks.stripe(key)]
+	mu.RLock()
+	defer mu.RUnlock()
+	defer p.releaseTile(key)
+	fn(p.acquireTile(key, false))
+}
+
+// writeTile calls fn with the tile locked for writing.
+func (p *Image) writeTile(key tileKey, fn func(m draw.Image)) {
+	mu := &p.locks.tiles[p.locks.stripe(key)]
+	mu.Lock()
+	defer mu.Unlock()
+	defer p.releaseTile(key)
+	fn(p.acquireTile(key, true))
+}
+
+// updateTile calls fn with the tile src locked for reading and the tile
+// dst locked for writing.
+func (p *Image) updateTile(src, dst tileKey, fn func(src, dst draw.Image)) {
+	defer p.locks.lock(src, dst)()
+	defer p.releaseTile(src)
+	defer p.releaseTile(dst)
+	fn(p.acquireTile(src, false), p.acquireTile(dst, true))
+}
+
 func (p *Image) SetTile(level, col, row int, m draw.Image) (err error) {
-	p.mu.Lock()
-	defer p.mu.Unlock()
 	level = p.adjustLevel(level)
 	if m.Bounds() != image.Rect(0, 0, p.TileSize.X, p.TileSize.Y) {
 		err = fmt.Errorf("image/big: Image.SetTile, bad bound size: %v", m.Bounds())
@@ -124,7 +195,18 @@ func (p *Image) SetTile(level, col, row int, m draw.Image) (err error) {
 		err = fmt.Errorf("image/big: Image.SetTile, bad color model: %T", m.ColorModel())
 		return
 	}
+	mu := &p.locks.tiles[p.locks.stripe(tileKey{level, col, row})]
+	mu.Lock()
+	defer mu.Unlock()
+	if p.store != nil {
+		tile := p.store.newTile()
+		draw_ext.Draw(tile, tile.Bounds(), m, image.Pt(0, 0))
+		p.store.setTile(tileKey{level, col, row}, tile)
+		return
+	}
+	p.locks.mu.Lock()
 	p.tileMap[level][col][row] = m
+	p.locks.mu.Unlock()
 	return
 }
 
@@ -156,7 +238,9 @@ func (p *Image) ReadRect(level int, r image.Rectangle, buf image_ext.ImageBuffer
 		for row := tMinY; row < tMaxY; row++ {
 			wg.Add(1)
 			go func(level, col, row int) {
-				p.readRectFromTile(buf, p.GetTile(level, col, row), r.Min.X, r.Min.Y, r.Dx(), r.Dy(), col, row)
+				p.readTile(tileKey{level, col, row}, func(tile draw.Image) {
+					p.readRectFromTile(buf, tile, r.Min.X, r.Min.Y, r.Dx(), r.Dy(), col, row)
+				})
 				wg.Done()
 			}(level, col, row)
 		}
@@ -202,6 +286,14 @@ func (p *Image) readRectFromTile(dst, tile draw.Image, x, y, dx, dy, col, row in
 }
 
 func (p *Image) WriteRect(level int, r image.Rectangle, m image.Image) (err error) {
+	return p.WriteRectProgress(level, r, m, nil)
+}
+
+// WriteRectProgress is like WriteRect, but it reports the progress of the
+// tile writing and the pyramid updating to fn, and returns
+// image_ext.ErrCanceled if fn returns false. The tiles written before the
+// cancellation are kept, and their parents are updated by FlushPyramid.
+func (p *Image) WriteRectProgress(level int, r image.Rectangle, m image.Image, fn image_ext.ProgressFunc) (err error) {
 	level = p.adjustLevel(level)
 	r = r.Intersect(p.Bounds())
 	if level < 0 || level >= p.Levels() {
@@ -224,20 +316,37 @@ func (p *Image) WriteRect(level int, r image.Rectangle, m image.Image) (err erro
 		tMaxY = max
 	}
 
-	var wg sync.WaitGroup
+	var keys []tileKey
 	for col := tMinX; col < tMaxX; col++ {
 		for row := tMinY; row < tMaxY; row++ {
-			wg.Add(1)
-			go func(level, col, row int) {
-				p.writeRectToTile(p.GetTile(level, col, row), m, r.Min.X, r.Min.Y, r.Dx(), r.Dy(), col, row)
-				wg.Done()
-			}(level, col, row)
+			keys = append(keys, tileKey{level, col, row})
 		}
 	}
-	wg.Wait()
+	var pyramid [][]tileKey
+	if !p.DeferPyramid {
+		pyramid = p.rectPyramidKeys(level, r.Min.X, r.Min.Y, r.Dx(), r.Dy())
+	}
+	steps := len(keys)
+	for _, v := range pyramid {
+		steps += len(v)
+	}
+	progress := image_ext.NewProgress(fn, steps)
 
-	p.updateRectPyramid(level, r.Min.X, r.Min.Y, r.Dx(), r.Dy())
-	return
+	p.forEachTile(keys, func(key tileKey) {
+		if progress.Canceled() {
+			return
+		}
+		p.writeTile(key, func(tile draw.Image) {
+			p.writeRectToTile(tile, m, r.Min.X, r.Min.Y, r.Dx(), r.Dy(), key.Col, key.Row)
+		})
+		progress.Step(1)
+	})
+
+	if p.DeferPyramid || progress.Canceled() {
+		p.markDirty(keys)
+		return progress.Err()
+	}
+	return p.updateRectPyramid(pyramid, progress)
 }
 
 func (p *Image) writeRectToTile(tile draw.Image, src image.Image, x, y, dx, dy, col, row int) {
@@ -275,7 +384,9 @@ func (p *Image) writeRectToTile(tile draw.Image, src image.Image, x, y, dx, dy,
 	return
 }
 
-func (p *Image) updateRectPyramid(level, x, y, dx, dy int) {
+// rectPyramidKeys returns the tiles whose parents are changed by the
+// writing of the rectangle of the level, from the bottom level up.
+func (p *Image) rectPyramidKeys(level, x, y, dx, dy int) (keys [][]tileKey) {
 	for level > 0 && dx > 0 && dy > 0 {
 		minX, minY := x, y
 		maxX, maxY := x+dx-1, y+dy-1
@@ -285,7 +396,7 @@ func (p *Image) updateRectPyramid(level, x, y, dx, dy int) {
 		tMaxCol := maxX / p.TileSize.X
 		tMaxRow := maxY / p.TileSize.Y
 
-		var wg sync.WaitGroup
+		var v []tileKey
 		for row := tMinRow; row <= tMaxRow; row++ {
 			if row >= p.TilesDown(level) {
 				continue
@@ -294,75 +405,138 @@ func (p *Image) updateRectPyramid(level, x, y, dx, dy int) {
 				if col >= p.TilesAcross(level) {
 					continue
 				}
-				wg.Add(1)
-				go func(level, col, row int) {
-					p.updateParentTile(level, col, row)
-					wg.Done()
-				}(level, col, row)
+				v = append(v, tileKey{level, col, row})
 			}
 		}
-		wg.Wait()
+		keys = append(keys, v)
 
-		x, dx = (minX+1)/2, (maxX-minX+1)/2
-		y, dy = (minY+1)/2, (maxY-minY+1)/2
+		// the pixels of the parent level changed by the pixels
+		x, dx = minX/2, maxX/2-minX/2+1
+		y, dy = minY/2, maxY/2-minY/2+1
 		level--
 	}
 	return
 }
 
+// updateRectPyramid updates the parents of the tiles level by level. If
+// it's canceled, the tiles of the current level are marked dirty.
+func (p *Image) updateRectPyramid(keys [][]tileKey, progress *image_ext.Progress) (err error) {
+	for _, v := range keys {
+		p.forEachTile(v, func(key tileKey) {
+			if progress.Canceled() {
+				return
+			}
+			p.updateParentTile(key.Level, key.Col, key.Row)
+			progress.Step(1)
+		})
+
+		if progress.Canceled() {
+			p.markDirty(v)
+			return image_ext.ErrCanceled
+		}
+	}
+	return
+}
+
+// markDirty marks the parents of the tiles are not updated, the tiles of
+// level 0 have no parent.
+func (p *Image) markDirty(keys []tileKey) {
+	for _, key := range keys {
+		if key.Level > 0 {
+			p.locks.markDirty(key)
+		}
+	}
+}
+
 func (p *Image) updateParentTile(level, col, row int) {
-	switch {
-	case col%2 == 0 && row%2 == 0:
-		draw_ext.DrawPyrDown(
-			p.GetTile(level-1, col/2, row/2),
-			image.Rect(
-				(p.TileSize.X/2)*0,
-				(p.TileSize.Y/2)*0,
-				(p.TileSize.X/2)*0+p.TileSize.X/2,
-				(p.TileSize.Y/2)*0+p.TileSize.Y/2,
-			),
-			p.GetTile(level, col, row),
-			image.Pt(0, 0),
-			draw_ext.Filter_Average,
-		)
-	case col%2 == 0 && row%2 == 1:
-		draw_ext.DrawPyrDown(
-			p.GetTile(level-1, col/2, row/2),
-			image.Rect(
-				(p.TileSize.X/2)*0,
-				(p.TileSize.Y/2)*1,
-				(p.TileSize.X/2)*0+p.TileSize.X/2,
-				(p.TileSize.Y/2)*1+p.TileSize.Y/2,
-			),
-			p.GetTile(level, col, row),
-			image.Pt(0, 0),
-			draw_ext.Filter_Average,
-		)
-	case col%2 == 1 && row%2 == 1:
+	dx, dy := p.TileSize.X/2, p.TileSize.Y/2
+	child, parent := tileKey{level, col, row}, tileKey{level - 1, col / 2, row / 2}
+	p.updateTile(child, parent, func(child, parent draw.Image) {
 		draw_ext.DrawPyrDown(
-			p.GetTile(level-1, col/2, row/2),
-			image.Rect(
-				(p.TileSize.X/2)*1,
-				(p.TileSize.Y/2)*1,
-				(p.TileSize.X/2)*1+p.TileSize.X/2,
-				(p.TileSize.Y/2)*1+p.TileSize.Y/2,
-			),
-			p.GetTile(level, col, row),
-			image.Pt(0, 0),
-			draw_ext.Filter_Average,
-		)
-	case col%2 == 1 && row%2 == 0:
-		draw_ext.DrawPyrDown(
-			p.GetTile(level-1, col/2, row/2),
-			image.Rect(
-				(p.TileSize.X/2)*1,
-				(p.TileSize.Y/2)*0,
-				(p.TileSize.X/2)*1+p.TileSize.X/2,
-				(p.TileSize.Y/2)*0+p.TileSize.Y/2,
-			),
-			p.GetTile(level, col, row),
-			image.Pt(0, 0),
+			parent, image.Rect(0, 0, dx, dy).Add(image.Pt((col%2)*dx, (row%2)*dy)),
+			child, image.Pt(0, 0),
 			draw_ext.Filter_Average,
 		)
+	})
+}
+
+// FlushPyramid updates the parents of the tiles which are written while
+// DeferPyramid is set. The levels are updated from the bottom up, and the
+// tiles of a level are updated in parallel by image_ext.Workers goroutines.
+func (p *Image) FlushPyramid() {
+	p.FlushPyramidProgress(nil)
+}
+
+// FlushPyramidProgress is like FlushPyramid, but it reports the progress
+// to fn, and returns image_ext.ErrCanceled if fn returns false. The tiles
+// whose parents are not updated are kept dirty.
+func (p *Image) FlushPyramidProgress(fn image_ext.ProgressFunc) (err error) {
+	levels := dirtyLevels(p.locks.takeDirty(), p.Levels())
+	steps := 0
+	for _, keys := range levels {
+		steps += len(keys)
 	}
+	progress := image_ext.NewProgress(fn, steps)
+
+	for i, keys := range levels {
+		p.forEachTile(keys, func(key tileKey) {
+			if progress.Canceled() {
+				return
+			}
+			p.updateParentTile(key.Level, key.Col, key.Row)
+			progress.Step(1)
+		})
+		if progress.Canceled() {
+			for _, keys := range levels[i:] {
+				p.markDirty(keys)
+			}
+			return image_ext.ErrCanceled
+		}
+	}
+	return
+}
+
+// dirtyLevels returns the dirty tiles and their dirty ancestors, which are
+// grouped by level from the bottom level up.
+func dirtyLevels(dirty map[tileKey]bool, levels int) (keys [][]tileKey) {
+	for level := levels - 1; level > 0 && len(dirty) > 0; level-- {
+		var v []tileKey
+		for key := range dirty {
+			if key.Level == level {
+				v = append(v, key)
+			}
+		}
+		for _, key := range v {
+			delete(dirty, key)
+			if level > 1 {
+				dirty[tileKey{level - 1, key.Col / 2, key.Row / 2}] = true
+			}
+		}
+		keys = append(keys, v)
+	}
+	return
+}
+
+// forEachTile calls fn with the keys in parallel.
+func (p *Image) forEachTile(keys []tileKey, fn func(key tileKey)) {
+	n := image_ext.Workers
+	if n <= 0 {
+		n = runtime.GOMAXPROCS(0)
+	}
+	ch := make(chan tileKey)
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for key := range ch {
+				fn(key)
+			}
+		}()
+	}
+	for _, key := range keys {
+		ch <- key
+	}
+	close(ch)
+	wg.Wait()
 }
@@ -9,7 +9,11 @@ import (
 	"image"
 	"image/color"
 	"image/draw"
+	"reflect"
 	"testing"
+
+	image_ext "github.com/chai2010/gopkg/image"
+	color_ext "github.com/chai2010/gopkg/image/color"
 )
 
 type tImageTester struct {
@@ -79,6 +83,114 @@ func TestImage_readAndWrite(t *testing.T) {
 	}
 }
 
+func TestImage_multiBand(t *testing.T) {
+	model := color_ext.NewUniformMultiBandModel(8, reflect.Uint16)
+	model.Band[7].NoData, model.Band[7].HasNoData = 0xffff, true
+
+	m := NewImage(image.Rect(0, 0, 10, 10), image.Pt(4, 4), model)
+	fgd := image_ext.NewMultiBand(image.Rect(0, 0, 6, 6), model)
+	for y := 0; y < 6; y++ {
+		for x := 0; x < 6; x++ {
+			for k := 0; k < 8; k++ {
+				fgd.SetValue(x, y, k, float64(k*100))
+			}
+		}
+	}
+	if err := m.WriteRect(-1, image.Rect(0, 0, 6, 6), fgd); err != nil {
+		t.Fatalf("WriteRect: %v", err)
+	}
+
+	for level, r := range []image.Rectangle{
+		image.Rect(0, 0, 1, 1),
+		image.Rect(0, 0, 2, 2),
+		image.Rect(0, 0, 6, 6),
+	} {
+		tile, err := m.ReadRect(level, r, nil)
+		if err != nil {
+			t.Fatalf("level %d: ReadRect: %v", level, err)
+		}
+		got, ok := tile.(*image_ext.MultiBand)
+		if !ok {
+			t.Fatalf("level %d: bad image type: %T", level, tile)
+		}
+		if got.Model != model {
+			t.Fatalf("level %d: model is not shared", level)
+		}
+		for k := 0; k < 8; k++ {
+			if v := got.Value(r.Min.X, r.Min.Y, k); v != float64(k*100) {
+				t.Fatalf("level %d, band %d: want %v, got %v", level, k, k*100, v)
+			}
+		}
+	}
+
+	tile, err := m.ReadRect(-1, image.Rect(0, 0, 10, 10), nil)
+	if err != nil {
+		t.Fatalf("ReadRect: %v", err)
+	}
+	if v := tile.(*image_ext.MultiBand).Value(9, 9, 7); v != 0xffff {
+		t.Fatalf("want nodata value, got %v", v)
+	}
+}
+
+// tProgress returns a ProgressFunc which cancels the operation after n
+// calls, and checks the done values are increasing.
+func tProgress(t *testing.T, n int, last *float64) image_ext.ProgressFunc {
+	return func(done float64) bool {
+		if done < *last || done > 1 {
+			t.Errorf("bad progress, %v after %v", done, *last)
+		}
+		*last = done
+		n--
+		return n > 0
+	}
+}
+
+func TestImage_WriteRectProgress(t *testing.T) {
+	m := NewImage(image.Rect(0, 0, 100, 100), image.Pt(16, 16), color.GrayModel)
+	r, src := m.Bounds(), image.NewUniform(color.Gray{200})
+
+	var last float64
+	if err := m.WriteRectProgress(-1, r, src, tProgress(t, 1<<30, &last)); err != nil {
+		t.Fatal(err)
+	}
+	if last != 1 {
+		t.Fatalf("bad progress: %v", last)
+	}
+	if c := m.SubLevels(1).At(0, 0); c != (color.Gray{200}) {
+		t.Fatalf("bad level 0 color: %v", c)
+	}
+
+	// cancel the pyramid updating, the pyramid is completed by FlushPyramid
+	m = NewImage(r, image.Pt(16, 16), color.GrayModel)
+	last = 0
+	if err := m.WriteRectProgress(-1, r, src, tProgress(t, 60, &last)); err != image_ext.ErrCanceled {
+		t.Fatalf("expect ErrCanceled, got %v", err)
+	}
+	if last >= 1 {
+		t.Fatalf("bad progress of canceled writing: %v", last)
+	}
+	if c := m.SubLevels(1).At(0, 0); c == (color.Gray{200}) {
+		t.Fatalf("the pyramid is updated after the cancellation: %v", c)
+	}
+	if err := m.FlushPyramidProgress(tProgress(t, 1<<30, new(float64))); err != nil {
+		t.Fatal(err)
+	}
+	if c := m.SubLevels(1).At(0, 0); c != (color.Gray{200}) {
+		t.Fatalf("bad level 0 color after FlushPyramid: %v", c)
+	}
+
+	// cancel the FlushPyramid, the tiles are kept dirty
+	m.DeferPyramid = true
+	m.WriteRect(-1, r, image.NewUniform(color.Gray{100}))
+	if err := m.FlushPyramidProgress(tProgress(t, 1, new(float64))); err != image_ext.ErrCanceled {
+		t.Fatalf("expect ErrCanceled, got %v", err)
+	}
+	m.FlushPyramid()
+	if c := m.SubLevels(1).At(0, 0); c != (color.Gray{100}) {
+		t.Fatalf("bad level 0 color after FlushPyramid: %v", c)
+	}
+}
+
 func tClearImage(m draw.Image, c color.Color) {
 	b := m.Bounds()
 	for y := b.Min.Y; y < b.Max.Y; y++ {
@@ -132,3 +244,46 @@ var tDrawTesterList = []tImageTester{
 		},
 	},
 }
+
+func TestImage_rectPyramid(t *testing.T) {
+	// the pyramid updated by WriteRect equals the one by FlushPyramid
+	for i, r := range []image.Rectangle{
+		image.Rect(5, 5, 6, 6),
+		image.Rect(3, 7, 4, 16),
+		image.Rect(1, 1, 15, 2),
+		image.Rect(7, 9, 13, 11),
+	} {
+		src := image.NewGray(image.Rect(0, 0, r.Dx(), r.Dy()))
+		for j := range src.Pix {
+			src.Pix[j] = uint8(200 + j)
+		}
+		m0 := NewImage(image.Rect(0, 0, 16, 16), image.Pt(4, 4), color.GrayModel)
+		m1 := NewImage(image.Rect(0, 0, 16, 16), image.Pt(4, 4), color.GrayModel)
+		m1.DeferPyramid = true
+		if err := m0.WriteRect(-1, r, src); err != nil {
+			t.Fatal(err)
+		}
+		if err := m1.WriteRect(-1, r, src); err != nil {
+			t.Fatal(err)
+		}
+		m1.FlushPyramid()
+		if c := m0.GetTile(0, 0, 0).At(r.Min.X/4, r.Min.Y/4); c == (color.Gray{}) {
+			t.Fatalf("%d: level 0 is not updated", i)
+		}
+		for level := 0; level < m0.Levels(); level++ {
+			for col := 0; col < m0.TilesAcross(level); col++ {
+				for row := 0; row < m0.TilesDown(level); row++ {
+					tile0, tile1 := m0.GetTile(level, col, row), m1.GetTile(level, col, row)
+					b := tile0.Bounds()
+					for y := b.Min.Y; y < b.Max.Y; y++ {
+						for x := b.Min.X; x < b.Max.X; x++ {
+							if c0, c1 := tile0.At(x, y), tile1.At(x, y); c0 != c1 {
+								t.Fatalf("%d: tile (%d, %d, %d) at (%d, %d): %v != %v", i, level, col, row, x, y, c0, c1)
+							}
+						}
+					}
+				}
+			}
+		}
+	}
+}
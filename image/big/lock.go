@@ -0,0 +1,67 @@
+// Copyright 2014 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package big
+
+import (
+	"sync"
+)
+
+// tileLockStripes is the number of the tile locks, the tiles share the
+// locks by the hash of the tile key.
+const tileLockStripes = 1024
+
+// imageLocks is shared by an Image and its SubLevels.
+type imageLocks struct {
+	mu    sync.Mutex // guards the lazy made tiles and dirty
+	tiles [tileLockStripes]sync.RWMutex
+	dirty map[tileKey]bool // the tiles whose parents are not updated
+}
+
+func newImageLocks() *imageLocks {
+	return &imageLocks{
+		dirty: make(map[tileKey]bool),
+	}
+}
+
+func (p *imageLocks) stripe(key tileKey) int {
+	h := uint(key.Level)*73856093 ^ uint(key.Col)*19349663 ^ uint(key.Row)*83492791
+	return int(h % tileLockStripes)
+}
+
+// lock locks the tile r for reading and the tile w for writing, the
+// stripes are locked in order. It returns the unlock function.
+func (p *imageLocks) lock(r, w tileKey) (unlock func()) {
+	i, j := p.stripe(r), p.stripe(w)
+	switch {
+	case i == j:
+		p.tiles[j].Lock()
+		return p.tiles[j].Unlock
+	case i < j:
+		p.tiles[i].RLock()
+		p.tiles[j].Lock()
+	default:
+		p.tiles[j].Lock()
+		p.tiles[i].RLock()
+	}
+	return func() {
+		p.tiles[j].Unlock()
+		p.tiles[i].RUnlock()
+	}
+}
+
+// markDirty marks the parent of the tile is not updated.
+func (p *imageLocks) markDirty(key tileKey) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.dirty[key] = true
+}
+
+// takeDirty returns and clears the dirty tiles.
+func (p *imageLocks) takeDirty() (dirty map[tileKey]bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	dirty, p.dirty = p.dirty, make(map[tileKey]bool)
+	return
+}
@@ -0,0 +1,119 @@
+// Copyright 2014 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package big
+
+import (
+	"image"
+	"image/color"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+func tNewStripesImage(r image.Rectangle, i int) *image.RGBA {
+	m := image.NewRGBA(r)
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			m.SetRGBA(x, y, color.RGBA{uint8(i * 40), uint8(x), uint8(y), 0xff})
+		}
+	}
+	return m
+}
+
+func tCheckSameImage(t *testing.T, name string, got, want *Image) {
+	for level := 0; level < want.Levels(); level++ {
+		got, want := got.SubLevels(level+1), want.SubLevels(level+1)
+		b := want.Bounds()
+		for y := b.Min.Y; y < b.Max.Y; y++ {
+			for x := b.Min.X; x < b.Max.X; x++ {
+				if c0, c1 := got.At(x, y), want.At(x, y); c0 != c1 {
+					t.Fatalf("%s: level %d: bad color at (%d, %d); got %v, want %v",
+						name, level, x, y, c0, c1,
+					)
+				}
+			}
+		}
+	}
+}
+
+func TestImage_concurrentWriteRect(t *testing.T) {
+	dir, err := ioutil.TempDir("", "big")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	store, err := OpenFileTileStore(filepath.Join(dir, "tiles.bigt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	disk, err := Create(store, image.Rect(0, 0, 700, 500), image.Pt(32, 32), color.RGBAModel)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer disk.Close()
+	disk.SetCacheSize(minCacheSize)
+
+	var rects []image.Rectangle
+	for y := 0; y < 500; y += 100 {
+		for x := 0; x < 700; x += 70 {
+			rects = append(rects, image.Rect(x, y, x+70, y+100))
+		}
+	}
+
+	want := NewImage(image.Rect(0, 0, 700, 500), image.Pt(32, 32), color.RGBAModel)
+	for i, r := range rects {
+		want.WriteRect(-1, r, tNewStripesImage(r, i))
+	}
+
+	for _, v := range []struct {
+		Name  string
+		Image *Image
+	}{
+		{"memory", NewImage(image.Rect(0, 0, 700, 500), image.Pt(32, 32), color.RGBAModel)},
+		{"store", disk},
+	} {
+		for _, deferPyramid := range []bool{false, true} {
+			m := v.Image
+			m.DeferPyramid = deferPyramid
+
+			var wg sync.WaitGroup
+			for i, r := range rects {
+				wg.Add(1)
+				go func(i int, r image.Rectangle) {
+					defer wg.Done()
+					if err := m.WriteRect(-1, r, tNewStripesImage(r, i)); err != nil {
+						t.Errorf("%s: WriteRect(%v): %v", v.Name, r, err)
+					}
+				}(i, r)
+			}
+			wg.Wait()
+			if deferPyramid {
+				m.FlushPyramid()
+			}
+			tCheckSameImage(t, v.Name, m, want)
+		}
+	}
+	if err := disk.Flush(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestImage_deferPyramid(t *testing.T) {
+	m := NewImage(image.Rect(0, 0, 100, 100), image.Pt(16, 16), color.GrayModel)
+	m.DeferPyramid = true
+	m.WriteRect(-1, image.Rect(0, 0, 100, 100), image.NewUniform(color.Gray{200}))
+	if c := m.SubLevels(1).At(0, 0); c != (color.Gray{}) {
+		t.Fatalf("the pyramid is updated before FlushPyramid: %v", c)
+	}
+	m.FlushPyramid()
+	if c := m.SubLevels(1).At(0, 0); c != (color.Gray{200}) {
+		t.Fatalf("bad level 0 color after FlushPyramid: %v", c)
+	}
+	if n := len(m.locks.dirty); n != 0 {
+		t.Fatalf("bad dirty tiles after FlushPyramid: %d", n)
+	}
+}
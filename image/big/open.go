@@ -0,0 +1,288 @@
+// Copyright 2014 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package big
+
+import (
+	"bytes"
+	"encoding/gob"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+
+	image_ext "github.com/chai2010/gopkg/image"
+	color_ext "github.com/chai2010/gopkg/image/color"
+)
+
+const (
+	storeMetaKind_Image = "Image"
+	storeMetaKind_Dem   = "Dem"
+)
+
+// storeMeta is the metadata of the images saved in a TileStore.
+type storeMeta struct {
+	Kind     string // Image or Dem
+	Rect     image.Rectangle
+	TileSize image.Point
+
+	// Image
+	Model   string // Gray/Gray16/Gray32f/RGBA/RGBA64/RGBA128f/MultiBand
+	Band    []color_ext.BandInfo
+	Mapping color_ext.BandMapping
+
+	// Dem
+	ZeroValue    float32
+	NoData       *float32
+	GeoTransform image_ext.GeoTransform
+	CRS          string
+}
+
+var storeModelNames = []struct {
+	Model color.Model
+	Name  string
+}{
+	{color.GrayModel, "Gray"},
+	{color.Gray16Model, "Gray16"},
+	{color_ext.Gray32fModel, "Gray32f"},
+	{color.RGBAModel, "RGBA"},
+	{color.RGBA64Model, "RGBA64"},
+	{color_ext.RGBA128fModel, "RGBA128f"},
+}
+
+func (p *storeMeta) setModel(model color.Model) {
+	if m, ok := model.(*color_ext.MultiBandModel); ok {
+		p.Model, p.Band, p.Mapping = "MultiBand", m.Band, m.Mapping
+		return
+	}
+	for _, v := range storeModelNames {
+		if v.Model == model {
+			p.Model = v.Name
+			return
+		}
+	}
+}
+
+func (p *storeMeta) model() (model color.Model, err error) {
+	if p.Model == "MultiBand" {
+		m := color_ext.NewMultiBandModel(p.Band...)
+		m.Mapping = p.Mapping
+		return m, nil
+	}
+	for _, v := range storeModelNames {
+		if v.Name == p.Model {
+			return v.Model, nil
+		}
+	}
+	err = fmt.Errorf("image/big: bad color model: %q", p.Model)
+	return
+}
+
+func writeStoreMeta(store TileStore, meta *storeMeta) (err error) {
+	var buf bytes.Buffer
+	if err = gob.NewEncoder(&buf).Encode(meta); err != nil {
+		err = fmt.Errorf("image/big: writeStoreMeta, %v", err)
+		return
+	}
+	return store.WriteMeta(buf.Bytes())
+}
+
+func readStoreMeta(store TileStore, kind string) (meta *storeMeta, err error) {
+	data, err := store.ReadMeta()
+	if err != nil {
+		return
+	}
+	if data == nil {
+		err = fmt.Errorf("image/big: readStoreMeta, metadata not found")
+		return
+	}
+	meta = new(storeMeta)
+	if err = gob.NewDecoder(bytes.NewReader(data)).Decode(meta); err != nil {
+		err = fmt.Errorf("image/big: readStoreMeta, %v", err)
+		return nil, err
+	}
+	if meta.Kind != kind {
+		err = fmt.Errorf("image/big: readStoreMeta, bad kind: %q, want %q", meta.Kind, kind)
+		return nil, err
+	}
+	if meta.Rect.Empty() || meta.TileSize.X <= 0 || meta.TileSize.Y <= 0 {
+		err = fmt.Errorf("image/big: readStoreMeta, bad metadata: rect = %v, tileSize = %v",
+			meta.Rect, meta.TileSize,
+		)
+		return nil, err
+	}
+	return
+}
+
+// Create creates a big image whose tiles are saved in the store. The tiles
+// are loaded lazily and the hot tiles are kept in memory, the changes are
+// saved by Flush and Close.
+func Create(store TileStore, r image.Rectangle, tileSize image.Point, model color.Model) (m *Image, err error) {
+	if r.Empty() || tileSize.X <= 0 || tileSize.Y <= 0 {
+		err = fmt.Errorf("image/big: Create, bad arguments: r = %v, tileSize = %v", r, tileSize)
+		return
+	}
+	if !isValidImageColorModel(model) {
+		err = fmt.Errorf("image/big: Create, bad color model: %T", model)
+		return
+	}
+	meta := &storeMeta{Kind: storeMetaKind_Image, Rect: r, TileSize: tileSize}
+	meta.setModel(model)
+	if err = writeStoreMeta(store, meta); err != nil {
+		return
+	}
+	m = newStoreImage(store, r, tileSize, model)
+	return
+}
+
+// Open opens a big image which is created by Create.
+func Open(store TileStore) (m *Image, err error) {
+	meta, err := readStoreMeta(store, storeMetaKind_Image)
+	if err != nil {
+		return
+	}
+	model, err := meta.model()
+	if err != nil {
+		return
+	}
+	if !isValidImageColorModel(model) {
+		err = fmt.Errorf("image/big: Open, bad color model: %q", meta.Model)
+		return
+	}
+	m = newStoreImage(store, meta.Rect, meta.TileSize, model)
+	return
+}
+
+func newStoreImage(store TileStore, r image.Rectangle, tileSize image.Point, model color.Model) *Image {
+	return &Image{
+		tileMap:  makeImageTileMap(r, tileSize),
+		TileSize: tileSize,
+		Rect:     r,
+		Model:    model,
+		locks:    newImageLocks(),
+		store: newStoreTiles(store, func() draw.Image {
+			return newImageTile(tileSize, model)
+		}),
+	}
+}
+
+// SetCacheSize sets the max number of the tiles which are kept in memory,
+// if the image is backed by a TileStore.
+func (p *Image) SetCacheSize(n int) {
+	if p.store != nil {
+		p.store.setCacheSize(n)
+	}
+}
+
+// Flush saves the changed tiles to the TileStore. It also returns the
+// first error of the lazy tile loading and saving since the last Flush.
+func (p *Image) Flush() error {
+	if p.store == nil {
+		return nil
+	}
+	return p.store.flush()
+}
+
+// Close flushes the image and closes the TileStore.
+func (p *Image) Close() error {
+	if p.store == nil {
+		return nil
+	}
+	err := p.store.flush()
+	if err1 := p.store.store.Close(); err == nil {
+		err = err1
+	}
+	return err
+}
+
+// CreateDem creates a big Dem whose tiles are saved in the store, see
+// Create.
+func CreateDem(store TileStore, r image.Rectangle, tileSize image.Point, zeroValue color_ext.Gray32f) (m *Dem, err error) {
+	if r.Empty() || tileSize.X <= 0 || tileSize.Y <= 0 {
+		err = fmt.Errorf("image/big: CreateDem, bad arguments: r = %v, tileSize = %v", r, tileSize)
+		return
+	}
+	m = newStoreDem(store, r, tileSize, zeroValue)
+	if err = m.writeMeta(); err != nil {
+		return nil, err
+	}
+	return
+}
+
+// OpenDem opens a big Dem which is created by CreateDem.
+func OpenDem(store TileStore) (m *Dem, err error) {
+	meta, err := readStoreMeta(store, storeMetaKind_Dem)
+	if err != nil {
+		return
+	}
+	m = newStoreDem(store, meta.Rect, meta.TileSize, color_ext.Gray32f{Y: meta.ZeroValue})
+	if meta.NoData != nil {
+		m.NoData = color_ext.Gray32f{Y: *meta.NoData}
+	}
+	m.GeoTransform, m.CRS = meta.GeoTransform, meta.CRS
+	return
+}
+
+func newStoreDem(store TileStore, r image.Rectangle, tileSize image.Point, zeroValue color_ext.Gray32f) *Dem {
+	return &Dem{
+		TileMap:   makeDemTileMap(r, tileSize),
+		TileSize:  tileSize,
+		Rect:      r,
+		ZeroValue: zeroValue,
+		store: newStoreTiles(store, func() draw.Image {
+			return newDemTile(tileSize, zeroValue)
+		}),
+	}
+}
+
+// writeMeta saves the metadata, the NoData and the georeferencing may be
+// changed after CreateDem.
+func (p *Dem) writeMeta() error {
+	meta := &storeMeta{
+		Kind:         storeMetaKind_Dem,
+		Rect:         p.Rect,
+		TileSize:     p.TileSize,
+		ZeroValue:    p.ZeroValue.Y,
+		GeoTransform: p.GeoTransform,
+		CRS:          p.CRS,
+	}
+	if p.NoData != nil {
+		v := color_ext.Gray32fModel.Convert(p.NoData).(color_ext.Gray32f).Y
+		meta.NoData = &v
+	}
+	return writeStoreMeta(p.store.store, meta)
+}
+
+// SetCacheSize sets the max number of the tiles which are kept in memory,
+// if the Dem is backed by a TileStore.
+func (p *Dem) SetCacheSize(n int) {
+	if p.store != nil {
+		p.store.setCacheSize(n)
+	}
+}
+
+// Flush saves the metadata and the changed tiles to the TileStore, see
+// Image.Flush.
+func (p *Dem) Flush() error {
+	if p.store == nil {
+		return nil
+	}
+	err := p.writeMeta()
+	if err1 := p.store.flush(); err == nil {
+		err = err1
+	}
+	return err
+}
+
+// Close flushes the Dem and closes the TileStore.
+func (p *Dem) Close() error {
+	if p.store == nil {
+		return nil
+	}
+	err := p.Flush()
+	if err1 := p.store.store.Close(); err == nil {
+		err = err1
+	}
+	return err
+}
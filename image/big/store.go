@@ -0,0 +1,434 @@
+// Copyright 2014 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package big
+
+import (
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+)
+
+// TileStore saves the encoded tiles and the metadata of a big image.
+// The methods must be safe for concurrent use.
+type TileStore interface {
+	// ReadMeta returns the data saved by WriteMeta, or nil if there is none.
+	ReadMeta() (data []byte, err error)
+	WriteMeta(data []byte) error
+
+	// ReadTile returns the data saved by WriteTile, or nil if the tile
+	// has not been saved.
+	ReadTile(level, col, row int) (data []byte, err error)
+	WriteTile(level, col, row int, data []byte) error
+
+	// Sync commits the saved data to the stable storage.
+	Sync() error
+	Close() error
+}
+
+// DirTileStore is a TileStore which saves every tile as a file of a
+// directory, the tile (level, col, row) is saved as "level/col/row.tile".
+type DirTileStore struct {
+	Dir string
+}
+
+// OpenDirTileStore opens the directory store, the directory is created if
+// it does not exist.
+func OpenDirTileStore(dir string) (p *DirTileStore, err error) {
+	if err = os.MkdirAll(dir, 0755); err != nil {
+		err = fmt.Errorf("image/big: OpenDirTileStore, %v", err)
+		return
+	}
+	p = &DirTileStore{Dir: dir}
+	return
+}
+
+func (p *DirTileStore) metaName() string {
+	return filepath.Join(p.Dir, "meta")
+}
+
+func (p *DirTileStore) tileName(level, col, row int) string {
+	return filepath.Join(p.Dir,
+		strconv.Itoa(level), strconv.Itoa(col), strconv.Itoa(row)+".tile",
+	)
+}
+
+func (p *DirTileStore) ReadMeta() (data []byte, err error) {
+	return p.readFile(p.metaName())
+}
+
+func (p *DirTileStore) WriteMeta(data []byte) error {
+	return p.writeFile(p.metaName(), data)
+}
+
+func (p *DirTileStore) ReadTile(level, col, row int) (data []byte, err error) {
+	return p.readFile(p.tileName(level, col, row))
+}
+
+func (p *DirTileStore) WriteTile(level, col, row int, data []byte) error {
+	return p.writeFile(p.tileName(level, col, row), data)
+}
+
+func (p *DirTileStore) Sync() error { return nil }
+
+func (p *DirTileStore) Close() error { return nil }
+
+func (p *DirTileStore) readFile(name string) (data []byte, err error) {
+	if data, err = ioutil.ReadFile(name); err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		err = fmt.Errorf("image/big: DirTileStore, %v", err)
+	}
+	return
+}
+
+// writeFile writes a temporary file and renames it to name, so the old
+// file is kept if the writing fails.
+func (p *DirTileStore) writeFile(name string, data []byte) (err error) {
+	if err = os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+		err = fmt.Errorf("image/big: DirTileStore, %v", err)
+		return
+	}
+	if err = ioutil.WriteFile(name+".tmp", data, 0644); err != nil {
+		err = fmt.Errorf("image/big: DirTileStore, %v", err)
+		return
+	}
+	if err = os.Rename(name+".tmp", name); err != nil {
+		err = fmt.Errorf("image/big: DirTileStore, %v", err)
+		return
+	}
+	return
+}
+
+const (
+	fileStoreSig        = "BIGT"
+	fileStoreHeaderSize = 8  // Sig, Version
+	fileStoreRecordSize = 24 // Kind, Level, Col, Row, Size, CheckSum
+	fileStoreVersion    = 1
+
+	fileStoreKind_Meta = 1
+	fileStoreKind_Tile = 2
+)
+
+// FileTileStore is a TileStore which saves all the tiles in a single file.
+//
+// The file is a log of the records, every record has a 24 bytes header
+// (little endian uint32 Kind, Level, Col, Row, Size and CRC-32 CheckSum)
+// and the data. The last record of a tile wins, the old records of the
+// rewritten tiles are garbage until Compact is called. A broken record at
+// the end of the file, which is left by a crash, is dropped when the file
+// is opened.
+type FileTileStore struct {
+	mu      sync.RWMutex
+	name    string
+	f       *os.File
+	size    int64
+	garbage int64 // the size of the old records
+	meta    fileStoreRecord
+	index   map[tileKey]fileStoreRecord
+}
+
+type fileStoreRecord struct {
+	Offset int64 // offset of the data
+	Size   int
+}
+
+// OpenFileTileStore opens the single-file store, the file is created if
+// it does not exist.
+func OpenFileTileStore(name string) (p *FileTileStore, err error) {
+	f, err := os.OpenFile(name, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		err = fmt.Errorf("image/big: OpenFileTileStore, %v", err)
+		return
+	}
+	p = &FileTileStore{
+		name:  name,
+		f:     f,
+		index: make(map[tileKey]fileStoreRecord),
+	}
+	if err = p.load(); err != nil {
+		f.Close()
+		p = nil
+		return
+	}
+	return
+}
+
+// load reads the header and builds the index of the records.
+func (p *FileTileStore) load() (err error) {
+	fi, err := p.f.Stat()
+	if err != nil {
+		return fmt.Errorf("image/big: OpenFileTileStore, %v", err)
+	}
+	if fi.Size() == 0 {
+		var hdr [fileStoreHeaderSize]byte
+		copy(hdr[:], fileStoreSig)
+		binary.LittleEndian.PutUint32(hdr[4:], fileStoreVersion)
+		if _, err = p.f.WriteAt(hdr[:], 0); err != nil {
+			return fmt.Errorf("image/big: OpenFileTileStore, %v", err)
+		}
+		p.size = fileStoreHeaderSize
+		return
+	}
+
+	var hdr [fileStoreHeaderSize]byte
+	if _, err = p.f.ReadAt(hdr[:], 0); err != nil {
+		return fmt.Errorf("image/big: OpenFileTileStore, bad header: %v", err)
+	}
+	if string(hdr[:4]) != fileStoreSig {
+		return fmt.Errorf("image/big: OpenFileTileStore, bad signature: %q", hdr[:4])
+	}
+	if v := binary.LittleEndian.Uint32(hdr[4:]); v != fileStoreVersion {
+		return fmt.Errorf("image/big: OpenFileTileStore, unsupported version: %d", v)
+	}
+
+	r := io.NewSectionReader(p.f, 0, fi.Size())
+	off := int64(fileStoreHeaderSize)
+	for {
+		var rec [fileStoreRecordSize]byte
+		if _, err := r.ReadAt(rec[:], off); err != nil {
+			break
+		}
+		kind := binary.LittleEndian.Uint32(rec[0:])
+		key := tileKey{
+			Level: int(binary.LittleEndian.Uint32(rec[4:])),
+			Col:   int(binary.LittleEndian.Uint32(rec[8:])),
+			Row:   int(binary.LittleEndian.Uint32(rec[12:])),
+		}
+		size := int64(binary.LittleEndian.Uint32(rec[16:]))
+		if off+fileStoreRecordSize+size > fi.Size() {
+			break
+		}
+		data := make([]byte, size)
+		if _, err := r.ReadAt(data, off+fileStoreRecordSize); err != nil {
+			break
+		}
+		if crc32.ChecksumIEEE(data) != binary.LittleEndian.Uint32(rec[20:]) {
+			break
+		}
+		v := fileStoreRecord{Offset: off + fileStoreRecordSize, Size: int(size)}
+		switch kind {
+		case fileStoreKind_Meta:
+			p.garbage += p.meta.recordSize()
+			p.meta = v
+		case fileStoreKind_Tile:
+			p.garbage += p.index[key].recordSize()
+			p.index[key] = v
+		default:
+			p.garbage += v.recordSize()
+		}
+		off += fileStoreRecordSize + size
+	}
+	if off < fi.Size() {
+		if err = p.f.Truncate(off); err != nil {
+			return fmt.Errorf("image/big: OpenFileTileStore, %v", err)
+		}
+	}
+	p.size = off
+	return
+}
+
+func (p *FileTileStore) ReadMeta() (data []byte, err error) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.read(p.meta)
+}
+
+func (p *FileTileStore) WriteMeta(data []byte) (err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	v, err := p.append(p.f, p.size, fileStoreKind_Meta, tileKey{}, data)
+	if err != nil {
+		return
+	}
+	p.garbage += p.meta.recordSize()
+	p.meta = v
+	p.size = v.end()
+	return
+}
+
+func (p *FileTileStore) ReadTile(level, col, row int) (data []byte, err error) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.read(p.index[tileKey{level, col, row}])
+}
+
+func (p *FileTileStore) WriteTile(level, col, row int, data []byte) (err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	key := tileKey{level, col, row}
+	v, err := p.append(p.f, p.size, fileStoreKind_Tile, key, data)
+	if err != nil {
+		return
+	}
+	p.garbage += p.index[key].recordSize()
+	p.index[key] = v
+	p.size = v.end()
+	return
+}
+
+// Garbage returns the size of the old records of the rewritten tiles and
+// metadata, which is reclaimed by Compact.
+func (p *FileTileStore) Garbage() int64 {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.garbage
+}
+
+// Compact rewrites the latest records of the tiles and the metadata to a
+// new file, which replaces the file of the store. The old file is kept if
+// the compaction fails. The store is locked until the compaction is done.
+func (p *FileTileStore) Compact() (err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.garbage == 0 {
+		return
+	}
+
+	tmpName := p.name + ".tmp"
+	f, err := os.OpenFile(tmpName, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return fmt.Errorf("image/big: FileTileStore.Compact, %v", err)
+	}
+	defer func() {
+		if err != nil {
+			f.Close()
+			os.Remove(tmpName)
+		}
+	}()
+
+	var hdr [fileStoreHeaderSize]byte
+	copy(hdr[:], fileStoreSig)
+	binary.LittleEndian.PutUint32(hdr[4:], fileStoreVersion)
+	if _, err = f.WriteAt(hdr[:], 0); err != nil {
+		return fmt.Errorf("image/big: FileTileStore.Compact, %v", err)
+	}
+	size := int64(fileStoreHeaderSize)
+
+	// copy the records in the order of the tiles
+	copyRecord := func(kind int, key tileKey, v fileStoreRecord) (fileStoreRecord, error) {
+		data, err := p.read(v)
+		if err != nil {
+			return fileStoreRecord{}, err
+		}
+		if v, err = p.append(f, size, kind, key, data); err != nil {
+			return fileStoreRecord{}, err
+		}
+		size = v.end()
+		return v, nil
+	}
+	var meta fileStoreRecord
+	if p.meta.Offset != 0 {
+		if meta, err = copyRecord(fileStoreKind_Meta, tileKey{}, p.meta); err != nil {
+			return
+		}
+	}
+	keys := make([]tileKey, 0, len(p.index))
+	for key := range p.index {
+		keys = append(keys, key)
+	}
+	sort.Sort(tileKeySlice(keys))
+	index := make(map[tileKey]fileStoreRecord, len(keys))
+	for _, key := range keys {
+		if index[key], err = copyRecord(fileStoreKind_Tile, key, p.index[key]); err != nil {
+			return
+		}
+	}
+
+	if err = f.Sync(); err != nil {
+		return fmt.Errorf("image/big: FileTileStore.Compact, %v", err)
+	}
+	if err = os.Rename(tmpName, p.name); err != nil {
+		return fmt.Errorf("image/big: FileTileStore.Compact, %v", err)
+	}
+	p.f.Close()
+	p.f, p.size, p.garbage = f, size, 0
+	p.meta, p.index = meta, index
+	return nil
+}
+
+func (p *FileTileStore) Sync() error {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if err := p.f.Sync(); err != nil {
+		return fmt.Errorf("image/big: FileTileStore.Sync, %v", err)
+	}
+	return nil
+}
+
+func (p *FileTileStore) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if err := p.f.Close(); err != nil {
+		return fmt.Errorf("image/big: FileTileStore.Close, %v", err)
+	}
+	return nil
+}
+
+func (p *FileTileStore) read(v fileStoreRecord) (data []byte, err error) {
+	if v.Offset == 0 {
+		return
+	}
+	data = make([]byte, v.Size)
+	if _, err = p.f.ReadAt(data, v.Offset); err != nil {
+		err = fmt.Errorf("image/big: FileTileStore, %v", err)
+		return nil, err
+	}
+	return
+}
+
+// append writes the record of data at offset off of f.
+func (p *FileTileStore) append(f *os.File, off int64, kind int, key tileKey, data []byte) (v fileStoreRecord, err error) {
+	buf := make([]byte, fileStoreRecordSize+len(data))
+	binary.LittleEndian.PutUint32(buf[0:], uint32(kind))
+	binary.LittleEndian.PutUint32(buf[4:], uint32(key.Level))
+	binary.LittleEndian.PutUint32(buf[8:], uint32(key.Col))
+	binary.LittleEndian.PutUint32(buf[12:], uint32(key.Row))
+	binary.LittleEndian.PutUint32(buf[16:], uint32(len(data)))
+	binary.LittleEndian.PutUint32(buf[20:], crc32.ChecksumIEEE(data))
+	copy(buf[fileStoreRecordSize:], data)
+
+	if _, err = f.WriteAt(buf, off); err != nil {
+		err = fmt.Errorf("image/big: FileTileStore, %v", err)
+		return
+	}
+	v = fileStoreRecord{Offset: off + fileStoreRecordSize, Size: len(data)}
+	return
+}
+
+// recordSize returns the size of the record with its header, or 0 if v is
+// not saved.
+func (v fileStoreRecord) recordSize() int64 {
+	if v.Offset == 0 {
+		return 0
+	}
+	return fileStoreRecordSize + int64(v.Size)
+}
+
+// end returns the offset after the record.
+func (v fileStoreRecord) end() int64 {
+	return v.Offset + int64(v.Size)
+}
+
+type tileKeySlice []tileKey
+
+func (p tileKeySlice) Len() int      { return len(p) }
+func (p tileKeySlice) Swap(i, j int) { p[i], p[j] = p[j], p[i] }
+func (p tileKeySlice) Less(i, j int) bool {
+	if p[i].Level != p[j].Level {
+		return p[i].Level < p[j].Level
+	}
+	if p[i].Col != p[j].Col {
+		return p[i].Col < p[j].Col
+	}
+	return p[i].Row < p[j].Row
+}
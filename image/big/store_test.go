@@ -0,0 +1,380 @@
+// Copyright 2014 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package big
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	image_ext "github.com/chai2010/gopkg/image"
+	color_ext "github.com/chai2010/gopkg/image/color"
+)
+
+type tStoreTester struct {
+	Name      string
+	OpenStore func(dir string) (TileStore, error)
+}
+
+var tStoreTesterList = []tStoreTester{
+	{"dir", func(dir string) (TileStore, error) {
+		return OpenDirTileStore(filepath.Join(dir, "tiles"))
+	}},
+	{"file", func(dir string) (TileStore, error) {
+		return OpenFileTileStore(filepath.Join(dir, "tiles.bigt"))
+	}},
+}
+
+func TestImage_store(t *testing.T) {
+	for i, v := range tStoreTesterList {
+		dir, err := ioutil.TempDir("", "big")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(dir)
+
+		store, err := v.OpenStore(dir)
+		if err != nil {
+			t.Fatalf("%d: %s: %v", i, v.Name, err)
+		}
+		m, err := Create(store, image.Rect(0, 0, 1000, 600), image.Pt(64, 64), color.RGBAModel)
+		if err != nil {
+			t.Fatalf("%d: %s: Create: %v", i, v.Name, err)
+		}
+		m.SetCacheSize(minCacheSize)
+
+		fgd := image.NewUniform(color.RGBA{R: 200, G: 100, B: 50, A: 255})
+		r := image.Rect(100, 200, 700, 500)
+		if err = m.WriteRect(-1, r, fgd); err != nil {
+			t.Fatalf("%d: %s: WriteRect: %v", i, v.Name, err)
+		}
+		if err = m.Close(); err != nil {
+			t.Fatalf("%d: %s: Close: %v", i, v.Name, err)
+		}
+
+		if store, err = v.OpenStore(dir); err != nil {
+			t.Fatalf("%d: %s: %v", i, v.Name, err)
+		}
+		if m, err = Open(store); err != nil {
+			t.Fatalf("%d: %s: Open: %v", i, v.Name, err)
+		}
+		defer m.Close()
+
+		if m.Bounds() != image.Rect(0, 0, 1000, 600) || m.TileSize != image.Pt(64, 64) {
+			t.Fatalf("%d: %s: bad bounds %v or tile size %v", i, v.Name, m.Bounds(), m.TileSize)
+		}
+		if m.ColorModel() != color.RGBAModel {
+			t.Fatalf("%d: %s: bad color model: %v", i, v.Name, m.ColorModel())
+		}
+		if err = tCheckImageColor(m, r, fgd.C, -1); err != nil {
+			t.Fatalf("%d: %s: %v", i, v.Name, err)
+		}
+		if err = tCheckImageColor(m, image.Rect(0, 0, 100, 100), color.RGBA{}, -1); err != nil {
+			t.Fatalf("%d: %s: %v", i, v.Name, err)
+		}
+
+		want := NewImage(m.Bounds(), m.TileSize, m.Model)
+		want.WriteRect(-1, r, fgd)
+		for level := 0; level < m.Levels(); level++ {
+			got, want := m.SubLevels(level+1), want.SubLevels(level+1)
+			b := want.Bounds()
+			for y := b.Min.Y; y < b.Max.Y; y++ {
+				for x := b.Min.X; x < b.Max.X; x++ {
+					if c0, c1 := got.At(x, y), want.At(x, y); c0 != c1 {
+						t.Fatalf("%d: %s: level %d: bad color at (%d, %d); got %v, want %v",
+							i, v.Name, level, x, y, c0, c1,
+						)
+					}
+				}
+			}
+		}
+		if err = m.Flush(); err != nil {
+			t.Fatalf("%d: %s: Flush: %v", i, v.Name, err)
+		}
+	}
+}
+
+func TestDem_store(t *testing.T) {
+	for i, v := range tStoreTesterList {
+		dir, err := ioutil.TempDir("", "big")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(dir)
+
+		store, err := v.OpenStore(dir)
+		if err != nil {
+			t.Fatalf("%d: %s: %v", i, v.Name, err)
+		}
+		dem, err := CreateDem(store, image.Rect(0, 0, 300, 200), image.Pt(32, 32), color_ext.Gray32f{Y: 1})
+		if err != nil {
+			t.Fatalf("%d: %s: CreateDem: %v", i, v.Name, err)
+		}
+		dem.NoData = color_ext.Gray32f{Y: -9999}
+		dem.GeoTransform = image_ext.NewGeoTransform(116.3, 39.9, 0.001, 0.001)
+		dem.CRS = "EPSG:4326"
+		dem.SetCacheSize(minCacheSize)
+
+		src := image_ext.NewGray32f(image.Rect(0, 0, 100, 100))
+		for y := 0; y < 100; y++ {
+			for x := 0; x < 100; x++ {
+				src.SetGray32f(x, y, color_ext.Gray32f{Y: float32(x + y)})
+			}
+		}
+		if err = dem.WriteRect(-1, image.Rect(50, 60, 150, 160), src); err != nil {
+			t.Fatalf("%d: %s: WriteRect: %v", i, v.Name, err)
+		}
+		if err = dem.Close(); err != nil {
+			t.Fatalf("%d: %s: Close: %v", i, v.Name, err)
+		}
+
+		if store, err = v.OpenStore(dir); err != nil {
+			t.Fatalf("%d: %s: %v", i, v.Name, err)
+		}
+		if dem, err = OpenDem(store); err != nil {
+			t.Fatalf("%d: %s: OpenDem: %v", i, v.Name, err)
+		}
+		defer dem.Close()
+
+		if dem.NoData != (color_ext.Gray32f{Y: -9999}) || dem.ZeroValue.Y != 1 {
+			t.Fatalf("%d: %s: bad nodata %v or zero value %v", i, v.Name, dem.NoData, dem.ZeroValue)
+		}
+		if dem.GeoTransform != image_ext.NewGeoTransform(116.3, 39.9, 0.001, 0.001) || dem.CRS != "EPSG:4326" {
+			t.Fatalf("%d: %s: bad georeferencing %v, %q", i, v.Name, dem.GeoTransform, dem.CRS)
+		}
+		for _, pt := range []image.Point{{50, 60}, {149, 159}, {99, 120}} {
+			got, want := dem.Gray32fAt(pt.X, pt.Y).Y, float32(pt.X-50+pt.Y-60)
+			if got != want {
+				t.Fatalf("%d: %s: bad value at %v; got %v, want %v", i, v.Name, pt, got, want)
+			}
+		}
+		if got := dem.Gray32fAt(0, 0).Y; got != 1 {
+			t.Fatalf("%d: %s: bad zero value; got %v", i, v.Name, got)
+		}
+		if _, err = Open(store); err == nil {
+			t.Fatalf("%d: %s: Open a Dem store: expect error", i, v.Name)
+		}
+	}
+}
+
+func TestFileTileStore_brokenTail(t *testing.T) {
+	dir, err := ioutil.TempDir("", "big")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	name := filepath.Join(dir, "tiles.bigt")
+
+	store, err := OpenFileTileStore(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = store.WriteTile(1, 2, 3, []byte("tile-v1")); err != nil {
+		t.Fatal(err)
+	}
+	if err = store.WriteTile(1, 2, 3, []byte("tile-v2")); err != nil {
+		t.Fatal(err)
+	}
+	if err = store.WriteTile(0, 0, 0, []byte("broken")); err != nil {
+		t.Fatal(err)
+	}
+	store.Close()
+
+	fi, err := os.Stat(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = os.Truncate(name, fi.Size()-2); err != nil {
+		t.Fatal(err)
+	}
+
+	if store, err = OpenFileTileStore(name); err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	if data, err := store.ReadTile(1, 2, 3); err != nil || string(data) != "tile-v2" {
+		t.Fatalf("bad tile: %q, %v", data, err)
+	}
+	if data, err := store.ReadTile(0, 0, 0); err != nil || data != nil {
+		t.Fatalf("broken tile is not dropped: %q, %v", data, err)
+	}
+	if data, err := store.ReadMeta(); err != nil || data != nil {
+		t.Fatalf("bad meta: %q, %v", data, err)
+	}
+}
+
+func TestFileTileStore_compact(t *testing.T) {
+	dir, err := ioutil.TempDir("", "big")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	name := filepath.Join(dir, "tiles.bigt")
+
+	store, err := OpenFileTileStore(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 10; i++ {
+		for col := 0; col < 4; col++ {
+			if err = store.WriteTile(0, col, 0, []byte(fmt.Sprintf("tile-%d-%d", col, i))); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err = store.WriteMeta([]byte(fmt.Sprintf("meta-%d", i))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := store.Garbage(); n == 0 {
+		t.Fatalf("no garbage")
+	}
+	fi0, err := os.Stat(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = store.Compact(); err != nil {
+		t.Fatal(err)
+	}
+	if n := store.Garbage(); n != 0 {
+		t.Fatalf("garbage after Compact: %d", n)
+	}
+	fi1, err := os.Stat(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi1.Size() >= fi0.Size()/5 {
+		t.Fatalf("file is not compacted: %d => %d", fi0.Size(), fi1.Size())
+	}
+
+	// the store is still writable, and the records are kept after reopen
+	if err = store.WriteTile(1, 0, 0, []byte("tile-1")); err != nil {
+		t.Fatal(err)
+	}
+	store.Close()
+	if store, err = OpenFileTileStore(name); err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	if n := store.Garbage(); n != 0 {
+		t.Fatalf("garbage after reopen: %d", n)
+	}
+	for col := 0; col < 4; col++ {
+		if data, err := store.ReadTile(0, col, 0); err != nil || string(data) != fmt.Sprintf("tile-%d-9", col) {
+			t.Fatalf("bad tile %d: %q, %v", col, data, err)
+		}
+	}
+	if data, err := store.ReadTile(1, 0, 0); err != nil || string(data) != "tile-1" {
+		t.Fatalf("bad tile: %q, %v", data, err)
+	}
+	if data, err := store.ReadMeta(); err != nil || string(data) != "meta-9" {
+		t.Fatalf("bad meta: %q, %v", data, err)
+	}
+}
+
+// tSlowTileStore blocks the reading and writing of the tiles in the row 1
+// until unblock is closed.
+type tSlowTileStore struct {
+	TileStore
+	blocked chan struct{}
+	unblock chan struct{}
+}
+
+func (p *tSlowTileStore) ReadTile(level, col, row int) (data []byte, err error) {
+	if row == 1 {
+		select {
+		case p.blocked <- struct{}{}:
+		default:
+		}
+		<-p.unblock
+	}
+	return p.TileStore.ReadTile(level, col, row)
+}
+
+func (p *tSlowTileStore) WriteTile(level, col, row int, data []byte) error {
+	if row == 1 {
+		select {
+		case p.blocked <- struct{}{}:
+		default:
+		}
+		<-p.unblock
+	}
+	return p.TileStore.WriteTile(level, col, row, data)
+}
+
+func TestStoreTiles_slowStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "big")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	store, err := OpenDirTileStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+
+	slow := &tSlowTileStore{
+		TileStore: store,
+		blocked:   make(chan struct{}, 1),
+		unblock:   make(chan struct{}),
+	}
+	p := newStoreTiles(slow, func() draw.Image {
+		return image.NewGray(image.Rect(0, 0, 4, 4))
+	})
+	p.setCacheSize(minCacheSize)
+	p.getTile(tileKey{0, 0, 0}, true).Set(1, 2, color.Gray{Y: 100})
+
+	// the cached tiles are used during the slow reading
+	done := make(chan draw.Image, 2)
+	for i := 0; i < 2; i++ {
+		go func() { done <- p.getTile(tileKey{0, 0, 1}, true) }()
+	}
+	<-slow.blocked
+	got := make(chan color.Color)
+	go func() { got <- p.getTile(tileKey{0, 0, 0}, false).At(1, 2) }()
+	select {
+	case c := <-got:
+		if c != (color.Gray{Y: 100}) {
+			t.Fatalf("bad color: %v", c)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("getTile is blocked by the slow ReadTile")
+	}
+	close(slow.unblock)
+	if a, b := <-done, <-done; a != b {
+		t.Fatal("the tile is loaded twice")
+	}
+
+	// the cached tiles are used during the slow saving of the evicted tile
+	slow.unblock = make(chan struct{})
+	go func() {
+		for col := 0; col < minCacheSize; col++ {
+			p.getTile(tileKey{0, col, 2}, false)
+		}
+	}()
+	<-slow.blocked
+	go func() { got <- p.getTile(tileKey{0, 0, 0}, false).At(1, 2) }()
+	select {
+	case c := <-got:
+		if c != (color.Gray{Y: 100}) {
+			t.Fatalf("bad color: %v", c)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("getTile is blocked by the slow WriteTile")
+	}
+	close(slow.unblock)
+	if err := p.flush(); err != nil {
+		t.Fatal(err)
+	}
+	if data, err := store.ReadTile(0, 0, 1); err != nil || data == nil {
+		t.Fatalf("the evicted tile is not saved: %v", err)
+	}
+}
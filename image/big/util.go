@@ -89,6 +89,9 @@ func newImageTile(tileSize image.Point, model color.Model) image_ext.ImageBuffer
 	case color_ext.RGBA128fModel:
 		return image_ext.NewRGBA128f(image.Rect(0, 0, tileSize.X, tileSize.Y))
 	}
+	if model, ok := model.(*color_ext.MultiBandModel); ok {
+		return newMultiBandTile(tileSize, model)
+	}
 	panic(fmt.Sprintf("image/big: newImageTile, bad color model: %T", model))
 }
 
@@ -105,6 +108,22 @@ func newDemTile(tileSize image.Point, zeroValue color_ext.Gray32f) *image_ext.Gr
 	return m
 }
 
+// newMultiBandTile returns a new tile filled with the nodata values.
+func newMultiBandTile(tileSize image.Point, model *color_ext.MultiBandModel) *image_ext.MultiBand {
+	m := image_ext.NewMultiBand(image.Rect(0, 0, tileSize.X, tileSize.Y), model)
+	for k, band := range model.Band {
+		if !band.HasNoData || band.NoData == 0 {
+			continue
+		}
+		for y := 0; y < tileSize.Y; y++ {
+			for x := 0; x < tileSize.X; x++ {
+				m.SetValue(x, y, k, band.NoData)
+			}
+		}
+	}
+	return m
+}
+
 func isValidImageColorModel(model color.Model) bool {
 	if model == nil {
 		return false
@@ -123,6 +142,9 @@ func isValidImageColorModel(model color.Model) bool {
 	case color_ext.RGBA128fModel:
 		return true
 	}
+	if model, ok := model.(*color_ext.MultiBandModel); ok {
+		return model.Valid() == nil
+	}
 	return false
 }
 
@@ -49,29 +49,52 @@ func Encode(w io.Writer, m image.Image, opt *Options) error {
 	return bmp.Encode(w, m)
 }
 
-func imageExtDecode(r io.Reader, opt interface{}) (image.Image, error) {
-	if opt, ok := opt.(*Options); ok {
-		return Decode(r, opt)
-	} else {
-		return Decode(r, nil)
+// newOptions converts the common options to the bmp options.
+func newOptions(opt *image_ext.Options) (*Options, error) {
+	var p Options
+	if ok, err := image_ext.ConvertOptions("bmp", opt, &p); !ok {
+		return nil, err
 	}
+	return &p, nil
 }
 
-func imageExtEncode(w io.Writer, m image.Image, opt interface{}) error {
-	if opt, ok := opt.(*Options); ok {
-		return Encode(w, m, opt)
-	} else {
-		return Encode(w, m, nil)
+// newEncodeOptions converts the common options to the bmp options,
+// BMP images are always lossless and uncompressed.
+func newEncodeOptions(opt *image_ext.Options) (*Options, error) {
+	var p Options
+	ok, err := image_ext.ConvertEncodeOptions("bmp", opt, &p, image_ext.EncodeSupport{
+		Compression: []image_ext.Compression{image_ext.CompressionNone},
+	})
+	if !ok {
+		return nil, err
+	}
+	return &p, nil
+}
+
+func imageExtDecode(r io.Reader, opt *image_ext.Options) (image.Image, error) {
+	p, err := newOptions(opt)
+	if err != nil {
+		return nil, err
+	}
+	return Decode(r, p)
+}
+
+func imageExtEncode(w io.Writer, m image.Image, opt *image_ext.Options) error {
+	p, err := newEncodeOptions(opt)
+	if err != nil {
+		return err
 	}
+	return Encode(w, m, p)
 }
 
 func init() {
 	image_ext.RegisterFormat(image_ext.Format{
-		Name:         "bmp",
-		Extensions:   []string{".bmp"},
-		Magics:       []string{"BM????\x00\x00\x00\x00"},
-		DecodeConfig: DecodeConfig,
-		Decode:       imageExtDecode,
-		Encode:       imageExtEncode,
+		Name:          "bmp",
+		Extensions:    []string{".bmp"},
+		Magics:        []string{"BM????\x00\x00\x00\x00"},
+		DecodeConfig:  DecodeConfig,
+		Decode:        imageExtDecode,
+		Encode:        imageExtEncode,
+		NewTileReader: imageExtNewTileReader,
 	})
 }
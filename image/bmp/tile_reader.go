@@ -0,0 +1,193 @@
+// Copyright 2014 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package bmp
+
+import (
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+
+	image_ext "github.com/chai2010/gopkg/image"
+	"github.com/chai2010/gopkg/image/convert"
+)
+
+const (
+	fileHeaderLen = 14
+	infoHeaderLen = 40
+)
+
+type tileReader struct {
+	r       io.ReaderAt
+	opt     *Options
+	config  image.Config
+	palette color.Palette
+	bpp     int
+	dataOff int64
+	stride  int
+	topDown bool
+	width   int
+	height  int
+}
+
+// NewTileReader returns a TileReader for the BMP image stored in r.
+// Uncompressed 8 and 24 bits per pixel images are read row by row for
+// every rectangle, other images are decoded once and the rectangles are
+// taken from it.
+func NewTileReader(r io.ReaderAt, size int64, opt *Options) (p image_ext.TileReader, err error) {
+	var b [fileHeaderLen + infoHeaderLen]byte
+	if _, err = r.ReadAt(b[:], 0); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return
+	}
+	if string(b[:2]) != "BM" {
+		err = fmt.Errorf("image/bmp: NewTileReader, bad magic")
+		return
+	}
+
+	var (
+		dataOff     = binary.LittleEndian.Uint32(b[10:14])
+		infoLen     = binary.LittleEndian.Uint32(b[14:18])
+		width       = int(int32(binary.LittleEndian.Uint32(b[18:22])))
+		height      = int(int32(binary.LittleEndian.Uint32(b[22:26])))
+		planes      = binary.LittleEndian.Uint16(b[26:28])
+		bpp         = int(binary.LittleEndian.Uint16(b[28:30]))
+		compression = binary.LittleEndian.Uint32(b[30:34])
+		numColors   = int(binary.LittleEndian.Uint32(b[46:50]))
+	)
+	topDown := height < 0
+	if topDown {
+		height = -height
+	}
+	if infoLen < infoHeaderLen || planes != 1 || compression != 0 || (bpp != 8 && bpp != 24) || width <= 0 {
+		var m image.Image
+		if m, err = Decode(io.NewSectionReader(r, 0, size), opt); err != nil {
+			return
+		}
+		p = image_ext.NewImageTileReader(m)
+		return
+	}
+
+	tr := &tileReader{
+		r:       r,
+		opt:     opt,
+		bpp:     bpp,
+		dataOff: int64(dataOff),
+		stride:  ((bpp*width + 31) / 32) * 4,
+		topDown: topDown,
+		width:   width,
+		height:  height,
+	}
+	if size < tr.dataOff+int64(tr.stride*height) {
+		err = fmt.Errorf("image/bmp: NewTileReader, bad data size")
+		return
+	}
+
+	if bpp == 8 {
+		if numColors <= 0 || numColors > 256 {
+			numColors = 256
+		}
+		pal := make([]byte, numColors*4)
+		if _, err = r.ReadAt(pal, fileHeaderLen+int64(infoLen)); err != nil {
+			return
+		}
+		tr.palette = make(color.Palette, numColors)
+		for i := range tr.palette {
+			// BMP images are stored in BGR order rather than RGB order.
+			// Every 4th byte is padding.
+			tr.palette[i] = color.RGBA{pal[4*i+2], pal[4*i+1], pal[4*i+0], 0xFF}
+		}
+		tr.config = image.Config{ColorModel: tr.palette, Width: width, Height: height}
+	} else {
+		tr.config = image.Config{ColorModel: color.RGBAModel, Width: width, Height: height}
+	}
+	if opt != nil && opt.ColorModel != nil {
+		tr.config.ColorModel = opt.ColorModel
+	}
+
+	p = tr
+	return
+}
+
+func (p *tileReader) Config() image.Config {
+	return p.config
+}
+
+func (p *tileReader) ReadRect(r image.Rectangle, buf image_ext.ImageBuffer) (m image.Image, err error) {
+	r = r.Intersect(image.Rect(0, 0, p.width, p.height))
+	if r.Empty() {
+		err = fmt.Errorf("image/bmp: ReadRect, empty rect: %v", r)
+		return
+	}
+
+	pixSize := p.bpp / 8
+	row := make([]byte, r.Dx()*pixSize)
+	readRow := func(y int) error {
+		if !p.topDown {
+			y = p.height - 1 - y
+		}
+		off := p.dataOff + int64(y*p.stride+r.Min.X*pixSize)
+		_, err := p.r.ReadAt(row, off)
+		return err
+	}
+
+	switch p.bpp {
+	case 8:
+		paletted := image.NewPaletted(r, p.palette)
+		for y := r.Min.Y; y < r.Max.Y; y++ {
+			if err = readRow(y); err != nil {
+				return
+			}
+			copy(paletted.Pix[paletted.PixOffset(r.Min.X, y):][:r.Dx()], row)
+		}
+		m = paletted
+	case 24:
+		rgba := newRGBA(r, buf)
+		for y := r.Min.Y; y < r.Max.Y; y++ {
+			if err = readRow(y); err != nil {
+				return
+			}
+			d := rgba.Pix[rgba.PixOffset(r.Min.X, y):][:r.Dx()*4]
+			for i, j := 0, 0; i < len(row); i, j = i+3, j+4 {
+				// BMP images are stored in BGR order rather than RGB order.
+				d[j+0] = row[i+2]
+				d[j+1] = row[i+1]
+				d[j+2] = row[i+0]
+				d[j+3] = 0xFF
+			}
+		}
+		m = rgba
+	}
+
+	// convert color model
+	if p.opt != nil && p.opt.ColorModel != nil {
+		m = convert.ColorModel(m, p.opt.ColorModel)
+	}
+	return
+}
+
+func (p *tileReader) Close() error {
+	return nil
+}
+
+func newRGBA(r image.Rectangle, buf image_ext.ImageBuffer) *image.RGBA {
+	if buf != nil && r.In(buf.Bounds()) {
+		if m, ok := buf.SubImage(r).(*image.RGBA); ok {
+			return m
+		}
+	}
+	return image.NewRGBA(r)
+}
+
+func imageExtNewTileReader(r io.ReaderAt, size int64, opt *image_ext.Options) (image_ext.TileReader, error) {
+	p, err := newOptions(opt)
+	if err != nil {
+		return nil, err
+	}
+	return NewTileReader(r, size, p)
+}
@@ -7,6 +7,7 @@ package color
 
 import (
 	"image/color"
+	"math"
 )
 
 // Gray32f represents a float32 grayscale color.
@@ -74,6 +75,78 @@ func (c RGBA128f) RGBA() (r, g, b, a uint32) {
 	return
 }
 
+// Gray16s represents a signed 16-bit grayscale color.
+type Gray16s struct {
+	Y int16
+}
+
+func (c Gray16s) RGBA() (r, g, b, a uint32) {
+	y := uint32(f64ToU16(float64(c.Y)))
+	return y, y, y, 0xffff
+}
+
+// Gray32i represents a signed 32-bit grayscale color.
+type Gray32i struct {
+	Y int32
+}
+
+func (c Gray32i) RGBA() (r, g, b, a uint32) {
+	y := uint32(f64ToU16(float64(c.Y)))
+	return y, y, y, 0xffff
+}
+
+// Gray64f represents a float64 grayscale color.
+type Gray64f struct {
+	Y float64
+}
+
+func (c Gray64f) RGBA() (r, g, b, a uint32) {
+	y := uint32(f64ToU16(c.Y))
+	return y, y, y, 0xffff
+}
+
+// RGB48s represents a 48-bit fully opaque color,
+// having signed 16 bits for each of red, green and blue.
+type RGB48s struct {
+	R, G, B int16
+}
+
+func (c RGB48s) RGBA() (r, g, b, a uint32) {
+	r = uint32(f64ToU16(float64(c.R)))
+	g = uint32(f64ToU16(float64(c.G)))
+	b = uint32(f64ToU16(float64(c.B)))
+	a = 0xFFFF
+	return
+}
+
+// RGB96i represents a 96-bit fully opaque color,
+// having signed 32 bits for each of red, green and blue.
+type RGB96i struct {
+	R, G, B int32
+}
+
+func (c RGB96i) RGBA() (r, g, b, a uint32) {
+	r = uint32(f64ToU16(float64(c.R)))
+	g = uint32(f64ToU16(float64(c.G)))
+	b = uint32(f64ToU16(float64(c.B)))
+	a = 0xFFFF
+	return
+}
+
+// RGB192f represents a 192-bit fully opaque color,
+// having float64 for each of red, green and blue.
+type RGB192f struct {
+	R, G, B float64
+}
+
+func (c RGB192f) RGBA() (r, g, b, a uint32) {
+	r = uint32(f64ToU16(c.R))
+	g = uint32(f64ToU16(c.G))
+	b = uint32(f64ToU16(c.B))
+	a = 0xFFFF
+	return
+}
+
 // Models for the standard color types.
 var (
 	Gray32fModel  color.Model = color.ModelFunc(gray32fModel)
@@ -81,6 +154,13 @@ var (
 	RGB48Model    color.Model = color.ModelFunc(rgb48Model)
 	RGB96fModel   color.Model = color.ModelFunc(rgb96fModel)
 	RGBA128fModel color.Model = color.ModelFunc(rgba128fModel)
+
+	Gray16sModel color.Model = color.ModelFunc(gray16sModel)
+	Gray32iModel color.Model = color.ModelFunc(gray32iModel)
+	Gray64fModel color.Model = color.ModelFunc(gray64fModel)
+	RGB48sModel  color.Model = color.ModelFunc(rgb48sModel)
+	RGB96iModel  color.Model = color.ModelFunc(rgb96iModel)
+	RGB192fModel color.Model = color.ModelFunc(rgb192fModel)
 )
 
 func gray32fModel(c color.Color) color.Color {
@@ -143,3 +223,61 @@ func rgba128fModel(c color.Color) color.Color {
 		return RGBA128f{float32(r), float32(g), float32(b), float32(a)}
 	}
 }
+
+// The values of the signed integer and float colors are kept when they are
+// converted to each other, other colors use the 16-bit values of RGBA.
+
+func gray16sModel(c color.Color) color.Color {
+	if _, ok := c.(Gray16s); ok {
+		return c
+	}
+	y := grayValue(c)
+	return Gray16s{int16(clampFloat64(y, math.MinInt16, math.MaxInt16))}
+}
+
+func gray32iModel(c color.Color) color.Color {
+	if _, ok := c.(Gray32i); ok {
+		return c
+	}
+	y := grayValue(c)
+	return Gray32i{int32(clampFloat64(y, math.MinInt32, math.MaxInt32))}
+}
+
+func gray64fModel(c color.Color) color.Color {
+	if _, ok := c.(Gray64f); ok {
+		return c
+	}
+	return Gray64f{grayValue(c)}
+}
+
+func rgb48sModel(c color.Color) color.Color {
+	if _, ok := c.(RGB48s); ok {
+		return c
+	}
+	r, g, b := rgbValue(c)
+	return RGB48s{
+		R: int16(clampFloat64(r, math.MinInt16, math.MaxInt16)),
+		G: int16(clampFloat64(g, math.MinInt16, math.MaxInt16)),
+		B: int16(clampFloat64(b, math.MinInt16, math.MaxInt16)),
+	}
+}
+
+func rgb96iModel(c color.Color) color.Color {
+	if _, ok := c.(RGB96i); ok {
+		return c
+	}
+	r, g, b := rgbValue(c)
+	return RGB96i{
+		R: int32(clampFloat64(r, math.MinInt32, math.MaxInt32)),
+		G: int32(clampFloat64(g, math.MinInt32, math.MaxInt32)),
+		B: int32(clampFloat64(b, math.MinInt32, math.MaxInt32)),
+	}
+}
+
+func rgb192fModel(c color.Color) color.Color {
+	if _, ok := c.(RGB192f); ok {
+		return c
+	}
+	r, g, b := rgbValue(c)
+	return RGB192f{r, g, b}
+}
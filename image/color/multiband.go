@@ -0,0 +1,233 @@
+// Copyright 2014 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package color
+
+import (
+	"fmt"
+	"image/color"
+	"math"
+	"reflect"
+)
+
+// BandInfo describes one band of a multi-band image.
+type BandInfo struct {
+	Name      string       // band name, such as "red" or "nir"
+	DataType  reflect.Kind // Uint8/Uint16/Int16/Int32/Float32/Float64
+	NoData    float64      // the nodata value, valid if HasNoData is true
+	HasNoData bool
+}
+
+// Size returns the size of one sample of the band in bytes,
+// or 0 if the data type is not supported.
+func (p BandInfo) Size() int {
+	switch p.DataType {
+	case reflect.Uint8:
+		return 1
+	case reflect.Uint16, reflect.Int16:
+		return 2
+	case reflect.Int32, reflect.Float32:
+		return 4
+	case reflect.Float64:
+		return 8
+	}
+	return 0
+}
+
+// IsNoData reports whether v is the nodata value of the band.
+func (p BandInfo) IsNoData(v float64) bool {
+	if !p.HasNoData {
+		return false
+	}
+	if math.IsNaN(p.NoData) {
+		return math.IsNaN(v)
+	}
+	return v == p.NoData
+}
+
+// BandMapping maps three bands of a multi-band image to red, green and blue.
+// Band[i] < 0 maps a zero value. The values in [Min[i], Max[i]] are scaled
+// to [0, 0xffff]; if Min[i] == Max[i], the native range of the band data
+// type is used, 0-0xff for Uint8 and 0-0xffff for the other types.
+type BandMapping struct {
+	Band     [3]int
+	Min, Max [3]float64
+}
+
+// MultiBandModel is the color model of a multi-band image. All the tiles
+// or sub images of the same image should share the same model pointer.
+type MultiBandModel struct {
+	Band    []BandInfo
+	Mapping BandMapping
+}
+
+// NewMultiBandModel returns a new multi-band model. The first three bands
+// are mapped to red, green and blue, or the first band is mapped to gray
+// if there are less than three bands.
+func NewMultiBandModel(band ...BandInfo) *MultiBandModel {
+	p := &MultiBandModel{
+		Band: append([]BandInfo(nil), band...),
+	}
+	if len(band) >= 3 {
+		p.Mapping.Band = [3]int{0, 1, 2}
+	}
+	return p
+}
+
+// NewUniformMultiBandModel returns a new multi-band model with the given
+// number of bands of the same data type.
+func NewUniformMultiBandModel(channels int, dataType reflect.Kind) *MultiBandModel {
+	band := make([]BandInfo, channels)
+	for i := range band {
+		band[i].DataType = dataType
+	}
+	return NewMultiBandModel(band...)
+}
+
+// Channels returns the number of bands.
+func (p *MultiBandModel) Channels() int {
+	return len(p.Band)
+}
+
+// PixelSize returns the size of one pixel of all the bands in bytes.
+func (p *MultiBandModel) PixelSize() int {
+	n := 0
+	for _, b := range p.Band {
+		n += b.Size()
+	}
+	return n
+}
+
+// DataType returns the data type shared by all the bands, or reflect.Invalid
+// if the bands have different data types.
+func (p *MultiBandModel) DataType() reflect.Kind {
+	if len(p.Band) == 0 {
+		return reflect.Invalid
+	}
+	for _, b := range p.Band[1:] {
+		if b.DataType != p.Band[0].DataType {
+			return reflect.Invalid
+		}
+	}
+	return p.Band[0].DataType
+}
+
+// SameLayout reports whether p and q have the same band data types.
+func (p *MultiBandModel) SameLayout(q *MultiBandModel) bool {
+	if p == q {
+		return true
+	}
+	if len(p.Band) != len(q.Band) {
+		return false
+	}
+	for i := range p.Band {
+		if p.Band[i].DataType != q.Band[i].DataType {
+			return false
+		}
+	}
+	return true
+}
+
+// Valid returns an error if the model has no band, a band with unsupported
+// data type, or a mapping to a missing band.
+func (p *MultiBandModel) Valid() error {
+	if len(p.Band) == 0 {
+		return fmt.Errorf("image/color: MultiBandModel, no band")
+	}
+	for i, b := range p.Band {
+		if b.Size() == 0 {
+			return fmt.Errorf("image/color: MultiBandModel, band %d, unsupported data type: %v", i, b.DataType)
+		}
+	}
+	for _, k := range p.Mapping.Band {
+		if k >= len(p.Band) {
+			return fmt.Errorf("image/color: MultiBandModel, bad mapping band: %d", k)
+		}
+	}
+	return nil
+}
+
+// ToRGB maps the value v of the band which is mapped to the color i to a
+// 16-bit color value.
+func (p *MultiBandModel) ToRGB(i int, v float64) uint16 {
+	min, max := p.mappingRange(i)
+	return f64ToU16((clampFloat64(v, min, max)-min)/(max-min)*0xffff + 0.5)
+}
+
+// FromRGB maps the 16-bit color value v to the value of the band which is
+// mapped to the color i, the value is rounded for the integer bands.
+func (p *MultiBandModel) FromRGB(i int, v uint16) float64 {
+	min, max := p.mappingRange(i)
+	x := min + float64(v)/0xffff*(max-min)
+	if k := p.Mapping.Band[i]; k >= 0 {
+		switch p.Band[k].DataType {
+		case reflect.Float32, reflect.Float64:
+		default:
+			x = math.Floor(x + 0.5)
+		}
+	}
+	return x
+}
+
+// FromColor returns the values of the bands which are mapped to red, green
+// and blue. If all the colors are mapped to the same band, the luminance of
+// c is used. It reports nodata if c is fully transparent and the mapped bands
+// have nodata values.
+func (p *MultiBandModel) FromColor(c color.Color) (v [3]float64, nodata bool) {
+	c1 := color.RGBA64Model.Convert(c).(color.RGBA64)
+	if c1.A == 0 && p.HasNoData() {
+		for i, k := range p.Mapping.Band {
+			if k >= 0 {
+				v[i] = p.Band[k].NoData
+			}
+		}
+		return v, true
+	}
+	rgb := [3]uint16{c1.R, c1.G, c1.B}
+	if m := p.Mapping.Band; m[0] == m[1] && m[1] == m[2] {
+		y := uint16((19595*uint32(c1.R) + 38470*uint32(c1.G) + 7471*uint32(c1.B) + 1<<15) >> 16)
+		rgb = [3]uint16{y, y, y}
+	}
+	for i := range rgb {
+		v[i] = p.FromRGB(i, rgb[i])
+	}
+	return v, false
+}
+
+// HasNoData reports whether any mapped band has a nodata value.
+func (p *MultiBandModel) HasNoData() bool {
+	for _, k := range p.Mapping.Band {
+		if k >= 0 && p.Band[k].HasNoData {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *MultiBandModel) mappingRange(i int) (min, max float64) {
+	min, max = p.Mapping.Min[i], p.Mapping.Max[i]
+	if min == max {
+		min, max = 0, 0xffff
+		if k := p.Mapping.Band[i]; k >= 0 && p.Band[k].DataType == reflect.Uint8 {
+			max = 0xff
+		}
+	}
+	return
+}
+
+// Convert converts c to the color.RGBA64 value which can be stored in the
+// mapped bands.
+func (p *MultiBandModel) Convert(c color.Color) color.Color {
+	v, nodata := p.FromColor(c)
+	if nodata {
+		return color.RGBA64{}
+	}
+	var rgb [3]uint16
+	for i, k := range p.Mapping.Band {
+		if k >= 0 {
+			rgb[i] = p.ToRGB(i, v[i])
+		}
+	}
+	return color.RGBA64{R: rgb[0], G: rgb[1], B: rgb[2], A: 0xffff}
+}
@@ -5,6 +5,7 @@
 package color
 
 import (
+	"image/color"
 	"math"
 )
 
@@ -18,3 +19,69 @@ func f32ToU16(v float32) uint16 {
 		return uint16(v)
 	}
 }
+
+func f64ToU16(v float64) uint16 {
+	switch {
+	case v < 0:
+		return 0
+	case v > math.MaxUint16:
+		return math.MaxUint16
+	default:
+		return uint16(v)
+	}
+}
+
+func clampFloat64(v, min, max float64) float64 {
+	switch {
+	case v < min:
+		return min
+	case v > max:
+		return max
+	default:
+		return v
+	}
+}
+
+// grayValue returns the gray value of c, the value of the signed integer
+// and float colors is not clamped.
+func grayValue(c color.Color) float64 {
+	switch c := c.(type) {
+	case Gray16s:
+		return float64(c.Y)
+	case Gray32i:
+		return float64(c.Y)
+	case Gray32f:
+		return float64(c.Y)
+	case Gray64f:
+		return c.Y
+	case RGB48s, RGB96i, RGB96f, RGB192f, RGBA128f:
+		r, g, b := rgbValue(c)
+		return (299*r + 587*g + 114*b) / 1000
+	default:
+		r, g, b, _ := c.RGBA()
+		return float64((299*r + 587*g + 114*b + 500) / 1000)
+	}
+}
+
+// rgbValue returns the red, green and blue values of c, the value of the
+// signed integer and float colors is not clamped.
+func rgbValue(c color.Color) (r, g, b float64) {
+	switch c := c.(type) {
+	case Gray16s, Gray32i, Gray32f, Gray64f:
+		y := grayValue(c)
+		return y, y, y
+	case RGB48s:
+		return float64(c.R), float64(c.G), float64(c.B)
+	case RGB96i:
+		return float64(c.R), float64(c.G), float64(c.B)
+	case RGB96f:
+		return float64(c.R), float64(c.G), float64(c.B)
+	case RGB192f:
+		return c.R, c.G, c.B
+	case RGBA128f:
+		return float64(c.R), float64(c.G), float64(c.B)
+	default:
+		r, g, b, _ := c.RGBA()
+		return float64(r), float64(g), float64(b)
+	}
+}
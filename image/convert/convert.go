@@ -9,15 +9,27 @@ import (
 	"fmt"
 	"image"
 	"image/color"
+	"image/draw"
+	"math"
 
 	image_ext "github.com/chai2010/gopkg/image"
 	color_ext "github.com/chai2010/gopkg/image/color"
 )
 
+// ColorModel converts m to the color model. If m has nodata pixels, the
+// nodata pixels are zero in the result, which is an image_ext.MaskedImage
+// with the nodata mask of m.
 func ColorModel(m image.Image, model color.Model) image.Image {
 	if model == nil {
 		return m
 	}
+	if m, ok := m.(image_ext.NoDataImage); ok && m.HasNoData() {
+		return noDataColorModel(m, model)
+	}
+	return colorModel(m, model)
+}
+
+func colorModel(m image.Image, model color.Model) image.Image {
 	switch model {
 	case color.GrayModel:
 		return Gray(m)
@@ -37,10 +49,45 @@ func ColorModel(m image.Image, model color.Model) image.Image {
 		return RGBA64(m)
 	case color_ext.RGBA128fModel:
 		return RGBA128f(m)
+	case color_ext.Gray16sModel:
+		return Gray16s(m)
+	case color_ext.Gray32iModel:
+		return Gray32i(m)
+	case color_ext.Gray64fModel:
+		return Gray64f(m)
+	case color_ext.RGB48sModel:
+		return RGB48s(m)
+	case color_ext.RGB96iModel:
+		return RGB96i(m)
+	case color_ext.RGB192fModel:
+		return RGB192f(m)
 	}
 	panic(fmt.Sprintf("image/convert: unsupport colorModel %T", model))
 }
 
+func noDataColorModel(m image_ext.NoDataImage, model color.Model) image.Image {
+	var src image.Image = m
+	if masked, ok := m.(*image_ext.MaskedImage); ok {
+		src = masked.Image
+	}
+	dst := colorModel(src, model).(draw.Image)
+	b := m.Bounds()
+	mask := image_ext.NewMask(b)
+	image_ext.ParallelRows(b, func(b image.Rectangle) {
+		for y := b.Min.Y; y < b.Max.Y; y++ {
+			for x := b.Min.X; x < b.Max.X; x++ {
+				if m.IsNoData(x, y) {
+					mask.SetNoData(x, y, true)
+					if dst != src {
+						dst.Set(x, y, color.Transparent)
+					}
+				}
+			}
+		}
+	}, m)
+	return image_ext.NewMaskedImage(dst, nil, mask)
+}
+
 func Color(m image.Image, isColor bool) image.Image {
 	if isColor {
 		return convertToColor(m)
@@ -57,37 +104,47 @@ func Gray(m image.Image) *image.Gray {
 	gray := image.NewGray(b)
 	switch m := m.(type) {
 	case *image.Gray16:
-		for y := b.Min.Y; y < b.Max.Y; y++ {
-			for x := b.Min.X; x < b.Max.X; x++ {
-				v := m.Gray16At(x, y)
-				gray.SetGray(x, y, color.Gray{uint8(v.Y >> 8)})
+		image_ext.ParallelRows(b, func(b image.Rectangle) {
+			for y := b.Min.Y; y < b.Max.Y; y++ {
+				for x := b.Min.X; x < b.Max.X; x++ {
+					v := m.Gray16At(x, y)
+					gray.SetGray(x, y, color.Gray{uint8(v.Y >> 8)})
+				}
 			}
-		}
+		}, m)
 	case *image.RGBA:
-		for y := b.Min.Y; y < b.Max.Y; y++ {
-			for x := b.Min.X; x < b.Max.X; x++ {
-				gray.SetGray(x, y, color.GrayModel.Convert(m.RGBAAt(x, y)).(color.Gray))
+		image_ext.ParallelRows(b, func(b image.Rectangle) {
+			for y := b.Min.Y; y < b.Max.Y; y++ {
+				for x := b.Min.X; x < b.Max.X; x++ {
+					gray.SetGray(x, y, color.GrayModel.Convert(m.RGBAAt(x, y)).(color.Gray))
+				}
 			}
-		}
+		}, m)
 	case *image.RGBA64:
-		for y := b.Min.Y; y < b.Max.Y; y++ {
-			for x := b.Min.X; x < b.Max.X; x++ {
-				gray.SetGray(x, y, color.GrayModel.Convert(m.RGBA64At(x, y)).(color.Gray))
+		image_ext.ParallelRows(b, func(b image.Rectangle) {
+			for y := b.Min.Y; y < b.Max.Y; y++ {
+				for x := b.Min.X; x < b.Max.X; x++ {
+					gray.SetGray(x, y, color.GrayModel.Convert(m.RGBA64At(x, y)).(color.Gray))
+				}
 			}
-		}
+		}, m)
 	case *image.YCbCr:
-		for y := b.Min.Y; y < b.Max.Y; y++ {
-			copy(
-				gray.Pix[y*gray.Stride:][:gray.Stride],
-				m.Y[y*m.YStride:][:m.YStride],
-			)
-		}
+		image_ext.ParallelRows(b, func(b image.Rectangle) {
+			for y := b.Min.Y; y < b.Max.Y; y++ {
+				copy(
+					gray.Pix[gray.PixOffset(b.Min.X, y):][:b.Dx()],
+					m.Y[m.YOffset(b.Min.X, y):],
+				)
+			}
+		}, m)
 	default:
-		for y := b.Min.Y; y < b.Max.Y; y++ {
-			for x := b.Min.X; x < b.Max.X; x++ {
-				gray.Set(x, y, m.At(x, y))
+		image_ext.ParallelRows(b, func(b image.Rectangle) {
+			for y := b.Min.Y; y < b.Max.Y; y++ {
+				for x := b.Min.X; x < b.Max.X; x++ {
+					gray.Set(x, y, m.At(x, y))
+				}
 			}
-		}
+		}, m)
 	}
 	return gray
 }
@@ -100,41 +157,51 @@ func Gray16(m image.Image) *image.Gray16 {
 	gray16 := image.NewGray16(b)
 	switch m := m.(type) {
 	case *image.Gray:
-		for y := b.Min.Y; y < b.Max.Y; y++ {
-			for x := b.Min.X; x < b.Max.X; x++ {
-				v := m.GrayAt(x, y)
-				gray16.SetGray16(x, y, color.Gray16{uint16(v.Y) << 8})
+		image_ext.ParallelRows(b, func(b image.Rectangle) {
+			for y := b.Min.Y; y < b.Max.Y; y++ {
+				for x := b.Min.X; x < b.Max.X; x++ {
+					v := m.GrayAt(x, y)
+					gray16.SetGray16(x, y, color.Gray16{uint16(v.Y) * 0x101})
+				}
 			}
-		}
+		}, m)
 	case *image.RGBA:
-		for y := b.Min.Y; y < b.Max.Y; y++ {
-			for x := b.Min.X; x < b.Max.X; x++ {
-				gray16.SetGray16(x, y,
-					color.Gray16Model.Convert(m.RGBAAt(x, y)).(color.Gray16),
-				)
+		image_ext.ParallelRows(b, func(b image.Rectangle) {
+			for y := b.Min.Y; y < b.Max.Y; y++ {
+				for x := b.Min.X; x < b.Max.X; x++ {
+					gray16.SetGray16(x, y,
+						color.Gray16Model.Convert(m.RGBAAt(x, y)).(color.Gray16),
+					)
+				}
 			}
-		}
+		}, m)
 	case *image.RGBA64:
-		for y := b.Min.Y; y < b.Max.Y; y++ {
-			for x := b.Min.X; x < b.Max.X; x++ {
-				gray16.SetGray16(x, y,
-					color.Gray16Model.Convert(m.RGBA64At(x, y)).(color.Gray16),
-				)
+		image_ext.ParallelRows(b, func(b image.Rectangle) {
+			for y := b.Min.Y; y < b.Max.Y; y++ {
+				for x := b.Min.X; x < b.Max.X; x++ {
+					gray16.SetGray16(x, y,
+						color.Gray16Model.Convert(m.RGBA64At(x, y)).(color.Gray16),
+					)
+				}
 			}
-		}
+		}, m)
 	case *image.YCbCr:
-		for y := b.Min.Y; y < b.Max.Y; y++ {
-			for x := b.Min.X; x < b.Max.X; x++ {
-				v := m.Y[m.YOffset(x, y)]
-				gray16.SetGray16(x, y, color.Gray16{uint16(v) << 8})
+		image_ext.ParallelRows(b, func(b image.Rectangle) {
+			for y := b.Min.Y; y < b.Max.Y; y++ {
+				for x := b.Min.X; x < b.Max.X; x++ {
+					v := m.Y[m.YOffset(x, y)]
+					gray16.SetGray16(x, y, color.Gray16{uint16(v) * 0x101})
+				}
 			}
-		}
+		}, m)
 	default:
-		for y := b.Min.Y; y < b.Max.Y; y++ {
-			for x := b.Min.X; x < b.Max.X; x++ {
-				gray16.Set(x, y, m.At(x, y))
+		image_ext.ParallelRows(b, func(b image.Rectangle) {
+			for y := b.Min.Y; y < b.Max.Y; y++ {
+				for x := b.Min.X; x < b.Max.X; x++ {
+					gray16.Set(x, y, m.At(x, y))
+				}
 			}
-		}
+		}, m)
 	}
 	return gray16
 }
@@ -145,10 +212,85 @@ func Gray32f(m image.Image) *image_ext.Gray32f {
 	}
 	b := m.Bounds()
 	gray32f := image_ext.NewGray32f(b)
-	for y := b.Min.Y; y < b.Max.Y; y++ {
-		for x := b.Min.X; x < b.Max.X; x++ {
-			gray32f.Set(x, y, m.At(x, y))
-		}
+	switch m := m.(type) {
+	case *image.Gray:
+		image_ext.ParallelRows(b, func(b image.Rectangle) {
+			for y := b.Min.Y; y < b.Max.Y; y++ {
+				for x := b.Min.X; x < b.Max.X; x++ {
+					v := uint32(m.GrayAt(x, y).Y) * 0x101
+					gray32f.SetGray32f(x, y, color_ext.Gray32f{
+						Y: float32((299*v + 587*v + 114*v + 500) / 1000),
+					})
+				}
+			}
+		}, m)
+	case *image.RGBA:
+		image_ext.ParallelRows(b, func(b image.Rectangle) {
+			for y := b.Min.Y; y < b.Max.Y; y++ {
+				for x := b.Min.X; x < b.Max.X; x++ {
+					r, g, b, _ := m.RGBAAt(x, y).RGBA()
+					gray32f.SetGray32f(x, y, color_ext.Gray32f{
+						Y: float32((299*r + 587*g + 114*b + 500) / 1000),
+					})
+				}
+			}
+		}, m)
+	case *image.YCbCr:
+		image_ext.ParallelRows(b, func(b image.Rectangle) {
+			for y := b.Min.Y; y < b.Max.Y; y++ {
+				for x := b.Min.X; x < b.Max.X; x++ {
+					r, g, b, _ := m.YCbCrAt(x, y).RGBA()
+					gray32f.SetGray32f(x, y, color_ext.Gray32f{
+						Y: float32((299*r + 587*g + 114*b + 500) / 1000),
+					})
+				}
+			}
+		}, m)
+	case *image_ext.RGB:
+		image_ext.ParallelRows(b, func(b image.Rectangle) {
+			for y := b.Min.Y; y < b.Max.Y; y++ {
+				for x := b.Min.X; x < b.Max.X; x++ {
+					r, g, b, _ := m.RGBAt(x, y).RGBA()
+					gray32f.SetGray32f(x, y, color_ext.Gray32f{
+						Y: float32((299*r + 587*g + 114*b + 500) / 1000),
+					})
+				}
+			}
+		}, m)
+	case *image_ext.RGB96f:
+		image_ext.ParallelRows(b, func(b image.Rectangle) {
+			for y := b.Min.Y; y < b.Max.Y; y++ {
+				for x := b.Min.X; x < b.Max.X; x++ {
+					v := m.RGB96fAt(x, y)
+					gray32f.SetGray32f(x, y, color_ext.Gray32f{
+						Y: (299*v.R + 587*v.G + 114*v.B + 500) / 1000,
+					})
+				}
+			}
+		}, m)
+	case *image_ext.RGBA128f:
+		image_ext.ParallelRows(b, func(b image.Rectangle) {
+			for y := b.Min.Y; y < b.Max.Y; y++ {
+				for x := b.Min.X; x < b.Max.X; x++ {
+					v := m.RGBA128fAt(x, y)
+					gray32f.SetGray32f(x, y, color_ext.Gray32f{
+						Y: (299*v.R + 587*v.G + 114*v.B + 500) / 1000,
+					})
+				}
+			}
+		}, m)
+	default:
+		at := rgbaFunc(m)
+		image_ext.ParallelRows(b, func(b image.Rectangle) {
+			for y := b.Min.Y; y < b.Max.Y; y++ {
+				for x := b.Min.X; x < b.Max.X; x++ {
+					rv, gv, bv, _ := at(x, y)
+					gray32f.SetGray32f(x, y, color_ext.Gray32f{
+						Y: float32((299*rv + 587*gv + 114*bv + 500) / 1000),
+					})
+				}
+			}
+		}, m)
 	}
 	return gray32f
 }
@@ -161,33 +303,81 @@ func RGB(m image.Image) *image_ext.RGB {
 	rgb := image_ext.NewRGB(b)
 	switch m := m.(type) {
 	case *image.Gray:
-		for y := b.Min.Y; y < b.Max.Y; y++ {
-			for x := b.Min.X; x < b.Max.X; x++ {
-				v := m.GrayAt(x, y)
-				rgb.SetRGB(x, y, color_ext.RGB{
-					R: v.Y,
-					G: v.Y,
-					B: v.Y,
-				})
+		image_ext.ParallelRows(b, func(b image.Rectangle) {
+			for y := b.Min.Y; y < b.Max.Y; y++ {
+				for x := b.Min.X; x < b.Max.X; x++ {
+					v := m.GrayAt(x, y)
+					rgb.SetRGB(x, y, color_ext.RGB{
+						R: v.Y,
+						G: v.Y,
+						B: v.Y,
+					})
+				}
 			}
-		}
+		}, m)
 	case *image.Gray16:
-		for y := b.Min.Y; y < b.Max.Y; y++ {
-			for x := b.Min.X; x < b.Max.X; x++ {
-				v := m.Gray16At(x, y)
-				rgb.SetRGB(x, y, color_ext.RGB{
-					R: uint8(v.Y >> 8),
-					G: uint8(v.Y >> 8),
-					B: uint8(v.Y >> 8),
-				})
+		image_ext.ParallelRows(b, func(b image.Rectangle) {
+			for y := b.Min.Y; y < b.Max.Y; y++ {
+				for x := b.Min.X; x < b.Max.X; x++ {
+					v := m.Gray16At(x, y)
+					rgb.SetRGB(x, y, color_ext.RGB{
+						R: uint8(v.Y >> 8),
+						G: uint8(v.Y >> 8),
+						B: uint8(v.Y >> 8),
+					})
+				}
 			}
-		}
+		}, m)
+	case *image.RGBA:
+		image_ext.ParallelRows(b, func(b image.Rectangle) {
+			for y := b.Min.Y; y < b.Max.Y; y++ {
+				dst := rgb.Pix[rgb.PixOffset(b.Min.X, y):][:b.Dx()*3]
+				src := m.Pix[m.PixOffset(b.Min.X, y):][:b.Dx()*4]
+				for i, j := 0, 0; i < len(dst); i, j = i+3, j+4 {
+					dst[i+0] = src[j+0]
+					dst[i+1] = src[j+1]
+					dst[i+2] = src[j+2]
+				}
+			}
+		}, m)
+	case *image.RGBA64:
+		image_ext.ParallelRows(b, func(b image.Rectangle) {
+			for y := b.Min.Y; y < b.Max.Y; y++ {
+				dst := rgb.Pix[rgb.PixOffset(b.Min.X, y):][:b.Dx()*3]
+				src := m.Pix[m.PixOffset(b.Min.X, y):][:b.Dx()*8]
+				for i, j := 0, 0; i < len(dst); i, j = i+3, j+8 {
+					dst[i+0] = src[j+0]
+					dst[i+1] = src[j+2]
+					dst[i+2] = src[j+4]
+				}
+			}
+		}, m)
+	case *image.YCbCr:
+		image_ext.ParallelRows(b, func(b image.Rectangle) {
+			for y := b.Min.Y; y < b.Max.Y; y++ {
+				dst := rgb.Pix[rgb.PixOffset(b.Min.X, y):][:b.Dx()*3]
+				for i, x := 0, b.Min.X; x < b.Max.X; i, x = i+3, x+1 {
+					r, g, b, _ := m.YCbCrAt(x, y).RGBA()
+					dst[i+0] = uint8(r >> 8)
+					dst[i+1] = uint8(g >> 8)
+					dst[i+2] = uint8(b >> 8)
+				}
+			}
+		}, m)
 	default:
-		for y := b.Min.Y; y < b.Max.Y; y++ {
-			for x := b.Min.X; x < b.Max.X; x++ {
-				rgb.Set(x, y, m.At(x, y))
+		at := rgbaFunc(m)
+		image_ext.ParallelRows(b, func(b image.Rectangle) {
+			for y := b.Min.Y; y < b.Max.Y; y++ {
+				for x := b.Min.X; x < b.Max.X; x++ {
+					rv, gv, bv, _ := at(x, y)
+					rgb.SetRGB(x, y, color_ext.RGB{
+						R: uint8(rv >> 8),
+						G: uint8(gv >> 8),
+						B: uint8(bv >> 8),
+					})
+				}
 			}
-		}
+		}, m)
 	}
 	return rgb
 }
@@ -200,33 +390,45 @@ func RGB48(m image.Image) *image_ext.RGB48 {
 	rgb48 := image_ext.NewRGB48(b)
 	switch m := m.(type) {
 	case *image.Gray:
-		for y := b.Min.Y; y < b.Max.Y; y++ {
-			for x := b.Min.X; x < b.Max.X; x++ {
-				v := m.GrayAt(x, y)
-				rgb48.SetRGB48(x, y, color_ext.RGB48{
-					R: uint16(v.Y) >> 8,
-					G: uint16(v.Y) >> 8,
-					B: uint16(v.Y) >> 8,
-				})
+		image_ext.ParallelRows(b, func(b image.Rectangle) {
+			for y := b.Min.Y; y < b.Max.Y; y++ {
+				for x := b.Min.X; x < b.Max.X; x++ {
+					v := m.GrayAt(x, y)
+					rgb48.SetRGB48(x, y, color_ext.RGB48{
+						R: uint16(v.Y) * 0x101,
+						G: uint16(v.Y) * 0x101,
+						B: uint16(v.Y) * 0x101,
+					})
+				}
 			}
-		}
+		}, m)
 	case *image.Gray16:
-		for y := b.Min.Y; y < b.Max.Y; y++ {
-			for x := b.Min.X; x < b.Max.X; x++ {
-				v := m.Gray16At(x, y)
-				rgb48.SetRGB48(x, y, color_ext.RGB48{
-					R: v.Y,
-					G: v.Y,
-					B: v.Y,
-				})
+		image_ext.ParallelRows(b, func(b image.Rectangle) {
+			for y := b.Min.Y; y < b.Max.Y; y++ {
+				for x := b.Min.X; x < b.Max.X; x++ {
+					v := m.Gray16At(x, y)
+					rgb48.SetRGB48(x, y, color_ext.RGB48{
+						R: v.Y,
+						G: v.Y,
+						B: v.Y,
+					})
+				}
 			}
-		}
+		}, m)
 	default:
-		for y := b.Min.Y; y < b.Max.Y; y++ {
-			for x := b.Min.X; x < b.Max.X; x++ {
-				rgb48.Set(x, y, m.At(x, y))
+		at := rgbaFunc(m)
+		image_ext.ParallelRows(b, func(b image.Rectangle) {
+			for y := b.Min.Y; y < b.Max.Y; y++ {
+				for x := b.Min.X; x < b.Max.X; x++ {
+					rv, gv, bv, _ := at(x, y)
+					rgb48.SetRGB48(x, y, color_ext.RGB48{
+						R: uint16(rv),
+						G: uint16(gv),
+						B: uint16(bv),
+					})
+				}
 			}
-		}
+		}, m)
 	}
 	return rgb48
 }
@@ -239,33 +441,97 @@ func RGB96f(m image.Image) *image_ext.RGB96f {
 	rgb96f := image_ext.NewRGB96f(b)
 	switch m := m.(type) {
 	case *image.Gray:
-		for y := b.Min.Y; y < b.Max.Y; y++ {
-			for x := b.Min.X; x < b.Max.X; x++ {
-				v := m.GrayAt(x, y)
-				rgb96f.SetRGB96f(x, y, color_ext.RGB96f{
-					R: float32(uint16(v.Y) >> 8),
-					G: float32(uint16(v.Y) >> 8),
-					B: float32(uint16(v.Y) >> 8),
-				})
+		image_ext.ParallelRows(b, func(b image.Rectangle) {
+			for y := b.Min.Y; y < b.Max.Y; y++ {
+				for x := b.Min.X; x < b.Max.X; x++ {
+					v := m.GrayAt(x, y)
+					rgb96f.SetRGB96f(x, y, color_ext.RGB96f{
+						R: float32(uint16(v.Y) * 0x101),
+						G: float32(uint16(v.Y) * 0x101),
+						B: float32(uint16(v.Y) * 0x101),
+					})
+				}
 			}
-		}
+		}, m)
 	case *image.Gray16:
-		for y := b.Min.Y; y < b.Max.Y; y++ {
-			for x := b.Min.X; x < b.Max.X; x++ {
-				v := m.Gray16At(x, y)
-				rgb96f.SetRGB96f(x, y, color_ext.RGB96f{
-					R: float32(v.Y),
-					G: float32(v.Y),
-					B: float32(v.Y),
-				})
+		image_ext.ParallelRows(b, func(b image.Rectangle) {
+			for y := b.Min.Y; y < b.Max.Y; y++ {
+				for x := b.Min.X; x < b.Max.X; x++ {
+					v := m.Gray16At(x, y)
+					rgb96f.SetRGB96f(x, y, color_ext.RGB96f{
+						R: float32(v.Y),
+						G: float32(v.Y),
+						B: float32(v.Y),
+					})
+				}
 			}
-		}
+		}, m)
+	case *image.RGBA:
+		image_ext.ParallelRows(b, func(b image.Rectangle) {
+			for y := b.Min.Y; y < b.Max.Y; y++ {
+				for x := b.Min.X; x < b.Max.X; x++ {
+					v := m.RGBAAt(x, y)
+					rgb96f.SetRGB96f(x, y, color_ext.RGB96f{
+						R: float32(uint16(v.R) * 0x101),
+						G: float32(uint16(v.G) * 0x101),
+						B: float32(uint16(v.B) * 0x101),
+					})
+				}
+			}
+		}, m)
+	case *image_ext.RGB:
+		image_ext.ParallelRows(b, func(b image.Rectangle) {
+			for y := b.Min.Y; y < b.Max.Y; y++ {
+				for x := b.Min.X; x < b.Max.X; x++ {
+					v := m.RGBAt(x, y)
+					rgb96f.SetRGB96f(x, y, color_ext.RGB96f{
+						R: float32(uint16(v.R) * 0x101),
+						G: float32(uint16(v.G) * 0x101),
+						B: float32(uint16(v.B) * 0x101),
+					})
+				}
+			}
+		}, m)
+	case *image_ext.Gray32f:
+		image_ext.ParallelRows(b, func(b image.Rectangle) {
+			for y := b.Min.Y; y < b.Max.Y; y++ {
+				for x := b.Min.X; x < b.Max.X; x++ {
+					v := m.Gray32fAt(x, y)
+					rgb96f.SetRGB96f(x, y, color_ext.RGB96f{
+						R: v.Y,
+						G: v.Y,
+						B: v.Y,
+					})
+				}
+			}
+		}, m)
+	case *image_ext.RGBA128f:
+		image_ext.ParallelRows(b, func(b image.Rectangle) {
+			for y := b.Min.Y; y < b.Max.Y; y++ {
+				for x := b.Min.X; x < b.Max.X; x++ {
+					v := m.RGBA128fAt(x, y)
+					rgb96f.SetRGB96f(x, y, color_ext.RGB96f{
+						R: v.R,
+						G: v.G,
+						B: v.B,
+					})
+				}
+			}
+		}, m)
 	default:
-		for y := b.Min.Y; y < b.Max.Y; y++ {
-			for x := b.Min.X; x < b.Max.X; x++ {
-				rgb96f.Set(x, y, m.At(x, y))
+		at := rgbaFunc(m)
+		image_ext.ParallelRows(b, func(b image.Rectangle) {
+			for y := b.Min.Y; y < b.Max.Y; y++ {
+				for x := b.Min.X; x < b.Max.X; x++ {
+					rv, gv, bv, _ := at(x, y)
+					rgb96f.SetRGB96f(x, y, color_ext.RGB96f{
+						R: float32(rv),
+						G: float32(gv),
+						B: float32(bv),
+					})
+				}
 			}
-		}
+		}, m)
 	}
 	return rgb96f
 }
@@ -278,143 +544,359 @@ func RGBA(m image.Image) *image.RGBA {
 	rgba := image.NewRGBA(b)
 	switch m := m.(type) {
 	case *image.Gray:
-		for y := b.Min.Y; y < b.Max.Y; y++ {
-			for x := b.Min.X; x < b.Max.X; x++ {
-				v := m.GrayAt(x, y)
-				rgba.SetRGBA(x, y, color.RGBA{
-					R: v.Y,
-					G: v.Y,
-					B: v.Y,
-					A: 0xFF,
-				})
+		image_ext.ParallelRows(b, func(b image.Rectangle) {
+			for y := b.Min.Y; y < b.Max.Y; y++ {
+				for x := b.Min.X; x < b.Max.X; x++ {
+					v := m.GrayAt(x, y)
+					rgba.SetRGBA(x, y, color.RGBA{
+						R: v.Y,
+						G: v.Y,
+						B: v.Y,
+						A: 0xFF,
+					})
+				}
 			}
-		}
+		}, m)
 	case *image.Gray16:
-		for y := b.Min.Y; y < b.Max.Y; y++ {
-			for x := b.Min.X; x < b.Max.X; x++ {
-				v := m.Gray16At(x, y)
-				rgba.SetRGBA(x, y, color.RGBA{
-					R: uint8(v.Y >> 8),
-					G: uint8(v.Y >> 8),
-					B: uint8(v.Y >> 8),
-					A: 0xFF,
-				})
+		image_ext.ParallelRows(b, func(b image.Rectangle) {
+			for y := b.Min.Y; y < b.Max.Y; y++ {
+				for x := b.Min.X; x < b.Max.X; x++ {
+					v := m.Gray16At(x, y)
+					rgba.SetRGBA(x, y, color.RGBA{
+						R: uint8(v.Y >> 8),
+						G: uint8(v.Y >> 8),
+						B: uint8(v.Y >> 8),
+						A: 0xFF,
+					})
+				}
+			}
+		}, m)
+	case *image_ext.RGB:
+		image_ext.ParallelRows(b, func(b image.Rectangle) {
+			for y := b.Min.Y; y < b.Max.Y; y++ {
+				dst := rgba.Pix[rgba.PixOffset(b.Min.X, y):][:b.Dx()*4]
+				src := m.Pix[m.PixOffset(b.Min.X, y):][:b.Dx()*3]
+				for i, j := 0, 0; i < len(dst); i, j = i+4, j+3 {
+					dst[i+0] = src[j+0]
+					dst[i+1] = src[j+1]
+					dst[i+2] = src[j+2]
+					dst[i+3] = 0xff
+				}
+			}
+		}, m)
+	case *image.YCbCr:
+		image_ext.ParallelRows(b, func(b image.Rectangle) {
+			for y := b.Min.Y; y < b.Max.Y; y++ {
+				dst := rgba.Pix[rgba.PixOffset(b.Min.X, y):][:b.Dx()*4]
+				for i, x := 0, b.Min.X; x < b.Max.X; i, x = i+4, x+1 {
+					r, g, b, _ := m.YCbCrAt(x, y).RGBA()
+					dst[i+0] = uint8(r >> 8)
+					dst[i+1] = uint8(g >> 8)
+					dst[i+2] = uint8(b >> 8)
+					dst[i+3] = 0xff
+				}
+			}
+		}, m)
+	default:
+		at := rgbaFunc(m)
+		image_ext.ParallelRows(b, func(b image.Rectangle) {
+			for y := b.Min.Y; y < b.Max.Y; y++ {
+				for x := b.Min.X; x < b.Max.X; x++ {
+					rv, gv, bv, av := at(x, y)
+					rgba.SetRGBA(x, y, color.RGBA{
+						R: uint8(rv >> 8),
+						G: uint8(gv >> 8),
+						B: uint8(bv >> 8),
+						A: uint8(av >> 8),
+					})
+				}
+			}
+		}, m)
+	}
+	return rgba
+}
+
+func RGBA64(m image.Image) *image.RGBA64 {
+	if rgba64, ok := m.(*image.RGBA64); ok {
+		return rgba64
+	}
+	b := m.Bounds()
+	rgba64 := image.NewRGBA64(b)
+	switch m := m.(type) {
+	case *image.Gray:
+		image_ext.ParallelRows(b, func(b image.Rectangle) {
+			for y := b.Min.Y; y < b.Max.Y; y++ {
+				for x := b.Min.X; x < b.Max.X; x++ {
+					v := m.GrayAt(x, y)
+					rgba64.SetRGBA64(x, y, color.RGBA64{
+						R: uint16(v.Y) * 0x101,
+						G: uint16(v.Y) * 0x101,
+						B: uint16(v.Y) * 0x101,
+						A: 0xFFFF,
+					})
+				}
+			}
+		}, m)
+	case *image.Gray16:
+		image_ext.ParallelRows(b, func(b image.Rectangle) {
+			for y := b.Min.Y; y < b.Max.Y; y++ {
+				for x := b.Min.X; x < b.Max.X; x++ {
+					v := m.Gray16At(x, y)
+					rgba64.SetRGBA64(x, y, color.RGBA64{
+						R: v.Y,
+						G: v.Y,
+						B: v.Y,
+						A: 0xFFFF,
+					})
+				}
+			}
+		}, m)
+	case *image.RGBA:
+		image_ext.ParallelRows(b, func(b image.Rectangle) {
+			for y := b.Min.Y; y < b.Max.Y; y++ {
+				for x := b.Min.X; x < b.Max.X; x++ {
+					v := m.RGBAAt(x, y)
+					rgba64.SetRGBA64(x, y, color.RGBA64{
+						R: uint16(v.R) * 0x101,
+						G: uint16(v.G) * 0x101,
+						B: uint16(v.B) * 0x101,
+						A: uint16(v.A) * 0x101,
+					})
+				}
+			}
+		}, m)
+	default:
+		at := rgbaFunc(m)
+		image_ext.ParallelRows(b, func(b image.Rectangle) {
+			for y := b.Min.Y; y < b.Max.Y; y++ {
+				for x := b.Min.X; x < b.Max.X; x++ {
+					rv, gv, bv, av := at(x, y)
+					rgba64.SetRGBA64(x, y, color.RGBA64{
+						R: uint16(rv),
+						G: uint16(gv),
+						B: uint16(bv),
+						A: uint16(av),
+					})
+				}
+			}
+		}, m)
+	}
+	return rgba64
+}
+
+func RGBA128f(m image.Image) *image_ext.RGBA128f {
+	if rgba128f, ok := m.(*image_ext.RGBA128f); ok {
+		return rgba128f
+	}
+	b := m.Bounds()
+	rgba128f := image_ext.NewRGBA128f(b)
+	switch m := m.(type) {
+	case *image.Gray:
+		image_ext.ParallelRows(b, func(b image.Rectangle) {
+			for y := b.Min.Y; y < b.Max.Y; y++ {
+				for x := b.Min.X; x < b.Max.X; x++ {
+					v := m.GrayAt(x, y)
+					rgba128f.SetRGBA128f(x, y, color_ext.RGBA128f{
+						R: float32(uint16(v.Y) * 0x101),
+						G: float32(uint16(v.Y) * 0x101),
+						B: float32(uint16(v.Y) * 0x101),
+						A: 0xFFFF,
+					})
+				}
+			}
+		}, m)
+	case *image.Gray16:
+		image_ext.ParallelRows(b, func(b image.Rectangle) {
+			for y := b.Min.Y; y < b.Max.Y; y++ {
+				for x := b.Min.X; x < b.Max.X; x++ {
+					v := m.Gray16At(x, y)
+					rgba128f.SetRGBA128f(x, y, color_ext.RGBA128f{
+						R: float32(v.Y),
+						G: float32(v.Y),
+						B: float32(v.Y),
+						A: 0xFFFF,
+					})
+				}
+			}
+		}, m)
+	case *image.RGBA:
+		image_ext.ParallelRows(b, func(b image.Rectangle) {
+			for y := b.Min.Y; y < b.Max.Y; y++ {
+				for x := b.Min.X; x < b.Max.X; x++ {
+					v := m.RGBAAt(x, y)
+					rgba128f.SetRGBA128f(x, y, color_ext.RGBA128f{
+						R: float32(uint16(v.R) * 0x101),
+						G: float32(uint16(v.G) * 0x101),
+						B: float32(uint16(v.B) * 0x101),
+						A: float32(uint16(v.A) * 0x101),
+					})
+				}
+			}
+		}, m)
+	case *image_ext.Gray32f:
+		image_ext.ParallelRows(b, func(b image.Rectangle) {
+			for y := b.Min.Y; y < b.Max.Y; y++ {
+				for x := b.Min.X; x < b.Max.X; x++ {
+					v := m.Gray32fAt(x, y)
+					rgba128f.SetRGBA128f(x, y, color_ext.RGBA128f{
+						R: v.Y,
+						G: v.Y,
+						B: v.Y,
+						A: 0xFFFF,
+					})
+				}
 			}
-		}
+		}, m)
+	case *image_ext.RGB96f:
+		image_ext.ParallelRows(b, func(b image.Rectangle) {
+			for y := b.Min.Y; y < b.Max.Y; y++ {
+				for x := b.Min.X; x < b.Max.X; x++ {
+					v := m.RGB96fAt(x, y)
+					rgba128f.SetRGBA128f(x, y, color_ext.RGBA128f{
+						R: v.R,
+						G: v.G,
+						B: v.B,
+						A: 0xFFFF,
+					})
+				}
+			}
+		}, m)
 	default:
-		for y := b.Min.Y; y < b.Max.Y; y++ {
-			for x := b.Min.X; x < b.Max.X; x++ {
-				rgba.Set(x, y, m.At(x, y))
+		at := rgbaFunc(m)
+		image_ext.ParallelRows(b, func(b image.Rectangle) {
+			for y := b.Min.Y; y < b.Max.Y; y++ {
+				for x := b.Min.X; x < b.Max.X; x++ {
+					rv, gv, bv, av := at(x, y)
+					rgba128f.SetRGBA128f(x, y, color_ext.RGBA128f{
+						R: float32(rv),
+						G: float32(gv),
+						B: float32(bv),
+						A: float32(av),
+					})
+				}
 			}
-		}
+		}, m)
 	}
-	return rgba
+	return rgba128f
 }
 
-func RGBA64(m image.Image) *image.RGBA64 {
-	if rgba64, ok := m.(*image.RGBA64); ok {
-		return rgba64
+func Gray16s(m image.Image) *image_ext.Gray16s {
+	if gray16s, ok := m.(*image_ext.Gray16s); ok {
+		return gray16s
 	}
 	b := m.Bounds()
-	rgba64 := image.NewRGBA64(b)
-	switch m := m.(type) {
-	case *image.Gray:
-		for y := b.Min.Y; y < b.Max.Y; y++ {
-			for x := b.Min.X; x < b.Max.X; x++ {
-				v := m.GrayAt(x, y)
-				rgba64.SetRGBA64(x, y, color.RGBA64{
-					R: uint16(v.Y) >> 8,
-					G: uint16(v.Y) >> 8,
-					B: uint16(v.Y) >> 8,
-					A: 0xFFFF,
-				})
-			}
-		}
-	case *image.Gray16:
+	gray16s := image_ext.NewGray16s(b)
+	gray := grayValueFunc(m)
+	image_ext.ParallelRows(b, func(b image.Rectangle) {
 		for y := b.Min.Y; y < b.Max.Y; y++ {
 			for x := b.Min.X; x < b.Max.X; x++ {
-				v := m.Gray16At(x, y)
-				rgba64.SetRGBA64(x, y, color.RGBA64{
-					R: v.Y,
-					G: v.Y,
-					B: v.Y,
-					A: 0xFFFF,
-				})
+				v := clampFloat64(gray(x, y), math.MinInt16, math.MaxInt16)
+				gray16s.SetGray16s(x, y, color_ext.Gray16s{Y: int16(v)})
 			}
 		}
-	case *image.RGBA:
+	}, m)
+	return gray16s
+}
+
+func Gray32i(m image.Image) *image_ext.Gray32i {
+	if gray32i, ok := m.(*image_ext.Gray32i); ok {
+		return gray32i
+	}
+	b := m.Bounds()
+	gray32i := image_ext.NewGray32i(b)
+	gray := grayValueFunc(m)
+	image_ext.ParallelRows(b, func(b image.Rectangle) {
 		for y := b.Min.Y; y < b.Max.Y; y++ {
 			for x := b.Min.X; x < b.Max.X; x++ {
-				v := m.RGBAAt(x, y)
-				rgba64.SetRGBA64(x, y, color.RGBA64{
-					R: uint16(v.R) >> 8,
-					G: uint16(v.G) >> 8,
-					B: uint16(v.B) >> 8,
-					A: uint16(v.A) >> 8,
-				})
+				v := clampFloat64(gray(x, y), math.MinInt32, math.MaxInt32)
+				gray32i.SetGray32i(x, y, color_ext.Gray32i{Y: int32(v)})
 			}
 		}
-	default:
+	}, m)
+	return gray32i
+}
+
+func Gray64f(m image.Image) *image_ext.Gray64f {
+	if gray64f, ok := m.(*image_ext.Gray64f); ok {
+		return gray64f
+	}
+	b := m.Bounds()
+	gray64f := image_ext.NewGray64f(b)
+	gray := grayValueFunc(m)
+	image_ext.ParallelRows(b, func(b image.Rectangle) {
 		for y := b.Min.Y; y < b.Max.Y; y++ {
 			for x := b.Min.X; x < b.Max.X; x++ {
-				rgba64.Set(x, y, m.At(x, y))
+				gray64f.SetGray64f(x, y, color_ext.Gray64f{Y: gray(x, y)})
 			}
 		}
-	}
-	return rgba64
+	}, m)
+	return gray64f
 }
 
-func RGBA128f(m image.Image) *image_ext.RGBA128f {
-	if rgba128f, ok := m.(*image_ext.RGBA128f); ok {
-		return rgba128f
+func RGB48s(m image.Image) *image_ext.RGB48s {
+	if rgb48s, ok := m.(*image_ext.RGB48s); ok {
+		return rgb48s
 	}
 	b := m.Bounds()
-	rgba128f := image_ext.NewRGBA128f(b)
-	switch m := m.(type) {
-	case *image.Gray:
+	rgb48s := image_ext.NewRGB48s(b)
+	rgb := rgbValueFunc(m)
+	image_ext.ParallelRows(b, func(b image.Rectangle) {
 		for y := b.Min.Y; y < b.Max.Y; y++ {
 			for x := b.Min.X; x < b.Max.X; x++ {
-				v := m.GrayAt(x, y)
-				rgba128f.SetRGBA128f(x, y, color_ext.RGBA128f{
-					R: float32(uint16(v.Y) >> 8),
-					G: float32(uint16(v.Y) >> 8),
-					B: float32(uint16(v.Y) >> 8),
-					A: 0xFFFF,
+				rv, gv, bv := rgb(x, y)
+				rgb48s.SetRGB48s(x, y, color_ext.RGB48s{
+					R: int16(clampFloat64(rv, math.MinInt16, math.MaxInt16)),
+					G: int16(clampFloat64(gv, math.MinInt16, math.MaxInt16)),
+					B: int16(clampFloat64(bv, math.MinInt16, math.MaxInt16)),
 				})
 			}
 		}
-	case *image.Gray16:
+	}, m)
+	return rgb48s
+}
+
+func RGB96i(m image.Image) *image_ext.RGB96i {
+	if rgb96i, ok := m.(*image_ext.RGB96i); ok {
+		return rgb96i
+	}
+	b := m.Bounds()
+	rgb96i := image_ext.NewRGB96i(b)
+	rgb := rgbValueFunc(m)
+	image_ext.ParallelRows(b, func(b image.Rectangle) {
 		for y := b.Min.Y; y < b.Max.Y; y++ {
 			for x := b.Min.X; x < b.Max.X; x++ {
-				v := m.Gray16At(x, y)
-				rgba128f.SetRGBA128f(x, y, color_ext.RGBA128f{
-					R: float32(v.Y),
-					G: float32(v.Y),
-					B: float32(v.Y),
-					A: 0xFFFF,
+				rv, gv, bv := rgb(x, y)
+				rgb96i.SetRGB96i(x, y, color_ext.RGB96i{
+					R: int32(clampFloat64(rv, math.MinInt32, math.MaxInt32)),
+					G: int32(clampFloat64(gv, math.MinInt32, math.MaxInt32)),
+					B: int32(clampFloat64(bv, math.MinInt32, math.MaxInt32)),
 				})
 			}
 		}
-	case *image.RGBA:
+	}, m)
+	return rgb96i
+}
+
+func RGB192f(m image.Image) *image_ext.RGB192f {
+	if rgb192f, ok := m.(*image_ext.RGB192f); ok {
+		return rgb192f
+	}
+	b := m.Bounds()
+	rgb192f := image_ext.NewRGB192f(b)
+	rgb := rgbValueFunc(m)
+	image_ext.ParallelRows(b, func(b image.Rectangle) {
 		for y := b.Min.Y; y < b.Max.Y; y++ {
 			for x := b.Min.X; x < b.Max.X; x++ {
-				v := m.RGBAAt(x, y)
-				rgba128f.SetRGBA128f(x, y, color_ext.RGBA128f{
-					R: float32(uint16(v.R) >> 8),
-					G: float32(uint16(v.G) >> 8),
-					B: float32(uint16(v.B) >> 8),
-					A: float32(uint16(v.A) >> 8),
+				rv, gv, bv := rgb(x, y)
+				rgb192f.SetRGB192f(x, y, color_ext.RGB192f{
+					R: rv,
+					G: gv,
+					B: bv,
 				})
 			}
 		}
-	default:
-		for y := b.Min.Y; y < b.Max.Y; y++ {
-			for x := b.Min.X; x < b.Max.X; x++ {
-				rgba128f.Set(x, y, m.At(x, y))
-			}
-		}
-	}
-	return rgba128f
+	}, m)
+	return rgb192f
 }
 
 func Paletted(m image.Image, p color.Palette) *image.Paletted {
@@ -439,11 +921,13 @@ func Paletted(m image.Image, p color.Palette) *image.Paletted {
 	}
 	b := m.Bounds()
 	paletted := image.NewPaletted(b, p)
-	for y := b.Min.Y; y < b.Max.Y; y++ {
-		for x := b.Min.X; x < b.Max.X; x++ {
-			paletted.Set(x, y, m.At(x, y))
+	image_ext.ParallelRows(b, func(b image.Rectangle) {
+		for y := b.Min.Y; y < b.Max.Y; y++ {
+			for x := b.Min.X; x < b.Max.X; x++ {
+				paletted.Set(x, y, m.At(x, y))
+			}
 		}
-	}
+	}, m)
 	return paletted
 }
 
@@ -455,11 +939,13 @@ func YCbCr(m image.Image, subsampleRatio image.YCbCrSubsampleRatio) *image.YCbCr
 	}
 	b := m.Bounds()
 	yCbCr := image_ext.NewYCbCr(b, subsampleRatio)
-	for y := b.Min.Y; y < b.Max.Y; y++ {
-		for x := b.Min.X; x < b.Max.X; x++ {
-			yCbCr.Set(x, y, m.At(x, y))
+	image_ext.ParallelRows(b, func(b image.Rectangle) {
+		for y := b.Min.Y; y < b.Max.Y; y++ {
+			for x := b.Min.X; x < b.Max.X; x++ {
+				yCbCr.Set(x, y, m.At(x, y))
+			}
 		}
-	}
+	}, m)
 	return (*image.YCbCr)(yCbCr)
 }
 
@@ -468,110 +954,106 @@ func convertToColor(m image.Image) image.Image {
 	case *image.Gray:
 		b := m.Bounds()
 		rgb := image_ext.NewRGB(b)
-		for y := b.Min.Y; y < b.Max.Y; y++ {
-			for x := b.Min.X; x < b.Max.X; x++ {
-				v := m.GrayAt(x, y)
-				rgb.SetRGB(x, y, color_ext.RGB{
-					R: v.Y,
-					G: v.Y,
-					B: v.Y,
-				})
+		image_ext.ParallelRows(b, func(b image.Rectangle) {
+			for y := b.Min.Y; y < b.Max.Y; y++ {
+				for x := b.Min.X; x < b.Max.X; x++ {
+					v := m.GrayAt(x, y)
+					rgb.SetRGB(x, y, color_ext.RGB{
+						R: v.Y,
+						G: v.Y,
+						B: v.Y,
+					})
+				}
 			}
-		}
+		}, m)
 		return rgb
 	case *image.Gray16:
 		b := m.Bounds()
 		rgb48 := image_ext.NewRGB48(b)
-		for y := b.Min.Y; y < b.Max.Y; y++ {
-			for x := b.Min.X; x < b.Max.X; x++ {
-				v := m.Gray16At(x, y)
-				rgb48.SetRGB48(x, y, color_ext.RGB48{
-					R: v.Y,
-					G: v.Y,
-					B: v.Y,
-				})
+		image_ext.ParallelRows(b, func(b image.Rectangle) {
+			for y := b.Min.Y; y < b.Max.Y; y++ {
+				for x := b.Min.X; x < b.Max.X; x++ {
+					v := m.Gray16At(x, y)
+					rgb48.SetRGB48(x, y, color_ext.RGB48{
+						R: v.Y,
+						G: v.Y,
+						B: v.Y,
+					})
+				}
 			}
-		}
+		}, m)
 		return rgb48
 	case *image_ext.Gray32f:
 		b := m.Bounds()
 		rgb96f := image_ext.NewRGB96f(b)
-		for y := b.Min.Y; y < b.Max.Y; y++ {
-			for x := b.Min.X; x < b.Max.X; x++ {
-				v := m.Gray32fAt(x, y)
-				rgb96f.SetRGB96f(x, y, color_ext.RGB96f{
-					R: v.Y,
-					G: v.Y,
-					B: v.Y,
-				})
+		image_ext.ParallelRows(b, func(b image.Rectangle) {
+			for y := b.Min.Y; y < b.Max.Y; y++ {
+				for x := b.Min.X; x < b.Max.X; x++ {
+					v := m.Gray32fAt(x, y)
+					rgb96f.SetRGB96f(x, y, color_ext.RGB96f{
+						R: v.Y,
+						G: v.Y,
+						B: v.Y,
+					})
+				}
 			}
-		}
+		}, m)
 		return rgb96f
-	case *image.YCbCr:
+	case *image_ext.Gray16s:
 		b := m.Bounds()
-		rgb := image_ext.NewRGB(b)
-		for y := b.Min.Y; y < b.Max.Y; y++ {
-			for x := b.Min.X; x < b.Max.X; x++ {
-				v := m.YCbCrAt(x, y)
-				rr, gg, bb := color.YCbCrToRGB(v.Y, v.Cb, v.Cr)
-				rgb.SetRGB(x, y, color_ext.RGB{
-					R: rr,
-					G: gg,
-					B: bb,
-				})
-			}
-		}
-		return rgb
-	case *image.Paletted:
-		switch m.Palette[0].(type) {
-		case color.Gray:
-			b := m.Bounds()
-			rgb := image_ext.NewRGB(b)
+		rGB48s := image_ext.NewRGB48s(b)
+		image_ext.ParallelRows(b, func(b image.Rectangle) {
 			for y := b.Min.Y; y < b.Max.Y; y++ {
 				for x := b.Min.X; x < b.Max.X; x++ {
-					v := m.At(x, y).(color.Gray)
-					rgb.SetRGB(x, y, color_ext.RGB{
+					v := m.Gray16sAt(x, y)
+					rGB48s.SetRGB48s(x, y, color_ext.RGB48s{
 						R: v.Y,
 						G: v.Y,
 						B: v.Y,
 					})
 				}
 			}
-			return rgb
-		case color.Gray16:
-			b := m.Bounds()
-			rgb48 := image_ext.NewRGB48(b)
+		}, m)
+		return rGB48s
+	case *image_ext.Gray32i:
+		b := m.Bounds()
+		rGB96i := image_ext.NewRGB96i(b)
+		image_ext.ParallelRows(b, func(b image.Rectangle) {
 			for y := b.Min.Y; y < b.Max.Y; y++ {
 				for x := b.Min.X; x < b.Max.X; x++ {
-					v := m.At(x, y).(color.Gray16)
-					rgb48.SetRGB48(x, y, color_ext.RGB48{
+					v := m.Gray32iAt(x, y)
+					rGB96i.SetRGB96i(x, y, color_ext.RGB96i{
 						R: v.Y,
 						G: v.Y,
 						B: v.Y,
 					})
 				}
 			}
-			return rgb48
-		case color_ext.Gray32f:
-			b := m.Bounds()
-			rgb96f := image_ext.NewRGB96f(b)
+		}, m)
+		return rGB96i
+	case *image_ext.Gray64f:
+		b := m.Bounds()
+		rGB192f := image_ext.NewRGB192f(b)
+		image_ext.ParallelRows(b, func(b image.Rectangle) {
 			for y := b.Min.Y; y < b.Max.Y; y++ {
 				for x := b.Min.X; x < b.Max.X; x++ {
-					v := m.At(x, y).(color_ext.Gray32f)
-					rgb96f.SetRGB96f(x, y, color_ext.RGB96f{
+					v := m.Gray64fAt(x, y)
+					rGB192f.SetRGB192f(x, y, color_ext.RGB192f{
 						R: v.Y,
 						G: v.Y,
 						B: v.Y,
 					})
 				}
 			}
-			return rgb96f
-		case color.YCbCr:
-			b := m.Bounds()
-			rgb := image_ext.NewRGB(b)
+		}, m)
+		return rGB192f
+	case *image.YCbCr:
+		b := m.Bounds()
+		rgb := image_ext.NewRGB(b)
+		image_ext.ParallelRows(b, func(b image.Rectangle) {
 			for y := b.Min.Y; y < b.Max.Y; y++ {
 				for x := b.Min.X; x < b.Max.X; x++ {
-					v := m.At(x, y).(color.YCbCr)
+					v := m.YCbCrAt(x, y)
 					rr, gg, bb := color.YCbCrToRGB(v.Y, v.Cb, v.Cr)
 					rgb.SetRGB(x, y, color_ext.RGB{
 						R: rr,
@@ -580,6 +1062,74 @@ func convertToColor(m image.Image) image.Image {
 					})
 				}
 			}
+		}, m)
+		return rgb
+	case *image.Paletted:
+		switch m.Palette[0].(type) {
+		case color.Gray:
+			b := m.Bounds()
+			rgb := image_ext.NewRGB(b)
+			image_ext.ParallelRows(b, func(b image.Rectangle) {
+				for y := b.Min.Y; y < b.Max.Y; y++ {
+					for x := b.Min.X; x < b.Max.X; x++ {
+						v := m.At(x, y).(color.Gray)
+						rgb.SetRGB(x, y, color_ext.RGB{
+							R: v.Y,
+							G: v.Y,
+							B: v.Y,
+						})
+					}
+				}
+			}, m)
+			return rgb
+		case color.Gray16:
+			b := m.Bounds()
+			rgb48 := image_ext.NewRGB48(b)
+			image_ext.ParallelRows(b, func(b image.Rectangle) {
+				for y := b.Min.Y; y < b.Max.Y; y++ {
+					for x := b.Min.X; x < b.Max.X; x++ {
+						v := m.At(x, y).(color.Gray16)
+						rgb48.SetRGB48(x, y, color_ext.RGB48{
+							R: v.Y,
+							G: v.Y,
+							B: v.Y,
+						})
+					}
+				}
+			}, m)
+			return rgb48
+		case color_ext.Gray32f:
+			b := m.Bounds()
+			rgb96f := image_ext.NewRGB96f(b)
+			image_ext.ParallelRows(b, func(b image.Rectangle) {
+				for y := b.Min.Y; y < b.Max.Y; y++ {
+					for x := b.Min.X; x < b.Max.X; x++ {
+						v := m.At(x, y).(color_ext.Gray32f)
+						rgb96f.SetRGB96f(x, y, color_ext.RGB96f{
+							R: v.Y,
+							G: v.Y,
+							B: v.Y,
+						})
+					}
+				}
+			}, m)
+			return rgb96f
+		case color.YCbCr:
+			b := m.Bounds()
+			rgb := image_ext.NewRGB(b)
+			image_ext.ParallelRows(b, func(b image.Rectangle) {
+				for y := b.Min.Y; y < b.Max.Y; y++ {
+					for x := b.Min.X; x < b.Max.X; x++ {
+						v := m.At(x, y).(color.YCbCr)
+						rr, gg, bb := color.YCbCrToRGB(v.Y, v.Cb, v.Cr)
+						rgb.SetRGB(x, y, color_ext.RGB{
+							R: rr,
+							G: gg,
+							B: bb,
+						})
+					}
+				}
+			}, m)
 			return rgb
 		}
 	}
@@ -591,110 +1141,169 @@ func convertToGray(m image.Image) image.Image {
 	case *image_ext.RGB:
 		b := m.Bounds()
 		gray := image.NewGray(b)
-		for y := b.Min.Y; y < b.Max.Y; y++ {
-			for x := b.Min.X; x < b.Max.X; x++ {
-				gray.SetGray(x, y,
-					color.GrayModel.Convert(m.RGBAt(x, y)).(color.Gray),
-				)
+		image_ext.ParallelRows(b, func(b image.Rectangle) {
+			for y := b.Min.Y; y < b.Max.Y; y++ {
+				for x := b.Min.X; x < b.Max.X; x++ {
+					gray.SetGray(x, y,
+						color.GrayModel.Convert(m.RGBAt(x, y)).(color.Gray),
+					)
+				}
 			}
-		}
+		}, m)
 		return gray
 	case *image_ext.RGB48:
 		b := m.Bounds()
 		gray16 := image.NewGray16(b)
-		for y := b.Min.Y; y < b.Max.Y; y++ {
-			for x := b.Min.X; x < b.Max.X; x++ {
-				gray16.SetGray16(x, y,
-					color.Gray16Model.Convert(m.RGB48At(x, y)).(color.Gray16),
-				)
+		image_ext.ParallelRows(b, func(b image.Rectangle) {
+			for y := b.Min.Y; y < b.Max.Y; y++ {
+				for x := b.Min.X; x < b.Max.X; x++ {
+					gray16.SetGray16(x, y,
+						color.Gray16Model.Convert(m.RGB48At(x, y)).(color.Gray16),
+					)
+				}
 			}
-		}
+		}, m)
 		return gray16
 	case *image_ext.RGB96f:
 		b := m.Bounds()
 		gray32f := image_ext.NewGray32f(b)
-		for y := b.Min.Y; y < b.Max.Y; y++ {
-			for x := b.Min.X; x < b.Max.X; x++ {
-				gray32f.SetGray32f(x, y,
-					color_ext.Gray32fModel.Convert(m.RGB96fAt(x, y)).(color_ext.Gray32f),
-				)
+		image_ext.ParallelRows(b, func(b image.Rectangle) {
+			for y := b.Min.Y; y < b.Max.Y; y++ {
+				for x := b.Min.X; x < b.Max.X; x++ {
+					gray32f.SetGray32f(x, y,
+						color_ext.Gray32fModel.Convert(m.RGB96fAt(x, y)).(color_ext.Gray32f),
+					)
+				}
 			}
-		}
+		}, m)
 		return gray32f
+	case *image_ext.RGB48s:
+		b := m.Bounds()
+		gray16s := image_ext.NewGray16s(b)
+		image_ext.ParallelRows(b, func(b image.Rectangle) {
+			for y := b.Min.Y; y < b.Max.Y; y++ {
+				for x := b.Min.X; x < b.Max.X; x++ {
+					gray16s.SetGray16s(x, y,
+						color_ext.Gray16sModel.Convert(m.RGB48sAt(x, y)).(color_ext.Gray16s),
+					)
+				}
+			}
+		}, m)
+		return gray16s
+	case *image_ext.RGB96i:
+		b := m.Bounds()
+		gray32i := image_ext.NewGray32i(b)
+		image_ext.ParallelRows(b, func(b image.Rectangle) {
+			for y := b.Min.Y; y < b.Max.Y; y++ {
+				for x := b.Min.X; x < b.Max.X; x++ {
+					gray32i.SetGray32i(x, y,
+						color_ext.Gray32iModel.Convert(m.RGB96iAt(x, y)).(color_ext.Gray32i),
+					)
+				}
+			}
+		}, m)
+		return gray32i
+	case *image_ext.RGB192f:
+		b := m.Bounds()
+		gray64f := image_ext.NewGray64f(b)
+		image_ext.ParallelRows(b, func(b image.Rectangle) {
+			for y := b.Min.Y; y < b.Max.Y; y++ {
+				for x := b.Min.X; x < b.Max.X; x++ {
+					gray64f.SetGray64f(x, y,
+						color_ext.Gray64fModel.Convert(m.RGB192fAt(x, y)).(color_ext.Gray64f),
+					)
+				}
+			}
+		}, m)
+		return gray64f
 	case *image.RGBA:
 		b := m.Bounds()
 		gray := image.NewGray(b)
-		for y := b.Min.Y; y < b.Max.Y; y++ {
-			for x := b.Min.X; x < b.Max.X; x++ {
-				gray.SetGray(x, y,
-					color.RGBAModel.Convert(m.RGBAAt(x, y)).(color.Gray),
-				)
+		image_ext.ParallelRows(b, func(b image.Rectangle) {
+			for y := b.Min.Y; y < b.Max.Y; y++ {
+				for x := b.Min.X; x < b.Max.X; x++ {
+					gray.SetGray(x, y,
+						color.RGBAModel.Convert(m.RGBAAt(x, y)).(color.Gray),
+					)
+				}
 			}
-		}
+		}, m)
 		return gray
 	case *image.RGBA64:
 		b := m.Bounds()
 		gray16 := image.NewGray16(b)
-		for y := b.Min.Y; y < b.Max.Y; y++ {
-			for x := b.Min.X; x < b.Max.X; x++ {
-				gray16.SetGray16(x, y,
-					color.Gray16Model.Convert(m.RGBA64At(x, y)).(color.Gray16),
-				)
+		image_ext.ParallelRows(b, func(b image.Rectangle) {
+			for y := b.Min.Y; y < b.Max.Y; y++ {
+				for x := b.Min.X; x < b.Max.X; x++ {
+					gray16.SetGray16(x, y,
+						color.Gray16Model.Convert(m.RGBA64At(x, y)).(color.Gray16),
+					)
+				}
 			}
-		}
+		}, m)
 		return gray16
 	case *image_ext.RGBA128f:
 		b := m.Bounds()
 		gray32f := image_ext.NewGray32f(b)
-		for y := b.Min.Y; y < b.Max.Y; y++ {
-			for x := b.Min.X; x < b.Max.X; x++ {
-				gray32f.SetGray32f(x, y,
-					color_ext.Gray32fModel.Convert(m.RGBA128fAt(x, y)).(color_ext.Gray32f),
-				)
+		image_ext.ParallelRows(b, func(b image.Rectangle) {
+			for y := b.Min.Y; y < b.Max.Y; y++ {
+				for x := b.Min.X; x < b.Max.X; x++ {
+					gray32f.SetGray32f(x, y,
+						color_ext.Gray32fModel.Convert(m.RGBA128fAt(x, y)).(color_ext.Gray32f),
+					)
+				}
 			}
-		}
+		}, m)
 		return gray32f
 	case *image.YCbCr:
 		b := m.Bounds()
 		gray := image.NewGray(b)
-		for y := b.Min.Y; y < b.Max.Y; y++ {
-			copy(gray.Pix[y*gray.Stride:][:b.Dx()], m.Y[y*m.YStride:])
-		}
+		image_ext.ParallelRows(b, func(b image.Rectangle) {
+			for y := b.Min.Y; y < b.Max.Y; y++ {
+				copy(gray.Pix[gray.PixOffset(b.Min.X, y):][:b.Dx()], m.Y[m.YOffset(b.Min.X, y):])
+			}
+		}, m)
 		return gray
 	case *image.Paletted:
 		switch m.Palette[0].(type) {
 		case color_ext.RGB, color.RGBA, color.YCbCr:
 			b := m.Bounds()
 			gray := image.NewGray(b)
-			for y := b.Min.Y; y < b.Max.Y; y++ {
-				for x := b.Min.X; x < b.Max.X; x++ {
-					gray.SetGray(x, y,
-						color.GrayModel.Convert(m.At(x, y)).(color.Gray),
-					)
+			image_ext.ParallelRows(b, func(b image.Rectangle) {
+				for y := b.Min.Y; y < b.Max.Y; y++ {
+					for x := b.Min.X; x < b.Max.X; x++ {
+						gray.SetGray(x, y,
+							color.GrayModel.Convert(m.At(x, y)).(color.Gray),
+						)
+					}
 				}
-			}
+			}, m)
 			return gray
 		case color_ext.RGB48, color.RGBA64:
 			b := m.Bounds()
 			gray16 := image.NewGray16(b)
-			for y := b.Min.Y; y < b.Max.Y; y++ {
-				for x := b.Min.X; x < b.Max.X; x++ {
-					gray16.SetGray16(x, y,
-						color.Gray16Model.Convert(m.At(x, y)).(color.Gray16),
-					)
+			image_ext.ParallelRows(b, func(b image.Rectangle) {
+				for y := b.Min.Y; y < b.Max.Y; y++ {
+					for x := b.Min.X; x < b.Max.X; x++ {
+						gray16.SetGray16(x, y,
+							color.Gray16Model.Convert(m.At(x, y)).(color.Gray16),
+						)
+					}
 				}
-			}
+			}, m)
 			return gray16
 		case color_ext.RGB96f, color_ext.RGBA128f:
 			b := m.Bounds()
 			gray32f := image_ext.NewGray32f(b)
-			for y := b.Min.Y; y < b.Max.Y; y++ {
-				for x := b.Min.X; x < b.Max.X; x++ {
-					gray32f.SetGray32f(x, y,
-						color_ext.Gray32fModel.Convert(m.At(x, y)).(color_ext.Gray32f),
-					)
+			image_ext.ParallelRows(b, func(b image.Rectangle) {
+				for y := b.Min.Y; y < b.Max.Y; y++ {
+					for x := b.Min.X; x < b.Max.X; x++ {
+						gray32f.SetGray32f(x, y,
+							color_ext.Gray32fModel.Convert(m.At(x, y)).(color_ext.Gray32f),
+						)
+					}
 				}
-			}
+			}, m)
 			return gray32f
 		}
 	}
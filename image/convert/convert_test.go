@@ -0,0 +1,146 @@
+// Copyright 2014 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package convert
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"testing"
+
+	image_ext "github.com/chai2010/gopkg/image"
+	color_ext "github.com/chai2010/gopkg/image/color"
+)
+
+// tNewTestImages returns the images with the same random-like pixels.
+func tNewTestImages(r image.Rectangle) []image.Image {
+	rgba := image.NewRGBA(r)
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			rgba.SetRGBA(x, y, color.RGBA{
+				R: uint8(x*7 + y*3),
+				G: uint8(x*5 + y*11),
+				B: uint8(x*13 + y),
+				A: 0xff,
+			})
+		}
+	}
+	ycbcr := image.NewYCbCr(r, image.YCbCrSubsampleRatio420)
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			ycbcr.Y[ycbcr.YOffset(x, y)] = uint8(x*3 + y*7)
+			ycbcr.Cb[ycbcr.COffset(x, y)] = uint8(x + y*5)
+			ycbcr.Cr[ycbcr.COffset(x, y)] = uint8(x*9 + y)
+		}
+	}
+	rgb64 := image.NewRGBA64(r)
+	gray := image.NewGray(r)
+	rgb := image_ext.NewRGB(r)
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			rgb64.Set(x, y, rgba.At(x, y))
+			gray.Set(x, y, rgba.At(x, y))
+			rgb.Set(x, y, rgba.At(x, y))
+		}
+	}
+	images := []image.Image{gray, rgba, rgb64, ycbcr, rgb}
+
+	// the other source types take the pixels of rgba
+	for _, m := range []draw.Image{
+		image.NewGray16(r),
+		image.NewNRGBA(r),
+		image_ext.NewGray32f(r),
+		image_ext.NewRGB48(r),
+		image_ext.NewRGB96f(r),
+		image_ext.NewRGBA128f(r),
+	} {
+		for y := r.Min.Y; y < r.Max.Y; y++ {
+			for x := r.Min.X; x < r.Max.X; x++ {
+				m.Set(x, y, rgba.At(x, y))
+			}
+		}
+		images = append(images, m)
+	}
+
+	// the signed integer and float values are out of the 16-bit range
+	gray16s := image_ext.NewGray16s(r)
+	gray32i := image_ext.NewGray32i(r)
+	gray64f := image_ext.NewGray64f(r)
+	rgb48s := image_ext.NewRGB48s(r)
+	rgb96i := image_ext.NewRGB96i(r)
+	rgb192f := image_ext.NewRGB192f(r)
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			v := (x-150)*y*997 + x
+			gray16s.SetGray16s(x, y, color_ext.Gray16s{Y: int16(v)})
+			gray32i.SetGray32i(x, y, color_ext.Gray32i{Y: int32(v)})
+			gray64f.SetGray64f(x, y, color_ext.Gray64f{Y: float64(v) * 1e3})
+			rgb48s.SetRGB48s(x, y, color_ext.RGB48s{R: int16(v), G: int16(v * 3), B: int16(-v)})
+			rgb96i.SetRGB96i(x, y, color_ext.RGB96i{R: int32(v), G: int32(v * 3), B: int32(-v)})
+			rgb192f.SetRGB192f(x, y, color_ext.RGB192f{R: float64(v) * 1e3, G: float64(v) / 3, B: float64(-v)})
+		}
+	}
+	return append(images, gray16s, gray32i, gray64f, rgb48s, rgb96i, rgb192f)
+}
+
+func TestConvert_fastPaths(t *testing.T) {
+	defer func(n int) { image_ext.Workers = n }(image_ext.Workers)
+	image_ext.Workers = 4
+
+	r := image.Rect(1, 3, 301, 203)
+	for i, v := range []struct {
+		Name    string
+		Convert func(m image.Image) image.Image
+	}{
+		{"Gray", func(m image.Image) image.Image { return Gray(m) }},
+		{"Gray16", func(m image.Image) image.Image { return Gray16(m) }},
+		{"Gray32f", func(m image.Image) image.Image { return Gray32f(m) }},
+		{"RGB", func(m image.Image) image.Image { return RGB(m) }},
+		{"RGB48", func(m image.Image) image.Image { return RGB48(m) }},
+		{"RGB96f", func(m image.Image) image.Image { return RGB96f(m) }},
+		{"RGBA", func(m image.Image) image.Image { return RGBA(m) }},
+		{"RGBA64", func(m image.Image) image.Image { return RGBA64(m) }},
+		{"RGBA128f", func(m image.Image) image.Image { return RGBA128f(m) }},
+		{"Gray16s", func(m image.Image) image.Image { return Gray16s(m) }},
+		{"Gray32i", func(m image.Image) image.Image { return Gray32i(m) }},
+		{"Gray64f", func(m image.Image) image.Image { return Gray64f(m) }},
+		{"RGB48s", func(m image.Image) image.Image { return RGB48s(m) }},
+		{"RGB96i", func(m image.Image) image.Image { return RGB96i(m) }},
+		{"RGB192f", func(m image.Image) image.Image { return RGB192f(m) }},
+	} {
+		for _, src := range tNewTestImages(r) {
+			dst := v.Convert(src)
+			if got := dst.Bounds(); got != r {
+				t.Fatalf("%d: %s(%T): bad bounds; got %v, want %v", i, v.Name, src, got, r)
+			}
+			if x, y, got, want := tFirstDiff(dst, src); got != nil {
+				t.Fatalf("%d: %s(%T): bad color at (%d, %d); got %v, want %v",
+					i, v.Name, src, x, y, got, want,
+				)
+			}
+		}
+	}
+}
+
+// tFirstDiff returns the first pixel of dst which is not converted from src
+// by the color model of dst. The gray images take the Y of the YCbCr images.
+func tFirstDiff(dst, src image.Image) (x, y int, got, want color.Color) {
+	b, model := dst.Bounds(), dst.ColorModel()
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			got, want = dst.At(x, y), model.Convert(src.At(x, y))
+			if m, ok := src.(*image.YCbCr); ok {
+				switch dst.(type) {
+				case *image.Gray, *image.Gray16:
+					want = model.Convert(color.Gray{Y: m.Y[m.YOffset(x, y)]})
+				}
+			}
+			if got != want {
+				return x, y, got, want
+			}
+		}
+	}
+	return 0, 0, nil, nil
+}
@@ -0,0 +1,155 @@
+// Copyright 2014 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package convert
+
+import (
+	"image"
+
+	image_ext "github.com/chai2010/gopkg/image"
+	color_ext "github.com/chai2010/gopkg/image/color"
+)
+
+// The pixel functions read the pixels of the known image types without
+// boxing the colors, they return the same values as the color models of
+// the color package read from the colors returned by At.
+
+// rgbaFunc returns a function which returns the RGBA of the pixel (x, y).
+func rgbaFunc(m image.Image) func(x, y int) (r, g, b, a uint32) {
+	switch m := m.(type) {
+	case *image.Gray:
+		return func(x, y int) (r, g, b, a uint32) { return m.GrayAt(x, y).RGBA() }
+	case *image.Gray16:
+		return func(x, y int) (r, g, b, a uint32) { return m.Gray16At(x, y).RGBA() }
+	case *image.RGBA:
+		return func(x, y int) (r, g, b, a uint32) { return m.RGBAAt(x, y).RGBA() }
+	case *image.RGBA64:
+		return func(x, y int) (r, g, b, a uint32) { return m.RGBA64At(x, y).RGBA() }
+	case *image.NRGBA:
+		return func(x, y int) (r, g, b, a uint32) { return m.NRGBAAt(x, y).RGBA() }
+	case *image.NRGBA64:
+		return func(x, y int) (r, g, b, a uint32) { return m.NRGBA64At(x, y).RGBA() }
+	case *image.YCbCr:
+		return func(x, y int) (r, g, b, a uint32) { return m.YCbCrAt(x, y).RGBA() }
+	case *image_ext.YCbCr:
+		return func(x, y int) (r, g, b, a uint32) { return m.YCbCrAt(x, y).RGBA() }
+	case *image_ext.Gray32f:
+		return func(x, y int) (r, g, b, a uint32) { return m.Gray32fAt(x, y).RGBA() }
+	case *image_ext.Gray16s:
+		return func(x, y int) (r, g, b, a uint32) { return m.Gray16sAt(x, y).RGBA() }
+	case *image_ext.Gray32i:
+		return func(x, y int) (r, g, b, a uint32) { return m.Gray32iAt(x, y).RGBA() }
+	case *image_ext.Gray64f:
+		return func(x, y int) (r, g, b, a uint32) { return m.Gray64fAt(x, y).RGBA() }
+	case *image_ext.RGB:
+		return func(x, y int) (r, g, b, a uint32) { return m.RGBAt(x, y).RGBA() }
+	case *image_ext.RGB48:
+		return func(x, y int) (r, g, b, a uint32) { return m.RGB48At(x, y).RGBA() }
+	case *image_ext.RGB96f:
+		return func(x, y int) (r, g, b, a uint32) { return m.RGB96fAt(x, y).RGBA() }
+	case *image_ext.RGB48s:
+		return func(x, y int) (r, g, b, a uint32) { return m.RGB48sAt(x, y).RGBA() }
+	case *image_ext.RGB96i:
+		return func(x, y int) (r, g, b, a uint32) { return m.RGB96iAt(x, y).RGBA() }
+	case *image_ext.RGB192f:
+		return func(x, y int) (r, g, b, a uint32) { return m.RGB192fAt(x, y).RGBA() }
+	case *image_ext.RGBA128f:
+		return func(x, y int) (r, g, b, a uint32) { return m.RGBA128fAt(x, y).RGBA() }
+	}
+	return func(x, y int) (r, g, b, a uint32) { return m.At(x, y).RGBA() }
+}
+
+// grayValueFunc returns a function which returns the gray value of the
+// pixel (x, y), see Gray64fModel. The values of the signed integer and
+// float images are not clamped.
+func grayValueFunc(m image.Image) func(x, y int) float64 {
+	switch m := m.(type) {
+	case *image_ext.Gray16s:
+		return func(x, y int) float64 { return float64(m.Gray16sAt(x, y).Y) }
+	case *image_ext.Gray32i:
+		return func(x, y int) float64 { return float64(m.Gray32iAt(x, y).Y) }
+	case *image_ext.Gray32f:
+		return func(x, y int) float64 { return float64(m.Gray32fAt(x, y).Y) }
+	case *image_ext.Gray64f:
+		return func(x, y int) float64 { return m.Gray64fAt(x, y).Y }
+	case *image_ext.RGB48s, *image_ext.RGB96i, *image_ext.RGB96f, *image_ext.RGB192f, *image_ext.RGBA128f:
+		rgb := rgbValueFunc(m)
+		return func(x, y int) float64 {
+			r, g, b := rgb(x, y)
+			return (299*r + 587*g + 114*b) / 1000
+		}
+	case *image.Gray, *image.Gray16, *image.RGBA, *image.RGBA64, *image.NRGBA, *image.NRGBA64,
+		*image.YCbCr, *image_ext.YCbCr, *image_ext.RGB, *image_ext.RGB48:
+		rgba := rgbaFunc(m)
+		return func(x, y int) float64 {
+			r, g, b, _ := rgba(x, y)
+			return float64((299*r + 587*g + 114*b + 500) / 1000)
+		}
+	}
+	return func(x, y int) float64 {
+		return color_ext.Gray64fModel.Convert(m.At(x, y)).(color_ext.Gray64f).Y
+	}
+}
+
+// rgbValueFunc returns a function which returns the red, green and blue
+// values of the pixel (x, y), see RGB192fModel. The values of the signed
+// integer and float images are not clamped.
+func rgbValueFunc(m image.Image) func(x, y int) (r, g, b float64) {
+	switch m := m.(type) {
+	case *image_ext.Gray16s, *image_ext.Gray32i, *image_ext.Gray32f, *image_ext.Gray64f:
+		gray := grayValueFunc(m)
+		return func(x, y int) (r, g, b float64) {
+			v := gray(x, y)
+			return v, v, v
+		}
+	case *image_ext.RGB48s:
+		return func(x, y int) (r, g, b float64) {
+			v := m.RGB48sAt(x, y)
+			return float64(v.R), float64(v.G), float64(v.B)
+		}
+	case *image_ext.RGB96i:
+		return func(x, y int) (r, g, b float64) {
+			v := m.RGB96iAt(x, y)
+			return float64(v.R), float64(v.G), float64(v.B)
+		}
+	case *image_ext.RGB96f:
+		return func(x, y int) (r, g, b float64) {
+			v := m.RGB96fAt(x, y)
+			return float64(v.R), float64(v.G), float64(v.B)
+		}
+	case *image_ext.RGB192f:
+		return func(x, y int) (r, g, b float64) {
+			v := m.RGB192fAt(x, y)
+			return v.R, v.G, v.B
+		}
+	case *image_ext.RGBA128f:
+		return func(x, y int) (r, g, b float64) {
+			v := m.RGBA128fAt(x, y)
+			return float64(v.R), float64(v.G), float64(v.B)
+		}
+	case *image.Gray, *image.Gray16, *image.RGBA, *image.RGBA64, *image.NRGBA, *image.NRGBA64,
+		*image.YCbCr, *image_ext.YCbCr, *image_ext.RGB, *image_ext.RGB48:
+		rgba := rgbaFunc(m)
+		return func(x, y int) (r, g, b float64) {
+			r32, g32, b32, _ := rgba(x, y)
+			return float64(r32), float64(g32), float64(b32)
+		}
+	}
+	return func(x, y int) (r, g, b float64) {
+		v := color_ext.RGB192fModel.Convert(m.At(x, y)).(color_ext.RGB192f)
+		return v.R, v.G, v.B
+	}
+}
+
+// clampFloat64 returns v clamped to [min, max].
+func clampFloat64(v, min, max float64) float64 {
+	switch {
+	case v < min:
+		return min
+	case v > max:
+		return max
+	default:
+		return v
+	}
+}
@@ -0,0 +1,199 @@
+// Copyright 2014 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package arcinfogrid implements the ASCII ArcInfo Grid DEM decoder and
+// encoder.
+//
+// The grid has a header of "key value" lines, ncols, nrows, xllcorner or
+// xllcenter, yllcorner or yllcenter, cellsize (or dx and dy) and the
+// optional NODATA_value, followed by the cell values from the top row.
+package arcinfogrid
+
+import (
+	"bufio"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+	"math"
+	"strconv"
+
+	image_ext "github.com/chai2010/gopkg/image"
+	color_ext "github.com/chai2010/gopkg/image/color"
+	"github.com/chai2010/gopkg/image/convert"
+)
+
+// Options are the encoding and decoding parameters.
+type Options struct {
+	ColorModel color.Model // convert the decoded image to ColorModel
+	Header     *Header     // the georeferencing and nodata of Encode, may be nil
+
+	// Progress reports the progress of Encode by rows, may be nil. The
+	// encoding is canceled with image_ext.ErrCanceled if it returns false.
+	Progress image_ext.ProgressFunc
+}
+
+// DecodeConfig returns the color model and dimensions of a grid without
+// decoding the entire image.
+func DecodeConfig(r io.Reader) (config image.Config, err error) {
+	hdr, err := newWordScanner(r).readHeader()
+	if err != nil {
+		return
+	}
+	config = image.Config{
+		ColorModel: color_ext.Gray32fModel,
+		Width:      hdr.Cols,
+		Height:     hdr.Rows,
+	}
+	return
+}
+
+// Decode reads a grid from r and returns it as a *image.Gray32f, the nodata
+// cells keep the NODATA_value of the file.
+func Decode(r io.Reader, opt *Options) (m image.Image, err error) {
+	if m, _, err = DecodeWithHeader(r); err != nil {
+		return
+	}
+	if opt != nil && opt.ColorModel != nil {
+		m = convert.ColorModel(m, opt.ColorModel)
+	}
+	return
+}
+
+// DecodeWithHeader reads a grid and its header from r.
+func DecodeWithHeader(r io.Reader) (m *image_ext.Gray32f, hdr *Header, err error) {
+	s := newWordScanner(r)
+	if hdr, err = s.readHeader(); err != nil {
+		return
+	}
+	m = image_ext.NewGray32f(image.Rect(0, 0, hdr.Cols, hdr.Rows))
+	for y := 0; y < hdr.Rows; y++ {
+		for x := 0; x < hdr.Cols; x++ {
+			word, err := s.next()
+			if err != nil {
+				return nil, nil, fmt.Errorf("image/dem/ArcInfoGrid: Decode, %v", err)
+			}
+			v, err := strconv.ParseFloat(word, 32)
+			if err != nil {
+				return nil, nil, fmt.Errorf("image/dem/ArcInfoGrid: Decode, bad value at (%d, %d): %q", x, y, word)
+			}
+			m.SetGray32f(x, y, color_ext.Gray32f{Y: float32(v)})
+		}
+	}
+	return
+}
+
+// Encode writes the image m to w as a grid. The georeferencing and nodata
+// are taken from opt.Header, and the size is taken from m. The NaN cells
+// are written as the nodata value, which is DefaultNoData if the Header
+// has no nodata value.
+func Encode(w io.Writer, m image.Image, opt *Options) (err error) {
+	gray32f := convert.Gray32f(m)
+	b := gray32f.Bounds()
+
+	var hdr Header
+	if opt != nil && opt.Header != nil {
+		hdr = *opt.Header
+	}
+	hdr.Cols, hdr.Rows = b.Dx(), b.Dy()
+	if hdr.DX <= 0 || hdr.DY <= 0 {
+		hdr.DX, hdr.DY = 1, 1
+	}
+	if !hdr.HasNoData && hasNaN(gray32f) {
+		hdr.HasNoData, hdr.NoData = true, DefaultNoData
+	}
+
+	bw := bufio.NewWriter(w)
+	if err = writeHeader(bw, &hdr); err != nil {
+		return
+	}
+	var progress *image_ext.Progress
+	if opt != nil {
+		progress = image_ext.NewProgress(opt.Progress, b.Dy())
+	}
+	var buf []byte
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		buf = buf[:0]
+		for x := b.Min.X; x < b.Max.X; x++ {
+			if x > b.Min.X {
+				buf = append(buf, ' ')
+			}
+			v := gray32f.Gray32fAt(x, y).Y
+			if v != v {
+				buf = strconv.AppendFloat(buf, hdr.NoData, 'g', -1, 64)
+			} else {
+				buf = strconv.AppendFloat(buf, float64(v), 'g', -1, 32)
+			}
+		}
+		buf = append(buf, '\n')
+		if _, err = bw.Write(buf); err != nil {
+			return
+		}
+		if !progress.Step(1) {
+			return image_ext.ErrCanceled
+		}
+	}
+	return bw.Flush()
+}
+
+func hasNaN(m *image_ext.Gray32f) bool {
+	b := m.Bounds()
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			if math.IsNaN(float64(m.Gray32fAt(x, y).Y)) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// newOptions converts the common options to the grid options.
+func newOptions(opt *image_ext.Options) (*Options, error) {
+	var p Options
+	if ok, err := image_ext.ConvertOptions("ArcInfoGrid", opt, &p); !ok {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// newEncodeOptions converts the common options to the grid options, the
+// grids are always lossless and uncompressed.
+func newEncodeOptions(opt *image_ext.Options) (*Options, error) {
+	var p Options
+	ok, err := image_ext.ConvertEncodeOptions("ArcInfoGrid", opt, &p, image_ext.EncodeSupport{
+		Compression: []image_ext.Compression{image_ext.CompressionNone},
+	})
+	if !ok {
+		return nil, err
+	}
+	return &p, nil
+}
+
+func imageExtDecode(r io.Reader, opt *image_ext.Options) (image.Image, error) {
+	p, err := newOptions(opt)
+	if err != nil {
+		return nil, err
+	}
+	return Decode(r, p)
+}
+
+func imageExtEncode(w io.Writer, m image.Image, opt *image_ext.Options) error {
+	p, err := newEncodeOptions(opt)
+	if err != nil {
+		return err
+	}
+	return Encode(w, m, p)
+}
+
+func init() {
+	image_ext.RegisterFormat(image_ext.Format{
+		Name:         "ArcInfoGrid",
+		Extensions:   []string{".asc"},
+		Magics:       []string{"ncols", "NCOLS", "Ncols"},
+		DecodeConfig: DecodeConfig,
+		Decode:       imageExtDecode,
+		Encode:       imageExtEncode,
+	})
+}
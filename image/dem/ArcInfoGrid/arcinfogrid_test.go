@@ -0,0 +1,106 @@
+// Copyright 2014 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package arcinfogrid
+
+import (
+	"bytes"
+	"image"
+	"math"
+	"strings"
+	"testing"
+
+	image_ext "github.com/chai2010/gopkg/image"
+	color_ext "github.com/chai2010/gopkg/image/color"
+)
+
+const tGrid = `NCOLS 4
+NROWS 3
+XLLCENTER 1000.5
+YLLCENTER 2000.5
+CELLSIZE 1
+NODATA_value -9999
+1 2 3 4
+5 6.5 -9999 8
+9 10 11
+12
+`
+
+func TestDecode(t *testing.T) {
+	m, hdr, err := DecodeWithHeader(strings.NewReader(tGrid))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Header{Cols: 4, Rows: 3, XLLCorner: 1000, YLLCorner: 2000, DX: 1, DY: 1, HasNoData: true, NoData: -9999}
+	if *hdr != want {
+		t.Fatalf("bad header: %+v", *hdr)
+	}
+	if gt := hdr.GeoTransform(); gt != image_ext.NewGeoTransform(1000, 2003, 1, 1) {
+		t.Fatalf("bad GeoTransform: %v", gt)
+	}
+	if m.Bounds() != image.Rect(0, 0, 4, 3) {
+		t.Fatalf("bad bounds: %v", m.Bounds())
+	}
+	for i, v := range []float32{1, 2, 3, 4, 5, 6.5, -9999, 8, 9, 10, 11, 12} {
+		if got := m.Gray32fAt(i%4, i/4).Y; got != v {
+			t.Fatalf("%d: bad value: got %v, want %v", i, got, v)
+		}
+	}
+
+	if _, format, err := image_ext.Decode(strings.NewReader(tGrid), nil); err != nil || format != "ArcInfoGrid" {
+		t.Fatalf("bad format: %q, %v", format, err)
+	}
+	if c, err := DecodeConfig(strings.NewReader(tGrid)); err != nil || c.Width != 4 || c.Height != 3 {
+		t.Fatalf("bad config: %v, %v", c, err)
+	}
+	for i, s := range []string{
+		"ncols 4\nnrows 3\n1 2 3",
+		"ncols 2\nnrows 1\ncellsize 1\n1",
+		"ncols 2\nnrows 1\ncellsize 1\n1 x",
+	} {
+		if _, err := Decode(strings.NewReader(s), nil); err == nil {
+			t.Fatalf("%d: expect error", i)
+		}
+	}
+}
+
+func TestEncode(t *testing.T) {
+	m := image_ext.NewGray32f(image.Rect(0, 0, 5, 4))
+	for y := 0; y < 4; y++ {
+		for x := 0; x < 5; x++ {
+			m.SetGray32f(x, y, color_ext.Gray32f{Y: float32(x*10+y) + 0.25})
+		}
+	}
+	m.SetGray32f(2, 2, color_ext.Gray32f{Y: float32(math.NaN())})
+
+	hdr := &Header{Rows: 4, DX: 30, DY: 30}
+	if err := hdr.SetGeoTransform(image_ext.NewGeoTransform(500000, 4200000, 30, 30)); err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := Encode(&buf, m, &Options{Header: hdr}); err != nil {
+		t.Fatal(err)
+	}
+	got, gotHdr, err := DecodeWithHeader(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if gotHdr.GeoTransform() != image_ext.NewGeoTransform(500000, 4200000, 30, 30) {
+		t.Fatalf("bad GeoTransform: %v", gotHdr.GeoTransform())
+	}
+	if !gotHdr.HasNoData || gotHdr.NoData != DefaultNoData {
+		t.Fatalf("bad nodata: %+v", gotHdr)
+	}
+	for y := 0; y < 4; y++ {
+		for x := 0; x < 5; x++ {
+			want := m.Gray32fAt(x, y).Y
+			if x == 2 && y == 2 {
+				want = DefaultNoData
+			}
+			if v := got.Gray32fAt(x, y).Y; v != want {
+				t.Fatalf("bad value at (%d, %d): got %v, want %v", x, y, v, want)
+			}
+		}
+	}
+}
@@ -0,0 +1,161 @@
+// Copyright 2014 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package arcinfogrid
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	image_ext "github.com/chai2010/gopkg/image"
+)
+
+// DefaultNoData is the nodata value written for the NaN cells if the
+// Header has no nodata value.
+const DefaultNoData = -9999
+
+// Header is the header of an ASCII ArcInfo Grid.
+type Header struct {
+	Cols, Rows int
+	XLLCorner  float64 // the x of the lower-left corner of the grid
+	YLLCorner  float64 // the y of the lower-left corner of the grid
+	DX, DY     float64 // the cell size
+	HasNoData  bool
+	NoData     float64
+}
+
+// GeoTransform returns the GeoTransform of the grid.
+func (p *Header) GeoTransform() image_ext.GeoTransform {
+	return image_ext.NewGeoTransform(p.XLLCorner, p.YLLCorner+float64(p.Rows)*p.DY, p.DX, p.DY)
+}
+
+// SetGeoTransform sets the corner and the cell size by gt, the Rows should
+// be set before. The rotated gt is not supported.
+func (p *Header) SetGeoTransform(gt image_ext.GeoTransform) error {
+	if gt[2] != 0 || gt[4] != 0 || gt[1] <= 0 || gt[5] >= 0 {
+		return fmt.Errorf("image/dem/ArcInfoGrid: Header.SetGeoTransform, unsupported transform: %v", gt)
+	}
+	p.DX, p.DY = gt[1], -gt[5]
+	p.XLLCorner, p.YLLCorner = gt[0], gt[3]-float64(p.Rows)*p.DY
+	return nil
+}
+
+// wordScanner reads the words separated by the white spaces.
+type wordScanner struct {
+	*bufio.Scanner
+	unread string
+}
+
+func newWordScanner(r io.Reader) *wordScanner {
+	s := bufio.NewScanner(r)
+	s.Split(bufio.ScanWords)
+	return &wordScanner{Scanner: s}
+}
+
+func (p *wordScanner) next() (word string, err error) {
+	if p.unread != "" {
+		word, p.unread = p.unread, ""
+		return
+	}
+	if !p.Scan() {
+		if err = p.Err(); err == nil {
+			err = io.ErrUnexpectedEOF
+		}
+		return
+	}
+	return p.Text(), nil
+}
+
+// readHeader reads the "key value" pairs until the first cell value.
+func (p *wordScanner) readHeader() (hdr *Header, err error) {
+	hdr = new(Header)
+	keys := make(map[string]bool)
+	for {
+		key, err := p.next()
+		if err != nil {
+			return nil, err
+		}
+		name := strings.ToLower(key)
+		switch name {
+		case "ncols", "nrows", "xllcorner", "yllcorner", "xllcenter", "yllcenter",
+			"cellsize", "dx", "dy", "nodata_value":
+		default:
+			p.unread = key
+			return hdr, hdr.check(keys)
+		}
+		value, err := p.next()
+		if err != nil {
+			return nil, err
+		}
+		v, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return nil, fmt.Errorf("image/dem/ArcInfoGrid: bad %s: %q", key, value)
+		}
+		keys[name] = true
+		switch name {
+		case "ncols":
+			hdr.Cols = int(v)
+		case "nrows":
+			hdr.Rows = int(v)
+		case "xllcorner", "xllcenter":
+			hdr.XLLCorner = v
+		case "yllcorner", "yllcenter":
+			hdr.YLLCorner = v
+		case "cellsize":
+			hdr.DX, hdr.DY = v, v
+		case "dx":
+			hdr.DX = v
+		case "dy":
+			hdr.DY = v
+		case "nodata_value":
+			hdr.HasNoData, hdr.NoData = true, v
+		}
+	}
+}
+
+// check checks the header and converts the center of the lower-left cell
+// to the corner.
+func (p *Header) check(keys map[string]bool) error {
+	if !keys["ncols"] || !keys["nrows"] || !(keys["cellsize"] || keys["dx"] && keys["dy"]) {
+		return fmt.Errorf("image/dem/ArcInfoGrid: missing ncols, nrows or cellsize")
+	}
+	if p.Cols <= 0 || p.Rows <= 0 || p.DX <= 0 || p.DY <= 0 {
+		return fmt.Errorf("image/dem/ArcInfoGrid: bad header: %+v", *p)
+	}
+	if keys["xllcenter"] {
+		p.XLLCorner -= p.DX / 2
+	}
+	if keys["yllcenter"] {
+		p.YLLCorner -= p.DY / 2
+	}
+	return nil
+}
+
+func writeHeader(w io.Writer, hdr *Header) (err error) {
+	format := func(v float64) string {
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	}
+	lines := []string{
+		fmt.Sprintf("ncols        %d", hdr.Cols),
+		fmt.Sprintf("nrows        %d", hdr.Rows),
+		fmt.Sprintf("xllcorner    %s", format(hdr.XLLCorner)),
+		fmt.Sprintf("yllcorner    %s", format(hdr.YLLCorner)),
+	}
+	if hdr.DX == hdr.DY {
+		lines = append(lines, fmt.Sprintf("cellsize     %s", format(hdr.DX)))
+	} else {
+		lines = append(lines,
+			fmt.Sprintf("dx           %s", format(hdr.DX)),
+			fmt.Sprintf("dy           %s", format(hdr.DY)),
+		)
+	}
+	if hdr.HasNoData {
+		lines = append(lines, fmt.Sprintf("NODATA_value %s", format(hdr.NoData)))
+	}
+	_, err = io.WriteString(w, strings.Join(lines, "\n")+"\n")
+	return
+}
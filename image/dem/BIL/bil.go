@@ -0,0 +1,294 @@
+// Copyright 2014 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package bil implements the BIL, BIP and BSQ raster decoder and encoder.
+//
+// The raster is saved in two files, the raw cell values (.bil, .bip or
+// .bsq) and the ESRI .hdr file which describes the size, the layout and
+// the georeferencing, see HeaderName.
+package bil
+
+import (
+	"bufio"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+
+	image_ext "github.com/chai2010/gopkg/image"
+	color_ext "github.com/chai2010/gopkg/image/color"
+	"github.com/chai2010/gopkg/image/convert"
+)
+
+// Options are the encoding and decoding parameters.
+type Options struct {
+	ColorModel color.Model // convert the decoded image to ColorModel
+	Band       int         // the decoded band, 0 is the first band
+	Header     *Header     // the byte order, pixel type, georeferencing and nodata of Encode, may be nil
+
+	// Progress reports the progress of Encode by rows, may be nil. The
+	// encoding is canceled with image_ext.ErrCanceled if it returns false.
+	Progress image_ext.ProgressFunc
+}
+
+// DecodeConfig returns the color model and dimensions of the raster of
+// the header.
+func DecodeConfig(hdr *Header) image.Config {
+	return image.Config{
+		ColorModel: color_ext.Gray32fModel,
+		Width:      hdr.Cols,
+		Height:     hdr.Rows,
+	}
+}
+
+// Decode reads the band opt.Band of the raster data from r, and returns
+// it as a *image.Gray32f. The nodata cells keep the NODATA of hdr.
+func Decode(r io.Reader, hdr *Header, opt *Options) (m image.Image, err error) {
+	v := *hdr
+	if err = v.setDefaults(); err != nil {
+		return
+	}
+	var band int
+	if opt != nil {
+		band = opt.Band
+	}
+	if band < 0 || band >= v.Bands {
+		err = fmt.Errorf("image/dem/BIL: Decode, bad band: %d, bands = %d", band, v.Bands)
+		return
+	}
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return
+	}
+	if end := v.offset(v.Cols-1, v.Rows-1, band) + int64(v.Bits/8); int64(len(data)) < end {
+		err = fmt.Errorf("image/dem/BIL: Decode, data too short: %d, want %d", len(data), end)
+		return
+	}
+
+	gray32f := image_ext.NewGray32f(image.Rect(0, 0, v.Cols, v.Rows))
+	for y := 0; y < v.Rows; y++ {
+		for x := 0; x < v.Cols; x++ {
+			f := v.readValue(data[v.offset(x, y, band):])
+			gray32f.SetGray32f(x, y, color_ext.Gray32f{Y: float32(f)})
+		}
+	}
+	if m = gray32f; opt != nil && opt.ColorModel != nil {
+		m = convert.ColorModel(m, opt.ColorModel)
+	}
+	return
+}
+
+func (p *Header) readValue(b []byte) float64 {
+	switch {
+	case p.PixelType == PixelType_Float && p.Bits == 32:
+		return float64(math.Float32frombits(p.ByteOrder.Uint32(b)))
+	case p.PixelType == PixelType_Float:
+		return math.Float64frombits(p.ByteOrder.Uint64(b))
+	case p.Bits == 8 && p.PixelType == PixelType_SignedInt:
+		return float64(int8(b[0]))
+	case p.Bits == 8:
+		return float64(b[0])
+	case p.Bits == 16 && p.PixelType == PixelType_SignedInt:
+		return float64(int16(p.ByteOrder.Uint16(b)))
+	case p.Bits == 16:
+		return float64(p.ByteOrder.Uint16(b))
+	case p.PixelType == PixelType_SignedInt:
+		return float64(int32(p.ByteOrder.Uint32(b)))
+	}
+	return float64(p.ByteOrder.Uint32(b))
+}
+
+func (p *Header) putValue(b []byte, v float64) {
+	if p.PixelType != PixelType_Float {
+		v = math.Floor(v + 0.5)
+	}
+	switch {
+	case p.PixelType == PixelType_Float && p.Bits == 32:
+		p.ByteOrder.PutUint32(b, math.Float32bits(float32(v)))
+	case p.PixelType == PixelType_Float:
+		p.ByteOrder.PutUint64(b, math.Float64bits(v))
+	case p.Bits == 8 && p.PixelType == PixelType_SignedInt:
+		b[0] = byte(int8(clamp(v, math.MinInt8, math.MaxInt8)))
+	case p.Bits == 8:
+		b[0] = byte(clamp(v, 0, math.MaxUint8))
+	case p.Bits == 16 && p.PixelType == PixelType_SignedInt:
+		p.ByteOrder.PutUint16(b, uint16(int16(clamp(v, math.MinInt16, math.MaxInt16))))
+	case p.Bits == 16:
+		p.ByteOrder.PutUint16(b, uint16(clamp(v, 0, math.MaxUint16)))
+	case p.PixelType == PixelType_SignedInt:
+		p.ByteOrder.PutUint32(b, uint32(int32(clamp(v, math.MinInt32, math.MaxInt32))))
+	default:
+		p.ByteOrder.PutUint32(b, uint32(clamp(v, 0, math.MaxUint32)))
+	}
+}
+
+func clamp(v, min, max float64) float64 {
+	if v < min {
+		return min
+	}
+	if v > max {
+		return max
+	}
+	return v
+}
+
+// Encode writes the image m to w as the raster data of a band, and
+// returns the header of the data. The byte order, layout, pixel type,
+// georeferencing and nodata are taken from opt.Header, the pixel type is
+// 32 bits FLOAT if it's not set. The NaN cells are written as the nodata
+// value, or 0 for the integer pixel types without nodata.
+func Encode(w io.Writer, m image.Image, opt *Options) (hdr *Header, err error) {
+	gray32f := convert.Gray32f(m)
+	b := gray32f.Bounds()
+
+	hdr = new(Header)
+	if opt != nil && opt.Header != nil {
+		*hdr = *opt.Header
+	}
+	if hdr.PixelType == "" {
+		hdr.PixelType, hdr.Bits = PixelType_Float, 32
+	}
+	hdr.Rows, hdr.Cols, hdr.Bands = b.Dy(), b.Dx(), 1
+	hdr.SkipBytes, hdr.BandRowBytes, hdr.TotalRowBytes, hdr.BandGapBytes = 0, 0, 0, 0
+	if err = hdr.setDefaults(); err != nil {
+		return nil, err
+	}
+
+	var progress *image_ext.Progress
+	if opt != nil {
+		progress = image_ext.NewProgress(opt.Progress, b.Dy())
+	}
+	bw := bufio.NewWriter(w)
+	row := make([]byte, hdr.BandRowBytes)
+	n := hdr.Bits / 8
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			v := float64(gray32f.Gray32fAt(x, y).Y)
+			if v != v && hdr.HasNoData {
+				v = hdr.NoData
+			} else if v != v && hdr.PixelType != PixelType_Float {
+				v = 0
+			}
+			hdr.putValue(row[(x-b.Min.X)*n:], v)
+		}
+		if _, err = bw.Write(row); err != nil {
+			return nil, err
+		}
+		if !progress.Step(1) {
+			return nil, image_ext.ErrCanceled
+		}
+	}
+	if err = bw.Flush(); err != nil {
+		return nil, err
+	}
+	return
+}
+
+// Load reads the raster file and its .hdr file.
+func Load(filename string, opt *Options) (m image.Image, hdr *Header, err error) {
+	f, err := os.Open(HeaderName(filename))
+	if err != nil {
+		return
+	}
+	hdr, err = DecodeHeader(f)
+	f.Close()
+	if err != nil {
+		return
+	}
+	if f, err = os.Open(filename); err != nil {
+		return
+	}
+	defer f.Close()
+	m, err = Decode(f, hdr, opt)
+	return
+}
+
+// Save writes the raster file and its .hdr file, the layout is taken from
+// the file name extension if opt.Header has no layout.
+func Save(filename string, m image.Image, opt *Options) (err error) {
+	var v Options
+	if opt != nil {
+		v = *opt
+	}
+	if v.Header == nil || v.Header.Layout == "" {
+		var hdr Header
+		if v.Header != nil {
+			hdr = *v.Header
+		}
+		switch layout := strings.ToUpper(strings.TrimPrefix(filepath.Ext(filename), ".")); layout {
+		case Layout_BIL, Layout_BIP, Layout_BSQ:
+			hdr.Layout = layout
+		}
+		v.Header = &hdr
+	}
+
+	f, err := os.Create(filename)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	hdr, err := Encode(f, m, &v)
+	if err != nil {
+		return
+	}
+	fh, err := os.Create(HeaderName(filename))
+	if err != nil {
+		return
+	}
+	defer fh.Close()
+	return EncodeHeader(fh, hdr)
+}
+
+// newOptions converts the common options to the BIL options.
+func newOptions(opt *image_ext.Options) (*Options, error) {
+	var p Options
+	if ok, err := image_ext.ConvertOptions("BIL", opt, &p); !ok {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// newEncodeOptions converts the common options to the BIL options, the
+// rasters are always lossless and uncompressed.
+func newEncodeOptions(opt *image_ext.Options) (*Options, error) {
+	var p Options
+	ok, err := image_ext.ConvertEncodeOptions("BIL", opt, &p, image_ext.EncodeSupport{
+		Compression: []image_ext.Compression{image_ext.CompressionNone},
+	})
+	if !ok {
+		return nil, err
+	}
+	return &p, nil
+}
+
+func imageExtLoadFile(filename string, opt *image_ext.Options) (image.Image, error) {
+	p, err := newOptions(opt)
+	if err != nil {
+		return nil, err
+	}
+	m, _, err := Load(filename, p)
+	return m, err
+}
+
+func imageExtSaveFile(filename string, m image.Image, opt *image_ext.Options) error {
+	p, err := newEncodeOptions(opt)
+	if err != nil {
+		return err
+	}
+	return Save(filename, m, p)
+}
+
+func init() {
+	image_ext.RegisterFormat(image_ext.Format{
+		Name:       "BIL",
+		Extensions: []string{".bil", ".bip", ".bsq"},
+		LoadFile:   imageExtLoadFile,
+		SaveFile:   imageExtSaveFile,
+	})
+}
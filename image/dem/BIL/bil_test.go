@@ -0,0 +1,189 @@
+// Copyright 2014 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package bil
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	image_ext "github.com/chai2010/gopkg/image"
+	color_ext "github.com/chai2010/gopkg/image/color"
+)
+
+// tValue is the value (x, y) of the band k.
+func tValue(x, y, k int) int16 {
+	return int16(-1000*k + 10*y + x)
+}
+
+func TestDecode(t *testing.T) {
+	const cols, rows, bands = 3, 2, 2
+	for i, layout := range []string{Layout_BIL, Layout_BIP, Layout_BSQ} {
+		var buf bytes.Buffer
+		buf.WriteString("skip")
+		put := func(x, y, k int) {
+			binary.Write(&buf, binary.BigEndian, tValue(x, y, k))
+		}
+		switch layout {
+		case Layout_BIL:
+			for y := 0; y < rows; y++ {
+				for k := 0; k < bands; k++ {
+					for x := 0; x < cols; x++ {
+						put(x, y, k)
+					}
+				}
+			}
+		case Layout_BIP:
+			for y := 0; y < rows; y++ {
+				for x := 0; x < cols; x++ {
+					for k := 0; k < bands; k++ {
+						put(x, y, k)
+					}
+				}
+			}
+		case Layout_BSQ:
+			for k := 0; k < bands; k++ {
+				for y := 0; y < rows; y++ {
+					for x := 0; x < cols; x++ {
+						put(x, y, k)
+					}
+				}
+			}
+		}
+		hdr, err := DecodeHeader(strings.NewReader(strings.Join([]string{
+			"BYTEORDER M",
+			"LAYOUT " + layout,
+			"NROWS 2",
+			"NCOLS 3",
+			"NBANDS 2",
+			"NBITS 16",
+			"PIXELTYPE SIGNEDINT",
+			"SKIPBYTES 4",
+			"ULXMAP 100.5",
+			"ULYMAP 199.5",
+			"XDIM 1",
+			"YDIM 1",
+			"NODATA -32768",
+		}, "\n")))
+		if err != nil {
+			t.Fatalf("%d: %v", i, err)
+		}
+		if gt := hdr.GeoTransform(); gt != image_ext.NewGeoTransform(100, 200, 1, 1) {
+			t.Fatalf("%d: bad GeoTransform: %v", i, gt)
+		}
+		if !hdr.HasNoData || hdr.NoData != -32768 {
+			t.Fatalf("%d: bad nodata: %v", i, hdr.NoData)
+		}
+		for k := 0; k < bands; k++ {
+			m, err := Decode(bytes.NewReader(buf.Bytes()), hdr, &Options{Band: k})
+			if err != nil {
+				t.Fatalf("%d: band %d: %v", i, k, err)
+			}
+			for y := 0; y < rows; y++ {
+				for x := 0; x < cols; x++ {
+					got := m.(*image_ext.Gray32f).Gray32fAt(x, y).Y
+					if want := float32(tValue(x, y, k)); got != want {
+						t.Fatalf("%d: %s: band %d: bad value at (%d, %d): got %v, want %v", i, layout, k, x, y, got, want)
+					}
+				}
+			}
+		}
+		if _, err = Decode(bytes.NewReader(buf.Bytes()[:buf.Len()-1]), hdr, &Options{Band: 1}); err == nil {
+			t.Fatalf("%d: short data: expect error", i)
+		}
+		if _, err = Decode(bytes.NewReader(buf.Bytes()), hdr, &Options{Band: 2}); err == nil {
+			t.Fatalf("%d: bad band: expect error", i)
+		}
+	}
+}
+
+func TestSave(t *testing.T) {
+	dir, err := ioutil.TempDir("", "bil")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	m := image_ext.NewGray32f(image.Rect(0, 0, 7, 5))
+	for y := 0; y < 5; y++ {
+		for x := 0; x < 7; x++ {
+			m.SetGray32f(x, y, color_ext.Gray32f{Y: float32(x*100+y) - 200.5})
+		}
+	}
+	m.SetGray32f(3, 3, color_ext.Gray32f{Y: float32(math.NaN())})
+
+	for i, v := range []struct {
+		Name   string
+		Header *Header
+		Round  bool
+	}{
+		{"a.bil", nil, false},
+		{"b.bsq", &Header{ByteOrder: binary.BigEndian, HasNoData: true, NoData: -9999}, false},
+		{"c.bip", &Header{PixelType: PixelType_SignedInt, Bits: 16, HasNoData: true, NoData: -9999}, true},
+		{"d.bil", &Header{PixelType: PixelType_Float, Bits: 64}, false},
+	} {
+		name := filepath.Join(dir, v.Name)
+		hdr := &Header{}
+		if v.Header != nil {
+			hdr = v.Header
+		}
+		if err := hdr.SetGeoTransform(image_ext.NewGeoTransform(10, 20, 0.5, 0.5)); err != nil {
+			t.Fatal(err)
+		}
+		if err := image_ext.Save(name, m, &image_ext.Options{Ext: &Options{Header: hdr}}); err != nil {
+			t.Fatalf("%d: Save: %v", i, err)
+		}
+		got, format, err := image_ext.Load(name, nil)
+		if err != nil || format != "BIL" {
+			t.Fatalf("%d: Load: %q, %v", i, format, err)
+		}
+		_, gotHdr, err := Load(name, nil)
+		if err != nil {
+			t.Fatalf("%d: Load: %v", i, err)
+		}
+		if gt := gotHdr.GeoTransform(); gt != image_ext.NewGeoTransform(10, 20, 0.5, 0.5) {
+			t.Fatalf("%d: bad GeoTransform: %v", i, gt)
+		}
+		if want := strings.ToUpper(filepath.Ext(v.Name)[1:]); gotHdr.Layout != want {
+			t.Fatalf("%d: bad layout: %q, want %q", i, gotHdr.Layout, want)
+		}
+		for y := 0; y < 5; y++ {
+			for x := 0; x < 7; x++ {
+				want := m.Gray32fAt(x, y).Y
+				if v.Round {
+					want = float32(math.Floor(float64(want) + 0.5))
+				}
+				if x == 3 && y == 3 && v.Header != nil && v.Header.HasNoData {
+					want = -9999
+				}
+				v := got.(*image_ext.Gray32f).Gray32fAt(x, y).Y
+				if v != want && !(v != v && want != want) {
+					t.Fatalf("%d: bad value at (%d, %d): got %v, want %v", i, x, y, v, want)
+				}
+			}
+		}
+	}
+}
+
+func TestEncode_progress(t *testing.T) {
+	m := image_ext.NewGray32f(image.Rect(0, 0, 7, 5))
+	var rows []float64
+	_, err := Encode(ioutil.Discard, m, &Options{Progress: func(done float64) bool {
+		rows = append(rows, done)
+		return len(rows) < 3
+	}})
+	if err != image_ext.ErrCanceled {
+		t.Fatalf("expect ErrCanceled, got %v", err)
+	}
+	if len(rows) != 3 || rows[2] != 0.6 {
+		t.Fatalf("bad progress: %v", rows)
+	}
+}
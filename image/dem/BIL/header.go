@@ -0,0 +1,263 @@
+// Copyright 2014 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package bil
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	image_ext "github.com/chai2010/gopkg/image"
+)
+
+// Layouts of the bands.
+const (
+	Layout_BIL = "BIL" // band interleaved by line
+	Layout_BIP = "BIP" // band interleaved by pixel
+	Layout_BSQ = "BSQ" // band sequential
+)
+
+// Pixel types.
+const (
+	PixelType_UnsignedInt = "UNSIGNEDINT"
+	PixelType_SignedInt   = "SIGNEDINT"
+	PixelType_Float       = "FLOAT"
+)
+
+// Header is the .hdr file of a BIL, BIP or BSQ raster. The zero fields
+// of the row and band sizes are computed by the Cols, Bands and Bits.
+type Header struct {
+	ByteOrder     binary.ByteOrder // binary.LittleEndian for "I", binary.BigEndian for "M"
+	Layout        string           // BIL, BIP or BSQ
+	Rows, Cols    int
+	Bands         int
+	Bits          int     // 8, 16, 32 or 64
+	PixelType     string  // UNSIGNEDINT, SIGNEDINT or FLOAT
+	SkipBytes     int64   // the bytes before the data
+	BandRowBytes  int     // the bytes of a band row
+	TotalRowBytes int     // the bytes of a row of all the bands, BIL and BIP
+	BandGapBytes  int     // the bytes between the bands, BSQ
+	ULXMap        float64 // the x of the center of the upper-left cell
+	ULYMap        float64 // the y of the center of the upper-left cell
+	XDim, YDim    float64 // the cell size
+	HasNoData     bool
+	NoData        float64
+}
+
+// HeaderName returns the .hdr file name of the raster file.
+func HeaderName(filename string) string {
+	if i := strings.LastIndex(filename, "."); i > strings.LastIndexAny(filename, `/\`) {
+		filename = filename[:i]
+	}
+	return filename + ".hdr"
+}
+
+// GeoTransform returns the GeoTransform of the raster.
+func (p *Header) GeoTransform() image_ext.GeoTransform {
+	return image_ext.NewGeoTransform(p.ULXMap-p.XDim/2, p.ULYMap+p.YDim/2, p.XDim, p.YDim)
+}
+
+// SetGeoTransform sets the ULXMap, ULYMap, XDim and YDim by gt, the
+// rotated gt is not supported.
+func (p *Header) SetGeoTransform(gt image_ext.GeoTransform) error {
+	if gt[2] != 0 || gt[4] != 0 || gt[1] <= 0 || gt[5] >= 0 {
+		return fmt.Errorf("image/dem/BIL: Header.SetGeoTransform, unsupported transform: %v", gt)
+	}
+	p.XDim, p.YDim = gt[1], -gt[5]
+	p.ULXMap, p.ULYMap = gt.PixelToWorld(0.5, 0.5)
+	return nil
+}
+
+// setDefaults sets the zero fields to the defaults and checks the header.
+func (p *Header) setDefaults() error {
+	if p.ByteOrder == nil {
+		p.ByteOrder = binary.LittleEndian
+	}
+	if p.Layout == "" {
+		p.Layout = Layout_BIL
+	}
+	if p.Bands == 0 {
+		p.Bands = 1
+	}
+	if p.Bits == 0 {
+		p.Bits = 8
+	}
+	if p.PixelType == "" {
+		p.PixelType = PixelType_UnsignedInt
+	}
+	if p.XDim == 0 {
+		p.XDim = 1
+	}
+	if p.YDim == 0 {
+		p.YDim = 1
+	}
+	if p.BandRowBytes == 0 {
+		p.BandRowBytes = p.Cols * p.Bits / 8
+		if p.Layout == Layout_BIP {
+			p.BandRowBytes *= p.Bands
+		}
+	}
+	if p.TotalRowBytes == 0 {
+		p.TotalRowBytes = p.BandRowBytes
+		if p.Layout == Layout_BIL {
+			p.TotalRowBytes *= p.Bands
+		}
+	}
+
+	if p.Rows <= 0 || p.Cols <= 0 || p.Bands <= 0 {
+		return fmt.Errorf("image/dem/BIL: bad size: rows = %d, cols = %d, bands = %d", p.Rows, p.Cols, p.Bands)
+	}
+	switch p.Layout {
+	case Layout_BIL, Layout_BIP, Layout_BSQ:
+	default:
+		return fmt.Errorf("image/dem/BIL: bad layout: %q", p.Layout)
+	}
+	switch {
+	case p.PixelType == PixelType_Float && (p.Bits == 32 || p.Bits == 64):
+	case p.PixelType == PixelType_UnsignedInt || p.PixelType == PixelType_SignedInt:
+		if p.Bits != 8 && p.Bits != 16 && p.Bits != 32 {
+			return fmt.Errorf("image/dem/BIL: unsupported bits: %d", p.Bits)
+		}
+	default:
+		return fmt.Errorf("image/dem/BIL: unsupported pixel type: %q, %d bits", p.PixelType, p.Bits)
+	}
+	return nil
+}
+
+// offset returns the offset of the value (x, y) of the band k.
+func (p *Header) offset(x, y, k int) int64 {
+	n := int64(p.Bits / 8)
+	switch p.Layout {
+	case Layout_BIP:
+		return p.SkipBytes + int64(y)*int64(p.TotalRowBytes) + int64(x*p.Bands+k)*n
+	case Layout_BSQ:
+		band := int64(p.Rows)*int64(p.BandRowBytes) + int64(p.BandGapBytes)
+		return p.SkipBytes + int64(k)*band + int64(y)*int64(p.BandRowBytes) + int64(x)*n
+	}
+	return p.SkipBytes + int64(y)*int64(p.TotalRowBytes) + int64(k)*int64(p.BandRowBytes) + int64(x)*n
+}
+
+// DecodeHeader reads the .hdr file.
+func DecodeHeader(r io.Reader) (hdr *Header, err error) {
+	hdr = new(Header)
+	s := bufio.NewScanner(r)
+	for s.Scan() {
+		f := strings.Fields(s.Text())
+		if len(f) < 2 {
+			continue
+		}
+		key, value := strings.ToUpper(f[0]), f[1]
+		var n int
+		var v float64
+		switch key {
+		case "BYTEORDER":
+			switch strings.ToUpper(value) {
+			case "I":
+				hdr.ByteOrder = binary.LittleEndian
+			case "M":
+				hdr.ByteOrder = binary.BigEndian
+			default:
+				return nil, fmt.Errorf("image/dem/BIL: bad BYTEORDER: %q", value)
+			}
+			continue
+		case "LAYOUT", "INTERLEAVING":
+			hdr.Layout = strings.ToUpper(value)
+			continue
+		case "PIXELTYPE":
+			hdr.PixelType = strings.ToUpper(value)
+			continue
+		case "NROWS", "ROWS", "NCOLS", "COLS", "NBANDS", "BANDS", "NBITS",
+			"SKIPBYTES", "BANDROWBYTES", "TOTALROWBYTES", "BANDGAPBYTES":
+			if n, err = strconv.Atoi(value); err != nil {
+				return nil, fmt.Errorf("image/dem/BIL: bad %s: %q", f[0], value)
+			}
+		case "ULXMAP", "ULYMAP", "XDIM", "YDIM", "NODATA", "NODATA_VALUE":
+			if v, err = strconv.ParseFloat(value, 64); err != nil {
+				return nil, fmt.Errorf("image/dem/BIL: bad %s: %q", f[0], value)
+			}
+		default:
+			continue
+		}
+		switch key {
+		case "NROWS", "ROWS":
+			hdr.Rows = n
+		case "NCOLS", "COLS":
+			hdr.Cols = n
+		case "NBANDS", "BANDS":
+			hdr.Bands = n
+		case "NBITS":
+			hdr.Bits = n
+		case "SKIPBYTES":
+			hdr.SkipBytes = int64(n)
+		case "BANDROWBYTES":
+			hdr.BandRowBytes = n
+		case "TOTALROWBYTES":
+			hdr.TotalRowBytes = n
+		case "BANDGAPBYTES":
+			hdr.BandGapBytes = n
+		case "ULXMAP":
+			hdr.ULXMap = v
+		case "ULYMAP":
+			hdr.ULYMap = v
+		case "XDIM":
+			hdr.XDim = v
+		case "YDIM":
+			hdr.YDim = v
+		case "NODATA", "NODATA_VALUE":
+			hdr.HasNoData, hdr.NoData = true, v
+		}
+	}
+	if err = s.Err(); err != nil {
+		return nil, err
+	}
+	if err = hdr.setDefaults(); err != nil {
+		return nil, err
+	}
+	return
+}
+
+// EncodeHeader writes the .hdr file.
+func EncodeHeader(w io.Writer, hdr *Header) (err error) {
+	v := *hdr
+	if err = v.setDefaults(); err != nil {
+		return
+	}
+	byteOrder := "I"
+	if v.ByteOrder == binary.BigEndian {
+		byteOrder = "M"
+	}
+	format := func(v float64) string {
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	}
+	lines := [][2]string{
+		{"BYTEORDER", byteOrder},
+		{"LAYOUT", v.Layout},
+		{"NROWS", strconv.Itoa(v.Rows)},
+		{"NCOLS", strconv.Itoa(v.Cols)},
+		{"NBANDS", strconv.Itoa(v.Bands)},
+		{"NBITS", strconv.Itoa(v.Bits)},
+		{"PIXELTYPE", v.PixelType},
+		{"SKIPBYTES", strconv.FormatInt(v.SkipBytes, 10)},
+		{"BANDROWBYTES", strconv.Itoa(v.BandRowBytes)},
+		{"TOTALROWBYTES", strconv.Itoa(v.TotalRowBytes)},
+		{"BANDGAPBYTES", strconv.Itoa(v.BandGapBytes)},
+		{"ULXMAP", format(v.ULXMap)},
+		{"ULYMAP", format(v.ULYMap)},
+		{"XDIM", format(v.XDim)},
+		{"YDIM", format(v.YDim)},
+	}
+	if v.HasNoData {
+		lines = append(lines, [2]string{"NODATA", format(v.NoData)})
+	}
+	for _, line := range lines {
+		if _, err = fmt.Fprintf(w, "%-14s %s\n", line[0], line[1]); err != nil {
+			return
+		}
+	}
+	return
+}
@@ -0,0 +1,210 @@
+// Copyright 2014 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package cnsdtf implements the CNSDTF-DEM decoder and encoder.
+//
+// CNSDTF-DEM is the DEM format of the Chinese National Spatial Data
+// Transfer Format (GB/T 17798-2007). The file has a header of "Key: Value"
+// lines which begins with "DataMark: CNSDTF-DEM", followed by the values
+// from the top row, the values are the elevations multiplied by HZoom.
+package cnsdtf
+
+import (
+	"bufio"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+	"math"
+	"strconv"
+
+	image_ext "github.com/chai2010/gopkg/image"
+	color_ext "github.com/chai2010/gopkg/image/color"
+	"github.com/chai2010/gopkg/image/convert"
+)
+
+// Options are the encoding and decoding parameters.
+type Options struct {
+	ColorModel color.Model // convert the decoded image to ColorModel
+	Header     *Header     // the georeferencing, HZoom and nodata of Encode, may be nil
+
+	// Progress reports the progress of Encode by rows, may be nil. The
+	// encoding is canceled with image_ext.ErrCanceled if it returns false.
+	Progress image_ext.ProgressFunc
+}
+
+// DecodeConfig returns the color model and dimensions of a CNSDTF-DEM
+// file without decoding the entire image.
+func DecodeConfig(r io.Reader) (config image.Config, err error) {
+	hdr, _, err := readHeader(r)
+	if err != nil {
+		return
+	}
+	config = image.Config{
+		ColorModel: color_ext.Gray32fModel,
+		Width:      hdr.Cols,
+		Height:     hdr.Rows,
+	}
+	return
+}
+
+// Decode reads a CNSDTF-DEM file from r and returns it as a *image.Gray32f.
+// The values are divided by HZoom, the void cells keep the NoData of the
+// header.
+func Decode(r io.Reader, opt *Options) (m image.Image, err error) {
+	if m, _, err = DecodeWithHeader(r); err != nil {
+		return
+	}
+	if opt != nil && opt.ColorModel != nil {
+		m = convert.ColorModel(m, opt.ColorModel)
+	}
+	return
+}
+
+// DecodeWithHeader reads a CNSDTF-DEM file and its header from r.
+func DecodeWithHeader(r io.Reader) (m *image_ext.Gray32f, hdr *Header, err error) {
+	hdr, values, err := readHeader(r)
+	if err != nil {
+		return
+	}
+	s := bufio.NewScanner(values)
+	s.Split(bufio.ScanWords)
+	m = image_ext.NewGray32f(image.Rect(0, 0, hdr.Cols, hdr.Rows))
+	for y := 0; y < hdr.Rows; y++ {
+		for x := 0; x < hdr.Cols; x++ {
+			if !s.Scan() {
+				if err = s.Err(); err == nil {
+					err = io.ErrUnexpectedEOF
+				}
+				return nil, nil, fmt.Errorf("image/dem/CNSDTF: Decode, %v", err)
+			}
+			v, err := strconv.ParseFloat(s.Text(), 64)
+			if err != nil {
+				return nil, nil, fmt.Errorf("image/dem/CNSDTF: Decode, bad value at (%d, %d): %q", x, y, s.Text())
+			}
+			if v != hdr.NoData {
+				v /= hdr.HZoom
+			}
+			m.SetGray32f(x, y, color_ext.Gray32f{Y: float32(v)})
+		}
+	}
+	return
+}
+
+// Encode writes the image m to w in CNSDTF-DEM format. The georeferencing,
+// HZoom and nodata are taken from opt.Header, and the size is taken from
+// m. The NaN cells are written as the nodata value.
+func Encode(w io.Writer, m image.Image, opt *Options) (err error) {
+	gray32f := convert.Gray32f(m)
+	b := gray32f.Bounds()
+
+	var hdr Header
+	if opt != nil && opt.Header != nil {
+		hdr = *opt.Header
+	}
+	hdr.Rows, hdr.Cols = b.Dy(), b.Dx()
+	if hdr.DX <= 0 || hdr.DY <= 0 {
+		hdr.DX, hdr.DY = 1, 1
+	}
+	hdr.setDefaults()
+	if err = hdr.check(); err != nil {
+		return
+	}
+
+	value := func(x, y int) (v float64, ok bool) {
+		v = float64(gray32f.Gray32fAt(x, y).Y)
+		if v != v || v == hdr.NoData {
+			return hdr.NoData, false
+		}
+		if v *= hdr.HZoom; hdr.ValueType == ValueType_Integer {
+			v = math.Floor(v + 0.5)
+		}
+		return v, true
+	}
+	min, max := math.Inf(1), math.Inf(-1)
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			if v, ok := value(x, y); ok {
+				min, max = math.Min(min, v), math.Max(max, v)
+			}
+		}
+	}
+
+	bw := bufio.NewWriter(w)
+	if err = writeHeader(bw, &hdr, min, max); err != nil {
+		return
+	}
+	var progress *image_ext.Progress
+	if opt != nil {
+		progress = image_ext.NewProgress(opt.Progress, b.Dy())
+	}
+	var buf []byte
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		buf = buf[:0]
+		for x := b.Min.X; x < b.Max.X; x++ {
+			if x > b.Min.X {
+				buf = append(buf, ' ')
+			}
+			v, _ := value(x, y)
+			buf = strconv.AppendFloat(buf, v, 'f', -1, 64)
+		}
+		buf = append(buf, '\n')
+		if _, err = bw.Write(buf); err != nil {
+			return
+		}
+		if !progress.Step(1) {
+			return image_ext.ErrCanceled
+		}
+	}
+	return bw.Flush()
+}
+
+// newOptions converts the common options to the CNSDTF options.
+func newOptions(opt *image_ext.Options) (*Options, error) {
+	var p Options
+	if ok, err := image_ext.ConvertOptions("CNSDTF", opt, &p); !ok {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// newEncodeOptions converts the common options to the CNSDTF options, the
+// files are always uncompressed.
+func newEncodeOptions(opt *image_ext.Options) (*Options, error) {
+	var p Options
+	ok, err := image_ext.ConvertEncodeOptions("CNSDTF", opt, &p, image_ext.EncodeSupport{
+		Compression: []image_ext.Compression{image_ext.CompressionNone},
+	})
+	if !ok {
+		return nil, err
+	}
+	return &p, nil
+}
+
+func imageExtDecode(r io.Reader, opt *image_ext.Options) (image.Image, error) {
+	p, err := newOptions(opt)
+	if err != nil {
+		return nil, err
+	}
+	return Decode(r, p)
+}
+
+func imageExtEncode(w io.Writer, m image.Image, opt *image_ext.Options) error {
+	p, err := newEncodeOptions(opt)
+	if err != nil {
+		return err
+	}
+	return Encode(w, m, p)
+}
+
+func init() {
+	image_ext.RegisterFormat(image_ext.Format{
+		Name:         "CNSDTF",
+		Extensions:   []string{".dem"},
+		Magics:       []string{"DataMark"},
+		DecodeConfig: DecodeConfig,
+		Decode:       imageExtDecode,
+		Encode:       imageExtEncode,
+	})
+}
@@ -0,0 +1,110 @@
+// Copyright 2014 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package cnsdtf
+
+import (
+	"bytes"
+	"image"
+	"math"
+	"strings"
+	"testing"
+
+	image_ext "github.com/chai2010/gopkg/image"
+	color_ext "github.com/chai2010/gopkg/image/color"
+)
+
+const tDem = `DataMark: CNSDTF-DEM
+Version: 1.0
+Alpha: 0.000000
+Unit: M
+Compress: 0
+X0: 500002.500000
+Y0: 4000097.500000
+DX: 5.000000
+DY: 5.000000
+Row: 2
+Col: 3
+ValueType: Integer
+HZoom: 10
+MinV: 1005
+MaxV: 1520
+1005 1010 -99999
+1500 1510 1520
+`
+
+func TestDecode(t *testing.T) {
+	m, hdr, err := DecodeWithHeader(strings.NewReader(tDem))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hdr.Rows != 2 || hdr.Cols != 3 || hdr.HZoom != 10 || hdr.NoData != DefaultNoData {
+		t.Fatalf("bad header: %+v", *hdr)
+	}
+	if gt := hdr.GeoTransform(); gt != image_ext.NewGeoTransform(500000, 4000100, 5, 5) {
+		t.Fatalf("bad GeoTransform: %v", gt)
+	}
+	for i, v := range []float32{100.5, 101, DefaultNoData, 150, 151, 152} {
+		if got := m.Gray32fAt(i%3, i/3).Y; got != v {
+			t.Fatalf("%d: bad value: got %v, want %v", i, got, v)
+		}
+	}
+
+	if _, format, err := image_ext.Decode(strings.NewReader(tDem), nil); err != nil || format != "CNSDTF" {
+		t.Fatalf("bad format: %q, %v", format, err)
+	}
+	if c, err := DecodeConfig(strings.NewReader(tDem)); err != nil || c.Width != 3 || c.Height != 2 {
+		t.Fatalf("bad config: %v, %v", c, err)
+	}
+	for i, s := range []string{
+		strings.Replace(tDem, "CNSDTF-DEM", "NSDTF-DEM", 1),
+		strings.Replace(tDem, "Compress: 0", "Compress: 1", 1),
+		strings.Replace(tDem, "1500 1510 1520", "1500 1510", 1),
+	} {
+		if _, err := Decode(strings.NewReader(s), nil); err == nil {
+			t.Fatalf("%d: expect error", i)
+		}
+	}
+}
+
+func TestEncode(t *testing.T) {
+	m := image_ext.NewGray32f(image.Rect(0, 0, 4, 3))
+	for y := 0; y < 3; y++ {
+		for x := 0; x < 4; x++ {
+			m.SetGray32f(x, y, color_ext.Gray32f{Y: float32(x*100+y) + 0.5})
+		}
+	}
+	m.SetGray32f(1, 1, color_ext.Gray32f{Y: float32(math.NaN())})
+
+	for i, hdr := range []*Header{
+		{HZoom: 100},
+		{HZoom: 1, ValueType: ValueType_Float},
+	} {
+		if err := hdr.SetGeoTransform(image_ext.NewGeoTransform(100, 200, 2, 2)); err != nil {
+			t.Fatal(err)
+		}
+		var buf bytes.Buffer
+		if err := Encode(&buf, m, &Options{Header: hdr}); err != nil {
+			t.Fatalf("%d: %v", i, err)
+		}
+		got, gotHdr, err := DecodeWithHeader(&buf)
+		if err != nil {
+			t.Fatalf("%d: %v", i, err)
+		}
+		if gotHdr.GeoTransform() != image_ext.NewGeoTransform(100, 200, 2, 2) {
+			t.Fatalf("%d: bad GeoTransform: %v", i, gotHdr.GeoTransform())
+		}
+		for y := 0; y < 3; y++ {
+			for x := 0; x < 4; x++ {
+				want := m.Gray32fAt(x, y).Y
+				if x == 1 && y == 1 {
+					want = DefaultNoData
+				}
+				if v := got.Gray32fAt(x, y).Y; v != want {
+					t.Fatalf("%d: bad value at (%d, %d): got %v, want %v", i, x, y, v, want)
+				}
+			}
+		}
+	}
+}
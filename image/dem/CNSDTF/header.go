@@ -0,0 +1,215 @@
+// Copyright 2014 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package cnsdtf
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+
+	image_ext "github.com/chai2010/gopkg/image"
+)
+
+const (
+	// DataMark is the first header line of CNSDTF-DEM.
+	DataMark = "CNSDTF-DEM"
+	// DefaultNoData is the value of the void cells.
+	DefaultNoData = -99999
+)
+
+// Value types.
+const (
+	ValueType_Integer = "Integer"
+	ValueType_Float   = "Float"
+)
+
+// Header is the header of a CNSDTF-DEM file.
+type Header struct {
+	Version    string  // "1.0" if empty
+	Unit       string  // the unit of the coordinates, "M" if empty
+	Alpha      float64 // the counter-clockwise angle of the rows to the x axis in degrees
+	Compress   int     // must be 0, the compressed files are not supported
+	X0, Y0     float64 // the upper-left grid point, the center of the upper-left cell
+	DX, DY     float64 // the cell size
+	Rows, Cols int
+	ValueType  string  // Integer or Float, Integer if empty
+	HZoom      float64 // the values are the elevations multiplied by HZoom, 1 if zero
+	NoData     float64 // the value of the void cells, DefaultNoData if zero
+}
+
+// GeoTransform returns the GeoTransform of the grid.
+func (p *Header) GeoTransform() image_ext.GeoTransform {
+	sin, cos := math.Sincos(p.Alpha * math.Pi / 180)
+	gt := image_ext.GeoTransform{p.X0, p.DX * cos, p.DY * sin, p.Y0, p.DX * sin, -p.DY * cos}
+	return gt.Translate(-0.5, -0.5)
+}
+
+// SetGeoTransform sets the X0, Y0, DX and DY by gt, the rotated gt is not
+// supported.
+func (p *Header) SetGeoTransform(gt image_ext.GeoTransform) error {
+	if gt[2] != 0 || gt[4] != 0 || gt[1] <= 0 || gt[5] >= 0 {
+		return fmt.Errorf("image/dem/CNSDTF: Header.SetGeoTransform, unsupported transform: %v", gt)
+	}
+	p.Alpha, p.DX, p.DY = 0, gt[1], -gt[5]
+	p.X0, p.Y0 = gt.PixelToWorld(0.5, 0.5)
+	return nil
+}
+
+func (p *Header) setDefaults() {
+	if p.Version == "" {
+		p.Version = "1.0"
+	}
+	if p.Unit == "" {
+		p.Unit = "M"
+	}
+	if p.ValueType == "" {
+		p.ValueType = ValueType_Integer
+	}
+	if p.HZoom == 0 {
+		p.HZoom = 1
+	}
+	if p.NoData == 0 {
+		p.NoData = DefaultNoData
+	}
+}
+
+func (p *Header) check() error {
+	if p.Rows <= 0 || p.Cols <= 0 || p.DX <= 0 || p.DY <= 0 {
+		return fmt.Errorf("image/dem/CNSDTF: bad header: rows = %d, cols = %d, dx = %v, dy = %v",
+			p.Rows, p.Cols, p.DX, p.DY,
+		)
+	}
+	if p.Compress != 0 {
+		return fmt.Errorf("image/dem/CNSDTF: unsupported compress: %d", p.Compress)
+	}
+	if p.ValueType != ValueType_Integer && p.ValueType != ValueType_Float {
+		return fmt.Errorf("image/dem/CNSDTF: unsupported value type: %q", p.ValueType)
+	}
+	return nil
+}
+
+// readHeader reads the "Key: Value" lines, and returns the reader of the
+// values.
+func readHeader(r io.Reader) (hdr *Header, values io.Reader, err error) {
+	br := bufio.NewReader(r)
+	hdr = new(Header)
+	var mark bool
+	for {
+		line, err := br.ReadString('\n')
+		if err != nil && (err != io.EOF || line == "") {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return nil, nil, err
+		}
+		i := strings.Index(line, ":")
+		if i < 0 {
+			if strings.TrimSpace(line) == "" {
+				continue
+			}
+			values = io.MultiReader(strings.NewReader(line), br)
+			break
+		}
+		key, value := strings.TrimSpace(line[:i]), strings.TrimSpace(line[i+1:])
+		if err = hdr.set(key, value); err != nil {
+			return nil, nil, err
+		}
+		if key == "DataMark" {
+			if value != DataMark {
+				return nil, nil, fmt.Errorf("image/dem/CNSDTF: bad DataMark: %q", value)
+			}
+			mark = true
+		}
+	}
+	if !mark {
+		return nil, nil, fmt.Errorf("image/dem/CNSDTF: missing DataMark")
+	}
+	hdr.setDefaults()
+	if err = hdr.check(); err != nil {
+		return nil, nil, err
+	}
+	return
+}
+
+func (p *Header) set(key, value string) (err error) {
+	var v float64
+	switch key {
+	case "DataMark":
+		return
+	case "Version":
+		p.Version = value
+		return
+	case "Unit":
+		p.Unit = value
+		return
+	case "ValueType":
+		p.ValueType = value
+		return
+	case "Alpha", "Compress", "X0", "Y0", "DX", "DY", "Row", "Col", "HZoom", "NoData":
+		if v, err = strconv.ParseFloat(value, 64); err != nil {
+			return fmt.Errorf("image/dem/CNSDTF: bad %s: %q", key, value)
+		}
+	default:
+		return // MinV, MaxV and the unknown keys
+	}
+	switch key {
+	case "Alpha":
+		p.Alpha = v
+	case "Compress":
+		p.Compress = int(v)
+	case "X0":
+		p.X0 = v
+	case "Y0":
+		p.Y0 = v
+	case "DX":
+		p.DX = v
+	case "DY":
+		p.DY = v
+	case "Row":
+		p.Rows = int(v)
+	case "Col":
+		p.Cols = int(v)
+	case "HZoom":
+		p.HZoom = v
+	case "NoData":
+		p.NoData = v
+	}
+	return
+}
+
+// writeHeader writes the header, min and max are the range of the values.
+func writeHeader(w io.Writer, hdr *Header, min, max float64) (err error) {
+	format := func(v float64) string {
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	}
+	lines := [][2]string{
+		{"DataMark", DataMark},
+		{"Version", hdr.Version},
+		{"Alpha", format(hdr.Alpha)},
+		{"Unit", hdr.Unit},
+		{"Compress", strconv.Itoa(hdr.Compress)},
+		{"X0", format(hdr.X0)},
+		{"Y0", format(hdr.Y0)},
+		{"DX", format(hdr.DX)},
+		{"DY", format(hdr.DY)},
+		{"Row", strconv.Itoa(hdr.Rows)},
+		{"Col", strconv.Itoa(hdr.Cols)},
+		{"ValueType", hdr.ValueType},
+		{"HZoom", format(hdr.HZoom)},
+		{"NoData", format(hdr.NoData)},
+	}
+	if min <= max {
+		lines = append(lines, [2]string{"MinV", format(min)}, [2]string{"MaxV", format(max)})
+	}
+	for _, line := range lines {
+		if _, err = fmt.Fprintf(w, "%s: %s\n", line[0], line[1]); err != nil {
+			return
+		}
+	}
+	return
+}
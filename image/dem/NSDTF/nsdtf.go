@@ -0,0 +1,312 @@
+// Copyright 2014 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package nsdtf implements the NSDTF-DEM decoder and encoder.
+//
+// NSDTF-DEM is the DEM format of the Chinese National Spatial Data
+// Transfer Format (GB/T 17798-1999). The file has a header of 12 lines,
+// "NSDTF-DEM", Version, Unit, Alpha, Compress, X0, Y0, DX, DY, Row, Col
+// and HZoom, followed by the integer values from the top row, the values
+// are the elevations multiplied by HZoom. See image/dem/CNSDTF for the
+// newer format.
+package nsdtf
+
+import (
+	"bufio"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+	"math"
+	"strconv"
+
+	image_ext "github.com/chai2010/gopkg/image"
+	color_ext "github.com/chai2010/gopkg/image/color"
+	"github.com/chai2010/gopkg/image/convert"
+)
+
+const (
+	// DataMark is the first header line of NSDTF-DEM.
+	DataMark = "NSDTF-DEM"
+	// DefaultNoData is the value of the void cells.
+	DefaultNoData = -99999
+)
+
+// Header is the header of a NSDTF-DEM file.
+type Header struct {
+	Version    string  // "1.0" if empty
+	Unit       string  // the unit of the coordinates, "M" if empty
+	Alpha      float64 // the counter-clockwise angle of the rows to the x axis in degrees
+	Compress   int     // must be 0, the compressed files are not supported
+	X0, Y0     float64 // the upper-left grid point, the center of the upper-left cell
+	DX, DY     float64 // the cell size
+	Rows, Cols int
+	HZoom      float64 // the values are the elevations multiplied by HZoom, 1 if zero
+}
+
+// GeoTransform returns the GeoTransform of the grid.
+func (p *Header) GeoTransform() image_ext.GeoTransform {
+	sin, cos := math.Sincos(p.Alpha * math.Pi / 180)
+	gt := image_ext.GeoTransform{p.X0, p.DX * cos, p.DY * sin, p.Y0, p.DX * sin, -p.DY * cos}
+	return gt.Translate(-0.5, -0.5)
+}
+
+// SetGeoTransform sets the X0, Y0, DX and DY by gt, the rotated gt is not
+// supported.
+func (p *Header) SetGeoTransform(gt image_ext.GeoTransform) error {
+	if gt[2] != 0 || gt[4] != 0 || gt[1] <= 0 || gt[5] >= 0 {
+		return fmt.Errorf("image/dem/NSDTF: Header.SetGeoTransform, unsupported transform: %v", gt)
+	}
+	p.Alpha, p.DX, p.DY = 0, gt[1], -gt[5]
+	p.X0, p.Y0 = gt.PixelToWorld(0.5, 0.5)
+	return nil
+}
+
+// Options are the encoding and decoding parameters.
+type Options struct {
+	ColorModel color.Model // convert the decoded image to ColorModel
+	Header     *Header     // the georeferencing and HZoom of Encode, may be nil
+
+	// Progress reports the progress of Encode by rows, may be nil. The
+	// encoding is canceled with image_ext.ErrCanceled if it returns false.
+	Progress image_ext.ProgressFunc
+}
+
+// readHeader reads the 12 header words.
+func readHeader(s *bufio.Scanner) (hdr *Header, err error) {
+	var words [12]string
+	for i := range words {
+		if !s.Scan() {
+			if err = s.Err(); err == nil {
+				err = io.ErrUnexpectedEOF
+			}
+			return
+		}
+		words[i] = s.Text()
+	}
+	if words[0] != DataMark {
+		err = fmt.Errorf("image/dem/NSDTF: bad DataMark: %q", words[0])
+		return
+	}
+	var v [9]float64
+	for i := range v {
+		if v[i], err = strconv.ParseFloat(words[i+3], 64); err != nil {
+			err = fmt.Errorf("image/dem/NSDTF: bad header line %d: %q", i+4, words[i+3])
+			return
+		}
+	}
+	hdr = &Header{
+		Version:  words[1],
+		Unit:     words[2],
+		Alpha:    v[0],
+		Compress: int(v[1]),
+		X0:       v[2],
+		Y0:       v[3],
+		DX:       v[4],
+		DY:       v[5],
+		Rows:     int(v[6]),
+		Cols:     int(v[7]),
+		HZoom:    v[8],
+	}
+	if hdr.HZoom == 0 {
+		hdr.HZoom = 1
+	}
+	if err = hdr.check(); err != nil {
+		return nil, err
+	}
+	return
+}
+
+func (p *Header) check() error {
+	if p.Rows <= 0 || p.Cols <= 0 || p.DX <= 0 || p.DY <= 0 {
+		return fmt.Errorf("image/dem/NSDTF: bad header: rows = %d, cols = %d, dx = %v, dy = %v",
+			p.Rows, p.Cols, p.DX, p.DY,
+		)
+	}
+	if p.Compress != 0 {
+		return fmt.Errorf("image/dem/NSDTF: unsupported compress: %d", p.Compress)
+	}
+	return nil
+}
+
+func newWordScanner(r io.Reader) *bufio.Scanner {
+	s := bufio.NewScanner(r)
+	s.Split(bufio.ScanWords)
+	return s
+}
+
+// DecodeConfig returns the color model and dimensions of a NSDTF-DEM file
+// without decoding the entire image.
+func DecodeConfig(r io.Reader) (config image.Config, err error) {
+	hdr, err := readHeader(newWordScanner(r))
+	if err != nil {
+		return
+	}
+	config = image.Config{
+		ColorModel: color_ext.Gray32fModel,
+		Width:      hdr.Cols,
+		Height:     hdr.Rows,
+	}
+	return
+}
+
+// Decode reads a NSDTF-DEM file from r and returns it as a *image.Gray32f.
+// The values are divided by HZoom, the void cells are DefaultNoData.
+func Decode(r io.Reader, opt *Options) (m image.Image, err error) {
+	if m, _, err = DecodeWithHeader(r); err != nil {
+		return
+	}
+	if opt != nil && opt.ColorModel != nil {
+		m = convert.ColorModel(m, opt.ColorModel)
+	}
+	return
+}
+
+// DecodeWithHeader reads a NSDTF-DEM file and its header from r.
+func DecodeWithHeader(r io.Reader) (m *image_ext.Gray32f, hdr *Header, err error) {
+	s := newWordScanner(r)
+	if hdr, err = readHeader(s); err != nil {
+		return
+	}
+	m = image_ext.NewGray32f(image.Rect(0, 0, hdr.Cols, hdr.Rows))
+	for y := 0; y < hdr.Rows; y++ {
+		for x := 0; x < hdr.Cols; x++ {
+			if !s.Scan() {
+				if err = s.Err(); err == nil {
+					err = io.ErrUnexpectedEOF
+				}
+				return nil, nil, fmt.Errorf("image/dem/NSDTF: Decode, %v", err)
+			}
+			v, err := strconv.ParseFloat(s.Text(), 64)
+			if err != nil {
+				return nil, nil, fmt.Errorf("image/dem/NSDTF: Decode, bad value at (%d, %d): %q", x, y, s.Text())
+			}
+			if v != DefaultNoData {
+				v /= hdr.HZoom
+			}
+			m.SetGray32f(x, y, color_ext.Gray32f{Y: float32(v)})
+		}
+	}
+	return
+}
+
+// Encode writes the image m to w in NSDTF-DEM format. The georeferencing
+// and HZoom are taken from opt.Header, and the size is taken from m. The
+// values are rounded to the integers, the NaN cells are written as
+// DefaultNoData.
+func Encode(w io.Writer, m image.Image, opt *Options) (err error) {
+	gray32f := convert.Gray32f(m)
+	b := gray32f.Bounds()
+
+	var hdr Header
+	if opt != nil && opt.Header != nil {
+		hdr = *opt.Header
+	}
+	hdr.Rows, hdr.Cols = b.Dy(), b.Dx()
+	if hdr.Version == "" {
+		hdr.Version = "1.0"
+	}
+	if hdr.Unit == "" {
+		hdr.Unit = "M"
+	}
+	if hdr.DX <= 0 || hdr.DY <= 0 {
+		hdr.DX, hdr.DY = 1, 1
+	}
+	if hdr.HZoom == 0 {
+		hdr.HZoom = 1
+	}
+	if err = hdr.check(); err != nil {
+		return
+	}
+
+	format := func(v float64) string {
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	}
+	bw := bufio.NewWriter(w)
+	for _, line := range []string{
+		DataMark, hdr.Version, hdr.Unit, format(hdr.Alpha), strconv.Itoa(hdr.Compress),
+		format(hdr.X0), format(hdr.Y0), format(hdr.DX), format(hdr.DY),
+		strconv.Itoa(hdr.Rows), strconv.Itoa(hdr.Cols), format(hdr.HZoom),
+	} {
+		if _, err = bw.WriteString(line + "\n"); err != nil {
+			return
+		}
+	}
+	var progress *image_ext.Progress
+	if opt != nil {
+		progress = image_ext.NewProgress(opt.Progress, b.Dy())
+	}
+	var buf []byte
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		buf = buf[:0]
+		for x := b.Min.X; x < b.Max.X; x++ {
+			if x > b.Min.X {
+				buf = append(buf, ' ')
+			}
+			v := float64(gray32f.Gray32fAt(x, y).Y)
+			if v != v || v == DefaultNoData {
+				v = DefaultNoData
+			} else {
+				v = math.Floor(v*hdr.HZoom + 0.5)
+			}
+			buf = strconv.AppendFloat(buf, v, 'f', -1, 64)
+		}
+		buf = append(buf, '\n')
+		if _, err = bw.Write(buf); err != nil {
+			return
+		}
+		if !progress.Step(1) {
+			return image_ext.ErrCanceled
+		}
+	}
+	return bw.Flush()
+}
+
+// newOptions converts the common options to the NSDTF options.
+func newOptions(opt *image_ext.Options) (*Options, error) {
+	var p Options
+	if ok, err := image_ext.ConvertOptions("NSDTF", opt, &p); !ok {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// newEncodeOptions converts the common options to the NSDTF options, the
+// files are always uncompressed.
+func newEncodeOptions(opt *image_ext.Options) (*Options, error) {
+	var p Options
+	ok, err := image_ext.ConvertEncodeOptions("NSDTF", opt, &p, image_ext.EncodeSupport{
+		Compression: []image_ext.Compression{image_ext.CompressionNone},
+	})
+	if !ok {
+		return nil, err
+	}
+	return &p, nil
+}
+
+func imageExtDecode(r io.Reader, opt *image_ext.Options) (image.Image, error) {
+	p, err := newOptions(opt)
+	if err != nil {
+		return nil, err
+	}
+	return Decode(r, p)
+}
+
+func imageExtEncode(w io.Writer, m image.Image, opt *image_ext.Options) error {
+	p, err := newEncodeOptions(opt)
+	if err != nil {
+		return err
+	}
+	return Encode(w, m, p)
+}
+
+func init() {
+	image_ext.RegisterFormat(image_ext.Format{
+		Name:         "NSDTF",
+		Magics:       []string{DataMark},
+		DecodeConfig: DecodeConfig,
+		Decode:       imageExtDecode,
+		Encode:       imageExtEncode,
+	})
+}
@@ -0,0 +1,97 @@
+// Copyright 2014 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package nsdtf
+
+import (
+	"bytes"
+	"image"
+	"math"
+	"strings"
+	"testing"
+
+	image_ext "github.com/chai2010/gopkg/image"
+	color_ext "github.com/chai2010/gopkg/image/color"
+)
+
+const tDem = `NSDTF-DEM
+1.0
+M
+0.000000
+0
+500002.500000
+4000097.500000
+5.000000
+5.000000
+2
+3
+10
+1005 1010 -99999
+1500 1510 1520
+`
+
+func TestDecode(t *testing.T) {
+	m, hdr, err := DecodeWithHeader(strings.NewReader(tDem))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hdr.Rows != 2 || hdr.Cols != 3 || hdr.HZoom != 10 || hdr.Unit != "M" {
+		t.Fatalf("bad header: %+v", *hdr)
+	}
+	if gt := hdr.GeoTransform(); gt != image_ext.NewGeoTransform(500000, 4000100, 5, 5) {
+		t.Fatalf("bad GeoTransform: %v", gt)
+	}
+	for i, v := range []float32{100.5, 101, DefaultNoData, 150, 151, 152} {
+		if got := m.Gray32fAt(i%3, i/3).Y; got != v {
+			t.Fatalf("%d: bad value: got %v, want %v", i, got, v)
+		}
+	}
+
+	if _, format, err := image_ext.Decode(strings.NewReader(tDem), nil); err != nil || format != "NSDTF" {
+		t.Fatalf("bad format: %q, %v", format, err)
+	}
+	if c, err := DecodeConfig(strings.NewReader(tDem)); err != nil || c.Width != 3 || c.Height != 2 {
+		t.Fatalf("bad config: %v, %v", c, err)
+	}
+	if _, err := Decode(strings.NewReader(tDem[:len(tDem)-5]), nil); err == nil {
+		t.Fatalf("short file: expect error")
+	}
+}
+
+func TestEncode(t *testing.T) {
+	m := image_ext.NewGray32f(image.Rect(0, 0, 4, 3))
+	for y := 0; y < 3; y++ {
+		for x := 0; x < 4; x++ {
+			m.SetGray32f(x, y, color_ext.Gray32f{Y: float32(x*100+y) + 0.5})
+		}
+	}
+	m.SetGray32f(1, 1, color_ext.Gray32f{Y: float32(math.NaN())})
+
+	hdr := &Header{HZoom: 10}
+	if err := hdr.SetGeoTransform(image_ext.NewGeoTransform(100, 200, 2, 2)); err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := Encode(&buf, m, &Options{Header: hdr}); err != nil {
+		t.Fatal(err)
+	}
+	got, gotHdr, err := DecodeWithHeader(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if gotHdr.GeoTransform() != image_ext.NewGeoTransform(100, 200, 2, 2) {
+		t.Fatalf("bad GeoTransform: %v", gotHdr.GeoTransform())
+	}
+	for y := 0; y < 3; y++ {
+		for x := 0; x < 4; x++ {
+			want := m.Gray32fAt(x, y).Y
+			if x == 1 && y == 1 {
+				want = DefaultNoData
+			}
+			if v := got.Gray32fAt(x, y).Y; v != want {
+				t.Fatalf("bad value at (%d, %d): got %v, want %v", x, y, v, want)
+			}
+		}
+	}
+}
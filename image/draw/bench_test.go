@@ -6,7 +6,11 @@ package draw
 
 import (
 	"image"
+	"image/draw"
 	"testing"
+
+	image_ext "github.com/chai2010/gopkg/image"
+	"github.com/chai2010/gopkg/image/convert"
 )
 
 // ----------------------------------------------------------------------------
@@ -508,6 +512,259 @@ func BenchmarkDrawPyrDown_Interlace_gray_128x128(b *testing.B) {
 	}
 }
 
+// ----------------------------------------------------------------------------
+// DrawPyrDown: parallel
+// ----------------------------------------------------------------------------
+
+func benchmarkDrawPyrDown(b *testing.B, workers int, dst, src draw.Image, filter Filter) {
+	defer func(n int) { image_ext.Workers = n }(image_ext.Workers)
+	image_ext.Workers = workers
+
+	b.SetBytes(int64(src.Bounds().Dx() * src.Bounds().Dy()))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		DrawPyrDown(dst, dst.Bounds(), src, image.Pt(0, 0), filter)
+	}
+}
+
+func BenchmarkDrawPyrDown_Average_gray_1024x1024_serial(b *testing.B) {
+	dst := image.NewGray(image.Rect(0, 0, 1024, 1024))
+	src := image.NewGray(image.Rect(0, 0, 2048, 2048))
+	benchmarkDrawPyrDown(b, 1, dst, src, Filter_Average)
+}
+
+func BenchmarkDrawPyrDown_Average_gray_1024x1024_parallel(b *testing.B) {
+	dst := image.NewGray(image.Rect(0, 0, 1024, 1024))
+	src := image.NewGray(image.Rect(0, 0, 2048, 2048))
+	benchmarkDrawPyrDown(b, 0, dst, src, Filter_Average)
+}
+
+func BenchmarkDrawPyrDown_Average_rgba_1024x1024_serial(b *testing.B) {
+	dst := image.NewRGBA(image.Rect(0, 0, 1024, 1024))
+	src := image.NewRGBA(image.Rect(0, 0, 2048, 2048))
+	benchmarkDrawPyrDown(b, 1, dst, src, Filter_Average)
+}
+
+func BenchmarkDrawPyrDown_Average_rgba_1024x1024_parallel(b *testing.B) {
+	dst := image.NewRGBA(image.Rect(0, 0, 1024, 1024))
+	src := image.NewRGBA(image.Rect(0, 0, 2048, 2048))
+	benchmarkDrawPyrDown(b, 0, dst, src, Filter_Average)
+}
+
+func BenchmarkDrawPyrDown_Lanczos_rgba_512x512_serial(b *testing.B) {
+	dst := image.NewRGBA(image.Rect(0, 0, 512, 512))
+	src := image.NewRGBA(image.Rect(0, 0, 1024, 1024))
+	benchmarkDrawPyrDown(b, 1, dst, src, Filter_Lanczos)
+}
+
+func BenchmarkDrawPyrDown_Lanczos_rgba_512x512_parallel(b *testing.B) {
+	dst := image.NewRGBA(image.Rect(0, 0, 512, 512))
+	src := image.NewRGBA(image.Rect(0, 0, 1024, 1024))
+	benchmarkDrawPyrDown(b, 0, dst, src, Filter_Lanczos)
+}
+
+// ----------------------------------------------------------------------------
+// Draw: parallel
+// ----------------------------------------------------------------------------
+
+func benchmarkDraw(b *testing.B, workers int, dst draw.Image, src image.Image) {
+	defer func(n int) { image_ext.Workers = n }(image_ext.Workers)
+	image_ext.Workers = workers
+
+	b.SetBytes(int64(dst.Bounds().Dx() * dst.Bounds().Dy()))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		Draw(dst, dst.Bounds(), src, image.Pt(0, 0))
+	}
+}
+
+func BenchmarkDraw_gray32f_rgba_1024x1024_serial(b *testing.B) {
+	dst := image_ext.NewGray32f(image.Rect(0, 0, 1024, 1024))
+	src := image.NewRGBA(image.Rect(0, 0, 1024, 1024))
+	benchmarkDraw(b, 1, dst, src)
+}
+
+func BenchmarkDraw_gray32f_rgba_1024x1024_parallel(b *testing.B) {
+	dst := image_ext.NewGray32f(image.Rect(0, 0, 1024, 1024))
+	src := image.NewRGBA(image.Rect(0, 0, 1024, 1024))
+	benchmarkDraw(b, 0, dst, src)
+}
+
+// ----------------------------------------------------------------------------
+// convert: parallel
+// ----------------------------------------------------------------------------
+
+func benchmarkConvert(b *testing.B, workers int, src image.Image, fn func(m image.Image) image.Image) {
+	defer func(n int) { image_ext.Workers = n }(image_ext.Workers)
+	image_ext.Workers = workers
+
+	b.SetBytes(int64(src.Bounds().Dx() * src.Bounds().Dy()))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		fn(src)
+	}
+}
+
+func BenchmarkConvert_YCbCr_RGB_1024x1024_serial(b *testing.B) {
+	src := image.NewYCbCr(image.Rect(0, 0, 1024, 1024), image.YCbCrSubsampleRatio420)
+	benchmarkConvert(b, 1, src, func(m image.Image) image.Image { return convert.RGB(m) })
+}
+
+func BenchmarkConvert_YCbCr_RGB_1024x1024_parallel(b *testing.B) {
+	src := image.NewYCbCr(image.Rect(0, 0, 1024, 1024), image.YCbCrSubsampleRatio420)
+	benchmarkConvert(b, 0, src, func(m image.Image) image.Image { return convert.RGB(m) })
+}
+
+func BenchmarkConvert_RGBA_Gray32f_1024x1024_serial(b *testing.B) {
+	src := image.NewRGBA(image.Rect(0, 0, 1024, 1024))
+	benchmarkConvert(b, 1, src, func(m image.Image) image.Image { return convert.Gray32f(m) })
+}
+
+func BenchmarkConvert_RGBA_Gray32f_1024x1024_parallel(b *testing.B) {
+	src := image.NewRGBA(image.Rect(0, 0, 1024, 1024))
+	benchmarkConvert(b, 0, src, func(m image.Image) image.Image { return convert.Gray32f(m) })
+}
+
+func BenchmarkConvert_RGB_RGBA_1024x1024_serial(b *testing.B) {
+	src := image_ext.NewRGB(image.Rect(0, 0, 1024, 1024))
+	benchmarkConvert(b, 1, src, func(m image.Image) image.Image { return convert.RGBA(m) })
+}
+
+func BenchmarkConvert_RGB_RGBA_1024x1024_parallel(b *testing.B) {
+	src := image_ext.NewRGB(image.Rect(0, 0, 1024, 1024))
+	benchmarkConvert(b, 0, src, func(m image.Image) image.Image { return convert.RGBA(m) })
+}
+
+func BenchmarkConvert_YCbCr_RGB48_1024x1024_serial(b *testing.B) {
+	src := image.NewYCbCr(image.Rect(0, 0, 1024, 1024), image.YCbCrSubsampleRatio420)
+	benchmarkConvert(b, 1, src, func(m image.Image) image.Image { return convert.RGB48(m) })
+}
+
+func BenchmarkConvert_YCbCr_RGB48_1024x1024_parallel(b *testing.B) {
+	src := image.NewYCbCr(image.Rect(0, 0, 1024, 1024), image.YCbCrSubsampleRatio420)
+	benchmarkConvert(b, 0, src, func(m image.Image) image.Image { return convert.RGB48(m) })
+}
+
+func BenchmarkConvert_YCbCr_RGB96f_1024x1024_serial(b *testing.B) {
+	src := image.NewYCbCr(image.Rect(0, 0, 1024, 1024), image.YCbCrSubsampleRatio420)
+	benchmarkConvert(b, 1, src, func(m image.Image) image.Image { return convert.RGB96f(m) })
+}
+
+func BenchmarkConvert_YCbCr_RGB96f_1024x1024_parallel(b *testing.B) {
+	src := image.NewYCbCr(image.Rect(0, 0, 1024, 1024), image.YCbCrSubsampleRatio420)
+	benchmarkConvert(b, 0, src, func(m image.Image) image.Image { return convert.RGB96f(m) })
+}
+
+func BenchmarkConvert_YCbCr_RGBA64_1024x1024_serial(b *testing.B) {
+	src := image.NewYCbCr(image.Rect(0, 0, 1024, 1024), image.YCbCrSubsampleRatio420)
+	benchmarkConvert(b, 1, src, func(m image.Image) image.Image { return convert.RGBA64(m) })
+}
+
+func BenchmarkConvert_YCbCr_RGBA64_1024x1024_parallel(b *testing.B) {
+	src := image.NewYCbCr(image.Rect(0, 0, 1024, 1024), image.YCbCrSubsampleRatio420)
+	benchmarkConvert(b, 0, src, func(m image.Image) image.Image { return convert.RGBA64(m) })
+}
+
+func BenchmarkConvert_YCbCr_RGBA128f_1024x1024_serial(b *testing.B) {
+	src := image.NewYCbCr(image.Rect(0, 0, 1024, 1024), image.YCbCrSubsampleRatio420)
+	benchmarkConvert(b, 1, src, func(m image.Image) image.Image { return convert.RGBA128f(m) })
+}
+
+func BenchmarkConvert_YCbCr_RGBA128f_1024x1024_parallel(b *testing.B) {
+	src := image.NewYCbCr(image.Rect(0, 0, 1024, 1024), image.YCbCrSubsampleRatio420)
+	benchmarkConvert(b, 0, src, func(m image.Image) image.Image { return convert.RGBA128f(m) })
+}
+
+func BenchmarkConvert_RGBA_Gray16s_1024x1024_serial(b *testing.B) {
+	src := image.NewRGBA(image.Rect(0, 0, 1024, 1024))
+	benchmarkConvert(b, 1, src, func(m image.Image) image.Image { return convert.Gray16s(m) })
+}
+
+func BenchmarkConvert_RGBA_Gray16s_1024x1024_parallel(b *testing.B) {
+	src := image.NewRGBA(image.Rect(0, 0, 1024, 1024))
+	benchmarkConvert(b, 0, src, func(m image.Image) image.Image { return convert.Gray16s(m) })
+}
+
+func BenchmarkConvert_RGBA_Gray32i_1024x1024_serial(b *testing.B) {
+	src := image.NewRGBA(image.Rect(0, 0, 1024, 1024))
+	benchmarkConvert(b, 1, src, func(m image.Image) image.Image { return convert.Gray32i(m) })
+}
+
+func BenchmarkConvert_RGBA_Gray32i_1024x1024_parallel(b *testing.B) {
+	src := image.NewRGBA(image.Rect(0, 0, 1024, 1024))
+	benchmarkConvert(b, 0, src, func(m image.Image) image.Image { return convert.Gray32i(m) })
+}
+
+func BenchmarkConvert_RGBA_Gray64f_1024x1024_serial(b *testing.B) {
+	src := image.NewRGBA(image.Rect(0, 0, 1024, 1024))
+	benchmarkConvert(b, 1, src, func(m image.Image) image.Image { return convert.Gray64f(m) })
+}
+
+func BenchmarkConvert_RGBA_Gray64f_1024x1024_parallel(b *testing.B) {
+	src := image.NewRGBA(image.Rect(0, 0, 1024, 1024))
+	benchmarkConvert(b, 0, src, func(m image.Image) image.Image { return convert.Gray64f(m) })
+}
+
+func BenchmarkConvert_RGBA_RGB48s_1024x1024_serial(b *testing.B) {
+	src := image.NewRGBA(image.Rect(0, 0, 1024, 1024))
+	benchmarkConvert(b, 1, src, func(m image.Image) image.Image { return convert.RGB48s(m) })
+}
+
+func BenchmarkConvert_RGBA_RGB48s_1024x1024_parallel(b *testing.B) {
+	src := image.NewRGBA(image.Rect(0, 0, 1024, 1024))
+	benchmarkConvert(b, 0, src, func(m image.Image) image.Image { return convert.RGB48s(m) })
+}
+
+func BenchmarkConvert_RGBA_RGB96i_1024x1024_serial(b *testing.B) {
+	src := image.NewRGBA(image.Rect(0, 0, 1024, 1024))
+	benchmarkConvert(b, 1, src, func(m image.Image) image.Image { return convert.RGB96i(m) })
+}
+
+func BenchmarkConvert_RGBA_RGB96i_1024x1024_parallel(b *testing.B) {
+	src := image.NewRGBA(image.Rect(0, 0, 1024, 1024))
+	benchmarkConvert(b, 0, src, func(m image.Image) image.Image { return convert.RGB96i(m) })
+}
+
+func BenchmarkConvert_RGBA_RGB192f_1024x1024_serial(b *testing.B) {
+	src := image.NewRGBA(image.Rect(0, 0, 1024, 1024))
+	benchmarkConvert(b, 1, src, func(m image.Image) image.Image { return convert.RGB192f(m) })
+}
+
+func BenchmarkConvert_RGBA_RGB192f_1024x1024_parallel(b *testing.B) {
+	src := image.NewRGBA(image.Rect(0, 0, 1024, 1024))
+	benchmarkConvert(b, 0, src, func(m image.Image) image.Image { return convert.RGB192f(m) })
+}
+
+func BenchmarkConvert_Gray32f_RGBA128f_1024x1024_serial(b *testing.B) {
+	src := image_ext.NewGray32f(image.Rect(0, 0, 1024, 1024))
+	benchmarkConvert(b, 1, src, func(m image.Image) image.Image { return convert.RGBA128f(m) })
+}
+
+func BenchmarkConvert_Gray32f_RGBA128f_1024x1024_parallel(b *testing.B) {
+	src := image_ext.NewGray32f(image.Rect(0, 0, 1024, 1024))
+	benchmarkConvert(b, 0, src, func(m image.Image) image.Image { return convert.RGBA128f(m) })
+}
+
+func BenchmarkConvert_RGB48_RGBA_1024x1024_serial(b *testing.B) {
+	src := image_ext.NewRGB48(image.Rect(0, 0, 1024, 1024))
+	benchmarkConvert(b, 1, src, func(m image.Image) image.Image { return convert.RGBA(m) })
+}
+
+func BenchmarkConvert_RGB48_RGBA_1024x1024_parallel(b *testing.B) {
+	src := image_ext.NewRGB48(image.Rect(0, 0, 1024, 1024))
+	benchmarkConvert(b, 0, src, func(m image.Image) image.Image { return convert.RGBA(m) })
+}
+
+func BenchmarkConvert_RGB96f_Gray16s_1024x1024_serial(b *testing.B) {
+	src := image_ext.NewRGB96f(image.Rect(0, 0, 1024, 1024))
+	benchmarkConvert(b, 1, src, func(m image.Image) image.Image { return convert.Gray16s(m) })
+}
+
+func BenchmarkConvert_RGB96f_Gray16s_1024x1024_parallel(b *testing.B) {
+	src := image_ext.NewRGB96f(image.Rect(0, 0, 1024, 1024))
+	benchmarkConvert(b, 0, src, func(m image.Image) image.Image { return convert.Gray16s(m) })
+}
+
 // ----------------------------------------------------------------------------
 // END
 // ----------------------------------------------------------------------------
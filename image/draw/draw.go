@@ -13,11 +13,24 @@ import (
 )
 
 // Draw aligns r.Min in dst with sp in src and then replaces the rectangle r in dst with src.
+// The nodata pixels of src are skipped if src is an image_ext.NoDataImage.
 func Draw(dst draw.Image, r image.Rectangle, src image.Image, sp image.Point) {
 	r0 := r.Intersect(dst.Bounds()).Sub(r.Min)
 	r1 := image.Rect(sp.X, sp.Y, sp.X+r.Dx(), sp.Y+r.Dy()).Intersect(src.Bounds()).Sub(sp)
 	r = r0.Intersect(r1).Add(r.Min)
 
+	min := r.Min
+	image_ext.ParallelRows(r, func(r image.Rectangle) {
+		drawRect(dst, r, src, sp.Add(r.Min.Sub(min)))
+	}, dst, src)
+}
+
+func drawRect(dst draw.Image, r image.Rectangle, src image.Image, sp image.Point) {
+	if src, ok := noDataSource(dst, src); ok {
+		drawNoData(dst, r, src, sp)
+		return
+	}
+
 	switch dst := dst.(type) {
 	case *image.Gray:
 		drawGray(dst, r, src, sp)
@@ -37,6 +50,20 @@ func Draw(dst draw.Image, r image.Rectangle, src image.Image, sp image.Point) {
 		drawRGBA64(dst, r, src, sp)
 	case *image_ext.RGBA128f:
 		drawRGBA128f(dst, r, src, sp)
+	case *image_ext.Gray16s:
+		drawGray16s(dst, r, src, sp)
+	case *image_ext.Gray32i:
+		drawGray32i(dst, r, src, sp)
+	case *image_ext.Gray64f:
+		drawGray64f(dst, r, src, sp)
+	case *image_ext.RGB48s:
+		drawRGB48s(dst, r, src, sp)
+	case *image_ext.RGB96i:
+		drawRGB96i(dst, r, src, sp)
+	case *image_ext.RGB192f:
+		drawRGB192f(dst, r, src, sp)
+	case *image_ext.MultiBand:
+		drawMultiBand(dst, r, src, sp)
 	default:
 		drawImage(dst, r, src, sp)
 	}
@@ -159,6 +186,112 @@ func drawRGBA128f(dst *image_ext.RGBA128f, r image.Rectangle, src image.Image, s
 	}
 }
 
+func drawGray16s(dst *image_ext.Gray16s, r image.Rectangle, src image.Image, sp image.Point) {
+	switch src := src.(type) {
+	case *image_ext.Gray16s:
+		for y := r.Min.Y; y < r.Max.Y; y++ {
+			off0 := dst.PixOffset(r.Min.X, y)
+			off1 := src.PixOffset(sp.X, y-r.Min.Y+sp.Y)
+			copy(dst.Pix[off0:][:r.Dx()*2], src.Pix[off1:])
+		}
+	default:
+		drawImage(dst, r, src, sp)
+	}
+}
+
+func drawGray32i(dst *image_ext.Gray32i, r image.Rectangle, src image.Image, sp image.Point) {
+	switch src := src.(type) {
+	case *image_ext.Gray32i:
+		for y := r.Min.Y; y < r.Max.Y; y++ {
+			off0 := dst.PixOffset(r.Min.X, y)
+			off1 := src.PixOffset(sp.X, y-r.Min.Y+sp.Y)
+			copy(dst.Pix[off0:][:r.Dx()*4], src.Pix[off1:])
+		}
+	default:
+		drawImage(dst, r, src, sp)
+	}
+}
+
+func drawGray64f(dst *image_ext.Gray64f, r image.Rectangle, src image.Image, sp image.Point) {
+	switch src := src.(type) {
+	case *image_ext.Gray64f:
+		for y := r.Min.Y; y < r.Max.Y; y++ {
+			off0 := dst.PixOffset(r.Min.X, y)
+			off1 := src.PixOffset(sp.X, y-r.Min.Y+sp.Y)
+			copy(dst.Pix[off0:][:r.Dx()*8], src.Pix[off1:])
+		}
+	default:
+		drawImage(dst, r, src, sp)
+	}
+}
+
+func drawRGB48s(dst *image_ext.RGB48s, r image.Rectangle, src image.Image, sp image.Point) {
+	switch src := src.(type) {
+	case *image_ext.RGB48s:
+		for y := r.Min.Y; y < r.Max.Y; y++ {
+			off0 := dst.PixOffset(r.Min.X, y)
+			off1 := src.PixOffset(sp.X, y-r.Min.Y+sp.Y)
+			copy(dst.Pix[off0:][:r.Dx()*6], src.Pix[off1:])
+		}
+	default:
+		drawImage(dst, r, src, sp)
+	}
+}
+
+func drawRGB96i(dst *image_ext.RGB96i, r image.Rectangle, src image.Image, sp image.Point) {
+	switch src := src.(type) {
+	case *image_ext.RGB96i:
+		for y := r.Min.Y; y < r.Max.Y; y++ {
+			off0 := dst.PixOffset(r.Min.X, y)
+			off1 := src.PixOffset(sp.X, y-r.Min.Y+sp.Y)
+			copy(dst.Pix[off0:][:r.Dx()*12], src.Pix[off1:])
+		}
+	default:
+		drawImage(dst, r, src, sp)
+	}
+}
+
+func drawRGB192f(dst *image_ext.RGB192f, r image.Rectangle, src image.Image, sp image.Point) {
+	switch src := src.(type) {
+	case *image_ext.RGB192f:
+		for y := r.Min.Y; y < r.Max.Y; y++ {
+			off0 := dst.PixOffset(r.Min.X, y)
+			off1 := src.PixOffset(sp.X, y-r.Min.Y+sp.Y)
+			copy(dst.Pix[off0:][:r.Dx()*24], src.Pix[off1:])
+		}
+	default:
+		drawImage(dst, r, src, sp)
+	}
+}
+
+func drawMultiBand(dst *image_ext.MultiBand, r image.Rectangle, src image.Image, sp image.Point) {
+	switch src := src.(type) {
+	case *image_ext.MultiBand:
+		if dst.Model.SameLayout(src.Model) {
+			n := dst.Model.PixelSize()
+			for y := r.Min.Y; y < r.Max.Y; y++ {
+				off0 := dst.PixOffset(r.Min.X, y, 0)
+				off1 := src.PixOffset(sp.X, y-r.Min.Y+sp.Y, 0)
+				copy(dst.Pix[off0:][:r.Dx()*n], src.Pix[off1:])
+			}
+			return
+		}
+		bands := len(dst.Model.Band)
+		if len(src.Model.Band) < bands {
+			bands = len(src.Model.Band)
+		}
+		for y := r.Min.Y; y < r.Max.Y; y++ {
+			for x := r.Min.X; x < r.Max.X; x++ {
+				for k := 0; k < bands; k++ {
+					dst.SetValue(x, y, k, src.Value(x-r.Min.X+sp.X, y-r.Min.Y+sp.Y, k))
+				}
+			}
+		}
+	default:
+		drawImage(dst, r, src, sp)
+	}
+}
+
 func drawYCbCr(dst *yCbCr, r image.Rectangle, src image.Image, sp image.Point) {
 	drawImage(dst, r, src, sp)
 }
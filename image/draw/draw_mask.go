@@ -0,0 +1,143 @@
+// Copyright 2014 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package draw
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+
+	color_ext "github.com/chai2010/gopkg/image/color"
+)
+
+// Op is a Porter-Duff compositing operator or a blend mode of DrawMask.
+type Op int
+
+const (
+	Op_Over     Op = iota // src over dst
+	Op_Src                // src replaces dst
+	Op_Multiply           // src multiplies dst, then over dst
+	Op_Screen             // src screens dst, then over dst
+)
+
+// DrawMask aligns r.Min in dst with sp in src and mp in mask and then
+// composites the rectangle r in dst with src by the operator op. A nil
+// mask is fully opaque.
+//
+// The colors are alpha-premultiplied. The float and signed types keep
+// their native values, so the float values are not clamped; the types
+// without alpha are fully opaque.
+func DrawMask(
+	dst draw.Image, r image.Rectangle, src image.Image, sp image.Point,
+	mask image.Image, mp image.Point, op Op,
+) {
+	orig := r.Min
+	r = r.Intersect(dst.Bounds())
+	r = r.Intersect(src.Bounds().Add(orig.Sub(sp)))
+	if mask != nil {
+		r = r.Intersect(mask.Bounds().Add(orig.Sub(mp)))
+	}
+	if r.Empty() {
+		return
+	}
+	sp = sp.Add(r.Min.Sub(orig))
+	mp = mp.Add(r.Min.Sub(orig))
+	if op == Op_Src && mask == nil {
+		Draw(dst, r, src, sp)
+		return
+	}
+
+	nodata, _ := noDataSource(dst, src)
+	proto := dst.ColorModel().Convert(color.Black)
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			sx, sy := x-r.Min.X+sp.X, y-r.Min.Y+sp.Y
+			if nodata != nil && nodata.IsNoData(sx, sy) {
+				continue
+			}
+			m := 1.0
+			if mask != nil {
+				_, _, _, ma := mask.At(x-r.Min.X+mp.X, y-r.Min.Y+mp.Y).RGBA()
+				if m = float64(ma) / 0xffff; m == 0 {
+					continue
+				}
+			}
+			s := premulValues(src.At(sx, sy))
+			for i := range s {
+				s[i] *= m
+			}
+			d := premulValues(dst.At(x, y))
+			dst.Set(x, y, newPremulColor(proto, composite(d, s, m, op)))
+		}
+	}
+}
+
+// composite returns the composited color of the dst color d and the src
+// color s, which has been multiplied by the mask value m.
+func composite(d, s [4]float64, m float64, op Op) (v [4]float64) {
+	const M = 0xffff
+	sa, da := s[3]/M, d[3]/M
+	switch op {
+	case Op_Src:
+		for i := range v {
+			v[i] = s[i] + d[i]*(1-m)
+		}
+	case Op_Multiply:
+		for i := 0; i < 3; i++ {
+			v[i] = s[i]*d[i]/M + s[i]*(1-da) + d[i]*(1-sa)
+		}
+		v[3] = s[3] + d[3]*(1-sa)
+	case Op_Screen:
+		for i := 0; i < 3; i++ {
+			v[i] = s[i] + d[i] - s[i]*d[i]/M
+		}
+		v[3] = s[3] + d[3]*(1-sa)
+	default: // Op_Over
+		for i := range v {
+			v[i] = s[i] + d[i]*(1-sa)
+		}
+	}
+	return
+}
+
+// premulValues returns the alpha-premultiplied red, green, blue and alpha
+// values of c in [0, 0xffff], the float and signed colors keep their values.
+func premulValues(c color.Color) (v [4]float64) {
+	v, n := colorValues(c)
+	switch n {
+	case 1:
+		v = [4]float64{v[0], v[0], v[0], 0xffff}
+	case 3:
+		v[3] = 0xffff
+	}
+	return
+}
+
+// newPremulColor returns a color of the same type as proto with the
+// alpha-premultiplied values v, see premulValues.
+func newPremulColor(proto color.Color, v [4]float64) color.Color {
+	_, n := colorValues(proto)
+	switch proto.(type) {
+	case color_ext.Gray32f, color_ext.Gray16s, color_ext.Gray32i, color_ext.Gray64f,
+		color_ext.RGB96f, color_ext.RGB48s, color_ext.RGB96i, color_ext.RGB192f,
+		color_ext.RGBA128f:
+		if n == 1 {
+			v[0] = (299*v[0] + 587*v[1] + 114*v[2]) / 1000
+		}
+		if min, max, isInt := colorRange(proto); isInt {
+			for i := 0; i < n; i++ {
+				v[i] = clampRoundRange(v[i], min, max)
+			}
+		}
+		return newColorLike(proto, v)
+	}
+	a := clampRound(v[3], 0xffff)
+	return color.RGBA64{
+		R: uint16(clampRound(v[0], a)),
+		G: uint16(clampRound(v[1], a)),
+		B: uint16(clampRound(v[2], a)),
+		A: uint16(a),
+	}
+}
@@ -0,0 +1,120 @@
+// Copyright 2014 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package draw
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"testing"
+
+	image_ext "github.com/chai2010/gopkg/image"
+	color_ext "github.com/chai2010/gopkg/image/color"
+)
+
+func TestDrawMask(t *testing.T) {
+	const M = 0xffff
+	half := image.NewUniform(color.Alpha16{A: 0x8000})
+	for i, v := range []struct {
+		Dst      draw.Image
+		DstColor color.Color
+		Src      color.Color
+		Mask     image.Image
+		Op       Op
+		Want     color.Color
+	}{
+		// Over, the float values are not clamped
+		{
+			image_ext.NewRGBA128f(image.Rect(0, 0, 4, 4)), color_ext.RGBA128f{A: M},
+			color_ext.RGBA128f{R: 0x8000, G: 0x4000, B: 100000, A: 0x8000}, nil, Op_Over,
+			color_ext.RGBA128f{R: 0x8000, G: 0x4000, B: 100000, A: M},
+		},
+		{
+			image_ext.NewRGB96f(image.Rect(0, 0, 4, 4)), color_ext.RGB96f{R: 1000, G: 1000, B: 1000},
+			color_ext.RGBA128f{R: 0, G: 0, B: 0, A: 0x8000}, nil, Op_Over,
+			color_ext.RGB96f{R: 1000 * (1 - 0x8000/float32(M)), G: 1000 * (1 - 0x8000/float32(M)), B: 1000 * (1 - 0x8000/float32(M))},
+		},
+		// Src with mask
+		{
+			image.NewGray(image.Rect(0, 0, 4, 4)), color.Gray{Y: 100},
+			color.Gray{Y: 200}, half, Op_Src,
+			color.Gray{Y: 150},
+		},
+		// Multiply and Screen
+		{
+			image_ext.NewGray32f(image.Rect(0, 0, 4, 4)), color_ext.Gray32f{Y: M / 2},
+			color_ext.Gray32f{Y: M / 4}, nil, Op_Multiply,
+			color_ext.Gray32f{Y: float32(M/2) * float32(M/4) / M},
+		},
+		{
+			image_ext.NewRGB(image.Rect(0, 0, 4, 4)), color_ext.RGB{R: 0x80, G: 0, B: 0xff},
+			color_ext.RGB{R: 0x80, G: 0x80, B: 0x80}, nil, Op_Screen,
+			color_ext.RGB{R: 0xc0, G: 0x80, B: 0xff},
+		},
+		// signed values
+		{
+			image_ext.NewGray16s(image.Rect(0, 0, 4, 4)), color_ext.Gray16s{Y: -100},
+			color_ext.Gray16s{Y: -300}, half, Op_Src,
+			color_ext.Gray16s{Y: -200},
+		},
+	} {
+		tClearImage(v.Dst, v.DstColor)
+		src := image.NewUniform(v.Src)
+		DrawMask(v.Dst, image.Rect(1, 1, 3, 3), src, image.ZP, v.Mask, image.ZP, v.Op)
+		if err := tCheckImageColorNear(v.Dst, image.Rect(1, 1, 3, 3), v.Want, v.DstColor); err != nil {
+			t.Fatalf("%d: %v", i, err)
+		}
+	}
+}
+
+func TestDrawMask_RGBA(t *testing.T) {
+	// the same as the standard Over operator
+	dst0 := image.NewRGBA(image.Rect(0, 0, 16, 16))
+	dst1 := image.NewRGBA(image.Rect(0, 0, 16, 16))
+	src := image.NewRGBA(image.Rect(0, 0, 16, 16))
+	mask := image.NewAlpha(image.Rect(0, 0, 16, 16))
+	for i := range src.Pix {
+		dst0.Pix[i] = uint8(i * 7)
+		src.Pix[i] = uint8(i * 13)
+		if i%4 == 3 {
+			dst0.Pix[i], src.Pix[i] = 0xff, 0xff-uint8(i)
+		}
+		mask.Pix[i/4] = uint8(i * 5)
+	}
+	for i := range src.Pix {
+		if i%4 != 3 && src.Pix[i] > src.Pix[i|3] {
+			src.Pix[i] = src.Pix[i|3]
+		}
+	}
+	copy(dst1.Pix, dst0.Pix)
+	draw.DrawMask(dst0, dst0.Bounds(), src, image.ZP, mask, image.ZP, draw.Over)
+	DrawMask(dst1, dst1.Bounds(), src, image.ZP, mask, image.ZP, Op_Over)
+	for i := range dst0.Pix {
+		if d := int(dst0.Pix[i]) - int(dst1.Pix[i]); d < -1 || d > 1 {
+			t.Fatalf("pix %d: got %d, want %d", i, dst1.Pix[i], dst0.Pix[i])
+		}
+	}
+}
+
+func tCheckImageColorNear(m draw.Image, fgdRect image.Rectangle, fgdColor, bgdColor color.Color) error {
+	b := m.Bounds()
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			want := bgdColor
+			if image.Pt(x, y).In(fgdRect) {
+				want = fgdColor
+			}
+			v0, n := colorValues(m.ColorModel().Convert(want))
+			v1, _ := colorValues(m.At(x, y))
+			for i := 0; i < n; i++ {
+				if d := v0[i] - v1[i]; d < -0.5 || d > 0.5 {
+					return fmt.Errorf("pixel(%d, %d): want %v, got %v", x, y, want, m.At(x, y))
+				}
+			}
+		}
+	}
+	return nil
+}
@@ -11,22 +11,103 @@ import (
 	image_ext "github.com/chai2010/gopkg/image"
 )
 
+// Filter is the resampling filter of DrawPyrDown and Resize.
 type Filter int
 
 const (
-	Filter_Average Filter = iota
-	Filter_Interlace
+	Filter_Average   Filter = iota // box filter, average of the covered pixels
+	Filter_Interlace               // top-left pixel, fastest
+	Filter_Nearest                 // nearest pixel of the center
+	Filter_Bilinear                // triangle filter
+	Filter_Gaussian                // Gaussian filter, sigma = 0.5
+	Filter_Lanczos                 // Lanczos filter, a = 3, sharpest
 )
 
 // DrawPyrDown aligns r.Min in dst with sp in src and then replaces
 // the rectangle r in dst with downsamples src.
+//
+// If src is an image_ext.NoDataImage, the nodata pixels are ignored, and
+// the dst pixel is set to nodata if all the source pixels are nodata.
 func DrawPyrDown(
 	dst draw.Image, r image.Rectangle, src image.Image, sp image.Point,
 	filter Filter,
 ) {
+	r = pyrDownRect(dst, r, src, sp)
+	if !isResampleFilter(dst, src, filter) {
+		min := r.Min
+		image_ext.ParallelRows(r, func(r image.Rectangle) {
+			drawPyrDown(dst, r, src, sp.Add(r.Min.Sub(min).Mul(2)), filter)
+		}, dst, src)
+		return
+	}
+
+	// Nearest, Bilinear, Gaussian and Lanczos
+	sr := image.Rect(sp.X, sp.Y, sp.X+r.Dx()*2, sp.Y+r.Dy()*2).Intersect(src.Bounds())
+	resample(dst, r, src, sr, 2, 2, filter)
+}
+
+// pyrDownRect returns the part of r which DrawPyrDown draws.
+func pyrDownRect(dst draw.Image, r image.Rectangle, src image.Image, sp image.Point) image.Rectangle {
 	r0 := r.Intersect(dst.Bounds()).Sub(r.Min)
 	r1 := image.Rect(sp.X, sp.Y, sp.X+r.Dx()*2, sp.Y+r.Dy()*2).Intersect(src.Bounds()).Sub(sp)
-	r = r0.Intersect(image.Rect(0, 0, (r1.Max.X+1)/2, (r1.Max.Y+1)/2)).Add(r.Min)
+	return r0.Intersect(image.Rect(0, 0, (r1.Max.X+1)/2, (r1.Max.Y+1)/2)).Add(r.Min)
+}
+
+// isResampleFilter reports whether DrawPyrDown draws with resample, the
+// nodata pixels are only ignored by drawPyrDown.
+func isResampleFilter(dst draw.Image, src image.Image, filter Filter) bool {
+	if _, ok := noDataSource(dst, src); ok {
+		return false
+	}
+	return filter != Filter_Average && filter != Filter_Interlace
+}
+
+// pyrDownProgressRows is the number of the dst rows of a step of
+// DrawPyrDownProgress.
+const pyrDownProgressRows = 64
+
+// DrawPyrDownProgress is like DrawPyrDown, but it draws the rows of r in
+// bands, reports the progress to fn after each band, and returns
+// image_ext.ErrCanceled if fn returns false. The bands drawn before the
+// cancellation are kept.
+//
+// The Nearest, Bilinear, Gaussian and Lanczos filters read the source rows
+// around a band within the support of the filter, so the bands are the
+// same as the rows drawn by DrawPyrDown in one step.
+func DrawPyrDownProgress(
+	dst draw.Image, r image.Rectangle, src image.Image, sp image.Point,
+	filter Filter, fn image_ext.ProgressFunc,
+) error {
+	var wy []resampleWeight
+	var sr image.Rectangle
+	if isResampleFilter(dst, src, filter) {
+		r0 := pyrDownRect(dst, r, src, sp)
+		sp, r = sp.Add(r0.Min.Sub(r.Min).Mul(2)), r0
+		sr = image.Rect(sp.X, sp.Y, sp.X+r.Dx()*2, sp.Y+r.Dy()*2).Intersect(src.Bounds())
+		wy = makeResampleWeights(r.Dy(), sr.Dy(), 2, filter)
+	}
+
+	rows := pyrDownProgressRows
+	progress := image_ext.NewProgress(fn, (r.Dy()+rows-1)/rows)
+	for y := r.Min.Y; y < r.Max.Y; y += rows {
+		band := image.Rect(r.Min.X, y, r.Max.X, y+rows).Intersect(r)
+		if wy != nil {
+			resampleRows(dst, r, src, sr, 2, wy, filter, band.Min.Y, band.Max.Y)
+		} else {
+			DrawPyrDown(dst, band, src, sp.Add(image.Pt(0, (y-r.Min.Y)*2)), filter)
+		}
+		if !progress.Step(1) {
+			return image_ext.ErrCanceled
+		}
+	}
+	return nil
+}
+
+func drawPyrDown(dst draw.Image, r image.Rectangle, src image.Image, sp image.Point, filter Filter) {
+	if src, ok := noDataSource(dst, src); ok {
+		drawPyrDownNoData(dst, r, src, sp, filter)
+		return
+	}
 
 	switch filter {
 	case Filter_Average:
@@ -58,6 +139,9 @@ func DrawPyrDown(
 		case *image_ext.RGBA128f:
 			drawPyrDownRGBA128f_Average(dst, r, src, sp)
 			return
+		case *image_ext.MultiBand:
+			drawPyrDownMultiBand_Average(dst, r, src, sp)
+			return
 		default:
 			drawPyrDown_Average(dst, r, src, sp)
 			return
@@ -91,6 +175,9 @@ func DrawPyrDown(
 		case *image_ext.RGBA128f:
 			drawPyrDownRGBA128f_Interlace(dst, r, src, sp)
 			return
+		case *image_ext.MultiBand:
+			drawPyrDownMultiBand_Interlace(dst, r, src, sp)
+			return
 		default:
 			drawPyrDown_Interlace(dst, r, src, sp)
 			return
@@ -331,6 +331,48 @@ func drawPyrDownRGBA128f_Average(dst *image_ext.RGBA128f, r image.Rectangle, src
 	}
 }
 
+func drawPyrDownMultiBand_Average(dst *image_ext.MultiBand, r image.Rectangle, src image.Image, sp image.Point) {
+	switch src := src.(type) {
+	case *image_ext.MultiBand:
+		bands := len(dst.Model.Band)
+		if len(src.Model.Band) < bands {
+			bands = len(src.Model.Band)
+		}
+		b := src.Bounds()
+		for y := r.Min.Y; y < r.Max.Y; y++ {
+			for x := r.Min.X; x < r.Max.X; x++ {
+				x0 := (x-r.Min.X)*2 + sp.X
+				y0 := (y-r.Min.Y)*2 + sp.Y
+
+				// average the valid samples, skip the nodata values
+				for k := 0; k < bands; k++ {
+					var sum float64
+					var n int
+					for _, pt := range [4]image.Point{{x0, y0}, {x0, y0 + 1}, {x0 + 1, y0 + 1}, {x0 + 1, y0}} {
+						if !pt.In(b) {
+							continue
+						}
+						if v := src.Value(pt.X, pt.Y, k); !src.Model.Band[k].IsNoData(v) {
+							sum += v
+							n++
+						}
+					}
+					switch {
+					case n > 0:
+						dst.SetValue(x, y, k, sum/float64(n))
+					case dst.Model.Band[k].HasNoData:
+						dst.SetValue(x, y, k, dst.Model.Band[k].NoData)
+					default:
+						dst.SetValue(x, y, k, 0)
+					}
+				}
+			}
+		}
+	default:
+		drawPyrDown_Average(dst, r, src, sp)
+	}
+}
+
 func drawPyrDownYCbCr_Average(dst *yCbCr, r image.Rectangle, src image.Image, sp image.Point) {
 	drawPyrDown_Average(dst, r, src, sp)
 }
@@ -155,6 +155,28 @@ func drawPyrDownRGBA128f_Interlace(dst *image_ext.RGBA128f, r image.Rectangle, s
 	}
 }
 
+func drawPyrDownMultiBand_Interlace(dst *image_ext.MultiBand, r image.Rectangle, src image.Image, sp image.Point) {
+	switch src := src.(type) {
+	case *image_ext.MultiBand:
+		bands := len(dst.Model.Band)
+		if len(src.Model.Band) < bands {
+			bands = len(src.Model.Band)
+		}
+		for y := r.Min.Y; y < r.Max.Y; y++ {
+			for x := r.Min.X; x < r.Max.X; x++ {
+				x0 := (x-r.Min.X)*2 + sp.X
+				y0 := (y-r.Min.Y)*2 + sp.Y
+
+				for k := 0; k < bands; k++ {
+					dst.SetValue(x, y, k, src.Value(x0, y0, k))
+				}
+			}
+		}
+	default:
+		drawPyrDown_Interlace(dst, r, src, sp)
+	}
+}
+
 func drawPyrDownYCbCr_Interlace(dst *yCbCr, r image.Rectangle, src image.Image, sp image.Point) {
 	drawPyrDown_Interlace(dst, r, src, sp)
 }
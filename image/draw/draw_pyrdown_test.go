@@ -5,6 +5,7 @@
 package draw
 
 import (
+	"bytes"
 	"image"
 	"image/color"
 	"image/draw"
@@ -48,6 +49,51 @@ func TestDrawPyrDown_Interlace(t *testing.T) {
 	}
 }
 
+func TestDrawPyrDownProgress(t *testing.T) {
+	src := image.NewGray(image.Rect(0, 0, 300, 301))
+	for y := 0; y < 301; y++ {
+		for x := 0; x < 300; x++ {
+			src.SetGray(x, y, color.Gray{uint8(x*7 + y*13)})
+		}
+	}
+	r := image.Rect(5, 3, 150, 151)
+	for i, filter := range []Filter{
+		Filter_Average, Filter_Interlace,
+		Filter_Nearest, Filter_Bilinear, Filter_Gaussian, Filter_Lanczos,
+	} {
+		m0 := image.NewGray(image.Rect(0, 0, 160, 160))
+		m1 := image.NewGray(image.Rect(0, 0, 160, 160))
+		DrawPyrDown(m0, r, src, image.Pt(0, 1), filter)
+		var last float64
+		var steps int
+		err := DrawPyrDownProgress(m1, r, src, image.Pt(0, 1), filter, func(done float64) bool {
+			if done <= last {
+				t.Errorf("%d: bad progress, %v after %v", i, done, last)
+			}
+			last = done
+			steps++
+			return true
+		})
+		if err != nil || last != 1 || steps != 3 {
+			t.Fatalf("%d: err = %v, progress = %v, steps = %d", i, err, last, steps)
+		}
+		if !bytes.Equal(m0.Pix, m1.Pix) {
+			t.Fatalf("%d: DrawPyrDownProgress and DrawPyrDown differ", i)
+		}
+
+		m := image.NewGray(image.Rect(0, 0, 160, 160))
+		err = DrawPyrDownProgress(m, r, src, image.Pt(0, 1), filter, func(done float64) bool {
+			return false
+		})
+		if err != image_ext.ErrCanceled {
+			t.Fatalf("%d: expect ErrCanceled, got %v", i, err)
+		}
+		if m.GrayAt(5, 3).Y == 0 || m.GrayAt(5, 3+pyrDownProgressRows).Y != 0 {
+			t.Fatalf("%d: bad rows after the cancellation", i)
+		}
+	}
+}
+
 var tDrawPyrDownTesterList = []tDrawPyrDownTester{
 	// Gray
 	tDrawPyrDownTester{
@@ -377,4 +423,16 @@ var tDrawPyrDownTesterList = []tDrawPyrDownTester{
 		DrawSp:   image.Pt(6, 6),           // +overflow
 		FgdRect:  image.Rect(0, 0, 1, 1),
 	},
+	// Paletted, the palettes are not comparable
+	tDrawPyrDownTester{
+		BgdImage: image.NewPaletted(image.Rect(0, 0, 10, 10), tPalette),
+		BgdColor: color.Gray{100},
+		FgdImage: image.NewPaletted(image.Rect(0, 0, 10, 10), tPalette),
+		FgdColor: color.Gray{250},
+		DrawRect: image.Rect(0, 0, 10, 10),
+		DrawSp:   image.Pt(0, 0),
+		FgdRect:  image.Rect(0, 0, 5, 5),
+	},
 }
+
+var tPalette = color.Palette{color.Gray{100}, color.Gray{250}}
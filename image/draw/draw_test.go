@@ -390,4 +390,118 @@ var tDrawTesterList = []tDrawTester{
 		DrawSp:   image.Pt(5, 5),           // +overflow
 		FgdRect:  image.Rect(0, 0, 3, 3),
 	},
+	// Gray16s
+	tDrawTester{
+		BgdImage: image_ext.NewGray16s(image.Rect(0, 0, 10, 10)),
+		BgdColor: color_ext.Gray16s{Y: 100},
+		FgdImage: image_ext.NewGray16s(image.Rect(0, 0, 10, 10)),
+		FgdColor: color_ext.Gray16s{Y: 250},
+		DrawRect: image.Rect(0, 0, 5, 5),
+		DrawSp:   image.Pt(0, 0),
+		FgdRect:  image.Rect(0, 0, 5, 5),
+	},
+	tDrawTester{
+		BgdImage: image_ext.NewGray16s(image.Rect(0, 0, 10, 10)),
+		BgdColor: color_ext.Gray16s{Y: 100},
+		FgdImage: image_ext.NewGray16s(image.Rect(0, 0, 8, 8)),
+		FgdColor: color_ext.Gray16s{Y: 250},
+		DrawRect: image.Rect(0, 0, 15, 15), // +overflow
+		DrawSp:   image.Pt(5, 5),           // +overflow
+		FgdRect:  image.Rect(0, 0, 3, 3),
+	},
+	// Gray32i
+	tDrawTester{
+		BgdImage: image_ext.NewGray32i(image.Rect(0, 0, 10, 10)),
+		BgdColor: color_ext.Gray32i{Y: 100 << 8},
+		FgdImage: image_ext.NewGray32i(image.Rect(0, 0, 10, 10)),
+		FgdColor: color_ext.Gray32i{Y: 250 << 8},
+		DrawRect: image.Rect(0, 0, 5, 5),
+		DrawSp:   image.Pt(0, 0),
+		FgdRect:  image.Rect(0, 0, 5, 5),
+	},
+	tDrawTester{
+		BgdImage: image_ext.NewGray32i(image.Rect(0, 0, 10, 10)),
+		BgdColor: color_ext.Gray32i{Y: 100 << 8},
+		FgdImage: image_ext.NewGray32i(image.Rect(0, 0, 8, 8)),
+		FgdColor: color_ext.Gray32i{Y: 250 << 8},
+		DrawRect: image.Rect(0, 0, 15, 15), // +overflow
+		DrawSp:   image.Pt(5, 5),           // +overflow
+		FgdRect:  image.Rect(0, 0, 3, 3),
+	},
+	// Gray64f
+	tDrawTester{
+		BgdImage: image_ext.NewGray64f(image.Rect(0, 0, 10, 10)),
+		BgdColor: color_ext.Gray64f{Y: 100 << 8},
+		FgdImage: image_ext.NewGray64f(image.Rect(0, 0, 10, 10)),
+		FgdColor: color_ext.Gray64f{Y: 250 << 8},
+		DrawRect: image.Rect(0, 0, 5, 5),
+		DrawSp:   image.Pt(0, 0),
+		FgdRect:  image.Rect(0, 0, 5, 5),
+	},
+	tDrawTester{
+		BgdImage: image_ext.NewGray64f(image.Rect(0, 0, 10, 10)),
+		BgdColor: color_ext.Gray64f{Y: 100 << 8},
+		FgdImage: image_ext.NewGray64f(image.Rect(0, 0, 8, 8)),
+		FgdColor: color_ext.Gray64f{Y: 250 << 8},
+		DrawRect: image.Rect(0, 0, 15, 15), // +overflow
+		DrawSp:   image.Pt(5, 5),           // +overflow
+		FgdRect:  image.Rect(0, 0, 3, 3),
+	},
+	// RGB48s
+	tDrawTester{
+		BgdImage: image_ext.NewRGB48s(image.Rect(0, 0, 10, 10)),
+		BgdColor: color_ext.RGB48s{R: 100, G: 100, B: 100},
+		FgdImage: image_ext.NewRGB48s(image.Rect(0, 0, 10, 10)),
+		FgdColor: color_ext.RGB48s{R: 250, G: 250, B: 250},
+		DrawRect: image.Rect(0, 0, 5, 5),
+		DrawSp:   image.Pt(0, 0),
+		FgdRect:  image.Rect(0, 0, 5, 5),
+	},
+	tDrawTester{
+		BgdImage: image_ext.NewRGB48s(image.Rect(0, 0, 10, 10)),
+		BgdColor: color_ext.RGB48s{R: 100, G: 100, B: 100},
+		FgdImage: image_ext.NewRGB48s(image.Rect(0, 0, 8, 8)),
+		FgdColor: color_ext.RGB48s{R: 250, G: 250, B: 250},
+		DrawRect: image.Rect(0, 0, 15, 15), // +overflow
+		DrawSp:   image.Pt(5, 5),           // +overflow
+		FgdRect:  image.Rect(0, 0, 3, 3),
+	},
+	// RGB96i
+	tDrawTester{
+		BgdImage: image_ext.NewRGB96i(image.Rect(0, 0, 10, 10)),
+		BgdColor: color_ext.RGB96i{R: 100 << 8, G: 100 << 8, B: 100 << 8},
+		FgdImage: image_ext.NewRGB96i(image.Rect(0, 0, 10, 10)),
+		FgdColor: color_ext.RGB96i{R: 250 << 8, G: 250 << 8, B: 250 << 8},
+		DrawRect: image.Rect(0, 0, 5, 5),
+		DrawSp:   image.Pt(0, 0),
+		FgdRect:  image.Rect(0, 0, 5, 5),
+	},
+	tDrawTester{
+		BgdImage: image_ext.NewRGB96i(image.Rect(0, 0, 10, 10)),
+		BgdColor: color_ext.RGB96i{R: 100 << 8, G: 100 << 8, B: 100 << 8},
+		FgdImage: image_ext.NewRGB96i(image.Rect(0, 0, 8, 8)),
+		FgdColor: color_ext.RGB96i{R: 250 << 8, G: 250 << 8, B: 250 << 8},
+		DrawRect: image.Rect(0, 0, 15, 15), // +overflow
+		DrawSp:   image.Pt(5, 5),           // +overflow
+		FgdRect:  image.Rect(0, 0, 3, 3),
+	},
+	// RGB192f
+	tDrawTester{
+		BgdImage: image_ext.NewRGB192f(image.Rect(0, 0, 10, 10)),
+		BgdColor: color_ext.RGB192f{R: 100 << 8, G: 100 << 8, B: 100 << 8},
+		FgdImage: image_ext.NewRGB192f(image.Rect(0, 0, 10, 10)),
+		FgdColor: color_ext.RGB192f{R: 250 << 8, G: 250 << 8, B: 250 << 8},
+		DrawRect: image.Rect(0, 0, 5, 5),
+		DrawSp:   image.Pt(0, 0),
+		FgdRect:  image.Rect(0, 0, 5, 5),
+	},
+	tDrawTester{
+		BgdImage: image_ext.NewRGB192f(image.Rect(0, 0, 10, 10)),
+		BgdColor: color_ext.RGB192f{R: 100 << 8, G: 100 << 8, B: 100 << 8},
+		FgdImage: image_ext.NewRGB192f(image.Rect(0, 0, 8, 8)),
+		FgdColor: color_ext.RGB192f{R: 250 << 8, G: 250 << 8, B: 250 << 8},
+		DrawRect: image.Rect(0, 0, 15, 15), // +overflow
+		DrawSp:   image.Pt(5, 5),           // +overflow
+		FgdRect:  image.Rect(0, 0, 3, 3),
+	},
 }
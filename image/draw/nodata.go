@@ -0,0 +1,154 @@
+// Copyright 2014 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package draw
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+
+	image_ext "github.com/chai2010/gopkg/image"
+	color_ext "github.com/chai2010/gopkg/image/color"
+)
+
+// noDataSource returns src as a NoDataImage if it may have nodata pixels.
+// The MultiBand to MultiBand drawing handles the nodata values per band.
+func noDataSource(dst draw.Image, src image.Image) (image_ext.NoDataImage, bool) {
+	m, ok := src.(image_ext.NoDataImage)
+	if !ok || !m.HasNoData() {
+		return nil, false
+	}
+	if _, ok := dst.(*image_ext.MultiBand); ok {
+		if _, ok := src.(*image_ext.MultiBand); ok {
+			return nil, false
+		}
+	}
+	return m, true
+}
+
+// drawNoData draws the valid pixels of src, the nodata pixels are skipped.
+func drawNoData(dst draw.Image, r image.Rectangle, src image_ext.NoDataImage, sp image.Point) {
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			x0, y0 := x-r.Min.X+sp.X, y-r.Min.Y+sp.Y
+			if !src.IsNoData(x0, y0) {
+				setValidPixel(dst, x, y, src.At(x0, y0))
+			}
+		}
+	}
+}
+
+// drawPyrDownNoData downsamples the valid pixels of src. The dst pixel is
+// nodata if all the source pixels are nodata. The Interlace and Nearest
+// filters take the first valid pixel, the other filters average the valid
+// pixels.
+func drawPyrDownNoData(dst draw.Image, r image.Rectangle, src image_ext.NoDataImage, sp image.Point, filter Filter) {
+	b := src.Bounds()
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			x0 := (x-r.Min.X)*2 + sp.X
+			y0 := (y-r.Min.Y)*2 + sp.Y
+
+			var sum [4]float64
+			var last color.Color
+			var n, channels int
+			for _, pt := range [4]image.Point{{x0, y0}, {x0, y0 + 1}, {x0 + 1, y0 + 1}, {x0 + 1, y0}} {
+				if !pt.In(b) || src.IsNoData(pt.X, pt.Y) {
+					continue
+				}
+				last = src.At(pt.X, pt.Y)
+				if filter == Filter_Interlace || filter == Filter_Nearest {
+					n = 1
+					break
+				}
+				var v [4]float64
+				v, channels = colorValues(last)
+				for i := 0; i < channels; i++ {
+					sum[i] += v[i]
+				}
+				n++
+			}
+			switch {
+			case n == 0:
+				setNoDataPixel(dst, x, y)
+			case filter == Filter_Interlace || filter == Filter_Nearest:
+				setValidPixel(dst, x, y, last)
+			default:
+				for i := 0; i < channels; i++ {
+					sum[i] /= float64(n)
+				}
+				setValidPixel(dst, x, y, newColorLike(last, sum))
+			}
+		}
+	}
+}
+
+func setValidPixel(dst draw.Image, x, y int, c color.Color) {
+	dst.Set(x, y, c)
+	if m, ok := dst.(*image_ext.MaskedImage); ok && m.Mask != nil {
+		m.Mask.SetNoData(x, y, false)
+	}
+}
+
+func setNoDataPixel(dst draw.Image, x, y int) {
+	if m, ok := dst.(image_ext.NoDataSetter); ok {
+		m.SetNoData(x, y)
+	} else {
+		dst.Set(x, y, color.Transparent)
+	}
+}
+
+// colorValues returns the channel values of c. The float and signed colors
+// keep their values, the other colors return the 16-bit RGBA values.
+func colorValues(c color.Color) (v [4]float64, n int) {
+	switch c := c.(type) {
+	case color_ext.Gray32f:
+		return [4]float64{float64(c.Y)}, 1
+	case color_ext.Gray16s:
+		return [4]float64{float64(c.Y)}, 1
+	case color_ext.Gray32i:
+		return [4]float64{float64(c.Y)}, 1
+	case color_ext.Gray64f:
+		return [4]float64{c.Y}, 1
+	case color_ext.RGB96f:
+		return [4]float64{float64(c.R), float64(c.G), float64(c.B)}, 3
+	case color_ext.RGB48s:
+		return [4]float64{float64(c.R), float64(c.G), float64(c.B)}, 3
+	case color_ext.RGB96i:
+		return [4]float64{float64(c.R), float64(c.G), float64(c.B)}, 3
+	case color_ext.RGB192f:
+		return [4]float64{c.R, c.G, c.B}, 3
+	case color_ext.RGBA128f:
+		return [4]float64{float64(c.R), float64(c.G), float64(c.B), float64(c.A)}, 4
+	}
+	r, g, b, a := c.RGBA()
+	return [4]float64{float64(r), float64(g), float64(b), float64(a)}, 4
+}
+
+// newColorLike returns a color of the same type as c with the channel
+// values v, see colorValues.
+func newColorLike(c color.Color, v [4]float64) color.Color {
+	switch c.(type) {
+	case color_ext.Gray32f:
+		return color_ext.Gray32f{Y: float32(v[0])}
+	case color_ext.Gray16s:
+		return color_ext.Gray16s{Y: int16(v[0])}
+	case color_ext.Gray32i:
+		return color_ext.Gray32i{Y: int32(v[0])}
+	case color_ext.Gray64f:
+		return color_ext.Gray64f{Y: v[0]}
+	case color_ext.RGB96f:
+		return color_ext.RGB96f{R: float32(v[0]), G: float32(v[1]), B: float32(v[2])}
+	case color_ext.RGB48s:
+		return color_ext.RGB48s{R: int16(v[0]), G: int16(v[1]), B: int16(v[2])}
+	case color_ext.RGB96i:
+		return color_ext.RGB96i{R: int32(v[0]), G: int32(v[1]), B: int32(v[2])}
+	case color_ext.RGB192f:
+		return color_ext.RGB192f{R: v[0], G: v[1], B: v[2]}
+	case color_ext.RGBA128f:
+		return color_ext.RGBA128f{R: float32(v[0]), G: float32(v[1]), B: float32(v[2]), A: float32(v[3])}
+	}
+	return color.RGBA64{R: uint16(v[0]), G: uint16(v[1]), B: uint16(v[2]), A: uint16(v[3])}
+}
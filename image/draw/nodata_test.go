@@ -0,0 +1,59 @@
+// Copyright 2014 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package draw
+
+import (
+	"image"
+	"image/color"
+	"testing"
+
+	image_ext "github.com/chai2010/gopkg/image"
+	color_ext "github.com/chai2010/gopkg/image/color"
+)
+
+func TestDrawPyrDown_NoData(t *testing.T) {
+	nodata := color_ext.Gray32f{Y: -9999}
+	src := image_ext.NewGray32f(image.Rect(0, 0, 4, 2))
+	for i, y := range []float32{
+		10, -9999, -9999, -9999,
+		20, -5, -9999, -9999,
+	} {
+		src.SetGray32f(i%4, i/4, color_ext.Gray32f{Y: y})
+	}
+	for i, v := range []struct {
+		Filter Filter
+		Want   [2]float32
+	}{
+		{Filter_Average, [2]float32{(10 + 20 - 5) / 3.0, -9999}},
+		{Filter_Interlace, [2]float32{10, -9999}},
+	} {
+		dst := image_ext.NewGray32f(image.Rect(0, 0, 2, 1))
+		DrawPyrDown(
+			image_ext.NewMaskedImage(dst, nodata, nil), dst.Bounds(),
+			image_ext.NewMaskedImage(src, nodata, nil), image.Pt(0, 0),
+			v.Filter,
+		)
+		for x, want := range v.Want {
+			if got := dst.Gray32fAt(x, 0).Y; got != want {
+				t.Fatalf("%d: bad value at (%d, 0); got %v, want %v", i, x, got, want)
+			}
+		}
+	}
+}
+
+func TestDraw_NoData(t *testing.T) {
+	src := image.NewGray(image.Rect(0, 0, 2, 1))
+	src.SetGray(0, 0, color.Gray{Y: 7})
+	src.SetGray(1, 0, color.Gray{Y: 8})
+	mask := image_ext.NewMask(src.Bounds())
+	mask.SetNoData(1, 0, true)
+
+	dst := image.NewGray(image.Rect(0, 0, 2, 1))
+	tClearImage(dst, color.Gray{Y: 1})
+	Draw(dst, dst.Bounds(), image_ext.NewMaskedImage(src, nil, mask), image.Pt(0, 0))
+	if got := dst.Pix; got[0] != 7 || got[1] != 1 {
+		t.Fatalf("bad pixels; got %v, want [7 1]", got)
+	}
+}
@@ -0,0 +1,487 @@
+// Copyright 2014 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package draw
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+
+	image_ext "github.com/chai2010/gopkg/image"
+	color_ext "github.com/chai2010/gopkg/image/color"
+)
+
+// Resize scales src to fill the bounds of dst with the filter, the ratios
+// of the two sides may be any value.
+//
+// The values of Gray, Gray16, Gray32f, RGB, RGB48, RGB96f, RGBA, RGBA64,
+// RGBA128f and YCbCr images are resampled in the native range if dst and
+// src have the same color model, the float values are not clamped.
+func Resize(dst draw.Image, src image.Image, filter Filter) {
+	dr, sr := dst.Bounds(), src.Bounds()
+	if dr.Empty() || sr.Empty() {
+		return
+	}
+	scaleX := float64(sr.Dx()) / float64(dr.Dx())
+	scaleY := float64(sr.Dy()) / float64(dr.Dy())
+	resample(dst, dr, src, sr, scaleX, scaleY, filter)
+}
+
+// resample scales the rectangle sr of src to the rectangle dr of dst, the
+// pixel x of dst is mapped to the pixel (x-dr.Min.X+0.5)*scaleX-0.5 of sr.
+// The pixels out of sr are clamped to the edge of sr.
+func resample(dst draw.Image, dr image.Rectangle, src image.Image, sr image.Rectangle, scaleX, scaleY float64, filter Filter) {
+	if dr.Empty() || sr.Empty() {
+		return
+	}
+	wy := makeResampleWeights(dr.Dy(), sr.Dy(), scaleY, filter)
+	resampleRows(dst, dr, src, sr, scaleX, wy, filter, dr.Min.Y, dr.Max.Y)
+}
+
+// resampleRows is like resample, but it only draws the rows [y0, y1) of dr
+// with the vertical weights wy of dr, and only reads the rows of sr which
+// have a weight in these rows.
+func resampleRows(dst draw.Image, dr image.Rectangle, src image.Image, sr image.Rectangle, scaleX float64, wy []resampleWeight, filter Filter, y0, y1 int) {
+	wy = wy[y0-dr.Min.Y : y1-dr.Min.Y]
+	lo, hi := sr.Dy(), 0
+	for _, w := range wy {
+		for _, i := range w.Index {
+			if i < lo {
+				lo = i
+			}
+			if i >= hi {
+				hi = i + 1
+			}
+		}
+	}
+	if lo >= hi {
+		return
+	}
+	wx := makeResampleWeights(dr.Dx(), sr.Dx(), scaleX, filter)
+	dr = image.Rect(dr.Min.X, y0, dr.Max.X, y1)
+	sr = image.Rect(sr.Min.X, sr.Min.Y+lo, sr.Max.X, sr.Min.Y+hi)
+
+	p := readFloatPixels(src, sr, dst)
+	n := p.Channels
+
+	// horizontal pass: sr.Dx() x sr.Dy() => dr.Dx() x sr.Dy()
+	tmp := &floatPixels{
+		Pix:      make([]float64, dr.Dx()*sr.Dy()*n),
+		Channels: n,
+		Rect:     image.Rect(0, 0, dr.Dx(), sr.Dy()),
+		Proto:    p.Proto,
+	}
+	image_ext.ParallelRows(tmp.Rect, func(r image.Rectangle) {
+		for y := r.Min.Y; y < r.Max.Y; y++ {
+			row0 := p.Pix[y*sr.Dx()*n:]
+			row1 := tmp.Pix[y*dr.Dx()*n:]
+			for x, w := range wx {
+				v := row1[x*n : x*n+n]
+				for k, i := range w.Index {
+					for c := range v {
+						v[c] += w.Weight[k] * row0[i*n+c]
+					}
+				}
+			}
+		}
+	})
+
+	// vertical pass: dr.Dx() x sr.Dy() => dr.Dx() x dr.Dy()
+	out := &floatPixels{
+		Pix:      make([]float64, dr.Dx()*dr.Dy()*n),
+		Channels: n,
+		Rect:     dr,
+		Proto:    p.Proto,
+	}
+	stride := dr.Dx() * n
+	image_ext.ParallelRows(image.Rect(0, 0, dr.Dx(), dr.Dy()), func(r image.Rectangle) {
+		for y := r.Min.Y; y < r.Max.Y; y++ {
+			row1 := out.Pix[y*stride:][:stride]
+			for k, i := range wy[y].Index {
+				row0 := tmp.Pix[(i-lo)*stride:][:stride]
+				for j := range row1 {
+					row1[j] += wy[y].Weight[k] * row0[j]
+				}
+			}
+		}
+	})
+	writeFloatPixels(dst, out)
+}
+
+// resampleWeight holds the source pixels and the weights of a destination
+// pixel.
+type resampleWeight struct {
+	Index  []int
+	Weight []float64
+}
+
+// makeResampleWeights returns the weights of the dn destination pixels, the
+// source indexes are clamped to [0, sn).
+func makeResampleWeights(dn, sn int, scale float64, filter Filter) []resampleWeight {
+	weights := make([]resampleWeight, dn)
+	clamp := func(i int) int {
+		switch {
+		case i < 0:
+			return 0
+		case i >= sn:
+			return sn - 1
+		}
+		return i
+	}
+
+	switch filter {
+	case Filter_Interlace:
+		for x := range weights {
+			weights[x] = resampleWeight{[]int{clamp(int(float64(x) * scale))}, []float64{1}}
+		}
+		return weights
+	case Filter_Nearest:
+		for x := range weights {
+			weights[x] = resampleWeight{[]int{clamp(int((float64(x) + 0.5) * scale))}, []float64{1}}
+		}
+		return weights
+	}
+
+	kernel, support := resampleKernel(filter)
+	fscale := math.Max(scale, 1)
+	support *= fscale
+	for x := range weights {
+		center := (float64(x)+0.5)*scale - 0.5
+		var sum float64
+		w := &weights[x]
+		for i := int(math.Ceil(center - support)); i <= int(math.Floor(center+support)); i++ {
+			v := kernel((float64(i) - center) / fscale)
+			if v == 0 {
+				continue
+			}
+			w.Index = append(w.Index, clamp(i))
+			w.Weight = append(w.Weight, v)
+			sum += v
+		}
+		if sum == 0 {
+			w.Index = []int{clamp(int(center + 0.5))}
+			w.Weight = []float64{1}
+			continue
+		}
+		for k := range w.Weight {
+			w.Weight[k] /= sum
+		}
+	}
+	return weights
+}
+
+// resampleKernel returns the kernel of the filter and its support radius.
+func resampleKernel(filter Filter) (kernel func(t float64) float64, support float64) {
+	switch filter {
+	case Filter_Bilinear:
+		return func(t float64) float64 {
+			if t = math.Abs(t); t < 1 {
+				return 1 - t
+			}
+			return 0
+		}, 1
+	case Filter_Gaussian:
+		return func(t float64) float64 {
+			if math.Abs(t) < 2 {
+				return math.Exp(-2 * t * t)
+			}
+			return 0
+		}, 2
+	case Filter_Lanczos:
+		return func(t float64) float64 {
+			if math.Abs(t) < 3 {
+				return sinc(t) * sinc(t/3)
+			}
+			return 0
+		}, 3
+	}
+	// Filter_Average: box
+	return func(t float64) float64 {
+		if -0.5 <= t && t < 0.5 {
+			return 1
+		}
+		return 0
+	}, 0.5
+}
+
+func sinc(x float64) float64 {
+	if x == 0 {
+		return 1
+	}
+	x *= math.Pi
+	return math.Sin(x) / x
+}
+
+// floatPixels holds the channel values of the pixels in float64.
+type floatPixels struct {
+	Pix      []float64
+	Channels int
+	Rect     image.Rectangle
+	Proto    color.Color // the color type of the generic pixels, see colorValues
+}
+
+func newFloatPixels(r image.Rectangle, channels int) *floatPixels {
+	return &floatPixels{
+		Pix:      make([]float64, r.Dx()*r.Dy()*channels),
+		Channels: channels,
+		Rect:     r,
+	}
+}
+
+// each calls fn with the channel values of every pixel.
+func (p *floatPixels) each(fn func(x, y int, v []float64)) {
+	n, i := p.Channels, 0
+	for y := p.Rect.Min.Y; y < p.Rect.Max.Y; y++ {
+		for x := p.Rect.Min.X; x < p.Rect.Max.X; x++ {
+			fn(x, y, p.Pix[i:i+n])
+			i += n
+		}
+	}
+}
+
+// isFloatPixelsImage reports whether writeFloatPixels writes the native
+// values to m without the Proto of the pixels.
+func isFloatPixelsImage(m image.Image) bool {
+	switch m.(type) {
+	case *image.Gray, *image.Gray16, *image_ext.Gray32f,
+		*image_ext.RGB, *image_ext.RGB48, *image_ext.RGB96f,
+		*image.RGBA, *image.RGBA64, *image_ext.RGBA128f,
+		*image_ext.YCbCr:
+		return true
+	}
+	return false
+}
+
+// isSameModel reports whether a and b are the same color model, the
+// palettes are not comparable, so they are never the same.
+func isSameModel(a, b color.Model) bool {
+	if _, ok := a.(color.Palette); ok {
+		return false
+	}
+	return a == b
+}
+
+// readFloatPixels reads the rectangle r of src for dst. The native values
+// are read if src has the color model of dst, or the 16-bit RGBA values are
+// read.
+func readFloatPixels(src image.Image, r image.Rectangle, dst image.Image) (p *floatPixels) {
+	model := dst.ColorModel()
+	if isSameModel(src.ColorModel(), model) && isFloatPixelsImage(dst) {
+		switch src := src.(type) {
+		case *image.Gray:
+			p = newFloatPixels(r, 1)
+			p.each(func(x, y int, v []float64) { v[0] = float64(src.GrayAt(x, y).Y) })
+			return
+		case *image.Gray16:
+			p = newFloatPixels(r, 1)
+			p.each(func(x, y int, v []float64) { v[0] = float64(src.Gray16At(x, y).Y) })
+			return
+		case *image_ext.Gray32f:
+			p = newFloatPixels(r, 1)
+			p.each(func(x, y int, v []float64) { v[0] = float64(src.Gray32fAt(x, y).Y) })
+			return
+		case *image_ext.RGB:
+			p = newFloatPixels(r, 3)
+			p.each(func(x, y int, v []float64) {
+				c := src.RGBAt(x, y)
+				v[0], v[1], v[2] = float64(c.R), float64(c.G), float64(c.B)
+			})
+			return
+		case *image_ext.RGB48:
+			p = newFloatPixels(r, 3)
+			p.each(func(x, y int, v []float64) {
+				c := src.RGB48At(x, y)
+				v[0], v[1], v[2] = float64(c.R), float64(c.G), float64(c.B)
+			})
+			return
+		case *image_ext.RGB96f:
+			p = newFloatPixels(r, 3)
+			p.each(func(x, y int, v []float64) {
+				c := src.RGB96fAt(x, y)
+				v[0], v[1], v[2] = float64(c.R), float64(c.G), float64(c.B)
+			})
+			return
+		case *image.RGBA:
+			p = newFloatPixels(r, 4)
+			p.each(func(x, y int, v []float64) {
+				c := src.RGBAAt(x, y)
+				v[0], v[1], v[2], v[3] = float64(c.R), float64(c.G), float64(c.B), float64(c.A)
+			})
+			return
+		case *image.RGBA64:
+			p = newFloatPixels(r, 4)
+			p.each(func(x, y int, v []float64) {
+				c := src.RGBA64At(x, y)
+				v[0], v[1], v[2], v[3] = float64(c.R), float64(c.G), float64(c.B), float64(c.A)
+			})
+			return
+		case *image_ext.RGBA128f:
+			p = newFloatPixels(r, 4)
+			p.each(func(x, y int, v []float64) {
+				c := src.RGBA128fAt(x, y)
+				v[0], v[1], v[2], v[3] = float64(c.R), float64(c.G), float64(c.B), float64(c.A)
+			})
+			return
+		case *image.YCbCr:
+			p = newFloatPixels(r, 3)
+			p.each(func(x, y int, v []float64) {
+				c := src.YCbCrAt(x, y)
+				v[0], v[1], v[2] = float64(c.Y), float64(c.Cb), float64(c.Cr)
+			})
+			return
+		case *image_ext.YCbCr:
+			p = newFloatPixels(r, 3)
+			p.each(func(x, y int, v []float64) {
+				c := src.YCbCrAt(x, y)
+				v[0], v[1], v[2] = float64(c.Y), float64(c.Cb), float64(c.Cr)
+			})
+			return
+		}
+	}
+
+	// generic pixels, the native values of the same model or RGBA64
+	proto := color.Color(color.RGBA64{})
+	if isSameModel(src.ColorModel(), model) {
+		proto = model.Convert(color.Black)
+	}
+	_, n := colorValues(proto)
+	p = newFloatPixels(r, n)
+	p.Proto = proto
+	p.each(func(x, y int, v []float64) {
+		c := src.At(x, y)
+		if _, ok := proto.(color.RGBA64); ok {
+			c = color.RGBA64Model.Convert(c)
+		}
+		values, _ := colorValues(c)
+		copy(v, values[:n])
+	})
+	return
+}
+
+// writeFloatPixels writes p to dst, the integer values are rounded and
+// clamped to the range of the data type.
+func writeFloatPixels(dst draw.Image, p *floatPixels) {
+	if p.Proto == nil {
+		switch dst := dst.(type) {
+		case *image.Gray:
+			p.each(func(x, y int, v []float64) {
+				dst.SetGray(x, y, color.Gray{Y: uint8(clampRound(v[0], 0xff))})
+			})
+			return
+		case *image.Gray16:
+			p.each(func(x, y int, v []float64) {
+				dst.SetGray16(x, y, color.Gray16{Y: uint16(clampRound(v[0], 0xffff))})
+			})
+			return
+		case *image_ext.Gray32f:
+			p.each(func(x, y int, v []float64) {
+				dst.SetGray32f(x, y, color_ext.Gray32f{Y: float32(v[0])})
+			})
+			return
+		case *image_ext.RGB:
+			p.each(func(x, y int, v []float64) {
+				dst.SetRGB(x, y, color_ext.RGB{
+					R: uint8(clampRound(v[0], 0xff)),
+					G: uint8(clampRound(v[1], 0xff)),
+					B: uint8(clampRound(v[2], 0xff)),
+				})
+			})
+			return
+		case *image_ext.RGB48:
+			p.each(func(x, y int, v []float64) {
+				dst.SetRGB48(x, y, color_ext.RGB48{
+					R: uint16(clampRound(v[0], 0xffff)),
+					G: uint16(clampRound(v[1], 0xffff)),
+					B: uint16(clampRound(v[2], 0xffff)),
+				})
+			})
+			return
+		case *image_ext.RGB96f:
+			p.each(func(x, y int, v []float64) {
+				dst.SetRGB96f(x, y, color_ext.RGB96f{R: float32(v[0]), G: float32(v[1]), B: float32(v[2])})
+			})
+			return
+		case *image.RGBA:
+			p.each(func(x, y int, v []float64) {
+				// the colors are premultiplied, so they are not larger than alpha
+				a := clampRound(v[3], 0xff)
+				dst.SetRGBA(x, y, color.RGBA{
+					R: uint8(clampRound(v[0], a)),
+					G: uint8(clampRound(v[1], a)),
+					B: uint8(clampRound(v[2], a)),
+					A: uint8(a),
+				})
+			})
+			return
+		case *image.RGBA64:
+			p.each(func(x, y int, v []float64) {
+				a := clampRound(v[3], 0xffff)
+				dst.SetRGBA64(x, y, color.RGBA64{
+					R: uint16(clampRound(v[0], a)),
+					G: uint16(clampRound(v[1], a)),
+					B: uint16(clampRound(v[2], a)),
+					A: uint16(a),
+				})
+			})
+			return
+		case *image_ext.RGBA128f:
+			p.each(func(x, y int, v []float64) {
+				dst.SetRGBA128f(x, y, color_ext.RGBA128f{
+					R: float32(v[0]), G: float32(v[1]), B: float32(v[2]), A: float32(v[3]),
+				})
+			})
+			return
+		case *image_ext.YCbCr:
+			p.each(func(x, y int, v []float64) {
+				dst.SetYCbCr(x, y, color.YCbCr{
+					Y:  uint8(clampRound(v[0], 0xff)),
+					Cb: uint8(clampRound(v[1], 0xff)),
+					Cr: uint8(clampRound(v[2], 0xff)),
+				})
+			})
+			return
+		}
+	}
+
+	min, max, isInt := colorRange(p.Proto)
+	p.each(func(x, y int, v []float64) {
+		var values [4]float64
+		for i := range v {
+			values[i] = v[i]
+			if isInt {
+				values[i] = clampRoundRange(v[i], min, max)
+			}
+		}
+		dst.Set(x, y, newColorLike(p.Proto, values))
+	})
+}
+
+// colorRange returns the value range of the channels of c.
+func colorRange(c color.Color) (min, max float64, isInt bool) {
+	switch c.(type) {
+	case color_ext.Gray32f, color_ext.Gray64f, color_ext.RGB96f, color_ext.RGB192f, color_ext.RGBA128f:
+		return 0, 0, false
+	case color_ext.Gray16s, color_ext.RGB48s:
+		return math.MinInt16, math.MaxInt16, true
+	case color_ext.Gray32i, color_ext.RGB96i:
+		return math.MinInt32, math.MaxInt32, true
+	}
+	return 0, 0xffff, true
+}
+
+func clampRound(v, max float64) float64 {
+	switch {
+	case v < 0:
+		return 0
+	case v > max:
+		return max
+	}
+	return math.Floor(v + 0.5)
+}
+
+func clampRoundRange(v, min, max float64) float64 {
+	return math.Floor(math.Min(math.Max(v, min), max) + 0.5)
+}
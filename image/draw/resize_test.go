@@ -0,0 +1,116 @@
+// Copyright 2014 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package draw
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"testing"
+
+	image_ext "github.com/chai2010/gopkg/image"
+	color_ext "github.com/chai2010/gopkg/image/color"
+)
+
+var tResizeFilterList = []Filter{
+	Filter_Average,
+	Filter_Interlace,
+	Filter_Nearest,
+	Filter_Bilinear,
+	Filter_Gaussian,
+	Filter_Lanczos,
+}
+
+func TestDrawPyrDown_Filters(t *testing.T) {
+	for _, filter := range tResizeFilterList[2:] {
+		for i, v := range tDrawPyrDownTesterList {
+			tClearImage(v.BgdImage, v.BgdColor)
+			tClearImage(v.FgdImage, v.FgdColor)
+			DrawPyrDown(v.BgdImage, v.DrawRect, v.FgdImage, v.DrawSp, filter)
+			err := tCheckImageColor(v.BgdImage, v.FgdRect, v.FgdColor, v.BgdColor)
+			if err != nil {
+				t.Fatalf("filter %d, %d: %v", filter, i, err)
+			}
+		}
+	}
+}
+
+func TestResize(t *testing.T) {
+	for i, v := range []struct {
+		New   func(r image.Rectangle) draw.Image
+		Color color.Color
+	}{
+		{func(r image.Rectangle) draw.Image { return image.NewGray(r) }, color.Gray{Y: 250}},
+		{func(r image.Rectangle) draw.Image { return image.NewGray16(r) }, color.Gray16{Y: 250 << 8}},
+		{func(r image.Rectangle) draw.Image { return image_ext.NewGray32f(r) }, color_ext.Gray32f{Y: 250 << 8}},
+		{func(r image.Rectangle) draw.Image { return image_ext.NewRGB(r) }, color_ext.RGB{R: 250, G: 251, B: 252}},
+		{func(r image.Rectangle) draw.Image { return image_ext.NewRGB48(r) }, color_ext.RGB48{R: 250 << 8, G: 251 << 8, B: 252 << 8}},
+		{func(r image.Rectangle) draw.Image { return image_ext.NewRGB96f(r) }, color_ext.RGB96f{R: 250 << 8, G: 251 << 8, B: 252 << 8}},
+		{func(r image.Rectangle) draw.Image { return image.NewRGBA(r) }, color.RGBA{R: 200, G: 201, B: 202, A: 253}},
+		{func(r image.Rectangle) draw.Image { return image.NewRGBA64(r) }, color.RGBA64{R: 200 << 8, G: 201 << 8, B: 202 << 8, A: 253 << 8}},
+		{func(r image.Rectangle) draw.Image { return image_ext.NewRGBA128f(r) }, color_ext.RGBA128f{R: 200 << 8, G: 201 << 8, B: 202 << 8, A: 253 << 8}},
+		{func(r image.Rectangle) draw.Image { return image_ext.NewYCbCr(r, image.YCbCrSubsampleRatio444) }, color.YCbCr{Y: 150, Cb: 152, Cr: 154}},
+		{func(r image.Rectangle) draw.Image { return image_ext.NewGray16s(r) }, color_ext.Gray16s{Y: -1000}},
+		{func(r image.Rectangle) draw.Image { return image.NewPaletted(r, tPalette) }, color.Gray{Y: 250}},
+	} {
+		for _, filter := range tResizeFilterList {
+			for _, size := range []image.Point{{3, 2}, {7, 5}, {25, 31}} {
+				src := v.New(image.Rect(2, 3, 12, 13))
+				dst := v.New(image.Rectangle{Max: size}.Add(image.Pt(1, 1)))
+				tClearImage(src, v.Color)
+				Resize(dst, src, filter)
+				if err := tCheckImageColor(dst, dst.Bounds(), v.Color, v.Color); err != nil {
+					t.Fatalf("%d: filter %d, size %v: %v", i, filter, size, err)
+				}
+			}
+		}
+	}
+}
+
+func TestResize_Gray32f(t *testing.T) {
+	// the float values are not clamped
+	src := image_ext.NewGray32f(image.Rect(0, 0, 4, 1))
+	for x, y := range []float32{-100, -100, 300, 300} {
+		src.SetGray32f(x, 0, color_ext.Gray32f{Y: y})
+	}
+	dst := image_ext.NewGray32f(image.Rect(0, 0, 2, 1))
+	Resize(dst, src, Filter_Average)
+	if a, b := dst.Gray32fAt(0, 0).Y, dst.Gray32fAt(1, 0).Y; a != -100 || b != 300 {
+		t.Fatalf("bad values; got [%v %v], want [-100 300]", a, b)
+	}
+
+	// the edges are sharper than the average
+	src = image_ext.NewGray32f(image.Rect(0, 0, 8, 1))
+	for x := 4; x < 8; x++ {
+		src.SetGray32f(x, 0, color_ext.Gray32f{Y: 1})
+	}
+	var values [2]float32
+	for i, filter := range []Filter{Filter_Bilinear, Filter_Lanczos} {
+		dst := image_ext.NewGray32f(image.Rect(0, 0, 4, 1))
+		Resize(dst, src, filter)
+		values[i] = dst.Gray32fAt(1, 0).Y
+	}
+	if !(values[1] < values[0]) {
+		t.Fatalf("Lanczos is not sharper than Bilinear: %v", values)
+	}
+}
+
+func TestResize_maskedImage(t *testing.T) {
+	// dst has the color model of src, but is not a native image
+	src := image.NewGray(image.Rect(0, 0, 16, 16))
+	tClearImage(src, color.Gray{Y: 200})
+	for _, filter := range tResizeFilterList {
+		dst := image_ext.NewMaskedImage(image.NewGray(image.Rect(0, 0, 8, 8)), nil, nil)
+		Resize(dst, src, filter)
+		if err := tCheckImageColor(dst, dst.Bounds(), color.Gray{Y: 200}, color.Gray{Y: 200}); err != nil {
+			t.Fatalf("Resize: filter %d: %v", filter, err)
+		}
+		dst = image_ext.NewMaskedImage(image.NewGray(image.Rect(0, 0, 8, 8)), nil, nil)
+		DrawPyrDown(dst, dst.Bounds(), src, image.ZP, filter)
+		if err := tCheckImageColor(dst, dst.Bounds(), color.Gray{Y: 200}, color.Gray{Y: 200}); err != nil {
+			t.Fatalf("DrawPyrDown: filter %d: %v", filter, err)
+		}
+	}
+}
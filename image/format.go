@@ -6,8 +6,10 @@ package image
 
 import (
 	"bufio"
+	"bytes"
 	"image"
 	"io"
+	"io/ioutil"
 	"os"
 	"strings"
 )
@@ -20,13 +22,31 @@ import (
 // Decode is the function that decodes the encoded image.
 // DecodeConfig is the function that decodes just its configuration.
 // Encode is the function that encodes just its configuration.
+// NewTileReader is the function that opens the encoded image for random
+// rectangle access, it may be nil if the format can't do it.
+// DecodeWithMetadata and EncodeWithMetadata are the functions that decode
+// and encode the image with its metadata, they may be nil if the format
+// can't store the metadata.
+// DecodeAll and EncodeAll are the functions that decode and encode all the
+// frames, they may be nil if the format has only one frame.
+// LoadFile and SaveFile are the functions that load and save the image file
+// with its sidecar files, like the .hdr file of BIL, they are used by Load
+// and Save instead of Decode and Encode if they are not nil.
+// The opt of Decode, Encode and NewTileReader may be nil.
 type Format struct {
-	Name         string
-	Extensions   []string
-	Magics       []string
-	DecodeConfig func(r io.Reader) (image.Config, error)
-	Decode       func(r io.Reader, opt interface{}) (image.Image, error)
-	Encode       func(w io.Writer, m image.Image, opt interface{}) error
+	Name               string
+	Extensions         []string
+	Magics             []string
+	DecodeConfig       func(r io.Reader) (image.Config, error)
+	Decode             func(r io.Reader, opt *Options) (image.Image, error)
+	Encode             func(w io.Writer, m image.Image, opt *Options) error
+	NewTileReader      func(r io.ReaderAt, size int64, opt *Options) (TileReader, error)
+	DecodeWithMetadata func(r io.Reader, opt *Options) (image.Image, *Metadata, error)
+	EncodeWithMetadata func(w io.Writer, m image.Image, meta *Metadata, opt *Options) (dropped []string, err error)
+	DecodeAll          func(r io.Reader, opt *Options) (*Frames, error)
+	EncodeAll          func(w io.Writer, frames *Frames, opt *Options) error
+	LoadFile           func(filename string, opt *Options) (image.Image, error)
+	SaveFile           func(filename string, m image.Image, opt *Options) error
 }
 
 // Formats is the list of registered formats.
@@ -35,12 +55,36 @@ var formats []Format
 // RegisterFormat registers an image format for use by Encode and Decode.
 func RegisterFormat(fmt Format) {
 	formats = append(formats, Format{
+		Name:               fmt.Name,
+		Extensions:         append([]string(nil), fmt.Extensions...),
+		Magics:             append([]string(nil), fmt.Magics...),
+		DecodeConfig:       fmt.DecodeConfig,
+		Decode:             fmt.Decode,
+		Encode:             fmt.Encode,
+		NewTileReader:      fmt.NewTileReader,
+		DecodeWithMetadata: fmt.DecodeWithMetadata,
+		EncodeWithMetadata: fmt.EncodeWithMetadata,
+		DecodeAll:          fmt.DecodeAll,
+		EncodeAll:          fmt.EncodeAll,
+		LoadFile:           fmt.LoadFile,
+		SaveFile:           fmt.SaveFile,
+	})
+}
+
+// fallbackFormats is the list of registered fallback formats.
+var fallbackFormats []Format
+
+// RegisterFallbackFormat registers a format which is tried by Decode,
+// DecodeConfig and Load when no registered format matches the magic of the
+// data, like the GDAL bindings which can read many raster formats. The
+// Extensions and Magics of the fallback format are ignored. The fallback
+// formats should return image.ErrFormat if they can't read the data.
+func RegisterFallbackFormat(fmt Format) {
+	fallbackFormats = append(fallbackFormats, Format{
 		Name:         fmt.Name,
-		Extensions:   append([]string(nil), fmt.Extensions...),
-		Magics:       append([]string(nil), fmt.Magics...),
 		DecodeConfig: fmt.DecodeConfig,
 		Decode:       fmt.Decode,
-		Encode:       fmt.Encode,
+		LoadFile:     fmt.LoadFile,
 	})
 }
 
@@ -87,6 +131,12 @@ func sniffByName(filename string) Format {
 	return Format{}
 }
 
+// FormatByExtension returns the name of the registered format of the
+// filename extension, like ".jpg", or "" if there is no such format.
+func FormatByExtension(ext string) string {
+	return sniffByName(ext).Name
+}
+
 // Sniff determines the format of r's data.
 func sniffByMagic(r reader) Format {
 	for _, f := range formats {
@@ -104,16 +154,52 @@ func sniffByMagic(r reader) Format {
 // The string returned is the format name used during format registration.
 // Format registration is typically done by an init function in the codec-
 // specific package.
-func Decode(r io.Reader, opt interface{}) (image.Image, string, error) {
+func Decode(r io.Reader, opt *Options) (image.Image, string, error) {
 	rr := asReader(r)
 	f := sniffByMagic(rr)
 	if f.Decode == nil {
-		return nil, "", image.ErrFormat
+		return decodeFallback(rr, opt)
 	}
 	m, err := f.Decode(rr, opt)
 	return m, f.Name, err
 }
 
+// decodeFallback decodes the image with the fallback formats, the data is
+// read into memory if there is more than one fallback format.
+func decodeFallback(r io.Reader, opt *Options) (image.Image, string, error) {
+	if len(fallbackFormats) == 1 && fallbackFormats[0].Decode != nil {
+		f := fallbackFormats[0]
+		m, err := f.Decode(r, opt)
+		return m, f.Name, err
+	}
+	data, err := readAllIfFallback(r, func(f Format) bool { return f.Decode != nil })
+	if err != nil {
+		return nil, "", err
+	}
+	for _, f := range fallbackFormats {
+		if f.Decode == nil {
+			continue
+		}
+		m, err := f.Decode(bytes.NewReader(data), opt)
+		if err == image.ErrFormat {
+			continue
+		}
+		return m, f.Name, err
+	}
+	return nil, "", image.ErrFormat
+}
+
+// readAllIfFallback reads all the data of r if any fallback format matches
+// the filter, or returns image.ErrFormat.
+func readAllIfFallback(r io.Reader, filter func(f Format) bool) ([]byte, error) {
+	for _, f := range fallbackFormats {
+		if filter(f) {
+			return ioutil.ReadAll(r)
+		}
+	}
+	return nil, image.ErrFormat
+}
+
 // DecodeConfig decodes the color model and dimensions of an image that has
 // been encoded in a registered format. The string returned is the format name
 // used during format registration. Format registration is typically done by
@@ -122,39 +208,76 @@ func DecodeConfig(r io.Reader) (image.Config, string, error) {
 	rr := asReader(r)
 	f := sniffByMagic(rr)
 	if f.DecodeConfig == nil {
-		return image.Config{}, "", image.ErrFormat
+		return decodeConfigFallback(rr)
 	}
 	c, err := f.DecodeConfig(rr)
 	return c, f.Name, err
 }
 
+func decodeConfigFallback(r io.Reader) (image.Config, string, error) {
+	data, err := readAllIfFallback(r, func(f Format) bool { return f.DecodeConfig != nil })
+	if err != nil {
+		return image.Config{}, "", err
+	}
+	for _, f := range fallbackFormats {
+		if f.DecodeConfig == nil {
+			continue
+		}
+		c, err := f.DecodeConfig(bytes.NewReader(data))
+		if err == image.ErrFormat {
+			continue
+		}
+		return c, f.Name, err
+	}
+	return image.Config{}, "", image.ErrFormat
+}
+
 // Encode encodes an image as a registered format.
 // The format is the format name used during format registration.
 // Format registration is typically done by an init function in the codec-
 // specific package.
-func Encode(format string, w io.Writer, m image.Image, opt interface{}) error {
+func Encode(format string, w io.Writer, m image.Image, opt *Options) error {
 	for _, f := range formats {
-		if f.Name == format {
+		if f.Name == format && f.Encode != nil {
 			return f.Encode(w, m, opt)
 		}
 	}
 	return image.ErrFormat
 }
 
-func Load(filename string, opt interface{}) (m image.Image, format string, err error) {
+func Load(filename string, opt *Options) (m image.Image, format string, err error) {
+	if f := sniffByName(filename); f.LoadFile != nil {
+		m, err = f.LoadFile(filename, opt)
+		return m, f.Name, err
+	}
 	f, err := os.Open(filename)
 	if err != nil {
 		return
 	}
 	defer f.Close()
-	m, format, err = Decode(f, opt)
-	if err != nil {
-		return
+	return loadReader(filename, asReader(f), opt)
+}
+
+// loadReader decodes the named file opened as r, the fallback formats may
+// read the file again with its sidecar files.
+func loadReader(filename string, r reader, opt *Options) (m image.Image, format string, err error) {
+	if sniffByMagic(r).Decode == nil {
+		for _, fallback := range fallbackFormats {
+			if fallback.LoadFile == nil {
+				continue
+			}
+			if m, err = fallback.LoadFile(filename, opt); err != image.ErrFormat {
+				return m, fallback.Name, err
+			}
+		}
 	}
-	return
+	return Decode(r, opt)
 }
 
-func Save(filename string, m image.Image, opt interface{}) (err error) {
+func Save(filename string, m image.Image, opt *Options) (err error) {
+	if f := sniffByName(filename); f.SaveFile != nil {
+		return f.SaveFile(filename, m, opt)
+	}
 	f, err := os.Create(filename)
 	if err != nil {
 		return
@@ -5,17 +5,20 @@
 package image_test
 
 import (
+	"bytes"
 	"image"
+	"io"
+	"io/ioutil"
 	"os"
 	"testing"
 
 	image_ext "github.com/chai2010/gopkg/image"
 	_ "github.com/chai2010/gopkg/image/bmp"
-	_ "github.com/chai2010/gopkg/image/gif"
+	"github.com/chai2010/gopkg/image/gif"
 	_ "github.com/chai2010/gopkg/image/jpeg"
 	_ "github.com/chai2010/gopkg/image/png"
 	_ "github.com/chai2010/gopkg/image/tiff"
-	_ "github.com/chai2010/gopkg/image/webp"
+	"github.com/chai2010/gopkg/image/webp"
 )
 
 type tFormatTester struct {
@@ -131,6 +134,46 @@ func TestFormats(t *testing.T) {
 	}
 }
 
+func TestFormats_Options(t *testing.T) {
+	golden, _, err := image_ext.Load("testdata/video-001.png", nil)
+	if err != nil {
+		t.Fatalf("Load golden fialed: %v", err)
+	}
+
+	for i, v := range []struct {
+		Format    string
+		Options   *image_ext.Options
+		Supported bool
+	}{
+		{"bmp", &image_ext.Options{Lossless: true}, true},
+		{"bmp", &image_ext.Options{Quality: 90}, false},
+		{"bmp", &image_ext.Options{Compression: image_ext.CompressionDeflate}, false},
+		{"gif", &image_ext.Options{Compression: image_ext.CompressionLZW}, true},
+		{"gif", &image_ext.Options{Lossless: true}, false},
+		{"jpeg", &image_ext.Options{Quality: 75}, true},
+		{"jpeg", &image_ext.Options{Lossless: true}, false},
+		{"jpeg", &image_ext.Options{Ext: &gif.Options{}}, false},
+		{"png", &image_ext.Options{Compression: image_ext.CompressionDeflate}, true},
+		{"png", &image_ext.Options{Quality: 75}, false},
+		{"tiff", &image_ext.Options{Compression: image_ext.CompressionDeflate}, true},
+		{"tiff", &image_ext.Options{Compression: image_ext.CompressionSnappy}, false},
+		{"webp", &image_ext.Options{Quality: 75}, true},
+		{"webp", &image_ext.Options{Lossless: true, Ext: &webp.Options{}}, true},
+		{"webp", &image_ext.Options{Compression: image_ext.CompressionLZW}, false},
+	} {
+		var buf bytes.Buffer
+		err := image_ext.Encode(v.Format, &buf, golden, v.Options)
+		if v.Supported && err != nil {
+			t.Fatalf("%d: %s, Encode fail: %v", i, v.Format, err)
+		}
+		if !v.Supported {
+			if _, ok := err.(*image_ext.UnsupportedOptionError); !ok {
+				t.Fatalf("%d: %s, expect UnsupportedOptionError, got %v", i, v.Format, err)
+			}
+		}
+	}
+}
+
 // averageDelta returns the average delta in RGB space. The two images must
 // have the same bounds.
 func averageDelta(m0, m1 image.Image) int64 {
@@ -158,3 +201,67 @@ func delta(u0, u1 uint32) int64 {
 	}
 	return d
 }
+
+func TestRegisterFallbackFormat(t *testing.T) {
+	const magic = "TFALLBACK"
+	decode := func(r io.Reader, opt *image_ext.Options) (image.Image, error) {
+		data, err := ioutil.ReadAll(r)
+		if err != nil {
+			return nil, err
+		}
+		if !bytes.HasPrefix(data, []byte(magic)) {
+			return nil, image.ErrFormat
+		}
+		return image.NewGray(image.Rect(0, 0, len(data), 1)), nil
+	}
+	image_ext.RegisterFallbackFormat(image_ext.Format{
+		Name: "tfallback",
+		DecodeConfig: func(r io.Reader) (image.Config, error) {
+			m, err := decode(r, nil)
+			if err != nil {
+				return image.Config{}, err
+			}
+			return image.Config{ColorModel: m.ColorModel(), Width: m.Bounds().Dx(), Height: 1}, nil
+		},
+		Decode: decode,
+	})
+
+	data := []byte(magic + "-data")
+	m, name, err := image_ext.Decode(bytes.NewReader(data), nil)
+	if err != nil || name != "tfallback" || m.Bounds().Dx() != len(data) {
+		t.Fatalf("Decode: %v, %q, %v", err, name, m)
+	}
+	config, name, err := image_ext.DecodeConfig(bytes.NewReader(data))
+	if err != nil || name != "tfallback" || config.Width != len(data) {
+		t.Fatalf("DecodeConfig: %v, %q, %v", err, name, config)
+	}
+
+	f, err := ioutil.TempFile("", "tfallback")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	f.Write(data)
+	f.Close()
+	if _, name, err = image_ext.Load(f.Name(), nil); err != nil || name != "tfallback" {
+		t.Fatalf("Load: %v, %q", err, name)
+	}
+	if _, meta, name, err := image_ext.LoadWithMetadata(f.Name(), nil); err != nil || name != "tfallback" || meta != nil {
+		t.Fatalf("LoadWithMetadata: %v, %q, %v", err, name, meta)
+	}
+	if _, _, name, err := image_ext.DecodeWithMetadata(bytes.NewReader(data), nil); err != nil || name != "tfallback" {
+		t.Fatalf("DecodeWithMetadata: %v, %q", err, name)
+	}
+
+	// the registered formats are sniffed first
+	png, err := ioutil.ReadFile("testdata/video-001.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, name, err = image_ext.Decode(bytes.NewReader(png), nil); err != nil || name != "png" {
+		t.Fatalf("Decode png: %v, %q", err, name)
+	}
+	if _, _, err = image_ext.Decode(bytes.NewReader([]byte("unknown data")), nil); err != image.ErrFormat {
+		t.Fatalf("Decode unknown: expect image.ErrFormat, got %v", err)
+	}
+}
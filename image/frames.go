@@ -0,0 +1,152 @@
+// Copyright 2014 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package image
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+	"os"
+	"time"
+)
+
+// Disposal is what happens to the canvas area of a frame before the next
+// frame is rendered.
+type Disposal int
+
+const (
+	DisposalNone       Disposal = iota // leave the canvas as is
+	DisposalBackground                 // restore to the background color
+	DisposalPrevious                   // restore to the previous canvas
+)
+
+func (d Disposal) String() string {
+	switch d {
+	case DisposalNone:
+		return "None"
+	case DisposalBackground:
+		return "Background"
+	case DisposalPrevious:
+		return "Previous"
+	}
+	return fmt.Sprintf("Disposal(%d)", int(d))
+}
+
+// A Frame is one frame of an animation or one page of a multi-page image.
+type Frame struct {
+	Image    image.Image   // the bounds are the position in the canvas
+	Delay    time.Duration // display time of the frame
+	Disposal Disposal      // disposal method after the frame is displayed
+	Blend    bool          // alpha blend the frame with the canvas
+	PageName string        // name of the page
+	Metadata *Metadata     // metadata of the page, may be nil
+}
+
+// Frames holds the frames of animated GIF/WEBP or the pages of multi-page
+// TIFF images.
+type Frames struct {
+	Frame      []Frame
+	Config     image.Config // the canvas size and color model
+	Background color.Color  // background color of the canvas, may be nil
+	LoopCount  int          // times the animation is played, 0 means forever
+}
+
+// NewFrames returns Frames holding the single image m.
+func NewFrames(m image.Image) *Frames {
+	return &Frames{
+		Frame: []Frame{{Image: m}},
+		Config: image.Config{
+			ColorModel: m.ColorModel(),
+			Width:      m.Bounds().Max.X,
+			Height:     m.Bounds().Max.Y,
+		},
+	}
+}
+
+// DecodeAll decodes all the frames of an image that has been encoded in a
+// registered format. Formats which have no multi-frame support return a
+// single frame.
+func DecodeAll(r io.Reader, opt *Options) (frames *Frames, format string, err error) {
+	rr := asReader(r)
+	f := sniffByMagic(rr)
+	if f.Decode == nil {
+		err = image.ErrFormat
+		return
+	}
+	format = f.Name
+	if f.DecodeAll != nil {
+		frames, err = f.DecodeAll(rr, opt)
+		return
+	}
+	m, err := f.Decode(rr, opt)
+	if err != nil {
+		return
+	}
+	frames = NewFrames(m)
+	return
+}
+
+// EncodeAll encodes all the frames as a registered format. Formats which
+// have no multi-frame support can only encode a single frame.
+func EncodeAll(format string, w io.Writer, frames *Frames, opt *Options) error {
+	for _, f := range formats {
+		if f.Name == format {
+			return encodeAll(f, w, frames, opt)
+		}
+	}
+	return image.ErrFormat
+}
+
+func encodeAll(f Format, w io.Writer, frames *Frames, opt *Options) error {
+	if f.Encode == nil {
+		return image.ErrFormat
+	}
+	if len(frames.Frame) == 0 {
+		return fmt.Errorf("image/%s: EncodeAll, no frames", f.Name)
+	}
+	if f.EncodeAll != nil {
+		return f.EncodeAll(w, frames, opt)
+	}
+	if len(frames.Frame) != 1 {
+		return fmt.Errorf("image/%s: EncodeAll, can't encode %d frames", f.Name, len(frames.Frame))
+	}
+	return f.Encode(w, frames.Frame[0].Image, opt)
+}
+
+// LoadAll reads all the frames from the named file.
+func LoadAll(filename string, opt *Options) (frames *Frames, format string, err error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	frames, format, err = DecodeAll(f, opt)
+	if err != nil {
+		return
+	}
+	return
+}
+
+// SaveAll writes all the frames to the named file, the format is determined
+// by the file name extension.
+func SaveAll(filename string, frames *Frames, opt *Options) (err error) {
+	format := sniffByName(filename)
+	if format.Encode == nil {
+		err = image.ErrFormat
+		return
+	}
+
+	f, err := os.Create(filename)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+
+	if err = encodeAll(format, f, frames, opt); err != nil {
+		return
+	}
+	return
+}
@@ -0,0 +1,115 @@
+// Copyright 2014 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package image_test
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/draw"
+	"testing"
+	"time"
+
+	image_ext "github.com/chai2010/gopkg/image"
+)
+
+func tNewFrames(t *testing.T) *image_ext.Frames {
+	golden, _, err := image_ext.Load("testdata/video-001.png", nil)
+	if err != nil {
+		t.Fatalf("Load golden fialed: %v", err)
+	}
+	b := golden.Bounds()
+
+	frames := &image_ext.Frames{
+		Config: image.Config{
+			ColorModel: color.RGBAModel,
+			Width:      b.Dx(),
+			Height:     b.Dy(),
+		},
+		LoopCount: 3,
+	}
+	for i, r := range []image.Rectangle{
+		b,
+		image.Rect(0, 0, b.Dx()/2, b.Dy()/2),
+		image.Rect(b.Dx()/2&^1, b.Dy()/2&^1, b.Dx(), b.Dy()), // even offset for webp
+	} {
+		m := image.NewRGBA(r)
+		draw.Draw(m, r, golden, r.Min, draw.Src)
+		frames.Frame = append(frames.Frame, image_ext.Frame{
+			Image:    m,
+			Delay:    time.Duration(i+1) * 100 * time.Millisecond,
+			Blend:    true,
+			PageName: []string{"a", "b", "c"}[i],
+		})
+	}
+	return frames
+}
+
+func TestFrames(t *testing.T) {
+	frames := tNewFrames(t)
+	for i, v := range []struct {
+		Format   string
+		Timing   bool
+		Offset   bool
+		PageName bool
+	}{
+		{"gif", true, true, false},
+		{"tiff", false, false, true},
+		{"webp", true, true, false},
+	} {
+		var buf bytes.Buffer
+		if err := image_ext.EncodeAll(v.Format, &buf, frames, nil); err != nil {
+			t.Fatalf("%d: %s, EncodeAll: %v", i, v.Format, err)
+		}
+		got, format, err := image_ext.DecodeAll(&buf, nil)
+		if err != nil {
+			t.Fatalf("%d: %s, DecodeAll: %v", i, v.Format, err)
+		}
+		if format != v.Format {
+			t.Fatalf("%d: bad format; got %v, want %v", i, format, v.Format)
+		}
+		if len(got.Frame) != len(frames.Frame) {
+			t.Fatalf("%d: %s, bad frames; got %d, want %d", i, v.Format, len(got.Frame), len(frames.Frame))
+		}
+		for k, frame := range got.Frame {
+			want := frames.Frame[k]
+			b, wantBounds := frame.Image.Bounds(), want.Image.Bounds()
+			if !v.Offset {
+				wantBounds = wantBounds.Sub(wantBounds.Min)
+			}
+			if b != wantBounds {
+				t.Fatalf("%d: %s, frame %d, bad bounds; got %v, want %v", i, v.Format, k, b, wantBounds)
+			}
+			if v.Timing && frame.Delay != want.Delay {
+				t.Fatalf("%d: %s, frame %d, bad delay; got %v, want %v", i, v.Format, k, frame.Delay, want.Delay)
+			}
+			if v.PageName && frame.PageName != want.PageName {
+				t.Fatalf("%d: %s, frame %d, bad page name; got %q, want %q", i, v.Format, k, frame.PageName, want.PageName)
+			}
+		}
+		if v.Timing && got.LoopCount != frames.LoopCount {
+			t.Fatalf("%d: %s, bad loop count; got %d, want %d", i, v.Format, got.LoopCount, frames.LoopCount)
+		}
+	}
+}
+
+func TestFrames_Single(t *testing.T) {
+	frames, format, err := image_ext.LoadAll("testdata/video-001.bmp", nil)
+	if err != nil {
+		t.Fatalf("LoadAll: %v", err)
+	}
+	if format != "bmp" || len(frames.Frame) != 1 {
+		t.Fatalf("bad frames; got %s/%d, want bmp/1", format, len(frames.Frame))
+	}
+
+	var buf bytes.Buffer
+	if err := image_ext.EncodeAll("bmp", &buf, frames, nil); err != nil {
+		t.Fatalf("EncodeAll: %v", err)
+	}
+	frames.Frame = append(frames.Frame, frames.Frame[0])
+	if err := image_ext.EncodeAll("bmp", &buf, frames, nil); err == nil {
+		t.Fatalf("EncodeAll: expect error for 2 bmp frames")
+	}
+}
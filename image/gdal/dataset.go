@@ -0,0 +1,416 @@
+// Copyright 2014 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gdal
+
+/*
+#include "go_gdal.h"
+*/
+import "C"
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"runtime"
+	"sync/atomic"
+	"unsafe"
+
+	image_ext "github.com/chai2010/gopkg/image"
+)
+
+// Dataset is a raster dataset opened by GDAL, like a GeoTIFF file. It is
+// closed by the finalizer if Close is not called, but the written pixels
+// are only flushed by Close.
+//
+// Dataset implements image_ext.TileReader.
+type Dataset struct {
+	h       C.GDALDatasetH
+	bands   []*Band
+	config  image.Config
+	err     error  // the error of the color model
+	memName string // the /vsimem/ file of OpenBytes
+}
+
+// Band is a raster band of a Dataset, it is valid until the Dataset is
+// closed.
+type Band struct {
+	h  C.GDALRasterBandH
+	ds *Dataset
+}
+
+// Open opens the raster file with the access GA_ReadOnly or GA_Update.
+func Open(filename string, access GDALAccess) (p *Dataset, err error) {
+	name := C.CString(filename)
+	defer C.free(unsafe.Pointer(name))
+
+	h := C.GDALOpen(name, C.GDALAccess(access))
+	if h == nil {
+		return nil, gdalLastError("Open", filename)
+	}
+	return newDataset(h, ""), nil
+}
+
+var memFileID int64
+
+// OpenBytes opens the raster file in data, as a read only GDAL /vsimem/
+// file. The data is copied.
+func OpenBytes(data []byte) (p *Dataset, err error) {
+	if len(data) == 0 {
+		return nil, fmt.Errorf("image/gdal: OpenBytes, empty data")
+	}
+	memName := fmt.Sprintf("/vsimem/gopkg-image-gdal-%d", atomic.AddInt64(&memFileID, 1))
+	name := C.CString(memName)
+	defer C.free(unsafe.Pointer(name))
+
+	// the buffer is freed by GDAL when the file is unlinked
+	buf := C.CBytes(data)
+	fp := C.VSIFileFromMemBuffer(name, (*C.GByte)(buf), C.vsi_l_offset(len(data)), 1)
+	if fp == nil {
+		C.free(buf)
+		return nil, gdalLastError("OpenBytes", memName)
+	}
+	C.VSIFCloseL(fp)
+
+	h := C.GDALOpen(name, C.GA_ReadOnly)
+	if h == nil {
+		err = gdalLastError("OpenBytes", memName)
+		C.VSIUnlink(name)
+		return nil, err
+	}
+	return newDataset(h, memName), nil
+}
+
+// Create creates a new dataset with the driver, like "GTiff" or "MEM".
+// The options are the creation options of the driver, like "TILED=YES".
+func Create(driver, filename string, width, height, bandCount int, dataType GDALDataType, options []string) (p *Dataset, err error) {
+	driverName := C.CString(driver)
+	defer C.free(unsafe.Pointer(driverName))
+
+	hDriver := C.GDALGetDriverByName(driverName)
+	if hDriver == nil {
+		return nil, fmt.Errorf("image/gdal: Create, unknown driver %q", driver)
+	}
+	h := GDALCreate(GDALDriverH(hDriver), filename, width, height, bandCount, dataType, options)
+	if h == nil {
+		return nil, gdalLastError("Create", filename)
+	}
+	return newDataset(C.GDALDatasetH(h), ""), nil
+}
+
+func newDataset(h C.GDALDatasetH, memName string) *Dataset {
+	p := &Dataset{h: h, memName: memName}
+	n := int(C.GDALGetRasterCount(h))
+	for i := 0; i < n; i++ {
+		p.bands = append(p.bands, &Band{h: C.GDALGetRasterBand(h, C.int(i+1)), ds: p})
+	}
+	p.config.Width = int(C.GDALGetRasterXSize(h))
+	p.config.Height = int(C.GDALGetRasterYSize(h))
+	p.config.ColorModel, p.err = bandsColorModel(p.bands)
+	runtime.SetFinalizer(p, (*Dataset).Close)
+	return p
+}
+
+// Close flushes the written pixels and closes the dataset, it is safe to
+// call Close more than once.
+func (p *Dataset) Close() error {
+	if p.h == nil {
+		return nil
+	}
+	C.GDALClose(p.h)
+	p.h = nil
+	if p.memName != "" {
+		name := C.CString(p.memName)
+		defer C.free(unsafe.Pointer(name))
+		C.VSIUnlink(name)
+	}
+	runtime.SetFinalizer(p, nil)
+	return nil
+}
+
+// Config returns the color model and dimensions of the dataset, the
+// ColorModel is nil if the bands can't be read as an image.
+func (p *Dataset) Config() image.Config {
+	return p.config
+}
+
+// Bounds returns the rectangle of the dataset.
+func (p *Dataset) Bounds() image.Rectangle {
+	return image.Rect(0, 0, p.config.Width, p.config.Height)
+}
+
+// DriverName returns the short name of the driver, like "GTiff".
+func (p *Dataset) DriverName() string {
+	if p.h == nil {
+		return ""
+	}
+	name := C.GoString(C.GDALGetDriverShortName(C.GDALGetDatasetDriver(p.h)))
+	runtime.KeepAlive(p)
+	return name
+}
+
+// BandCount returns the number of the bands.
+func (p *Dataset) BandCount() int {
+	return len(p.bands)
+}
+
+// Band returns the band i, 0 <= i < BandCount().
+func (p *Dataset) Band(i int) *Band {
+	return p.bands[i]
+}
+
+// GeoTransform returns the affine transform of the dataset, it is zero if
+// the dataset is not georeferenced.
+func (p *Dataset) GeoTransform() (gt image_ext.GeoTransform) {
+	if p.h == nil {
+		return
+	}
+	var v [6]C.double
+	rv := C.GDALGetGeoTransform(p.h, &v[0])
+	runtime.KeepAlive(p)
+	if rv != C.CE_None {
+		return
+	}
+	for i := range v {
+		gt[i] = float64(v[i])
+	}
+	return
+}
+
+// SetGeoTransform sets the affine transform of the dataset.
+func (p *Dataset) SetGeoTransform(gt image_ext.GeoTransform) error {
+	if p.h == nil {
+		return errClosed
+	}
+	var v [6]C.double
+	for i := range v {
+		v[i] = C.double(gt[i])
+	}
+	rv := C.GDALSetGeoTransform(p.h, &v[0])
+	runtime.KeepAlive(p)
+	if rv != C.CE_None {
+		return gdalLastError("SetGeoTransform", "")
+	}
+	return nil
+}
+
+// Projection returns the OGC WKT of the coordinate system, or "" if the
+// dataset is not georeferenced.
+func (p *Dataset) Projection() string {
+	if p.h == nil {
+		return ""
+	}
+	wkt := C.GoString(C.GDALGetProjectionRef(p.h))
+	runtime.KeepAlive(p)
+	return wkt
+}
+
+// SetProjection sets the OGC WKT of the coordinate system.
+func (p *Dataset) SetProjection(wkt string) error {
+	if p.h == nil {
+		return errClosed
+	}
+	s := C.CString(wkt)
+	defer C.free(unsafe.Pointer(s))
+	rv := C.GDALSetProjection(p.h, s)
+	runtime.KeepAlive(p)
+	if rv != C.CE_None {
+		return gdalLastError("SetProjection", "")
+	}
+	return nil
+}
+
+// ReadRect reads the pixels of all the bands inside r, see Band.ReadRect.
+func (p *Dataset) ReadRect(r image.Rectangle, buf image_ext.ImageBuffer) (m image.Image, err error) {
+	if p.err != nil {
+		return nil, p.err
+	}
+	return readRect(p, p.bands, p.config.ColorModel, r, buf)
+}
+
+// WriteRect writes the pixels of m inside r to all the bands, see
+// Band.WriteRect.
+func (p *Dataset) WriteRect(r image.Rectangle, m image.Image) error {
+	if p.err != nil {
+		return p.err
+	}
+	return writeRect(p, p.bands, p.config.ColorModel, r, m)
+}
+
+// DataType returns the data type of the samples.
+func (p *Band) DataType() GDALDataType {
+	if p.ds.h == nil {
+		return GDT_Unknown
+	}
+	dataType := GDALDataType(C.GDALGetRasterDataType(p.h))
+	runtime.KeepAlive(p.ds)
+	return dataType
+}
+
+// ColorInterp returns the color interpretation of the band.
+func (p *Band) ColorInterp() GDALColorInterp {
+	if p.ds.h == nil {
+		return GCI_Undefined
+	}
+	colorInterp := GDALColorInterp(C.GDALGetRasterColorInterpretation(p.h))
+	runtime.KeepAlive(p.ds)
+	return colorInterp
+}
+
+// SetColorInterp sets the color interpretation of the band, like
+// GCI_AlphaBand.
+func (p *Band) SetColorInterp(colorInterp GDALColorInterp) error {
+	if p.ds.h == nil {
+		return errClosed
+	}
+	rv := C.GDALSetRasterColorInterpretation(p.h, C.GDALColorInterp(colorInterp))
+	runtime.KeepAlive(p.ds)
+	if rv != C.CE_None {
+		return gdalLastError("SetColorInterp", "")
+	}
+	p.ds.config.ColorModel, p.ds.err = bandsColorModel(p.ds.bands)
+	return nil
+}
+
+// Description returns the description of the band, which is used as the
+// band name.
+func (p *Band) Description() string {
+	if p.ds.h == nil {
+		return ""
+	}
+	name := C.GoString(C.GDALGetDescription(C.GDALMajorObjectH(p.h)))
+	runtime.KeepAlive(p.ds)
+	return name
+}
+
+// NoData returns the nodata value of the band, ok is false if the band
+// has no nodata value.
+func (p *Band) NoData() (v float64, ok bool) {
+	if p.ds.h == nil {
+		return
+	}
+	var success C.int
+	v = float64(C.GDALGetRasterNoDataValue(p.h, &success))
+	runtime.KeepAlive(p.ds)
+	return v, success != 0
+}
+
+// SetNoData sets the nodata value of the band.
+func (p *Band) SetNoData(v float64) error {
+	if p.ds.h == nil {
+		return errClosed
+	}
+	rv := C.GDALSetRasterNoDataValue(p.h, C.double(v))
+	runtime.KeepAlive(p.ds)
+	if rv != C.CE_None {
+		return gdalLastError("SetNoData", "")
+	}
+	p.ds.config.ColorModel, p.ds.err = bandsColorModel(p.ds.bands)
+	return nil
+}
+
+// ReadRect reads the pixels of the band inside r, the bounds of the returned
+// image is r intersected with the dataset bounds. The samples of Byte, UInt16,
+// Int16, Int32, Float32 and Float64 are read as image.Gray, image.Gray16,
+// image_ext.Gray16s, image_ext.Gray32i, image_ext.Gray32f and image_ext.Gray64f,
+// the datasets of 3 bands are read as image_ext.RGB, image_ext.RGB48 and so on,
+// and the datasets of 4 bytes or uint16 bands with alpha are read as
+// image.NRGBA and image.NRGBA64. Other datasets are read as
+// image_ext.MultiBand.
+// If buf is not nil and covers r, it is used as the pixels buffer.
+func (p *Band) ReadRect(r image.Rectangle, buf image_ext.ImageBuffer) (m image.Image, err error) {
+	model, err := bandsColorModel([]*Band{p})
+	if err != nil {
+		return
+	}
+	return readRect(p.ds, []*Band{p}, model, r, buf)
+}
+
+// WriteRect writes the pixels of m inside r to the same rectangle of the
+// band, the pixels are converted to the color model of ReadRect if needed.
+func (p *Band) WriteRect(r image.Rectangle, m image.Image) error {
+	model, err := bandsColorModel([]*Band{p})
+	if err != nil {
+		return err
+	}
+	return writeRect(p.ds, []*Band{p}, model, r, m)
+}
+
+var errClosed = fmt.Errorf("image/gdal: the dataset is closed")
+
+func gdalLastError(op, name string) error {
+	msg := C.GoString(C.CPLGetLastErrorMsg())
+	if name != "" {
+		return fmt.Errorf("image/gdal: %s %q, %s", op, name, msg)
+	}
+	return fmt.Errorf("image/gdal: %s, %s", op, msg)
+}
+
+func readRect(ds *Dataset, bands []*Band, model color.Model, r image.Rectangle, buf image_ext.ImageBuffer) (m image.Image, err error) {
+	if ds.h == nil {
+		return nil, errClosed
+	}
+	r = r.Intersect(ds.Bounds())
+	if r.Empty() {
+		return nil, fmt.Errorf("image/gdal: ReadRect, empty rect: %v", r)
+	}
+	var dst image.Image
+	if buf != nil && r.In(buf.Bounds()) && buf.ColorModel() == model {
+		dst = buf.SubImage(r)
+	} else {
+		dst = newImage(r, model)
+	}
+	pix, ok := newPixLayout(dst)
+	if !ok || len(pix.bands) != len(bands) {
+		return nil, fmt.Errorf("image/gdal: ReadRect, unsupported image %T", dst)
+	}
+	for i, b := range bands {
+		if err = pix.rasterIO(C.GF_Read, b, i); err != nil {
+			return
+		}
+	}
+	// the finalizer of ds must not close the bands during RasterIO
+	runtime.KeepAlive(ds)
+	pix.toBigEndian()
+	return dst, nil
+}
+
+func writeRect(ds *Dataset, bands []*Band, model color.Model, r image.Rectangle, m image.Image) (err error) {
+	if ds.h == nil {
+		return errClosed
+	}
+	r = r.Intersect(ds.Bounds()).Intersect(m.Bounds())
+	if r.Empty() {
+		return fmt.Errorf("image/gdal: WriteRect, empty rect: %v", r)
+	}
+	pix, ok := newPixLayout(subImage(m, r))
+	if !ok || len(pix.bands) != len(bands) || pix.bigEndian {
+		// convert the pixels, the big endian samples are swapped
+		dst := newImage(r, model)
+		if dst == nil {
+			return fmt.Errorf("image/gdal: WriteRect, unsupported image %T", m)
+		}
+		if pix, ok = newPixLayout(dst); !ok || len(pix.bands) != len(bands) {
+			return fmt.Errorf("image/gdal: WriteRect, unsupported image %T", m)
+		}
+		draw.Draw(dst.(draw.Image), r, m, r.Min, draw.Src)
+		pix.toNative()
+	}
+	for i, b := range bands {
+		if err = pix.rasterIO(C.GF_Write, b, i); err != nil {
+			return
+		}
+	}
+	runtime.KeepAlive(ds)
+	return
+}
+
+func subImage(m image.Image, r image.Rectangle) image.Image {
+	if m, ok := m.(interface {
+		SubImage(r image.Rectangle) image.Image
+	}); ok {
+		return m.SubImage(r)
+	}
+	return m
+}
@@ -3,4 +3,10 @@
 // license that can be found in the LICENSE file.
 
 // Bindings for GDAL - Geospatial Data Abstraction Library
+//
+// The Dataset and Band types wrap the GDAL handles, the pixels are read and
+// written as the image types of github.com/chai2010/gopkg/image. The GDAL
+// raster formats are registered as the fallback format "gdal" of
+// github.com/chai2010/gopkg/image, they are tried by Decode and Load if no
+// other registered format matches the data.
 package gdal
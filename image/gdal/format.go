@@ -0,0 +1,80 @@
+// Copyright 2014 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gdal
+
+import (
+	"image"
+	"io"
+	"io/ioutil"
+
+	image_ext "github.com/chai2010/gopkg/image"
+	"github.com/chai2010/gopkg/image/convert"
+)
+
+// The GDAL raster formats are registered as the fallback format "gdal",
+// they are used by image_ext.Decode, image_ext.DecodeConfig and
+// image_ext.Load if no registered format matches the data.
+
+func decodeConfig(r io.Reader) (config image.Config, err error) {
+	ds, err := openReader(r)
+	if err != nil {
+		return
+	}
+	defer ds.Close()
+	if ds.err != nil {
+		return config, ds.err
+	}
+	return ds.Config(), nil
+}
+
+func imageExtDecode(r io.Reader, opt *image_ext.Options) (m image.Image, err error) {
+	ds, err := openReader(r)
+	if err != nil {
+		return
+	}
+	defer ds.Close()
+	return readImage(ds, opt)
+}
+
+// loadFile opens the file by name, so the sidecar files are read, like the
+// .hdr file of ENVI.
+func loadFile(filename string, opt *image_ext.Options) (m image.Image, err error) {
+	ds, err := Open(filename, GA_ReadOnly)
+	if err != nil {
+		return nil, image.ErrFormat
+	}
+	defer ds.Close()
+	return readImage(ds, opt)
+}
+
+func openReader(r io.Reader) (ds *Dataset, err error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return
+	}
+	if ds, err = OpenBytes(data); err != nil {
+		return nil, image.ErrFormat
+	}
+	return
+}
+
+func readImage(ds *Dataset, opt *image_ext.Options) (m image.Image, err error) {
+	if m, err = ds.ReadRect(ds.Bounds(), nil); err != nil {
+		return
+	}
+	if opt != nil && opt.ColorModel != nil {
+		m = convert.ColorModel(m, opt.ColorModel)
+	}
+	return
+}
+
+func init() {
+	image_ext.RegisterFallbackFormat(image_ext.Format{
+		Name:         "gdal",
+		DecodeConfig: decodeConfig,
+		Decode:       imageExtDecode,
+		LoadFile:     loadFile,
+	})
+}
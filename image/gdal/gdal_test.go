@@ -3,3 +3,221 @@
 // license that can be found in the LICENSE file.
 
 package gdal
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	image_ext "github.com/chai2010/gopkg/image"
+	color_ext "github.com/chai2010/gopkg/image/color"
+)
+
+// tFillImage fills the image with different values of all the samples.
+func tFillImage(m image_ext.ImageBuffer) image_ext.ImageBuffer {
+	b := m.Bounds()
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			v := uint16(x*2357 + y*977)
+			if mb, ok := m.(*image_ext.MultiBand); ok {
+				for k := range mb.Model.Band {
+					mb.SetValue(x, y, k, float64(int(v)*(k+1)%250))
+				}
+				continue
+			}
+			m.Set(x, y, color.NRGBA64{v, v * 3, v * 7, v | 0x8000})
+		}
+	}
+	return m
+}
+
+// tEqualPix reports whether the pixels of m0 and m1 are the same.
+func tEqualPix(m0, m1 image.Image) bool {
+	p0, ok0 := newPixLayout(m0)
+	p1, ok1 := newPixLayout(m1)
+	if !ok0 || !ok1 || !p0.rect.Eq(p1.rect) || p0.pixSize != p1.pixSize {
+		return false
+	}
+	for y := 0; y < p0.rect.Dy(); y++ {
+		n := p0.rect.Dx() * p0.pixSize
+		if !bytes.Equal(p0.pix[y*p0.stride:][:n], p1.pix[y*p1.stride:][:n]) {
+			return false
+		}
+	}
+	return true
+}
+
+func TestDataset_ReadWriteRect(t *testing.T) {
+	r := image.Rect(0, 0, 37, 21)
+	for i, v := range []struct {
+		m        image_ext.ImageBuffer
+		dataType GDALDataType
+		bands    int
+	}{
+		{image.NewGray(r), GDT_Byte, 1},
+		{image.NewGray16(r), GDT_UInt16, 1},
+		{image_ext.NewGray16s(r), GDT_Int16, 1},
+		{image_ext.NewGray32i(r), GDT_Int32, 1},
+		{image_ext.NewGray32f(r), GDT_Float32, 1},
+		{image_ext.NewGray64f(r), GDT_Float64, 1},
+		{image_ext.NewRGB(r), GDT_Byte, 3},
+		{image_ext.NewRGB48(r), GDT_UInt16, 3},
+		{image_ext.NewRGB48s(r), GDT_Int16, 3},
+		{image_ext.NewRGB96i(r), GDT_Int32, 3},
+		{image_ext.NewRGB96f(r), GDT_Float32, 3},
+		{image_ext.NewRGB192f(r), GDT_Float64, 3},
+		{image.NewNRGBA(r), GDT_Byte, 4},
+		{image.NewNRGBA64(r), GDT_UInt16, 4},
+		{image_ext.NewMultiBand(r, color_ext.NewMultiBandModel(
+			color_ext.BandInfo{DataType: reflect.Uint8},
+			color_ext.BandInfo{DataType: reflect.Uint8},
+			color_ext.BandInfo{DataType: reflect.Uint8},
+			color_ext.BandInfo{DataType: reflect.Uint8},
+			color_ext.BandInfo{DataType: reflect.Uint8},
+		)), GDT_Byte, 5},
+	} {
+		ds, err := Create("MEM", "", r.Dx(), r.Dy(), v.bands, v.dataType, nil)
+		if err != nil {
+			t.Fatalf("%d: %v", i, err)
+		}
+		if v.bands == 4 {
+			if err = ds.Band(3).SetColorInterp(GCI_AlphaBand); err != nil {
+				t.Fatalf("%d: %v", i, err)
+			}
+		}
+		if _, ok := v.m.(*image_ext.MultiBand); !ok && ds.Config().ColorModel != v.m.ColorModel() {
+			t.Fatalf("%d: bad color model, %T", i, ds.Config().ColorModel)
+		}
+
+		m0 := tFillImage(v.m)
+		if err = ds.WriteRect(r, m0); err != nil {
+			t.Fatalf("%d: %v", i, err)
+		}
+		m1, err := ds.ReadRect(r, nil)
+		if err != nil {
+			t.Fatalf("%d: %v", i, err)
+		}
+		if !tEqualPix(m0, m1) {
+			t.Fatalf("%d: %T, pixels differ", i, m1)
+		}
+
+		// read a rectangle into the buffer
+		sub := image.Rect(3, 5, 20, 18)
+		buf := newImage(r, m1.ColorModel()).(image_ext.ImageBuffer)
+		m2, err := ds.ReadRect(sub, buf)
+		if err != nil {
+			t.Fatalf("%d: %v", i, err)
+		}
+		if m2.Bounds() != sub || !tEqualPix(m0.SubImage(sub), m2) || !tEqualPix(m2, buf.SubImage(sub)) {
+			t.Fatalf("%d: bad rectangle, %v", i, m2.Bounds())
+		}
+		ds.Close()
+	}
+}
+
+func TestDataset_WriteRect_convert(t *testing.T) {
+	ds, err := Create("MEM", "", 10, 10, 1, GDT_Float32, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ds.Close()
+
+	gray := tFillImage(image.NewGray16(image.Rect(0, 0, 10, 10))).(*image.Gray16)
+	if err = ds.WriteRect(gray.Bounds(), gray); err != nil {
+		t.Fatal(err)
+	}
+	m, err := ds.Band(0).ReadRect(image.Rect(2, 3, 8, 9), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gray32f, ok := m.(*image_ext.Gray32f)
+	if !ok {
+		t.Fatalf("bad image type, %T", m)
+	}
+	for y := 3; y < 9; y++ {
+		for x := 2; x < 8; x++ {
+			if v0, v1 := float32(gray.Gray16At(x, y).Y), gray32f.Gray32fAt(x, y).Y; v0 != v1 {
+				t.Fatalf("pixel(%d, %d), expect = %v, got = %v", x, y, v0, v1)
+			}
+		}
+	}
+}
+
+func TestDataset_GeoTransform(t *testing.T) {
+	ds, err := Create("MEM", "", 4, 4, 1, GDT_Byte, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if gt := ds.GeoTransform(); !gt.IsZero() {
+		t.Fatalf("expect zero GeoTransform, got %v", gt)
+	}
+	gt := image_ext.NewGeoTransform(440720, 3751320, 60, 60)
+	if err = ds.SetGeoTransform(gt); err != nil {
+		t.Fatal(err)
+	}
+	if v := ds.GeoTransform(); v != gt {
+		t.Fatalf("bad GeoTransform, expect = %v, got = %v", gt, v)
+	}
+	const wkt = `GEOGCS["WGS 84",DATUM["WGS_1984",SPHEROID["WGS 84",6378137,298.257223563]],PRIMEM["Greenwich",0],UNIT["degree",0.0174532925199433]]`
+	if err = ds.SetProjection(wkt); err != nil {
+		t.Fatal(err)
+	}
+	if v := ds.Projection(); v == "" {
+		t.Fatal("empty Projection")
+	}
+
+	ds.Close()
+	ds.Close()
+	if _, err = ds.ReadRect(ds.Bounds(), nil); err == nil {
+		t.Fatal("expect error, the dataset is closed")
+	}
+}
+
+func TestFallbackFormat(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gdal")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	filename := filepath.Join(dir, "a.tif")
+	ds, err := Create("GTiff", filename, 16, 8, 1, GDT_UInt16, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m0 := tFillImage(image.NewGray16(image.Rect(0, 0, 16, 8)))
+	if err = ds.WriteRect(m0.Bounds(), m0); err != nil {
+		t.Fatal(err)
+	}
+	if err = ds.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// the tiff package is not imported, so the data is read by GDAL
+	m1, format, err := image_ext.Load(filename, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if format != "gdal" || !tEqualPix(m0, m1) {
+		t.Fatalf("Load: bad image, format = %q", format)
+	}
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m2, format, err := image_ext.Decode(bytes.NewReader(data), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if format != "gdal" || !tEqualPix(m0, m2) {
+		t.Fatalf("Decode: bad image, format = %q", format)
+	}
+	if _, _, err = image_ext.Decode(bytes.NewReader([]byte("unknown data")), nil); err != image.ErrFormat {
+		t.Fatalf("expect image.ErrFormat, got %v", err)
+	}
+}
@@ -7,6 +7,7 @@
 
 #include <gdal.h>
 #include <cpl_conv.h>
+#include <cpl_vsi.h>
 
 // transform GDALProgressFunc to go func
 GDALProgressFunc goGDALProgressFuncProxyB();
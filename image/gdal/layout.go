@@ -0,0 +1,267 @@
+// Copyright 2014 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gdal
+
+/*
+#include "go_gdal.h"
+*/
+import "C"
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"reflect"
+	"unsafe"
+
+	"github.com/chai2010/gopkg/builtin"
+	image_ext "github.com/chai2010/gopkg/image"
+	color_ext "github.com/chai2010/gopkg/image/color"
+)
+
+// pixLayout is the layout of the samples of an image, the bands of a pixel
+// are interleaved.
+type pixLayout struct {
+	pix       []byte
+	stride    int
+	rect      image.Rectangle
+	pixSize   int
+	bands     []pixBand
+	bigEndian bool // the uint16 samples are big endian, as image.Gray16
+}
+
+type pixBand struct {
+	off      int // the offset in the pixel
+	dataType GDALDataType
+}
+
+func newPixLayout(m image.Image) (p *pixLayout, ok bool) {
+	bands := func(dataType GDALDataType, size, n int) []pixBand {
+		v := make([]pixBand, n)
+		for i := range v {
+			v[i] = pixBand{off: i * size, dataType: dataType}
+		}
+		return v
+	}
+	switch m := m.(type) {
+	case *image.Gray:
+		p = &pixLayout{m.Pix, m.Stride, m.Rect, 1, bands(GDT_Byte, 1, 1), false}
+	case *image.Gray16:
+		p = &pixLayout{m.Pix, m.Stride, m.Rect, 2, bands(GDT_UInt16, 2, 1), true}
+	case *image_ext.Gray16s:
+		p = &pixLayout{m.Pix, m.Stride, m.Rect, 2, bands(GDT_Int16, 2, 1), false}
+	case *image_ext.Gray32i:
+		p = &pixLayout{m.Pix, m.Stride, m.Rect, 4, bands(GDT_Int32, 4, 1), false}
+	case *image_ext.Gray32f:
+		p = &pixLayout{m.Pix, m.Stride, m.Rect, 4, bands(GDT_Float32, 4, 1), false}
+	case *image_ext.Gray64f:
+		p = &pixLayout{m.Pix, m.Stride, m.Rect, 8, bands(GDT_Float64, 8, 1), false}
+	case *image_ext.RGB:
+		p = &pixLayout{m.Pix, m.Stride, m.Rect, 3, bands(GDT_Byte, 1, 3), false}
+	case *image_ext.RGB48:
+		p = &pixLayout{m.Pix, m.Stride, m.Rect, 6, bands(GDT_UInt16, 2, 3), true}
+	case *image_ext.RGB48s:
+		p = &pixLayout{m.Pix, m.Stride, m.Rect, 6, bands(GDT_Int16, 2, 3), false}
+	case *image_ext.RGB96i:
+		p = &pixLayout{m.Pix, m.Stride, m.Rect, 12, bands(GDT_Int32, 4, 3), false}
+	case *image_ext.RGB96f:
+		p = &pixLayout{m.Pix, m.Stride, m.Rect, 16, bands(GDT_Float32, 4, 3), false}
+	case *image_ext.RGB192f:
+		p = &pixLayout{m.Pix, m.Stride, m.Rect, 24, bands(GDT_Float64, 8, 3), false}
+	case *image.NRGBA:
+		p = &pixLayout{m.Pix, m.Stride, m.Rect, 4, bands(GDT_Byte, 1, 4), false}
+	case *image.NRGBA64:
+		p = &pixLayout{m.Pix, m.Stride, m.Rect, 8, bands(GDT_UInt16, 2, 4), true}
+	case *image_ext.MultiBand:
+		p = &pixLayout{pix: m.Pix, stride: m.Stride, rect: m.Rect, pixSize: m.Model.PixelSize()}
+		for k, b := range m.Model.Band {
+			dataType, ok := kindDataType(b.DataType)
+			if !ok {
+				return nil, false
+			}
+			p.bands = append(p.bands, pixBand{off: m.PixOffset(m.Rect.Min.X, m.Rect.Min.Y, k) - m.PixOffset(m.Rect.Min.X, m.Rect.Min.Y, 0), dataType: dataType})
+		}
+	default:
+		return nil, false
+	}
+	return p, true
+}
+
+// rasterIO reads or writes the band k of the pixels.
+func (p *pixLayout) rasterIO(flag C.GDALRWFlag, band *Band, k int) error {
+	if p.rect.Empty() {
+		return nil
+	}
+	w, h := p.rect.Dx(), p.rect.Dy()
+	rv := C.GDALRasterIO(band.h, flag,
+		C.int(p.rect.Min.X), C.int(p.rect.Min.Y), C.int(w), C.int(h),
+		unsafe.Pointer(&p.pix[p.bands[k].off]), C.int(w), C.int(h),
+		C.GDALDataType(p.bands[k].dataType), C.int(p.pixSize), C.int(p.stride),
+	)
+	if rv != C.CE_None {
+		return gdalLastError("RasterIO", "")
+	}
+	return nil
+}
+
+// toBigEndian converts the native uint16 samples of GDAL to big endian.
+func (p *pixLayout) toBigEndian() {
+	if p.bigEndian {
+		p.swap16(func(b []byte) {
+			v := builtin.Uint16(b)
+			b[0], b[1] = uint8(v>>8), uint8(v)
+		})
+	}
+}
+
+// toNative converts the big endian uint16 samples to native for GDAL.
+func (p *pixLayout) toNative() {
+	if p.bigEndian {
+		p.swap16(func(b []byte) {
+			builtin.PutUint16(b, uint16(b[0])<<8|uint16(b[1]))
+		})
+	}
+}
+
+func (p *pixLayout) swap16(fn func(b []byte)) {
+	for y := 0; y < p.rect.Dy(); y++ {
+		row := p.pix[y*p.stride:]
+		for x := 0; x < p.rect.Dx(); x++ {
+			for i := 0; i < p.pixSize; i += 2 {
+				fn(row[x*p.pixSize+i:])
+			}
+		}
+	}
+}
+
+func kindDataType(kind reflect.Kind) (dataType GDALDataType, ok bool) {
+	switch kind {
+	case reflect.Uint8:
+		return GDT_Byte, true
+	case reflect.Uint16:
+		return GDT_UInt16, true
+	case reflect.Int16:
+		return GDT_Int16, true
+	case reflect.Int32:
+		return GDT_Int32, true
+	case reflect.Float32:
+		return GDT_Float32, true
+	case reflect.Float64:
+		return GDT_Float64, true
+	}
+	return GDT_Unknown, false
+}
+
+// dataTypeKind returns the sample type of the GDAL data type, the UInt32
+// samples are read as Float64.
+func dataTypeKind(dataType GDALDataType) (kind reflect.Kind, ok bool) {
+	switch dataType {
+	case GDT_Byte:
+		return reflect.Uint8, true
+	case GDT_UInt16:
+		return reflect.Uint16, true
+	case GDT_Int16:
+		return reflect.Int16, true
+	case GDT_Int32:
+		return reflect.Int32, true
+	case GDT_Float32:
+		return reflect.Float32, true
+	case GDT_UInt32, GDT_Float64:
+		return reflect.Float64, true
+	}
+	return reflect.Invalid, false
+}
+
+// bandsColorModel returns the color model of the image of the bands, see
+// Band.ReadRect.
+func bandsColorModel(bands []*Band) (model color.Model, err error) {
+	if len(bands) == 0 {
+		return nil, fmt.Errorf("image/gdal: no raster band")
+	}
+	kind, ok := dataTypeKind(bands[0].DataType())
+	for _, b := range bands[1:] {
+		if k, _ := dataTypeKind(b.DataType()); k != kind {
+			ok = false
+		}
+	}
+	if ok {
+		switch {
+		case len(bands) == 1:
+			model = map[reflect.Kind]color.Model{
+				reflect.Uint8:   color.GrayModel,
+				reflect.Uint16:  color.Gray16Model,
+				reflect.Int16:   color_ext.Gray16sModel,
+				reflect.Int32:   color_ext.Gray32iModel,
+				reflect.Float32: color_ext.Gray32fModel,
+				reflect.Float64: color_ext.Gray64fModel,
+			}[kind]
+		case len(bands) == 3:
+			model = map[reflect.Kind]color.Model{
+				reflect.Uint8:   color_ext.RGBModel,
+				reflect.Uint16:  color_ext.RGB48Model,
+				reflect.Int16:   color_ext.RGB48sModel,
+				reflect.Int32:   color_ext.RGB96iModel,
+				reflect.Float32: color_ext.RGB96fModel,
+				reflect.Float64: color_ext.RGB192fModel,
+			}[kind]
+		case len(bands) == 4 && bands[3].ColorInterp() == GCI_AlphaBand:
+			model = map[reflect.Kind]color.Model{
+				reflect.Uint8:  color.NRGBAModel,
+				reflect.Uint16: color.NRGBA64Model,
+			}[kind]
+		}
+		if model != nil {
+			return
+		}
+	}
+
+	info := make([]color_ext.BandInfo, len(bands))
+	for i, b := range bands {
+		if info[i].DataType, ok = dataTypeKind(b.DataType()); !ok {
+			return nil, fmt.Errorf("image/gdal: unsupported data type, %s, band %d", GDALGetDataTypeName(b.DataType()), i)
+		}
+		info[i].Name = b.Description()
+		info[i].NoData, info[i].HasNoData = b.NoData()
+	}
+	return color_ext.NewMultiBandModel(info...), nil
+}
+
+// newImage returns a new image of the color model, or nil if the model is
+// not supported.
+func newImage(r image.Rectangle, model color.Model) image.Image {
+	switch model {
+	case color.GrayModel:
+		return image.NewGray(r)
+	case color.Gray16Model:
+		return image.NewGray16(r)
+	case color_ext.Gray16sModel:
+		return image_ext.NewGray16s(r)
+	case color_ext.Gray32iModel:
+		return image_ext.NewGray32i(r)
+	case color_ext.Gray32fModel:
+		return image_ext.NewGray32f(r)
+	case color_ext.Gray64fModel:
+		return image_ext.NewGray64f(r)
+	case color_ext.RGBModel:
+		return image_ext.NewRGB(r)
+	case color_ext.RGB48Model:
+		return image_ext.NewRGB48(r)
+	case color_ext.RGB48sModel:
+		return image_ext.NewRGB48s(r)
+	case color_ext.RGB96iModel:
+		return image_ext.NewRGB96i(r)
+	case color_ext.RGB96fModel:
+		return image_ext.NewRGB96f(r)
+	case color_ext.RGB192fModel:
+		return image_ext.NewRGB192f(r)
+	case color.NRGBAModel:
+		return image.NewNRGBA(r)
+	case color.NRGBA64Model:
+		return image.NewNRGBA64(r)
+	}
+	if model, ok := model.(*color_ext.MultiBandModel); ok {
+		return image_ext.NewMultiBand(r, model)
+	}
+	return nil
+}
@@ -0,0 +1,218 @@
+// Copyright 2014 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package image
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// GeoTransform is the affine transform from the pixel coordinates to the
+// world coordinates, in the GDAL order:
+//
+//	X = GeoTransform[0] + x*GeoTransform[1] + y*GeoTransform[2]
+//	Y = GeoTransform[3] + x*GeoTransform[4] + y*GeoTransform[5]
+//
+// The pixel (x, y) is the upper-left corner of the pixel, the center of
+// the pixel is (x+0.5, y+0.5). The zero GeoTransform means the raster is
+// not georeferenced.
+type GeoTransform [6]float64
+
+// NewGeoTransform returns a north-up GeoTransform, (originX, originY) is
+// the upper-left corner of the raster, and the pixel size is positive.
+func NewGeoTransform(originX, originY, pixelWidth, pixelHeight float64) GeoTransform {
+	return GeoTransform{originX, pixelWidth, 0, originY, 0, -pixelHeight}
+}
+
+// IsZero reports whether p is the zero GeoTransform.
+func (p GeoTransform) IsZero() bool {
+	return p == GeoTransform{}
+}
+
+// Origin returns the world coordinates of the pixel coordinates (0, 0).
+func (p GeoTransform) Origin() (x, y float64) {
+	return p[0], p[3]
+}
+
+// PixelSize returns the width and height of a pixel in the world units,
+// the rotation terms are included.
+func (p GeoTransform) PixelSize() (dx, dy float64) {
+	return math.Hypot(p[1], p[4]), math.Hypot(p[2], p[5])
+}
+
+// PixelToWorld converts the pixel coordinates to the world coordinates.
+func (p GeoTransform) PixelToWorld(x, y float64) (wx, wy float64) {
+	wx = p[0] + x*p[1] + y*p[2]
+	wy = p[3] + x*p[4] + y*p[5]
+	return
+}
+
+// WorldToPixel converts the world coordinates to the pixel coordinates,
+// ok is false if p is not invertible.
+func (p GeoTransform) WorldToPixel(wx, wy float64) (x, y float64, ok bool) {
+	inv, ok := p.Invert()
+	if !ok {
+		return
+	}
+	x, y = inv.PixelToWorld(wx, wy)
+	return
+}
+
+// Invert returns the inverse transform, ok is false if p is not
+// invertible.
+func (p GeoTransform) Invert() (inv GeoTransform, ok bool) {
+	det := p[1]*p[5] - p[2]*p[4]
+	if det == 0 || math.IsNaN(det) || math.IsInf(det, 0) {
+		return
+	}
+	inv[1] = p[5] / det
+	inv[2] = -p[2] / det
+	inv[4] = -p[4] / det
+	inv[5] = p[1] / det
+	inv[0] = -(inv[1]*p[0] + inv[2]*p[3])
+	inv[3] = -(inv[4]*p[0] + inv[5]*p[3])
+	ok = true
+	return
+}
+
+// Scale returns the GeoTransform whose pixels are k times the pixels of
+// p, such as the GeoTransform of the next pyramid level with k = 2. The
+// origin is not changed.
+func (p GeoTransform) Scale(k float64) GeoTransform {
+	return GeoTransform{p[0], p[1] * k, p[2] * k, p[3], p[4] * k, p[5] * k}
+}
+
+// Translate returns the GeoTransform whose pixel (0, 0) is the pixel
+// (x, y) of p, such as the GeoTransform of a sub image.
+func (p GeoTransform) Translate(x, y float64) GeoTransform {
+	p[0], p[3] = p.PixelToWorld(x, y)
+	return p
+}
+
+// WorldFileName returns the world file name of the image file, the world
+// file extension is made of the first and last letters of the image file
+// extension and a "w", such as ".tfw" for ".tif" and ".jgw" for ".jpg".
+func WorldFileName(filename string) string {
+	ext := filepath.Ext(filename)
+	base := filename[:len(filename)-len(ext)]
+	switch {
+	case len(ext) >= 3:
+		return base + ext[:2] + ext[len(ext)-1:] + "w"
+	case len(ext) == 2:
+		return base + ext + "w"
+	}
+	return filename + ".wld"
+}
+
+// ReadWorldFile reads a world file. The world file has six lines:
+// the pixel width, the y rotation, the x rotation, the pixel height
+// (negative for north-up), and the world coordinates of the center of
+// the upper-left pixel.
+func ReadWorldFile(r io.Reader) (p GeoTransform, err error) {
+	var v [6]float64
+	var n int
+	s := bufio.NewScanner(r)
+	for s.Scan() {
+		line := strings.TrimSpace(s.Text())
+		if line == "" {
+			continue
+		}
+		if n >= len(v) {
+			err = fmt.Errorf("image: ReadWorldFile, too many lines")
+			return
+		}
+		if v[n], err = strconv.ParseFloat(line, 64); err != nil {
+			err = fmt.Errorf("image: ReadWorldFile, bad line %d: %v", n+1, err)
+			return
+		}
+		n++
+	}
+	if err = s.Err(); err != nil {
+		err = fmt.Errorf("image: ReadWorldFile, %v", err)
+		return
+	}
+	if n != len(v) {
+		err = fmt.Errorf("image: ReadWorldFile, bad lines: %d", n)
+		return
+	}
+	a, d, b, e, c, f := v[0], v[1], v[2], v[3], v[4], v[5]
+	p = GeoTransform{c - a/2 - b/2, a, b, f - d/2 - e/2, d, e}
+	return
+}
+
+// WriteWorldFile writes p as a world file, see ReadWorldFile.
+func WriteWorldFile(w io.Writer, p GeoTransform) (err error) {
+	cx, cy := p.PixelToWorld(0.5, 0.5)
+	for _, v := range []float64{p[1], p[4], p[2], p[5], cx, cy} {
+		if _, err = fmt.Fprintln(w, strconv.FormatFloat(v, 'f', -1, 64)); err != nil {
+			return
+		}
+	}
+	return
+}
+
+// LoadWorldFile reads the world file of the image file, see WorldFileName.
+func LoadWorldFile(filename string) (p GeoTransform, err error) {
+	f, err := os.Open(WorldFileName(filename))
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	return ReadWorldFile(f)
+}
+
+// SaveWorldFile writes the world file of the image file, see
+// WorldFileName.
+func SaveWorldFile(filename string, p GeoTransform) (err error) {
+	f, err := os.Create(WorldFileName(filename))
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	return WriteWorldFile(f, p)
+}
+
+// GeoTransform returns the GeoTransform of the GeoTIFF tags, from the
+// ModelTransformation tag, or the ModelTiepoint and ModelPixelScale tags.
+// The raster is assumed to be PixelIsArea.
+func (p *GeoTIFF) GeoTransform() (gt GeoTransform, ok bool) {
+	if p == nil {
+		return
+	}
+	if v := p.ModelTransformation; len(v) >= 16 {
+		return GeoTransform{v[3], v[0], v[1], v[7], v[4], v[5]}, true
+	}
+	if len(p.ModelTiepoint) >= 6 && len(p.ModelPixelScale) >= 2 {
+		t, s := p.ModelTiepoint, p.ModelPixelScale
+		gt = GeoTransform{t[3] - t[0]*s[0], s[0], 0, t[4] + t[1]*s[1], 0, -s[1]}
+		return gt, true
+	}
+	return
+}
+
+// SetGeoTransform sets the ModelTiepoint and ModelPixelScale tags, or the
+// ModelTransformation tag if gt is rotated.
+func (p *GeoTIFF) SetGeoTransform(gt GeoTransform) {
+	if gt[2] == 0 && gt[4] == 0 {
+		p.ModelTiepoint = []float64{0, 0, 0, gt[0], gt[3], 0}
+		p.ModelPixelScale = []float64{gt[1], -gt[5], 0}
+		p.ModelTransformation = nil
+		return
+	}
+	p.ModelTiepoint = nil
+	p.ModelPixelScale = nil
+	p.ModelTransformation = []float64{
+		gt[1], gt[2], 0, gt[0],
+		gt[4], gt[5], 0, gt[3],
+		0, 0, 0, 0,
+		0, 0, 0, 1,
+	}
+}
@@ -0,0 +1,115 @@
+// Copyright 2014 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package image_test
+
+import (
+	"bytes"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+
+	image_ext "github.com/chai2010/gopkg/image"
+)
+
+func tNearlyEqual(a, b float64) bool {
+	return math.Abs(a-b) <= 1e-9*math.Max(1, math.Max(math.Abs(a), math.Abs(b)))
+}
+
+func TestGeoTransform(t *testing.T) {
+	for i, gt := range []image_ext.GeoTransform{
+		image_ext.NewGeoTransform(116.3, 39.9, 0.5, 0.25),
+		{500000, 30, 5, 4200000, 4, -30},
+	} {
+		for _, pt := range [][2]float64{{0, 0}, {0.5, 0.5}, {100, 20}, {-3, 7.25}} {
+			wx, wy := gt.PixelToWorld(pt[0], pt[1])
+			x, y, ok := gt.WorldToPixel(wx, wy)
+			if !ok || !tNearlyEqual(x, pt[0]) || !tNearlyEqual(y, pt[1]) {
+				t.Fatalf("%d: bad round trip of %v: got (%v, %v, %v)", i, pt, x, y, ok)
+			}
+		}
+	}
+
+	gt := image_ext.NewGeoTransform(100, 200, 2, 3)
+	if x, y := gt.PixelToWorld(10, 10); x != 120 || y != 170 {
+		t.Fatalf("bad PixelToWorld: (%v, %v)", x, y)
+	}
+	if dx, dy := gt.Scale(4).PixelSize(); dx != 8 || dy != 12 {
+		t.Fatalf("bad Scale: (%v, %v)", dx, dy)
+	}
+	if x, y := gt.Translate(5, 1).Origin(); x != 110 || y != 197 {
+		t.Fatalf("bad Translate: (%v, %v)", x, y)
+	}
+	if _, _, ok := (image_ext.GeoTransform{}).WorldToPixel(1, 1); ok {
+		t.Fatalf("zero GeoTransform: expect not invertible")
+	}
+}
+
+func TestWorldFile(t *testing.T) {
+	for i, v := range [][2]string{
+		{"a.tif", "a.tfw"},
+		{"a/b.jpg", "a/b.jgw"},
+		{"c.tiff", "c.tfw"},
+		{"d.png", "d.pgw"},
+		{"e", "e.wld"},
+	} {
+		if got := image_ext.WorldFileName(v[0]); got != v[1] {
+			t.Fatalf("%d: WorldFileName(%q): got %q, want %q", i, v[0], got, v[1])
+		}
+	}
+
+	gt := image_ext.GeoTransform{500000, 30, 0.5, 4200000, -0.25, -30}
+	var buf bytes.Buffer
+	if err := image_ext.WriteWorldFile(&buf, gt); err != nil {
+		t.Fatal(err)
+	}
+	if want := "30\n-0.25\n0.5\n-30\n500015.25\n4199984.875\n"; buf.String() != want {
+		t.Fatalf("bad world file: %q, want %q", buf.String(), want)
+	}
+	got, err := image_ext.ReadWorldFile(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != gt {
+		t.Fatalf("bad ReadWorldFile: got %v, want %v", got, gt)
+	}
+	if _, err := image_ext.ReadWorldFile(bytes.NewBufferString("1\n0\n0\n-1\n")); err == nil {
+		t.Fatalf("short world file: expect error")
+	}
+
+	dir, err := ioutil.TempDir("", "geo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	name := filepath.Join(dir, "dem.tif")
+	if err = image_ext.SaveWorldFile(name, gt); err != nil {
+		t.Fatal(err)
+	}
+	if got, err = image_ext.LoadWorldFile(name); err != nil || got != gt {
+		t.Fatalf("bad LoadWorldFile: %v, %v", got, err)
+	}
+}
+
+func TestGeoTIFF_GeoTransform(t *testing.T) {
+	for i, gt := range []image_ext.GeoTransform{
+		image_ext.NewGeoTransform(116.3, 39.9, 0.5, 0.5),
+		{500000, 30, 5, 4200000, 4, -30},
+	} {
+		var geo image_ext.GeoTIFF
+		geo.SetGeoTransform(gt)
+		got, ok := geo.GeoTransform()
+		if !ok || got != gt {
+			t.Fatalf("%d: got %v, %v, want %v", i, got, ok, gt)
+		}
+	}
+	if gt, ok := tMetadata.GeoTIFF.GeoTransform(); !ok || gt != image_ext.NewGeoTransform(116.3, 39.9, 0.5, 0.5) {
+		t.Fatalf("bad GeoTransform of tMetadata: %v, %v", gt, ok)
+	}
+	if _, ok := (&image_ext.GeoTIFF{}).GeoTransform(); ok {
+		t.Fatalf("empty GeoTIFF: expect no GeoTransform")
+	}
+}
@@ -0,0 +1,152 @@
+// Copyright 2014 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gif
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/color/palette"
+	"image/draw"
+	"image/gif"
+	"io"
+	"time"
+
+	image_ext "github.com/chai2010/gopkg/image"
+	"github.com/chai2010/gopkg/image/convert"
+)
+
+// DecodeFrames reads a GIF image from r and returns all the frames with
+// timing and disposal information.
+func DecodeFrames(r io.Reader, opt *Options) (frames *image_ext.Frames, err error) {
+	g, err := gif.DecodeAll(r)
+	if err != nil {
+		return
+	}
+
+	frames = &image_ext.Frames{
+		Frame:  make([]image_ext.Frame, len(g.Image)),
+		Config: g.Config,
+	}
+	if p, ok := g.Config.ColorModel.(color.Palette); ok && int(g.BackgroundIndex) < len(p) {
+		frames.Background = p[g.BackgroundIndex]
+	}
+	switch {
+	case g.LoopCount < 0:
+		frames.LoopCount = 1
+	case g.LoopCount > 0:
+		frames.LoopCount = g.LoopCount + 1
+	}
+
+	for i, m := range g.Image {
+		frame := &frames.Frame[i]
+		frame.Image = m
+		frame.Blend = true
+		if i < len(g.Delay) {
+			frame.Delay = time.Duration(g.Delay[i]) * 10 * time.Millisecond
+		}
+		if i < len(g.Disposal) {
+			switch g.Disposal[i] {
+			case gif.DisposalBackground:
+				frame.Disposal = image_ext.DisposalBackground
+			case gif.DisposalPrevious:
+				frame.Disposal = image_ext.DisposalPrevious
+			}
+		}
+		if opt != nil && opt.ColorModel != nil {
+			frame.Image = convert.ColorModel(m, opt.ColorModel)
+		}
+	}
+	if opt != nil && opt.ColorModel != nil {
+		frames.Config.ColorModel = opt.ColorModel
+	}
+	return
+}
+
+// EncodeFrames writes all the frames to w in GIF format. The frames which
+// are not paletted images are quantized with the Plan9 palette, or with
+// opt.Options when it is not nil.
+func EncodeFrames(w io.Writer, frames *image_ext.Frames, opt *Options) error {
+	g := &gif.GIF{
+		Image:    make([]*image.Paletted, len(frames.Frame)),
+		Delay:    make([]int, len(frames.Frame)),
+		Disposal: make([]byte, len(frames.Frame)),
+		Config: image.Config{
+			Width:  frames.Config.Width,
+			Height: frames.Config.Height,
+		},
+	}
+	switch {
+	case frames.LoopCount == 1:
+		g.LoopCount = -1
+	case frames.LoopCount > 1:
+		g.LoopCount = frames.LoopCount - 1
+	}
+
+	for i, frame := range frames.Frame {
+		m := frame.Image
+		if opt != nil && opt.ColorModel != nil {
+			m = convert.ColorModel(m, opt.ColorModel)
+		}
+		g.Image[i] = newPaletted(m, opt)
+		g.Delay[i] = int(frame.Delay / (10 * time.Millisecond))
+		switch frame.Disposal {
+		case image_ext.DisposalNone:
+			g.Disposal[i] = gif.DisposalNone
+		case image_ext.DisposalBackground:
+			g.Disposal[i] = gif.DisposalBackground
+		case image_ext.DisposalPrevious:
+			g.Disposal[i] = gif.DisposalPrevious
+		default:
+			return fmt.Errorf("image/gif: EncodeFrames, bad disposal: %v", frame.Disposal)
+		}
+	}
+	if p, ok := frames.Config.ColorModel.(color.Palette); ok {
+		g.Config.ColorModel = p
+		if frames.Background != nil {
+			g.BackgroundIndex = byte(p.Index(frames.Background))
+		}
+	}
+	return gif.EncodeAll(w, g)
+}
+
+// newPaletted returns m as a paletted image, like gif.Encode does.
+func newPaletted(m image.Image, opt *Options) *image.Paletted {
+	if pm, ok := m.(*image.Paletted); ok {
+		return pm
+	}
+
+	var (
+		pal    color.Palette = palette.Plan9
+		drawer draw.Drawer   = draw.FloydSteinberg
+	)
+	if opt != nil && opt.Options != nil {
+		if opt.Options.Quantizer != nil {
+			pal = opt.Options.Quantizer.Quantize(make(color.Palette, 0, 256), m)
+		}
+		if opt.Options.Drawer != nil {
+			drawer = opt.Options.Drawer
+		}
+	}
+	pm := image.NewPaletted(m.Bounds(), pal)
+	drawer.Draw(pm, m.Bounds(), m, m.Bounds().Min)
+	return pm
+}
+
+func imageExtDecodeAll(r io.Reader, opt *image_ext.Options) (*image_ext.Frames, error) {
+	p, err := newOptions(opt)
+	if err != nil {
+		return nil, err
+	}
+	return DecodeFrames(r, p)
+}
+
+func imageExtEncodeAll(w io.Writer, frames *image_ext.Frames, opt *image_ext.Options) error {
+	p, err := newEncodeOptions(opt)
+	if err != nil {
+		return err
+	}
+	return EncodeFrames(w, frames, p)
+}
@@ -65,20 +65,43 @@ func Encode(w io.Writer, m image.Image, opt *Options) error {
 	}
 }
 
-func imageExtDecode(r io.Reader, opt interface{}) (image.Image, error) {
-	if opt, ok := opt.(*Options); ok {
-		return Decode(r, opt)
-	} else {
-		return Decode(r, nil)
+// newOptions converts the common options to the gif options.
+func newOptions(opt *image_ext.Options) (*Options, error) {
+	var p Options
+	if ok, err := image_ext.ConvertOptions("gif", opt, &p); !ok {
+		return nil, err
 	}
+	return &p, nil
 }
 
-func imageExtEncode(w io.Writer, m image.Image, opt interface{}) error {
-	if opt, ok := opt.(*Options); ok {
-		return Encode(w, m, opt)
-	} else {
-		return Encode(w, m, nil)
+// newEncodeOptions converts the common options to the gif options,
+// GIF images are always LZW compressed.
+func newEncodeOptions(opt *image_ext.Options) (*Options, error) {
+	var p Options
+	ok, err := image_ext.ConvertEncodeOptions("gif", opt, &p, image_ext.EncodeSupport{
+		NoLossless:  true,
+		Compression: []image_ext.Compression{image_ext.CompressionLZW},
+	})
+	if !ok {
+		return nil, err
+	}
+	return &p, nil
+}
+
+func imageExtDecode(r io.Reader, opt *image_ext.Options) (image.Image, error) {
+	p, err := newOptions(opt)
+	if err != nil {
+		return nil, err
+	}
+	return Decode(r, p)
+}
+
+func imageExtEncode(w io.Writer, m image.Image, opt *image_ext.Options) error {
+	p, err := newEncodeOptions(opt)
+	if err != nil {
+		return err
 	}
+	return Encode(w, m, p)
 }
 
 func init() {
@@ -89,5 +112,7 @@ func init() {
 		DecodeConfig: DecodeConfig,
 		Decode:       imageExtDecode,
 		Encode:       imageExtEncode,
+		DecodeAll:    imageExtDecodeAll,
+		EncodeAll:    imageExtEncodeAll,
 	})
 }
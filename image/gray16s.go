@@ -0,0 +1,93 @@
+// Copyright 2014 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package image
+
+import (
+	"image"
+	"image/color"
+
+	"github.com/chai2010/gopkg/builtin"
+	color_ext "github.com/chai2010/gopkg/image/color"
+)
+
+// Gray16s is an in-memory image whose At method returns color.Gray16s values.
+type Gray16s struct {
+	// Pix holds the image's pixels. The pixel at (x, y) starts at
+	// Pix[(y-Rect.Min.Y)*Stride + (x-Rect.Min.X)*2].
+	Pix []byte
+	// Stride is the Pix stride between vertically adjacent pixels.
+	Stride int
+	// Rect is the image's bounds.
+	Rect image.Rectangle
+}
+
+func (p *Gray16s) ColorModel() color.Model { return color_ext.Gray16sModel }
+
+func (p *Gray16s) Bounds() image.Rectangle { return p.Rect }
+
+func (p *Gray16s) At(x, y int) color.Color {
+	return p.Gray16sAt(x, y)
+}
+
+func (p *Gray16s) Gray16sAt(x, y int) color_ext.Gray16s {
+	if !(image.Point{x, y}.In(p.Rect)) {
+		return color_ext.Gray16s{}
+	}
+	v := int16(builtin.Uint16(p.Pix[p.PixOffset(x, y):]))
+	return color_ext.Gray16s{Y: v}
+}
+
+// PixOffset returns the index of the first element of Pix that corresponds to
+// the pixel at (x, y).
+func (p *Gray16s) PixOffset(x, y int) int {
+	return (y-p.Rect.Min.Y)*p.Stride + (x-p.Rect.Min.X)*2
+}
+
+func (p *Gray16s) Set(x, y int, c color.Color) {
+	if !(image.Point{x, y}.In(p.Rect)) {
+		return
+	}
+	i := p.PixOffset(x, y)
+	c1 := color_ext.Gray16sModel.Convert(c).(color_ext.Gray16s)
+	builtin.PutUint16(p.Pix[i:], uint16(c1.Y))
+}
+
+func (p *Gray16s) SetGray16s(x, y int, c color_ext.Gray16s) {
+	if !(image.Point{x, y}.In(p.Rect)) {
+		return
+	}
+	i := p.PixOffset(x, y)
+	builtin.PutUint16(p.Pix[i:], uint16(c.Y))
+}
+
+// SubImage returns an image representing the portion of the image p visible
+// through r. The returned value shares pixels with the original image.
+func (p *Gray16s) SubImage(r image.Rectangle) image.Image {
+	r = r.Intersect(p.Rect)
+	// If r1 and r2 are Rectangles, r1.Intersect(r2) is not guaranteed to be inside
+	// either r1 or r2 if the intersection is empty. Without explicitly checking for
+	// this, the Pix[i:] expression below can panic.
+	if r.Empty() {
+		return &Gray16s{}
+	}
+	i := p.PixOffset(r.Min.X, r.Min.Y)
+	return &Gray16s{
+		Pix:    p.Pix[i:],
+		Stride: p.Stride,
+		Rect:   r,
+	}
+}
+
+// Opaque scans the entire image and reports whether it is fully opaque.
+func (p *Gray16s) Opaque() bool {
+	return true
+}
+
+// NewGray16s returns a new Gray16s with the given bounds.
+func NewGray16s(r image.Rectangle) *Gray16s {
+	w, h := r.Dx(), r.Dy()
+	pix := make([]byte, w*h*2)
+	return &Gray16s{pix, w * 2, r}
+}
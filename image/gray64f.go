@@ -0,0 +1,93 @@
+// Copyright 2014 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package image
+
+import (
+	"image"
+	"image/color"
+
+	"github.com/chai2010/gopkg/builtin"
+	color_ext "github.com/chai2010/gopkg/image/color"
+)
+
+// Gray64f is an in-memory image whose At method returns color.Gray64f values.
+type Gray64f struct {
+	// Pix holds the image's pixels. The pixel at (x, y) starts at
+	// Pix[(y-Rect.Min.Y)*Stride + (x-Rect.Min.X)*8].
+	Pix []byte
+	// Stride is the Pix stride between vertically adjacent pixels.
+	Stride int
+	// Rect is the image's bounds.
+	Rect image.Rectangle
+}
+
+func (p *Gray64f) ColorModel() color.Model { return color_ext.Gray64fModel }
+
+func (p *Gray64f) Bounds() image.Rectangle { return p.Rect }
+
+func (p *Gray64f) At(x, y int) color.Color {
+	return p.Gray64fAt(x, y)
+}
+
+func (p *Gray64f) Gray64fAt(x, y int) color_ext.Gray64f {
+	if !(image.Point{x, y}.In(p.Rect)) {
+		return color_ext.Gray64f{}
+	}
+	v := builtin.Float64(p.Pix[p.PixOffset(x, y):])
+	return color_ext.Gray64f{Y: v}
+}
+
+// PixOffset returns the index of the first element of Pix that corresponds to
+// the pixel at (x, y).
+func (p *Gray64f) PixOffset(x, y int) int {
+	return (y-p.Rect.Min.Y)*p.Stride + (x-p.Rect.Min.X)*8
+}
+
+func (p *Gray64f) Set(x, y int, c color.Color) {
+	if !(image.Point{x, y}.In(p.Rect)) {
+		return
+	}
+	i := p.PixOffset(x, y)
+	c1 := color_ext.Gray64fModel.Convert(c).(color_ext.Gray64f)
+	builtin.PutFloat64(p.Pix[i:], c1.Y)
+}
+
+func (p *Gray64f) SetGray64f(x, y int, c color_ext.Gray64f) {
+	if !(image.Point{x, y}.In(p.Rect)) {
+		return
+	}
+	i := p.PixOffset(x, y)
+	builtin.PutFloat64(p.Pix[i:], c.Y)
+}
+
+// SubImage returns an image representing the portion of the image p visible
+// through r. The returned value shares pixels with the original image.
+func (p *Gray64f) SubImage(r image.Rectangle) image.Image {
+	r = r.Intersect(p.Rect)
+	// If r1 and r2 are Rectangles, r1.Intersect(r2) is not guaranteed to be inside
+	// either r1 or r2 if the intersection is empty. Without explicitly checking for
+	// this, the Pix[i:] expression below can panic.
+	if r.Empty() {
+		return &Gray64f{}
+	}
+	i := p.PixOffset(r.Min.X, r.Min.Y)
+	return &Gray64f{
+		Pix:    p.Pix[i:],
+		Stride: p.Stride,
+		Rect:   r,
+	}
+}
+
+// Opaque scans the entire image and reports whether it is fully opaque.
+func (p *Gray64f) Opaque() bool {
+	return true
+}
+
+// NewGray64f returns a new Gray64f with the given bounds.
+func NewGray64f(r image.Rectangle) *Gray64f {
+	w, h := r.Dx(), r.Dy()
+	pix := make([]byte, w*h*8)
+	return &Gray64f{pix, w * 8, r}
+}
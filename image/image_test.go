@@ -7,6 +7,7 @@ package image_test
 import (
 	"image"
 	"image/color"
+	"reflect"
 	"testing"
 
 	image_ext "github.com/chai2010/gopkg/image"
@@ -33,6 +34,13 @@ func TestImage(t *testing.T) {
 		image_ext.NewRGB48(image.Rect(0, 0, 10, 10)),
 		image_ext.NewRGB96f(image.Rect(0, 0, 10, 10)),
 		image_ext.NewRGBA128f(image.Rect(0, 0, 10, 10)),
+		image_ext.NewGray16s(image.Rect(0, 0, 10, 10)),
+		image_ext.NewGray32i(image.Rect(0, 0, 10, 10)),
+		image_ext.NewGray64f(image.Rect(0, 0, 10, 10)),
+		image_ext.NewRGB48s(image.Rect(0, 0, 10, 10)),
+		image_ext.NewRGB96i(image.Rect(0, 0, 10, 10)),
+		image_ext.NewRGB192f(image.Rect(0, 0, 10, 10)),
+		image_ext.NewMultiBand(image.Rect(0, 0, 10, 10), color_ext.NewUniformMultiBandModel(8, reflect.Uint16)),
 	}
 	for _, m := range testImage {
 		if !image.Rect(0, 0, 10, 10).Eq(m.Bounds()) {
@@ -102,3 +110,30 @@ func Test16BitsPerColorChannel(t *testing.T) {
 		}
 	}
 }
+
+func TestSignedAndFloatColorModel(t *testing.T) {
+	for i, v := range []struct {
+		Model color.Model
+		In    color.Color
+		Out   color.Color
+	}{
+		{color_ext.Gray16sModel, color_ext.Gray64f{-1234.5}, color_ext.Gray16s{-1234}},
+		{color_ext.Gray16sModel, color_ext.Gray32i{-100000}, color_ext.Gray16s{-32768}},
+		{color_ext.Gray32iModel, color_ext.Gray16s{-1234}, color_ext.Gray32i{-1234}},
+		{color_ext.Gray64fModel, color_ext.Gray32i{-100000}, color_ext.Gray64f{-100000}},
+		{color_ext.Gray64fModel, color.Gray16{0x1234}, color_ext.Gray64f{0x1234}},
+		{color_ext.RGB48sModel, color_ext.RGB192f{-1, 2, 1e6}, color_ext.RGB48s{-1, 2, 32767}},
+		{color_ext.RGB96iModel, color_ext.Gray16s{-7}, color_ext.RGB96i{-7, -7, -7}},
+		{color_ext.RGB192fModel, color_ext.RGB96i{-1, 0, 1}, color_ext.RGB192f{-1, 0, 1}},
+		{color_ext.Gray64fModel, color_ext.RGB192f{-1000, -1000, -1000}, color_ext.Gray64f{-1000}},
+	} {
+		if c := v.Model.Convert(v.In); c != v.Out {
+			t.Errorf("%d: want %v, got %v", i, v.Out, c)
+		}
+	}
+
+	r, _, _, _ := color_ext.Gray16s{-1}.RGBA()
+	if r != 0 {
+		t.Errorf("Gray16s{-1}: want red value 0 got 0x%04x", r)
+	}
+}
@@ -53,29 +53,60 @@ func Encode(w io.Writer, m image.Image, opt *Options) error {
 	}
 }
 
-func imageExtDecode(r io.Reader, opt interface{}) (image.Image, error) {
-	if opt, ok := opt.(*Options); ok {
-		return Decode(r, opt)
-	} else {
-		return Decode(r, nil)
+// newOptions converts the common options to the jpeg options.
+func newOptions(opt *image_ext.Options) (*Options, error) {
+	var p Options
+	if ok, err := image_ext.ConvertOptions("jpeg", opt, &p); !ok {
+		return nil, err
 	}
+	return &p, nil
 }
 
-func imageExtEncode(w io.Writer, m image.Image, opt interface{}) error {
-	if opt, ok := opt.(*Options); ok {
-		return Encode(w, m, opt)
-	} else {
-		return Encode(w, m, nil)
+// newEncodeOptions converts the common options to the jpeg options.
+func newEncodeOptions(opt *image_ext.Options) (*Options, error) {
+	var p Options
+	ok, err := image_ext.ConvertEncodeOptions("jpeg", opt, &p, image_ext.EncodeSupport{
+		Quality:    true,
+		NoLossless: true,
+	})
+	if !ok {
+		return nil, err
+	}
+	if opt.Quality != 0 {
+		jpegOpt := &jpeg.Options{Quality: int(opt.Quality)}
+		if jpegOpt.Quality < 1 {
+			jpegOpt.Quality = 1
+		}
+		p.Options = jpegOpt
+	}
+	return &p, nil
+}
+
+func imageExtDecode(r io.Reader, opt *image_ext.Options) (image.Image, error) {
+	p, err := newOptions(opt)
+	if err != nil {
+		return nil, err
+	}
+	return Decode(r, p)
+}
+
+func imageExtEncode(w io.Writer, m image.Image, opt *image_ext.Options) error {
+	p, err := newEncodeOptions(opt)
+	if err != nil {
+		return err
 	}
+	return Encode(w, m, p)
 }
 
 func init() {
 	image_ext.RegisterFormat(image_ext.Format{
-		Name:         "jpeg",
-		Extensions:   []string{".jpeg", ".jpg"},
-		Magics:       []string{"\xff\xd8"},
-		DecodeConfig: DecodeConfig,
-		Decode:       imageExtDecode,
-		Encode:       imageExtEncode,
+		Name:               "jpeg",
+		Extensions:         []string{".jpeg", ".jpg"},
+		Magics:             []string{"\xff\xd8"},
+		DecodeConfig:       DecodeConfig,
+		Decode:             imageExtDecode,
+		Encode:             imageExtEncode,
+		DecodeWithMetadata: imageExtDecodeWithMetadata,
+		EncodeWithMetadata: imageExtEncodeWithMetadata,
 	})
 }
@@ -0,0 +1,204 @@
+// Copyright 2014 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package jpeg
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"io"
+	"io/ioutil"
+
+	image_ext "github.com/chai2010/gopkg/image"
+)
+
+const (
+	exifHeader = "Exif\x00\x00"
+	xmpHeader  = "http://ns.adobe.com/xap/1.0/\x00"
+	iccHeader  = "ICC_PROFILE\x00"
+)
+
+const (
+	soiMarker  = 0xd8
+	eoiMarker  = 0xd9
+	sosMarker  = 0xda
+	app1Marker = 0xe1
+	app2Marker = 0xe2
+
+	// maxSegmentSize is the max payload of a marker segment.
+	maxSegmentSize = 0xffff - 2
+	// maxICCChunkSize is the max ICC profile bytes of one APP2 segment.
+	maxICCChunkSize = maxSegmentSize - len(iccHeader) - 2
+)
+
+// DecodeWithMetadata reads a JPEG image and its EXIF/XMP/ICC metadata from r.
+func DecodeWithMetadata(r io.Reader, opt *Options) (m image.Image, meta *image_ext.Metadata, err error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return
+	}
+	if meta, err = readMetadata(data); err != nil {
+		return
+	}
+	if m, err = Decode(bytes.NewReader(data), opt); err != nil {
+		return
+	}
+	return
+}
+
+// EncodeWithMetadata writes the image m and its metadata to w in JPEG format.
+// The GeoTIFF tags and the metadata too large for the marker segments are
+// dropped, their names are returned.
+func EncodeWithMetadata(w io.Writer, m image.Image, meta *image_ext.Metadata, opt *Options) (dropped []string, err error) {
+	var buf bytes.Buffer
+	if err = Encode(&buf, m, opt); err != nil {
+		return
+	}
+	data := buf.Bytes()
+
+	segments, dropped := makeMetadataSegments(meta)
+	if _, err = w.Write(data[:2]); err != nil {
+		return
+	}
+	if _, err = w.Write(segments); err != nil {
+		return
+	}
+	if _, err = w.Write(data[2:]); err != nil {
+		return
+	}
+	return
+}
+
+// readMetadata reads the APP1 and APP2 segments before the SOS marker.
+func readMetadata(data []byte) (meta *image_ext.Metadata, err error) {
+	if len(data) < 2 || data[0] != 0xff || data[1] != soiMarker {
+		err = fmt.Errorf("image/jpeg: missing SOI marker")
+		return
+	}
+
+	meta = new(image_ext.Metadata)
+	var iccChunks [][]byte
+	for i := 2; i+1 < len(data); {
+		if data[i] != 0xff {
+			err = fmt.Errorf("image/jpeg: missing 0xff marker start")
+			return
+		}
+		marker := data[i+1]
+		if marker == 0xff {
+			// fill bytes
+			i++
+			continue
+		}
+		if marker == sosMarker || marker == eoiMarker {
+			break
+		}
+		if marker == 0x01 || (marker >= 0xd0 && marker <= 0xd7) {
+			i += 2
+			continue
+		}
+		if i+4 > len(data) {
+			err = io.ErrUnexpectedEOF
+			return
+		}
+		n := int(binary.BigEndian.Uint16(data[i+2:]))
+		if n < 2 || i+2+n > len(data) {
+			err = fmt.Errorf("image/jpeg: bad segment length, %d", n)
+			return
+		}
+		seg := data[i+4 : i+2+n]
+		i += 2 + n
+
+		switch {
+		case marker == app1Marker && bytes.HasPrefix(seg, []byte(exifHeader)):
+			meta.Exif = append([]byte(nil), seg[len(exifHeader):]...)
+		case marker == app1Marker && bytes.HasPrefix(seg, []byte(xmpHeader)):
+			meta.XMP = append([]byte(nil), seg[len(xmpHeader):]...)
+		case marker == app2Marker && bytes.HasPrefix(seg, []byte(iccHeader)):
+			seg = seg[len(iccHeader):]
+			if len(seg) < 2 || seg[0] == 0 || seg[0] > seg[1] {
+				continue
+			}
+			if iccChunks == nil {
+				iccChunks = make([][]byte, seg[1])
+			}
+			if int(seg[0]) <= len(iccChunks) {
+				iccChunks[seg[0]-1] = seg[2:]
+			}
+		}
+	}
+	for _, chunk := range iccChunks {
+		meta.ICC = append(meta.ICC, chunk...)
+	}
+	return
+}
+
+// makeMetadataSegments returns the APP1 and APP2 segments of meta.
+func makeMetadataSegments(meta *image_ext.Metadata) (segments []byte, dropped []string) {
+	if meta == nil {
+		return
+	}
+	var buf bytes.Buffer
+	writeSegment := func(marker byte, parts ...[]byte) {
+		n := 2
+		for _, part := range parts {
+			n += len(part)
+		}
+		buf.Write([]byte{0xff, marker, byte(n >> 8), byte(n)})
+		for _, part := range parts {
+			buf.Write(part)
+		}
+	}
+
+	if len(meta.Exif) != 0 {
+		if len(exifHeader)+len(meta.Exif) <= maxSegmentSize {
+			writeSegment(app1Marker, []byte(exifHeader), meta.Exif)
+		} else {
+			dropped = append(dropped, image_ext.MetadataExif)
+		}
+	}
+	if len(meta.XMP) != 0 {
+		if len(xmpHeader)+len(meta.XMP) <= maxSegmentSize {
+			writeSegment(app1Marker, []byte(xmpHeader), meta.XMP)
+		} else {
+			dropped = append(dropped, image_ext.MetadataXMP)
+		}
+	}
+	if len(meta.ICC) != 0 {
+		count := (len(meta.ICC) + maxICCChunkSize - 1) / maxICCChunkSize
+		if count <= 255 {
+			for i := 0; i < count; i++ {
+				chunk := meta.ICC[i*maxICCChunkSize:]
+				if len(chunk) > maxICCChunkSize {
+					chunk = chunk[:maxICCChunkSize]
+				}
+				writeSegment(app2Marker, []byte(iccHeader), []byte{byte(i + 1), byte(count)}, chunk)
+			}
+		} else {
+			dropped = append(dropped, image_ext.MetadataICC)
+		}
+	}
+	if !meta.GeoTIFF.IsEmpty() {
+		dropped = append(dropped, image_ext.MetadataGeoTIFF)
+	}
+	segments = buf.Bytes()
+	return
+}
+
+func imageExtDecodeWithMetadata(r io.Reader, opt *image_ext.Options) (image.Image, *image_ext.Metadata, error) {
+	p, err := newOptions(opt)
+	if err != nil {
+		return nil, nil, err
+	}
+	return DecodeWithMetadata(r, p)
+}
+
+func imageExtEncodeWithMetadata(w io.Writer, m image.Image, meta *image_ext.Metadata, opt *image_ext.Options) ([]string, error) {
+	p, err := newEncodeOptions(opt)
+	if err != nil {
+		return nil, err
+	}
+	return EncodeWithMetadata(w, m, meta, p)
+}
@@ -13,11 +13,13 @@ package jxr
 #cgo windows CFLAGS: -I./jxrlib/include -fno-stack-check -fno-stack-protector -mno-stack-arg-probe
 #cgo linux   CFLAGS: -I./jxrlib/include
 
+#include <stdlib.h>
 #include "jxr.h"
 */
 import "C"
 import (
 	"fmt"
+	"image"
 	"unsafe"
 )
 
@@ -36,90 +38,114 @@ const (
 	jxr_float    = jxr_data_type_t(C.jxr_float)
 )
 
-func jxr_decode_config(data []byte) (
-	width, height, channels, depth C.int,
-	data_type jxr_data_type_t,
-	err error,
-) {
+// jxrDecoder decodes the rectangles of a JPEG/XR image.
+type jxrDecoder struct {
+	p    *C.jxr_decoder_t
+	data unsafe.Pointer // the decoder keeps the pointer of the data
+
+	Width         int
+	Height        int
+	Channels      int
+	Depth         int
+	PixelSize     int // the bytes of a pixel, may be padded
+	DataType      jxr_data_type_t
+	Premultiplied bool
+}
+
+func newJxrDecoder(data []byte) (p *jxrDecoder, err error) {
 	if len(data) == 0 {
-		err = fmt.Errorf("jxr_decode_config: bad arguments")
+		err = fmt.Errorf("jxr_decoder_init: bad arguments")
 		return
 	}
-	rv := jxr_bool_t(C.jxr_decode_config(
-		(*C.char)(unsafe.Pointer(&data[0])), C.int(len(data)),
-		(*C.int)(&width), (*C.int)(&height), (*C.int)(&channels), (*C.int)(&depth),
-		(*C.jxr_data_type_t)(&data_type),
-	))
-	if rv != jxr_true {
-		err = fmt.Errorf("jxr_decode_config: failed")
+	p = &jxrDecoder{p: C.jxr_decoder_new()}
+	if p.p == nil {
+		err = fmt.Errorf("jxr_decoder_new: failed")
+		return
+	}
+	p.data = C.CBytes(data)
+	if jxr_bool_t(C.jxr_decoder_init(p.p, (*C.char)(p.data), C.int(len(data)))) != jxr_true {
+		p.Close()
+		err = fmt.Errorf("jxr_decoder_init: failed")
 		return
 	}
+	p.Width = int(C.jxr_decoder_width(p.p))
+	p.Height = int(C.jxr_decoder_height(p.p))
+	p.Channels = int(C.jxr_decoder_channels(p.p))
+	p.Depth = int(C.jxr_decoder_depth(p.p))
+	p.PixelSize = int(C.jxr_decoder_pixel_size(p.p))
+	p.DataType = jxr_data_type_t(C.jxr_decoder_data_type(p.p))
+	p.Premultiplied = jxr_bool_t(C.jxr_decoder_premultiplied(p.p)) == jxr_true
 	return
 }
 
-func jxr_decode(data, pix []byte, stride int) (
-	width, height, channels, depth C.int,
-	data_type jxr_data_type_t,
-	err error,
-) {
-	if len(data) == 0 {
-		err = fmt.Errorf("jxr_decode: bad arguments")
-		return
+// Decode decodes the pixels inside r to pix, r must be inside the image.
+func (p *jxrDecoder) Decode(r image.Rectangle, pix []byte, stride int) error {
+	if r.Empty() || stride < r.Dx()*p.PixelSize || len(pix) < stride*(r.Dy()-1)+r.Dx()*p.PixelSize {
+		return fmt.Errorf("jxr_decoder_decode: bad arguments")
 	}
-	rv := jxr_bool_t(C.jxr_decode(
-		(*C.char)(unsafe.Pointer(&pix[0])), C.int(len(pix)), C.int(stride),
-		(*C.char)(unsafe.Pointer(&data[0])), C.int(len(data)),
-		(*C.int)(&width), (*C.int)(&height), (*C.int)(&channels), (*C.int)(&depth),
-		(*C.jxr_data_type_t)(&data_type),
-	))
+	rect := C.jxr_rect_t{
+		x:      C.int(r.Min.X),
+		y:      C.int(r.Min.Y),
+		width:  C.int(r.Dx()),
+		height: C.int(r.Dy()),
+	}
+	rv := jxr_bool_t(C.jxr_decoder_decode(p.p, &rect, (*C.char)(unsafe.Pointer(&pix[0])), C.int(stride)))
 	if rv != jxr_true {
-		err = fmt.Errorf("jxr_decode: failed")
-		return
+		return fmt.Errorf("jxr_decoder_decode: failed")
 	}
-	return
+	return nil
 }
 
-func jxr_encode_len(
-	pix []byte, stride int,
-	width, height, channels, depth, quality int,
-	data_type jxr_data_type_t,
-) (size C.int, err error) {
-	if len(pix) == 0 {
-		err = fmt.Errorf("jxr_encode_len: bad arguments")
-		return
+func (p *jxrDecoder) Close() {
+	if p.p != nil {
+		C.jxr_decoder_delete(p.p)
+		p.p = nil
 	}
-	rv := jxr_bool_t(C.jxr_encode_len(
-		(*C.char)(unsafe.Pointer(&pix[0])), C.int(len(pix)), C.int(stride),
-		(C.int)(width), (C.int)(height), (C.int)(channels), (C.int)(depth), C.int(quality),
-		(C.jxr_data_type_t)(data_type),
-		&size,
-	))
-	if rv != jxr_true {
-		err = fmt.Errorf("jxr_encode_len: failed")
-		return
+	if p.data != nil {
+		C.free(p.data)
+		p.data = nil
 	}
-	return
+}
+
+// jxrEncodeOptions are the options of jxr_encode.
+type jxrEncodeOptions struct {
+	Quality      float32 // (0, 1], 1 is lossless
+	AlphaQuality float32 // (0, 1], 1 is lossless
+	TileWidth    int     // 0 is one tile column
+	TileHeight   int     // 0 is one tile row
+	Overlap      int     // 0 ~ 2, -1 is chosen by the quality
 }
 
 func jxr_encode(
-	buf, pix []byte, stride int,
-	width, height, channels, depth, quality int,
+	pix []byte, stride int,
+	width, height, channels, depth int,
 	data_type jxr_data_type_t,
-) (newSize C.int, err error) {
-	if len(buf) == 0 || len(pix) == 0 {
+	opt *jxrEncodeOptions,
+) (data []byte, err error) {
+	if len(pix) == 0 || opt == nil {
 		err = fmt.Errorf("jxr_encode: bad arguments")
 		return
 	}
+	copt := C.jxr_encode_options_t{
+		quality:       C.float(opt.Quality),
+		alpha_quality: C.float(opt.AlphaQuality),
+		tile_width:    C.int(opt.TileWidth),
+		tile_height:   C.int(opt.TileHeight),
+		overlap:       C.int(opt.Overlap),
+	}
+	var buf *C.char
+	var size C.int
 	rv := jxr_bool_t(C.jxr_encode(
-		(*C.char)(unsafe.Pointer(&buf[0])), C.int(len(buf)),
+		&buf, &size,
 		(*C.char)(unsafe.Pointer(&pix[0])), C.int(len(pix)), C.int(stride),
-		C.int(width), C.int(height), C.int(channels), C.int(depth), C.int(quality),
-		C.jxr_data_type_t(data_type),
-		&newSize,
+		C.int(width), C.int(height), C.int(channels), C.int(depth),
+		C.jxr_data_type_t(data_type), &copt,
 	))
 	if rv != jxr_true {
-		err = fmt.Errorf("jxr_encode_len: failed")
+		err = fmt.Errorf("jxr_encode: failed")
 		return
 	}
+	defer C.jxr_free(unsafe.Pointer(buf))
+	data = C.GoBytes(unsafe.Pointer(buf), size)
 	return
 }
@@ -4,5 +4,11 @@
 
 // Package jxr implements a JPEG/XR image decoder and encoder.
 //
+// The 8-bit, 16-bit and 32-bit float gray, RGB and RGBA images are
+// supported. The encoder can be lossless or lossy, and the tile layout,
+// the alpha quality and the overlap filtering are set by Options.
+// NewTileReader decodes the rectangles of an image by the region
+// decoding of the codec.
+//
 // The JPEG/XR specification is at http://www.itu.int/rec/T-REC-T.832
 package jxr
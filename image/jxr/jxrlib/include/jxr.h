@@ -34,6 +34,14 @@ typedef struct jxr_rect_t {
 	int height;
 } jxr_rect_t;
 
+typedef struct jxr_encode_options_t {
+	float quality;       // (0, 1], 1 is lossless
+	float alpha_quality; // (0, 1], 1 is lossless
+	int   tile_width;    // the tile width in pixels, 0 is one tile column
+	int   tile_height;   // the tile height in pixels, 0 is one tile row
+	int   overlap;       // the overlap filter level 0 ~ 2, -1 is chosen by quality
+} jxr_encode_options_t;
+
 // ----------------------------------------------------------------------------
 // decode/encode simple api
 // ----------------------------------------------------------------------------
@@ -50,21 +58,16 @@ jxr_bool_t jxr_decode(
 	jxr_data_type_t* type
 );
 
-jxr_bool_t jxr_encode_len(
-	const char* data, int data_size, int stride,
-	int width, int height, int channels, int depth,
-	int quality, jxr_data_type_t type,
-	int* size
-);
-
+// the encoded data is allocated by malloc, and freed by jxr_free
 jxr_bool_t jxr_encode(
-	char* buf, int buf_len,
+	char** buf, int* size,
 	const char* data, int data_size, int stride,
 	int width, int height, int channels, int depth,
-	int quality, jxr_data_type_t type,
-	int* size
+	jxr_data_type_t type, const jxr_encode_options_t* opt
 );
 
+void jxr_free(void* p);
+
 // ----------------------------------------------------------------------------
 // decoder
 // ----------------------------------------------------------------------------
@@ -79,6 +82,8 @@ int jxr_decoder_height(jxr_decoder_t* p);
 int jxr_decoder_channels(jxr_decoder_t* p);
 int jxr_decoder_depth(jxr_decoder_t* p);
 int jxr_decoder_data_type(jxr_decoder_t* p);
+int jxr_decoder_pixel_size(jxr_decoder_t* p);
+jxr_bool_t jxr_decoder_premultiplied(jxr_decoder_t* p);
 
 jxr_bool_t jxr_decoder_decode(jxr_decoder_t* p, const jxr_rect_t* r, char* buf, int stride);
 
@@ -92,11 +97,11 @@ void jxr_encoder_delete(jxr_encoder_t* p);
 jxr_bool_t jxr_encoder_init(jxr_encoder_t* p,
 	const char* data, int size, int stride,
 	int width, int height, int channels, int depth,
-	int quality, jxr_data_type_t type
+	jxr_data_type_t type, const jxr_encode_options_t* opt
 );
 
-jxr_bool_t jxr_encoder_need_buffer_size(jxr_encoder_t* p, int* size);
-jxr_bool_t jxr_encoder_encode(jxr_encoder_t* p, char* buf, int buf_len, int* size);
+// the encoded data is allocated by malloc, and freed by jxr_free
+jxr_bool_t jxr_encoder_encode(jxr_encoder_t* p, char** buf, int* size);
 
 // ----------------------------------------------------------------------------
 // END
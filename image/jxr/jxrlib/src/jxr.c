@@ -43,9 +43,9 @@ jxr_bool_t jxr_decode(
 
 	// set stride size
 	if(stride <= 0) {
-		stride = jxr_decoder_width(p)*jxr_decoder_channels(p)*jxr_decoder_depth(p)/8;
+		stride = jxr_decoder_width(p)*jxr_decoder_pixel_size(p);
 	}
-	if(stride < (jxr_decoder_width(p)*jxr_decoder_channels(p)*jxr_decoder_depth(p)/8)) {
+	if(stride < jxr_decoder_width(p)*jxr_decoder_pixel_size(p)) {
 		jxr_decoder_delete(p);
 		return jxr_false;
 	}
@@ -72,62 +72,24 @@ jxr_bool_t jxr_decode(
 	return jxr_true;
 }
 
-jxr_bool_t jxr_encode_len(
-	const char* data, int data_size, int stride,
-	int width, int height, int channels, int depth,
-	int quality, jxr_data_type_t type,
-	int* size
-) {
-	jxr_encoder_t* p = jxr_encoder_new();
-	if(!p) return jxr_false;
-
-	if(!jxr_encoder_init(
-		p, data, data_size, stride,
-		width, height, channels, depth,
-		quality, type
-	)) {
-		jxr_encoder_delete(p);
-		return jxr_false;
-	}
-	if(!jxr_encoder_need_buffer_size(p, size)) {
-		jxr_encoder_delete(p);
-		return jxr_false;
-	}
-
-	jxr_encoder_delete(p);
-	return jxr_true;
-}
-
 jxr_bool_t jxr_encode(
-	char* buf, int buf_len,
+	char** buf, int* size,
 	const char* data, int data_size, int stride,
 	int width, int height, int channels, int depth,
-	int quality, jxr_data_type_t type,
-	int* size
+	jxr_data_type_t type, const jxr_encode_options_t* opt
 ) {
-	int need_buf_size;
-
 	jxr_encoder_t* p = jxr_encoder_new();
 	if(!p) return jxr_false;
 
 	if(!jxr_encoder_init(
 		p, data, data_size, stride,
 		width, height, channels, depth,
-		quality, type
+		type, opt
 	)) {
 		jxr_encoder_delete(p);
 		return jxr_false;
 	}
-	if(!jxr_encoder_need_buffer_size(p, &need_buf_size)) {
-		jxr_encoder_delete(p);
-		return jxr_false;
-	}
-
-	if(buf_len < need_buf_size) {
-		jxr_encoder_delete(p);
-		return jxr_false;
-	}
-	if(!jxr_encoder_encode(p, buf, buf_len, size)) {
+	if(!jxr_encoder_encode(p, buf, size)) {
 		jxr_encoder_delete(p);
 		return jxr_false;
 	}
@@ -136,3 +98,6 @@ jxr_bool_t jxr_encode(
 	return jxr_true;
 }
 
+void jxr_free(void* p) {
+	free(p);
+}
@@ -15,6 +15,10 @@ struct jxr_decoder_t {
 	int               channels;
 	int               depth;
 	jxr_data_type_t   dataType;
+	int               pixelSize;
+	jxr_bool_t        premultiplied;
+	CWMImageInfo      wmiI;   // the image info after init
+	CWMIStrCodecParam wmiSCP; // the codec parameters after init
 };
 
 static const char jxr_decoder_type[] = "jxr_decoder_t";
@@ -54,9 +58,12 @@ void jxr_decoder_delete(jxr_decoder_t* p) {
 		p->pFactory = NULL;
 	}
 	p->pType = NULL;
+	free(p);
 }
 
 jxr_bool_t jxr_decoder_init(jxr_decoder_t* p, const char* data, int size) {
+	PKPixelInfo pixelInfo;
+
 	if(p == NULL || p->pType != jxr_decoder_type) {
 		fprintf(stderr, "jxr: jxr_decoder_init, invalid jxr_decoder_t type!");
 		abort();
@@ -72,6 +79,8 @@ jxr_bool_t jxr_decoder_init(jxr_decoder_t* p, const char* data, int size) {
 	p->channels = 0;
 	p->depth = 0;
 	p->dataType = jxr_unsigned;
+	p->pixelSize = 0;
+	p->premultiplied = jxr_false;
 
 	// create new stream
 	if(Failed(p->pFactory->CreateStreamFromMemory(&p->pStream, (void*)data, size))) {
@@ -85,6 +94,19 @@ jxr_bool_t jxr_decoder_init(jxr_decoder_t* p, const char* data, int size) {
 	if(!jxr_parse_format_guid(&(p->pDecoder->guidPixFormat), &p->channels, &p->depth, &p->dataType)) {
 		return jxr_false;
 	}
+	pixelInfo.pGUIDPixFmt = &(p->pDecoder->guidPixFormat);
+	if(Failed(PixelFormatLookup(&pixelInfo, LOOKUP_FORWARD))) {
+		return jxr_false;
+	}
+	p->pixelSize = (int)(pixelInfo.cbitUnit/8);
+	p->premultiplied = (pixelInfo.grBit & PK_pixfmtPreMul)? jxr_true: jxr_false;
+
+	// decode the image and the alpha, like JxrDecApp
+	p->pDecoder->WMP.wmiSCP.uAlphaMode = (pixelInfo.grBit & PK_pixfmtHasAlpha)? 2: 0;
+
+	// the decoding changes the parameters, they are restored for every rect
+	p->wmiI = p->pDecoder->WMP.wmiI;
+	p->wmiSCP = p->pDecoder->WMP.wmiSCP;
 	p->width = (int)(p->pDecoder->uWidth);
 	p->height = (int)(p->pDecoder->uHeight);
 	return jxr_true;
@@ -130,7 +152,24 @@ int jxr_decoder_data_type(jxr_decoder_t* p) {
 	return p->dataType;
 }
 
+int jxr_decoder_pixel_size(jxr_decoder_t* p) {
+	if(p == NULL || p->pType != jxr_decoder_type) {
+		fprintf(stderr, "jxr: jxr_decoder_pixel_size, invalid jxr_decoder_t type!");
+		abort();
+	}
+	return p->pixelSize;
+}
+
+jxr_bool_t jxr_decoder_premultiplied(jxr_decoder_t* p) {
+	if(p == NULL || p->pType != jxr_decoder_type) {
+		fprintf(stderr, "jxr: jxr_decoder_premultiplied, invalid jxr_decoder_t type!");
+		abort();
+	}
+	return p->premultiplied;
+}
+
 jxr_bool_t jxr_decoder_decode(jxr_decoder_t* p, const jxr_rect_t* r, char* buf, int stride) {
+	CWMImageInfo* pII;
 	PKRect rect;
 	ERR err = WMP_errSuccess;
 
@@ -142,32 +181,59 @@ jxr_bool_t jxr_decoder_decode(jxr_decoder_t* p, const jxr_rect_t* r, char* buf,
 	if(buf == NULL) {
 		return jxr_false;
 	}
-	if(p->width <= 0 || p->height <= 0 || p->channels <= 0 || p->depth <= 0) {
-		return jxr_false;
-	}
-
-	// set stride size
-	if(stride <= 0) {
-		stride = (p->width)*(p->channels)*(p->depth)/8;
-	}
-	if(stride < ((p->width)*(p->channels)*(p->depth)/8)) {
+	if(p->width <= 0 || p->height <= 0 || p->pixelSize <= 0) {
 		return jxr_false;
 	}
 
+	// the region is decoded into the top left of buf
+	rect.X = 0;
+	rect.Y = 0;
 	if(r != NULL) {
-		rect.X = r->x;
-		rect.Y = r->y;
+		if(r->x < 0 || r->y < 0 || r->width <= 0 || r->height <= 0) {
+			return jxr_false;
+		}
+		if(r->x+r->width > p->width || r->y+r->height > p->height) {
+			return jxr_false;
+		}
 		rect.Width = r->width;
 		rect.Height = r->height;
 	} else {
-		rect.X = 0;
-		rect.Y = 0;
 		rect.Width = p->width;
 		rect.Height = p->height;
 	}
 
+	// set stride size
+	if(stride <= 0) {
+		stride = rect.Width*p->pixelSize;
+	}
+	if(stride < rect.Width*p->pixelSize) {
+		return jxr_false;
+	}
+
+	// the previous decoding is finished, start a new one
+	p->pDecoder->WMP.wmiI = p->wmiI;
+	p->pDecoder->WMP.wmiSCP = p->wmiSCP;
+	p->pDecoder->WMP.DecoderCurrMBRow = 0;
+	p->pDecoder->WMP.DecoderCurrAlphaMBRow = 0;
+	p->pDecoder->WMP.cLinesDecoded = 0;
+	p->pDecoder->WMP.cLinesCropped = 0;
+	p->pDecoder->WMP.fFirstNonZeroDecode = FALSE;
+
+	pII = &p->pDecoder->WMP.wmiI;
+	pII->cThumbnailWidth = pII->cWidth;
+	pII->cThumbnailHeight = pII->cHeight;
+	pII->cROILeftX = (r != NULL)? r->x: 0;
+	pII->cROITopY = (r != NULL)? r->y: 0;
+	pII->cROIWidth = rect.Width;
+	pII->cROIHeight = rect.Height;
+
+	// rewind the stream for the next decoding
+	if(Failed(p->pStream->SetPos(p->pStream, p->pDecoder->WMP.wmiDEMisc.uImageOffset))) {
+		return jxr_false;
+	}
+
 	// decode image data
-	p->pDecoder->WMP.wmiI.bRGB = 1; // use RGB order
-	err = p->pDecoder->Copy(p->pDecoder, &rect, buf, stride);
+	pII->bRGB = 1; // use RGB order
+	err = p->pDecoder->Copy(p->pDecoder, &rect, (U8*)buf, stride);
 	return Failed(err)? jxr_false: jxr_true;
 }
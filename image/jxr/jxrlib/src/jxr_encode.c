@@ -6,25 +6,82 @@
 #include "jxr_private.h"
 
 struct jxr_encoder_t {
-	const void*       pType;
-	PKFactory*        pFactory;
-	PKImageEncode*    pEncoder;
-	struct WMPStream* pStream;
-	CWMIStrCodecParam wmiSCP;
-	const char*       data;
-	int               dataSize;
-	int               stride;
-	int               width;
-	int               height;
-	int               channels;
-	int               depth;
-	int               quality;
-	jxr_data_type_t   dataType;
-	size_t            destSize;
+	const void*          pType;
+	PKFactory*           pFactory;
+	PKImageEncode*       pEncoder;
+	CWMIStrCodecParam    wmiSCP;
+	PKPixelInfo          pixelInfo;
+	const char*          data;
+	int                  dataSize;
+	int                  stride;
+	int                  width;
+	int                  height;
+	jxr_encode_options_t opt;
 };
 
 static const char jxr_encoder_type[] = "jxr_encoder_t";
 
+// the QP tables of JxrEncApp: Y, U, V, YHP, UHP, VHP
+static const int jxr_qps_420[12][6] = { // for 8 bit only
+	{ 66, 65, 70, 72, 72, 77 },
+	{ 59, 58, 63, 64, 63, 68 },
+	{ 52, 51, 57, 56, 56, 61 },
+	{ 48, 48, 54, 51, 50, 55 },
+	{ 43, 44, 48, 46, 46, 49 },
+	{ 37, 37, 42, 38, 38, 43 },
+	{ 26, 28, 31, 27, 28, 31 },
+	{ 16, 17, 22, 16, 17, 21 },
+	{ 10, 11, 13, 10, 10, 13 },
+	{  5,  5,  6,  5,  5,  6 },
+	{  2,  2,  3,  2,  2,  2 },
+	{  2,  2,  3,  2,  2,  2 },
+};
+
+static const int jxr_qps_8[12][6] = {
+	{ 67, 79, 86, 72, 90, 98 },
+	{ 59, 74, 80, 64, 83, 89 },
+	{ 53, 68, 75, 57, 76, 83 },
+	{ 49, 64, 71, 53, 70, 77 },
+	{ 45, 60, 67, 48, 67, 74 },
+	{ 40, 56, 62, 42, 59, 66 },
+	{ 33, 49, 55, 35, 51, 58 },
+	{ 27, 44, 49, 28, 45, 50 },
+	{ 20, 36, 42, 20, 38, 44 },
+	{ 13, 27, 34, 13, 28, 34 },
+	{  7, 17, 21,  8, 17, 21 }, // Photoshop 100%
+	{  2,  5,  6,  2,  5,  6 },
+};
+
+static const int jxr_qps_16[12][6] = {
+	{ 197, 203, 210, 202, 207, 213 },
+	{ 174, 188, 193, 180, 189, 196 },
+	{ 152, 167, 173, 156, 169, 174 },
+	{ 135, 152, 157, 137, 153, 158 },
+	{ 119, 137, 141, 119, 138, 142 },
+	{ 102, 120, 125, 100, 120, 124 },
+	{  82,  98, 104,  79,  98, 103 },
+	{  60,  76,  81,  58,  76,  81 },
+	{  39,  52,  58,  36,  52,  58 },
+	{  16,  27,  33,  14,  27,  33 },
+	{   5,   8,   9,   4,   7,   8 },
+	{   5,   8,   9,   4,   7,   8 },
+};
+
+static const int jxr_qps_32f[12][6] = {
+	{ 194, 206, 209, 204, 211, 217 },
+	{ 175, 187, 196, 186, 193, 205 },
+	{ 157, 170, 177, 167, 180, 190 },
+	{ 133, 152, 156, 144, 163, 168 },
+	{ 116, 138, 142, 117, 143, 148 },
+	{  98, 120, 123,  96, 123, 126 },
+	{  80,  99, 102,  78,  99, 102 },
+	{  65,  79,  84,  63,  79,  84 },
+	{  48,  61,  67,  45,  60,  66 },
+	{  27,  41,  46,  24,  40,  45 },
+	{   3,  22,  24,   2,  21,  22 },
+	{   3,  22,  24,   2,  21,  22 },
+};
+
 jxr_encoder_t* jxr_encoder_new() {
 	jxr_encoder_t* p = (jxr_encoder_t*)calloc(1, sizeof(*p));
 	if(!p) return NULL;
@@ -43,128 +100,224 @@ jxr_encoder_t* jxr_encoder_new() {
 
 void jxr_encoder_delete(jxr_encoder_t* p) {
 	if(p == NULL || p->pType != jxr_encoder_type) {
-		fprintf(stderr, "jxr: jxr_encoder_delete, invalid jxr_decoder_t type!");
+		fprintf(stderr, "jxr: jxr_encoder_delete, invalid jxr_encoder_t type!");
 		abort();
 	}
 
 	if(p->pEncoder != NULL) {
-		p->pEncoder->Release(&p->pEncoder);
+		// the stream is owned and closed by the initialized encoder
+		if(p->pEncoder->pStream != NULL) {
+			p->pEncoder->Release(&p->pEncoder);
+		} else {
+			PKFree((void**)&p->pEncoder);
+		}
 		p->pEncoder = NULL;
 	}
-	if(p->pStream != NULL) {
-		p->pStream->Close(&p->pStream);
-		p->pStream = NULL;
-	}
 	if(p->pFactory != NULL) {
 		p->pFactory->Release(&p->pFactory);
 		p->pFactory = NULL;
 	}
 	p->pType = NULL;
+	free(p);
+}
+
+// jxr_set_tiles sets the uniform tiles of n pixels, the last tile may be
+// smaller.
+static int jxr_set_tiles(U32* tiles, int n, int size) {
+	int mb, count, i;
+
+	if(n <= 0) {
+		return 0;
+	}
+	mb = (n + 15) / 16;
+	count = ((size + 15) / 16 + mb - 1) / mb;
+	if(count <= 1) {
+		return 0;
+	}
+	if(count > MAX_TILES) {
+		count = MAX_TILES;
+	}
+	for(i = 0; i < count; ++i) {
+		tiles[i] = mb;
+	}
+	return count - 1;
+}
+
+// jxr_set_quality sets the QP of the quality, like JxrEncApp.
+static void jxr_set_quality(jxr_encoder_t* p, CWMIStrCodecParam* scp) {
+	const int (*qps)[6];
+	float quality = p->opt.quality;
+	int qi, i;
+	float qf;
+	U8 v[6];
+
+	if(quality <= 0 || quality >= 1) {
+		scp->uiDefaultQPIndex = 1;
+		return;
+	}
+
+	// remap [0.8, 0.866, 0.933, 1.0] to [0.8, 0.9, 1.0, 1.1]
+	// to use 8-bit DPK QP table (0.933 == Photoshop JPEG 100)
+	if(quality > 0.8f && p->pixelInfo.bdBitDepth == BD_8 && scp->cfColorFormat == YUV_444) {
+		quality = 0.8f + (quality - 0.8f) * 1.5f;
+	}
+	qi = (int)(10.f * quality);
+	qf = 10.f * quality - (float)qi;
+
+	if(scp->cfColorFormat == YUV_420) {
+		qps = jxr_qps_420;
+	} else if(p->pixelInfo.bdBitDepth == BD_8) {
+		qps = jxr_qps_8;
+	} else if(p->pixelInfo.bdBitDepth == BD_16) {
+		qps = jxr_qps_16;
+	} else {
+		qps = jxr_qps_32f;
+	}
+	for(i = 0; i < 6; ++i) {
+		v[i] = (U8)(0.5f + (float)qps[qi][i] * (1.f - qf) + (float)qps[qi + 1][i] * qf);
+	}
+	scp->uiDefaultQPIndex = v[0];
+	scp->uiDefaultQPIndexU = v[1];
+	scp->uiDefaultQPIndexV = v[2];
+	scp->uiDefaultQPIndexYHP = v[3];
+	scp->uiDefaultQPIndexUHP = v[4];
+	scp->uiDefaultQPIndexVHP = v[5];
+}
+
+// jxr_alpha_qp returns the QP of the planar alpha.
+static U8 jxr_alpha_qp(jxr_encoder_t* p) {
+	float quality = p->opt.alpha_quality;
+	const int (*qps)[6];
+	int qi;
+	float qf;
+
+	if(quality <= 0 || quality >= 1) {
+		return 1;
+	}
+	qps = p->pixelInfo.bdBitDepth == BD_8? jxr_qps_8:
+		(p->pixelInfo.bdBitDepth == BD_16? jxr_qps_16: jxr_qps_32f);
+	qi = (int)(10.f * quality);
+	qf = 10.f * quality - (float)qi;
+	return (U8)(0.5f + (float)qps[qi][0] * (1.f - qf) + (float)qps[qi + 1][0] * qf);
 }
 
 jxr_bool_t jxr_encoder_init(jxr_encoder_t* p,
 	const char* data, int size, int stride,
 	int width, int height, int channels, int depth,
-	int quality, jxr_data_type_t type
+	jxr_data_type_t type, const jxr_encode_options_t* opt
 ) {
 	const PKPixelFormatGUID* fmt = NULL;
 
 	if(p == NULL || p->pType != jxr_encoder_type) {
-		fprintf(stderr, "jxr: jxr_encoder_init, invalid jxr_decoder_t type!");
+		fprintf(stderr, "jxr: jxr_encoder_init, invalid jxr_encoder_t type!");
 		abort();
 	}
+	if(data == NULL || width <= 0 || height <= 0 || stride <= 0 || size < stride*(height-1)) {
+		return jxr_false;
+	}
 
 	// lookup best match format
 	if(!jxr_golden_format(channels, depth, type, &fmt)) {
 		return jxr_false;
 	}
-	if(Failed(p->pEncoder->SetPixelFormat(p->pEncoder, *fmt))) {
+	p->pixelInfo.pGUIDPixFmt = fmt;
+	if(Failed(PixelFormatLookup(&p->pixelInfo, LOOKUP_FORWARD))) {
 		return jxr_false;
 	}
-
-	// set image size
-	if(Failed(p->pEncoder->SetSize(p->pEncoder, width, height))) {
+	if(size < stride*(height-1) + width*(int)(p->pixelInfo.cbitUnit/8)) {
 		return jxr_false;
 	}
 
 	p->data = data;
 	p->dataSize = size;
 	p->stride = stride;
-
 	p->width = width;
 	p->height = height;
-	p->channels = channels;
-	p->depth = depth;
-	p->quality = quality;
-	p->dataType = type;
-	p->destSize = 0;
-
-	return jxr_true;
-}
 
-jxr_bool_t jxr_encoder_need_buffer_size(jxr_encoder_t* p, int* size) {
-	struct WMPStream* pNilStream = NULL;
-
-	if(p->destSize == 0) {
-		// create discard stream
-		if(Failed(CreateWS_Discard(&pNilStream))) {
-			return jxr_false;
-		}
-		if(Failed(p->pEncoder->Initialize(p->pEncoder, pNilStream, &p->wmiSCP, sizeof(p->wmiSCP)))) {
-			pNilStream->Close(&pNilStream);
-			return jxr_false;
-		}
+	p->opt.quality = 1;
+	p->opt.alpha_quality = 1;
+	p->opt.overlap = -1;
+	if(opt != NULL) {
+		p->opt = *opt;
+	}
 
-		{
-			// how to set quality ?
-		}
+	// the default parameters of JxrEncApp
+	memset(&p->wmiSCP, 0, sizeof(p->wmiSCP));
+	p->wmiSCP.cfColorFormat = YUV_444;
+	p->wmiSCP.bdBitDepth = BD_LONG;
+	p->wmiSCP.bfBitstreamFormat = SPATIAL;
+	p->wmiSCP.bProgressiveMode = TRUE;
+	p->wmiSCP.sbSubband = SB_ALL;
+	p->wmiSCP.uiDefaultQPIndex = 1;
+	p->wmiSCP.uiDefaultQPIndexAlpha = 1;
+	if(p->pixelInfo.bdBitDepth == BD_32F && (p->opt.quality <= 0 || p->opt.quality >= 1)) {
+		// the mantissa of the float is 23 bits, but the coefficients may
+		// overflow if more than 20 bits are kept
+		p->wmiSCP.nLenMantissaOrShift = 20;
+	}
 
-		// try encode
-		if(Failed(p->pEncoder->WritePixels(p->pEncoder, p->height, (U8*)p->data, p->stride))) {
-			pNilStream->Close(&pNilStream);
-			return jxr_false;
+	// the overlap and subsampling of the quality, like JxrEncApp
+	if(p->opt.quality <= 0 || p->opt.quality >= 1) {
+		p->wmiSCP.olOverlap = OL_NONE;
+	} else {
+		p->wmiSCP.olOverlap = p->opt.quality > 0.4f? OL_ONE: OL_TWO;
+		if(p->opt.quality < 0.5f && p->pixelInfo.uBitsPerSample <= 8 && p->pixelInfo.uSamplePerPixel >= 3) {
+			p->wmiSCP.cfColorFormat = YUV_420;
 		}
-		if(Failed(pNilStream->GetPos(pNilStream, &p->destSize))) {
-			pNilStream->Close(&pNilStream);
-			return jxr_false;
-		}
-
-		pNilStream->Close(&pNilStream);
 	}
-	if(size != NULL) {
-		*size = p->destSize;
+	if(p->opt.overlap >= 0 && p->opt.overlap <= 2) {
+		p->wmiSCP.olOverlap = (OVERLAP)p->opt.overlap;
 	}
+	p->wmiSCP.uAlphaMode = (p->pixelInfo.grBit & PK_pixfmtHasAlpha)? 2: 0; // planar alpha
+	p->wmiSCP.cNumOfSliceMinus1V = jxr_set_tiles(p->wmiSCP.uiTileX, p->opt.tile_width, width);
+	p->wmiSCP.cNumOfSliceMinus1H = jxr_set_tiles(p->wmiSCP.uiTileY, p->opt.tile_height, height);
+
 	return jxr_true;
 }
 
-jxr_bool_t jxr_encoder_encode(jxr_encoder_t* p, char* buf, int buf_len, int* size) {
-	// create new stream
-	if(p->pStream == NULL) {
-		if(Failed(p->pFactory->CreateStreamFromMemory(&p->pStream, (void*)buf, buf_len))) {
-			return jxr_false;
-		}
-	}
+jxr_bool_t jxr_encoder_encode(jxr_encoder_t* p, char** buf, int* size) {
+	struct WMPStream* pStream = NULL;
+	const char* data;
+	size_t n = 0;
 
-	// set output steam
-	if(Failed(p->pEncoder->Initialize(p->pEncoder, p->pStream, &p->wmiSCP, sizeof(p->wmiSCP)))) {
+	if(p == NULL || p->pType != jxr_encoder_type) {
+		fprintf(stderr, "jxr: jxr_encoder_encode, invalid jxr_encoder_t type!");
+		abort();
+	}
+	if(p->data == NULL || buf == NULL || size == NULL) {
 		return jxr_false;
 	}
 
-	// how to set quality ?
-	{
-		//
+	// the encoder can write pixels only once
+	if(p->pEncoder->pStream != NULL) {
+		return jxr_false;
+	}
+	if(Failed(CreateWS_Buffer(&pStream))) {
+		return jxr_false;
 	}
+	if(Failed(p->pEncoder->Initialize(p->pEncoder, pStream, &p->wmiSCP, sizeof(p->wmiSCP)))) {
+		pStream->Close(&pStream);
+		return jxr_false;
+	}
+	data = p->data;
+	p->data = NULL;
 
-	// encode
-	if(Failed(p->pEncoder->WritePixels(p->pEncoder, p->height, (U8*)p->data, p->stride))) {
+	jxr_set_quality(p, &p->pEncoder->WMP.wmiSCP);
+	if(p->pEncoder->WMP.wmiSCP.uAlphaMode == 2) {
+		p->pEncoder->WMP.wmiSCP_Alpha.uiDefaultQPIndex = jxr_alpha_qp(p);
+	}
+	if(Failed(p->pEncoder->SetPixelFormat(p->pEncoder, *p->pixelInfo.pGUIDPixFmt))) {
 		return jxr_false;
 	}
-	if(Failed(p->pStream->GetPos(p->pStream, &p->destSize))) {
+	if(Failed(p->pEncoder->SetSize(p->pEncoder, p->width, p->height))) {
 		return jxr_false;
 	}
-	if(size != NULL) {
-		*size = p->destSize;
+	if(Failed(p->pEncoder->WritePixels(p->pEncoder, p->height, (U8*)data, p->stride))) {
+		return jxr_false;
 	}
-
+	if(Failed(TakeWS_Buffer(pStream, buf, &n))) {
+		return jxr_false;
+	}
+	*size = (int)n;
 	return jxr_true;
 }
@@ -24,7 +24,7 @@ static const struct {
 
 	/* 24bpp formats */
 	{ _JXR_FMT_(GUID_PKPixelFormat24bppBGR), 3, 8, jxr_unsigned, jxr_false },
-	{ _JXR_FMT_(GUID_PKPixelFormat24bppRGB), 3, 8, jxr_unsigned, jxr_false },           // golden RGB
+	{ _JXR_FMT_(GUID_PKPixelFormat24bppRGB), 3, 8, jxr_unsigned, jxr_true },            // golden RGB
 
 	/* 32bpp format */
 	{ _JXR_FMT_(GUID_PKPixelFormat32bppBGR), 3, 8, jxr_unsigned, jxr_false },
@@ -45,7 +45,7 @@ static const struct {
 	{ _JXR_FMT_(GUID_PKPixelFormat32bppRGB101010), 3, 8, jxr_unsigned, jxr_false },
 
 	/* 48bpp format */
-	{ _JXR_FMT_(GUID_PKPixelFormat48bppRGB), 3, 8, jxr_unsigned, jxr_true },            // golden RGB48
+	{ _JXR_FMT_(GUID_PKPixelFormat48bppRGB), 3, 16, jxr_unsigned, jxr_true },           // golden RGB48
 
 	/* 64bpp format */
 	{ _JXR_FMT_(GUID_PKPixelFormat64bppRGBA), 4, 16, jxr_unsigned, jxr_true },          // golden RGBA64
@@ -53,12 +53,12 @@ static const struct {
 
 	/* 96bpp format */
 	{ _JXR_FMT_(GUID_PKPixelFormat96bppRGBFixedPoint), 3, 32, jxr_signed, jxr_false },  // golden RGB96i
-	{ _JXR_FMT_(GUID_PKPixelFormat96bppRGBFloat), 3, 32, jxr_float, jxr_false },        // golden RGB96f
+	{ _JXR_FMT_(GUID_PKPixelFormat96bppRGBFloat), 3, 32, jxr_float, jxr_false },
 
 	/* Floating point scRGB formats */
 	{ _JXR_FMT_(GUID_PKPixelFormat128bppRGBAFloat), 4, 32, jxr_float, jxr_true },       // golden RGBA128f
 	{ _JXR_FMT_(GUID_PKPixelFormat128bppPRGBAFloat), 4, 32, jxr_float, jxr_false },
-	{ _JXR_FMT_(GUID_PKPixelFormat128bppRGBFloat), 4, 32, jxr_float, jxr_false },
+	{ _JXR_FMT_(GUID_PKPixelFormat128bppRGBFloat), 3, 32, jxr_float, jxr_true },        // golden RGB96f (padded)
 
 	/* CMYK formats. */
 	{ _JXR_FMT_(GUID_PKPixelFormat32bppCMYK), 3, 8, jxr_unsigned, jxr_false },
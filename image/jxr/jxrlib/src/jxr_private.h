@@ -28,10 +28,16 @@ jxr_bool_t jxr_golden_format(
 	const PKPixelFormatGUID** fmt
 );
 
-ERR CreateWS_Discard(
+ERR CreateWS_Buffer(
 	struct WMPStream** ppWS
 );
 
+// TakeWS_Buffer takes the data of the buffer stream, the data is freed by free
+ERR TakeWS_Buffer(
+	struct WMPStream* pWS,
+	char** buf, size_t* size
+);
+
 #ifdef  __cplusplus
 } // extern "C"
 #endif
@@ -0,0 +1,127 @@
+﻿// Copyright 2014 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+#include "jxr.h"
+#include "jxr_private.h"
+
+// the buffer stream grows on writing, the data is allocated by malloc.
+// cbBuf is the capacity, cbCur is the position, cbBufCount is the size.
+
+static
+ERR CloseWS_Buffer(struct WMPStream** ppWS)
+{
+	ERR err = WMP_errSuccess;
+
+	if(*ppWS != NULL) {
+		free((*ppWS)->state.buf.pbBuf);
+	}
+	Call(WMPFree((void**)ppWS));
+
+Cleanup:
+	return err;
+}
+
+static
+Bool EOSWS_Buffer(struct WMPStream* pWS)
+{
+	return pWS->state.buf.cbBufCount <= pWS->state.buf.cbCur;
+}
+
+static
+ERR ReadWS_Buffer(struct WMPStream* pWS, void* pv, size_t cb)
+{
+	ERR err = WMP_errSuccess;
+
+	FailIf(pWS->state.buf.cbBufCount < pWS->state.buf.cbCur, WMP_errBufferOverflow);
+	FailIf(pWS->state.buf.cbBufCount - pWS->state.buf.cbCur < cb, WMP_errBufferOverflow);
+
+	memcpy(pv, pWS->state.buf.pbBuf + pWS->state.buf.cbCur, cb);
+	pWS->state.buf.cbCur += cb;
+
+Cleanup:
+	return err;
+}
+
+static
+ERR WriteWS_Buffer(struct WMPStream* pWS, const void* pv, size_t cb)
+{
+	ERR err = WMP_errSuccess;
+	size_t n = pWS->state.buf.cbCur + cb;
+
+	FailIf(n < pWS->state.buf.cbCur, WMP_errBufferOverflow);
+
+	if(pWS->state.buf.cbBuf < n) {
+		size_t capacity = pWS->state.buf.cbBuf? pWS->state.buf.cbBuf: 4096;
+		U8* pb;
+		while(capacity < n) {
+			FailIf(capacity*2 < capacity, WMP_errBufferOverflow);
+			capacity *= 2;
+		}
+		pb = (U8*)realloc(pWS->state.buf.pbBuf, capacity);
+		FailIf(pb == NULL, WMP_errOutOfMemory);
+		pWS->state.buf.pbBuf = pb;
+		pWS->state.buf.cbBuf = capacity;
+	}
+
+	memcpy(pWS->state.buf.pbBuf + pWS->state.buf.cbCur, pv, cb);
+	pWS->state.buf.cbCur = n;
+	if(pWS->state.buf.cbBufCount < n) {
+		pWS->state.buf.cbBufCount = n;
+	}
+
+Cleanup:
+	return err;
+}
+
+static
+ERR SetPosWS_Buffer(struct WMPStream* pWS, size_t offPos)
+{
+	pWS->state.buf.cbCur = offPos;
+	return WMP_errSuccess;
+}
+
+static
+ERR GetPosWS_Buffer(struct WMPStream* pWS, size_t* poffPos)
+{
+	*poffPos = pWS->state.buf.cbCur;
+	return WMP_errSuccess;
+}
+
+ERR CreateWS_Buffer(struct WMPStream** ppWS)
+{
+	ERR err = WMP_errSuccess;
+	struct WMPStream* pWS = NULL;
+
+	Call(WMPAlloc((void** )ppWS, sizeof(**ppWS)));
+	pWS = *ppWS;
+
+	pWS->state.buf.pbBuf = NULL;
+	pWS->state.buf.cbBuf = 0;
+	pWS->state.buf.cbCur = 0;
+	pWS->state.buf.cbBufCount = 0;
+
+	pWS->Close = CloseWS_Buffer;
+	pWS->EOS = EOSWS_Buffer;
+
+	pWS->Read = ReadWS_Buffer;
+	pWS->Write = WriteWS_Buffer;
+
+	pWS->SetPos = SetPosWS_Buffer;
+	pWS->GetPos = GetPosWS_Buffer;
+
+Cleanup:
+	return err;
+}
+
+ERR TakeWS_Buffer(struct WMPStream* pWS, char** buf, size_t* size)
+{
+	*buf = (char*)pWS->state.buf.pbBuf;
+	*size = pWS->state.buf.cbBufCount;
+
+	pWS->state.buf.pbBuf = NULL;
+	pWS->state.buf.cbBuf = 0;
+	pWS->state.buf.cbCur = 0;
+	pWS->state.buf.cbBufCount = 0;
+	return WMP_errSuccess;
+}
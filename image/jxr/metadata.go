@@ -0,0 +1,214 @@
+// Copyright 2014 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package jxr
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"io"
+	"io/ioutil"
+	"sort"
+
+	image_ext "github.com/chai2010/gopkg/image"
+)
+
+// JPEG/XR container tags for metadata.
+const (
+	tXMP        = 0x02BC
+	tICCProfile = 0x8773
+
+	dtByte      = 1
+	dtUndefined = 7
+)
+
+// DecodeWithMetadata reads a JPEG/XR image and its XMP/ICC metadata from r.
+func DecodeWithMetadata(r io.Reader, opt *Options) (m image.Image, meta *image_ext.Metadata, err error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return
+	}
+	if meta, err = readMetadata(data); err != nil {
+		return
+	}
+	if m, err = Decode(bytes.NewReader(data), opt); err != nil {
+		return
+	}
+	return
+}
+
+// EncodeWithMetadata writes the image m and its XMP/ICC metadata to w in
+// JPEG/XR format. The EXIF and GeoTIFF metadata are dropped, their names are
+// returned.
+func EncodeWithMetadata(w io.Writer, m image.Image, meta *image_ext.Metadata, opt *Options) (dropped []string, err error) {
+	var buf bytes.Buffer
+	if err = Encode(&buf, m, opt); err != nil {
+		return
+	}
+	data := buf.Bytes()
+	if meta != nil && (len(meta.XMP) != 0 || len(meta.ICC) != 0) {
+		if data, err = writeMetadata(data, meta); err != nil {
+			return
+		}
+	}
+	for _, name := range meta.Names() {
+		if name != image_ext.MetadataXMP && name != image_ext.MetadataICC {
+			dropped = append(dropped, name)
+		}
+	}
+	_, err = w.Write(data)
+	return
+}
+
+// writeMetadata appends a copy of the first IFD with the XMP and ICC
+// entries to data, the header points to the new IFD. The old IFD is kept,
+// so the offsets of the other entries are not changed.
+func writeMetadata(data []byte, meta *image_ext.Metadata) ([]byte, error) {
+	if len(data) < 8 || string(data[:3]) != leHeader[:3] {
+		return nil, fmt.Errorf("jxr: malformed header")
+	}
+	order := binary.LittleEndian
+	off := int(order.Uint32(data[4:8]))
+	if off+2 > len(data) {
+		return nil, fmt.Errorf("jxr: bad IFD offset")
+	}
+	n := int(order.Uint16(data[off:]))
+	if off+2+n*ifdLen+4 > len(data) {
+		return nil, fmt.Errorf("jxr: bad IFD")
+	}
+	if int64(len(data))+int64(len(meta.XMP))+int64(len(meta.ICC))+int64(n+2)*ifdLen+16 > 1<<32-1 {
+		return nil, fmt.Errorf("jxr: metadata too large")
+	}
+
+	var entries ifdEntries
+	for i := 0; i < n; i++ {
+		e := data[off+2+i*ifdLen:][:ifdLen]
+		if tag := order.Uint16(e[0:2]); tag != tXMP && tag != tICCProfile {
+			entries = append(entries, ifdEntry{entry: e})
+		}
+	}
+	addEntry := func(tag, datatype uint16, value []byte) {
+		e := make([]byte, ifdLen)
+		order.PutUint16(e[0:2], tag)
+		order.PutUint16(e[2:4], datatype)
+		order.PutUint32(e[4:8], uint32(len(value)))
+		if len(value) <= 4 {
+			copy(e[8:12], value)
+			value = nil
+		}
+		entries = append(entries, ifdEntry{entry: e, value: value})
+	}
+	if len(meta.XMP) != 0 {
+		addEntry(tXMP, dtByte, meta.XMP)
+	}
+	if len(meta.ICC) != 0 {
+		addEntry(tICCProfile, dtUndefined, meta.ICC)
+	}
+	sort.Sort(entries)
+
+	// the IFD and the values are word aligned
+	out := append([]byte(nil), data...)
+	if len(out)%2 != 0 {
+		out = append(out, 0)
+	}
+	ifdOff := len(out)
+	out = append(out, make([]byte, 2+len(entries)*ifdLen+4)...)
+	order.PutUint16(out[ifdOff:], uint16(len(entries)))
+	for i, e := range entries {
+		entry := out[ifdOff+2+i*ifdLen:][:ifdLen]
+		copy(entry, e.entry)
+		if e.value != nil {
+			order.PutUint32(entry[8:12], uint32(len(out)))
+			out = append(out, e.value...)
+			if len(out)%2 != 0 {
+				out = append(out, 0)
+			}
+		}
+	}
+	// the next IFD of the old IFD is kept
+	copy(out[ifdOff+2+len(entries)*ifdLen:][:4], data[off+2+n*ifdLen:][:4])
+	order.PutUint32(out[4:8], uint32(ifdOff))
+	return out, nil
+}
+
+// ifdEntry is an IFD entry, the value is written after the IFD if it is not
+// nil.
+type ifdEntry struct {
+	entry []byte
+	value []byte
+}
+
+// ifdEntries sorts the IFD entries by their tags.
+type ifdEntries []ifdEntry
+
+func (p ifdEntries) Len() int      { return len(p) }
+func (p ifdEntries) Swap(i, j int) { p[i], p[j] = p[j], p[i] }
+func (p ifdEntries) Less(i, j int) bool {
+	return binary.LittleEndian.Uint16(p[i].entry) < binary.LittleEndian.Uint16(p[j].entry)
+}
+
+// readMetadata reads the XMP and ICC entries of the first IFD.
+func readMetadata(data []byte) (meta *image_ext.Metadata, err error) {
+	if len(data) < 8 || string(data[:3]) != leHeader[:3] {
+		err = fmt.Errorf("jxr: malformed header")
+		return
+	}
+	order := binary.LittleEndian
+	off := int(order.Uint32(data[4:8]))
+	if off+2 > len(data) {
+		err = fmt.Errorf("jxr: bad IFD offset")
+		return
+	}
+	n := int(order.Uint16(data[off:]))
+	if off+2+n*ifdLen > len(data) {
+		err = fmt.Errorf("jxr: bad IFD")
+		return
+	}
+
+	meta = new(image_ext.Metadata)
+	for i := 0; i < n; i++ {
+		e := data[off+2+i*ifdLen:][:ifdLen]
+		tag := order.Uint16(e[0:2])
+		if tag != tXMP && tag != tICCProfile {
+			continue
+		}
+		count := int(order.Uint32(e[4:8]))
+		value := e[8:12]
+		if count > 4 {
+			pos := int(order.Uint32(e[8:12]))
+			if count < 0 || pos < 0 || pos+count > len(data) {
+				err = fmt.Errorf("jxr: bad IFD entry, tag = %x", tag)
+				return
+			}
+			value = data[pos : pos+count]
+		} else {
+			value = value[:count]
+		}
+		switch tag {
+		case tXMP:
+			meta.XMP = append([]byte(nil), value...)
+		case tICCProfile:
+			meta.ICC = append([]byte(nil), value...)
+		}
+	}
+	return
+}
+
+func imageExtDecodeWithMetadata(r io.Reader, opt *image_ext.Options) (image.Image, *image_ext.Metadata, error) {
+	p, err := newOptions(opt)
+	if err != nil {
+		return nil, nil, err
+	}
+	return DecodeWithMetadata(r, p)
+}
+
+func imageExtEncodeWithMetadata(w io.Writer, m image.Image, meta *image_ext.Metadata, opt *image_ext.Options) ([]string, error) {
+	p, err := newEncodeOptions(opt)
+	if err != nil {
+		return nil, err
+	}
+	return EncodeWithMetadata(w, m, meta, p)
+}
@@ -4,7 +4,6 @@
 
 package jxr
 
-import "C"
 import (
 	"fmt"
 	"image"
@@ -12,7 +11,6 @@ import (
 	"io"
 	"io/ioutil"
 
-	"github.com/chai2010/gopkg/builtin"
 	image_ext "github.com/chai2010/gopkg/image"
 	color_ext "github.com/chai2010/gopkg/image/color"
 	"github.com/chai2010/gopkg/image/convert"
@@ -25,56 +23,171 @@ const (
 	ifdLen = 12 // Length of an IFD entry in bytes.
 )
 
-func decodeConfig(data []byte) (config image.Config, err error) {
-	width, height, channels, depth, data_type, err := jxr_decode_config(data)
-	if err != nil {
-		return
-	}
+// DefaultQuality is the quality of Encode if Quality is zero, it's lossless.
+const DefaultQuality = 100
 
-	if data_type != jxr_unsigned {
-		err = fmt.Errorf("jxr: unsupported data type: %v", data_type)
-		return
-	}
+// Overlap is the overlap filtering level of the encoder. The overlap
+// filter reduces the block artifacts of the lossy images.
+type Overlap int
 
-	config.Width = int(width)
-	config.Height = int(height)
+const (
+	OverlapDefault Overlap = iota // chosen by the quality, like the reference encoder
+	OverlapNone                   // no overlap filtering
+	OverlapOne                    // the first level overlap filtering
+	OverlapTwo                    // the first and the second level overlap filtering
+)
+
+// Options are the encoding and decoding parameters.
+type Options struct {
+	ColorModel   color.Model // convert the image to ColorModel
+	Quality      float32     // 1 ~ 100, DefaultQuality if zero, 100 is lossless
+	Lossless     bool        // use lossless encoding, same as Quality 100
+	AlphaQuality float32     // 1 ~ 100 of the alpha channel, Quality if zero
+	TileWidth    int         // the tile width in pixels, rounded up to 16, 0 is one tile column
+	TileHeight   int         // the tile height in pixels, rounded up to 16, 0 is one tile row
+	Overlap      Overlap     // the overlap filtering level
+}
 
-	switch data_type {
+// decoderColorModel returns the color model of the pixels decoded by d.
+// The 16-bit images are big-endian like the standard library, and the
+// 3 channels images may be padded to 4 channels by the decoder.
+func decoderColorModel(d *jxrDecoder) (model color.Model, err error) {
+	n := d.Channels * d.Depth / 8
+	if d.PixelSize != n && !(d.Channels == 3 && d.PixelSize == n/3*4) {
+		err = fmt.Errorf("jxr: unsupported pixel size: %d", d.PixelSize)
+		return
+	}
+	switch d.DataType {
 	case jxr_unsigned:
 		switch {
-		case channels == 1 && depth == 8:
-			config.ColorModel = color.GrayModel
-		case channels == 1 && depth == 16:
-			config.ColorModel = color.Gray16Model
-		case channels == 3 && depth == 8:
-			config.ColorModel = color.RGBAModel
-		case channels == 3 && depth == 16:
-			config.ColorModel = color.RGBA64Model
-		case channels == 4 && depth == 8:
-			config.ColorModel = color.RGBAModel
-		case channels == 4 && depth == 16:
-			config.ColorModel = color.RGBA64Model
+		case d.Channels == 1 && d.Depth == 8:
+			model = color.GrayModel
+		case d.Channels == 1 && d.Depth == 16:
+			model = color.Gray16Model
+		case d.Channels == 3 && d.Depth == 8:
+			model = color_ext.RGBModel
+		case d.Channels == 3 && d.Depth == 16:
+			model = color_ext.RGB48Model
+		case d.Channels == 4 && d.Depth == 8 && d.Premultiplied:
+			model = color.RGBAModel
+		case d.Channels == 4 && d.Depth == 8:
+			model = color.NRGBAModel
+		case d.Channels == 4 && d.Depth == 16 && d.Premultiplied:
+			model = color.RGBA64Model
+		case d.Channels == 4 && d.Depth == 16:
+			model = color.NRGBA64Model
 		}
 	case jxr_float:
 		switch {
-		case channels == 1 && depth == 32:
-			config.ColorModel = color_ext.Gray32fModel
-		case channels == 3 && depth == 32:
-			config.ColorModel = color_ext.RGBA128fModel
-		case channels == 4 && depth == 32:
-			config.ColorModel = color_ext.RGBA128fModel
+		case d.Channels == 1 && d.Depth == 32:
+			model = color_ext.Gray32fModel
+		case d.Channels == 3 && d.Depth == 32:
+			model = color_ext.RGB96fModel
+		case d.Channels == 4 && d.Depth == 32:
+			model = color_ext.RGBA128fModel
 		}
 	}
-	if config.ColorModel == nil {
-		err = fmt.Errorf("jxr: unsupported data type: %v", data_type)
+	if model == nil {
+		err = fmt.Errorf("jxr: unsupported data type: %v, channels = %d, depth = %d", d.DataType, d.Channels, d.Depth)
 		return
 	}
 	return
 }
 
-// Options are the encoding and decoding parameters.
-type Options struct {
-	ColorModel color.Model
+// decodeRect decodes the pixels of d inside r, r must be inside the image.
+func decodeRect(d *jxrDecoder, r image.Rectangle) (m image.Image, err error) {
+	model, err := decoderColorModel(d)
+	if err != nil {
+		return
+	}
+
+	var pix []byte
+	var stride, pixSize int
+	switch model {
+	case color.GrayModel:
+		p := image.NewGray(r)
+		m, pix, stride, pixSize = p, p.Pix, p.Stride, 1
+	case color.Gray16Model:
+		p := image.NewGray16(r)
+		m, pix, stride, pixSize = p, p.Pix, p.Stride, 2
+	case color_ext.Gray32fModel:
+		p := image_ext.NewGray32f(r)
+		m, pix, stride, pixSize = p, p.Pix, p.Stride, 4
+	case color_ext.RGBModel:
+		p := image_ext.NewRGB(r)
+		m, pix, stride, pixSize = p, p.Pix, p.Stride, 3
+	case color_ext.RGB48Model:
+		p := image_ext.NewRGB48(r)
+		m, pix, stride, pixSize = p, p.Pix, p.Stride, 6
+	case color_ext.RGB96fModel:
+		p := image_ext.NewRGB96f(r)
+		m, pix, stride, pixSize = p, p.Pix, p.Stride, 16
+	case color.RGBAModel:
+		p := image.NewRGBA(r)
+		m, pix, stride, pixSize = p, p.Pix, p.Stride, 4
+	case color.NRGBAModel:
+		p := image.NewNRGBA(r)
+		m, pix, stride, pixSize = p, p.Pix, p.Stride, 4
+	case color.RGBA64Model:
+		p := image.NewRGBA64(r)
+		m, pix, stride, pixSize = p, p.Pix, p.Stride, 8
+	case color.NRGBA64Model:
+		p := image.NewNRGBA64(r)
+		m, pix, stride, pixSize = p, p.Pix, p.Stride, 8
+	case color_ext.RGBA128fModel:
+		p := image_ext.NewRGBA128f(r)
+		m, pix, stride, pixSize = p, p.Pix, p.Stride, 16
+	}
+
+	if d.PixelSize == pixSize {
+		if err = d.Decode(r, pix, stride); err != nil {
+			return
+		}
+	} else {
+		// repack the padded or the packed pixels
+		width := r.Dx()
+		tmp := make([]byte, width*d.PixelSize*r.Dy())
+		if err = d.Decode(r, tmp, width*d.PixelSize); err != nil {
+			return
+		}
+		n := d.Channels * d.Depth / 8
+		for y := 0; y < r.Dy(); y++ {
+			src := tmp[y*width*d.PixelSize:]
+			dst := pix[y*stride:]
+			for x := 0; x < width; x++ {
+				copy(dst[x*pixSize:][:n], src[x*d.PixelSize:][:n])
+			}
+		}
+	}
+	if d.Depth == 16 {
+		swap16(pix, r.Dx()*pixSize, r.Dy(), stride)
+	}
+	return
+}
+
+// swap16 swaps the byte order of the 16-bit samples in place.
+func swap16(pix []byte, rowSize, height, stride int) {
+	for y := 0; y < height; y++ {
+		row := pix[y*stride:][:rowSize]
+		for i := 0; i+1 < len(row); i += 2 {
+			row[i], row[i+1] = row[i+1], row[i]
+		}
+	}
+}
+
+func decodeConfig(data []byte) (config image.Config, err error) {
+	d, err := newJxrDecoder(data)
+	if err != nil {
+		return
+	}
+	defer d.Close()
+
+	if config.ColorModel, err = decoderColorModel(d); err != nil {
+		return
+	}
+	config.Width = d.Width
+	config.Height = d.Height
+	return
 }
 
 // DecodeConfig returns the color model and dimensions of a JPEG/XR image without
@@ -88,89 +201,21 @@ func DecodeConfig(r io.Reader) (config image.Config, err error) {
 }
 
 // Decode reads a JPEG/XR image from r and returns it as an image.Image.
+// The 16-bit and float images are decoded as *image.Gray16, *image_ext.RGB48,
+// *image.NRGBA64, *image_ext.Gray32f, *image_ext.RGB96f and *image_ext.RGBA128f.
 func Decode(r io.Reader, opt *Options) (m image.Image, err error) {
 	data, err := ioutil.ReadAll(r)
 	if err != nil {
 		return
 	}
 
-	var config image.Config
-	if config, err = decodeConfig(data); err != nil {
+	d, err := newJxrDecoder(data)
+	if err != nil {
 		return
 	}
+	defer d.Close()
 
-	var channels C.int
-	switch config.ColorModel {
-	case color.GrayModel:
-		gray := image.NewGray(image.Rect(0, 0, config.Width, config.Height))
-		if _, _, _, _, _, err = jxr_decode(data, gray.Pix, gray.Stride); err != nil {
-			return
-		}
-		m = gray
-	case color.Gray16Model:
-		gray16 := image.NewGray16(image.Rect(0, 0, config.Width, config.Height))
-		if _, _, _, _, _, err = jxr_decode(data, gray16.Pix, gray16.Stride); err != nil {
-			return
-		}
-		m = gray16
-	case color_ext.Gray32fModel:
-		gray32f := image_ext.NewGray32f(image.Rect(0, 0, config.Width, config.Height))
-		if _, _, _, _, _, err = jxr_decode(data, gray32f.Pix, gray32f.Stride); err != nil {
-			return
-		}
-		m = gray32f
-	case color.RGBAModel:
-		rgba := image.NewRGBA(image.Rect(0, 0, config.Width, config.Height))
-		if _, _, channels, _, _, err = jxr_decode(data, rgba.Pix, rgba.Stride); err != nil {
-			return
-		}
-		if channels == 3 {
-			b := rgba.Bounds()
-			for y := 0; y < b.Max.Y; y++ {
-				d := rgba.Pix[y*rgba.Stride:]
-				for x := b.Max.X - 1; x >= 0; x-- {
-					copy(d[x*4:][:3], d[x*3:])
-					d[x*4+3] = 0xff
-				}
-			}
-		}
-		m = rgba
-	case color.RGBA64Model:
-		rgba64 := image.NewRGBA64(image.Rect(0, 0, config.Width, config.Height))
-		if _, _, channels, _, _, err = jxr_decode(data, rgba64.Pix, rgba64.Stride); err != nil {
-			return
-		}
-		if channels == 3 {
-			b := rgba64.Bounds()
-			for y := 0; y < b.Max.Y; y++ {
-				d := rgba64.Pix[y*rgba64.Stride:]
-				for x := b.Max.X - 1; x >= 0; x-- {
-					copy(d[x*8:][:6], d[x*6:])
-					d[x*8+7] = 0xff
-					d[x*8+6] = 0xff
-				}
-			}
-		}
-		m = rgba64
-	case color_ext.RGBA128fModel:
-		rgba128f := image_ext.NewRGBA128f(image.Rect(0, 0, config.Width, config.Height))
-		if _, _, channels, _, _, err = jxr_decode(data, rgba128f.Pix, rgba128f.Stride); err != nil {
-			return
-		}
-		if channels == 3 {
-			b := rgba128f.Bounds()
-			for y := 0; y < b.Max.Y; y++ {
-				d := rgba128f.Pix[y*rgba128f.Stride:]
-				for x := b.Max.X - 1; x >= 0; x-- {
-					copy(d[x*8:][:6], d[x*6:])
-					builtin.PutFloat32(d[x*8+6:], 0xffff)
-				}
-			}
-		}
-		m = rgba128f
-	}
-	if m == nil {
-		err = fmt.Errorf("jxr: Decode, unsupported colot model: %T", config.ColorModel)
+	if m, err = decodeRect(d, image.Rect(0, 0, d.Width, d.Height)); err != nil {
 		return
 	}
 	if opt != nil && opt.ColorModel != nil {
@@ -183,20 +228,47 @@ func imageDecode(r io.Reader) (image.Image, error) {
 	return Decode(r, nil)
 }
 
-func imageExtDecode(r io.Reader, opt interface{}) (image.Image, error) {
-	if opt, ok := opt.(*Options); ok {
-		return Decode(r, opt)
-	} else {
-		return Decode(r, nil)
+// newOptions converts the common options to the jxr options.
+func newOptions(opt *image_ext.Options) (*Options, error) {
+	var p Options
+	if ok, err := image_ext.ConvertOptions("jxr", opt, &p); !ok {
+		return nil, err
 	}
+	return &p, nil
 }
 
-func imageExtEncode(w io.Writer, m image.Image, opt interface{}) error {
-	if opt, ok := opt.(*Options); ok {
-		return Encode(w, m, opt)
-	} else {
-		return Encode(w, m, nil)
+// newEncodeOptions converts the common options to the jxr options.
+func newEncodeOptions(opt *image_ext.Options) (*Options, error) {
+	var p Options
+	ok, err := image_ext.ConvertEncodeOptions("jxr", opt, &p, image_ext.EncodeSupport{
+		Quality: true,
+	})
+	if !ok {
+		return nil, err
+	}
+	if opt.Lossless {
+		p.Lossless = true
+	}
+	if opt.Quality != 0 {
+		p.Quality = opt.Quality
+	}
+	return &p, nil
+}
+
+func imageExtDecode(r io.Reader, opt *image_ext.Options) (image.Image, error) {
+	p, err := newOptions(opt)
+	if err != nil {
+		return nil, err
+	}
+	return Decode(r, p)
+}
+
+func imageExtEncode(w io.Writer, m image.Image, opt *image_ext.Options) error {
+	p, err := newEncodeOptions(opt)
+	if err != nil {
+		return err
 	}
+	return Encode(w, m, p)
 }
 
 func init() {
@@ -204,11 +276,14 @@ func init() {
 	image.RegisterFormat("jxr", "II\xBC\x01", imageDecode, DecodeConfig)
 
 	image_ext.RegisterFormat(image_ext.Format{
-		Name:         "jxr",
-		Extensions:   []string{".jxr", ".wdp"},
-		Magics:       []string{"II\xBC\x00", "II\xBC\x01"},
-		DecodeConfig: DecodeConfig,
-		Decode:       imageExtDecode,
-		Encode:       imageExtEncode,
+		Name:               "jxr",
+		Extensions:         []string{".jxr", ".wdp"},
+		Magics:             []string{"II\xBC\x00", "II\xBC\x01"},
+		DecodeConfig:       DecodeConfig,
+		Decode:             imageExtDecode,
+		Encode:             imageExtEncode,
+		DecodeWithMetadata: imageExtDecodeWithMetadata,
+		EncodeWithMetadata: imageExtEncodeWithMetadata,
+		NewTileReader:      imageExtNewTileReader,
 	})
 }
@@ -5,10 +5,15 @@
 package jxr
 
 import (
+	"bytes"
 	"image"
+	"image/color"
 	_ "image/png"
 	"os"
 	"testing"
+
+	image_ext "github.com/chai2010/gopkg/image"
+	color_ext "github.com/chai2010/gopkg/image/color"
 )
 
 const testdataDir = "../testdata/"
@@ -61,6 +66,52 @@ func TestDecode(t *testing.T) {
 	}
 }
 
+func TestNewTileReader(t *testing.T) {
+	for i, model := range []color.Model{color.Gray16Model, color_ext.RGBModel, color.NRGBAModel, color_ext.RGB96fModel} {
+		m0 := tNewImage(image.Rect(0, 0, 150, 100), model)
+		var buf bytes.Buffer
+		if err := Encode(&buf, m0, &Options{TileWidth: 64, TileHeight: 64}); err != nil {
+			t.Fatalf("%d: Encode: %v", i, err)
+		}
+		tr, format, err := image_ext.NewTileReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()), nil)
+		if err != nil || format != "jxr" {
+			t.Fatalf("%d: NewTileReader: %q, %v", i, format, err)
+		}
+		if config := tr.Config(); config.ColorModel != model || config.Width != 150 || config.Height != 100 {
+			t.Fatalf("%d: bad config: %v", i, config)
+		}
+		for _, r := range []image.Rectangle{
+			image.Rect(0, 0, 150, 100),
+			image.Rect(70, 30, 110, 60),
+			image.Rect(3, 77, 9, 200),
+			image.Rect(64, 0, 128, 64),
+		} {
+			m1, err := tr.ReadRect(r, nil)
+			if err != nil {
+				t.Fatalf("%d: ReadRect(%v): %v", i, r, err)
+			}
+			want := m0.(image_ext.ImageBuffer).SubImage(r)
+			compare(t, want, m1)
+		}
+
+		// read into the buffer
+		buffer := tNewImage(image.Rect(0, 0, 150, 100), model).(image_ext.ImageBuffer)
+		r := image.Rect(20, 10, 60, 50)
+		m1, err := tr.ReadRect(r, buffer)
+		if err != nil {
+			t.Fatalf("%d: ReadRect(%v): %v", i, r, err)
+		}
+		compare(t, m0.(image_ext.ImageBuffer).SubImage(r), m1)
+
+		if err := tr.Close(); err != nil {
+			t.Fatalf("%d: Close: %v", i, err)
+		}
+		if _, err := tr.ReadRect(r, nil); err == nil {
+			t.Fatalf("%d: ReadRect after Close: expect error", i)
+		}
+	}
+}
+
 // averageDelta returns the average delta in RGB space. The two images must
 // have the same bounds.
 func averageDelta(m0, m1 image.Image) int64 {
@@ -0,0 +1,103 @@
+// Copyright 2014 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package jxr
+
+import (
+	"fmt"
+	"image"
+	"image/draw"
+	"io"
+	"sync"
+
+	image_ext "github.com/chai2010/gopkg/image"
+	"github.com/chai2010/gopkg/image/convert"
+)
+
+type tileReader struct {
+	mu      sync.Mutex
+	decoder *jxrDecoder
+	opt     *Options
+	config  image.Config
+}
+
+// NewTileReader returns a TileReader for the JPEG/XR image stored in r.
+// The rectangles are decoded by the region decoding of the codec, only
+// the macroblocks around the rectangles are reconstructed.
+func NewTileReader(r io.ReaderAt, size int64, opt *Options) (p image_ext.TileReader, err error) {
+	data := make([]byte, size)
+	if n, err := r.ReadAt(data, 0); n != len(data) {
+		return nil, err
+	}
+	decoder, err := newJxrDecoder(data)
+	if err != nil {
+		return
+	}
+	model, err := decoderColorModel(decoder)
+	if err != nil {
+		decoder.Close()
+		return
+	}
+	if opt != nil && opt.ColorModel != nil {
+		model = opt.ColorModel
+	}
+	p = &tileReader{
+		decoder: decoder,
+		opt:     opt,
+		config:  image.Config{ColorModel: model, Width: decoder.Width, Height: decoder.Height},
+	}
+	return
+}
+
+func (p *tileReader) Config() image.Config {
+	return p.config
+}
+
+func (p *tileReader) ReadRect(r image.Rectangle, buf image_ext.ImageBuffer) (m image.Image, err error) {
+	r = r.Intersect(image.Rect(0, 0, p.config.Width, p.config.Height))
+	if r.Empty() {
+		err = fmt.Errorf("jxr: ReadRect, empty rect: %v", r)
+		return
+	}
+
+	p.mu.Lock()
+	if p.decoder == nil {
+		p.mu.Unlock()
+		err = fmt.Errorf("jxr: ReadRect, reader is closed")
+		return
+	}
+	m, err = decodeRect(p.decoder, r)
+	p.mu.Unlock()
+	if err != nil {
+		return
+	}
+
+	// convert color model
+	if p.opt != nil && p.opt.ColorModel != nil {
+		m = convert.ColorModel(m, p.opt.ColorModel)
+	}
+	if buf != nil && r.In(buf.Bounds()) && buf.ColorModel() == m.ColorModel() {
+		draw.Draw(buf, r, m, r.Min, draw.Src)
+		m = buf.SubImage(r)
+	}
+	return
+}
+
+func (p *tileReader) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.decoder != nil {
+		p.decoder.Close()
+		p.decoder = nil
+	}
+	return nil
+}
+
+func imageExtNewTileReader(r io.ReaderAt, size int64, opt *image_ext.Options) (image_ext.TileReader, error) {
+	p, err := newOptions(opt)
+	if err != nil {
+		return nil, err
+	}
+	return NewTileReader(r, size, p)
+}
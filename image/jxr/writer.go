@@ -5,17 +5,143 @@
 package jxr
 
 import (
-	"errors"
+	"fmt"
 	"image"
+	"image/draw"
 	"io"
 
+	image_ext "github.com/chai2010/gopkg/image"
 	"github.com/chai2010/gopkg/image/convert"
 )
 
 // Encode writes the image m to w in JPEG/XR format.
+//
+// The *image.Gray, *image.Gray16, *image_ext.Gray32f, *image_ext.RGB,
+// *image_ext.RGB48, *image_ext.RGB96f, *image.NRGBA, *image.NRGBA64 and
+// *image_ext.RGBA128f images are encoded directly, the premultiplied images
+// are encoded as the non-premultiplied images, and the others are converted
+// to *image_ext.RGB or *image.NRGBA. The lossless float images keep 20 bits
+// of the 23 bits mantissa, it's the limit of the codec.
 func Encode(w io.Writer, m image.Image, opt *Options) error {
 	if opt != nil && opt.ColorModel != nil {
 		m = convert.ColorModel(m, opt.ColorModel)
 	}
-	return errors.New("jxr: Encode, unsupported")
+	eopt, err := newJxrEncodeOptions(opt)
+	if err != nil {
+		return err
+	}
+
+	var pix []byte
+	var stride, channels, depth int
+	var dataType = jxr_unsigned
+	switch m := adjustImage(m).(type) {
+	case *image.Gray:
+		pix, stride, channels, depth = m.Pix, m.Stride, 1, 8
+	case *image.Gray16:
+		pix, stride, channels, depth = m.Pix, m.Stride, 1, 16
+	case *image_ext.Gray32f:
+		pix, stride, channels, depth, dataType = m.Pix, m.Stride, 1, 32, jxr_float
+	case *image_ext.RGB:
+		pix, stride, channels, depth = m.Pix, m.Stride, 3, 8
+	case *image_ext.RGB48:
+		pix, stride, channels, depth = m.Pix, m.Stride, 3, 16
+	case *image_ext.RGB96f:
+		pix, stride, channels, depth, dataType = m.Pix, m.Stride, 3, 32, jxr_float
+	case *image.NRGBA:
+		pix, stride, channels, depth = m.Pix, m.Stride, 4, 8
+	case *image.NRGBA64:
+		pix, stride, channels, depth = m.Pix, m.Stride, 4, 16
+	case *image_ext.RGBA128f:
+		pix, stride, channels, depth, dataType = m.Pix, m.Stride, 4, 32, jxr_float
+	default:
+		panic("jxr: Encode, unreachable!")
+	}
+
+	b := m.Bounds()
+	if b.Empty() {
+		return fmt.Errorf("jxr: Encode, empty image: %v", b)
+	}
+	if depth == 16 {
+		// the samples of JPEG/XR are little-endian
+		rowSize := b.Dx() * channels * 2
+		pix = append([]byte(nil), pix[:stride*(b.Dy()-1)+rowSize]...)
+		swap16(pix, rowSize, b.Dy(), stride)
+	}
+
+	data, err := jxr_encode(pix, stride, b.Dx(), b.Dy(), channels, depth, dataType, eopt)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(data)
+	return err
+}
+
+// newJxrEncodeOptions checks the options and converts them to the options
+// of the encoder.
+func newJxrEncodeOptions(opt *Options) (*jxrEncodeOptions, error) {
+	p := &jxrEncodeOptions{Quality: 1, AlphaQuality: 1, Overlap: -1}
+	if opt == nil {
+		return p, nil
+	}
+	quality, alphaQuality := opt.Quality, opt.AlphaQuality
+	if quality == 0 {
+		quality = DefaultQuality
+	}
+	if alphaQuality == 0 {
+		alphaQuality = quality
+	}
+	if quality < 0 || quality > 100 {
+		return nil, fmt.Errorf("jxr: Encode, bad Quality: %v", opt.Quality)
+	}
+	if alphaQuality < 0 || alphaQuality > 100 {
+		return nil, fmt.Errorf("jxr: Encode, bad AlphaQuality: %v", opt.AlphaQuality)
+	}
+	if opt.TileWidth < 0 || opt.TileHeight < 0 {
+		return nil, fmt.Errorf("jxr: Encode, bad tile size: %dx%d", opt.TileWidth, opt.TileHeight)
+	}
+	if opt.Overlap < OverlapDefault || opt.Overlap > OverlapTwo {
+		return nil, fmt.Errorf("jxr: Encode, bad Overlap: %d", opt.Overlap)
+	}
+	if !opt.Lossless {
+		p.Quality = quality / 100
+		p.AlphaQuality = alphaQuality / 100
+	}
+	p.TileWidth = opt.TileWidth
+	p.TileHeight = opt.TileHeight
+	p.Overlap = int(opt.Overlap) - 1
+	return p, nil
+}
+
+// adjustImage converts m to the images supported by the encoder.
+func adjustImage(m image.Image) image.Image {
+	switch m := m.(type) {
+	case *image.Gray, *image.Gray16, *image_ext.Gray32f:
+		return m
+	case *image_ext.RGB, *image_ext.RGB48, *image_ext.RGB96f:
+		return m
+	case *image.NRGBA, *image.NRGBA64, *image_ext.RGBA128f:
+		return m
+	case *image.RGBA:
+		if m.Opaque() {
+			return &image.NRGBA{Pix: m.Pix, Stride: m.Stride, Rect: m.Rect}
+		}
+		nrgba := image.NewNRGBA(m.Bounds())
+		draw.Draw(nrgba, nrgba.Rect, m, m.Rect.Min, draw.Src)
+		return nrgba
+	case *image.RGBA64:
+		nrgba64 := image.NewNRGBA64(m.Bounds())
+		draw.Draw(nrgba64, nrgba64.Rect, m, m.Rect.Min, draw.Src)
+		return nrgba64
+	case *image_ext.MaskedImage:
+		// the nodata pixels are zero
+		return adjustImage(m.Image)
+	}
+	if p, ok := m.(interface {
+		Opaque() bool
+	}); ok && p.Opaque() {
+		return convert.RGB(m)
+	}
+	nrgba := image.NewNRGBA(m.Bounds())
+	draw.Draw(nrgba, nrgba.Rect, m, m.Bounds().Min, draw.Src)
+	return nrgba
 }
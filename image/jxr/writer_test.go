@@ -7,9 +7,13 @@ package jxr
 import (
 	"bytes"
 	"image"
+	"image/color"
 	"io/ioutil"
 	"os"
 	"testing"
+
+	image_ext "github.com/chai2010/gopkg/image"
+	color_ext "github.com/chai2010/gopkg/image/color"
 )
 
 func openImage(filename string) (image.Image, error) {
@@ -41,6 +45,154 @@ func TestEncode(t *testing.T) {
 	compare(t, img0, img1)
 }
 
+// tNewImage returns a gradient image of the color model.
+func tNewImage(r image.Rectangle, model color.Model) image.Image {
+	var m image_ext.ImageBuffer
+	switch model {
+	case color.GrayModel:
+		m = image.NewGray(r)
+	case color.Gray16Model:
+		m = image.NewGray16(r)
+	case color_ext.Gray32fModel:
+		m = image_ext.NewGray32f(r)
+	case color_ext.RGBModel:
+		m = image_ext.NewRGB(r)
+	case color_ext.RGB48Model:
+		m = image_ext.NewRGB48(r)
+	case color_ext.RGB96fModel:
+		m = image_ext.NewRGB96f(r)
+	case color.NRGBAModel:
+		m = image.NewNRGBA(r)
+	case color.NRGBA64Model:
+		m = image.NewNRGBA64(r)
+	case color_ext.RGBA128fModel:
+		m = image_ext.NewRGBA128f(r)
+	}
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			v := uint16(x*997 + y*331)
+			m.Set(x, y, color.NRGBA64{v, v * 7, uint16(y * 512), 0xffff - uint16(x*256)})
+		}
+	}
+	return m
+}
+
+func TestEncode_pixelFormats(t *testing.T) {
+	for i, model := range []color.Model{
+		color.GrayModel,
+		color.Gray16Model,
+		color_ext.Gray32fModel,
+		color_ext.RGBModel,
+		color_ext.RGB48Model,
+		color_ext.RGB96fModel,
+		color.NRGBAModel,
+		color.NRGBA64Model,
+		color_ext.RGBA128fModel,
+	} {
+		m0 := tNewImage(image.Rect(0, 0, 67, 45), model)
+		var buf bytes.Buffer
+		if err := Encode(&buf, m0, &Options{Lossless: true}); err != nil {
+			t.Fatalf("%d: Encode: %v", i, err)
+		}
+		config, err := DecodeConfig(bytes.NewReader(buf.Bytes()))
+		if err != nil || config.ColorModel != model || config.Width != 67 || config.Height != 45 {
+			t.Fatalf("%d: bad config: %v, %v", i, config, err)
+		}
+		m1, err := Decode(&buf, nil)
+		if err != nil {
+			t.Fatalf("%d: Decode: %v", i, err)
+		}
+		if m1.ColorModel() != model {
+			t.Fatalf("%d: bad color model: %T", i, m1)
+		}
+		b := m0.Bounds()
+		for y := b.Min.Y; y < b.Max.Y; y++ {
+			for x := b.Min.X; x < b.Max.X; x++ {
+				if c0, c1 := m0.At(x, y), m1.At(x, y); c0 != c1 {
+					t.Fatalf("%d: %T: bad color at (%d, %d): want %v, got %v", i, m0, x, y, c0, c1)
+				}
+			}
+		}
+	}
+}
+
+func TestEncode_quality(t *testing.T) {
+	m0, err := openImage("video-001.wdp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var lossless, lossy bytes.Buffer
+	if err := Encode(&lossless, m0, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := Encode(&lossy, m0, &Options{Quality: 50}); err != nil {
+		t.Fatal(err)
+	}
+	if lossy.Len() >= lossless.Len() {
+		t.Fatalf("lossy is not smaller: %d >= %d", lossy.Len(), lossless.Len())
+	}
+	m1, err := Decode(&lossy, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := averageDelta(m0, m1), int64(8<<8); got > want {
+		t.Fatalf("average delta too high; got %d, want <= %d", got, want)
+	}
+
+	for i, opt := range []*Options{
+		{Quality: 101},
+		{AlphaQuality: -1},
+		{TileWidth: -16},
+		{Overlap: OverlapTwo + 1},
+	} {
+		if err := Encode(ioutil.Discard, m0, opt); err == nil {
+			t.Fatalf("%d: expect error", i)
+		}
+	}
+}
+
+func TestEncode_tiles(t *testing.T) {
+	m0 := tNewImage(image.Rect(0, 0, 100, 70), color.NRGBAModel)
+	for i, opt := range []*Options{
+		{TileWidth: 32, TileHeight: 32},
+		{TileWidth: 16, Overlap: OverlapNone},
+		{TileHeight: 48, Quality: 80, AlphaQuality: 100, Overlap: OverlapOne},
+	} {
+		var buf bytes.Buffer
+		if err := Encode(&buf, m0, opt); err != nil {
+			t.Fatalf("%d: Encode: %v", i, err)
+		}
+		m1, err := Decode(&buf, nil)
+		if err != nil {
+			t.Fatalf("%d: Decode: %v", i, err)
+		}
+		if opt.Quality == 0 {
+			compare(t, m0, m1)
+		} else if got, want := averageDelta(m0, m1), int64(4<<8); got > want {
+			t.Fatalf("%d: average delta too high; got %d, want <= %d", i, got, want)
+		}
+	}
+}
+
+func TestEncode_imageExtOptions(t *testing.T) {
+	m0 := tNewImage(image.Rect(0, 0, 40, 30), color_ext.RGBModel)
+	var buf bytes.Buffer
+	if err := image_ext.Encode("jxr", &buf, m0, &image_ext.Options{Quality: 100}); err != nil {
+		t.Fatal(err)
+	}
+	m1, _, err := image_ext.Decode(&buf, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	compare(t, m0, m1)
+
+	if err := image_ext.Encode("jxr", ioutil.Discard, m0, &image_ext.Options{
+		Compression: image_ext.CompressionDeflate,
+	}); err == nil {
+		t.Fatalf("expect UnsupportedOptionError")
+	}
+}
+
 // BenchmarkEncode benchmarks the encoding of an image.
 func BenchmarkEncode(b *testing.B) {
 	img, err := openImage("video-001.wdp")
@@ -54,3 +206,31 @@ func BenchmarkEncode(b *testing.B) {
 		Encode(ioutil.Discard, img, nil)
 	}
 }
+
+func TestEncodeWithMetadata(t *testing.T) {
+	m0 := tNewImage(image.Rect(0, 0, 40, 30), color_ext.RGBModel)
+	meta0 := &image_ext.Metadata{
+		Exif: []byte("II*\x00\x08\x00\x00\x00\x00\x00\x00\x00\x00\x00"),
+		XMP:  []byte(`<x:xmpmeta xmlns:x="adobe:ns:meta/"></x:xmpmeta>`),
+		ICC:  bytes.Repeat([]byte("icc-profile"), 101),
+	}
+	var buf bytes.Buffer
+	dropped, err := image_ext.EncodeWithMetadata("jxr", &buf, m0, meta0, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(dropped) != 1 || dropped[0] != image_ext.MetadataExif {
+		t.Fatalf("bad dropped: %v", dropped)
+	}
+	m1, meta1, format, err := image_ext.DecodeWithMetadata(&buf, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if format != "jxr" {
+		t.Fatalf("bad format: %s", format)
+	}
+	if !bytes.Equal(meta1.XMP, meta0.XMP) || !bytes.Equal(meta1.ICC, meta0.ICC) || meta1.Exif != nil {
+		t.Fatalf("bad metadata: %v", meta1.Names())
+	}
+	compare(t, m0, m1)
+}
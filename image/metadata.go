@@ -0,0 +1,197 @@
+// Copyright 2014 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package image
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"io"
+	"io/ioutil"
+	"os"
+)
+
+// Metadata names, used to report the dropped metadata.
+const (
+	MetadataExif    = "EXIF"
+	MetadataXMP     = "XMP"
+	MetadataICC     = "ICC"
+	MetadataGeoTIFF = "GeoTIFF"
+)
+
+// Metadata holds the metadata of an image which is not part of the pixels.
+type Metadata struct {
+	Exif    []byte   // EXIF data, a TIFF stream begins with "II*\x00" or "MM\x00*"
+	XMP     []byte   // XMP packet
+	ICC     []byte   // ICC color profile
+	GeoTIFF *GeoTIFF // GeoTIFF georeferencing tags
+}
+
+// GeoTIFF holds the GeoTIFF tags.
+//
+// The GeoTIFF specification is at http://www.remotesensing.org/geotiff/spec/geotiffhome.html
+type GeoTIFF struct {
+	ModelPixelScale     []float64 // tag 33550
+	ModelTiepoint       []float64 // tag 33922
+	ModelTransformation []float64 // tag 34264
+	GeoKeyDirectory     []uint16  // tag 34735
+	GeoDoubleParams     []float64 // tag 34736
+	GeoAsciiParams      string    // tag 34737
+}
+
+// IsEmpty reports whether p has no tags.
+func (p *GeoTIFF) IsEmpty() bool {
+	return p == nil || (len(p.ModelPixelScale) == 0 &&
+		len(p.ModelTiepoint) == 0 &&
+		len(p.ModelTransformation) == 0 &&
+		len(p.GeoKeyDirectory) == 0 &&
+		len(p.GeoDoubleParams) == 0 &&
+		len(p.GeoAsciiParams) == 0)
+}
+
+// Names returns the names of the metadata held by p.
+func (p *Metadata) Names() (names []string) {
+	if p == nil {
+		return
+	}
+	if len(p.Exif) != 0 {
+		names = append(names, MetadataExif)
+	}
+	if len(p.XMP) != 0 {
+		names = append(names, MetadataXMP)
+	}
+	if len(p.ICC) != 0 {
+		names = append(names, MetadataICC)
+	}
+	if !p.GeoTIFF.IsEmpty() {
+		names = append(names, MetadataGeoTIFF)
+	}
+	return
+}
+
+// IsEmpty reports whether p holds no metadata.
+func (p *Metadata) IsEmpty() bool {
+	return len(p.Names()) == 0
+}
+
+// DecodeWithMetadata decodes an image and its metadata. The metadata is nil
+// if the format can't read it, like the fallback formats.
+func DecodeWithMetadata(r io.Reader, opt *Options) (m image.Image, meta *Metadata, format string, err error) {
+	rr := asReader(r)
+	f := sniffByMagic(rr)
+	if f.Decode == nil {
+		m, format, err = decodeFallback(rr, opt)
+		return
+	}
+	format = f.Name
+	if f.DecodeWithMetadata == nil {
+		m, err = f.Decode(rr, opt)
+		return
+	}
+	m, meta, err = f.DecodeWithMetadata(rr, opt)
+	return
+}
+
+// EncodeWithMetadata encodes an image and its metadata as a registered format.
+// The dropped returns the names of the metadata which the format can't store.
+// If opt.KeepMetadata is true, nothing is written and an error is returned
+// instead of dropping the metadata.
+func EncodeWithMetadata(format string, w io.Writer, m image.Image, meta *Metadata, opt *Options) (dropped []string, err error) {
+	for _, f := range formats {
+		if f.Name == format {
+			return encodeWithMetadata(f, w, m, meta, opt)
+		}
+	}
+	err = image.ErrFormat
+	return
+}
+
+func encodeWithMetadata(f Format, w io.Writer, m image.Image, meta *Metadata, opt *Options) (dropped []string, err error) {
+	if f.Encode == nil {
+		err = image.ErrFormat
+		return
+	}
+	if f.EncodeWithMetadata == nil {
+		if dropped, err = dropMetadata(f, meta, opt); err != nil {
+			return
+		}
+		err = f.Encode(w, m, opt)
+		return
+	}
+	if opt == nil || !opt.KeepMetadata {
+		dropped, err = f.EncodeWithMetadata(w, m, meta, opt)
+		return
+	}
+
+	var buf bytes.Buffer
+	if dropped, err = f.EncodeWithMetadata(&buf, m, meta, opt); err != nil {
+		return
+	}
+	if len(dropped) != 0 {
+		err = fmt.Errorf("image/%s: can't keep metadata %v", f.Name, dropped)
+		return
+	}
+	_, err = w.Write(buf.Bytes())
+	return
+}
+
+// dropMetadata returns the names of the metadata dropped by the format f
+// which can't store any metadata, or an error if opt.KeepMetadata is true.
+func dropMetadata(f Format, meta *Metadata, opt *Options) (dropped []string, err error) {
+	if dropped = meta.Names(); len(dropped) != 0 && opt != nil && opt.KeepMetadata {
+		err = fmt.Errorf("image/%s: can't keep metadata %v", f.Name, dropped)
+	}
+	return
+}
+
+// LoadWithMetadata reads the image and its metadata from the named file.
+// The files are read like Load, the metadata is nil if the format can't
+// read it, like the formats with sidecar files and the fallback formats.
+func LoadWithMetadata(filename string, opt *Options) (m image.Image, meta *Metadata, format string, err error) {
+	if f := sniffByName(filename); f.LoadFile != nil {
+		m, err = f.LoadFile(filename, opt)
+		return m, nil, f.Name, err
+	}
+	f, err := os.Open(filename)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	rr := asReader(f)
+	if sniffByMagic(rr).DecodeWithMetadata == nil {
+		m, format, err = loadReader(filename, rr, opt)
+		return
+	}
+	m, meta, format, err = DecodeWithMetadata(rr, opt)
+	return
+}
+
+// SaveWithMetadata writes the image and its metadata to the named file,
+// the format is determined by the file name extension. The formats with
+// sidecar files are written like Save, their metadata is dropped.
+func SaveWithMetadata(filename string, m image.Image, meta *Metadata, opt *Options) (dropped []string, err error) {
+	format := sniffByName(filename)
+	if format.SaveFile != nil && format.EncodeWithMetadata == nil {
+		if dropped, err = dropMetadata(format, meta, opt); err != nil {
+			return
+		}
+		err = format.SaveFile(filename, m, opt)
+		return
+	}
+	if format.Encode == nil {
+		err = image.ErrFormat
+		return
+	}
+
+	// the file is not written if the encoding fails
+	var buf bytes.Buffer
+	if dropped, err = encodeWithMetadata(format, &buf, m, meta, opt); err != nil {
+		return
+	}
+	if err = ioutil.WriteFile(filename, buf.Bytes(), 0666); err != nil {
+		os.Remove(filename)
+	}
+	return
+}
@@ -0,0 +1,200 @@
+// Copyright 2014 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package image_test
+
+import (
+	"bytes"
+	"image"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"testing"
+
+	image_ext "github.com/chai2010/gopkg/image"
+)
+
+var tMetadata = &image_ext.Metadata{
+	Exif: []byte("II*\x00\x08\x00\x00\x00\x00\x00\x00\x00\x00\x00"),
+	XMP:  []byte(`<x:xmpmeta xmlns:x="adobe:ns:meta/"></x:xmpmeta>`),
+	ICC:  bytes.Repeat([]byte("icc-profile"), 7000), // 2 APP2 segments for jpeg
+	GeoTIFF: &image_ext.GeoTIFF{
+		ModelPixelScale: []float64{0.5, 0.5, 0},
+		ModelTiepoint:   []float64{0, 0, 0, 116.3, 39.9, 0},
+		GeoKeyDirectory: []uint16{1, 1, 0, 1, 1024, 0, 1, 2},
+		GeoAsciiParams:  "WGS 84|",
+	},
+}
+
+func TestMetadata(t *testing.T) {
+	golden, _, err := image_ext.Load("testdata/video-001.png", nil)
+	if err != nil {
+		t.Fatalf("Load golden fialed: %v", err)
+	}
+
+	for i, v := range []struct {
+		Format  string
+		Dropped []string
+	}{
+		{"jpeg", []string{image_ext.MetadataGeoTIFF}},
+		{"png", []string{image_ext.MetadataGeoTIFF}},
+		{"tiff", nil},
+		{"webp", []string{image_ext.MetadataGeoTIFF}},
+		{"bmp", tMetadata.Names()},
+	} {
+		var buf bytes.Buffer
+		dropped, err := image_ext.EncodeWithMetadata(v.Format, &buf, golden, tMetadata, nil)
+		if err != nil {
+			t.Fatalf("%d: %s, EncodeWithMetadata: %v", i, v.Format, err)
+		}
+		if !reflect.DeepEqual(dropped, v.Dropped) {
+			t.Fatalf("%d: %s, bad dropped; got %v, want %v", i, v.Format, dropped, v.Dropped)
+		}
+
+		_, meta, format, err := image_ext.DecodeWithMetadata(&buf, nil)
+		if err != nil {
+			t.Fatalf("%d: %s, DecodeWithMetadata: %v", i, v.Format, err)
+		}
+		if format != v.Format {
+			t.Fatalf("%d: bad format; got %v, want %v", i, format, v.Format)
+		}
+		if names := meta.Names(); len(names)+len(dropped) != len(tMetadata.Names()) {
+			t.Fatalf("%d: %s, bad metadata; got %v, dropped %v", i, v.Format, names, dropped)
+		}
+		for _, name := range meta.Names() {
+			var got, want interface{}
+			switch name {
+			case image_ext.MetadataExif:
+				got, want = meta.Exif, tMetadata.Exif
+			case image_ext.MetadataXMP:
+				got, want = meta.XMP, tMetadata.XMP
+			case image_ext.MetadataICC:
+				got, want = meta.ICC, tMetadata.ICC
+			case image_ext.MetadataGeoTIFF:
+				got, want = meta.GeoTIFF, tMetadata.GeoTIFF
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Fatalf("%d: %s, bad %s", i, v.Format, name)
+			}
+		}
+	}
+}
+
+func TestMetadata_KeepMetadata(t *testing.T) {
+	golden, _, err := image_ext.Load("testdata/video-001.png", nil)
+	if err != nil {
+		t.Fatalf("Load golden fialed: %v", err)
+	}
+
+	opt := &image_ext.Options{KeepMetadata: true}
+	for i, v := range []struct {
+		Format string
+		Meta   *image_ext.Metadata
+		Ok     bool
+	}{
+		{"png", &image_ext.Metadata{XMP: tMetadata.XMP}, true},
+		{"png", tMetadata, false},
+		{"tiff", &image_ext.Metadata{GeoTIFF: tMetadata.GeoTIFF}, true},
+		{"bmp", &image_ext.Metadata{ICC: tMetadata.ICC}, false},
+		{"bmp", nil, true},
+	} {
+		var buf bytes.Buffer
+		_, err := image_ext.EncodeWithMetadata(v.Format, &buf, golden, v.Meta, opt)
+		if v.Ok && err != nil {
+			t.Fatalf("%d: %s, EncodeWithMetadata: %v", i, v.Format, err)
+		}
+		if !v.Ok && (err == nil || buf.Len() != 0) {
+			t.Fatalf("%d: %s, expect error and nothing written", i, v.Format)
+		}
+	}
+}
+
+func TestLoadWithMetadata(t *testing.T) {
+	golden, _, err := image_ext.Load("testdata/video-001.png", nil)
+	if err != nil {
+		t.Fatalf("Load golden fialed: %v", err)
+	}
+	dir, err := ioutil.TempDir("", "image-metadata-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	filename := filepath.Join(dir, "a.png")
+	dropped, err := image_ext.SaveWithMetadata(filename, golden, tMetadata, nil)
+	if err != nil || !reflect.DeepEqual(dropped, []string{image_ext.MetadataGeoTIFF}) {
+		t.Fatalf("SaveWithMetadata: %v, dropped %v", err, dropped)
+	}
+	_, meta, format, err := image_ext.LoadWithMetadata(filename, nil)
+	if err != nil || format != "png" || !bytes.Equal(meta.XMP, tMetadata.XMP) {
+		t.Fatalf("LoadWithMetadata: %v, %q, %v", err, format, meta.Names())
+	}
+
+	// nothing is written if the encoding fails
+	for i, opt := range []*image_ext.Options{{KeepMetadata: true}, {Quality: 75}} {
+		name := filepath.Join(dir, "b.png")
+		if _, err = image_ext.SaveWithMetadata(name, golden, tMetadata, opt); err == nil {
+			t.Fatalf("%d: SaveWithMetadata: expect error", i)
+		}
+		if _, err = os.Stat(name); !os.IsNotExist(err) {
+			t.Fatalf("%d: SaveWithMetadata: expect nothing written, %v", i, err)
+		}
+	}
+
+	// the width of the gray pixels is stored in the sidecar file
+	image_ext.RegisterFormat(image_ext.Format{
+		Name:       "tsidecar",
+		Extensions: []string{".tsidecar"},
+		LoadFile: func(filename string, opt *image_ext.Options) (image.Image, error) {
+			hdr, err := ioutil.ReadFile(filename + ".hdr")
+			if err != nil {
+				return nil, err
+			}
+			width, err := strconv.Atoi(string(hdr))
+			if err != nil {
+				return nil, err
+			}
+			pix, err := ioutil.ReadFile(filename)
+			if err != nil {
+				return nil, err
+			}
+			m := image.NewGray(image.Rect(0, 0, width, len(pix)/width))
+			copy(m.Pix, pix)
+			return m, nil
+		},
+		SaveFile: func(filename string, m image.Image, opt *image_ext.Options) error {
+			gray := m.(*image.Gray)
+			hdr := strconv.Itoa(gray.Bounds().Dx())
+			if err := ioutil.WriteFile(filename+".hdr", []byte(hdr), 0666); err != nil {
+				return err
+			}
+			return ioutil.WriteFile(filename, gray.Pix, 0666)
+		},
+	})
+	m0 := image.NewGray(image.Rect(0, 0, 5, 3))
+	for i := range m0.Pix {
+		m0.Pix[i] = uint8(i * 17)
+	}
+	filename = filepath.Join(dir, "a.tsidecar")
+	opt := &image_ext.Options{KeepMetadata: true}
+	if _, err = image_ext.SaveWithMetadata(filename, m0, tMetadata, opt); err == nil {
+		t.Fatalf("SaveWithMetadata: expect error")
+	}
+	if _, err = os.Stat(filename); !os.IsNotExist(err) {
+		t.Fatalf("SaveWithMetadata: expect nothing written, %v", err)
+	}
+	dropped, err = image_ext.SaveWithMetadata(filename, m0, tMetadata, nil)
+	if err != nil || !reflect.DeepEqual(dropped, tMetadata.Names()) {
+		t.Fatalf("SaveWithMetadata: %v, dropped %v", err, dropped)
+	}
+	m1, meta, format, err := image_ext.LoadWithMetadata(filename, nil)
+	if err != nil || format != "tsidecar" || meta != nil {
+		t.Fatalf("LoadWithMetadata: %v, %q, %v", err, format, meta)
+	}
+	if !reflect.DeepEqual(m0, m1) {
+		t.Fatalf("LoadWithMetadata: bad image")
+	}
+}
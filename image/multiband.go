@@ -0,0 +1,191 @@
+// Copyright 2014 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package image
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"reflect"
+
+	"github.com/chai2010/gopkg/builtin"
+	color_ext "github.com/chai2010/gopkg/image/color"
+)
+
+// MultiBand is an in-memory image with any number of bands, such as the
+// multispectral satellite images. Each band has its own data type, and the
+// bands of a pixel are interleaved. The At method returns color.RGBA64
+// values which are mapped from the bands by Model.Mapping.
+type MultiBand struct {
+	// Pix holds the image's pixels. The pixel at (x, y) starts at
+	// Pix[(y-Rect.Min.Y)*Stride + (x-Rect.Min.X)*Model.PixelSize()].
+	Pix []byte
+	// Stride is the Pix stride between vertically adjacent pixels.
+	Stride int
+	// Rect is the image's bounds.
+	Rect image.Rectangle
+	// Model describes the bands and the band-to-RGB mapping.
+	Model *color_ext.MultiBandModel
+}
+
+func (p *MultiBand) ColorModel() color.Model { return p.Model }
+
+func (p *MultiBand) Bounds() image.Rectangle { return p.Rect }
+
+func (p *MultiBand) At(x, y int) color.Color {
+	if !(image.Point{x, y}.In(p.Rect)) {
+		return color.RGBA64{}
+	}
+	var rgb [3]uint16
+	for i, k := range p.Model.Mapping.Band {
+		if k < 0 {
+			continue
+		}
+		v := p.Value(x, y, k)
+		if p.Model.Band[k].IsNoData(v) {
+			return color.RGBA64{}
+		}
+		rgb[i] = p.Model.ToRGB(i, v)
+	}
+	return color.RGBA64{R: rgb[0], G: rgb[1], B: rgb[2], A: 0xffff}
+}
+
+// PixOffset returns the index of the first element of Pix that corresponds to
+// the band k of the pixel at (x, y).
+func (p *MultiBand) PixOffset(x, y, k int) int {
+	i := (y-p.Rect.Min.Y)*p.Stride + (x-p.Rect.Min.X)*p.Model.PixelSize()
+	for _, b := range p.Model.Band[:k] {
+		i += b.Size()
+	}
+	return i
+}
+
+// Value returns the value of the band k of the pixel at (x, y).
+func (p *MultiBand) Value(x, y, k int) float64 {
+	if !(image.Point{x, y}.In(p.Rect)) {
+		return 0
+	}
+	b := p.Pix[p.PixOffset(x, y, k):]
+	switch p.Model.Band[k].DataType {
+	case reflect.Uint8:
+		return float64(b[0])
+	case reflect.Uint16:
+		return float64(builtin.Uint16(b))
+	case reflect.Int16:
+		return float64(int16(builtin.Uint16(b)))
+	case reflect.Int32:
+		return float64(int32(builtin.Uint32(b)))
+	case reflect.Float32:
+		return float64(builtin.Float32(b))
+	case reflect.Float64:
+		return builtin.Float64(b)
+	}
+	return 0
+}
+
+// SetValue sets the value of the band k of the pixel at (x, y), the value
+// is clamped to the range of the band data type.
+func (p *MultiBand) SetValue(x, y, k int, v float64) {
+	if !(image.Point{x, y}.In(p.Rect)) {
+		return
+	}
+	b := p.Pix[p.PixOffset(x, y, k):]
+	switch p.Model.Band[k].DataType {
+	case reflect.Uint8:
+		b[0] = uint8(clampRound(v, 0, math.MaxUint8))
+	case reflect.Uint16:
+		builtin.PutUint16(b, uint16(clampRound(v, 0, math.MaxUint16)))
+	case reflect.Int16:
+		builtin.PutUint16(b, uint16(int16(clampRound(v, math.MinInt16, math.MaxInt16))))
+	case reflect.Int32:
+		builtin.PutUint32(b, uint32(int32(clampRound(v, math.MinInt32, math.MaxInt32))))
+	case reflect.Float32:
+		builtin.PutFloat32(b, float32(v))
+	case reflect.Float64:
+		builtin.PutFloat64(b, v)
+	}
+}
+
+// IsNoData reports whether any mapped band of the pixel at (x, y) is nodata.
+func (p *MultiBand) IsNoData(x, y int) bool {
+	for _, k := range p.Model.Mapping.Band {
+		if k >= 0 && p.Model.Band[k].IsNoData(p.Value(x, y, k)) {
+			return true
+		}
+	}
+	return false
+}
+
+// Set sets the mapped bands of the pixel at (x, y) from c, see
+// MultiBandModel.FromColor.
+func (p *MultiBand) Set(x, y int, c color.Color) {
+	if !(image.Point{x, y}.In(p.Rect)) {
+		return
+	}
+	v, _ := p.Model.FromColor(c)
+	for i, k := range p.Model.Mapping.Band {
+		if k >= 0 {
+			p.SetValue(x, y, k, v[i])
+		}
+	}
+}
+
+// SubImage returns an image representing the portion of the image p visible
+// through r. The returned value shares pixels with the original image.
+func (p *MultiBand) SubImage(r image.Rectangle) image.Image {
+	r = r.Intersect(p.Rect)
+	// If r1 and r2 are Rectangles, r1.Intersect(r2) is not guaranteed to be inside
+	// either r1 or r2 if the intersection is empty. Without explicitly checking for
+	// this, the Pix[i:] expression below can panic.
+	if r.Empty() {
+		return &MultiBand{Model: p.Model}
+	}
+	i := p.PixOffset(r.Min.X, r.Min.Y, 0)
+	return &MultiBand{
+		Pix:    p.Pix[i:],
+		Stride: p.Stride,
+		Rect:   r,
+		Model:  p.Model,
+	}
+}
+
+// Opaque scans the entire image and reports whether it is fully opaque.
+func (p *MultiBand) Opaque() bool {
+	if p.Rect.Empty() {
+		return true
+	}
+	for _, k := range p.Model.Mapping.Band {
+		if k >= 0 && p.Model.Band[k].HasNoData {
+			for y := p.Rect.Min.Y; y < p.Rect.Max.Y; y++ {
+				for x := p.Rect.Min.X; x < p.Rect.Max.X; x++ {
+					if p.IsNoData(x, y) {
+						return false
+					}
+				}
+			}
+			return true
+		}
+	}
+	return true
+}
+
+// NewMultiBand returns a new MultiBand with the given bounds and model.
+// The image shares the model pointer.
+func NewMultiBand(r image.Rectangle, model *color_ext.MultiBandModel) *MultiBand {
+	w, h := r.Dx(), r.Dy()
+	n := model.PixelSize()
+	pix := make([]byte, w*h*n)
+	return &MultiBand{pix, w * n, r, model}
+}
+
+func clampRound(v, min, max float64) float64 {
+	switch {
+	case v < min:
+		return min
+	case v > max:
+		return max
+	}
+	return math.Floor(v + 0.5)
+}
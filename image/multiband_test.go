@@ -0,0 +1,161 @@
+// Copyright 2014 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package image_test
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"math"
+	"reflect"
+	"testing"
+
+	image_ext "github.com/chai2010/gopkg/image"
+	color_ext "github.com/chai2010/gopkg/image/color"
+)
+
+func tNewMultiBandModel() *color_ext.MultiBandModel {
+	model := color_ext.NewMultiBandModel(
+		color_ext.BandInfo{Name: "blue", DataType: reflect.Uint16},
+		color_ext.BandInfo{Name: "green", DataType: reflect.Uint8},
+		color_ext.BandInfo{Name: "red", DataType: reflect.Int16, NoData: -9999, HasNoData: true},
+		color_ext.BandInfo{Name: "nir", DataType: reflect.Float32},
+		color_ext.BandInfo{Name: "swir", DataType: reflect.Int32},
+		color_ext.BandInfo{Name: "tir", DataType: reflect.Float64, NoData: math.NaN(), HasNoData: true},
+	)
+	model.Mapping.Band = [3]int{2, 1, 0}
+	return model
+}
+
+func TestMultiBand(t *testing.T) {
+	model := tNewMultiBandModel()
+	if err := model.Valid(); err != nil {
+		t.Fatalf("Valid: %v", err)
+	}
+	if n := model.PixelSize(); n != 2+1+2+4+4+8 {
+		t.Fatalf("bad pixel size; got %d, want %d", n, 2+1+2+4+4+8)
+	}
+
+	m := image_ext.NewMultiBand(image.Rect(0, 0, 10, 10), model)
+	if m.ColorModel() != model {
+		t.Fatalf("bad color model")
+	}
+	for k, v := range []float64{65535, 255, -1, 0.5, -100000, math.Inf(1)} {
+		m.SetValue(6, 3, k, v)
+		if got := m.Value(6, 3, k); got != v {
+			t.Fatalf("band %d: bad value; got %v, want %v", k, got, v)
+		}
+	}
+	if got := m.SubImage(image.Rect(3, 2, 9, 8)).(*image_ext.MultiBand).Value(6, 3, 4); got != -100000 {
+		t.Fatalf("sub-image: bad value; got %v, want %v", got, -100000)
+	}
+
+	// band-to-RGB mapping
+	m.SetValue(6, 3, 2, 0x1234)
+	if got, want := m.At(6, 3), (color.RGBA64{R: 0x1234, G: 0xffff, B: 0xffff, A: 0xffff}); got != want {
+		t.Fatalf("bad color; got %v, want %v", got, want)
+	}
+	m.Set(6, 3, color.RGBA{R: 0x10, G: 0x20, B: 0x30, A: 0xff})
+	if got, want := [3]float64{m.Value(6, 3, 2), m.Value(6, 3, 1), m.Value(6, 3, 0)}, [3]float64{0x1010, 0x20, 0x3030}; got != want {
+		t.Fatalf("bad mapped values; got %v, want %v", got, want)
+	}
+
+	// nodata
+	if !m.Opaque() {
+		t.Fatalf("want opaque image")
+	}
+	m.Set(6, 3, color.Transparent)
+	if got := m.Value(6, 3, 2); got != -9999 || !m.IsNoData(6, 3) {
+		t.Fatalf("want nodata value; got %v", got)
+	}
+	if got := m.At(6, 3); got != (color.RGBA64{}) {
+		t.Fatalf("want transparent color; got %v", got)
+	}
+	if m.Opaque() {
+		t.Fatalf("want non-opaque image")
+	}
+
+	// gray mapping and range
+	model.Mapping = color_ext.BandMapping{
+		Band: [3]int{3, 3, 3},
+		Min:  [3]float64{0, 0, 0},
+		Max:  [3]float64{1, 1, 1},
+	}
+	if got, want := m.At(6, 3), (color.RGBA64{R: 0x8000, G: 0x8000, B: 0x8000, A: 0xffff}); got != want {
+		t.Fatalf("bad gray color; got %v, want %v", got, want)
+	}
+	m.Set(6, 3, color.White)
+	if got := m.Value(6, 3, 3); got != 1 {
+		t.Fatalf("bad gray value; got %v, want 1", got)
+	}
+}
+
+func TestMultiBand_tiff(t *testing.T) {
+	model := tNewMultiBandModel()
+	for i := range model.Band {
+		model.Band[i].NoData, model.Band[i].HasNoData = -1, true
+	}
+	m := image_ext.NewMultiBand(image.Rect(0, 0, 30, 20), model)
+	for y := 0; y < 20; y++ {
+		for x := 0; x < 30; x++ {
+			for k := range model.Band {
+				m.SetValue(x, y, k, float64(x+y*k))
+			}
+		}
+	}
+	m.SetValue(6, 3, 5, -1)
+
+	var buf bytes.Buffer
+	if err := image_ext.Encode("tiff", &buf, m, nil); err != nil {
+		t.Fatalf("Encode: %v", err)
+	}
+	config, _, err := image_ext.DecodeConfig(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatalf("DecodeConfig: %v", err)
+	}
+	if config.Width != 30 || config.Height != 20 {
+		t.Fatalf("bad config: %v", config)
+	}
+	got, _, err := image_ext.Decode(bytes.NewReader(buf.Bytes()), nil)
+	if err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+	tr, _, err := image_ext.NewTileReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()), nil)
+	if err != nil {
+		t.Fatalf("NewTileReader: %v", err)
+	}
+	tile, err := tr.ReadRect(image.Rect(5, 2, 9, 7), nil)
+	if err != nil {
+		t.Fatalf("ReadRect: %v", err)
+	}
+
+	for _, v := range []image.Image{got, tile} {
+		mb, ok := v.(*image_ext.MultiBand)
+		if !ok {
+			t.Fatalf("bad image type: %T", v)
+		}
+		for k, band := range mb.Model.Band {
+			if band.Name != model.Band[k].Name || band.DataType != model.Band[k].DataType {
+				t.Fatalf("band %d: want %v, got %v", k, model.Band[k], band)
+			}
+			if !band.HasNoData || band.NoData != -1 {
+				t.Fatalf("band %d: bad nodata: %v", k, band)
+			}
+		}
+		b := mb.Bounds()
+		for y := b.Min.Y; y < b.Max.Y; y++ {
+			for x := b.Min.X; x < b.Max.X; x++ {
+				for k := range model.Band {
+					if a, b := mb.Value(x, y, k), m.Value(x, y, k); a != b {
+						t.Fatalf("(%d, %d), band %d: want %v, got %v", x, y, k, b, a)
+					}
+				}
+			}
+		}
+		if !mb.Model.Band[5].IsNoData(mb.Value(6, 3, 5)) {
+			t.Fatalf("want nodata at (6, 3)")
+		}
+	}
+}
@@ -0,0 +1,171 @@
+// Copyright 2014 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package image
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+
+	color_ext "github.com/chai2010/gopkg/image/color"
+)
+
+// NoDataImage is an image which has nodata pixels, such as the void cells
+// of DEM or remote-sensing rasters. The nodata pixels are skipped by the
+// conversion, drawing and pyramid functions.
+type NoDataImage interface {
+	image.Image
+	// HasNoData reports whether the image may have nodata pixels.
+	HasNoData() bool
+	// IsNoData reports whether the pixel at (x, y) is nodata.
+	IsNoData(x, y int) bool
+}
+
+// NoDataSetter is a NoDataImage which can mark the pixels as nodata.
+type NoDataSetter interface {
+	NoDataImage
+	SetNoData(x, y int)
+}
+
+// Mask is a bit mask of the nodata pixels.
+type Mask struct {
+	// Pix holds the mask bits, 1 for the nodata pixels. The bit of (x, y) is
+	// Pix[(y-Rect.Min.Y)*Stride + (x-Rect.Min.X)/8] & (0x80 >> uint((x-Rect.Min.X)%8)).
+	Pix []byte
+	// Stride is the Pix stride between vertically adjacent pixels.
+	Stride int
+	// Rect is the mask's bounds.
+	Rect image.Rectangle
+}
+
+// NewMask returns a new Mask with the given bounds, all the pixels are valid.
+func NewMask(r image.Rectangle) *Mask {
+	w, h := r.Dx(), r.Dy()
+	stride := (w + 7) / 8
+	return &Mask{make([]byte, stride*h), stride, r}
+}
+
+// IsNoData reports whether the pixel at (x, y) is nodata.
+func (p *Mask) IsNoData(x, y int) bool {
+	if !(image.Point{x, y}.In(p.Rect)) {
+		return false
+	}
+	i, bit := p.bitOffset(x, y)
+	return p.Pix[i]&bit != 0
+}
+
+// SetNoData marks the pixel at (x, y) as nodata or valid.
+func (p *Mask) SetNoData(x, y int, nodata bool) {
+	if !(image.Point{x, y}.In(p.Rect)) {
+		return
+	}
+	i, bit := p.bitOffset(x, y)
+	if nodata {
+		p.Pix[i] |= bit
+	} else {
+		p.Pix[i] &^= bit
+	}
+}
+
+func (p *Mask) bitOffset(x, y int) (i int, bit byte) {
+	dx := x - p.Rect.Min.X
+	return (y-p.Rect.Min.Y)*p.Stride + dx/8, 0x80 >> uint(dx%8)
+}
+
+// MaskedImage adds the nodata pixels to an image. A pixel is nodata if its
+// bit in Mask is set, or its color equals NoData.
+type MaskedImage struct {
+	draw.Image             // the pixels
+	NoData     color.Color // the nodata value, may be nil
+	Mask       *Mask       // the nodata bit mask, may be nil
+}
+
+// NewMaskedImage returns a new MaskedImage of m, nodata or mask may be nil.
+func NewMaskedImage(m draw.Image, nodata color.Color, mask *Mask) *MaskedImage {
+	return &MaskedImage{
+		Image:  m,
+		NoData: nodata,
+		Mask:   mask,
+	}
+}
+
+func (p *MaskedImage) HasNoData() bool {
+	return p.NoData != nil || p.Mask != nil
+}
+
+func (p *MaskedImage) IsNoData(x, y int) bool {
+	if p.Mask != nil && p.Mask.IsNoData(x, y) {
+		return true
+	}
+	if p.NoData != nil {
+		return isSameColor(p.Image.At(x, y), p.Image.ColorModel().Convert(p.NoData))
+	}
+	return false
+}
+
+// SetNoData marks the pixel at (x, y) as nodata, the pixel is set to the
+// nodata value if NoData is not nil.
+func (p *MaskedImage) SetNoData(x, y int) {
+	if p.Mask != nil {
+		p.Mask.SetNoData(x, y, true)
+	}
+	if p.NoData != nil {
+		p.Image.Set(x, y, p.NoData)
+	}
+}
+
+// SubImage returns an image representing the portion of the image p visible
+// through r. The returned value shares pixels and mask with the original
+// image.
+func (p *MaskedImage) SubImage(r image.Rectangle) image.Image {
+	m, ok := p.Image.(interface {
+		SubImage(r image.Rectangle) image.Image
+	})
+	if !ok {
+		return p
+	}
+	sub, ok := m.SubImage(r).(draw.Image)
+	if !ok {
+		return p
+	}
+	return &MaskedImage{
+		Image:  sub,
+		NoData: p.NoData,
+		Mask:   p.Mask,
+	}
+}
+
+// HasNoData reports whether any mapped band has a nodata value.
+func (p *MultiBand) HasNoData() bool {
+	return p.Model.HasNoData()
+}
+
+// SetNoData sets the bands which have nodata values of the pixel at (x, y)
+// to nodata.
+func (p *MultiBand) SetNoData(x, y int) {
+	for k, b := range p.Model.Band {
+		if b.HasNoData {
+			p.SetValue(x, y, k, b.NoData)
+		}
+	}
+}
+
+// isSameColor reports whether a and b are the same color, the NaN float
+// colors are the same.
+func isSameColor(a, b color.Color) bool {
+	if a == b {
+		return true
+	}
+	switch a := a.(type) {
+	case color_ext.Gray32f:
+		b, ok := b.(color_ext.Gray32f)
+		return ok && math.IsNaN(float64(a.Y)) && math.IsNaN(float64(b.Y))
+	case color_ext.Gray64f:
+		b, ok := b.(color_ext.Gray64f)
+		return ok && math.IsNaN(a.Y) && math.IsNaN(b.Y)
+	}
+	return false
+}
@@ -0,0 +1,76 @@
+// Copyright 2014 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package image_test
+
+import (
+	"image"
+	"math"
+	"testing"
+
+	image_ext "github.com/chai2010/gopkg/image"
+	color_ext "github.com/chai2010/gopkg/image/color"
+	"github.com/chai2010/gopkg/image/convert"
+)
+
+func TestMask(t *testing.T) {
+	mask := image_ext.NewMask(image.Rect(3, 5, 20, 9))
+	for _, pt := range []image.Point{{3, 5}, {10, 5}, {11, 6}, {19, 8}} {
+		if mask.IsNoData(pt.X, pt.Y) {
+			t.Fatalf("%v: expect valid", pt)
+		}
+		mask.SetNoData(pt.X, pt.Y, true)
+		if !mask.IsNoData(pt.X, pt.Y) {
+			t.Fatalf("%v: expect nodata", pt)
+		}
+	}
+	if mask.IsNoData(4, 5) || mask.IsNoData(10, 6) || mask.IsNoData(100, 100) {
+		t.Fatalf("bad neighbour bits")
+	}
+	mask.SetNoData(10, 5, false)
+	if mask.IsNoData(10, 5) {
+		t.Fatalf("SetNoData(false) failed")
+	}
+}
+
+func TestMaskedImage(t *testing.T) {
+	nan := color_ext.Gray32f{Y: float32(math.NaN())}
+	m := image_ext.NewGray32f(image.Rect(0, 0, 4, 4))
+	p := image_ext.NewMaskedImage(m, nan, image_ext.NewMask(m.Bounds()))
+
+	m.SetGray32f(1, 1, color_ext.Gray32f{Y: 100})
+	p.SetNoData(2, 2)
+	p.Mask.SetNoData(3, 3, true)
+	m.SetGray32f(3, 3, color_ext.Gray32f{Y: 200})
+	for _, v := range []struct {
+		Pt     image.Point
+		NoData bool
+	}{
+		{image.Pt(1, 1), false},
+		{image.Pt(2, 2), true},
+		{image.Pt(3, 3), true},
+	} {
+		if got := p.IsNoData(v.Pt.X, v.Pt.Y); got != v.NoData {
+			t.Fatalf("%v: bad IsNoData; got %v, want %v", v.Pt, got, v.NoData)
+		}
+	}
+	if sub := p.SubImage(image.Rect(2, 2, 4, 4)).(*image_ext.MaskedImage); !sub.IsNoData(2, 2) {
+		t.Fatalf("SubImage: lost nodata")
+	}
+
+	// the nodata pixels are zero after conversion
+	rgb, ok := convert.ColorModel(p, color_ext.RGB48Model).(*image_ext.MaskedImage)
+	if !ok {
+		t.Fatalf("ColorModel: expect *MaskedImage")
+	}
+	if _, ok := rgb.Image.(*image_ext.RGB48); !ok {
+		t.Fatalf("ColorModel: bad image type %T", rgb.Image)
+	}
+	if !rgb.IsNoData(2, 2) || !rgb.IsNoData(3, 3) || rgb.IsNoData(1, 1) {
+		t.Fatalf("ColorModel: bad mask")
+	}
+	if c := rgb.At(3, 3).(color_ext.RGB48); c != (color_ext.RGB48{}) {
+		t.Fatalf("ColorModel: bad nodata pixel %v", c)
+	}
+}
@@ -0,0 +1,152 @@
+// Copyright 2014 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package image
+
+import (
+	"fmt"
+	"image/color"
+	"reflect"
+)
+
+// Compression is the compression method requested by Options.
+type Compression int
+
+const (
+	CompressionDefault  Compression = iota // the default of the format
+	CompressionNone                        // no compression
+	CompressionDeflate                     // zlib/deflate
+	CompressionLZW                         // LZW
+	CompressionPackBits                    // PackBits
+	CompressionSnappy                      // snappy
+)
+
+func (c Compression) String() string {
+	switch c {
+	case CompressionDefault:
+		return "Default"
+	case CompressionNone:
+		return "None"
+	case CompressionDeflate:
+		return "Deflate"
+	case CompressionLZW:
+		return "LZW"
+	case CompressionPackBits:
+		return "PackBits"
+	case CompressionSnappy:
+		return "Snappy"
+	}
+	return fmt.Sprintf("Compression(%d)", int(c))
+}
+
+// Options are the encoding and decoding parameters understood by every
+// registered format. The zero value means the defaults of the format.
+// Quality, Lossless and Compression are only used by the encoders.
+//
+// A format returns an *UnsupportedOptionError when an option is set that
+// it can't honour, instead of ignoring it.
+type Options struct {
+	ColorModel   color.Model // convert the image to ColorModel
+	Quality      float32     // 0 ~ 100, 0 means the default quality
+	Lossless     bool        // use lossless encoding
+	Compression  Compression // compression method
+	KeepMetadata bool        // fail instead of dropping the metadata
+
+	// Progress reports the progress of the encoding, and cancels it with
+	// ErrCanceled if it returns false. It's ignored by the formats which
+	// don't report the progress.
+	Progress ProgressFunc
+
+	// Ext holds the format specific options, like *webp.Options.
+	// The common fields above override the same fields of Ext.
+	Ext interface{}
+}
+
+// An UnsupportedOptionError reports that an option is not supported
+// by a format.
+type UnsupportedOptionError struct {
+	Format string // format name, like "bmp"
+	Option string // option description, like "Quality"
+}
+
+func (e *UnsupportedOptionError) Error() string {
+	return fmt.Sprintf("image/%s: unsupported option %s", e.Format, e.Option)
+}
+
+// NewUnsupportedOptionError returns an *UnsupportedOptionError.
+// The option is formatted in the manner of fmt.Sprintf.
+func NewUnsupportedOptionError(format string, option string, a ...interface{}) error {
+	return &UnsupportedOptionError{
+		Format: format,
+		Option: fmt.Sprintf(option, a...),
+	}
+}
+
+// EncodeSupport describes the common options supported by the encoder of a
+// format, see ConvertEncodeOptions.
+type EncodeSupport struct {
+	Quality     bool          // Quality is supported
+	NoLossless  bool          // Lossless is not supported
+	Compression []Compression // the supported methods besides CompressionDefault
+}
+
+// ConvertOptions converts opt to the options of a format, ext is a pointer
+// to the zero options of the format. ext is set to the copy of opt.Ext,
+// which must be nil or of the type of ext, and then the ColorModel and
+// Progress fields of ext, if any, are set to the non-nil fields of opt.
+// It returns false if opt is nil or on error.
+func ConvertOptions(format string, opt *Options, ext interface{}) (ok bool, err error) {
+	if opt == nil {
+		return false, nil
+	}
+	p := reflect.ValueOf(ext).Elem()
+	if opt.Ext != nil {
+		v := reflect.ValueOf(opt.Ext)
+		if v.Type() != reflect.TypeOf(ext) {
+			return false, NewUnsupportedOptionError(format, "type %T", opt.Ext)
+		}
+		if !v.IsNil() {
+			p.Set(v.Elem())
+		}
+	}
+	if opt.ColorModel != nil {
+		setOptionField(p, "ColorModel", opt.ColorModel)
+	}
+	if opt.Progress != nil {
+		setOptionField(p, "Progress", opt.Progress)
+	}
+	return true, nil
+}
+
+// ConvertEncodeOptions is like ConvertOptions, but it returns an
+// *UnsupportedOptionError if opt has an option which is not in support.
+func ConvertEncodeOptions(format string, opt *Options, ext interface{}, support EncodeSupport) (ok bool, err error) {
+	if opt == nil {
+		return false, nil
+	}
+	if opt.Quality != 0 && !support.Quality {
+		return false, NewUnsupportedOptionError(format, "Quality")
+	}
+	if opt.Lossless && support.NoLossless {
+		return false, NewUnsupportedOptionError(format, "Lossless")
+	}
+	if opt.Compression != CompressionDefault {
+		ok = false
+		for _, v := range support.Compression {
+			ok = ok || v == opt.Compression
+		}
+		if !ok {
+			return false, NewUnsupportedOptionError(format, "Compression %v", opt.Compression)
+		}
+	}
+	return ConvertOptions(format, opt, ext)
+}
+
+// setOptionField sets the field of the struct p if p has the field, the
+// fields of the embedded structs are not set.
+func setOptionField(p reflect.Value, name string, v interface{}) {
+	if f, ok := p.Type().FieldByName(name); ok && len(f.Index) == 1 {
+		p.Field(f.Index[0]).Set(reflect.ValueOf(v))
+	}
+}
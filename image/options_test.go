@@ -0,0 +1,86 @@
+// Copyright 2014 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package image_test
+
+import (
+	"image/color"
+	"testing"
+
+	image_ext "github.com/chai2010/gopkg/image"
+)
+
+type tFormatOptions struct {
+	ColorModel color.Model
+	Progress   image_ext.ProgressFunc
+	Level      int
+}
+
+// tEmbedOptions has the Progress in the nil embedded options, like the
+// *jpeg.Options of the jpeg options.
+type tEmbedOptions struct {
+	*tFormatOptions
+	ColorModel color.Model
+}
+
+func TestConvertOptions(t *testing.T) {
+	var p tFormatOptions
+	if ok, err := image_ext.ConvertOptions("tfmt", nil, &p); ok || err != nil {
+		t.Fatalf("nil options: %v, %v", ok, err)
+	}
+
+	progress := func(done float64) bool { return true }
+	opt := &image_ext.Options{
+		ColorModel: color.GrayModel,
+		Progress:   progress,
+		Ext:        &tFormatOptions{ColorModel: color.RGBAModel, Level: 3},
+	}
+	if ok, err := image_ext.ConvertOptions("tfmt", opt, &p); !ok || err != nil {
+		t.Fatalf("ConvertOptions: %v, %v", ok, err)
+	}
+	if p.ColorModel != color.GrayModel || p.Progress == nil || p.Level != 3 {
+		t.Fatalf("ConvertOptions: bad options %+v", p)
+	}
+
+	var q tEmbedOptions
+	opt.Ext = (*tEmbedOptions)(nil)
+	if ok, err := image_ext.ConvertOptions("tfmt", opt, &q); !ok || err != nil {
+		t.Fatalf("ConvertOptions(embed): %v, %v", ok, err)
+	}
+	if q.ColorModel != color.GrayModel || q.tFormatOptions != nil {
+		t.Fatalf("ConvertOptions(embed): bad options %+v", q)
+	}
+
+	opt.Ext = &q
+	if _, err := image_ext.ConvertOptions("tfmt", opt, &p); err == nil {
+		t.Fatalf("ConvertOptions: expect error of the Ext type")
+	}
+}
+
+func TestConvertEncodeOptions(t *testing.T) {
+	support := image_ext.EncodeSupport{
+		NoLossless:  true,
+		Compression: []image_ext.Compression{image_ext.CompressionLZW},
+	}
+	for i, v := range []struct {
+		Opt *image_ext.Options
+		Ok  bool
+	}{
+		{&image_ext.Options{}, true},
+		{&image_ext.Options{Compression: image_ext.CompressionLZW}, true},
+		{&image_ext.Options{Compression: image_ext.CompressionDeflate}, false},
+		{&image_ext.Options{Quality: 75}, false},
+		{&image_ext.Options{Lossless: true}, false},
+		{&image_ext.Options{Ext: 1}, false},
+	} {
+		var p tFormatOptions
+		ok, err := image_ext.ConvertEncodeOptions("tfmt", v.Opt, &p, support)
+		if ok != v.Ok {
+			t.Fatalf("%d: expect %v, got %v, %v", i, v.Ok, ok, err)
+		}
+		if _, isUnsupported := err.(*image_ext.UnsupportedOptionError); !ok && !isUnsupported {
+			t.Fatalf("%d: expect UnsupportedOptionError, got %v", i, err)
+		}
+	}
+}
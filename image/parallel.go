@@ -0,0 +1,90 @@
+// Copyright 2014 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package image
+
+import (
+	"image"
+	"runtime"
+	"sync"
+)
+
+// Workers is the max number of goroutines of the row-band parallel image
+// functions, such as the conversions of image/convert and the pyramid
+// functions of image/draw. Zero means runtime.GOMAXPROCS(0), and one
+// disables the parallelism. It should be set before these functions are
+// called.
+var Workers = 0
+
+// minParallelPixels is the min number of pixels of a band, the smaller
+// images are not split.
+const minParallelPixels = 1 << 14
+
+// ParallelRows splits r into horizontal bands and calls fn with the bands
+// in parallel, it returns when all the calls return. The bands start at
+// even rows, so the rows which share the chroma samples of YCbCr images are
+// in the same band.
+//
+// The images are the images which fn reads or writes, fn is called once
+// with r if any of them is not an in-memory image, whose methods may not
+// be safe for concurrent use, such as the tiled big images.
+func ParallelRows(r image.Rectangle, fn func(r image.Rectangle), m ...image.Image) {
+	if r.Empty() {
+		return
+	}
+	for _, m := range m {
+		if !isInMemoryImage(m) {
+			fn(r)
+			return
+		}
+	}
+	n := Workers
+	if n <= 0 {
+		n = runtime.GOMAXPROCS(0)
+	}
+	if max := r.Dx() * r.Dy() / minParallelPixels; n > max {
+		n = max
+	}
+	if max := r.Dy() / 2; n > max {
+		n = max
+	}
+	if n <= 1 {
+		fn(r)
+		return
+	}
+
+	h := (r.Dy() + n - 1) / n
+	var wg sync.WaitGroup
+	for y0 := r.Min.Y; y0 < r.Max.Y; {
+		y1 := (y0 + h + 1) &^ 1
+		if y1 > r.Max.Y {
+			y1 = r.Max.Y
+		}
+		wg.Add(1)
+		go func(band image.Rectangle) {
+			defer wg.Done()
+			fn(band)
+		}(image.Rect(r.Min.X, y0, r.Max.X, y1))
+		y0 = y1
+	}
+	wg.Wait()
+}
+
+// isInMemoryImage reports whether the different rows of m can be read and
+// written in parallel.
+func isInMemoryImage(m image.Image) bool {
+	switch m := m.(type) {
+	case *image.Gray, *image.Gray16, *image.Alpha, *image.Alpha16,
+		*image.RGBA, *image.RGBA64, *image.NRGBA, *image.NRGBA64,
+		*image.YCbCr, *image.Paletted, *image.Uniform:
+		return true
+	case *Gray32f, *RGB, *RGB48, *RGB96f, *RGBA128f, *YCbCr,
+		*Gray16s, *Gray32i, *Gray64f, *RGB48s, *RGB96i, *RGB192f,
+		*MultiBand:
+		return true
+	case *MaskedImage:
+		return isInMemoryImage(m.Image)
+	}
+	return false
+}
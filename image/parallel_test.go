@@ -0,0 +1,56 @@
+// Copyright 2014 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package image_test
+
+import (
+	"image"
+	"sync"
+	"testing"
+
+	image_ext "github.com/chai2010/gopkg/image"
+)
+
+func TestParallelRows(t *testing.T) {
+	defer func(n int) { image_ext.Workers = n }(image_ext.Workers)
+
+	for i, v := range []struct {
+		Workers int
+		Rect    image.Rectangle
+	}{
+		{0, image.Rect(0, 0, 1024, 1024)},
+		{1, image.Rect(0, 0, 1024, 1024)},
+		{3, image.Rect(0, 0, 1024, 1024)},
+		{4, image.Rect(3, 5, 515, 1030)},
+		{7, image.Rect(-10, -11, 1000, 1001)},
+		{8, image.Rect(0, 0, 16, 16)},
+	} {
+		image_ext.Workers = v.Workers
+
+		var mu sync.Mutex
+		rows := make(map[int]int)
+		image_ext.ParallelRows(v.Rect, func(r image.Rectangle) {
+			mu.Lock()
+			defer mu.Unlock()
+			if r.Min.X != v.Rect.Min.X || r.Max.X != v.Rect.Max.X {
+				t.Errorf("%d: bad band %v of %v", i, r, v.Rect)
+			}
+			if r.Min.Y != v.Rect.Min.Y && r.Min.Y%2 != 0 {
+				t.Errorf("%d: band %v starts at odd row", i, r)
+			}
+			for y := r.Min.Y; y < r.Max.Y; y++ {
+				rows[y]++
+			}
+		}, image_ext.NewGray32f(v.Rect))
+
+		for y := v.Rect.Min.Y; y < v.Rect.Max.Y; y++ {
+			if rows[y] != 1 {
+				t.Fatalf("%d: row %d is called %d times", i, y, rows[y])
+			}
+		}
+		if len(rows) != v.Rect.Dy() {
+			t.Fatalf("%d: bad rows; got %d, want %d", i, len(rows), v.Rect.Dy())
+		}
+	}
+}
@@ -0,0 +1,203 @@
+// Copyright 2014 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package png
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"image"
+	"io"
+	"io/ioutil"
+
+	image_ext "github.com/chai2010/gopkg/image"
+)
+
+const (
+	xmpKeyword = "XML:com.adobe.xmp"
+	iccName    = "ICC Profile"
+)
+
+// DecodeWithMetadata reads a PNG image and its EXIF/XMP/ICC metadata from r.
+func DecodeWithMetadata(r io.Reader, opt *Options) (m image.Image, meta *image_ext.Metadata, err error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return
+	}
+	if meta, err = readMetadata(data); err != nil {
+		return
+	}
+	if m, err = Decode(bytes.NewReader(data), opt); err != nil {
+		return
+	}
+	return
+}
+
+// EncodeWithMetadata writes the image m and its metadata to w in PNG format.
+// The GeoTIFF tags are dropped, their name is returned.
+func EncodeWithMetadata(w io.Writer, m image.Image, meta *image_ext.Metadata, opt *Options) (dropped []string, err error) {
+	var buf bytes.Buffer
+	if err = Encode(&buf, m, opt); err != nil {
+		return
+	}
+	data := buf.Bytes()
+
+	// the metadata chunks are placed after the IHDR chunk
+	ihdrEnd := len(pngHeader) + 8 + int(binary.BigEndian.Uint32(data[len(pngHeader):])) + 4
+	chunks, dropped, err := makeMetadataChunks(meta)
+	if err != nil {
+		return
+	}
+	if _, err = w.Write(data[:ihdrEnd]); err != nil {
+		return
+	}
+	if _, err = w.Write(chunks); err != nil {
+		return
+	}
+	if _, err = w.Write(data[ihdrEnd:]); err != nil {
+		return
+	}
+	return
+}
+
+// readMetadata reads the eXIf, iTXt and iCCP chunks before the IDAT chunk.
+func readMetadata(data []byte) (meta *image_ext.Metadata, err error) {
+	if !bytes.HasPrefix(data, []byte(pngHeader)) {
+		err = fmt.Errorf("image/png: not a PNG file")
+		return
+	}
+
+	meta = new(image_ext.Metadata)
+	for i := len(pngHeader); i+8 <= len(data); {
+		n := int(binary.BigEndian.Uint32(data[i:]))
+		typ := string(data[i+4 : i+8])
+		if n < 0 || i+12+n > len(data) {
+			err = fmt.Errorf("image/png: bad chunk length, %d", n)
+			return
+		}
+		chunk := data[i+8 : i+8+n]
+		i += 12 + n
+
+		switch typ {
+		case "IDAT", "IEND":
+			return
+		case "eXIf":
+			meta.Exif = append([]byte(nil), chunk...)
+		case "iCCP":
+			idx := bytes.IndexByte(chunk, 0)
+			if idx < 0 || idx+2 > len(chunk) || chunk[idx+1] != 0 {
+				err = fmt.Errorf("image/png: bad iCCP chunk")
+				return
+			}
+			if meta.ICC, err = zlibDecompress(chunk[idx+2:]); err != nil {
+				return
+			}
+		case "iTXt":
+			if !bytes.HasPrefix(chunk, []byte(xmpKeyword+"\x00")) {
+				continue
+			}
+			// compression flag, compression method, language tag, translated keyword
+			p := chunk[len(xmpKeyword)+1:]
+			if len(p) < 2 {
+				err = fmt.Errorf("image/png: bad iTXt chunk")
+				return
+			}
+			compressed := p[0] != 0
+			p = p[2:]
+			for k := 0; k < 2; k++ {
+				idx := bytes.IndexByte(p, 0)
+				if idx < 0 {
+					err = fmt.Errorf("image/png: bad iTXt chunk")
+					return
+				}
+				p = p[idx+1:]
+			}
+			if compressed {
+				if meta.XMP, err = zlibDecompress(p); err != nil {
+					return
+				}
+			} else {
+				meta.XMP = append([]byte(nil), p...)
+			}
+		}
+	}
+	return
+}
+
+// makeMetadataChunks returns the iCCP, eXIf and iTXt chunks of meta.
+func makeMetadataChunks(meta *image_ext.Metadata) (chunks []byte, dropped []string, err error) {
+	if meta == nil {
+		return
+	}
+	var buf bytes.Buffer
+	writeChunk := func(typ string, parts ...[]byte) {
+		var n int
+		for _, part := range parts {
+			n += len(part)
+		}
+		var hdr [8]byte
+		binary.BigEndian.PutUint32(hdr[:4], uint32(n))
+		copy(hdr[4:], typ)
+		buf.Write(hdr[:])
+
+		crc := crc32.NewIEEE()
+		crc.Write(hdr[4:])
+		for _, part := range parts {
+			buf.Write(part)
+			crc.Write(part)
+		}
+		binary.Write(&buf, binary.BigEndian, crc.Sum32())
+	}
+
+	if len(meta.ICC) != 0 {
+		var zbuf bytes.Buffer
+		zw := zlib.NewWriter(&zbuf)
+		if _, err = zw.Write(meta.ICC); err != nil {
+			return
+		}
+		if err = zw.Close(); err != nil {
+			return
+		}
+		writeChunk("iCCP", []byte(iccName+"\x00\x00"), zbuf.Bytes())
+	}
+	if len(meta.Exif) != 0 {
+		writeChunk("eXIf", meta.Exif)
+	}
+	if len(meta.XMP) != 0 {
+		writeChunk("iTXt", []byte(xmpKeyword+"\x00\x00\x00\x00\x00"), meta.XMP)
+	}
+	if !meta.GeoTIFF.IsEmpty() {
+		dropped = append(dropped, image_ext.MetadataGeoTIFF)
+	}
+	chunks = buf.Bytes()
+	return
+}
+
+func zlibDecompress(data []byte) ([]byte, error) {
+	zr, err := zlib.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+	return ioutil.ReadAll(zr)
+}
+
+func imageExtDecodeWithMetadata(r io.Reader, opt *image_ext.Options) (image.Image, *image_ext.Metadata, error) {
+	p, err := newOptions(opt)
+	if err != nil {
+		return nil, nil, err
+	}
+	return DecodeWithMetadata(r, p)
+}
+
+func imageExtEncodeWithMetadata(w io.Writer, m image.Image, meta *image_ext.Metadata, opt *image_ext.Options) ([]string, error) {
+	p, err := newEncodeOptions(opt)
+	if err != nil {
+		return nil, err
+	}
+	return EncodeWithMetadata(w, m, meta, p)
+}
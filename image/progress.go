@@ -0,0 +1,80 @@
+// Copyright 2014 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package image
+
+import (
+	"errors"
+	"sync"
+)
+
+// ErrCanceled is returned by the long running operations, such as the
+// encoders and the big image writing, if the ProgressFunc returns false.
+var ErrCanceled = errors.New("image: operation canceled")
+
+// ProgressFunc reports the progress of a long running operation, done is
+// the completed fraction in [0, 1]. The operation is canceled if it
+// returns false. It may be called from different goroutines, but the
+// calls are serialized and the done values are increasing.
+type ProgressFunc func(done float64) bool
+
+// Progress counts the finished steps of an operation and reports them to
+// a ProgressFunc. The methods are safe for concurrent use, and a nil
+// *Progress reports nothing and is never canceled.
+type Progress struct {
+	mu       sync.Mutex
+	fn       ProgressFunc
+	total    int
+	done     int
+	canceled bool
+}
+
+// NewProgress returns a Progress of the operation of total steps, it
+// returns nil if fn is nil.
+func NewProgress(fn ProgressFunc, total int) *Progress {
+	if fn == nil {
+		return nil
+	}
+	return &Progress{fn: fn, total: total}
+}
+
+// Step marks n more steps are finished, and reports whether the operation
+// should go on.
+func (p *Progress) Step(n int) bool {
+	if p == nil {
+		return true
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.canceled {
+		return false
+	}
+	if p.done += n; p.done > p.total {
+		p.done = p.total
+	}
+	done := 1.0
+	if p.total > 0 {
+		done = float64(p.done) / float64(p.total)
+	}
+	p.canceled = !p.fn(done)
+	return !p.canceled
+}
+
+// Canceled reports whether the ProgressFunc has returned false.
+func (p *Progress) Canceled() bool {
+	if p == nil {
+		return false
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.canceled
+}
+
+// Err returns ErrCanceled if the operation is canceled, or nil.
+func (p *Progress) Err() error {
+	if p.Canceled() {
+		return ErrCanceled
+	}
+	return nil
+}
@@ -0,0 +1,48 @@
+// Copyright 2014 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package image_test
+
+import (
+	"sync"
+	"testing"
+
+	image_ext "github.com/chai2010/gopkg/image"
+)
+
+func TestProgress(t *testing.T) {
+	var values []float64
+	p := image_ext.NewProgress(func(done float64) bool {
+		values = append(values, done)
+		return done <= 0.5
+	}, 4)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			p.Step(1)
+		}()
+	}
+	wg.Wait()
+	if p.Canceled() || p.Err() != nil {
+		t.Fatalf("canceled before 0.5: %v", values)
+	}
+	if p.Step(1) || !p.Canceled() || p.Err() != image_ext.ErrCanceled {
+		t.Fatalf("not canceled at 0.75: %v", values)
+	}
+	if p.Step(1) {
+		t.Fatal("Step returns true after the cancellation")
+	}
+	if len(values) != 3 || values[0] != 0.25 || values[1] != 0.5 || values[2] != 0.75 {
+		t.Fatalf("bad progress values: %v", values)
+	}
+
+	// nil Progress is never canceled
+	p = image_ext.NewProgress(nil, 4)
+	if p != nil || !p.Step(5) || p.Canceled() || p.Err() != nil {
+		t.Fatal("bad nil Progress")
+	}
+}
@@ -81,6 +81,44 @@ var tTesterList = []tTester{
 		DataType: reflect.Float32,
 		Channels: 4,
 	},
+	// Gray16s/Gray32i/Gray64f
+	tTester{
+		Image:    image_ext.NewGray16s(image.Rect(0, 0, 10, 10)),
+		Model:    color_ext.Gray16sModel,
+		DataType: reflect.Int16,
+		Channels: 1,
+	},
+	tTester{
+		Image:    image_ext.NewGray32i(image.Rect(0, 0, 10, 10)),
+		Model:    color_ext.Gray32iModel,
+		DataType: reflect.Int32,
+		Channels: 1,
+	},
+	tTester{
+		Image:    image_ext.NewGray64f(image.Rect(0, 0, 10, 10)),
+		Model:    color_ext.Gray64fModel,
+		DataType: reflect.Float64,
+		Channels: 1,
+	},
+	// RGB48s/RGB96i/RGB192f
+	tTester{
+		Image:    image_ext.NewRGB48s(image.Rect(0, 0, 10, 10)),
+		Model:    color_ext.RGB48sModel,
+		DataType: reflect.Int16,
+		Channels: 3,
+	},
+	tTester{
+		Image:    image_ext.NewRGB96i(image.Rect(0, 0, 10, 10)),
+		Model:    color_ext.RGB96iModel,
+		DataType: reflect.Int32,
+		Channels: 3,
+	},
+	tTester{
+		Image:    image_ext.NewRGB192f(image.Rect(0, 0, 10, 10)),
+		Model:    color_ext.RGB192fModel,
+		DataType: reflect.Float64,
+		Channels: 3,
+	},
 }
 
 func TestEncodeAndDecode(t *testing.T) {
@@ -108,6 +146,82 @@ func TestEncodeAndDecode(t *testing.T) {
 	}
 }
 
+func TestEncodeAndDecode_SignedAndFloat(t *testing.T) {
+	for i, v := range []struct {
+		Image    draw.Image
+		Color    color.Color
+		DataType reflect.Kind
+		Channels int
+	}{
+		{image_ext.NewGray16s(image.Rect(0, 0, 10, 10)), color_ext.Gray16s{-1234}, reflect.Int16, 1},
+		{image_ext.NewGray32i(image.Rect(0, 0, 10, 10)), color_ext.Gray32i{-123456}, reflect.Int32, 1},
+		{image_ext.NewGray64f(image.Rect(0, 0, 10, 10)), color_ext.Gray64f{-0.125}, reflect.Float64, 1},
+		{image_ext.NewRGB48s(image.Rect(0, 0, 10, 10)), color_ext.RGB48s{-1, 2, -3}, reflect.Int16, 3},
+		{image_ext.NewRGB96i(image.Rect(0, 0, 10, 10)), color_ext.RGB96i{-1e6, 2, -3}, reflect.Int32, 3},
+		{image_ext.NewRGB192f(image.Rect(0, 0, 10, 10)), color_ext.RGB192f{-1.5, 2, 1e10}, reflect.Float64, 3},
+	} {
+		v.Image.Set(6, 3, v.Color)
+
+		encoder := Encoder{v.Channels, v.DataType}
+		decoder := Decoder{v.Channels, v.DataType, v.Image.Bounds().Dx(), v.Image.Bounds().Dy()}
+		data, err := encoder.Encode(v.Image, nil)
+		if err != nil {
+			t.Fatalf("%d: %v", i, err)
+		}
+		m, err := decoder.Decode(data, nil)
+		if err != nil {
+			t.Fatalf("%d: %v", i, err)
+		}
+		if c := m.At(6, 3); c != v.Color {
+			t.Fatalf("%d: want %v, got %v", i, v.Color, c)
+		}
+	}
+}
+
+func TestEncodeAndDecode_MultiBand(t *testing.T) {
+	for i, v := range []struct {
+		DataType reflect.Kind
+		Channels int
+	}{
+		{reflect.Uint8, 2},
+		{reflect.Uint16, 8},
+		{reflect.Int16, 4},
+		{reflect.Int32, 5},
+		{reflect.Float32, 13},
+		{reflect.Float64, 4},
+	} {
+		model := color_ext.NewUniformMultiBandModel(v.Channels, v.DataType)
+		b := image.Rect(0, 0, 10, 10)
+		mb := image_ext.NewMultiBand(b, model)
+		for k := 0; k < v.Channels; k++ {
+			mb.SetValue(6, 3, k, float64(k*10+1))
+		}
+
+		encoder := Encoder{v.Channels, v.DataType}
+		decoder := Decoder{v.Channels, v.DataType, b.Dx(), b.Dy()}
+		data, err := encoder.Encode(mb, nil)
+		if err != nil {
+			t.Fatalf("%d: %v", i, err)
+		}
+		m, err := decoder.Decode(data, nil)
+		if err != nil {
+			t.Fatalf("%d: %v", i, err)
+		}
+		got, ok := m.(*image_ext.MultiBand)
+		if !ok {
+			t.Fatalf("%d: bad image type: %T", i, m)
+		}
+		if len(got.Model.Band) != v.Channels {
+			t.Fatalf("%d: bad channels; got %d, want %d", i, len(got.Model.Band), v.Channels)
+		}
+		for k := 0; k < v.Channels; k++ {
+			if x := got.Value(6, 3, k); x != float64(k*10+1) {
+				t.Fatalf("%d: band %d, want %v, got %v", i, k, k*10+1, x)
+			}
+		}
+	}
+}
+
 func TestEncodeAndDecode_YCbCr2Gray(t *testing.T) {
 	yuv := tNewYCbCr(image.Rect(0, 0, 10, 10), image.YCbCrSubsampleRatio420)
 	tSetYCbCr(yuv, 6, 3, color.Gray{0xAB})
@@ -17,8 +17,8 @@ import (
 )
 
 type Decoder struct {
-	Channels int          // 1/3/4
-	DataType reflect.Kind // Uint8/Uint16/Float32
+	Channels int          // 1/3/4, or any for MultiBand
+	DataType reflect.Kind // Uint8/Uint16/Int16/Int32/Float32/Float64
 	Width    int          // need for Decode
 	Height   int          // need for Decode
 }
@@ -57,6 +57,33 @@ func (p *Decoder) Decode(data []byte, buf image_ext.ImageBuffer) (m draw.Image,
 		return p.decodeRGBA128f(data, buf)
 	}
 
+	// Gray16s/Gray32i/Gray64f
+	if p.Channels == 1 && p.DataType == reflect.Int16 {
+		return p.decodeGray16s(data, buf)
+	}
+	if p.Channels == 1 && p.DataType == reflect.Int32 {
+		return p.decodeGray32i(data, buf)
+	}
+	if p.Channels == 1 && p.DataType == reflect.Float64 {
+		return p.decodeGray64f(data, buf)
+	}
+
+	// RGB48s/RGB96i/RGB192f
+	if p.Channels == 3 && p.DataType == reflect.Int16 {
+		return p.decodeRGB48s(data, buf)
+	}
+	if p.Channels == 3 && p.DataType == reflect.Int32 {
+		return p.decodeRGB96i(data, buf)
+	}
+	if p.Channels == 3 && p.DataType == reflect.Float64 {
+		return p.decodeRGB192f(data, buf)
+	}
+
+	// MultiBand
+	if p.Channels > 0 && isMultiBandDataType(p.DataType) {
+		return p.decodeMultiBand(data, buf)
+	}
+
 	// Unknown
 	err = fmt.Errorf(
 		"image/raw: Decode, unknown image format, channels = %v, dataType = %v",
@@ -73,6 +100,12 @@ func (p *Decoder) getPixelSize() int {
 		return p.Channels * 2
 	case reflect.Float32:
 		return p.Channels * 4
+	case reflect.Int16:
+		return p.Channels * 2
+	case reflect.Int32:
+		return p.Channels * 4
+	case reflect.Float64:
+		return p.Channels * 8
 	}
 	panic("image/raw: getPixelSize, unreachable")
 }
@@ -245,3 +278,110 @@ func (p *Decoder) decodeRGBA128f(data []byte, buf image_ext.ImageBuffer) (m draw
 	m = rgba128f
 	return
 }
+
+func (p *Decoder) decodeGray16s(data []byte, buf image_ext.ImageBuffer) (m draw.Image, err error) {
+	if size := p.getImageDataSize(); len(data) != size {
+		err = fmt.Errorf("image/raw: decodeGray16s, bad data size, expect = %d, got = %d", size, len(data))
+		return
+	}
+	gray16s := newGray16s(image.Rect(0, 0, p.Width, p.Height), buf)
+	var off = 0
+	for y := 0; y < p.Height; y++ {
+		copy(gray16s.Pix[y*gray16s.Stride:][:p.Width*2], data[off:])
+		off += p.Width * 2
+	}
+	m = gray16s
+	return
+}
+
+func (p *Decoder) decodeGray32i(data []byte, buf image_ext.ImageBuffer) (m draw.Image, err error) {
+	if size := p.getImageDataSize(); len(data) != size {
+		err = fmt.Errorf("image/raw: decodeGray32i, bad data size, expect = %d, got = %d", size, len(data))
+		return
+	}
+	gray32i := newGray32i(image.Rect(0, 0, p.Width, p.Height), buf)
+	var off = 0
+	for y := 0; y < p.Height; y++ {
+		copy(gray32i.Pix[y*gray32i.Stride:][:p.Width*4], data[off:])
+		off += p.Width * 4
+	}
+	m = gray32i
+	return
+}
+
+func (p *Decoder) decodeGray64f(data []byte, buf image_ext.ImageBuffer) (m draw.Image, err error) {
+	if size := p.getImageDataSize(); len(data) != size {
+		err = fmt.Errorf("image/raw: decodeGray64f, bad data size, expect = %d, got = %d", size, len(data))
+		return
+	}
+	gray64f := newGray64f(image.Rect(0, 0, p.Width, p.Height), buf)
+	var off = 0
+	for y := 0; y < p.Height; y++ {
+		copy(gray64f.Pix[y*gray64f.Stride:][:p.Width*8], data[off:])
+		off += p.Width * 8
+	}
+	m = gray64f
+	return
+}
+
+func (p *Decoder) decodeRGB48s(data []byte, buf image_ext.ImageBuffer) (m draw.Image, err error) {
+	if size := p.getImageDataSize(); len(data) != size {
+		err = fmt.Errorf("image/raw: decodeRGB48s, bad data size, expect = %d, got = %d", size, len(data))
+		return
+	}
+	rGB48s := newRGB48s(image.Rect(0, 0, p.Width, p.Height), buf)
+	var off = 0
+	for y := 0; y < p.Height; y++ {
+		copy(rGB48s.Pix[y*rGB48s.Stride:][:p.Width*6], data[off:])
+		off += p.Width * 6
+	}
+	m = rGB48s
+	return
+}
+
+func (p *Decoder) decodeRGB96i(data []byte, buf image_ext.ImageBuffer) (m draw.Image, err error) {
+	if size := p.getImageDataSize(); len(data) != size {
+		err = fmt.Errorf("image/raw: decodeRGB96i, bad data size, expect = %d, got = %d", size, len(data))
+		return
+	}
+	rGB96i := newRGB96i(image.Rect(0, 0, p.Width, p.Height), buf)
+	var off = 0
+	for y := 0; y < p.Height; y++ {
+		copy(rGB96i.Pix[y*rGB96i.Stride:][:p.Width*12], data[off:])
+		off += p.Width * 12
+	}
+	m = rGB96i
+	return
+}
+
+func (p *Decoder) decodeRGB192f(data []byte, buf image_ext.ImageBuffer) (m draw.Image, err error) {
+	if size := p.getImageDataSize(); len(data) != size {
+		err = fmt.Errorf("image/raw: decodeRGB192f, bad data size, expect = %d, got = %d", size, len(data))
+		return
+	}
+	rGB192f := newRGB192f(image.Rect(0, 0, p.Width, p.Height), buf)
+	var off = 0
+	for y := 0; y < p.Height; y++ {
+		copy(rGB192f.Pix[y*rGB192f.Stride:][:p.Width*24], data[off:])
+		off += p.Width * 24
+	}
+	m = rGB192f
+	return
+}
+
+func (p *Decoder) decodeMultiBand(data []byte, buf image_ext.ImageBuffer) (m draw.Image, err error) {
+	if size := p.getImageDataSize(); len(data) != size {
+		err = fmt.Errorf("image/raw: decodeMultiBand, bad data size, expect = %d, got = %d", size, len(data))
+		return
+	}
+	model := color_ext.NewUniformMultiBandModel(p.Channels, p.DataType)
+	multiBand := newMultiBand(image.Rect(0, 0, p.Width, p.Height), model, buf)
+	var off = 0
+	var n = p.getPixelSize() * p.Width
+	for y := 0; y < p.Height; y++ {
+		copy(multiBand.Pix[y*multiBand.Stride:][:n], data[off:])
+		off += n
+	}
+	m = multiBand
+	return
+}
@@ -49,6 +49,33 @@ func (p *Decoder) DecodeImage(data image.Image, buf image_ext.ImageBuffer) (m dr
 		return p.decodeImageRGBA128f(data, buf)
 	}
 
+	// Gray16s/Gray32i/Gray64f
+	if p.Channels == 1 && p.DataType == reflect.Int16 {
+		return p.decodeImageGray16s(data, buf)
+	}
+	if p.Channels == 1 && p.DataType == reflect.Int32 {
+		return p.decodeImageGray32i(data, buf)
+	}
+	if p.Channels == 1 && p.DataType == reflect.Float64 {
+		return p.decodeImageGray64f(data, buf)
+	}
+
+	// RGB48s/RGB96i/RGB192f
+	if p.Channels == 3 && p.DataType == reflect.Int16 {
+		return p.decodeImageRGB48s(data, buf)
+	}
+	if p.Channels == 3 && p.DataType == reflect.Int32 {
+		return p.decodeImageRGB96i(data, buf)
+	}
+	if p.Channels == 3 && p.DataType == reflect.Float64 {
+		return p.decodeImageRGB192f(data, buf)
+	}
+
+	// MultiBand
+	if p.Channels > 0 && isMultiBandDataType(p.DataType) {
+		return p.decodeImageMultiBand(data, buf)
+	}
+
 	// Unknown
 	err = fmt.Errorf(
 		"image/raw: DecodeImage, unknown image format, channels = %v, dataType = %v",
@@ -460,3 +487,142 @@ func (p *Decoder) decodeImageRGBA128f(data image.Image, buf image_ext.ImageBuffe
 	m = rgba128f
 	return
 }
+
+func (p *Decoder) decodeImageGray16s(data image.Image, buf image_ext.ImageBuffer) (m draw.Image, err error) {
+	if b := data.Bounds(); b.Dx() != p.Width || b.Dy() != p.Height {
+		err = fmt.Errorf("image/raw: bad bounds: %v", data.Bounds())
+		return
+	}
+	if m, ok := data.(*image_ext.Gray16s); ok {
+		return m, nil
+	}
+	gray16s := newGray16s(image.Rect(0, 0, p.Width, p.Height), buf)
+	for y := 0; y < p.Height; y++ {
+		for x := 0; x < p.Width; x++ {
+			gray16s.Set(x, y, data.At(x, y))
+		}
+	}
+	m = gray16s
+	return
+}
+
+func (p *Decoder) decodeImageGray32i(data image.Image, buf image_ext.ImageBuffer) (m draw.Image, err error) {
+	if b := data.Bounds(); b.Dx() != p.Width || b.Dy() != p.Height {
+		err = fmt.Errorf("image/raw: bad bounds: %v", data.Bounds())
+		return
+	}
+	if m, ok := data.(*image_ext.Gray32i); ok {
+		return m, nil
+	}
+	gray32i := newGray32i(image.Rect(0, 0, p.Width, p.Height), buf)
+	for y := 0; y < p.Height; y++ {
+		for x := 0; x < p.Width; x++ {
+			gray32i.Set(x, y, data.At(x, y))
+		}
+	}
+	m = gray32i
+	return
+}
+
+func (p *Decoder) decodeImageGray64f(data image.Image, buf image_ext.ImageBuffer) (m draw.Image, err error) {
+	if b := data.Bounds(); b.Dx() != p.Width || b.Dy() != p.Height {
+		err = fmt.Errorf("image/raw: bad bounds: %v", data.Bounds())
+		return
+	}
+	if m, ok := data.(*image_ext.Gray64f); ok {
+		return m, nil
+	}
+	gray64f := newGray64f(image.Rect(0, 0, p.Width, p.Height), buf)
+	for y := 0; y < p.Height; y++ {
+		for x := 0; x < p.Width; x++ {
+			gray64f.Set(x, y, data.At(x, y))
+		}
+	}
+	m = gray64f
+	return
+}
+
+func (p *Decoder) decodeImageRGB48s(data image.Image, buf image_ext.ImageBuffer) (m draw.Image, err error) {
+	if b := data.Bounds(); b.Dx() != p.Width || b.Dy() != p.Height {
+		err = fmt.Errorf("image/raw: bad bounds: %v", data.Bounds())
+		return
+	}
+	if m, ok := data.(*image_ext.RGB48s); ok {
+		return m, nil
+	}
+	rGB48s := newRGB48s(image.Rect(0, 0, p.Width, p.Height), buf)
+	for y := 0; y < p.Height; y++ {
+		for x := 0; x < p.Width; x++ {
+			rGB48s.Set(x, y, data.At(x, y))
+		}
+	}
+	m = rGB48s
+	return
+}
+
+func (p *Decoder) decodeImageRGB96i(data image.Image, buf image_ext.ImageBuffer) (m draw.Image, err error) {
+	if b := data.Bounds(); b.Dx() != p.Width || b.Dy() != p.Height {
+		err = fmt.Errorf("image/raw: bad bounds: %v", data.Bounds())
+		return
+	}
+	if m, ok := data.(*image_ext.RGB96i); ok {
+		return m, nil
+	}
+	rGB96i := newRGB96i(image.Rect(0, 0, p.Width, p.Height), buf)
+	for y := 0; y < p.Height; y++ {
+		for x := 0; x < p.Width; x++ {
+			rGB96i.Set(x, y, data.At(x, y))
+		}
+	}
+	m = rGB96i
+	return
+}
+
+func (p *Decoder) decodeImageRGB192f(data image.Image, buf image_ext.ImageBuffer) (m draw.Image, err error) {
+	if b := data.Bounds(); b.Dx() != p.Width || b.Dy() != p.Height {
+		err = fmt.Errorf("image/raw: bad bounds: %v", data.Bounds())
+		return
+	}
+	if m, ok := data.(*image_ext.RGB192f); ok {
+		return m, nil
+	}
+	rGB192f := newRGB192f(image.Rect(0, 0, p.Width, p.Height), buf)
+	for y := 0; y < p.Height; y++ {
+		for x := 0; x < p.Width; x++ {
+			rGB192f.Set(x, y, data.At(x, y))
+		}
+	}
+	m = rGB192f
+	return
+}
+
+func (p *Decoder) decodeImageMultiBand(data image.Image, buf image_ext.ImageBuffer) (m draw.Image, err error) {
+	if b := data.Bounds(); b.Dx() != p.Width || b.Dy() != p.Height {
+		err = fmt.Errorf("image/raw: bad bounds: %v", data.Bounds())
+		return
+	}
+	model := color_ext.NewUniformMultiBandModel(p.Channels, p.DataType)
+	if m, ok := data.(*image_ext.MultiBand); ok && m.Model.SameLayout(model) {
+		return m, nil
+	}
+	b := data.Bounds()
+	multiBand := newMultiBand(image.Rect(0, 0, p.Width, p.Height), model, buf)
+	switch data := data.(type) {
+	case *image_ext.MultiBand:
+		for y := 0; y < p.Height; y++ {
+			for x := 0; x < p.Width; x++ {
+				for k := 0; k < p.Channels && k < len(data.Model.Band); k++ {
+					multiBand.SetValue(x, y, k, data.Value(b.Min.X+x, b.Min.Y+y, k))
+				}
+			}
+		}
+	default:
+		for y := 0; y < p.Height; y++ {
+			for x := 0; x < p.Width; x++ {
+				multiBand.Set(x, y, data.At(b.Min.X+x, b.Min.Y+y))
+			}
+		}
+	}
+	m = multiBand
+	return
+}
@@ -0,0 +1,72 @@
+// Copyright 2014 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package raw
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+
+	image_ext "github.com/chai2010/gopkg/image"
+	color_ext "github.com/chai2010/gopkg/image/color"
+)
+
+// DecodeNoCopy returns an image whose Pix is data, the pixels are not
+// copied, which is used for the memory-mapped files.
+//
+// The Gray16, RGB48 and RGBA64 images store the big endian samples in Pix,
+// and the RGB96f image pads the pixels to 16 bytes, they can't share the
+// raw pixels, use Decode instead.
+func (p *Decoder) DecodeNoCopy(data []byte) (m draw.Image, err error) {
+	size := p.getImageDataSize()
+	if len(data) != size {
+		err = fmt.Errorf("image/raw: DecodeNoCopy, bad data size, expect = %d, got = %d", size, len(data))
+		return
+	}
+	pix := data[:size:size] // appending to Pix must not write to the data after it
+	stride := p.getPixelSize() * p.Width
+	r := image.Rect(0, 0, p.Width, p.Height)
+
+	model, err := colorModel(p.Channels, p.DataType)
+	if err != nil {
+		return
+	}
+	switch model {
+	case color.GrayModel:
+		return &image.Gray{Pix: pix, Stride: stride, Rect: r}, nil
+	case color_ext.Gray32fModel:
+		return &image_ext.Gray32f{Pix: pix, Stride: stride, Rect: r}, nil
+	case color_ext.RGBModel:
+		return &image_ext.RGB{Pix: pix, Stride: stride, Rect: r}, nil
+	case color.RGBAModel:
+		return &image.RGBA{Pix: pix, Stride: stride, Rect: r}, nil
+	case color_ext.RGBA128fModel:
+		return &image_ext.RGBA128f{Pix: pix, Stride: stride, Rect: r}, nil
+	case color_ext.Gray16sModel:
+		return &image_ext.Gray16s{Pix: pix, Stride: stride, Rect: r}, nil
+	case color_ext.Gray32iModel:
+		return &image_ext.Gray32i{Pix: pix, Stride: stride, Rect: r}, nil
+	case color_ext.Gray64fModel:
+		return &image_ext.Gray64f{Pix: pix, Stride: stride, Rect: r}, nil
+	case color_ext.RGB48sModel:
+		return &image_ext.RGB48s{Pix: pix, Stride: stride, Rect: r}, nil
+	case color_ext.RGB96iModel:
+		return &image_ext.RGB96i{Pix: pix, Stride: stride, Rect: r}, nil
+	case color_ext.RGB192fModel:
+		return &image_ext.RGB192f{Pix: pix, Stride: stride, Rect: r}, nil
+	case color.Gray16Model, color_ext.RGB48Model, color.RGBA64Model:
+		err = fmt.Errorf("image/raw: DecodeNoCopy, the Uint16 pixels must be copied")
+		return
+	case color_ext.RGB96fModel:
+		err = fmt.Errorf("image/raw: DecodeNoCopy, the RGB96f pixels must be copied")
+		return
+	}
+	if model, ok := model.(*color_ext.MultiBandModel); ok {
+		return &image_ext.MultiBand{Pix: pix, Stride: stride, Rect: r, Model: model}, nil
+	}
+	err = fmt.Errorf("image/raw: DecodeNoCopy, unsupported color model, %T", model)
+	return
+}
@@ -12,11 +12,12 @@ import (
 
 	"github.com/chai2010/gopkg/builtin"
 	image_ext "github.com/chai2010/gopkg/image"
+	color_ext "github.com/chai2010/gopkg/image/color"
 )
 
 type Encoder struct {
-	Channels int          // 1/3/4
-	DataType reflect.Kind // Uint8/Uint16/Float32
+	Channels int          // 1/3/4, or any for MultiBand
+	DataType reflect.Kind // Uint8/Uint16/Int16/Int32/Float32/Float64
 }
 
 func (p *Encoder) Encode(m image.Image, buf []byte) (data []byte, err error) {
@@ -53,6 +54,33 @@ func (p *Encoder) Encode(m image.Image, buf []byte) (data []byte, err error) {
 		return p.encodeRGBA128f(m, buf)
 	}
 
+	// Gray16s/Gray32i/Gray64f
+	if p.Channels == 1 && p.DataType == reflect.Int16 {
+		return p.encodeGray16s(m, buf)
+	}
+	if p.Channels == 1 && p.DataType == reflect.Int32 {
+		return p.encodeGray32i(m, buf)
+	}
+	if p.Channels == 1 && p.DataType == reflect.Float64 {
+		return p.encodeGray64f(m, buf)
+	}
+
+	// RGB48s/RGB96i/RGB192f
+	if p.Channels == 3 && p.DataType == reflect.Int16 {
+		return p.encodeRGB48s(m, buf)
+	}
+	if p.Channels == 3 && p.DataType == reflect.Int32 {
+		return p.encodeRGB96i(m, buf)
+	}
+	if p.Channels == 3 && p.DataType == reflect.Float64 {
+		return p.encodeRGB192f(m, buf)
+	}
+
+	// MultiBand
+	if p.Channels > 0 && isMultiBandDataType(p.DataType) {
+		return p.encodeMultiBand(m, buf)
+	}
+
 	// Unknown
 	err = fmt.Errorf("image/raw: Encode, unknown image format, channels = %v, dataType = %v", p.Channels, p.DataType)
 	return
@@ -846,3 +874,196 @@ func (p *Encoder) encodeRGBA128f(m image.Image, buf []byte) (data []byte, err er
 	data = d
 	return
 }
+
+func (p *Encoder) encodeGray16s(m image.Image, buf []byte) (data []byte, err error) {
+	b := m.Bounds()
+	d := newBytes(b.Dx()*b.Dy()*2, buf)
+	switch m := m.(type) {
+	case *image_ext.Gray16s:
+		var off = 0
+		for y := b.Min.Y; y < b.Max.Y; y++ {
+			copy(d[off:][:b.Dx()*2], m.Pix[m.PixOffset(b.Min.X, y):])
+			off += b.Dx() * 2
+		}
+	default:
+		var off = 0
+		for y := b.Min.Y; y < b.Max.Y; y++ {
+			for x := b.Min.X; x < b.Max.X; x++ {
+				v := color_ext.Gray16sModel.Convert(m.At(x, y)).(color_ext.Gray16s)
+				builtin.PutUint16(d[off:], uint16(v.Y))
+				off += 2
+			}
+		}
+	}
+	data = d
+	return
+}
+
+func (p *Encoder) encodeGray32i(m image.Image, buf []byte) (data []byte, err error) {
+	b := m.Bounds()
+	d := newBytes(b.Dx()*b.Dy()*4, buf)
+	switch m := m.(type) {
+	case *image_ext.Gray32i:
+		var off = 0
+		for y := b.Min.Y; y < b.Max.Y; y++ {
+			copy(d[off:][:b.Dx()*4], m.Pix[m.PixOffset(b.Min.X, y):])
+			off += b.Dx() * 4
+		}
+	default:
+		var off = 0
+		for y := b.Min.Y; y < b.Max.Y; y++ {
+			for x := b.Min.X; x < b.Max.X; x++ {
+				v := color_ext.Gray32iModel.Convert(m.At(x, y)).(color_ext.Gray32i)
+				builtin.PutUint32(d[off:], uint32(v.Y))
+				off += 4
+			}
+		}
+	}
+	data = d
+	return
+}
+
+func (p *Encoder) encodeGray64f(m image.Image, buf []byte) (data []byte, err error) {
+	b := m.Bounds()
+	d := newBytes(b.Dx()*b.Dy()*8, buf)
+	switch m := m.(type) {
+	case *image_ext.Gray64f:
+		var off = 0
+		for y := b.Min.Y; y < b.Max.Y; y++ {
+			copy(d[off:][:b.Dx()*8], m.Pix[m.PixOffset(b.Min.X, y):])
+			off += b.Dx() * 8
+		}
+	default:
+		var off = 0
+		for y := b.Min.Y; y < b.Max.Y; y++ {
+			for x := b.Min.X; x < b.Max.X; x++ {
+				v := color_ext.Gray64fModel.Convert(m.At(x, y)).(color_ext.Gray64f)
+				builtin.PutFloat64(d[off:], v.Y)
+				off += 8
+			}
+		}
+	}
+	data = d
+	return
+}
+
+func (p *Encoder) encodeRGB48s(m image.Image, buf []byte) (data []byte, err error) {
+	b := m.Bounds()
+	d := newBytes(b.Dx()*b.Dy()*6, buf)
+	switch m := m.(type) {
+	case *image_ext.RGB48s:
+		var off = 0
+		for y := b.Min.Y; y < b.Max.Y; y++ {
+			copy(d[off:][:b.Dx()*6], m.Pix[m.PixOffset(b.Min.X, y):])
+			off += b.Dx() * 6
+		}
+	default:
+		var off = 0
+		for y := b.Min.Y; y < b.Max.Y; y++ {
+			for x := b.Min.X; x < b.Max.X; x++ {
+				v := color_ext.RGB48sModel.Convert(m.At(x, y)).(color_ext.RGB48s)
+				builtin.PutUint16(d[off+0:], uint16(v.R))
+				builtin.PutUint16(d[off+2:], uint16(v.G))
+				builtin.PutUint16(d[off+4:], uint16(v.B))
+				off += 6
+			}
+		}
+	}
+	data = d
+	return
+}
+
+func (p *Encoder) encodeRGB96i(m image.Image, buf []byte) (data []byte, err error) {
+	b := m.Bounds()
+	d := newBytes(b.Dx()*b.Dy()*12, buf)
+	switch m := m.(type) {
+	case *image_ext.RGB96i:
+		var off = 0
+		for y := b.Min.Y; y < b.Max.Y; y++ {
+			copy(d[off:][:b.Dx()*12], m.Pix[m.PixOffset(b.Min.X, y):])
+			off += b.Dx() * 12
+		}
+	default:
+		var off = 0
+		for y := b.Min.Y; y < b.Max.Y; y++ {
+			for x := b.Min.X; x < b.Max.X; x++ {
+				v := color_ext.RGB96iModel.Convert(m.At(x, y)).(color_ext.RGB96i)
+				builtin.PutUint32(d[off+0:], uint32(v.R))
+				builtin.PutUint32(d[off+4:], uint32(v.G))
+				builtin.PutUint32(d[off+8:], uint32(v.B))
+				off += 12
+			}
+		}
+	}
+	data = d
+	return
+}
+
+func (p *Encoder) encodeRGB192f(m image.Image, buf []byte) (data []byte, err error) {
+	b := m.Bounds()
+	d := newBytes(b.Dx()*b.Dy()*24, buf)
+	switch m := m.(type) {
+	case *image_ext.RGB192f:
+		var off = 0
+		for y := b.Min.Y; y < b.Max.Y; y++ {
+			copy(d[off:][:b.Dx()*24], m.Pix[m.PixOffset(b.Min.X, y):])
+			off += b.Dx() * 24
+		}
+	default:
+		var off = 0
+		for y := b.Min.Y; y < b.Max.Y; y++ {
+			for x := b.Min.X; x < b.Max.X; x++ {
+				v := color_ext.RGB192fModel.Convert(m.At(x, y)).(color_ext.RGB192f)
+				builtin.PutFloat64(d[off+0:], v.R)
+				builtin.PutFloat64(d[off+8:], v.G)
+				builtin.PutFloat64(d[off+16:], v.B)
+				off += 24
+			}
+		}
+	}
+	data = d
+	return
+}
+
+func (p *Encoder) encodeMultiBand(m image.Image, buf []byte) (data []byte, err error) {
+	b := m.Bounds()
+	model := color_ext.NewUniformMultiBandModel(p.Channels, p.DataType)
+	size := model.PixelSize()
+	d := newBytes(b.Dx()*b.Dy()*size, buf)
+	if m, ok := m.(*image_ext.MultiBand); ok && m.Model.SameLayout(model) {
+		var off = 0
+		for y := b.Min.Y; y < b.Max.Y; y++ {
+			copy(d[off:][:b.Dx()*size], m.Pix[m.PixOffset(b.Min.X, y, 0):])
+			off += b.Dx() * size
+		}
+		data = d
+		return
+	}
+	multiBand := &image_ext.MultiBand{
+		Pix:    d,
+		Stride: b.Dx() * size,
+		Rect:   b,
+		Model:  model,
+	}
+	for i := range d {
+		d[i] = 0
+	}
+	switch m := m.(type) {
+	case *image_ext.MultiBand:
+		for y := b.Min.Y; y < b.Max.Y; y++ {
+			for x := b.Min.X; x < b.Max.X; x++ {
+				for k := 0; k < p.Channels && k < len(m.Model.Band); k++ {
+					multiBand.SetValue(x, y, k, m.Value(x, y, k))
+				}
+			}
+		}
+	default:
+		for y := b.Min.Y; y < b.Max.Y; y++ {
+			for x := b.Min.X; x < b.Max.X; x++ {
+				multiBand.Set(x, y, m.At(x, y))
+			}
+		}
+	}
+	data = d
+	return
+}
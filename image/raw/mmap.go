@@ -0,0 +1,89 @@
+// Copyright 2014 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package raw
+
+import (
+	"fmt"
+	"image/draw"
+)
+
+// MapMode is the access mode of the memory-mapped files.
+type MapMode int
+
+const (
+	// MapReadOnly maps the file read only, the pages are shared with the
+	// file. Writing to the pixels of the image crashes the program.
+	MapReadOnly MapMode = iota
+
+	// MapCopyOnWrite maps the file private and writable, the modified
+	// pages are copied and the file is never changed.
+	MapCopyOnWrite
+)
+
+func (m MapMode) String() string {
+	switch m {
+	case MapReadOnly:
+		return "ReadOnly"
+	case MapCopyOnWrite:
+		return "CopyOnWrite"
+	}
+	return fmt.Sprintf("MapMode(%d)", int(m))
+}
+
+// MappedFile is a memory-mapped file.
+//
+// The images returned by OpenMapped share the memory of Data, they must not
+// be used after Close.
+type MappedFile struct {
+	Data []byte
+	Mode MapMode
+}
+
+// OpenMappedFile maps the whole file into memory.
+func OpenMappedFile(filename string, mode MapMode) (f *MappedFile, err error) {
+	if mode != MapReadOnly && mode != MapCopyOnWrite {
+		err = fmt.Errorf("image/raw: OpenMappedFile, bad mode, %v", mode)
+		return
+	}
+	data, err := mmapFile(filename, mode)
+	if err != nil {
+		return
+	}
+	f = &MappedFile{Data: data, Mode: mode}
+	return
+}
+
+// Close unmaps the file.
+func (f *MappedFile) Close() error {
+	if f.Data == nil {
+		return nil
+	}
+	data := f.Data
+	f.Data = nil
+	return munmapFile(data)
+}
+
+// OpenMapped maps the file and returns an image whose Pix points into the
+// mapped memory, the raw pixels begin at offset off of the file. Only the
+// pixels which Pix can store as is are supported, see DecodeNoCopy.
+//
+// The file stays mapped until f is closed.
+func OpenMapped(filename string, off int64, decoder *Decoder, mode MapMode) (m draw.Image, f *MappedFile, err error) {
+	if f, err = OpenMappedFile(filename, mode); err != nil {
+		return
+	}
+	size := int64(decoder.getImageDataSize())
+	if off < 0 || off+size > int64(len(f.Data)) {
+		f.Close()
+		return nil, nil, fmt.Errorf("image/raw: OpenMapped, bad offset, off = %d, size = %d, file size = %d",
+			off, size, len(f.Data),
+		)
+	}
+	if m, err = decoder.DecodeNoCopy(f.Data[off : off+size]); err != nil {
+		f.Close()
+		return nil, nil, err
+	}
+	return
+}
@@ -0,0 +1,43 @@
+// Copyright 2014 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package raw
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+)
+
+func mmapFile(filename string, mode MapMode) (data []byte, err error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+
+	fi, err := f.Stat()
+	if err != nil {
+		return
+	}
+	size := fi.Size()
+	if size <= 0 || int64(int(size)) != size {
+		err = fmt.Errorf("image/raw: mmap, bad file size, %d", size)
+		return
+	}
+
+	prot, flags := syscall.PROT_READ, syscall.MAP_SHARED
+	if mode == MapCopyOnWrite {
+		prot, flags = syscall.PROT_READ|syscall.PROT_WRITE, syscall.MAP_PRIVATE
+	}
+	if data, err = syscall.Mmap(int(f.Fd()), 0, int(size), prot, flags); err != nil {
+		err = fmt.Errorf("image/raw: mmap, %v", err)
+		return
+	}
+	return
+}
+
+func munmapFile(data []byte) error {
+	return syscall.Munmap(data)
+}
@@ -0,0 +1,124 @@
+// Copyright 2014 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package raw
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	color_ext "github.com/chai2010/gopkg/image/color"
+)
+
+func TestOpenMapped(t *testing.T) {
+	dir, err := ioutil.TempDir("", "image-raw-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for i, v := range tTesterList {
+		encoder := Encoder{v.Channels, v.DataType}
+		decoder := Decoder{v.Channels, v.DataType, v.Image.Bounds().Dx(), v.Image.Bounds().Dy()}
+
+		data, err := encoder.Encode(v.Image, nil)
+		if err != nil {
+			t.Fatalf("%d: %v", i, err)
+		}
+		golden, err := decoder.Decode(data, nil)
+		if err != nil {
+			t.Fatalf("%d: %v", i, err)
+		}
+
+		// put some bytes before the pixels
+		filename := filepath.Join(dir, "a.raw")
+		data = append([]byte("header"), data...)
+		if err = ioutil.WriteFile(filename, data, 0666); err != nil {
+			t.Fatalf("%d: %v", i, err)
+		}
+
+		m, f, err := OpenMapped(filename, int64(len("header")), &decoder, MapReadOnly)
+		if v.DataType == reflect.Uint16 || v.Model == color_ext.RGB96fModel {
+			if err == nil {
+				f.Close()
+				t.Fatalf("%d: expect error", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%d: %v", i, err)
+		}
+		if model := m.ColorModel(); model != golden.ColorModel() {
+			t.Fatalf("%d: bad model, expect = %v, got = %v", i, golden.ColorModel(), model)
+		}
+		tDiffImage(t, i, golden, m)
+		if err = f.Close(); err != nil {
+			t.Fatalf("%d: %v", i, err)
+		}
+	}
+}
+
+func TestOpenMapped_copyOnWrite(t *testing.T) {
+	dir, err := ioutil.TempDir("", "image-raw-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	gray := image.NewGray(image.Rect(0, 0, 10, 10))
+	gray.SetGray(3, 4, color.Gray{0x80})
+	filename := filepath.Join(dir, "a.raw")
+	if err = ioutil.WriteFile(filename, gray.Pix, 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	decoder := Decoder{1, reflect.Uint8, 10, 10}
+	m, f, err := OpenMapped(filename, 0, &decoder, MapCopyOnWrite)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c := m.At(3, 4); c != (color.Gray{0x80}) {
+		t.Fatalf("bad pixel, got = %v", c)
+	}
+	m.Set(3, 4, color.Gray{0xFF})
+	if c := m.At(3, 4); c != (color.Gray{0xFF}) {
+		t.Fatalf("bad pixel, got = %v", c)
+	}
+	if err = f.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, gray.Pix) {
+		t.Fatalf("the file is modified")
+	}
+
+	// the pixels are out of the file
+	if _, _, err = OpenMapped(filename, 1, &decoder, MapReadOnly); err == nil {
+		t.Fatalf("expect error")
+	}
+}
+
+func tDiffImage(t *testing.T, i int, m0, m1 image.Image) {
+	b := m0.Bounds()
+	if m1.Bounds() != b {
+		t.Fatalf("%d: bad bounds, expect = %v, got = %v", i, b, m1.Bounds())
+	}
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			if c0, c1 := m0.At(x, y), m1.At(x, y); c0 != c1 {
+				t.Fatalf("%d: pixel(%d, %d), expect = %v, got = %v", i, x, y, c0, c1)
+			}
+		}
+	}
+}
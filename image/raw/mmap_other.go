@@ -0,0 +1,22 @@
+// Copyright 2014 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build !linux
+// +build !linux
+
+package raw
+
+import (
+	"fmt"
+	"runtime"
+)
+
+func mmapFile(filename string, mode MapMode) (data []byte, err error) {
+	err = fmt.Errorf("image/raw: mmap is not supported on %s", runtime.GOOS)
+	return
+}
+
+func munmapFile(data []byte) error {
+	return nil
+}
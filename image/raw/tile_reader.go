@@ -0,0 +1,173 @@
+// Copyright 2014 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package raw
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"io"
+	"reflect"
+
+	image_ext "github.com/chai2010/gopkg/image"
+	color_ext "github.com/chai2010/gopkg/image/color"
+)
+
+// TileReader reads rectangles of raw pixels stored in an io.ReaderAt,
+// only the rows and columns covered by the rectangle are read.
+type TileReader struct {
+	r       io.ReaderAt
+	off     int64
+	decoder Decoder
+}
+
+// NewTileReader returns a TileReader for the raw pixels which begin at
+// offset off of r. The decoder gives the layout and size of the pixels.
+func NewTileReader(r io.ReaderAt, off int64, decoder *Decoder) (p *TileReader, err error) {
+	if decoder.Width <= 0 || decoder.Height <= 0 {
+		err = fmt.Errorf("image/raw: NewTileReader, bad size, width = %v, height = %v",
+			decoder.Width, decoder.Height,
+		)
+		return
+	}
+	if _, err = colorModel(decoder.Channels, decoder.DataType); err != nil {
+		return
+	}
+	p = &TileReader{
+		r:       r,
+		off:     off,
+		decoder: *decoder,
+	}
+	return
+}
+
+// Config returns the color model and dimensions of the image.
+func (p *TileReader) Config() image.Config {
+	model, _ := colorModel(p.decoder.Channels, p.decoder.DataType)
+	return image.Config{
+		ColorModel: model,
+		Width:      p.decoder.Width,
+		Height:     p.decoder.Height,
+	}
+}
+
+// ReadRect decodes the pixels inside r. If buf covers r and has the same
+// color model, the pixels are stored in buf.
+func (p *TileReader) ReadRect(r image.Rectangle, buf image_ext.ImageBuffer) (m image.Image, err error) {
+	r = r.Intersect(image.Rect(0, 0, p.decoder.Width, p.decoder.Height))
+	if r.Empty() {
+		err = fmt.Errorf("image/raw: TileReader.ReadRect, empty rect: %v", r)
+		return
+	}
+
+	pixSize := p.decoder.getPixelSize()
+	rowSize := r.Dx() * pixSize
+	data := make([]byte, rowSize*r.Dy())
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		off := p.off + int64(y*p.decoder.Width+r.Min.X)*int64(pixSize)
+		if _, err = p.r.ReadAt(data[(y-r.Min.Y)*rowSize:][:rowSize], off); err != nil {
+			return
+		}
+	}
+
+	decoder := p.decoder
+	decoder.Width, decoder.Height = r.Dx(), r.Dy()
+	tile, err := decoder.Decode(data, nil)
+	if err != nil {
+		return
+	}
+	m = setImageRect(tile, r)
+	if buf != nil && r.In(buf.Bounds()) && buf.ColorModel() == m.ColorModel() {
+		draw.Draw(buf, r, m, r.Min, draw.Src)
+		m = buf.SubImage(r)
+	}
+	return
+}
+
+// Close does nothing, the io.ReaderAt is owned by the caller.
+func (p *TileReader) Close() error {
+	return nil
+}
+
+func colorModel(channels int, dataType reflect.Kind) (color.Model, error) {
+	switch {
+	case channels == 1 && dataType == reflect.Uint8:
+		return color.GrayModel, nil
+	case channels == 1 && dataType == reflect.Uint16:
+		return color.Gray16Model, nil
+	case channels == 1 && dataType == reflect.Float32:
+		return color_ext.Gray32fModel, nil
+	case channels == 3 && dataType == reflect.Uint8:
+		return color_ext.RGBModel, nil
+	case channels == 3 && dataType == reflect.Uint16:
+		return color_ext.RGB48Model, nil
+	case channels == 3 && dataType == reflect.Float32:
+		return color_ext.RGB96fModel, nil
+	case channels == 4 && dataType == reflect.Uint8:
+		return color.RGBAModel, nil
+	case channels == 4 && dataType == reflect.Uint16:
+		return color.RGBA64Model, nil
+	case channels == 4 && dataType == reflect.Float32:
+		return color_ext.RGBA128fModel, nil
+	case channels == 1 && dataType == reflect.Int16:
+		return color_ext.Gray16sModel, nil
+	case channels == 1 && dataType == reflect.Int32:
+		return color_ext.Gray32iModel, nil
+	case channels == 1 && dataType == reflect.Float64:
+		return color_ext.Gray64fModel, nil
+	case channels == 3 && dataType == reflect.Int16:
+		return color_ext.RGB48sModel, nil
+	case channels == 3 && dataType == reflect.Int32:
+		return color_ext.RGB96iModel, nil
+	case channels == 3 && dataType == reflect.Float64:
+		return color_ext.RGB192fModel, nil
+	case channels > 0 && isMultiBandDataType(dataType):
+		return color_ext.NewUniformMultiBandModel(channels, dataType), nil
+	}
+	return nil, fmt.Errorf(
+		"image/raw: unknown image format, channels = %v, dataType = %v",
+		channels, dataType,
+	)
+}
+
+// setImageRect moves the bounds of m to r, the size must be same.
+func setImageRect(m image.Image, r image.Rectangle) image.Image {
+	switch m := m.(type) {
+	case *image.Gray:
+		m.Rect = r
+	case *image.Gray16:
+		m.Rect = r
+	case *image_ext.Gray32f:
+		m.Rect = r
+	case *image_ext.RGB:
+		m.Rect = r
+	case *image_ext.RGB48:
+		m.Rect = r
+	case *image_ext.RGB96f:
+		m.Rect = r
+	case *image.RGBA:
+		m.Rect = r
+	case *image.RGBA64:
+		m.Rect = r
+	case *image_ext.RGBA128f:
+		m.Rect = r
+	case *image_ext.Gray16s:
+		m.Rect = r
+	case *image_ext.Gray32i:
+		m.Rect = r
+	case *image_ext.Gray64f:
+		m.Rect = r
+	case *image_ext.RGB48s:
+		m.Rect = r
+	case *image_ext.RGB96i:
+		m.Rect = r
+	case *image_ext.RGB192f:
+		m.Rect = r
+	case *image_ext.MultiBand:
+		m.Rect = r
+	}
+	return m
+}
@@ -0,0 +1,64 @@
+// Copyright 2014 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package raw
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestTileReader(t *testing.T) {
+	for _, v := range tTesterList {
+		v.Image.Set(6, 3, color.RGBA{0xAA, 0xBB, 0xCC, 0xDD})
+		v.Image.Set(2, 8, color.RGBA{0x11, 0x22, 0x33, 0x44})
+	}
+	for i, v := range tTesterList {
+		encoder := Encoder{v.Channels, v.DataType}
+		decoder := Decoder{v.Channels, v.DataType, v.Image.Bounds().Dx(), v.Image.Bounds().Dy()}
+
+		data, err := encoder.Encode(v.Image, nil)
+		if err != nil {
+			t.Fatalf("%d: %v", i, err)
+		}
+		golden, err := decoder.Decode(data, nil)
+		if err != nil {
+			t.Fatalf("%d: %v", i, err)
+		}
+
+		// put some bytes before the pixels
+		data = append([]byte("header"), data...)
+		p, err := NewTileReader(bytes.NewReader(data), int64(len("header")), &decoder)
+		if err != nil {
+			t.Fatalf("%d: %v", i, err)
+		}
+		if model := p.Config().ColorModel; model != v.Model {
+			t.Fatalf("%d: bad model, expect = %v, got = %v", i, v.Model, model)
+		}
+
+		for _, r := range []image.Rectangle{
+			image.Rect(0, 0, 10, 10),
+			image.Rect(1, 2, 7, 9),
+			image.Rect(5, 5, 20, 20),
+		} {
+			m, err := p.ReadRect(r, nil)
+			if err != nil {
+				t.Fatalf("%d: %v", i, err)
+			}
+			if want := r.Intersect(golden.Bounds()); m.Bounds() != want {
+				t.Fatalf("%d: bad bounds, expect = %v, got = %v", i, want, m.Bounds())
+			}
+			b := m.Bounds()
+			for y := b.Min.Y; y < b.Max.Y; y++ {
+				for x := b.Min.X; x < b.Max.X; x++ {
+					if c0, c1 := golden.At(x, y), m.At(x, y); c0 != c1 {
+						t.Fatalf("%d: pixel(%d, %d), expect = %v, got = %v", i, x, y, c0, c1)
+					}
+				}
+			}
+		}
+	}
+}
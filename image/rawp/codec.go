@@ -0,0 +1,112 @@
+// Copyright 2014 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package rawp
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"io"
+
+	"code.google.com/p/snappy-go/snappy"
+)
+
+// Codec is the compression method of the tiles of RawP v2 images.
+type Codec byte
+
+const (
+	CodecNone   Codec = 0 // no compression
+	CodecSnappy Codec = 1 // snappy
+	CodecZlib   Codec = 2 // zlib/deflate
+	CodecLZ4    Codec = 3 // LZ4 block format
+	CodecLZH    Codec = 4 // zstd-like LZ77 with a large window and Huffman coding, not compatible with zstd
+)
+
+func (c Codec) String() string {
+	switch c {
+	case CodecNone:
+		return "None"
+	case CodecSnappy:
+		return "Snappy"
+	case CodecZlib:
+		return "Zlib"
+	case CodecLZ4:
+		return "LZ4"
+	case CodecLZH:
+		return "LZH"
+	}
+	return fmt.Sprintf("Codec(%d)", byte(c))
+}
+
+func rawpIsValidCodec(c Codec) bool {
+	return c <= CodecLZH
+}
+
+func rawpCompressTile(codec Codec, pix []byte) (data []byte, err error) {
+	switch codec {
+	case CodecNone:
+		return pix, nil
+	case CodecSnappy:
+		return snappy.Encode(nil, pix)
+	case CodecZlib:
+		var buf bytes.Buffer
+		w := zlib.NewWriter(&buf)
+		if _, err = w.Write(pix); err != nil {
+			return
+		}
+		if err = w.Close(); err != nil {
+			return
+		}
+		return buf.Bytes(), nil
+	case CodecLZ4:
+		return lz4Encode(pix), nil
+	case CodecLZH:
+		return lzhEncode(pix)
+	}
+	return nil, fmt.Errorf("image/rawp: bad Codec, %v", codec)
+}
+
+// rawpDecompressTile decompresses the tile data, n is the size of the
+// pixels of the tile.
+func rawpDecompressTile(codec Codec, data []byte, n int) (pix []byte, err error) {
+	switch codec {
+	case CodecNone:
+		pix = data
+	case CodecSnappy:
+		if m, err := snappy.DecodedLen(data); err != nil || m != n {
+			return nil, fmt.Errorf("image/rawp: snappy.DecodedLen, n = %v, err = %v", m, err)
+		}
+		if pix, err = snappy.Decode(nil, data); err != nil {
+			return nil, fmt.Errorf("image/rawp: snappy err: %v", err)
+		}
+	case CodecZlib:
+		r, err := zlib.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, fmt.Errorf("image/rawp: zlib err: %v", err)
+		}
+		pix = make([]byte, n)
+		if _, err = io.ReadFull(r, pix); err != nil {
+			return nil, fmt.Errorf("image/rawp: zlib err: %v", err)
+		}
+		// read the end of the stream to check the checksum
+		if k, err := r.Read(make([]byte, 1)); k != 0 || err != io.EOF {
+			return nil, fmt.Errorf("image/rawp: zlib, bad stream end, err = %v", err)
+		}
+	case CodecLZ4:
+		if pix, err = lz4Decode(data, n); err != nil {
+			return nil, err
+		}
+	case CodecLZH:
+		if pix, err = lzhDecode(data, n); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("image/rawp: bad Codec, %v", codec)
+	}
+	if len(pix) != n {
+		return nil, fmt.Errorf("image/rawp: bad tile size, expect = %d, got = %d", n, len(pix))
+	}
+	return
+}
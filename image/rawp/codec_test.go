@@ -0,0 +1,182 @@
+// Copyright 2014 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package rawp
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"math"
+	"math/rand"
+	"reflect"
+	"testing"
+
+	image_ext "github.com/chai2010/gopkg/image"
+	color_ext "github.com/chai2010/gopkg/image/color"
+)
+
+func TestCodec(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	random := make([]byte, 5000)
+	rnd.Read(random)
+	runs := make([]byte, 100000)
+	for i := range runs {
+		runs[i] = byte(i / 1000 % 7)
+	}
+	for _, codec := range []Codec{CodecNone, CodecSnappy, CodecZlib, CodecLZ4, CodecLZH} {
+		for i, src := range [][]byte{
+			{},
+			{1},
+			[]byte("abcdabcdabcd"),
+			[]byte("abcdabcdabcda"),
+			[]byte("aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"),
+			random,
+			append(append([]byte{}, random...), random...),
+			runs,
+		} {
+			data, err := rawpCompressTile(codec, append([]byte{}, src...))
+			if err != nil {
+				t.Fatalf("%v %d: compress: %v", codec, i, err)
+			}
+			got, err := rawpDecompressTile(codec, data, len(src))
+			if err != nil {
+				t.Fatalf("%v %d: decompress: %v", codec, i, err)
+			}
+			if !bytes.Equal(got, src) {
+				t.Fatalf("%v %d: data differ", codec, i)
+			}
+			if codec != CodecNone && len(src) > 0 {
+				if _, err = rawpDecompressTile(codec, data[:len(data)-1], len(src)); err == nil {
+					t.Fatalf("%v %d: expect error for the truncated data", codec, i)
+				}
+			}
+		}
+	}
+}
+
+func TestPredictor(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	for _, size := range []int{1, 2, 4, 8} {
+		for _, p := range []Predictor{PredictorHorizontal, PredictorFloat} {
+			pix := make([]byte, 7*5*3*size)
+			rnd.Read(pix)
+			golden := append([]byte{}, pix...)
+			rawpPredict(p, pix, 7, 5, 3, size)
+			if bytes.Equal(pix, golden) {
+				t.Fatalf("%v %d: pixels are not changed", p, size)
+			}
+			rawpUnpredict(p, pix, 7, 5, 3, size)
+			if !bytes.Equal(pix, golden) {
+				t.Fatalf("%v %d: pixels differ", p, size)
+			}
+		}
+	}
+}
+
+func TestEncodeDecode_codecs(t *testing.T) {
+	// a smooth DEM
+	dem := image_ext.NewGray32f(image.Rect(0, 0, 200, 150))
+	for y := 0; y < 150; y++ {
+		for x := 0; x < 200; x++ {
+			v := 1000 + 300*math.Sin(float64(x)/30)*math.Cos(float64(y)/20)
+			dem.SetGray32f(x, y, color_ext.Gray32f{Y: float32(v)})
+		}
+	}
+	gray16s := image_ext.NewGray16s(image.Rect(0, 0, 200, 150))
+	for y := 0; y < 150; y++ {
+		for x := 0; x < 200; x++ {
+			gray16s.SetGray16s(x, y, color_ext.Gray16s{Y: int16(x*y - 5000)})
+		}
+	}
+	multiBand := image_ext.NewMultiBand(image.Rect(0, 0, 50, 40), color_ext.NewUniformMultiBandModel(5, reflect.Float64))
+	for i := range multiBand.Pix {
+		multiBand.Pix[i] = uint8(i / 16)
+	}
+
+	sizes := make(map[[2]int]int)
+	for i, m0 := range []image.Image{dem, gray16s, tNewRGBTestImage(90, 70), multiBand} {
+		for _, codec := range []Codec{CodecNone, CodecSnappy, CodecZlib, CodecLZ4, CodecLZH} {
+			for _, predictor := range []Predictor{PredictorNone, PredictorHorizontal, PredictorFloat} {
+				opt := &Options{TileWidth: 64, TileHeight: 64, Codec: codec, Predictor: predictor}
+				var buf bytes.Buffer
+				err := Encode(&buf, m0, opt)
+				if isFloat := i == 0 || i == 3; predictor == PredictorFloat && !isFloat {
+					if err == nil {
+						t.Fatalf("%d: %v %v: expect error for the integer image", i, codec, predictor)
+					}
+					continue
+				}
+				if err != nil {
+					t.Fatalf("%d: %v %v: Encode: %v", i, codec, predictor, err)
+				}
+				if i == 0 {
+					sizes[[2]int{int(codec), int(predictor)}] = buf.Len()
+				}
+				data := buf.Bytes()
+				m1, err := Decode(bytes.NewReader(data), nil)
+				if err != nil {
+					t.Fatalf("%d: %v %v: Decode: %v", i, codec, predictor, err)
+				}
+				if err = tDiffPix(m0, m1); err != nil {
+					t.Fatalf("%d: %v %v: Decode: %v", i, codec, predictor, err)
+				}
+				tr, err := NewTileReader(bytes.NewReader(data), int64(len(data)), nil)
+				if err != nil {
+					t.Fatalf("%d: %v %v: NewTileReader: %v", i, codec, predictor, err)
+				}
+				r := image.Rect(30, 20, 100, 90).Intersect(m0.Bounds())
+				m, err := tr.ReadRect(r, nil)
+				if err != nil {
+					t.Fatalf("%d: %v %v: ReadRect: %v", i, codec, predictor, err)
+				}
+				if err = tDiffPix(m0.(image_ext.ImageBuffer).SubImage(r), m); err != nil {
+					t.Fatalf("%d: %v %v: ReadRect: %v", i, codec, predictor, err)
+				}
+			}
+		}
+	}
+
+	// the predictors make the smooth DEM smaller
+	for _, codec := range []Codec{CodecZlib, CodecLZH} {
+		none := sizes[[2]int{int(codec), int(PredictorNone)}]
+		float := sizes[[2]int{int(codec), int(PredictorFloat)}]
+		if float >= none {
+			t.Fatalf("%v: PredictorFloat is not smaller, %d >= %d", codec, float, none)
+		}
+	}
+	if v := sizes[[2]int{int(CodecLZH), int(PredictorNone)}]; v >= sizes[[2]int{int(CodecNone), int(PredictorNone)}] {
+		t.Fatalf("LZH is not smaller, %d", v)
+	}
+
+	// RawP v1 only supports snappy
+	var buf bytes.Buffer
+	if err := Encode(&buf, dem, &Options{Version: 1, Codec: CodecLZ4}); err == nil {
+		t.Fatalf("Encode: expect error for RawP v1 with LZ4")
+	}
+}
+
+// tDiffPix compares the images by diff, the MultiBand images are compared
+// by the band values.
+func tDiffPix(m0, m1 image.Image) error {
+	mb0, ok0 := m0.(*image_ext.MultiBand)
+	mb1, ok1 := m1.(*image_ext.MultiBand)
+	if !ok0 || !ok1 {
+		return diff(m0, m1)
+	}
+	if mb0.Bounds() != mb1.Bounds() || !mb0.Model.SameLayout(mb1.Model) {
+		return fmt.Errorf("differ MultiBand: %v vs %v", mb0.Bounds(), mb1.Bounds())
+	}
+	b := mb0.Bounds()
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			for k := range mb0.Model.Band {
+				if v0, v1 := mb0.Value(x, y, k), mb1.Value(x, y, k); v0 != v1 && !(v0 != v0 && v1 != v1) {
+					return fmt.Errorf("values differ at (%d, %d, %d): %v vs %v", x, y, k, v0, v1)
+				}
+			}
+		}
+	}
+	return nil
+}
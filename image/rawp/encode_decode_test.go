@@ -8,9 +8,14 @@ import (
 	"bytes"
 	"fmt"
 	"image"
+	"image/color"
+	"io"
+	"io/ioutil"
+	"reflect"
 	"testing"
 
 	image_ext "github.com/chai2010/gopkg/image"
+	color_ext "github.com/chai2010/gopkg/image/color"
 )
 
 func diff(m0, m1 image.Image) error {
@@ -61,6 +66,12 @@ func TestEncodeDecode(t *testing.T) {
 		image.NewRGBA(image.Rect(0, 0, 70, 70)),
 		image.NewRGBA64(image.Rect(0, 0, 80, 80)),
 		image_ext.NewRGBA128f(image.Rect(0, 0, 90, 90)),
+		image_ext.NewGray16s(image.Rect(0, 0, 10, 10)),
+		image_ext.NewGray32i(image.Rect(0, 0, 20, 20)),
+		image_ext.NewGray64f(image.Rect(0, 0, 30, 30)),
+		image_ext.NewRGB48s(image.Rect(0, 0, 40, 40)),
+		image_ext.NewRGB96i(image.Rect(0, 0, 50, 50)),
+		image_ext.NewRGB192f(image.Rect(0, 0, 60, 60)),
 	}
 	for i, m0 := range imgs {
 		m1, err := encodeDecode(m0)
@@ -73,3 +84,282 @@ func TestEncodeDecode(t *testing.T) {
 		}
 	}
 }
+
+func TestEncodeDecode_SignedAndFloat(t *testing.T) {
+	for i, v := range []struct {
+		Image image_ext.ImageBuffer
+		Color color.Color
+	}{
+		{image_ext.NewGray16s(image.Rect(0, 0, 10, 10)), color_ext.Gray16s{-1234}},
+		{image_ext.NewGray32i(image.Rect(0, 0, 10, 10)), color_ext.Gray32i{-123456}},
+		{image_ext.NewGray64f(image.Rect(0, 0, 10, 10)), color_ext.Gray64f{-0.125}},
+		{image_ext.NewRGB48s(image.Rect(0, 0, 10, 10)), color_ext.RGB48s{-1, 2, -3}},
+		{image_ext.NewRGB96i(image.Rect(0, 0, 10, 10)), color_ext.RGB96i{-1e6, 2, -3}},
+		{image_ext.NewRGB192f(image.Rect(0, 0, 10, 10)), color_ext.RGB192f{-1.5, 2, 1e10}},
+	} {
+		v.Image.Set(6, 3, v.Color)
+		m, err := encodeDecode(v.Image)
+		if err != nil {
+			t.Fatalf("%d: %v", i, err)
+		}
+		if m.ColorModel() != v.Image.ColorModel() {
+			t.Fatalf("%d: bad model", i)
+		}
+		if c := m.At(6, 3); c != v.Color {
+			t.Fatalf("%d: want %v, got %v", i, v.Color, c)
+		}
+	}
+}
+
+func TestEncodeDecode_MultiBand(t *testing.T) {
+	model := color_ext.NewUniformMultiBandModel(8, reflect.Int16)
+	mb := image_ext.NewMultiBand(image.Rect(0, 0, 10, 10), model)
+	for k := 0; k < 8; k++ {
+		mb.SetValue(6, 3, k, float64(-100*k))
+	}
+
+	var buf bytes.Buffer
+	if err := Encode(&buf, mb, nil); err != nil {
+		t.Fatalf("Encode: %v", err)
+	}
+	m, err := Decode(bytes.NewReader(buf.Bytes()), nil)
+	if err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+	tr, err := NewTileReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()), nil)
+	if err != nil {
+		t.Fatalf("NewTileReader: %v", err)
+	}
+	tile, err := tr.ReadRect(image.Rect(5, 2, 8, 5), nil)
+	if err != nil {
+		t.Fatalf("ReadRect: %v", err)
+	}
+	if tile.ColorModel() != tr.Config().ColorModel {
+		t.Fatalf("tile model is not shared")
+	}
+	for _, m := range []image.Image{m, tile} {
+		got, ok := m.(*image_ext.MultiBand)
+		if !ok {
+			t.Fatalf("bad image type: %T", m)
+		}
+		for k := 0; k < 8; k++ {
+			if v := got.Value(6, 3, k); v != float64(-100*k) {
+				t.Fatalf("band %d: want %v, got %v", k, -100*k, v)
+			}
+		}
+	}
+
+	// the bands must have the same data type
+	mixed := image_ext.NewMultiBand(image.Rect(0, 0, 10, 10), color_ext.NewMultiBandModel(
+		color_ext.BandInfo{DataType: reflect.Uint8},
+		color_ext.BandInfo{DataType: reflect.Float32},
+	))
+	if err := Encode(&buf, mixed, nil); err == nil {
+		t.Fatalf("Encode: expect error for mixed data types")
+	}
+}
+
+func tNewRGBTestImage(w, h int) *image_ext.RGB {
+	m := image_ext.NewRGB(image.Rect(0, 0, w, h))
+	for i := range m.Pix {
+		m.Pix[i] = uint8(i * 7 / 3)
+	}
+	return m
+}
+
+func TestEncodeDecode_v2(t *testing.T) {
+	m0 := tNewRGBTestImage(300, 200)
+	for i, opt := range []*Options{
+		nil,
+		{TileWidth: 64, TileHeight: 48},
+		{TileWidth: 64, TileHeight: 48, UseSnappy: true},
+		{TileWidth: 1000, TileHeight: 16}, // strips
+		{Version: 1},
+		{Version: 1, UseSnappy: true},
+	} {
+		var buf bytes.Buffer
+		if err := Encode(&buf, m0, opt); err != nil {
+			t.Fatalf("%d: Encode: %v", i, err)
+		}
+		data := buf.Bytes()
+		if isV2 := rawpIsV2(data); isV2 != (opt == nil || opt.Version != 1) {
+			t.Fatalf("%d: bad version, v2 = %v", i, isV2)
+		}
+		m1, err := Decode(bytes.NewReader(data), nil)
+		if err != nil {
+			t.Fatalf("%d: Decode: %v", i, err)
+		}
+		if err = diff(m0, m1); err != nil {
+			t.Fatalf("%d: Decode: %v", i, err)
+		}
+
+		tr, err := NewTileReader(bytes.NewReader(data), int64(len(data)), nil)
+		if err != nil {
+			t.Fatalf("%d: NewTileReader: %v", i, err)
+		}
+		for _, r := range []image.Rectangle{
+			image.Rect(0, 0, 300, 200),
+			image.Rect(10, 20, 11, 21),
+			image.Rect(60, 40, 130, 100),
+			image.Rect(250, 150, 400, 400),
+		} {
+			m, err := tr.ReadRect(r, nil)
+			if err != nil {
+				t.Fatalf("%d: ReadRect(%v): %v", i, r, err)
+			}
+			if want := r.Intersect(m0.Bounds()); m.Bounds() != want {
+				t.Fatalf("%d: ReadRect(%v): bad bounds, %v", i, r, m.Bounds())
+			}
+			if err = diff(m0.SubImage(m.Bounds()), m); err != nil {
+				t.Fatalf("%d: ReadRect(%v): %v", i, r, err)
+			}
+		}
+	}
+}
+
+func TestEncode_progress(t *testing.T) {
+	m := tNewRGBTestImage(300, 200)
+	for i, opt := range []*Options{
+		{TileWidth: 64, TileHeight: 48},
+		{Version: 1},
+	} {
+		var calls int
+		var last float64
+		opt.Progress = func(done float64) bool {
+			if done <= last {
+				t.Errorf("%d: bad progress, %v after %v", i, done, last)
+			}
+			calls, last = calls+1, done
+			return true
+		}
+		if err := Encode(ioutil.Discard, m, opt); err != nil {
+			t.Fatalf("%d: %v", i, err)
+		}
+		if last != 1 || opt.Version != 1 && calls != 25 {
+			t.Fatalf("%d: bad progress, calls = %d, done = %v", i, calls, last)
+		}
+
+		opt.Progress = func(done float64) bool { return false }
+		if err := Encode(ioutil.Discard, m, opt); err != image_ext.ErrCanceled {
+			t.Fatalf("%d: expect ErrCanceled, got %v", i, err)
+		}
+	}
+
+	// the common options
+	canceled := &image_ext.Options{Progress: func(done float64) bool { return false }}
+	if err := image_ext.Encode("rawp", ioutil.Discard, m, canceled); err != image_ext.ErrCanceled {
+		t.Fatalf("image_ext.Encode: expect ErrCanceled, got %v", err)
+	}
+}
+
+func TestWriterReader(t *testing.T) {
+	m0 := tNewRGBTestImage(100, 90)
+	opt := &Options{TileWidth: 32, TileHeight: 20, UseSnappy: true}
+
+	var golden bytes.Buffer
+	if err := Encode(&golden, m0, opt); err != nil {
+		t.Fatalf("Encode: %v", err)
+	}
+
+	// write 7 rows at a time
+	var buf bytes.Buffer
+	w, err := NewWriter(&buf, image.Config{ColorModel: m0.ColorModel(), Width: 100, Height: 90}, opt)
+	if err != nil {
+		t.Fatalf("NewWriter: %v", err)
+	}
+	for y := 0; y < 90; y += 7 {
+		r := image.Rect(0, y, 100, y+7).Intersect(m0.Bounds())
+		if err = w.WriteRows(m0.SubImage(r)); err != nil {
+			t.Fatalf("WriteRows(%v): %v", r, err)
+		}
+	}
+	if err = w.WriteRows(m0.SubImage(image.Rect(0, 0, 100, 1))); err == nil {
+		t.Fatalf("WriteRows: expect error for too many rows")
+	}
+	if err = w.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	if !bytes.Equal(buf.Bytes(), golden.Bytes()) {
+		t.Fatalf("Writer and Encode differ")
+	}
+	w, err = NewWriter(ioutil.Discard, image.Config{ColorModel: m0.ColorModel(), Width: 100, Height: 90}, opt)
+	if err != nil {
+		t.Fatalf("NewWriter: %v", err)
+	}
+	if err = w.Close(); err == nil {
+		t.Fatalf("Close: expect error for missing rows")
+	}
+
+	// read a row of tiles at a time
+	r, err := NewReader(&buf, nil)
+	if err != nil {
+		t.Fatalf("NewReader: %v", err)
+	}
+	if cfg := r.Config(); cfg.Width != 100 || cfg.Height != 90 || cfg.ColorModel != m0.ColorModel() {
+		t.Fatalf("bad config: %v", cfg)
+	}
+	for y := 0; y < 90; y += 20 {
+		m, err := r.Next()
+		if err != nil {
+			t.Fatalf("Next: %v", err)
+		}
+		if want := image.Rect(0, y, 100, y+20).Intersect(m0.Bounds()); m.Bounds() != want {
+			t.Fatalf("Next: bad bounds, expect = %v, got = %v", want, m.Bounds())
+		}
+		if err = diff(m0.SubImage(m.Bounds()), m); err != nil {
+			t.Fatalf("Next: %v", err)
+		}
+	}
+	if _, err = r.Next(); err != io.EOF {
+		t.Fatalf("Next: expect io.EOF, got %v", err)
+	}
+}
+
+func TestEncode_largeWidth(t *testing.T) {
+	m0 := image.NewGray(image.Rect(0, 0, 70000, 2))
+	m0.Pix[69999] = 0xFF
+	var buf bytes.Buffer
+	if err := Encode(&buf, m0, &Options{Version: 1}); err == nil {
+		t.Fatalf("Encode: expect error for RawP v1")
+	}
+	buf.Reset()
+	if err := Encode(&buf, m0, nil); err != nil {
+		t.Fatalf("Encode: %v", err)
+	}
+	m1, err := Decode(&buf, nil)
+	if err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+	if err = diff(m0, m1); err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+}
+
+func TestDecode_badTile(t *testing.T) {
+	m0 := tNewRGBTestImage(64, 64)
+	var buf bytes.Buffer
+	if err := Encode(&buf, m0, &Options{TileWidth: 32, TileHeight: 32}); err != nil {
+		t.Fatalf("Encode: %v", err)
+	}
+	data := buf.Bytes()
+	data[rawpHeaderSizeV2+rawpTileFrameSize+5] ^= 0x10 // the first tile
+
+	if _, err := Decode(bytes.NewReader(data), nil); err == nil {
+		t.Fatalf("Decode: expect error for the bad tile")
+	}
+	tr, err := NewTileReader(bytes.NewReader(data), int64(len(data)), nil)
+	if err != nil {
+		t.Fatalf("NewTileReader: %v", err)
+	}
+	if _, err = tr.ReadRect(image.Rect(0, 0, 10, 10), nil); err == nil {
+		t.Fatalf("ReadRect: expect error for the bad tile")
+	}
+	r := image.Rect(32, 0, 64, 64)
+	m, err := tr.ReadRect(r, nil)
+	if err != nil {
+		t.Fatalf("ReadRect: %v", err)
+	}
+	if err = diff(m0.SubImage(r), m); err != nil {
+		t.Fatalf("ReadRect: %v", err)
+	}
+}
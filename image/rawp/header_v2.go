@@ -0,0 +1,251 @@
+// Copyright 2014 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package rawp
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"math"
+)
+
+// DefaultTileSize is the tile width and height of RawP v2 images.
+const DefaultTileSize = 256
+
+const (
+	rawpHeaderSizeV2  = 40
+	rawpTileFrameSize = 8  // DataSize + DataCheckSum
+	rawpTrailerSize   = 16 // IndexOffset + IndexCheckSum + EndMagic
+	rawpMagicV2       = 0x2BF2380A
+	rawpVersion2      = 2
+	rawpMaxTileBytes  = 1 << 30
+)
+
+// RawP v2 Image Spec (Little Endian), 40Bytes.
+type rawpHeaderV2 struct {
+	Sig            [4]byte   // 4Bytes, RAWP
+	Magic          uint32    // 4Bytes, 0x2BF2380A
+	Version        uint16    // 2Bytes, 2
+	HeaderSize     uint16    // 2Bytes, the offset of the first tile
+	Width          uint32    // 4Bytes, image Width
+	Height         uint32    // 4Bytes, image Height
+	TileWidth      uint32    // 4Bytes, tile Width
+	TileHeight     uint32    // 4Bytes, tile Height
+	Channels       byte      // 1Bytes, 1=Gray, 3=RGB, 4=RGBA, others=MultiBand
+	Depth          byte      // 1Bytes, 8/16/32/64 bits
+	DataType       byte      // 1Bytes, 1=Uint, 2=Int, 3=Float
+	Codec          Codec     // 1Bytes, 0=none, 1=snappy, 2=zlib, 3=lz4, 4=lzh
+	Predictor      Predictor // 1Bytes, 0=none, 1=horizontal, 2=float
+	Reserved       [3]byte   // 3Bytes, 0
+	HeaderCheckSum uint32    // 4Bytes, CRC32 of the header before HeaderCheckSum
+}
+
+// RawP v2 end of file, 16Bytes.
+type rawpTrailer struct {
+	IndexOffset   uint64 // 8Bytes, the offset of the tile offsets
+	IndexCheckSum uint32 // 4Bytes, CRC32 of the tile offsets
+	EndMagic      uint32 // 4Bytes, 0x2BF2380A
+}
+
+func rawpMakeHeaderV2(config image.Config, tileWidth, tileHeight int, codec Codec, predictor Predictor) (hdr *rawpHeaderV2, err error) {
+	if config.Width <= 0 || config.Width > math.MaxInt32 || config.Height <= 0 || config.Height > math.MaxInt32 {
+		err = fmt.Errorf("image/rawp: image size overflow: width = %v, height = %v", config.Width, config.Height)
+		return
+	}
+	if tileWidth <= 0 || tileWidth > config.Width {
+		tileWidth = config.Width
+	}
+	if tileHeight <= 0 || tileHeight > config.Height {
+		tileHeight = config.Height
+	}
+
+	var pix rawpHeader
+	if err = rawpSetColorModel(&pix, config.ColorModel); err != nil {
+		return
+	}
+	hdr = &rawpHeaderV2{
+		Sig:        [4]byte{'R', 'A', 'W', 'P'},
+		Magic:      rawpMagicV2,
+		Version:    rawpVersion2,
+		HeaderSize: rawpHeaderSizeV2,
+		Width:      uint32(config.Width),
+		Height:     uint32(config.Height),
+		TileWidth:  uint32(tileWidth),
+		TileHeight: uint32(tileHeight),
+		Channels:   pix.Channels,
+		Depth:      pix.Depth,
+		DataType:   pix.DataType,
+		Codec:      codec,
+		Predictor:  predictor,
+	}
+	if err = rawpIsValidHeaderV2(hdr); err != nil {
+		return nil, err
+	}
+	return
+}
+
+func rawpIsValidHeaderV2(hdr *rawpHeaderV2) error {
+	if string(hdr.Sig[:]) != rawpSig {
+		return fmt.Errorf("image/rawp: bad Sig, %v", hdr.Sig)
+	}
+	if hdr.Magic != rawpMagicV2 {
+		return fmt.Errorf("image/rawp: bad Magic, %x", hdr.Magic)
+	}
+	if hdr.Version != rawpVersion2 {
+		return fmt.Errorf("image/rawp: unsupported Version, %v", hdr.Version)
+	}
+	if hdr.HeaderSize < rawpHeaderSizeV2 {
+		return fmt.Errorf("image/rawp: bad HeaderSize, %v", hdr.HeaderSize)
+	}
+
+	if hdr.Width <= 0 || hdr.Height <= 0 || hdr.Width > math.MaxInt32 || hdr.Height > math.MaxInt32 {
+		return fmt.Errorf("image/rawp: bad size, width = %v, height = %v", hdr.Width, hdr.Height)
+	}
+	if hdr.TileWidth <= 0 || hdr.TileHeight <= 0 || hdr.TileWidth > hdr.Width || hdr.TileHeight > hdr.Height {
+		return fmt.Errorf("image/rawp: bad tile size, width = %v, height = %v", hdr.TileWidth, hdr.TileHeight)
+	}
+
+	// the pixel format is checked as the v1 header
+	pix := hdr.pixHeader()
+	if !rawpIsValidChannels(pix.Channels) {
+		return fmt.Errorf("image/rawp: bad Channels, %v", pix.Channels)
+	}
+	if !rawpIsValidDepth(pix.Depth) {
+		return fmt.Errorf("image/rawp: bad Depth, %v", pix.Depth)
+	}
+	if !rawpIsValidDataType(pix.DataType) {
+		return fmt.Errorf("image/rawp: bad DataType, %v", pix.DataType)
+	}
+	if pix.Depth == 8 || pix.Depth == 16 {
+		if pix.DataType == rawpDataType_Float {
+			return fmt.Errorf("image/rawp: bad Depth, %v", pix.Depth)
+		}
+	}
+	if n := int64(hdr.TileWidth) * int64(hdr.TileHeight) * int64(pix.Channels) * int64(pix.Depth) / 8; n > rawpMaxTileBytes {
+		return fmt.Errorf("image/rawp: tile size overflow: width = %v, height = %v", hdr.TileWidth, hdr.TileHeight)
+	}
+
+	if !rawpIsValidCodec(hdr.Codec) {
+		return fmt.Errorf("image/rawp: bad Codec, %v", hdr.Codec)
+	}
+	if !rawpIsValidPredictor(hdr.Predictor, pix.DataType) {
+		return fmt.Errorf("image/rawp: bad Predictor, %v, DataType = %v", hdr.Predictor, pix.DataType)
+	}
+	return nil
+}
+
+// pixHeader returns a v1 header with the pixel format of the v2 header,
+// which is used to find the color model and the pix decoder and encoder.
+// The Width and Height of the decoder must be set by the tile size.
+func (p *rawpHeaderV2) pixHeader() *rawpHeader {
+	return &rawpHeader{
+		Channels: p.Channels,
+		Depth:    p.Depth,
+		DataType: p.DataType,
+	}
+}
+
+func (p *rawpHeaderV2) pixelSize() int {
+	return int(p.Channels) * int(p.Depth) / 8
+}
+
+func (p *rawpHeaderV2) tilesAcross() int {
+	return int((p.Width + p.TileWidth - 1) / p.TileWidth)
+}
+
+func (p *rawpHeaderV2) tilesDown() int {
+	return int((p.Height + p.TileHeight - 1) / p.TileHeight)
+}
+
+func (p *rawpHeaderV2) tileCount() int {
+	return p.tilesAcross() * p.tilesDown()
+}
+
+// tileRect returns the bounds of the tile i, the tiles on the right and
+// bottom edges are clipped to the image.
+func (p *rawpHeaderV2) tileRect(i int) image.Rectangle {
+	tw, th := int(p.TileWidth), int(p.TileHeight)
+	x, y := i%p.tilesAcross()*tw, i/p.tilesAcross()*th
+	return image.Rect(x, y, x+tw, y+th).Intersect(image.Rect(0, 0, int(p.Width), int(p.Height)))
+}
+
+func rawpEncodeHeaderV2(hdr *rawpHeaderV2) []byte {
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.LittleEndian, hdr)
+	data := buf.Bytes()
+	hdr.HeaderCheckSum = crc32.ChecksumIEEE(data[:rawpHeaderSizeV2-4])
+	binary.LittleEndian.PutUint32(data[rawpHeaderSizeV2-4:], hdr.HeaderCheckSum)
+	return data
+}
+
+func rawpDecodeHeaderV2(data []byte) (hdr *rawpHeaderV2, err error) {
+	if len(data) < rawpHeaderSizeV2 {
+		err = fmt.Errorf("image/rawp: bad header.")
+		return
+	}
+	hdr = new(rawpHeaderV2)
+	if err = binary.Read(bytes.NewReader(data[:rawpHeaderSizeV2]), binary.LittleEndian, hdr); err != nil {
+		return nil, err
+	}
+	if v := crc32.ChecksumIEEE(data[:rawpHeaderSizeV2-4]); v != hdr.HeaderCheckSum {
+		return nil, fmt.Errorf("image/rawp: bad HeaderCheckSum, expect = %x, got = %x", hdr.HeaderCheckSum, v)
+	}
+	if err = rawpIsValidHeaderV2(hdr); err != nil {
+		return nil, err
+	}
+	return
+}
+
+// rawpIsV2 reports whether the first 8 bytes are the Sig and Magic of a
+// RawP v2 image.
+func rawpIsV2(sig []byte) bool {
+	return len(sig) >= 8 && string(sig[:4]) == rawpSig && binary.LittleEndian.Uint32(sig[4:]) == rawpMagicV2
+}
+
+// rawpMaxTileDataSize returns the max compressed size of a tile with n
+// bytes pixels, the larger tiles are broken.
+func rawpMaxTileDataSize(n int) int {
+	return n + n/2 + 1024
+}
+
+// rawpEncodeTile applies the predictor to the pixels of the tile i in
+// place, and compresses them.
+func rawpEncodeTile(hdr *rawpHeaderV2, i int, pix []byte) (data []byte, err error) {
+	if hdr.Predictor != PredictorNone {
+		r := hdr.tileRect(i)
+		rawpPredict(hdr.Predictor, pix, r.Dx(), r.Dy(), int(hdr.Channels), int(hdr.Depth)/8)
+	}
+	return rawpCompressTile(hdr.Codec, pix)
+}
+
+// rawpDecodeTile checks the frame of the tile i and returns its pixels.
+func rawpDecodeTile(hdr *rawpHeaderV2, i int, frame []byte) (pix []byte, err error) {
+	r := hdr.tileRect(i)
+	n := r.Dx() * r.Dy() * hdr.pixelSize()
+	size := binary.LittleEndian.Uint32(frame[0:])
+	checkSum := binary.LittleEndian.Uint32(frame[4:])
+	data := frame[rawpTileFrameSize:]
+	if int64(size) != int64(len(data)) {
+		return nil, fmt.Errorf("image/rawp: bad DataSize, %v, tile %d", size, i)
+	}
+	if v := crc32.ChecksumIEEE(data); v != checkSum {
+		return nil, fmt.Errorf("image/rawp: bad DataCheckSum, expect = %x, got = %x, tile %d", checkSum, v, i)
+	}
+	if pix, err = rawpDecompressTile(hdr.Codec, data, n); err != nil {
+		return nil, fmt.Errorf("%v, tile %d", err, i)
+	}
+	if hdr.Predictor != PredictorNone {
+		rawpUnpredict(hdr.Predictor, pix, r.Dx(), r.Dy(), int(hdr.Channels), int(hdr.Depth)/8)
+	}
+	return
+}
+
+// rawpColorModelV2 returns the color model of the v2 header.
+func rawpColorModelV2(hdr *rawpHeaderV2) (color.Model, error) {
+	return rawpColorModel(hdr.pixHeader())
+}
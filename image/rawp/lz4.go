@@ -0,0 +1,152 @@
+// Copyright 2014 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package rawp
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// LZ4 block format, see https://github.com/lz4/lz4/blob/dev/doc/lz4_Block_format.md.
+const (
+	lz4MinMatch     = 4
+	lz4LastLiterals = 5  // the last 5 bytes are always literals
+	lz4MFLimit      = 12 // the last match starts 12 bytes before the end
+	lz4MaxOffset    = 65535
+	lz4HashLog      = 16
+)
+
+func lz4Hash(v uint32) uint32 {
+	return (v * 2654435761) >> (32 - lz4HashLog)
+}
+
+// lz4Encode compresses src into a LZ4 block.
+func lz4Encode(src []byte) []byte {
+	dst := make([]byte, 0, len(src)+len(src)/255+16)
+	n := len(src)
+	anchor := 0
+
+	if n >= lz4MFLimit+1 {
+		var table [1 << lz4HashLog]int32 // the positions + 1
+		for i := 0; i < n-lz4MFLimit; {
+			seq := binary.LittleEndian.Uint32(src[i:])
+			h := lz4Hash(seq)
+			ref := int(table[h]) - 1
+			table[h] = int32(i + 1)
+			if ref < 0 || i-ref > lz4MaxOffset || binary.LittleEndian.Uint32(src[ref:]) != seq {
+				i += 1 + (i-anchor)>>6 // skip faster in the incompressible data
+				continue
+			}
+			for i > anchor && ref > 0 && src[i-1] == src[ref-1] {
+				i, ref = i-1, ref-1
+			}
+			ml := lz4MinMatch
+			for i+ml < n-lz4LastLiterals && src[i+ml] == src[ref+ml] {
+				ml++
+			}
+			dst = lz4AppendSequence(dst, src[anchor:i], i-ref, ml)
+			i += ml
+			anchor = i
+		}
+	}
+	return lz4AppendSequence(dst, src[anchor:], 0, 0)
+}
+
+// lz4AppendSequence appends a sequence, the last sequence has no match.
+func lz4AppendSequence(dst, literals []byte, offset, matchLen int) []byte {
+	token := len(dst)
+	dst = append(dst, 0)
+	if n := len(literals); n >= 15 {
+		dst[token] = 15 << 4
+		dst = lz4AppendLength(dst, n-15)
+	} else {
+		dst[token] = byte(n << 4)
+	}
+	dst = append(dst, literals...)
+	if matchLen == 0 {
+		return dst
+	}
+	dst = append(dst, byte(offset), byte(offset>>8))
+	if n := matchLen - lz4MinMatch; n >= 15 {
+		dst[token] |= 15
+		dst = lz4AppendLength(dst, n-15)
+	} else {
+		dst[token] |= byte(n)
+	}
+	return dst
+}
+
+func lz4AppendLength(dst []byte, n int) []byte {
+	for ; n >= 255; n -= 255 {
+		dst = append(dst, 255)
+	}
+	return append(dst, byte(n))
+}
+
+// lz4Decode decompresses a LZ4 block of n bytes.
+func lz4Decode(src []byte, n int) (dst []byte, err error) {
+	dst = make([]byte, 0, n)
+	readLength := func(i int) (int, int, error) {
+		v := 0
+		for {
+			if i >= len(src) {
+				return 0, 0, fmt.Errorf("image/rawp: lz4, unexpected end of block")
+			}
+			b := int(src[i])
+			v, i = v+b, i+1
+			if b != 255 {
+				return v, i, nil
+			}
+		}
+	}
+	for i := 0; i < len(src); {
+		token := int(src[i])
+		i++
+
+		// literals
+		litLen := token >> 4
+		if litLen == 15 {
+			var v int
+			if v, i, err = readLength(i); err != nil {
+				return nil, err
+			}
+			litLen += v
+		}
+		if litLen > len(src)-i || litLen > n-len(dst) {
+			return nil, fmt.Errorf("image/rawp: lz4, bad literal length, %d", litLen)
+		}
+		dst = append(dst, src[i:i+litLen]...)
+		if i += litLen; i == len(src) {
+			break // the last sequence
+		}
+
+		// match
+		if i+2 > len(src) {
+			return nil, fmt.Errorf("image/rawp: lz4, unexpected end of block")
+		}
+		offset := int(src[i]) | int(src[i+1])<<8
+		i += 2
+		matchLen := token & 15
+		if matchLen == 15 {
+			var v int
+			if v, i, err = readLength(i); err != nil {
+				return nil, err
+			}
+			matchLen += v
+		}
+		matchLen += lz4MinMatch
+		if offset == 0 || offset > len(dst) || matchLen > n-len(dst) {
+			return nil, fmt.Errorf("image/rawp: lz4, bad match, offset = %d, length = %d", offset, matchLen)
+		}
+		for k := len(dst) - offset; matchLen > 0; matchLen-- {
+			dst = append(dst, dst[k])
+			k++
+		}
+	}
+	if len(dst) != n {
+		return nil, fmt.Errorf("image/rawp: lz4, bad size, expect = %d, got = %d", n, len(dst))
+	}
+	return
+}
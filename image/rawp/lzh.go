@@ -0,0 +1,175 @@
+// Copyright 2014 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package rawp
+
+import (
+	"bytes"
+	"compress/flate"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+)
+
+// The LZH block is a zstd-like format, but it's not compatible with zstd.
+// The data are parsed into LZ77 sequences with a large window and repeat
+// offsets, the literals and the sequences are Huffman coded separately:
+//
+//	uvarint(len(Literals)) Literals  // Huffman coded literal bytes
+//	uvarint(len(Sequences)) Sequences // Huffman coded uvarint triples
+//
+// A sequence is uvarint(literal length), uvarint(match length - 4) and
+// uvarint(offset code), the offset code 0 repeats the last offset, others
+// are offset + 1. The literals after the last sequence end the block.
+const (
+	lzhMinMatch  = 4
+	lzhMaxOffset = 1 << 20
+	lzhHashLog   = 17
+	lzhMaxChain  = 16 // the matches tried for a position
+)
+
+func lzhHash(v uint32) uint32 {
+	return (v * 2654435761) >> (32 - lzhHashLog)
+}
+
+// lzhEncode compresses src into a LZH block.
+func lzhEncode(src []byte) (data []byte, err error) {
+	var literals, sequences []byte
+	var tmp [binary.MaxVarintLen64]byte
+	appendUvarint := func(b []byte, v int) []byte {
+		return append(b, tmp[:binary.PutUvarint(tmp[:], uint64(v))]...)
+	}
+
+	n := len(src)
+	head := make([]int32, 1<<lzhHashLog) // the last positions + 1
+	chain := make([]int32, n)            // the previous positions + 1
+	insert := func(i int) {
+		h := lzhHash(binary.LittleEndian.Uint32(src[i:]))
+		chain[i] = head[h]
+		head[h] = int32(i + 1)
+	}
+
+	anchor, lastOffset := 0, 0
+	for i := 0; i+lzhMinMatch <= n; {
+		bestLen, bestOffset := 0, 0
+		if lastOffset > 0 && i >= lastOffset {
+			bestLen, bestOffset = lzhMatchLen(src, i-lastOffset, i), lastOffset
+		}
+		seq := binary.LittleEndian.Uint32(src[i:])
+		ref := int(head[lzhHash(seq)]) - 1
+		for k := 0; ref >= 0 && i-ref <= lzhMaxOffset && k < lzhMaxChain; k++ {
+			if l := lzhMatchLen(src, ref, i); l > bestLen {
+				bestLen, bestOffset = l, i-ref
+			}
+			ref = int(chain[ref]) - 1
+		}
+		if bestLen < lzhMinMatch {
+			insert(i)
+			i++
+			continue
+		}
+
+		offsetCode := bestOffset + 1
+		if bestOffset == lastOffset {
+			offsetCode = 0
+		}
+		literals = append(literals, src[anchor:i]...)
+		sequences = appendUvarint(sequences, i-anchor)
+		sequences = appendUvarint(sequences, bestLen-lzhMinMatch)
+		sequences = appendUvarint(sequences, offsetCode)
+		lastOffset = bestOffset
+		for end := i + bestLen; i < end; i++ {
+			if i+lzhMinMatch <= n {
+				insert(i)
+			}
+		}
+		anchor = i
+	}
+	literals = append(literals, src[anchor:]...)
+
+	var buf bytes.Buffer
+	for _, b := range [][]byte{literals, sequences} {
+		var block bytes.Buffer
+		w, err := flate.NewWriter(&block, flate.HuffmanOnly)
+		if err != nil {
+			return nil, err
+		}
+		if _, err = w.Write(b); err != nil {
+			return nil, err
+		}
+		if err = w.Close(); err != nil {
+			return nil, err
+		}
+		buf.Write(tmp[:binary.PutUvarint(tmp[:], uint64(block.Len()))])
+		buf.Write(block.Bytes())
+	}
+	return buf.Bytes(), nil
+}
+
+// lzhMatchLen returns the length of the match of src[i:] at src[ref:].
+func lzhMatchLen(src []byte, ref, i int) int {
+	n := 0
+	for i+n < len(src) && src[ref+n] == src[i+n] {
+		n++
+	}
+	return n
+}
+
+// lzhDecode decompresses a LZH block of n bytes.
+func lzhDecode(data []byte, n int) (dst []byte, err error) {
+	var streams [2][]byte
+	r := bytes.NewReader(data)
+	for k := range streams {
+		size, err := binary.ReadUvarint(r)
+		if err != nil || size > uint64(r.Len()) {
+			return nil, fmt.Errorf("image/rawp: lzh, bad stream size")
+		}
+		fr := flate.NewReader(io.LimitReader(r, int64(size)))
+		// the literals and the sequences are not larger than the block
+		if streams[k], err = ioutil.ReadAll(io.LimitReader(fr, int64(n)+1)); err != nil {
+			return nil, fmt.Errorf("image/rawp: lzh, %v", err)
+		}
+		if len(streams[k]) > n {
+			return nil, fmt.Errorf("image/rawp: lzh, stream too large")
+		}
+	}
+	literals, sequences := streams[0], bytes.NewReader(streams[1])
+
+	dst = make([]byte, 0, n)
+	lastOffset := 0
+	for sequences.Len() > 0 {
+		var v [3]uint64
+		for k := range v {
+			if v[k], err = binary.ReadUvarint(sequences); err != nil {
+				return nil, fmt.Errorf("image/rawp: lzh, bad sequence")
+			}
+		}
+		if v[0] > uint64(n) || v[1] > uint64(n) || v[2] > lzhMaxOffset+1 {
+			return nil, fmt.Errorf("image/rawp: lzh, bad sequence")
+		}
+		litLen, matchLen, offset := v[0], v[1]+lzhMinMatch, int(v[2])-1
+		if offset < 0 {
+			offset = lastOffset
+		}
+		if litLen > uint64(len(literals)) || litLen+matchLen > uint64(n-len(dst)) {
+			return nil, fmt.Errorf("image/rawp: lzh, bad sequence length")
+		}
+		dst = append(dst, literals[:litLen]...)
+		literals = literals[litLen:]
+		if offset <= 0 || offset > len(dst) {
+			return nil, fmt.Errorf("image/rawp: lzh, bad offset, %d", offset)
+		}
+		for k := len(dst) - offset; matchLen > 0; matchLen-- {
+			dst = append(dst, dst[k])
+			k++
+		}
+		lastOffset = offset
+	}
+	dst = append(dst, literals...)
+	if len(dst) != n {
+		return nil, fmt.Errorf("image/rawp: lzh, bad size, expect = %d, got = %d", n, len(dst))
+	}
+	return
+}
@@ -0,0 +1,298 @@
+// Copyright 2014 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package rawp
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"image"
+	"image/draw"
+	"unsafe"
+
+	image_ext "github.com/chai2010/gopkg/image"
+	color_ext "github.com/chai2010/gopkg/image/color"
+	"github.com/chai2010/gopkg/image/raw"
+)
+
+// OpenMapped maps the RawP file into memory and returns an image whose Pix
+// points into the mapped memory, the pixels are not copied. The file stays
+// mapped until f is closed, the image must not be used after that.
+//
+// Only the uncompressed pixels stored in one piece can be mapped, they are
+// the v1 images without snappy, and the v2 images of a single tile with
+// CodecNone and PredictorNone. The larger images are mapped tile by tile
+// with OpenMappedTiles. The Gray16, RGB48 and RGBA64 images can't be
+// mapped, see raw.Decoder.DecodeNoCopy.
+//
+// The pixels are not read when the file is opened, so the checksum of the
+// pixels is not checked, see VerifyMapped.
+func OpenMapped(filename string, mode raw.MapMode) (m draw.Image, f *raw.MappedFile, err error) {
+	if f, err = raw.OpenMappedFile(filename, mode); err != nil {
+		return
+	}
+	if m, err = rawpDecodeMapped(f.Data); err != nil {
+		f.Close()
+		return nil, nil, err
+	}
+	return
+}
+
+// VerifyMapped checks the checksums of the pixels of the RawP file mapped
+// by OpenMapped or OpenMappedTiles, all the pixels are read.
+func VerifyMapped(f *raw.MappedFile) error {
+	data := f.Data
+	if !rawpIsV2(data) {
+		hdr, pix, err := rawpMappedPixV1(data)
+		if err != nil {
+			return err
+		}
+		if v := crc32.ChecksumIEEE(pix); v != hdr.DataCheckSum {
+			return fmt.Errorf("image/rawp: bad DataCheckSum, expect = %x, got = %x", hdr.DataCheckSum, v)
+		}
+		return nil
+	}
+	hdr, err := rawpDecodeHeaderV2(data)
+	if err != nil {
+		return err
+	}
+	index, err := rawpReadIndexV2(bytes.NewReader(data), int64(len(data)), hdr)
+	if err != nil {
+		return err
+	}
+	for i := 0; i < hdr.tileCount(); i++ {
+		if err = rawpVerifyTileFrame(data[index[i]:index[i+1]], i); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// rawpVerifyTileFrame checks the DataSize and DataCheckSum of the frame of
+// the tile i.
+func rawpVerifyTileFrame(frame []byte, i int) error {
+	size := binary.LittleEndian.Uint32(frame[0:])
+	checkSum := binary.LittleEndian.Uint32(frame[4:])
+	data := frame[rawpTileFrameSize:]
+	if int64(size) != int64(len(data)) {
+		return fmt.Errorf("image/rawp: bad DataSize, %v, tile %d", size, i)
+	}
+	if v := crc32.ChecksumIEEE(data); v != checkSum {
+		return fmt.Errorf("image/rawp: bad DataCheckSum, expect = %x, got = %x, tile %d", checkSum, v, i)
+	}
+	return nil
+}
+
+// rawpMappedPixV1 returns the header and the uncompressed pixels of the
+// RawP v1 file.
+func rawpMappedPixV1(data []byte) (hdr *rawpHeader, pix []byte, err error) {
+	if len(data) < rawpHeaderSize {
+		return nil, nil, fmt.Errorf("image/rawp: OpenMapped, bad header.")
+	}
+	hdr = new(rawpHeader)
+	copy(((*[1 << 30]byte)(unsafe.Pointer(hdr)))[:rawpHeaderSize], data)
+	if err = rawpIsValidHeaderFields(hdr); err != nil {
+		return
+	}
+	if hdr.UseSnappy != 0 {
+		return nil, nil, fmt.Errorf("image/rawp: OpenMapped, the pixels are compressed with snappy; encode with CodecNone")
+	}
+	if int64(len(data)) < rawpHeaderSize+int64(hdr.DataSize) {
+		return nil, nil, fmt.Errorf("image/rawp: OpenMapped, bad DataSize, %v", hdr.DataSize)
+	}
+	pix = data[rawpHeaderSize:][:hdr.DataSize]
+	return
+}
+
+// rawpMappedHeaderV2 returns the header and the index of the RawP v2 file
+// whose tiles can be mapped, and checks the sizes of all the tiles.
+func rawpMappedHeaderV2(data []byte) (hdr *rawpHeaderV2, index []uint64, err error) {
+	if hdr, err = rawpDecodeHeaderV2(data); err != nil {
+		return
+	}
+	if hdr.Codec != CodecNone || hdr.Predictor != PredictorNone {
+		return nil, nil, fmt.Errorf(
+			"image/rawp: OpenMapped, the pixels are compressed, codec = %v, predictor = %v; encode with CodecNone and PredictorNone",
+			hdr.Codec, hdr.Predictor,
+		)
+	}
+	if len(data) < rawpHeaderSizeV2+rawpTrailerSize {
+		return nil, nil, fmt.Errorf("image/rawp: OpenMapped, bad file size, %d", len(data))
+	}
+	if index, err = rawpReadIndexV2(bytes.NewReader(data), int64(len(data)), hdr); err != nil {
+		return
+	}
+	for i := 0; i < hdr.tileCount(); i++ {
+		r := hdr.tileRect(i)
+		if n := uint64(r.Dx() * r.Dy() * hdr.pixelSize()); index[i+1]-index[i] != rawpTileFrameSize+n {
+			return nil, nil, fmt.Errorf("image/rawp: OpenMapped, bad DataSize, %v, tile %d", index[i+1]-index[i]-rawpTileFrameSize, i)
+		}
+	}
+	return
+}
+
+func rawpDecodeMapped(data []byte) (m draw.Image, err error) {
+	var hdr *rawpHeader
+	var pix []byte
+	var width, height int
+
+	if rawpIsV2(data) {
+		hdrV2, index, err := rawpMappedHeaderV2(data)
+		if err != nil {
+			return nil, err
+		}
+		if hdrV2.tileCount() != 1 {
+			return nil, fmt.Errorf(
+				"image/rawp: OpenMapped, the pixels are not stored in one piece, tiles = %d; use OpenMappedTiles",
+				hdrV2.tileCount(),
+			)
+		}
+		pix = data[index[0]+rawpTileFrameSize : index[1]]
+		hdr = hdrV2.pixHeader()
+		width, height = int(hdrV2.Width), int(hdrV2.Height)
+	} else {
+		if hdr, pix, err = rawpMappedPixV1(data); err != nil {
+			return
+		}
+		width, height = int(hdr.Width), int(hdr.Height)
+	}
+
+	decoder, err := rawpPixDecoder(hdr)
+	if err != nil {
+		return
+	}
+	p := raw.Decoder(*decoder)
+	p.Width, p.Height = width, height
+	return p.DecodeNoCopy(pix)
+}
+
+// MappedTileReader reads the tiles of a RawP v2 file mapped into memory,
+// the tiles are not copied and can be as large as the address space. The
+// checksums of the tiles are checked when the tiles are copied by
+// ReadRect, or by VerifyTile, the other pages of the file are not read.
+type MappedTileReader struct {
+	f       *raw.MappedFile
+	hdr     *rawpHeaderV2
+	index   []uint64 // the offsets of the tiles, and the offset of the index
+	decoder *pixDecoder
+	reader  *tileReaderV2
+}
+
+// OpenMappedTiles maps the RawP v2 file into memory and returns a reader of
+// its tiles. Only the tiles of CodecNone and PredictorNone can be mapped,
+// the Gray16, RGB48 and RGBA64 tiles can't be mapped, see OpenMapped.
+//
+// The file stays mapped until p is closed, the tiles returned by Tile must
+// not be used after that.
+func OpenMappedTiles(filename string, mode raw.MapMode, opt *Options) (p *MappedTileReader, err error) {
+	f, err := raw.OpenMappedFile(filename, mode)
+	if err != nil {
+		return
+	}
+	if p, err = newMappedTileReader(f, opt); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return
+}
+
+func newMappedTileReader(f *raw.MappedFile, opt *Options) (p *MappedTileReader, err error) {
+	if !rawpIsV2(f.Data) {
+		return nil, fmt.Errorf("image/rawp: OpenMappedTiles, not a RawP v2 image; use OpenMapped")
+	}
+	hdr, index, err := rawpMappedHeaderV2(f.Data)
+	if err != nil {
+		return
+	}
+	decoder, err := rawpPixDecoder(hdr.pixHeader())
+	if err != nil {
+		return
+	}
+	tr, err := newTileReaderV2(bytes.NewReader(f.Data), int64(len(f.Data)), opt)
+	if err != nil {
+		return
+	}
+	p = &MappedTileReader{
+		f:       f,
+		hdr:     hdr,
+		index:   index,
+		decoder: decoder,
+		reader:  tr.(*tileReaderV2),
+	}
+
+	// the pixel format is checked by the first tile
+	if _, err = p.Tile(0, 0); err != nil {
+		return nil, err
+	}
+	return
+}
+
+func (p *MappedTileReader) Config() image.Config {
+	return p.reader.Config()
+}
+
+// TileSize returns the size of the tiles, the tiles on the right and
+// bottom edges are clipped to the image.
+func (p *MappedTileReader) TileSize() (width, height int) {
+	return int(p.hdr.TileWidth), int(p.hdr.TileHeight)
+}
+
+// Tiles returns the number of the tiles across and down the image.
+func (p *MappedTileReader) Tiles() (across, down int) {
+	return p.hdr.tilesAcross(), p.hdr.tilesDown()
+}
+
+// tileIndex returns the index of the tile (tx, ty).
+func (p *MappedTileReader) tileIndex(tx, ty int) (i int, err error) {
+	if tx < 0 || ty < 0 || tx >= p.hdr.tilesAcross() || ty >= p.hdr.tilesDown() {
+		return 0, fmt.Errorf("image/rawp: tile (%d, %d) out of the image", tx, ty)
+	}
+	return ty*p.hdr.tilesAcross() + tx, nil
+}
+
+// Tile returns the tile (tx, ty) whose Pix points into the mapped memory,
+// the bounds of the tile are in the coordinates of the image. The checksum
+// of the tile is not checked, see VerifyTile.
+func (p *MappedTileReader) Tile(tx, ty int) (m draw.Image, err error) {
+	i, err := p.tileIndex(tx, ty)
+	if err != nil {
+		return
+	}
+	r := p.hdr.tileRect(i)
+	d := raw.Decoder(*p.decoder)
+	d.Width, d.Height = r.Dx(), r.Dy()
+	if m, err = d.DecodeNoCopy(p.f.Data[p.index[i]+rawpTileFrameSize : p.index[i+1]]); err != nil {
+		return
+	}
+	if tile, ok := m.(*image_ext.MultiBand); ok {
+		// all the tiles share the model of the image
+		if model, ok := p.reader.config.ColorModel.(*color_ext.MultiBandModel); ok {
+			tile.Model = model
+		}
+	}
+	setImageRect(m, r)
+	return
+}
+
+// VerifyTile checks the checksum of the tile (tx, ty).
+func (p *MappedTileReader) VerifyTile(tx, ty int) error {
+	i, err := p.tileIndex(tx, ty)
+	if err != nil {
+		return err
+	}
+	return rawpVerifyTileFrame(p.f.Data[p.index[i]:p.index[i+1]], i)
+}
+
+// ReadRect copies the pixels of the rectangle r from the tiles, the
+// checksums of the tiles are checked.
+func (p *MappedTileReader) ReadRect(r image.Rectangle, buf image_ext.ImageBuffer) (m image.Image, err error) {
+	return p.reader.ReadRect(r, buf)
+}
+
+// Close unmaps the file.
+func (p *MappedTileReader) Close() error {
+	return p.f.Close()
+}
@@ -0,0 +1,191 @@
+// Copyright 2014 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package rawp
+
+import (
+	"bytes"
+	"image"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	image_ext "github.com/chai2010/gopkg/image"
+	"github.com/chai2010/gopkg/image/raw"
+)
+
+func TestOpenMapped(t *testing.T) {
+	dir, err := ioutil.TempDir("", "image-rawp-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	m0 := image_ext.NewGray32f(image.Rect(0, 0, 300, 200))
+	for i := range m0.Pix {
+		m0.Pix[i] = uint8(i * 7 / 3)
+	}
+	for i, v := range []struct {
+		opt *Options
+		ok  bool
+	}{
+		{&Options{Version: 1}, true},
+		{&Options{TileWidth: 300, TileHeight: 200}, true},
+		{&Options{TileWidth: 1000, TileHeight: 1000}, true},
+		{&Options{Version: 1, UseSnappy: true}, false},
+		{&Options{TileWidth: 300, TileHeight: 200, Codec: CodecLZ4}, false},
+		{&Options{TileWidth: 300, TileHeight: 200, Predictor: PredictorFloat}, false},
+		{&Options{TileWidth: 64, TileHeight: 64}, false},
+	} {
+		var buf bytes.Buffer
+		if err := Encode(&buf, m0, v.opt); err != nil {
+			t.Fatalf("%d: Encode: %v", i, err)
+		}
+		filename := filepath.Join(dir, "a.rawp")
+		if err = ioutil.WriteFile(filename, buf.Bytes(), 0666); err != nil {
+			t.Fatalf("%d: %v", i, err)
+		}
+
+		for _, mode := range []raw.MapMode{raw.MapReadOnly, raw.MapCopyOnWrite} {
+			m1, f, err := OpenMapped(filename, mode)
+			if !v.ok {
+				if err == nil {
+					f.Close()
+					t.Fatalf("%d: %v: expect error", i, mode)
+				}
+				continue
+			}
+			if err != nil {
+				t.Fatalf("%d: %v: %v", i, mode, err)
+			}
+			if _, ok := m1.(*image_ext.Gray32f); !ok {
+				t.Fatalf("%d: %v: bad image type, %T", i, mode, m1)
+			}
+			if err = diff(m0, m1); err != nil {
+				t.Fatalf("%d: %v: %v", i, mode, err)
+			}
+			if err = f.Close(); err != nil {
+				t.Fatalf("%d: %v: %v", i, mode, err)
+			}
+		}
+	}
+}
+
+func TestOpenMappedTiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "image-rawp-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	m0 := image_ext.NewGray32f(image.Rect(0, 0, 300, 200))
+	for i := range m0.Pix {
+		m0.Pix[i] = uint8(i * 7 / 3)
+	}
+	var buf bytes.Buffer
+	if err := Encode(&buf, m0, &Options{TileWidth: 64, TileHeight: 48}); err != nil {
+		t.Fatal(err)
+	}
+	data := buf.Bytes()
+	filename := filepath.Join(dir, "a.rawp")
+	if err = ioutil.WriteFile(filename, data, 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	p, err := OpenMappedTiles(filename, raw.MapReadOnly, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if across, down := p.Tiles(); across != 5 || down != 5 {
+		t.Fatalf("bad tiles: %dx%d", across, down)
+	}
+	for ty := 0; ty < 5; ty++ {
+		for tx := 0; tx < 5; tx++ {
+			tile, err := p.Tile(tx, ty)
+			if err != nil {
+				t.Fatalf("Tile(%d, %d): %v", tx, ty, err)
+			}
+			if err = diff(m0.SubImage(tile.Bounds()), tile); err != nil {
+				t.Fatalf("Tile(%d, %d): %v", tx, ty, err)
+			}
+			if err = p.VerifyTile(tx, ty); err != nil {
+				t.Fatalf("VerifyTile(%d, %d): %v", tx, ty, err)
+			}
+		}
+	}
+	if _, err = p.Tile(5, 0); err == nil {
+		t.Fatalf("Tile out of the image: expect error")
+	}
+	r := image.Rect(50, 40, 250, 170)
+	m1, err := p.ReadRect(r, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = diff(m0.SubImage(r), m1); err != nil {
+		t.Fatal(err)
+	}
+	if err = p.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// the compressed tiles can't be mapped
+	buf.Reset()
+	if err := Encode(&buf, m0, &Options{TileWidth: 64, TileHeight: 48, Codec: CodecLZ4}); err != nil {
+		t.Fatal(err)
+	}
+	if err = ioutil.WriteFile(filename, buf.Bytes(), 0666); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = OpenMappedTiles(filename, raw.MapReadOnly, nil); err == nil {
+		t.Fatalf("expect error")
+	}
+}
+
+func TestVerifyMapped(t *testing.T) {
+	dir, err := ioutil.TempDir("", "image-rawp-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	m0 := image.NewGray(image.Rect(0, 0, 100, 80))
+	for i, opt := range []*Options{
+		{Version: 1},
+		{TileWidth: 100, TileHeight: 80},
+		{TileWidth: 32, TileHeight: 32},
+	} {
+		var buf bytes.Buffer
+		if err := Encode(&buf, m0, opt); err != nil {
+			t.Fatalf("%d: %v", i, err)
+		}
+		data := buf.Bytes()
+		data[len(data)/2] ^= 0xff // a pixel of the middle tile
+		filename := filepath.Join(dir, "a.rawp")
+		if err = ioutil.WriteFile(filename, data, 0666); err != nil {
+			t.Fatalf("%d: %v", i, err)
+		}
+
+		// the checksums are not checked when the file is opened
+		f, err := raw.OpenMappedFile(filename, raw.MapReadOnly)
+		if err != nil {
+			t.Fatalf("%d: %v", i, err)
+		}
+		if opt.TileWidth == 32 {
+			p, err := newMappedTileReader(f, nil)
+			if err != nil {
+				t.Fatalf("%d: %v", i, err)
+			}
+			if err = p.VerifyTile(0, 0); err != nil {
+				t.Fatalf("%d: %v", i, err)
+			}
+		} else if _, err = rawpDecodeMapped(f.Data); err != nil {
+			t.Fatalf("%d: %v", i, err)
+		}
+		if err = VerifyMapped(f); err == nil {
+			t.Fatalf("%d: expect error", i)
+		}
+		f.Close()
+	}
+}
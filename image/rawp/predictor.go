@@ -0,0 +1,141 @@
+// Copyright 2014 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package rawp
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// Predictor is the lossless predictor applied to the pixels of the tiles
+// before the compression, which makes the smooth images compress better.
+type Predictor byte
+
+const (
+	PredictorNone       Predictor = 0 // no prediction
+	PredictorHorizontal Predictor = 1 // horizontal differencing, like TIFF predictor 2
+	PredictorFloat      Predictor = 2 // horizontal differencing of the shuffled float bytes, like TIFF predictor 3
+)
+
+func (p Predictor) String() string {
+	switch p {
+	case PredictorNone:
+		return "None"
+	case PredictorHorizontal:
+		return "Horizontal"
+	case PredictorFloat:
+		return "Float"
+	}
+	return fmt.Sprintf("Predictor(%d)", byte(p))
+}
+
+// rawpIsValidPredictor reports whether the predictor can be used with the
+// data type, PredictorFloat is only for the float data.
+func rawpIsValidPredictor(p Predictor, dataType byte) bool {
+	switch p {
+	case PredictorNone, PredictorHorizontal:
+		return true
+	case PredictorFloat:
+		return dataType == rawpDataType_Float
+	}
+	return false
+}
+
+// rawpPredict applies the predictor to the rows of the tile pixels in place,
+// size is the bytes of a sample.
+func rawpPredict(p Predictor, pix []byte, width, height, channels, size int) {
+	rowSize := width * channels * size
+	var tmp []byte
+	for y := 0; y < height; y++ {
+		row := pix[y*rowSize:][:rowSize]
+		switch p {
+		case PredictorHorizontal:
+			predictHorizontal(row, channels, size)
+		case PredictorFloat:
+			tmp = newBytes(rowSize, tmp)
+			shuffleFloat(tmp, row, size)
+			predictHorizontal(tmp, channels, 1)
+			copy(row, tmp)
+		}
+	}
+}
+
+// rawpUnpredict reverts rawpPredict.
+func rawpUnpredict(p Predictor, pix []byte, width, height, channels, size int) {
+	rowSize := width * channels * size
+	var tmp []byte
+	for y := 0; y < height; y++ {
+		row := pix[y*rowSize:][:rowSize]
+		switch p {
+		case PredictorHorizontal:
+			unpredictHorizontal(row, channels, size)
+		case PredictorFloat:
+			tmp = newBytes(rowSize, tmp)
+			unpredictHorizontal(row, channels, 1)
+			unshuffleFloat(tmp, row, size)
+			copy(row, tmp)
+		}
+	}
+}
+
+// predictHorizontal replaces the samples by the difference to the same
+// channel of the left pixel, the samples are little endian integers.
+func predictHorizontal(row []byte, channels, size int) {
+	stride := channels * size
+	for i := len(row) - size; i >= stride; i -= size {
+		switch size {
+		case 1:
+			row[i] -= row[i-stride]
+		case 2:
+			v := binary.LittleEndian.Uint16(row[i:]) - binary.LittleEndian.Uint16(row[i-stride:])
+			binary.LittleEndian.PutUint16(row[i:], v)
+		case 4:
+			v := binary.LittleEndian.Uint32(row[i:]) - binary.LittleEndian.Uint32(row[i-stride:])
+			binary.LittleEndian.PutUint32(row[i:], v)
+		case 8:
+			v := binary.LittleEndian.Uint64(row[i:]) - binary.LittleEndian.Uint64(row[i-stride:])
+			binary.LittleEndian.PutUint64(row[i:], v)
+		}
+	}
+}
+
+func unpredictHorizontal(row []byte, channels, size int) {
+	stride := channels * size
+	for i := stride; i+size <= len(row); i += size {
+		switch size {
+		case 1:
+			row[i] += row[i-stride]
+		case 2:
+			v := binary.LittleEndian.Uint16(row[i:]) + binary.LittleEndian.Uint16(row[i-stride:])
+			binary.LittleEndian.PutUint16(row[i:], v)
+		case 4:
+			v := binary.LittleEndian.Uint32(row[i:]) + binary.LittleEndian.Uint32(row[i-stride:])
+			binary.LittleEndian.PutUint32(row[i:], v)
+		case 8:
+			v := binary.LittleEndian.Uint64(row[i:]) + binary.LittleEndian.Uint64(row[i-stride:])
+			binary.LittleEndian.PutUint64(row[i:], v)
+		}
+	}
+}
+
+// shuffleFloat splits the little endian samples of src into the byte
+// planes of dst, the most significant bytes come first.
+func shuffleFloat(dst, src []byte, size int) {
+	n := len(src) / size
+	for i := 0; i < n; i++ {
+		for k := 0; k < size; k++ {
+			dst[k*n+i] = src[i*size+size-1-k]
+		}
+	}
+}
+
+func unshuffleFloat(dst, src []byte, size int) {
+	n := len(src) / size
+	for i := 0; i < n; i++ {
+		for k := 0; k < size; k++ {
+			dst[i*size+size-1-k] = src[k*n+i]
+		}
+	}
+}
@@ -4,13 +4,13 @@
 
 // Package rawp implements a decoder and encoder for RawP images.
 //
-// RawP Image Structs (Little Endian):
+// RawP v1 Image Structs (Little Endian):
 //	type RawPImage struct {
 //		Sig          [4]byte // 4Bytes, WEWP
 //		Magic        uint32  // 4Bytes, 0x1BF2380A
 //		Width        uint16  // 2Bytes, image Width
 //		Height       uint16  // 2Bytes, image Height
-//		Channels     byte    // 1Bytes, 1=Gray, 3=RGB, 4=RGBA
+//		Channels     byte    // 1Bytes, 1=Gray, 3=RGB, 4=RGBA, others=MultiBand
 //		Depth        byte    // 1Bytes, 8/16/32/64 bits
 //		DataType     byte    // 1Bytes, 1=Uint, 2=Int, 3=Float
 //		UseSnappy    byte    // 1Bytes, 0=disabled, 1=enabled (RawPImage.Data)
@@ -19,6 +19,45 @@
 //		Data         []byte  // ?Bytes, image data (RawPImage.DataSize)
 //	}
 //
+// RawP v2 Image Structs (Little Endian):
+//	type RawPImageV2 struct {
+//		Sig            [4]byte  // 4Bytes, RAWP
+//		Magic          uint32   // 4Bytes, 0x2BF2380A
+//		Version        uint16   // 2Bytes, 2
+//		HeaderSize     uint16   // 2Bytes, the offset of the first tile, 40
+//		Width          uint32   // 4Bytes, image Width
+//		Height         uint32   // 4Bytes, image Height
+//		TileWidth      uint32   // 4Bytes, tile Width
+//		TileHeight     uint32   // 4Bytes, tile Height
+//		Channels       byte     // 1Bytes, 1=Gray, 3=RGB, 4=RGBA, others=MultiBand
+//		Depth          byte     // 1Bytes, 8/16/32/64 bits
+//		DataType       byte     // 1Bytes, 1=Uint, 2=Int, 3=Float
+//		Codec          byte     // 1Bytes, 0=none, 1=snappy, 2=zlib, 3=lz4, 4=lzh
+//		Predictor      byte     // 1Bytes, 0=none, 1=horizontal, 2=float
+//		Reserved       [3]byte  // 3Bytes, 0
+//		HeaderCheckSum uint32   // 4Bytes, CRC32 of the header before HeaderCheckSum
+//		Tiles          []Tile   // the tiles in row-major order
+//		Index          []uint64 // 8Bytes*N, the offsets of the tiles
+//		IndexOffset    uint64   // 8Bytes, the offset of the Index
+//		IndexCheckSum  uint32   // 4Bytes, CRC32(RawPImageV2.Index)
+//		EndMagic       uint32   // 4Bytes, 0x2BF2380A
+//	}
+//	type Tile struct {
+//		DataSize     uint32 // 4Bytes, tile data size (Tile.Data)
+//		DataCheckSum uint32 // 4Bytes, CRC32(Tile.Data[Tile.DataSize])
+//		Data         []byte // ?Bytes, compressed tile pixels
+//	}
+//
+// The tiles on the right and bottom edges are clipped to the image. The
+// tiles can be read one by one from a stream, or randomly by the Index at
+// the end of the file. A bad tile only loses the pixels of the tile.
+// The pixels of a tile are transformed by the Predictor and compressed
+// by the Codec, see Options.
+//
+// The images with other channels, or 4 channels of Int16/Int32/Float64,
+// are decoded as image.MultiBand. All the bands of a RawP image have the
+// same data type, the band names and nodata values are not stored.
+//
 // Please report bugs to chaishushan{AT}gmail.com.
 //
 // Thanks!
@@ -55,7 +94,7 @@ type rawpHeader struct {
 	Magic        uint32  // 4Bytes, 0x1BF2380A
 	Width        uint16  // 2Bytes, image Width
 	Height       uint16  // 2Bytes, image Height
-	Channels     byte    // 1Bytes, 1=Gray, 3=RGB, 4=RGBA
+	Channels     byte    // 1Bytes, 1=Gray, 3=RGB, 4=RGBA, others=MultiBand
 	Depth        byte    // 1Bytes, 8/16/32/64 bits
 	DataType     byte    // 1Bytes, 1=Uint, 2=Int, 3=Float
 	UseSnappy    byte    // 1Bytes, 0=disabled, 1=enabled (Header.Data)
@@ -94,7 +133,7 @@ image/rawp.rawpHeader{
 }
 
 func rawpIsValidChannels(channels byte) bool {
-	return channels == 1 || channels == 3 || channels == 4
+	return channels > 0
 }
 
 func rawpIsValidDepth(depth byte) bool {
@@ -106,6 +145,31 @@ func rawpIsValidDataType(t byte) bool {
 }
 
 func rawpIsValidHeader(hdr *rawpHeader) error {
+	if err := rawpIsValidHeaderFields(hdr); err != nil {
+		return err
+	}
+
+	// check data size more ...
+	if hdr.UseSnappy != 0 {
+		n, err := snappy.DecodedLen(hdr.Data)
+		if err != nil {
+			return fmt.Errorf("image/rawp: snappy.DecodedLen, err = %v", err)
+		}
+		if x := int(hdr.Width) * int(hdr.Height) * int(hdr.Channels) * int(hdr.Depth) / 8; n != x {
+			return fmt.Errorf("image/rawp: snappy.DecodedLen, n = %v", n)
+		}
+	}
+
+	// Check CRC32
+	if v := crc32.ChecksumIEEE(hdr.Data); v != hdr.DataCheckSum {
+		return fmt.Errorf("image/rawp: bad DataCheckSum, expect = %x, got = %x", hdr.DataCheckSum, v)
+	}
+
+	return nil
+}
+
+// rawpIsValidHeaderFields checks the header without touching the data.
+func rawpIsValidHeaderFields(hdr *rawpHeader) error {
 	if string(hdr.Sig[:]) != rawpSig {
 		return fmt.Errorf("image/rawp: bad Sig, %v", hdr.Sig)
 	}
@@ -141,26 +205,13 @@ func rawpIsValidHeader(hdr *rawpHeader) error {
 	}
 
 	// check data size more ...
-	if hdr.UseSnappy != 0 {
-		n, err := snappy.DecodedLen(hdr.Data)
-		if err != nil {
-			return fmt.Errorf("image/rawp: snappy.DecodedLen, err = %v", err)
-		}
-		if x := int(hdr.Width) * int(hdr.Height) * int(hdr.Channels) * int(hdr.Depth) / 8; n != x {
-			return fmt.Errorf("image/rawp: snappy.DecodedLen, n = %v", n)
-		}
-	} else {
+	if hdr.UseSnappy == 0 {
 		n := int(hdr.DataSize)
 		if x := int(hdr.Width) * int(hdr.Height) * int(hdr.Channels) * int(hdr.Depth) / 8; n != x {
 			return fmt.Errorf("image/rawp: bad DataSize, %v", hdr.DataSize)
 		}
 	}
 
-	// Check CRC32
-	if v := crc32.ChecksumIEEE(hdr.Data); v != hdr.DataCheckSum {
-		return fmt.Errorf("image/rawp: bad DataCheckSum, expect = %x, got = %x", hdr.DataCheckSum, v)
-	}
-
 	return nil
 }
 
@@ -174,6 +225,12 @@ func rawpColorModel(hdr *rawpHeader) (color.Model, error) {
 			return color.Gray16Model, nil
 		case hdr.Depth == 32 && hdr.DataType == rawpDataType_Float:
 			return color_ext.Gray32fModel, nil
+		case hdr.Depth == 16 && hdr.DataType == rawpDataType_Int:
+			return color_ext.Gray16sModel, nil
+		case hdr.Depth == 32 && hdr.DataType == rawpDataType_Int:
+			return color_ext.Gray32iModel, nil
+		case hdr.Depth == 64 && hdr.DataType == rawpDataType_Float:
+			return color_ext.Gray64fModel, nil
 		}
 	case hdr.Channels == 3:
 		switch {
@@ -183,6 +240,12 @@ func rawpColorModel(hdr *rawpHeader) (color.Model, error) {
 			return color_ext.RGB48Model, nil
 		case hdr.Depth == 32 && hdr.DataType == rawpDataType_Float:
 			return color_ext.RGB96fModel, nil
+		case hdr.Depth == 16 && hdr.DataType == rawpDataType_Int:
+			return color_ext.RGB48sModel, nil
+		case hdr.Depth == 32 && hdr.DataType == rawpDataType_Int:
+			return color_ext.RGB96iModel, nil
+		case hdr.Depth == 64 && hdr.DataType == rawpDataType_Float:
+			return color_ext.RGB192fModel, nil
 		}
 	case hdr.Channels == 4:
 		switch {
@@ -194,6 +257,9 @@ func rawpColorModel(hdr *rawpHeader) (color.Model, error) {
 			return color_ext.RGBA128fModel, nil
 		}
 	}
+	if kind := rawpDataKind(hdr); kind != reflect.Invalid {
+		return color_ext.NewUniformMultiBandModel(int(hdr.Channels), kind), nil
+	}
 	return nil, fmt.Errorf("image/rawp: unsupport color model, hdr = %v", hdr)
 }
 
@@ -225,6 +291,30 @@ func rawpPixDecoder(hdr *rawpHeader) (decoder *pixDecoder, err error) {
 				Height:   int(hdr.Height),
 			}
 			return
+		case hdr.Depth == 16 && hdr.DataType == rawpDataType_Int:
+			decoder = &pixDecoder{
+				Channels: int(hdr.Channels),
+				DataType: reflect.Int16,
+				Width:    int(hdr.Width),
+				Height:   int(hdr.Height),
+			}
+			return
+		case hdr.Depth == 32 && hdr.DataType == rawpDataType_Int:
+			decoder = &pixDecoder{
+				Channels: int(hdr.Channels),
+				DataType: reflect.Int32,
+				Width:    int(hdr.Width),
+				Height:   int(hdr.Height),
+			}
+			return
+		case hdr.Depth == 64 && hdr.DataType == rawpDataType_Float:
+			decoder = &pixDecoder{
+				Channels: int(hdr.Channels),
+				DataType: reflect.Float64,
+				Width:    int(hdr.Width),
+				Height:   int(hdr.Height),
+			}
+			return
 		}
 	case hdr.Channels == 3:
 		switch {
@@ -252,6 +342,30 @@ func rawpPixDecoder(hdr *rawpHeader) (decoder *pixDecoder, err error) {
 				Height:   int(hdr.Height),
 			}
 			return
+		case hdr.Depth == 16 && hdr.DataType == rawpDataType_Int:
+			decoder = &pixDecoder{
+				Channels: int(hdr.Channels),
+				DataType: reflect.Int16,
+				Width:    int(hdr.Width),
+				Height:   int(hdr.Height),
+			}
+			return
+		case hdr.Depth == 32 && hdr.DataType == rawpDataType_Int:
+			decoder = &pixDecoder{
+				Channels: int(hdr.Channels),
+				DataType: reflect.Int32,
+				Width:    int(hdr.Width),
+				Height:   int(hdr.Height),
+			}
+			return
+		case hdr.Depth == 64 && hdr.DataType == rawpDataType_Float:
+			decoder = &pixDecoder{
+				Channels: int(hdr.Channels),
+				DataType: reflect.Float64,
+				Width:    int(hdr.Width),
+				Height:   int(hdr.Height),
+			}
+			return
 		}
 	case hdr.Channels == 4:
 		switch {
@@ -281,6 +395,15 @@ func rawpPixDecoder(hdr *rawpHeader) (decoder *pixDecoder, err error) {
 			return
 		}
 	}
+	if kind := rawpDataKind(hdr); kind != reflect.Invalid {
+		decoder = &pixDecoder{
+			Channels: int(hdr.Channels),
+			DataType: kind,
+			Width:    int(hdr.Width),
+			Height:   int(hdr.Height),
+		}
+		return
+	}
 	return nil, fmt.Errorf("image/rawp: unsupport color model, hdr = %v", hdr)
 }
 
@@ -306,6 +429,24 @@ func rawpPixEncoder(hdr *rawpHeader) (encoder *pixEncoder, err error) {
 				DataType: reflect.Float32,
 			}
 			return
+		case hdr.Depth == 16 && hdr.DataType == rawpDataType_Int:
+			encoder = &pixEncoder{
+				Channels: int(hdr.Channels),
+				DataType: reflect.Int16,
+			}
+			return
+		case hdr.Depth == 32 && hdr.DataType == rawpDataType_Int:
+			encoder = &pixEncoder{
+				Channels: int(hdr.Channels),
+				DataType: reflect.Int32,
+			}
+			return
+		case hdr.Depth == 64 && hdr.DataType == rawpDataType_Float:
+			encoder = &pixEncoder{
+				Channels: int(hdr.Channels),
+				DataType: reflect.Float64,
+			}
+			return
 		}
 	case hdr.Channels == 3:
 		switch {
@@ -327,6 +468,24 @@ func rawpPixEncoder(hdr *rawpHeader) (encoder *pixEncoder, err error) {
 				DataType: reflect.Float32,
 			}
 			return
+		case hdr.Depth == 16 && hdr.DataType == rawpDataType_Int:
+			encoder = &pixEncoder{
+				Channels: int(hdr.Channels),
+				DataType: reflect.Int16,
+			}
+			return
+		case hdr.Depth == 32 && hdr.DataType == rawpDataType_Int:
+			encoder = &pixEncoder{
+				Channels: int(hdr.Channels),
+				DataType: reflect.Int32,
+			}
+			return
+		case hdr.Depth == 64 && hdr.DataType == rawpDataType_Float:
+			encoder = &pixEncoder{
+				Channels: int(hdr.Channels),
+				DataType: reflect.Float64,
+			}
+			return
 		}
 	case hdr.Channels == 4:
 		switch {
@@ -350,6 +509,13 @@ func rawpPixEncoder(hdr *rawpHeader) (encoder *pixEncoder, err error) {
 			return
 		}
 	}
+	if kind := rawpDataKind(hdr); kind != reflect.Invalid {
+		encoder = &pixEncoder{
+			Channels: int(hdr.Channels),
+			DataType: kind,
+		}
+		return
+	}
 	return nil, fmt.Errorf("image/rawp: unsupport color model, hdr = %v", hdr)
 }
 
@@ -372,55 +538,131 @@ func rawpMakeHeader(width, height int, model color.Model, useSnappy bool) (hdr *
 	if useSnappy {
 		hdr.UseSnappy = 1
 	}
+	if err = rawpSetColorModel(hdr, model); err != nil {
+		return nil, err
+	}
+	return
+}
 
+// rawpSetColorModel sets the Channels, Depth and DataType of hdr by model.
+func rawpSetColorModel(hdr *rawpHeader, model color.Model) error {
 	switch model {
 	case color.GrayModel:
 		hdr.Channels = 1
 		hdr.Depth = 8
 		hdr.DataType = rawpDataType_UInt
-		return
+		return nil
 	case color.Gray16Model:
 		hdr.Channels = 1
 		hdr.Depth = 16
 		hdr.DataType = rawpDataType_UInt
-		return
+		return nil
 	case color_ext.Gray32fModel:
 		hdr.Channels = 1
 		hdr.Depth = 32
 		hdr.DataType = rawpDataType_Float
-		return
+		return nil
 	case color_ext.RGBModel:
 		hdr.Channels = 3
 		hdr.Depth = 8
 		hdr.DataType = rawpDataType_UInt
-		return
+		return nil
 	case color_ext.RGB48Model:
 		hdr.Channels = 3
 		hdr.Depth = 16
 		hdr.DataType = rawpDataType_UInt
-		return
+		return nil
 	case color_ext.RGB96fModel:
 		hdr.Channels = 3
 		hdr.Depth = 32
 		hdr.DataType = rawpDataType_Float
-		return
+		return nil
 	case color.RGBAModel:
 		hdr.Channels = 4
 		hdr.Depth = 8
 		hdr.DataType = rawpDataType_UInt
-		return
+		return nil
 	case color.RGBA64Model:
 		hdr.Channels = 4
 		hdr.Depth = 16
 		hdr.DataType = rawpDataType_UInt
-		return
+		return nil
 	case color_ext.RGBA128fModel:
 		hdr.Channels = 4
 		hdr.Depth = 32
 		hdr.DataType = rawpDataType_Float
-		return
+		return nil
+	case color_ext.Gray16sModel:
+		hdr.Channels = 1
+		hdr.Depth = 16
+		hdr.DataType = rawpDataType_Int
+		return nil
+	case color_ext.Gray32iModel:
+		hdr.Channels = 1
+		hdr.Depth = 32
+		hdr.DataType = rawpDataType_Int
+		return nil
+	case color_ext.Gray64fModel:
+		hdr.Channels = 1
+		hdr.Depth = 64
+		hdr.DataType = rawpDataType_Float
+		return nil
+	case color_ext.RGB48sModel:
+		hdr.Channels = 3
+		hdr.Depth = 16
+		hdr.DataType = rawpDataType_Int
+		return nil
+	case color_ext.RGB96iModel:
+		hdr.Channels = 3
+		hdr.Depth = 32
+		hdr.DataType = rawpDataType_Int
+		return nil
+	case color_ext.RGB192fModel:
+		hdr.Channels = 3
+		hdr.Depth = 64
+		hdr.DataType = rawpDataType_Float
+		return nil
+	}
+	if model, ok := model.(*color_ext.MultiBandModel); ok {
+		if len(model.Band) == 0 || len(model.Band) > math.MaxUint8 {
+			return fmt.Errorf("image/rawp: bad MultiBand channels, %d", len(model.Band))
+		}
+		kind := model.DataType()
+		if kind == reflect.Invalid {
+			return fmt.Errorf("image/rawp: MultiBand bands must have the same data type")
+		}
+		hdr.Channels = byte(len(model.Band))
+		hdr.Depth = byte(model.Band[0].Size() * 8)
+		switch kind {
+		case reflect.Uint8, reflect.Uint16:
+			hdr.DataType = rawpDataType_UInt
+		case reflect.Int16, reflect.Int32:
+			hdr.DataType = rawpDataType_Int
+		case reflect.Float32, reflect.Float64:
+			hdr.DataType = rawpDataType_Float
+		}
+		return nil
+	}
+	return fmt.Errorf("image/rawp: unsupport color model, %T", model)
+}
+
+// rawpDataKind returns the data type of the channels in hdr.
+func rawpDataKind(hdr *rawpHeader) reflect.Kind {
+	switch {
+	case hdr.Depth == 8 && hdr.DataType == rawpDataType_UInt:
+		return reflect.Uint8
+	case hdr.Depth == 16 && hdr.DataType == rawpDataType_UInt:
+		return reflect.Uint16
+	case hdr.Depth == 16 && hdr.DataType == rawpDataType_Int:
+		return reflect.Int16
+	case hdr.Depth == 32 && hdr.DataType == rawpDataType_Int:
+		return reflect.Int32
+	case hdr.Depth == 32 && hdr.DataType == rawpDataType_Float:
+		return reflect.Float32
+	case hdr.Depth == 64 && hdr.DataType == rawpDataType_Float:
+		return reflect.Float64
 	}
-	return nil, fmt.Errorf("image/rawp: unsupport color model, %T", model)
+	return reflect.Invalid
 }
 
 func rawpDecodeHeader(data []byte) (hdr *rawpHeader, err error) {
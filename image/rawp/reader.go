@@ -5,6 +5,8 @@
 package rawp
 
 import (
+	"bytes"
+	"encoding/binary"
 	"fmt"
 	"image"
 	"image/color"
@@ -13,69 +15,246 @@ import (
 
 	"code.google.com/p/snappy-go/snappy"
 	image_ext "github.com/chai2010/gopkg/image"
+	color_ext "github.com/chai2010/gopkg/image/color"
 	"github.com/chai2010/gopkg/image/convert"
 )
 
+// Options are the encoding and decoding parameters.
 type Options struct {
-	ColorModel color.Model
-	UseSnappy  bool
+	ColorModel color.Model // convert the image to ColorModel
+	UseSnappy  bool        // compress the pixels with snappy, same as CodecSnappy
+	Codec      Codec       // the compression of v2, CodecNone if zero
+	Predictor  Predictor   // the predictor of v2, PredictorNone if zero
+	TileWidth  int         // the tile width of v2, DefaultTileSize if zero
+	TileHeight int         // the tile height of v2, DefaultTileSize if zero
+	Version    int         // 1 encodes RawP v1, 0 or 2 encodes RawP v2
+
+	// Progress reports the progress of Encode and Writer by tiles, may be
+	// nil. The encoding is canceled with image_ext.ErrCanceled if it
+	// returns false.
+	Progress image_ext.ProgressFunc
 }
 
+// DecodeConfig returns the color model and dimensions of a RawP image
+// without decoding the entire image.
 func DecodeConfig(r io.Reader) (config image.Config, err error) {
-	data, err := ioutil.ReadAll(r)
+	p, err := NewReader(r, nil)
 	if err != nil {
 		return
 	}
-	hdr, err := rawpDecodeHeader(data)
+	config = p.Config()
+	return
+}
+
+// Decode reads a RawP v1 or v2 image from r and returns it as an
+// image.Image.
+func Decode(r io.Reader, opt *Options) (m image.Image, err error) {
+	p, err := NewReader(r, nil)
 	if err != nil {
 		return
 	}
 
-	model, err := rawpColorModel(hdr)
-	if err != nil {
+	// decode raw pix
+	var pix []byte
+	if p.v1 != nil {
+		if pix, err = p.v1Pix(); err != nil {
+			return
+		}
+	} else {
+		pix = make([]byte, p.rowSize()*p.config.Height)
+		for y := 0; y < p.config.Height; {
+			n, err := p.readRows(pix[y*p.rowSize():])
+			if err != nil {
+				return nil, err
+			}
+			y += n
+		}
+	}
+	decoder := *p.decoder
+	decoder.Width, decoder.Height = p.config.Width, p.config.Height
+	if m, err = decoder.Decode(pix, nil); err != nil {
 		return
 	}
 
-	config = image.Config{model, int(hdr.Width), int(hdr.Height)}
+	// convert color model
+	if opt != nil && opt.ColorModel != nil {
+		m = convert.ColorModel(m, opt.ColorModel)
+	}
+
 	return
 }
 
-func Decode(r io.Reader, opt *Options) (m image.Image, err error) {
-	data, err := ioutil.ReadAll(r)
-	if err != nil {
-		return
-	}
-	hdr, err := rawpDecodeHeader(data)
-	if err != nil {
+// Reader reads a RawP image from a stream row by row, RawP v2 images are
+// read a row of tiles at a time, and RawP v1 images are read at once.
+type Reader struct {
+	r       io.Reader
+	hdr     *rawpHeaderV2 // nil for v1
+	decoder *pixDecoder
+	opt     *Options
+	config  image.Config
+	v1      *rawpHeader // nil for v2
+	y       int         // the next row
+	tile    int         // the next tile of v2
+	buf     []byte
+}
+
+// NewReader reads the header of a RawP v1 or v2 image from r, and returns
+// a Reader for the pixels.
+func NewReader(r io.Reader, opt *Options) (p *Reader, err error) {
+	var sig [8]byte
+	if _, err = io.ReadFull(r, sig[:]); err != nil {
 		return
 	}
+	p = &Reader{r: r, opt: opt}
 
-	// new decoder
-	decoder, err := rawpPixDecoder(hdr)
-	if err != nil {
-		return
+	var model color.Model
+	if rawpIsV2(sig[:]) {
+		data := make([]byte, rawpHeaderSizeV2)
+		copy(data, sig[:])
+		if _, err = io.ReadFull(r, data[len(sig):]); err != nil {
+			return nil, err
+		}
+		if p.hdr, err = rawpDecodeHeaderV2(data); err != nil {
+			return nil, err
+		}
+		if _, err = io.CopyN(ioutil.Discard, r, int64(p.hdr.HeaderSize)-rawpHeaderSizeV2); err != nil {
+			return nil, err
+		}
+		if p.decoder, err = rawpPixDecoder(p.hdr.pixHeader()); err != nil {
+			return nil, err
+		}
+		if model, err = rawpColorModelV2(p.hdr); err != nil {
+			return nil, err
+		}
+		p.config = image.Config{ColorModel: model, Width: int(p.hdr.Width), Height: int(p.hdr.Height)}
+	} else {
+		data, err := ioutil.ReadAll(io.MultiReader(bytes.NewReader(sig[:]), r))
+		if err != nil {
+			return nil, err
+		}
+		hdr, err := rawpDecodeHeader(data)
+		if err != nil {
+			return nil, err
+		}
+		if p.decoder, err = rawpPixDecoder(hdr); err != nil {
+			return nil, err
+		}
+		if model, err = rawpColorModel(hdr); err != nil {
+			return nil, err
+		}
+		p.config = image.Config{ColorModel: model, Width: int(hdr.Width), Height: int(hdr.Height)}
+		p.v1 = hdr
 	}
+	return
+}
 
+// v1Pix returns the pixels of the v1 image.
+func (p *Reader) v1Pix() (pix []byte, err error) {
 	// decode snappy
-	pix := hdr.Data
-	if hdr.UseSnappy != 0 {
-		if pix, err = snappy.Decode(nil, hdr.Data); err != nil {
-			err = fmt.Errorf("image/rawp: Decode, snappy err: %v", err)
-			return
+	pix = p.v1.Data
+	if p.v1.UseSnappy != 0 {
+		if pix, err = snappy.Decode(nil, p.v1.Data); err != nil {
+			return nil, fmt.Errorf("image/rawp: Decode, snappy err: %v", err)
 		}
 	}
+	return
+}
 
-	// decode raw pix
-	m, err = decoder.Decode(pix, nil)
+// Config returns the color model and dimensions of the image, the color
+// model is not converted by opt.ColorModel.
+func (p *Reader) Config() image.Config {
+	return p.config
+}
+
+func (p *Reader) rowSize() int {
+	return p.decoder.getPixelSize() * p.config.Width
+}
+
+// readRows reads the pixels of the next rows to dst, and returns the
+// number of the rows.
+func (p *Reader) readRows(dst []byte) (n int, err error) {
+	if p.y >= p.config.Height {
+		return 0, io.EOF
+	}
+	if p.v1 != nil {
+		pix, err := p.v1Pix()
+		if err != nil {
+			return 0, err
+		}
+		copy(dst, pix)
+		p.y = p.config.Height
+		return p.y, nil
+	}
+
+	rowSize, pixSize := p.rowSize(), p.decoder.getPixelSize()
+	for ; p.tile < p.hdr.tileCount(); p.tile++ {
+		r := p.hdr.tileRect(p.tile)
+		if r.Min.Y > p.y {
+			break
+		}
+		tileRowSize := r.Dx() * pixSize
+		size := tileRowSize * r.Dy()
+
+		var frame [rawpTileFrameSize]byte
+		if _, err = io.ReadFull(p.r, frame[:]); err != nil {
+			return 0, err
+		}
+		dataSize := int64(binary.LittleEndian.Uint32(frame[0:]))
+		if dataSize > int64(rawpMaxTileDataSize(size)) {
+			return 0, fmt.Errorf("image/rawp: bad DataSize, %v, tile %d", dataSize, p.tile)
+		}
+		p.buf = newBytes(rawpTileFrameSize+int(dataSize), p.buf)
+		copy(p.buf, frame[:])
+		if _, err = io.ReadFull(p.r, p.buf[rawpTileFrameSize:]); err != nil {
+			return 0, err
+		}
+		tile, err := rawpDecodeTile(p.hdr, p.tile, p.buf)
+		if err != nil {
+			return 0, err
+		}
+		for y := 0; y < r.Dy(); y++ {
+			copy(dst[y*rowSize+r.Min.X*pixSize:][:tileRowSize], tile[y*tileRowSize:])
+		}
+		n = r.Dy()
+	}
+	p.y += n
+	return
+}
+
+// Next decodes the next rows of the image, and returns them as an image
+// with the bounds of the rows. It returns io.EOF after the last row.
+func (p *Reader) Next() (m image.Image, err error) {
+	if p.y >= p.config.Height {
+		return nil, io.EOF
+	}
+	y := p.y
+	n := p.config.Height - y
+	if p.hdr != nil && n > int(p.hdr.TileHeight) {
+		n = int(p.hdr.TileHeight)
+	}
+	pix := make([]byte, p.rowSize()*n)
+	if n, err = p.readRows(pix); err != nil {
+		return
+	}
+
+	decoder := *p.decoder
+	decoder.Width, decoder.Height = p.config.Width, n
+	tile, err := decoder.Decode(pix, nil)
 	if err != nil {
 		return
 	}
+	if tile, ok := tile.(*image_ext.MultiBand); ok {
+		// all the rows share the model of the image
+		if model, ok := p.config.ColorModel.(*color_ext.MultiBandModel); ok {
+			tile.Model = model
+		}
+	}
+	m = setImageRect(tile, image.Rect(0, y, p.config.Width, y+n))
 
 	// convert color model
-	if opt != nil && opt.ColorModel != nil {
-		m = convert.ColorModel(m, opt.ColorModel)
+	if p.opt != nil && p.opt.ColorModel != nil {
+		m = convert.ColorModel(m, p.opt.ColorModel)
 	}
-
 	return
 }
 
@@ -83,31 +262,67 @@ func imageDecode(r io.Reader) (image.Image, error) {
 	return Decode(r, nil)
 }
 
-func imageExtDecode(r io.Reader, opt interface{}) (image.Image, error) {
-	if opt, ok := opt.(*Options); ok {
-		return Decode(r, opt)
-	} else {
-		return Decode(r, nil)
+// newOptions converts the common options to the rawp options.
+func newOptions(opt *image_ext.Options) (*Options, error) {
+	var p Options
+	if ok, err := image_ext.ConvertOptions("rawp", opt, &p); !ok {
+		return nil, err
 	}
+	return &p, nil
 }
 
-func imageExtEncode(w io.Writer, m image.Image, opt interface{}) error {
-	if opt, ok := opt.(*Options); ok {
-		return Encode(w, m, opt)
-	} else {
-		return Encode(w, m, nil)
+// newEncodeOptions converts the common options to the rawp options,
+// RawP images are always lossless.
+func newEncodeOptions(opt *image_ext.Options) (*Options, error) {
+	var p Options
+	ok, err := image_ext.ConvertEncodeOptions("rawp", opt, &p, image_ext.EncodeSupport{
+		Compression: []image_ext.Compression{
+			image_ext.CompressionNone,
+			image_ext.CompressionSnappy,
+			image_ext.CompressionDeflate,
+		},
+	})
+	if !ok {
+		return nil, err
+	}
+	switch opt.Compression {
+	case image_ext.CompressionNone:
+		p.UseSnappy, p.Codec = false, CodecNone
+	case image_ext.CompressionSnappy:
+		p.UseSnappy, p.Codec = false, CodecSnappy
+	case image_ext.CompressionDeflate:
+		p.UseSnappy, p.Codec = false, CodecZlib
+	}
+	return &p, nil
+}
+
+func imageExtDecode(r io.Reader, opt *image_ext.Options) (image.Image, error) {
+	p, err := newOptions(opt)
+	if err != nil {
+		return nil, err
+	}
+	return Decode(r, p)
+}
+
+func imageExtEncode(w io.Writer, m image.Image, opt *image_ext.Options) error {
+	p, err := newEncodeOptions(opt)
+	if err != nil {
+		return err
 	}
+	return Encode(w, m, p)
 }
 
 func init() {
-	image.RegisterFormat("rawp", "RAWP\x1B\xF2\x38\x0A", imageDecode, DecodeConfig)
+	image.RegisterFormat("rawp", "RAWP\x0A\x38\xF2\x1B", imageDecode, DecodeConfig)
+	image.RegisterFormat("rawp", "RAWP\x0A\x38\xF2\x2B", imageDecode, DecodeConfig)
 
 	image_ext.RegisterFormat(image_ext.Format{
-		Name:         "rawp",
-		Extensions:   []string{".rawp"},
-		Magics:       []string{"RAWP\x1B\xF2\x38\x0A"}, // rawSig + rawpMagic
-		DecodeConfig: DecodeConfig,
-		Decode:       imageExtDecode,
-		Encode:       imageExtEncode,
+		Name:          "rawp",
+		Extensions:    []string{".rawp"},
+		Magics:        []string{"RAWP\x0A\x38\xF2\x1B", "RAWP\x0A\x38\xF2\x2B"}, // rawSig + rawpMagic/rawpMagicV2
+		DecodeConfig:  DecodeConfig,
+		Decode:        imageExtDecode,
+		Encode:        imageExtEncode,
+		NewTileReader: imageExtNewTileReader,
 	})
 }
@@ -0,0 +1,287 @@
+// Copyright 2014 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package rawp
+
+import (
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"io"
+	"unsafe"
+
+	image_ext "github.com/chai2010/gopkg/image"
+	color_ext "github.com/chai2010/gopkg/image/color"
+	"github.com/chai2010/gopkg/image/convert"
+	draw_ext "github.com/chai2010/gopkg/image/draw"
+)
+
+type tileReader struct {
+	r       io.ReaderAt
+	hdr     *rawpHeader
+	decoder *pixDecoder
+	opt     *Options
+	config  image.Config
+}
+
+// NewTileReader returns a TileReader for the RawP image stored in r.
+// RawP v2 images only decode the tiles inside the rectangles. For RawP v1
+// images, uncompressed images are read row by row for every rectangle,
+// snappy compressed images are decoded once and the rectangles are taken
+// from it.
+func NewTileReader(r io.ReaderAt, size int64, opt *Options) (p image_ext.TileReader, err error) {
+	if size < rawpHeaderSize {
+		err = fmt.Errorf("image/rawp: NewTileReader, bad header.")
+		return
+	}
+	var sig [8]byte
+	if _, err = r.ReadAt(sig[:], 0); err != nil {
+		return
+	}
+	if rawpIsV2(sig[:]) {
+		return newTileReaderV2(r, size, opt)
+	}
+
+	hdr := new(rawpHeader)
+	if _, err = r.ReadAt(((*[1 << 30]byte)(unsafe.Pointer(hdr)))[:rawpHeaderSize], 0); err != nil {
+		return
+	}
+	if err = rawpIsValidHeaderFields(hdr); err != nil {
+		return
+	}
+	if size < rawpHeaderSize+int64(hdr.DataSize) {
+		err = fmt.Errorf("image/rawp: NewTileReader, bad DataSize, %v", hdr.DataSize)
+		return
+	}
+
+	if hdr.UseSnappy != 0 {
+		var m image.Image
+		if m, err = Decode(io.NewSectionReader(r, 0, size), opt); err != nil {
+			return
+		}
+		p = image_ext.NewImageTileReader(m)
+		return
+	}
+
+	decoder, err := rawpPixDecoder(hdr)
+	if err != nil {
+		return
+	}
+	model, err := rawpColorModel(hdr)
+	if err != nil {
+		return
+	}
+	if opt != nil && opt.ColorModel != nil {
+		model = opt.ColorModel
+	}
+	p = &tileReader{
+		r:       r,
+		hdr:     hdr,
+		decoder: decoder,
+		opt:     opt,
+		config:  image.Config{ColorModel: model, Width: int(hdr.Width), Height: int(hdr.Height)},
+	}
+	return
+}
+
+func (p *tileReader) Config() image.Config {
+	return p.config
+}
+
+func (p *tileReader) ReadRect(r image.Rectangle, buf image_ext.ImageBuffer) (m image.Image, err error) {
+	r = r.Intersect(image.Rect(0, 0, int(p.hdr.Width), int(p.hdr.Height)))
+	if r.Empty() {
+		err = fmt.Errorf("image/rawp: ReadRect, empty rect: %v", r)
+		return
+	}
+
+	pixSize := p.decoder.getPixelSize()
+	rowSize := r.Dx() * pixSize
+	data := make([]byte, rowSize*r.Dy())
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		off := rawpHeaderSize + int64(y*int(p.hdr.Width)+r.Min.X)*int64(pixSize)
+		if _, err = p.r.ReadAt(data[(y-r.Min.Y)*rowSize:][:rowSize], off); err != nil {
+			return
+		}
+	}
+
+	return decodeRect(p.decoder, data, r, p.config.ColorModel, buf, p.opt)
+}
+
+// decodeRect decodes the pixels of the rectangle r.
+func decodeRect(decoder *pixDecoder, data []byte, r image.Rectangle, model color.Model, buf image_ext.ImageBuffer, opt *Options) (m image.Image, err error) {
+	d := *decoder
+	d.Width, d.Height = r.Dx(), r.Dy()
+	tile, err := d.Decode(data, nil)
+	if err != nil {
+		return
+	}
+	if tile, ok := tile.(*image_ext.MultiBand); ok {
+		// all the tiles share the model of the image
+		if model, ok := model.(*color_ext.MultiBandModel); ok {
+			tile.Model = model
+		}
+	}
+	m = setImageRect(tile, r)
+	if buf != nil && r.In(buf.Bounds()) && buf.ColorModel() == m.ColorModel() {
+		draw_ext.Draw(buf, r, m, r.Min)
+		m = buf.SubImage(r)
+	}
+
+	// convert color model
+	if opt != nil && opt.ColorModel != nil {
+		m = convert.ColorModel(m, opt.ColorModel)
+	}
+	return
+}
+
+func (p *tileReader) Close() error {
+	return nil
+}
+
+type tileReaderV2 struct {
+	r       io.ReaderAt
+	hdr     *rawpHeaderV2
+	index   []uint64 // the offsets of the tiles, and the offset of the index
+	decoder *pixDecoder
+	opt     *Options
+	config  image.Config
+}
+
+func newTileReaderV2(r io.ReaderAt, size int64, opt *Options) (p image_ext.TileReader, err error) {
+	if size < rawpHeaderSizeV2+rawpTrailerSize {
+		err = fmt.Errorf("image/rawp: NewTileReader, bad header.")
+		return
+	}
+	data := make([]byte, rawpHeaderSizeV2)
+	if _, err = r.ReadAt(data, 0); err != nil {
+		return
+	}
+	hdr, err := rawpDecodeHeaderV2(data)
+	if err != nil {
+		return
+	}
+
+	index, err := rawpReadIndexV2(r, size, hdr)
+	if err != nil {
+		return
+	}
+	decoder, err := rawpPixDecoder(hdr.pixHeader())
+	if err != nil {
+		return
+	}
+	model, err := rawpColorModelV2(hdr)
+	if err != nil {
+		return
+	}
+	if opt != nil && opt.ColorModel != nil {
+		model = opt.ColorModel
+	}
+	p = &tileReaderV2{
+		r:       r,
+		hdr:     hdr,
+		index:   index,
+		decoder: decoder,
+		opt:     opt,
+		config:  image.Config{ColorModel: model, Width: int(hdr.Width), Height: int(hdr.Height)},
+	}
+	return
+}
+
+// rawpReadIndexV2 reads the index at the end of the RawP v2 file, the
+// offsets of the tiles and the offset of the index are returned.
+func rawpReadIndexV2(r io.ReaderAt, size int64, hdr *rawpHeaderV2) (index []uint64, err error) {
+	var trailer rawpTrailer
+	if err = binary.Read(io.NewSectionReader(r, size-rawpTrailerSize, rawpTrailerSize), binary.LittleEndian, &trailer); err != nil {
+		return
+	}
+	n := hdr.tileCount()
+	if trailer.EndMagic != rawpMagicV2 || trailer.IndexOffset != uint64(size-rawpTrailerSize-int64(n)*8) {
+		err = fmt.Errorf("image/rawp: NewTileReader, bad index, offset = %v, magic = %x", trailer.IndexOffset, trailer.EndMagic)
+		return
+	}
+	data := make([]byte, n*8)
+	if _, err = r.ReadAt(data, int64(trailer.IndexOffset)); err != nil {
+		return
+	}
+	if v := crc32.ChecksumIEEE(data); v != trailer.IndexCheckSum {
+		err = fmt.Errorf("image/rawp: bad IndexCheckSum, expect = %x, got = %x", trailer.IndexCheckSum, v)
+		return
+	}
+	index = make([]uint64, n+1)
+	for i := 0; i < n; i++ {
+		index[i] = binary.LittleEndian.Uint64(data[i*8:])
+	}
+	index[n] = trailer.IndexOffset
+	for i := 0; i < n; i++ {
+		if index[i] < uint64(hdr.HeaderSize) || index[i]+rawpTileFrameSize > index[i+1] {
+			err = fmt.Errorf("image/rawp: NewTileReader, bad tile offset, %v, tile %d", index[i], i)
+			return nil, err
+		}
+	}
+	return
+}
+
+func (p *tileReaderV2) Config() image.Config {
+	return p.config
+}
+
+// readTile reads the pixels of the tile i.
+func (p *tileReaderV2) readTile(i int) (pix []byte, err error) {
+	r := p.hdr.tileRect(i)
+	size := r.Dx() * r.Dy() * p.hdr.pixelSize()
+	n := p.index[i+1] - p.index[i]
+	if n > uint64(rawpTileFrameSize+rawpMaxTileDataSize(size)) {
+		return nil, fmt.Errorf("image/rawp: bad DataSize, %v, tile %d", n-rawpTileFrameSize, i)
+	}
+	frame := make([]byte, n)
+	if _, err = p.r.ReadAt(frame, int64(p.index[i])); err != nil {
+		return
+	}
+	return rawpDecodeTile(p.hdr, i, frame)
+}
+
+func (p *tileReaderV2) ReadRect(r image.Rectangle, buf image_ext.ImageBuffer) (m image.Image, err error) {
+	r = r.Intersect(image.Rect(0, 0, int(p.hdr.Width), int(p.hdr.Height)))
+	if r.Empty() {
+		err = fmt.Errorf("image/rawp: ReadRect, empty rect: %v", r)
+		return
+	}
+
+	pixSize := p.hdr.pixelSize()
+	rowSize := r.Dx() * pixSize
+	data := make([]byte, rowSize*r.Dy())
+	tw, th := int(p.hdr.TileWidth), int(p.hdr.TileHeight)
+	for ty := r.Min.Y / th; ty*th < r.Max.Y; ty++ {
+		for tx := r.Min.X / tw; tx*tw < r.Max.X; tx++ {
+			i := ty*p.hdr.tilesAcross() + tx
+			tile, err := p.readTile(i)
+			if err != nil {
+				return nil, err
+			}
+			tr := p.hdr.tileRect(i)
+			ir := tr.Intersect(r)
+			n := ir.Dx() * pixSize
+			for y := ir.Min.Y; y < ir.Max.Y; y++ {
+				src := tile[((y-tr.Min.Y)*tr.Dx()+ir.Min.X-tr.Min.X)*pixSize:]
+				copy(data[(y-r.Min.Y)*rowSize+(ir.Min.X-r.Min.X)*pixSize:][:n], src)
+			}
+		}
+	}
+	return decodeRect(p.decoder, data, r, p.config.ColorModel, buf, p.opt)
+}
+
+func (p *tileReaderV2) Close() error {
+	return nil
+}
+
+func imageExtNewTileReader(r io.ReaderAt, size int64, opt *image_ext.Options) (image_ext.TileReader, error) {
+	p, err := newOptions(opt)
+	if err != nil {
+		return nil, err
+	}
+	return NewTileReader(r, size, p)
+}
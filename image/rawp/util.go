@@ -9,6 +9,7 @@ import (
 	"reflect"
 
 	image_ext "github.com/chai2010/gopkg/image"
+	color_ext "github.com/chai2010/gopkg/image/color"
 )
 
 func defaultDepthKind(depth int) reflect.Kind {
@@ -110,3 +111,111 @@ func newRGBA128f(r image.Rectangle, buf image_ext.ImageBuffer) *image_ext.RGBA12
 	}
 	return image_ext.NewRGBA128f(r)
 }
+
+func newGray16s(r image.Rectangle, buf image_ext.ImageBuffer) *image_ext.Gray16s {
+	if buf != nil && r.In(buf.Bounds()) {
+		if m, ok := buf.SubImage(r).(*image_ext.Gray16s); ok {
+			return m
+		}
+	}
+	return image_ext.NewGray16s(r)
+}
+
+func newGray32i(r image.Rectangle, buf image_ext.ImageBuffer) *image_ext.Gray32i {
+	if buf != nil && r.In(buf.Bounds()) {
+		if m, ok := buf.SubImage(r).(*image_ext.Gray32i); ok {
+			return m
+		}
+	}
+	return image_ext.NewGray32i(r)
+}
+
+func newGray64f(r image.Rectangle, buf image_ext.ImageBuffer) *image_ext.Gray64f {
+	if buf != nil && r.In(buf.Bounds()) {
+		if m, ok := buf.SubImage(r).(*image_ext.Gray64f); ok {
+			return m
+		}
+	}
+	return image_ext.NewGray64f(r)
+}
+
+func newRGB48s(r image.Rectangle, buf image_ext.ImageBuffer) *image_ext.RGB48s {
+	if buf != nil && r.In(buf.Bounds()) {
+		if m, ok := buf.SubImage(r).(*image_ext.RGB48s); ok {
+			return m
+		}
+	}
+	return image_ext.NewRGB48s(r)
+}
+
+func newRGB96i(r image.Rectangle, buf image_ext.ImageBuffer) *image_ext.RGB96i {
+	if buf != nil && r.In(buf.Bounds()) {
+		if m, ok := buf.SubImage(r).(*image_ext.RGB96i); ok {
+			return m
+		}
+	}
+	return image_ext.NewRGB96i(r)
+}
+
+func newRGB192f(r image.Rectangle, buf image_ext.ImageBuffer) *image_ext.RGB192f {
+	if buf != nil && r.In(buf.Bounds()) {
+		if m, ok := buf.SubImage(r).(*image_ext.RGB192f); ok {
+			return m
+		}
+	}
+	return image_ext.NewRGB192f(r)
+}
+
+func newMultiBand(r image.Rectangle, model *color_ext.MultiBandModel, buf image_ext.ImageBuffer) *image_ext.MultiBand {
+	if buf != nil && r.In(buf.Bounds()) {
+		if m, ok := buf.SubImage(r).(*image_ext.MultiBand); ok && m.Model.SameLayout(model) {
+			return m
+		}
+	}
+	return image_ext.NewMultiBand(r, model)
+}
+
+// isMultiBandDataType reports whether the data type can be used by the
+// bands of MultiBand images.
+func isMultiBandDataType(dataType reflect.Kind) bool {
+	return color_ext.BandInfo{DataType: dataType}.Size() != 0
+}
+
+// setImageRect moves the bounds of m to r, the size must be same.
+func setImageRect(m image.Image, r image.Rectangle) image.Image {
+	switch m := m.(type) {
+	case *image.Gray:
+		m.Rect = r
+	case *image.Gray16:
+		m.Rect = r
+	case *image_ext.Gray32f:
+		m.Rect = r
+	case *image_ext.RGB:
+		m.Rect = r
+	case *image_ext.RGB48:
+		m.Rect = r
+	case *image_ext.RGB96f:
+		m.Rect = r
+	case *image.RGBA:
+		m.Rect = r
+	case *image.RGBA64:
+		m.Rect = r
+	case *image_ext.RGBA128f:
+		m.Rect = r
+	case *image_ext.Gray16s:
+		m.Rect = r
+	case *image_ext.Gray32i:
+		m.Rect = r
+	case *image_ext.Gray64f:
+		m.Rect = r
+	case *image_ext.RGB48s:
+		m.Rect = r
+	case *image_ext.RGB96i:
+		m.Rect = r
+	case *image_ext.RGB192f:
+		m.Rect = r
+	case *image_ext.MultiBand:
+		m.Rect = r
+	}
+	return m
+}
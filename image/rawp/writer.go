@@ -5,6 +5,8 @@
 package rawp
 
 import (
+	"encoding/binary"
+	"fmt"
 	"hash/crc32"
 	"image"
 	"image/color"
@@ -16,17 +18,33 @@ import (
 	"github.com/chai2010/gopkg/image/convert"
 )
 
+// Encode writes the image m to w in RawP format. The image is written in
+// RawP v2 format, or v1 format if opt.Version is 1. RawP v1 only supports
+// the snappy compression without predictor.
 func Encode(w io.Writer, m image.Image, opt *Options) (err error) {
 	if opt != nil && opt.ColorModel != nil {
 		m = convert.ColorModel(m, opt.ColorModel)
 	}
 	m = adjustImage(m)
 
-	var useSnappy bool
-	if opt != nil {
-		useSnappy = opt.UseSnappy
+	if opt != nil && opt.Version == 1 {
+		if opt.Codec != CodecNone && opt.Codec != CodecSnappy || opt.Predictor != PredictorNone {
+			return fmt.Errorf("image/rawp: RawP v1 doesn't support Codec %v and Predictor %v", opt.Codec, opt.Predictor)
+		}
+		return encodeV1(w, m, opt.UseSnappy || opt.Codec == CodecSnappy, opt.Progress)
+	}
+	b := m.Bounds()
+	enc, err := NewWriter(w, image.Config{ColorModel: m.ColorModel(), Width: b.Dx(), Height: b.Dy()}, opt)
+	if err != nil {
+		return
 	}
+	if err = enc.WriteRows(m); err != nil {
+		return
+	}
+	return enc.Close()
+}
 
+func encodeV1(w io.Writer, m image.Image, useSnappy bool, fn image_ext.ProgressFunc) (err error) {
 	hdr, err := rawpMakeHeader(m.Bounds().Dx(), m.Bounds().Dy(), m.ColorModel(), useSnappy)
 	if err != nil {
 		return
@@ -48,6 +66,10 @@ func Encode(w io.Writer, m image.Image, opt *Options) (err error) {
 		}
 	}
 
+	if !image_ext.NewProgress(fn, 1).Step(1) {
+		return image_ext.ErrCanceled
+	}
+
 	hdr.DataSize = uint32(len(pix))
 	hdr.DataCheckSum = crc32.ChecksumIEEE(pix)
 	hdr.Data = pix
@@ -61,6 +83,176 @@ func Encode(w io.Writer, m image.Image, opt *Options) (err error) {
 	return
 }
 
+// Writer writes a RawP v2 image row by row, only a row of tiles is held
+// in memory.
+type Writer struct {
+	w        io.Writer
+	hdr      *rawpHeaderV2
+	encoder  *pixEncoder
+	pixSize  int
+	rows     []byte   // the pixels of the current row of tiles
+	y        int      // the next row
+	offset   uint64   // the bytes written
+	index    []uint64 // the offsets of the written tiles
+	progress *image_ext.Progress
+	err      error
+	buf, tmp []byte
+}
+
+// NewWriter returns a Writer which writes an image of config to w. The
+// tile size is taken from opt, and the pixels are stored in the color
+// model of config, the opt.ColorModel and opt.Version are ignored.
+func NewWriter(w io.Writer, config image.Config, opt *Options) (p *Writer, err error) {
+	tileWidth, tileHeight := DefaultTileSize, DefaultTileSize
+	codec, predictor := CodecNone, PredictorNone
+	var progressFunc image_ext.ProgressFunc
+	if opt != nil {
+		if opt.TileWidth != 0 {
+			tileWidth = opt.TileWidth
+		}
+		if opt.TileHeight != 0 {
+			tileHeight = opt.TileHeight
+		}
+		if codec = opt.Codec; codec == CodecNone && opt.UseSnappy {
+			codec = CodecSnappy
+		}
+		predictor = opt.Predictor
+		progressFunc = opt.Progress
+	}
+	if tileWidth < 0 || tileHeight < 0 {
+		err = fmt.Errorf("image/rawp: NewWriter, bad tile size, width = %v, height = %v", tileWidth, tileHeight)
+		return
+	}
+	hdr, err := rawpMakeHeaderV2(config, tileWidth, tileHeight, codec, predictor)
+	if err != nil {
+		return
+	}
+	encoder, err := rawpPixEncoder(hdr.pixHeader())
+	if err != nil {
+		return
+	}
+	data := rawpEncodeHeaderV2(hdr)
+	if _, err = w.Write(data); err != nil {
+		return
+	}
+
+	p = &Writer{
+		w:        w,
+		hdr:      hdr,
+		encoder:  encoder,
+		pixSize:  hdr.pixelSize(),
+		offset:   uint64(len(data)),
+		index:    make([]uint64, 0, hdr.tileCount()),
+		progress: image_ext.NewProgress(progressFunc, hdr.tileCount()),
+	}
+	p.rows = make([]byte, p.rowSize()*int(hdr.TileHeight))
+	return
+}
+
+func (p *Writer) rowSize() int {
+	return int(p.hdr.Width) * p.pixSize
+}
+
+// WriteRows writes the pixels of m as the next m.Bounds().Dy() rows of
+// the image, the width of m must be the image width. A row of tiles is
+// written when its last row is written.
+func (p *Writer) WriteRows(m image.Image) (err error) {
+	if p.err != nil {
+		return p.err
+	}
+	b := m.Bounds()
+	if b.Dx() != int(p.hdr.Width) || p.y+b.Dy() > int(p.hdr.Height) {
+		return fmt.Errorf("image/rawp: WriteRows, bad rect: %v, image size = %dx%d, next row = %d",
+			b, p.hdr.Width, p.hdr.Height, p.y,
+		)
+	}
+	if b.Empty() {
+		return
+	}
+	if m, ok := m.(*image_ext.MaskedImage); ok {
+		return p.WriteRows(m.Image)
+	}
+
+	if p.buf, err = p.encoder.Encode(m, p.buf); err != nil {
+		p.err = err
+		return
+	}
+	rowSize, tileHeight := p.rowSize(), int(p.hdr.TileHeight)
+	for src := p.buf; len(src) > 0; src = src[rowSize:] {
+		copy(p.rows[p.y%tileHeight*rowSize:][:rowSize], src)
+		if p.y++; p.y%tileHeight == 0 || p.y == int(p.hdr.Height) {
+			if err = p.writeTiles(); err != nil {
+				p.err = err
+				return
+			}
+		}
+	}
+	return
+}
+
+// writeTiles writes the tiles of the current row of tiles.
+func (p *Writer) writeTiles() (err error) {
+	rowSize := p.rowSize()
+	for i := len(p.index); i < p.hdr.tileCount(); i++ {
+		r := p.hdr.tileRect(i)
+		if r.Max.Y > p.y {
+			break
+		}
+		tileRowSize := r.Dx() * p.pixSize
+		p.tmp = newBytes(tileRowSize*r.Dy(), p.tmp)
+		for y := 0; y < r.Dy(); y++ {
+			copy(p.tmp[y*tileRowSize:][:tileRowSize], p.rows[y*rowSize+r.Min.X*p.pixSize:])
+		}
+		data, err := rawpEncodeTile(p.hdr, i, p.tmp)
+		if err != nil {
+			return err
+		}
+
+		var frame [rawpTileFrameSize]byte
+		binary.LittleEndian.PutUint32(frame[0:], uint32(len(data)))
+		binary.LittleEndian.PutUint32(frame[4:], crc32.ChecksumIEEE(data))
+		if _, err = p.w.Write(frame[:]); err != nil {
+			return err
+		}
+		if _, err = p.w.Write(data); err != nil {
+			return err
+		}
+		p.index = append(p.index, p.offset)
+		p.offset += uint64(len(frame) + len(data))
+		if !p.progress.Step(1) {
+			return image_ext.ErrCanceled
+		}
+	}
+	return
+}
+
+// Close writes the tile offsets and the end of the image, all the rows
+// must have been written. It doesn't close the underlying writer.
+func (p *Writer) Close() (err error) {
+	if p.err != nil {
+		return p.err
+	}
+	if p.y != int(p.hdr.Height) {
+		p.err = fmt.Errorf("image/rawp: Writer.Close, missing rows, %d of %d are written", p.y, p.hdr.Height)
+		return p.err
+	}
+	p.err = fmt.Errorf("image/rawp: Writer is closed")
+
+	index := make([]byte, len(p.index)*8)
+	for i, off := range p.index {
+		binary.LittleEndian.PutUint64(index[i*8:], off)
+	}
+	trailer := rawpTrailer{
+		IndexOffset:   p.offset,
+		IndexCheckSum: crc32.ChecksumIEEE(index),
+		EndMagic:      rawpMagicV2,
+	}
+	if _, err = p.w.Write(index); err != nil {
+		return
+	}
+	return binary.Write(p.w, binary.LittleEndian, &trailer)
+}
+
 func adjustImage(m image.Image) image.Image {
 	switch m := m.(type) {
 	case *image.Gray, *image.Gray16, *image_ext.Gray32f:
@@ -69,6 +261,15 @@ func adjustImage(m image.Image) image.Image {
 		return m
 	case *image.RGBA, *image.RGBA64, *image_ext.RGBA128f:
 		return m
+	case *image_ext.Gray16s, *image_ext.Gray32i, *image_ext.Gray64f:
+		return m
+	case *image_ext.RGB48s, *image_ext.RGB96i, *image_ext.RGB192f:
+		return m
+	case *image_ext.MultiBand:
+		return m
+	case *image_ext.MaskedImage:
+		// the nodata pixels are zero
+		return adjustImage(m.Image)
 	default:
 		b := m.Bounds()
 		rgba := image.NewRGBA(b)
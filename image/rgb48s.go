@@ -0,0 +1,101 @@
+// Copyright 2014 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package image
+
+import (
+	"image"
+	"image/color"
+
+	"github.com/chai2010/gopkg/builtin"
+	color_ext "github.com/chai2010/gopkg/image/color"
+)
+
+// RGB48s is an in-memory image whose At method returns color.RGB48s values.
+type RGB48s struct {
+	// Pix holds the image's pixels. The pixel at (x, y) starts at
+	// Pix[(y-Rect.Min.Y)*Stride + (x-Rect.Min.X)*6].
+	Pix []byte
+	// Stride is the Pix stride between vertically adjacent pixels.
+	Stride int
+	// Rect is the image's bounds.
+	Rect image.Rectangle
+}
+
+func (p *RGB48s) ColorModel() color.Model { return color_ext.RGB48sModel }
+
+func (p *RGB48s) Bounds() image.Rectangle { return p.Rect }
+
+func (p *RGB48s) At(x, y int) color.Color {
+	return p.RGB48sAt(x, y)
+}
+
+func (p *RGB48s) RGB48sAt(x, y int) color_ext.RGB48s {
+	if !(image.Point{x, y}.In(p.Rect)) {
+		return color_ext.RGB48s{}
+	}
+	i := p.PixOffset(x, y)
+	return color_ext.RGB48s{
+		R: int16(builtin.Uint16(p.Pix[i+0:])),
+		G: int16(builtin.Uint16(p.Pix[i+2:])),
+		B: int16(builtin.Uint16(p.Pix[i+4:])),
+	}
+}
+
+// PixOffset returns the index of the first element of Pix that corresponds to
+// the pixel at (x, y).
+func (p *RGB48s) PixOffset(x, y int) int {
+	return (y-p.Rect.Min.Y)*p.Stride + (x-p.Rect.Min.X)*6
+}
+
+func (p *RGB48s) Set(x, y int, c color.Color) {
+	if !(image.Point{x, y}.In(p.Rect)) {
+		return
+	}
+	i := p.PixOffset(x, y)
+	c1 := color_ext.RGB48sModel.Convert(c).(color_ext.RGB48s)
+	builtin.PutUint16(p.Pix[i+0:], uint16(c1.R))
+	builtin.PutUint16(p.Pix[i+2:], uint16(c1.G))
+	builtin.PutUint16(p.Pix[i+4:], uint16(c1.B))
+}
+
+func (p *RGB48s) SetRGB48s(x, y int, c color_ext.RGB48s) {
+	if !(image.Point{x, y}.In(p.Rect)) {
+		return
+	}
+	i := p.PixOffset(x, y)
+	builtin.PutUint16(p.Pix[i+0:], uint16(c.R))
+	builtin.PutUint16(p.Pix[i+2:], uint16(c.G))
+	builtin.PutUint16(p.Pix[i+4:], uint16(c.B))
+}
+
+// SubImage returns an image representing the portion of the image p visible
+// through r. The returned value shares pixels with the original image.
+func (p *RGB48s) SubImage(r image.Rectangle) image.Image {
+	r = r.Intersect(p.Rect)
+	// If r1 and r2 are Rectangles, r1.Intersect(r2) is not guaranteed to be inside
+	// either r1 or r2 if the intersection is empty. Without explicitly checking for
+	// this, the Pix[i:] expression below can panic.
+	if r.Empty() {
+		return &RGB48s{}
+	}
+	i := p.PixOffset(r.Min.X, r.Min.Y)
+	return &RGB48s{
+		Pix:    p.Pix[i:],
+		Stride: p.Stride,
+		Rect:   r,
+	}
+}
+
+// Opaque scans the entire image and reports whether it is fully opaque.
+func (p *RGB48s) Opaque() bool {
+	return true
+}
+
+// NewRGB48s returns a new RGB48s with the given bounds.
+func NewRGB48s(r image.Rectangle) *RGB48s {
+	w, h := r.Dx(), r.Dy()
+	pix := make([]byte, w*h*6)
+	return &RGB48s{pix, w * 6, r}
+}
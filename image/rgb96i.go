@@ -0,0 +1,101 @@
+// Copyright 2014 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package image
+
+import (
+	"image"
+	"image/color"
+
+	"github.com/chai2010/gopkg/builtin"
+	color_ext "github.com/chai2010/gopkg/image/color"
+)
+
+// RGB96i is an in-memory image whose At method returns color.RGB96i values.
+type RGB96i struct {
+	// Pix holds the image's pixels. The pixel at (x, y) starts at
+	// Pix[(y-Rect.Min.Y)*Stride + (x-Rect.Min.X)*12].
+	Pix []byte
+	// Stride is the Pix stride between vertically adjacent pixels.
+	Stride int
+	// Rect is the image's bounds.
+	Rect image.Rectangle
+}
+
+func (p *RGB96i) ColorModel() color.Model { return color_ext.RGB96iModel }
+
+func (p *RGB96i) Bounds() image.Rectangle { return p.Rect }
+
+func (p *RGB96i) At(x, y int) color.Color {
+	return p.RGB96iAt(x, y)
+}
+
+func (p *RGB96i) RGB96iAt(x, y int) color_ext.RGB96i {
+	if !(image.Point{x, y}.In(p.Rect)) {
+		return color_ext.RGB96i{}
+	}
+	i := p.PixOffset(x, y)
+	return color_ext.RGB96i{
+		R: int32(builtin.Uint32(p.Pix[i+0:])),
+		G: int32(builtin.Uint32(p.Pix[i+4:])),
+		B: int32(builtin.Uint32(p.Pix[i+8:])),
+	}
+}
+
+// PixOffset returns the index of the first element of Pix that corresponds to
+// the pixel at (x, y).
+func (p *RGB96i) PixOffset(x, y int) int {
+	return (y-p.Rect.Min.Y)*p.Stride + (x-p.Rect.Min.X)*12
+}
+
+func (p *RGB96i) Set(x, y int, c color.Color) {
+	if !(image.Point{x, y}.In(p.Rect)) {
+		return
+	}
+	i := p.PixOffset(x, y)
+	c1 := color_ext.RGB96iModel.Convert(c).(color_ext.RGB96i)
+	builtin.PutUint32(p.Pix[i+0:], uint32(c1.R))
+	builtin.PutUint32(p.Pix[i+4:], uint32(c1.G))
+	builtin.PutUint32(p.Pix[i+8:], uint32(c1.B))
+}
+
+func (p *RGB96i) SetRGB96i(x, y int, c color_ext.RGB96i) {
+	if !(image.Point{x, y}.In(p.Rect)) {
+		return
+	}
+	i := p.PixOffset(x, y)
+	builtin.PutUint32(p.Pix[i+0:], uint32(c.R))
+	builtin.PutUint32(p.Pix[i+4:], uint32(c.G))
+	builtin.PutUint32(p.Pix[i+8:], uint32(c.B))
+}
+
+// SubImage returns an image representing the portion of the image p visible
+// through r. The returned value shares pixels with the original image.
+func (p *RGB96i) SubImage(r image.Rectangle) image.Image {
+	r = r.Intersect(p.Rect)
+	// If r1 and r2 are Rectangles, r1.Intersect(r2) is not guaranteed to be inside
+	// either r1 or r2 if the intersection is empty. Without explicitly checking for
+	// this, the Pix[i:] expression below can panic.
+	if r.Empty() {
+		return &RGB96i{}
+	}
+	i := p.PixOffset(r.Min.X, r.Min.Y)
+	return &RGB96i{
+		Pix:    p.Pix[i:],
+		Stride: p.Stride,
+		Rect:   r,
+	}
+}
+
+// Opaque scans the entire image and reports whether it is fully opaque.
+func (p *RGB96i) Opaque() bool {
+	return true
+}
+
+// NewRGB96i returns a new RGB96i with the given bounds.
+func NewRGB96i(r image.Rectangle) *RGB96i {
+	w, h := r.Dx(), r.Dy()
+	pix := make([]byte, w*h*12)
+	return &RGB96i{pix, w * 12, r}
+}
@@ -0,0 +1,284 @@
+// Copyright 2014 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package terrain
+
+import (
+	"image"
+	"math"
+	"sort"
+
+	"github.com/chai2010/gopkg/builtin"
+	image_ext "github.com/chai2010/gopkg/image"
+)
+
+// Point is a point of the contour lines in the pixel coordinates, the
+// value of the cell (x, y) is at (x+0.5, y+0.5).
+type Point struct {
+	X, Y float64
+}
+
+// Contour is the contour lines of a level.
+type Contour struct {
+	Level float64
+	Lines [][]Point // the polylines, the closed lines end with the first point
+}
+
+// Transform converts the points to the world coordinates.
+func (p *Contour) Transform(gt image_ext.GeoTransform) {
+	for _, line := range p.Lines {
+		for i, pt := range line {
+			line[i].X, line[i].Y = gt.PixelToWorld(pt.X, pt.Y)
+		}
+	}
+}
+
+// ContourLevels returns the levels base + k*interval between min and max.
+func ContourLevels(min, max, interval, base float64) (levels []float64) {
+	if !(interval > 0) || !(min <= max) {
+		return
+	}
+	k0 := math.Ceil((min - base) / interval)
+	k1 := math.Floor((max - base) / interval)
+	for k := k0; k <= k1; k++ {
+		levels = append(levels, base+k*interval)
+	}
+	return
+}
+
+// Contours returns the contour lines of src at the levels base +
+// k*interval, the levels without lines are omitted. The cells which have
+// nodata corners are skipped.
+func Contours(src *image_ext.Gray32f, interval, base float64, opt *Options) []Contour {
+	p := newOptions(opt)
+	min, max, ok := p.minMax(src)
+	if !ok {
+		return nil
+	}
+	return p.contours(src, ContourLevels(min, max, interval, base))
+}
+
+// ContoursAt returns the contour lines of src at the levels, see Contours.
+func ContoursAt(src *image_ext.Gray32f, levels []float64, opt *Options) []Contour {
+	return newOptions(opt).contours(src, levels)
+}
+
+func (p *options) contours(src *image_ext.Gray32f, levels []float64) []Contour {
+	c := newContourBuilder(levels)
+	c.addCells(src, src.Bounds(), p)
+	return c.contours()
+}
+
+// minMax returns the range of the valid cells of src.
+func (p *options) minMax(src *image_ext.Gray32f) (min, max float64, ok bool) {
+	b := src.Bounds()
+	min, max = math.Inf(1), math.Inf(-1)
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		off := src.PixOffset(b.Min.X, y)
+		for x := b.Min.X; x < b.Max.X; x++ {
+			if v := builtin.Float32(src.Pix[off:]); !p.isNoData(v) {
+				min, max = math.Min(min, float64(v)), math.Max(max, float64(v))
+			}
+			off += 4
+		}
+	}
+	ok = min <= max
+	return
+}
+
+// contourEdge is the edge between the cells (X, Y) and (X+1, Y), or the
+// cells (X, Y) and (X, Y+1) if Down is true.
+type contourEdge struct {
+	X, Y int
+	Down bool
+}
+
+type contourSegment struct {
+	A, B contourEdge
+}
+
+// contourCases are the edges of the segments of a square by the corners
+// above the level, the corners are 1 top-left, 2 top-right, 4 bottom-right
+// and 8 bottom-left, the edges are 0 top, 1 right, 2 bottom and 3 left.
+// The saddles 5 and 10 are the cases whose center is below the level.
+var contourCases = [16][][2]int{
+	1:  {{3, 0}},
+	2:  {{0, 1}},
+	3:  {{3, 1}},
+	4:  {{1, 2}},
+	5:  {{3, 0}, {1, 2}},
+	6:  {{0, 2}},
+	7:  {{3, 2}},
+	8:  {{2, 3}},
+	9:  {{0, 2}},
+	10: {{0, 1}, {2, 3}},
+	11: {{1, 2}},
+	12: {{3, 1}},
+	13: {{0, 1}},
+	14: {{3, 0}},
+}
+
+// contourLevel is the segments of a level, the segments are joined by
+// the shared edges.
+type contourLevel struct {
+	Level    float64
+	Segments []contourSegment
+	Points   map[contourEdge]Point
+}
+
+// contourBuilder is the marching squares of the sorted levels, the cells
+// can be added tile by tile.
+type contourBuilder struct {
+	levels []*contourLevel
+	values []float64
+}
+
+func newContourBuilder(levels []float64) *contourBuilder {
+	values := append([]float64(nil), levels...)
+	sort.Float64s(values)
+	p := &contourBuilder{values: values}
+	for _, v := range values {
+		p.levels = append(p.levels, &contourLevel{
+			Level:  v,
+			Points: make(map[contourEdge]Point),
+		})
+	}
+	return p
+}
+
+// addCells adds the squares whose top-left corners are in r, the corners
+// out of the bounds of src are skipped.
+func (p *contourBuilder) addCells(src *image_ext.Gray32f, r image.Rectangle, opt *options) {
+	b := src.Bounds()
+	r = r.Intersect(image.Rect(b.Min.X, b.Min.Y, b.Max.X-1, b.Max.Y-1))
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			var v [4]float64 // top-left, top-right, bottom-right, bottom-left
+			var ok = true
+			for i, pt := range [4]image.Point{{x, y}, {x + 1, y}, {x + 1, y + 1}, {x, y + 1}} {
+				f := builtin.Float32(src.Pix[src.PixOffset(pt.X, pt.Y):])
+				if opt.isNoData(f) {
+					ok = false
+					break
+				}
+				v[i] = float64(f)
+			}
+			if ok {
+				p.addCell(x, y, v)
+			}
+		}
+	}
+}
+
+func (p *contourBuilder) addCell(x, y int, v [4]float64) {
+	min := math.Min(math.Min(v[0], v[1]), math.Min(v[2], v[3]))
+	max := math.Max(math.Max(v[0], v[1]), math.Max(v[2], v[3]))
+	i := sort.Search(len(p.values), func(i int) bool { return p.values[i] > min })
+	for ; i < len(p.values) && p.values[i] <= max; i++ {
+		level := p.levels[i]
+		var n int
+		for k := 0; k < 4; k++ {
+			if v[k] >= level.Level {
+				n |= 1 << uint(k)
+			}
+		}
+		edges := [4]contourEdge{{x, y, false}, {x + 1, y, true}, {x, y + 1, false}, {x, y, true}}
+		values := [4][2]float64{{v[0], v[1]}, {v[1], v[2]}, {v[3], v[2]}, {v[0], v[3]}}
+		cases := contourCases[n]
+		if (n == 5 || n == 10) && (v[0]+v[1]+v[2]+v[3])/4 >= level.Level {
+			cases = contourCases[15-n]
+		}
+		for _, c := range cases {
+			a, b := edges[c[0]], edges[c[1]]
+			level.addPoint(a, values[c[0]])
+			level.addPoint(b, values[c[1]])
+			level.Segments = append(level.Segments, contourSegment{a, b})
+		}
+	}
+}
+
+// addPoint adds the crossing point of the edge e, v are the values of the
+// edge's cells.
+func (p *contourLevel) addPoint(e contourEdge, v [2]float64) {
+	if _, ok := p.Points[e]; ok {
+		return
+	}
+	t := (p.Level - v[0]) / (v[1] - v[0])
+	if e.Down {
+		p.Points[e] = Point{float64(e.X) + 0.5, float64(e.Y) + 0.5 + t}
+	} else {
+		p.Points[e] = Point{float64(e.X) + 0.5 + t, float64(e.Y) + 0.5}
+	}
+}
+
+func (p *contourBuilder) contours() (contours []Contour) {
+	for _, level := range p.levels {
+		if lines := level.lines(); len(lines) > 0 {
+			contours = append(contours, Contour{Level: level.Level, Lines: lines})
+		}
+	}
+	return
+}
+
+// lines joins the segments to the polylines, an edge is shared by two
+// segments at most.
+func (p *contourLevel) lines() (lines [][]Point) {
+	links := make(map[contourEdge][]int, len(p.Points))
+	for i, s := range p.Segments {
+		links[s.A] = append(links[s.A], i)
+		links[s.B] = append(links[s.B], i)
+	}
+	used := make([]bool, len(p.Segments))
+
+	// walk returns the edges from e, the segment i is the previous one.
+	walk := func(e contourEdge, i int) (edges []contourEdge, closed bool) {
+		for {
+			next := -1
+			for _, k := range links[e] {
+				if k != i && !used[k] {
+					next = k
+					break
+				}
+			}
+			if next < 0 {
+				for _, k := range links[e] {
+					if k != i && used[k] {
+						closed = true
+					}
+				}
+				return
+			}
+			used[next] = true
+			if s := p.Segments[next]; s.A == e {
+				e = s.B
+			} else {
+				e = s.A
+			}
+			edges = append(edges, e)
+			i = next
+		}
+	}
+
+	for i, s := range p.Segments {
+		if used[i] {
+			continue
+		}
+		used[i] = true
+		tail, closed := walk(s.B, i)
+		var head []contourEdge
+		if !closed {
+			head, _ = walk(s.A, i)
+		}
+		line := make([]Point, 0, len(head)+len(tail)+2)
+		for k := len(head) - 1; k >= 0; k-- {
+			line = append(line, p.Points[head[k]])
+		}
+		line = append(line, p.Points[s.A], p.Points[s.B])
+		for _, e := range tail {
+			line = append(line, p.Points[e])
+		}
+		lines = append(lines, line)
+	}
+	return
+}
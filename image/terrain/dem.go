@@ -0,0 +1,122 @@
+// Copyright 2014 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package terrain
+
+import (
+	"fmt"
+	"image"
+	"math"
+
+	image_ext "github.com/chai2010/gopkg/image"
+	"github.com/chai2010/gopkg/image/big"
+)
+
+// demOptions returns the options of src, the zero cell size and the nil
+// NoData of opt are taken from src.
+func demOptions(src *big.Dem, opt *Options) *options {
+	var v Options
+	if opt != nil {
+		v = *opt
+	}
+	if v.CellWidth == 0 && !src.GeoTransform.IsZero() {
+		v.CellWidth, v.CellHeight = src.Resolution(-1)
+	}
+	if v.NoData == nil {
+		v.NoData = src.NoData
+	}
+	return newOptions(&v)
+}
+
+// forEachDemTile calls fn with the tiles of the max level of src, buf is
+// the tile r and its neighbor cells in the border of the Dem.
+func forEachDemTile(src *big.Dem, border image.Rectangle, fn func(buf *image_ext.Gray32f, r image.Rectangle) error) (err error) {
+	b, size := src.Bounds(), src.TileSize
+	for y := b.Min.Y / size.Y * size.Y; y < b.Max.Y; y += size.Y {
+		for x := b.Min.X / size.X * size.X; x < b.Max.X; x += size.X {
+			r := image.Rect(x, y, x+size.X, y+size.Y).Intersect(b)
+			rr := image.Rectangle{r.Min.Add(border.Min), r.Max.Add(border.Max)}.Intersect(b)
+			buf, err := src.ReadRect(-1, rr, nil)
+			if err != nil {
+				return err
+			}
+			buf.Rect = rr
+			if err = fn(buf, r); err != nil {
+				return err
+			}
+		}
+	}
+	return
+}
+
+// DemSlope writes the slope of src to dst, see Slope. The CellWidth and
+// CellHeight are the resolution of src if they are zero, and the NoData is
+// the NoData of src if it is nil.
+func DemSlope(dst, src *big.Dem, opt *Options) error {
+	return demFloat(dst, src, demOptions(src, opt), "DemSlope", (*options).slopeImage)
+}
+
+// DemAspect writes the aspect of src to dst, see Aspect and DemSlope.
+func DemAspect(dst, src *big.Dem, opt *Options) error {
+	return demFloat(dst, src, demOptions(src, opt), "DemAspect", (*options).aspectImage)
+}
+
+func demFloat(dst, src *big.Dem, p *options, name string, fn func(p *options, src *image_ext.Gray32f, r image.Rectangle) *image_ext.Gray32f) error {
+	if dst.Bounds() != src.Bounds() {
+		return fmt.Errorf("image/terrain: %s, bad bounds: dst = %v, src = %v", name, dst.Bounds(), src.Bounds())
+	}
+	return forEachDemTile(src, image.Rect(-1, -1, 1, 1), func(buf *image_ext.Gray32f, r image.Rectangle) error {
+		m := fn(p, buf, r)
+		m.Rect = m.Rect.Sub(r.Min)
+		return dst.WriteRect(-1, r, m)
+	})
+}
+
+// DemHillshade writes the hillshade of src to dst, see Hillshade and
+// DemSlope. The color model of dst should be Gray.
+func DemHillshade(dst *big.Image, src *big.Dem, opt *Options) error {
+	if dst.Bounds() != src.Bounds() {
+		return fmt.Errorf("image/terrain: DemHillshade, bad bounds: dst = %v, src = %v", dst.Bounds(), src.Bounds())
+	}
+	p := demOptions(src, opt)
+	return forEachDemTile(src, image.Rect(-1, -1, 1, 1), func(buf *image_ext.Gray32f, r image.Rectangle) error {
+		m := p.hillshadeImage(buf, r)
+		m.Rect = m.Rect.Sub(r.Min)
+		return dst.WriteRect(-1, r, m)
+	})
+}
+
+// DemContours returns the contour lines of src, see Contours and DemSlope.
+// The points are the pixel coordinates of the max level, the
+// Contour.Transform converts them to the world coordinates.
+func DemContours(src *big.Dem, interval, base float64, opt *Options) (contours []Contour, err error) {
+	p := demOptions(src, opt)
+	min, max := math.Inf(1), math.Inf(-1)
+	err = forEachDemTile(src, image.Rectangle{}, func(buf *image_ext.Gray32f, r image.Rectangle) error {
+		if v0, v1, ok := p.minMax(buf); ok {
+			min, max = math.Min(min, v0), math.Max(max, v1)
+		}
+		return nil
+	})
+	if err != nil || min > max {
+		return
+	}
+	return DemContoursAt(src, ContourLevels(min, max, interval, base), opt)
+}
+
+// DemContoursAt returns the contour lines of src at the levels, see
+// DemContours.
+func DemContoursAt(src *big.Dem, levels []float64, opt *Options) (contours []Contour, err error) {
+	p := demOptions(src, opt)
+	c := newContourBuilder(levels)
+	err = forEachDemTile(src, image.Rect(0, 0, 1, 1), func(buf *image_ext.Gray32f, r image.Rectangle) error {
+		c.addCells(buf, r, p)
+		return nil
+	})
+	if err != nil {
+		return
+	}
+	contours = c.contours()
+	return
+}
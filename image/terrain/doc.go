@@ -0,0 +1,27 @@
+// Copyright 2014 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+/*
+Package terrain implements the terrain analysis of DEM: slope, aspect,
+hillshade and contour lines.
+
+The functions work on the in-memory Gray32f images, and the tiled big.Dem
+images tile by tile, the pixels near the tile seams are computed with the
+neighbor tiles, so the results are the same as the in-memory ones.
+
+The slope, aspect and hillshade use the 3x3 window of Horn's method. The
+nodata and outside cells of the window are extrapolated from the other
+cells, so the slope of a plane is the same at the borders, or replaced by
+the center cell. The output cell is nodata if the center cell is nodata.
+
+Example:
+
+	opt := &terrain.Options{CellWidth: 30, Azimuth: 315, Altitude: 45}
+	slope := terrain.Slope(dem, opt)
+	shade := terrain.Hillshade(dem, opt)
+	for _, c := range terrain.Contours(dem, 10, 0, opt) {
+		fmt.Println(c.Level, len(c.Lines))
+	}
+*/
+package terrain
@@ -0,0 +1,220 @@
+// Copyright 2014 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package terrain
+
+import (
+	"image"
+	"image/color"
+	"math"
+
+	"github.com/chai2010/gopkg/builtin"
+	image_ext "github.com/chai2010/gopkg/image"
+	color_ext "github.com/chai2010/gopkg/image/color"
+)
+
+// AspectFlat is the aspect of the flat cells.
+const AspectFlat = -1
+
+// Options are the parameters of the terrain functions. The nil Options
+// and the zero fields mean the defaults.
+type Options struct {
+	CellWidth  float64     // the cell width in the horizontal units, 1 if zero
+	CellHeight float64     // the cell height in the horizontal units, CellWidth if zero
+	ZFactor    float64     // the ratio of the vertical units to the horizontal units, 1 if zero
+	NoData     color.Color // the nodata value of the DEM, the NaN cells are always nodata
+
+	// Azimuth is the light direction of Hillshade in degrees clockwise
+	// from north, 315 if zero, 360 for the north light.
+	Azimuth float64
+	// Altitude is the light angle of Hillshade in degrees above the
+	// horizon, 45 if zero.
+	Altitude float64
+}
+
+// options is the Options with the defaults.
+type options struct {
+	Options
+	hasNoData bool
+	nodata    float32
+}
+
+func newOptions(opt *Options) *options {
+	p := new(options)
+	if opt != nil {
+		p.Options = *opt
+	}
+	if p.CellWidth == 0 {
+		p.CellWidth = 1
+	}
+	if p.CellHeight == 0 {
+		p.CellHeight = p.CellWidth
+	}
+	if p.ZFactor == 0 {
+		p.ZFactor = 1
+	}
+	if p.Azimuth == 0 {
+		p.Azimuth = 315
+	}
+	if p.Altitude == 0 {
+		p.Altitude = 45
+	}
+	if p.NoData != nil {
+		p.hasNoData = true
+		p.nodata = color_ext.Gray32fModel.Convert(p.NoData).(color_ext.Gray32f).Y
+	}
+	return p
+}
+
+// isNoData reports whether v is nodata.
+func (p *options) isNoData(v float32) bool {
+	return v != v || p.hasNoData && v == p.nodata
+}
+
+// noDataValue returns the nodata value of the float outputs, NaN if the
+// NoData is nil.
+func (p *options) noDataValue() float32 {
+	if p.hasNoData {
+		return p.nodata
+	}
+	return float32(math.NaN())
+}
+
+// gradient returns the elevation changes per horizontal unit to the east
+// and to the south of the cell (x, y) of src, with the cells out of r as
+// nodata. The nodata neighbors are extrapolated from the opposite cells
+// or the cells in the same row or column, or replaced by the center cell.
+// ok is false if the cell is nodata.
+func (p *options) gradient(src *image_ext.Gray32f, r image.Rectangle, x, y int) (dx, dy float64, ok bool) {
+	e := builtin.Float32(src.Pix[src.PixOffset(x, y):])
+	if p.isNoData(e) {
+		return
+	}
+	var w [3][3]float64
+	var valid [3][3]bool
+	for j := 0; j < 3; j++ {
+		for i := 0; i < 3; i++ {
+			if xx, yy := x+i-1, y+j-1; (image.Point{xx, yy}).In(r) {
+				if v := builtin.Float32(src.Pix[src.PixOffset(xx, yy):]); !p.isNoData(v) {
+					w[j][i], valid[j][i] = float64(v), true
+				}
+			}
+		}
+	}
+	valid[1][1] = true
+	w[1][1] = float64(e)
+	// the side cells first, then the corners can use them
+	for _, k := range [8][2]int{{0, 1}, {2, 1}, {1, 0}, {1, 2}, {0, 0}, {0, 2}, {2, 0}, {2, 2}} {
+		j, i := k[0], k[1]
+		switch {
+		case valid[j][i]:
+			continue
+		case valid[2-j][2-i]:
+			w[j][i] = 2*w[1][1] - w[2-j][2-i]
+		case i != 1 && valid[j][1] && valid[j][2-i]:
+			w[j][i] = 2*w[j][1] - w[j][2-i]
+		case j != 1 && valid[1][i] && valid[2-j][i]:
+			w[j][i] = 2*w[1][i] - w[2-j][i]
+		default:
+			w[j][i] = w[1][1]
+		}
+		valid[j][i] = true
+	}
+	dx = ((w[0][2] + 2*w[1][2] + w[2][2]) - (w[0][0] + 2*w[1][0] + w[2][0])) / (8 * p.CellWidth)
+	dy = ((w[2][0] + 2*w[2][1] + w[2][2]) - (w[0][0] + 2*w[0][1] + w[0][2])) / (8 * p.CellHeight)
+	dx, dy, ok = dx*p.ZFactor, dy*p.ZFactor, true
+	return
+}
+
+func (p *options) slope(dx, dy float64) float32 {
+	return float32(math.Atan(math.Hypot(dx, dy)) * 180 / math.Pi)
+}
+
+func (p *options) aspect(dx, dy float64) float32 {
+	if dx == 0 && dy == 0 {
+		return AspectFlat
+	}
+	// the downslope direction is (-dx, dy) in the east and north axes
+	v := math.Atan2(-dx, dy) * 180 / math.Pi
+	if v < 0 {
+		v += 360
+	}
+	return float32(v)
+}
+
+func (p *options) hillshade(dx, dy float64) uint8 {
+	az := p.Azimuth * math.Pi / 180
+	alt := p.Altitude * math.Pi / 180
+	lx, ly, lz := math.Sin(az)*math.Cos(alt), math.Cos(az)*math.Cos(alt), math.Sin(alt)
+	v := (-dx*lx + dy*ly + lz) / math.Sqrt(dx*dx+dy*dy+1)
+	if v < 0 {
+		v = 0
+	}
+	return uint8(1 + 254*v + 0.5)
+}
+
+// Slope returns the slope of src in degrees, the nodata cells are the
+// NoData value of opt, or NaN if the NoData is nil.
+func Slope(src *image_ext.Gray32f, opt *Options) *image_ext.Gray32f {
+	return newOptions(opt).slopeImage(src, src.Bounds())
+}
+
+// Aspect returns the downslope direction of src in degrees clockwise from
+// north, the flat cells are AspectFlat, the nodata cells are the same as
+// Slope.
+func Aspect(src *image_ext.Gray32f, opt *Options) *image_ext.Gray32f {
+	return newOptions(opt).aspectImage(src, src.Bounds())
+}
+
+// Hillshade returns the shaded relief of src, the values are 1 ~ 255 and
+// the nodata cells are 0.
+func Hillshade(src *image_ext.Gray32f, opt *Options) *image.Gray {
+	return newOptions(opt).hillshadeImage(src, src.Bounds())
+}
+
+// slopeImage returns the slope of the rect r of src, the bounds of the
+// returned image are r.
+func (p *options) slopeImage(src *image_ext.Gray32f, r image.Rectangle) *image_ext.Gray32f {
+	return p.floatImage(src, r, p.slope)
+}
+
+func (p *options) aspectImage(src *image_ext.Gray32f, r image.Rectangle) *image_ext.Gray32f {
+	return p.floatImage(src, r, p.aspect)
+}
+
+func (p *options) floatImage(src *image_ext.Gray32f, r image.Rectangle, fn func(dx, dy float64) float32) *image_ext.Gray32f {
+	dst := image_ext.NewGray32f(r)
+	b, nodata := src.Bounds(), p.noDataValue()
+	image_ext.ParallelRows(r, func(r image.Rectangle) {
+		for y := r.Min.Y; y < r.Max.Y; y++ {
+			off := dst.PixOffset(r.Min.X, y)
+			for x := r.Min.X; x < r.Max.X; x++ {
+				v := nodata
+				if dx, dy, ok := p.gradient(src, b, x, y); ok {
+					v = fn(dx, dy)
+				}
+				builtin.PutFloat32(dst.Pix[off:], v)
+				off += 4
+			}
+		}
+	}, src, dst)
+	return dst
+}
+
+func (p *options) hillshadeImage(src *image_ext.Gray32f, r image.Rectangle) *image.Gray {
+	dst := image.NewGray(r)
+	b := src.Bounds()
+	image_ext.ParallelRows(r, func(r image.Rectangle) {
+		for y := r.Min.Y; y < r.Max.Y; y++ {
+			off := dst.PixOffset(r.Min.X, y)
+			for x := r.Min.X; x < r.Max.X; x++ {
+				if dx, dy, ok := p.gradient(src, b, x, y); ok {
+					dst.Pix[off] = p.hillshade(dx, dy)
+				}
+				off++
+			}
+		}
+	}, src, dst)
+	return dst
+}
@@ -0,0 +1,234 @@
+// Copyright 2014 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package terrain
+
+import (
+	"image"
+	"math"
+	"reflect"
+	"testing"
+
+	image_ext "github.com/chai2010/gopkg/image"
+	"github.com/chai2010/gopkg/image/big"
+	color_ext "github.com/chai2010/gopkg/image/color"
+)
+
+func tNewDem(r image.Rectangle, fn func(x, y int) float32) *image_ext.Gray32f {
+	m := image_ext.NewGray32f(r)
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			m.SetGray32f(x, y, color_ext.Gray32f{Y: fn(x, y)})
+		}
+	}
+	return m
+}
+
+func tNewBigDem(m *image_ext.Gray32f, tileSize image.Point) *big.Dem {
+	dem := big.NewDem(m.Bounds(), tileSize, color_ext.Gray32f{})
+	if err := dem.WriteRect(-1, m.Bounds(), m); err != nil {
+		panic(err)
+	}
+	return dem
+}
+
+func tCone(x, y int) float32 {
+	return float32(100 - math.Hypot(float64(x)-31.5, float64(y)-23.5))
+}
+
+func TestSlopeAspect(t *testing.T) {
+	for i, v := range []struct {
+		Fn     func(x, y int) float32
+		Opt    *Options
+		Slope  float64
+		Aspect float32
+	}{
+		{func(x, y int) float32 { return float32(2 * x) }, nil, math.Atan(2), 270},
+		{func(x, y int) float32 { return float32(-3 * x) }, &Options{CellWidth: 3}, math.Pi / 4, 90},
+		{func(x, y int) float32 { return float32(-y) }, nil, math.Pi / 4, 180},
+		{func(x, y int) float32 { return float32(y) }, &Options{ZFactor: 2}, math.Atan(2), 0},
+		{func(x, y int) float32 { return float32(x + y) }, &Options{CellHeight: 1, CellWidth: 1}, math.Atan(math.Sqrt2), 315},
+		{func(x, y int) float32 { return 7 }, nil, 0, AspectFlat},
+	} {
+		m := tNewDem(image.Rect(0, 0, 8, 6), v.Fn)
+		slope, aspect := Slope(m, v.Opt), Aspect(m, v.Opt)
+		for _, pt := range []image.Point{{3, 3}, {0, 0}, {7, 5}} {
+			if got, want := float64(slope.Gray32fAt(pt.X, pt.Y).Y), v.Slope*180/math.Pi; math.Abs(got-want) > 1e-4 {
+				t.Fatalf("%d: bad slope at %v; got %v, want %v", i, pt, got, want)
+			}
+			if got := aspect.Gray32fAt(pt.X, pt.Y).Y; math.Abs(float64(got-v.Aspect)) > 1e-4 {
+				t.Fatalf("%d: bad aspect at %v; got %v, want %v", i, pt, got, v.Aspect)
+			}
+		}
+	}
+}
+
+func TestHillshade(t *testing.T) {
+	flat := tNewDem(image.Rect(0, 0, 4, 4), func(x, y int) float32 { return 1 })
+	if got, want := Hillshade(flat, nil).GrayAt(1, 1).Y, uint8(1+254*math.Sin(math.Pi/4)+0.5); got != want {
+		t.Fatalf("bad flat hillshade: got %v, want %v", got, want)
+	}
+
+	// the slope faces the light, and the opposite slope is in shadow
+	west := tNewDem(image.Rect(0, 0, 4, 4), func(x, y int) float32 { return float32(math.Sqrt(3) * float64(x)) })
+	if got := Hillshade(west, &Options{Azimuth: 270, Altitude: 30}).GrayAt(1, 1).Y; got < 254 {
+		t.Fatalf("bad lit hillshade: %v", got)
+	}
+	if got := Hillshade(west, &Options{Azimuth: 90, Altitude: 30}).GrayAt(1, 1).Y; got != 1 {
+		t.Fatalf("bad shadow hillshade: %v", got)
+	}
+}
+
+func TestNoData(t *testing.T) {
+	m := tNewDem(image.Rect(0, 0, 5, 5), func(x, y int) float32 { return float32(x) })
+	m.SetGray32f(2, 2, color_ext.Gray32f{Y: -9999})
+	m.SetGray32f(1, 1, color_ext.Gray32f{Y: float32(math.NaN())})
+	opt := &Options{NoData: color_ext.Gray32f{Y: -9999}}
+
+	slope := Slope(m, opt)
+	if got := slope.Gray32fAt(2, 2).Y; got != -9999 {
+		t.Fatalf("bad nodata slope: %v", got)
+	}
+	if got := Slope(m, nil).Gray32fAt(1, 1).Y; got == got {
+		t.Fatalf("bad NaN slope: %v", got)
+	}
+	// the nodata neighbors are extrapolated from the opposite cells
+	if got := slope.Gray32fAt(3, 3).Y; math.Abs(float64(got)-45) > 1e-4 {
+		t.Fatalf("bad slope near nodata: %v", got)
+	}
+	if got := Hillshade(m, opt).GrayAt(2, 2).Y; got != 0 {
+		t.Fatalf("bad nodata hillshade: %v", got)
+	}
+	// the lines are broken by the cells which have nodata corners
+	contours := ContoursAt(m, []float64{1.5, 2.5}, opt)
+	if len(contours) != 2 || len(contours[0].Lines) != 1 || len(contours[1].Lines) != 2 {
+		t.Fatalf("bad contours near nodata: %v", contours)
+	}
+	if line := contours[0].Lines[0]; len(line) != 2 || line[0].Y+line[1].Y != 8 {
+		t.Fatalf("bad line near nodata: %v", line)
+	}
+}
+
+func TestContours(t *testing.T) {
+	m := tNewDem(image.Rect(0, 0, 64, 48), tCone)
+	if contours := Contours(m, 5, 0, nil); len(contours) != 7 || contours[0].Level != 65 {
+		t.Fatalf("bad contours: %v", contours)
+	}
+	contours := ContoursAt(m, []float64{95, 80, 90, 85, 200}, nil)
+	if len(contours) != 4 {
+		t.Fatalf("bad contours: %d", len(contours))
+	}
+	for i, c := range contours {
+		if c.Level != float64(80+5*i) || len(c.Lines) != 1 {
+			t.Fatalf("%d: bad level %v or lines %d", i, c.Level, len(c.Lines))
+		}
+		line := c.Lines[0]
+		if len(line) < 8 || line[0] != line[len(line)-1] {
+			t.Fatalf("%d: the line is not closed: %v", i, line)
+		}
+		for _, pt := range line {
+			d := math.Hypot(pt.X-32, pt.Y-24)
+			if math.Abs(d-(100-c.Level)) > 0.1 {
+				t.Fatalf("%d: bad point %v, distance %v", i, pt, d)
+			}
+		}
+	}
+
+	// the open lines end at the border
+	contours = ContoursAt(m, []float64{75}, nil)
+	if len(contours) != 1 || len(contours[0].Lines) != 2 {
+		t.Fatalf("bad open contours: %v", contours)
+	}
+	for _, line := range contours[0].Lines {
+		if line[0] == line[len(line)-1] {
+			t.Fatalf("bad open line: %v", line)
+		}
+	}
+
+	gt := image_ext.NewGeoTransform(1000, 2000, 10, 10)
+	c := Contour{Lines: [][]Point{{{0.5, 0.5}, {1.5, 2}}}}
+	c.Transform(gt)
+	if c.Lines[0][0] != (Point{1005, 1995}) || c.Lines[0][1] != (Point{1015, 1980}) {
+		t.Fatalf("bad Transform: %v", c.Lines)
+	}
+}
+
+func TestDem(t *testing.T) {
+	m := tNewDem(image.Rect(0, 0, 100, 70), func(x, y int) float32 {
+		return tCone(x, y) + float32(math.Sin(float64(x)/5)*3)
+	})
+	m.SetGray32f(32, 16, color_ext.Gray32f{Y: -9999})
+	src := tNewBigDem(m, image.Pt(32, 32))
+	src.NoData = color_ext.Gray32f{Y: -9999}
+	src.GeoTransform = image_ext.NewGeoTransform(0, 0, 2, 2)
+	opt := &Options{CellWidth: 2, NoData: src.NoData}
+
+	for _, fn := range []struct {
+		Name string
+		Dem  func(dst, src *big.Dem, opt *Options) error
+		Mem  func(src *image_ext.Gray32f, opt *Options) *image_ext.Gray32f
+	}{
+		{"slope", DemSlope, Slope},
+		{"aspect", DemAspect, Aspect},
+	} {
+		dst := big.NewDem(src.Bounds(), src.TileSize, color_ext.Gray32f{})
+		if err := fn.Dem(dst, src, nil); err != nil {
+			t.Fatalf("%s: %v", fn.Name, err)
+		}
+		want := fn.Mem(m, opt)
+		for y := 0; y < 70; y++ {
+			for x := 0; x < 100; x++ {
+				if got, want := dst.Gray32fAt(x, y), want.Gray32fAt(x, y); got != want {
+					t.Fatalf("%s: bad value at (%d, %d); got %v, want %v", fn.Name, x, y, got, want)
+				}
+			}
+		}
+	}
+
+	shade := big.NewImage(src.Bounds(), src.TileSize, image.NewGray(image.Rect(0, 0, 1, 1)).ColorModel())
+	if err := DemHillshade(shade, src, nil); err != nil {
+		t.Fatal(err)
+	}
+	want := Hillshade(m, opt)
+	for y := 0; y < 70; y++ {
+		for x := 0; x < 100; x++ {
+			if got, want := shade.At(x, y), want.At(x, y); got != want {
+				t.Fatalf("hillshade: bad value at (%d, %d); got %v, want %v", x, y, got, want)
+			}
+		}
+	}
+
+	got, err := DemContours(src, 4, 0, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantContours := Contours(m, 4, 0, opt)
+	if len(got) != len(wantContours) {
+		t.Fatalf("bad contour levels: %d, want %d", len(got), len(wantContours))
+	}
+	for i := range got {
+		if got[i].Level != wantContours[i].Level || len(got[i].Lines) != len(wantContours[i].Lines) {
+			t.Fatalf("%d: bad level %v or lines %d, want %v, %d", i,
+				got[i].Level, len(got[i].Lines), wantContours[i].Level, len(wantContours[i].Lines),
+			)
+		}
+		if s0, s1 := tPointSet(got[i]), tPointSet(wantContours[i]); !reflect.DeepEqual(s0, s1) {
+			t.Fatalf("%d: bad points: %d, want %d", i, len(s0), len(s1))
+		}
+	}
+
+	if err := DemSlope(big.NewDem(image.Rect(0, 0, 10, 10), src.TileSize, color_ext.Gray32f{}), src, nil); err == nil {
+		t.Fatalf("bad bounds: expect error")
+	}
+}
+
+func tPointSet(c Contour) map[Point]bool {
+	m := make(map[Point]bool)
+	for _, line := range c.Lines {
+		for _, pt := range line {
+			m[pt] = true
+		}
+	}
+	return m
+}
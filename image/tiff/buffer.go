@@ -0,0 +1,52 @@
+// Copyright 2014 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tiff
+
+import (
+	"fmt"
+	"io"
+)
+
+// buffer buffers an io.Reader to satisfy io.ReaderAt, the data is read
+// from r when the offsets are first read.
+type buffer struct {
+	r   io.Reader
+	buf []byte
+	err error // the error of r, io.EOF at the end of r
+}
+
+// newReaderAt returns r if it's an io.ReaderAt, or buffers it.
+func newReaderAt(r io.Reader) io.ReaderAt {
+	if ra, ok := r.(io.ReaderAt); ok {
+		return ra
+	}
+	return &buffer{r: r, buf: make([]byte, 0, 1024)}
+}
+
+// fill reads r until the buffer holds end bytes, only the bytes of r are
+// allocated.
+func (b *buffer) fill(end int64) {
+	for int64(len(b.buf)) < end && b.err == nil {
+		if len(b.buf) == cap(b.buf) {
+			b.buf = append(b.buf, 0)[:len(b.buf)]
+		}
+		n, err := b.r.Read(b.buf[len(b.buf):cap(b.buf)])
+		b.buf, b.err = b.buf[:len(b.buf)+n], err
+	}
+}
+
+func (b *buffer) ReadAt(p []byte, off int64) (n int, err error) {
+	if off < 0 {
+		return 0, fmt.Errorf("image/tiff: negative offset %d", off)
+	}
+	b.fill(off + int64(len(p)))
+	if off < int64(len(b.buf)) {
+		n = copy(p, b.buf[off:])
+	}
+	if n < len(p) {
+		err = b.err
+	}
+	return
+}
@@ -0,0 +1,141 @@
+// Copyright 2014 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tiff
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"io"
+	"io/ioutil"
+
+	image_ext "github.com/chai2010/gopkg/image"
+)
+
+// Page tags.
+const (
+	tNewSubfileType = 254
+	tPageName       = 285
+	tPageNumber     = 297
+
+	subfilePage = 2 // NewSubfileType value of a page of a multi-page image
+)
+
+// DecodeFrames reads all the pages of a TIFF image from r, with the name
+// and the XMP/ICC/GeoTIFF metadata of every page.
+func DecodeFrames(r io.Reader, opt *Options) (frames *image_ext.Frames, err error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return
+	}
+	list, err := readIFDs(bytes.NewReader(data))
+	if err != nil {
+		return
+	}
+
+	frames = &image_ext.Frames{
+		Frame:     make([]image_ext.Frame, len(list)),
+		LoopCount: 1,
+	}
+	for i, d := range list {
+		pr := &pageReader{data: data, order: d.order, big: d.big, offset: d.offset}
+		var m image.Image
+		if m, err = Decode(io.NewSectionReader(pr, 0, int64(len(data))), opt); err != nil {
+			err = fmt.Errorf("image/tiff: DecodeFrames, page %d: %v", i, err)
+			return
+		}
+		frames.Frame[i] = image_ext.Frame{
+			Image:    m,
+			Metadata: readMetadata(bytes.NewReader(data), d),
+		}
+		if e, ok := d.raw[tPageName]; ok && e.datatype == dtASCII {
+			frames.Frame[i].PageName = string(bytes.TrimRight(e.data, "\x00"))
+		}
+
+		b := m.Bounds()
+		if b.Dx() > frames.Config.Width {
+			frames.Config.Width = b.Dx()
+		}
+		if b.Dy() > frames.Config.Height {
+			frames.Config.Height = b.Dy()
+		}
+		if i == 0 {
+			frames.Config.ColorModel = m.ColorModel()
+		}
+	}
+	return
+}
+
+// EncodeFrames writes all the frames to w as the pages of a TIFF image,
+// with the name and the XMP/ICC/GeoTIFF metadata of every page.
+func EncodeFrames(w io.Writer, frames *image_ext.Frames, opt *Options) error {
+	pages := make([]page, len(frames.Frame))
+	for i, frame := range frames.Frame {
+		// page tags
+		tags := []ifdTag{
+			makeTag(tNewSubfileType, dtLong, subfilePage),
+			makeTag(tPageNumber, dtShort, uint64(i), uint64(len(frames.Frame))),
+		}
+		if frame.PageName != "" {
+			name := []byte(frame.PageName + "\x00")
+			tags = append(tags, ifdTag{tPageName, dtASCII, uint32(len(name)), name, nil})
+		}
+		if frame.Metadata != nil {
+			metaTags, _ := makeMetadataTags(frame.Metadata)
+			tags = append(tags, metaTags...)
+		}
+		pages[i] = page{m: frame.Image, tags: tags}
+	}
+	return encodePages(w, pages, opt)
+}
+
+// pageReader reads a TIFF file whose first IFD is at offset.
+type pageReader struct {
+	data   []byte
+	order  binary.ByteOrder
+	big    bool // BigTIFF
+	offset int64
+}
+
+func (p *pageReader) ReadAt(b []byte, off int64) (n int, err error) {
+	if off >= int64(len(p.data)) {
+		return 0, io.EOF
+	}
+	n = copy(b, p.data[off:])
+	var hdr []byte
+	if p.big {
+		hdr = make([]byte, 16)
+		copy(hdr, p.data[:8])
+		p.order.PutUint64(hdr[8:], uint64(p.offset))
+	} else {
+		hdr = make([]byte, 8)
+		copy(hdr, p.data[:4])
+		p.order.PutUint32(hdr[4:], uint32(p.offset))
+	}
+	if off < int64(len(hdr)) {
+		copy(b, hdr[off:])
+	}
+	if n < len(b) {
+		err = io.EOF
+	}
+	return
+}
+
+func imageExtDecodeAll(r io.Reader, opt *image_ext.Options) (*image_ext.Frames, error) {
+	p, err := newOptions(opt)
+	if err != nil {
+		return nil, err
+	}
+	return DecodeFrames(r, p)
+}
+
+func imageExtEncodeAll(w io.Writer, frames *image_ext.Frames, opt *image_ext.Options) error {
+	p, err := newEncodeOptions(opt)
+	if err != nil {
+		return err
+	}
+	return EncodeFrames(w, frames, p)
+}
@@ -0,0 +1,305 @@
+// Copyright 2014 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tiff
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+)
+
+// Tags (see p. 28-41 of the spec).
+const (
+	tImageWidth                = 256
+	tImageLength               = 257
+	tBitsPerSample             = 258
+	tCompression               = 259
+	tPhotometricInterpretation = 262
+	tStripOffsets              = 273
+	tSamplesPerPixel           = 277
+	tRowsPerStrip              = 278
+	tStripByteCounts           = 279
+	tPlanarConfiguration       = 284
+	tPredictor                 = 317
+	tColorMap                  = 320
+	tTileWidth                 = 322
+	tTileLength                = 323
+	tTileOffsets               = 324
+	tTileByteCounts            = 325
+	tExtraSamples              = 338
+	tSampleFormat              = 339
+	tJPEGTables                = 347
+	tYCbCrSubSampling          = 530
+	tXMP                       = 700
+	tModelPixelScale           = 33550
+	tModelTiepoint             = 33922
+	tModelTransformation       = 34264
+	tExifIFD                   = 34665
+	tICCProfile                = 34675
+	tGeoKeyDirectory           = 34735
+	tGeoDoubleParams           = 34736
+	tGeoAsciiParams            = 34737
+	tGPSIFD                    = 34853
+	tInteropIFD                = 40965
+)
+
+// Data types (p. 14-16 of the spec, and the BigTIFF types).
+const (
+	dtByte      = 1
+	dtASCII     = 2
+	dtShort     = 3
+	dtLong      = 4
+	dtRational  = 5
+	dtUndefined = 7
+	dtSRational = 10
+	dtDouble    = 12
+	dtIFD       = 13
+	dtLong8     = 16
+	dtIFD8      = 18
+)
+
+// The length of one instance of each data type in bytes.
+var lengths = [...]uint32{0, 1, 1, 2, 4, 8, 1, 1, 2, 4, 8, 4, 8, 4, 0, 0, 8, 8, 8}
+
+// Compression types (defined in various places in the spec and supplements).
+const (
+	cNone       = 1
+	cLZW        = 5
+	cJPEG       = 7
+	cDeflate    = 32946
+	cDeflateNew = 8
+	cPackBits   = 32773
+)
+
+// Photometric interpretation values (see p. 37 of the spec).
+const (
+	pWhiteIsZero = 0
+	pBlackIsZero = 1
+	pRGB         = 2
+	pPaletted    = 3
+	pYCbCr       = 6
+)
+
+// Values for the tPredictor tag (page 64-65 of the spec).
+const (
+	prNone          = 1
+	prHorizontal    = 2
+	prFloatingPoint = 3
+)
+
+// ifd holds the entries of an image file directory.
+type ifd struct {
+	order   binary.ByteOrder
+	big     bool             // BigTIFF
+	offset  int64            // offset of the IFD
+	next    int64            // offset of the next IFD, 0 if none
+	entries map[int][]uint   // BYTE/SHORT/LONG values
+	raw     map[int]ifdEntry // all values
+}
+
+// ifdEntry is the raw value of an IFD entry.
+type ifdEntry struct {
+	datatype uint16
+	count    uint32
+	data     []byte
+}
+
+// readHeader reads the byte order and the offset of the first IFD, big
+// reports whether it's a BigTIFF file.
+func readHeader(r io.ReaderAt) (order binary.ByteOrder, big bool, off int64, err error) {
+	var hdr [16]byte
+	if n, err := r.ReadAt(hdr[:], 0); n < 8 {
+		if err == nil || err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, false, 0, err
+	}
+	switch string(hdr[:4]) {
+	case leHeader, beHeader:
+	case bigLEHeader, bigBEHeader:
+		big = true
+	default:
+		err = fmt.Errorf("image/tiff: malformed header")
+		return
+	}
+	if hdr[0] == 'I' {
+		order = binary.LittleEndian
+	} else {
+		order = binary.BigEndian
+	}
+	if !big {
+		off = int64(order.Uint32(hdr[4:8]))
+		return
+	}
+	if order.Uint16(hdr[4:6]) != 8 || order.Uint16(hdr[6:8]) != 0 {
+		err = fmt.Errorf("image/tiff: malformed BigTIFF header")
+		return
+	}
+	off = int64(order.Uint64(hdr[8:16]))
+	return
+}
+
+// readIFD reads the first image file directory of the TIFF file in r.
+func readIFD(r io.ReaderAt) (p *ifd, err error) {
+	order, big, off, err := readHeader(r)
+	if err != nil {
+		return
+	}
+	return readIFDAt(r, order, big, off)
+}
+
+// readIFDs reads all the image file directories of the TIFF file in r.
+func readIFDs(r io.ReaderAt) (list []*ifd, err error) {
+	order, big, off, err := readHeader(r)
+	if err != nil {
+		return
+	}
+	seen := make(map[int64]bool)
+	for off != 0 && !seen[off] {
+		seen[off] = true
+		var p *ifd
+		if p, err = readIFDAt(r, order, big, off); err != nil {
+			return
+		}
+		list = append(list, p)
+		off = p.next
+	}
+	return
+}
+
+// readIFDAt reads the image file directory at offset off.
+func readIFDAt(r io.ReaderAt, order binary.ByteOrder, big bool, off int64) (p *ifd, err error) {
+	p = &ifd{
+		order:   order,
+		big:     big,
+		offset:  off,
+		entries: make(map[int][]uint),
+		raw:     make(map[int]ifdEntry),
+	}
+
+	// the entry count, the entries and the next IFD offset are 2, 12 and
+	// 4 bytes in TIFF, 8, 20 and 8 bytes in BigTIFF.
+	countLen, entryLen, nextLen := 2, 12, 4
+	if big {
+		countLen, entryLen, nextLen = 8, 20, 8
+	}
+	var b [8]byte
+	if _, err = r.ReadAt(b[:countLen], off); err != nil {
+		return
+	}
+	n := uint64(p.order.Uint16(b[:]))
+	if big {
+		n = p.order.Uint64(b[:])
+	}
+	if n > 1<<20 {
+		return nil, fmt.Errorf("image/tiff: IFD entry count overflow: %d", n)
+	}
+	size := entryLen * int(n)
+	buf := make([]byte, size+nextLen)
+	fileSize := readerSize(r)
+	if nr, err := r.ReadAt(buf, off+int64(countLen)); err != nil {
+		if err != io.EOF {
+			return nil, err
+		}
+		if nr < size {
+			return nil, io.ErrUnexpectedEOF
+		}
+	}
+	for i := 0; i < size; i += entryLen {
+		if err = p.parseEntry(r, fileSize, buf[i:i+entryLen]); err != nil {
+			return
+		}
+	}
+	if big {
+		p.next = int64(p.order.Uint64(buf[size:]))
+	} else {
+		p.next = int64(p.order.Uint32(buf[size:]))
+	}
+	return
+}
+
+// parseEntry parses a single IFD entry, size is the size of r, or -1 if
+// it's unknown.
+func (p *ifd) parseEntry(r io.ReaderAt, size int64, e []byte) error {
+	tag := int(p.order.Uint16(e[0:2]))
+	datatype := p.order.Uint16(e[2:4])
+	if datatype == 0 || int(datatype) >= len(lengths) || lengths[datatype] == 0 {
+		return nil
+	}
+	var count uint64
+	var raw []byte
+	var pos int64
+	if p.big {
+		count, raw = p.order.Uint64(e[4:12]), e[12:20]
+		pos = int64(p.order.Uint64(raw))
+	} else {
+		count, raw = uint64(p.order.Uint32(e[4:8])), e[8:12]
+		pos = int64(p.order.Uint32(raw))
+	}
+	if count > 1<<28 {
+		return fmt.Errorf("image/tiff: IFD entry count overflow, tag = %d", tag)
+	}
+
+	if n := count * uint64(lengths[datatype]); n > uint64(len(raw)) {
+		// the values out of the file are rejected before they are
+		// allocated, only the bytes in the file are allocated if the size
+		// of the file is unknown
+		if size >= 0 && (n > uint64(size) || uint64(pos) > uint64(size)-n) {
+			return FormatError(fmt.Sprintf("IFD entry out of the file, tag = %d, offset %d, size %d", tag, pos, n))
+		}
+		var err error
+		if size < 0 {
+			raw, err = ioutil.ReadAll(io.NewSectionReader(r, pos, int64(n)))
+			if err == nil && uint64(len(raw)) < n {
+				err = io.ErrUnexpectedEOF
+			}
+		} else {
+			raw = make([]byte, n)
+			var nr int
+			if nr, err = r.ReadAt(raw, pos); err == io.EOF && nr == len(raw) {
+				err = nil
+			}
+		}
+		if err != nil {
+			return err
+		}
+	}
+	p.raw[tag] = ifdEntry{
+		datatype: datatype,
+		count:    uint32(count),
+		data:     raw[:count*uint64(lengths[datatype])],
+	}
+	switch datatype {
+	case dtByte, dtShort, dtLong, dtLong8, dtIFD8:
+	default:
+		return nil
+	}
+
+	val := make([]uint, count)
+	for i := range val {
+		switch datatype {
+		case dtByte:
+			val[i] = uint(raw[i])
+		case dtShort:
+			val[i] = uint(p.order.Uint16(raw[2*i:]))
+		case dtLong:
+			val[i] = uint(p.order.Uint32(raw[4*i:]))
+		case dtLong8, dtIFD8:
+			val[i] = uint(p.order.Uint64(raw[8*i:]))
+		}
+	}
+	p.entries[tag] = val
+	return nil
+}
+
+// firstVal returns the first uint of the entry with the given tag,
+// or def if the tag does not exist.
+func (p *ifd) firstVal(tag int, def uint) uint {
+	if v := p.entries[tag]; len(v) > 0 {
+		return v[0]
+	}
+	return def
+}
@@ -0,0 +1,279 @@
+// Copyright 2014 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tiff
+
+import (
+	"encoding/binary"
+	"image"
+	"image/color"
+	"reflect"
+
+	"github.com/chai2010/gopkg/builtin"
+	image_ext "github.com/chai2010/gopkg/image"
+	color_ext "github.com/chai2010/gopkg/image/color"
+)
+
+// pixelLayout describes the samples of a pixel in the TIFF file, and the
+// image type which holds them.
+type pixelLayout struct {
+	model       color.Model
+	photometric uint
+	spp         int  // samples per pixel
+	bits        int  // bits per sample, 0 if the bands have different sizes
+	format      uint // sample format of all the samples
+	extra       uint // ExtraSamples value of the alpha sample, 0 if none
+	pixSize     int  // the bytes of a pixel in the image, may be padded
+	bigEndian   bool // the samples are big endian in the image, or native
+
+	palette color.Palette             // the colors of the paletted images
+	bands   *color_ext.MultiBandModel // the bands of the MultiBand images
+}
+
+// pixelLayouts are the layouts of the standard image types, the first one
+// of the same model is used by the encoder.
+var pixelLayouts = []pixelLayout{
+	{model: color.GrayModel, photometric: pBlackIsZero, spp: 1, bits: 8, format: sfUint, pixSize: 1, bigEndian: true},
+	{model: color.Gray16Model, photometric: pBlackIsZero, spp: 1, bits: 16, format: sfUint, pixSize: 2, bigEndian: true},
+	{model: color_ext.Gray16sModel, photometric: pBlackIsZero, spp: 1, bits: 16, format: sfInt, pixSize: 2},
+	{model: color_ext.Gray32iModel, photometric: pBlackIsZero, spp: 1, bits: 32, format: sfInt, pixSize: 4},
+	{model: color_ext.Gray32fModel, photometric: pBlackIsZero, spp: 1, bits: 32, format: sfFloat, pixSize: 4},
+	{model: color_ext.Gray64fModel, photometric: pBlackIsZero, spp: 1, bits: 64, format: sfFloat, pixSize: 8},
+	{model: color_ext.RGBModel, photometric: pRGB, spp: 3, bits: 8, format: sfUint, pixSize: 3, bigEndian: true},
+	{model: color_ext.RGB48Model, photometric: pRGB, spp: 3, bits: 16, format: sfUint, pixSize: 6, bigEndian: true},
+	{model: color_ext.RGB48sModel, photometric: pRGB, spp: 3, bits: 16, format: sfInt, pixSize: 6},
+	{model: color_ext.RGB96iModel, photometric: pRGB, spp: 3, bits: 32, format: sfInt, pixSize: 12},
+	{model: color_ext.RGB96fModel, photometric: pRGB, spp: 3, bits: 32, format: sfFloat, pixSize: 16},
+	{model: color_ext.RGB192fModel, photometric: pRGB, spp: 3, bits: 64, format: sfFloat, pixSize: 24},
+	{model: color.RGBAModel, photometric: pRGB, spp: 4, bits: 8, format: sfUint, extra: 1, pixSize: 4, bigEndian: true},
+	{model: color.NRGBAModel, photometric: pRGB, spp: 4, bits: 8, format: sfUint, extra: 2, pixSize: 4, bigEndian: true},
+	{model: color.RGBA64Model, photometric: pRGB, spp: 4, bits: 16, format: sfUint, extra: 1, pixSize: 8, bigEndian: true},
+	{model: color.NRGBA64Model, photometric: pRGB, spp: 4, bits: 16, format: sfUint, extra: 2, pixSize: 8, bigEndian: true},
+	{model: color_ext.RGBA128fModel, photometric: pRGB, spp: 4, bits: 32, format: sfFloat, extra: 1, pixSize: 16},
+}
+
+// findPixelLayout returns the layout of the standard image type of the
+// samples, or false if there is none.
+func findPixelLayout(photometric uint, spp, bits int, format, extra uint) (*pixelLayout, bool) {
+	for i := range pixelLayouts {
+		p := &pixelLayouts[i]
+		if p.photometric == photometric && p.spp == spp && p.bits == bits && p.format == format && p.extra == extra {
+			layout := *p
+			return &layout, true
+		}
+	}
+	return nil, false
+}
+
+// modelPixelLayout returns the layout of the image type of model, or false
+// if model is not a standard model.
+func modelPixelLayout(model color.Model) (*pixelLayout, bool) {
+	for i := range pixelLayouts {
+		if pixelLayouts[i].model == model {
+			layout := pixelLayouts[i]
+			return &layout, true
+		}
+	}
+	return nil, false
+}
+
+// newPalettedLayout returns the layout of the 8 bits paletted images.
+func newPalettedLayout(palette color.Palette) *pixelLayout {
+	return &pixelLayout{
+		model:       palette,
+		photometric: pPaletted,
+		spp:         1,
+		bits:        8,
+		format:      sfUint,
+		pixSize:     1,
+		palette:     palette,
+	}
+}
+
+// newMultiBandLayout returns the layout of the MultiBand images.
+func newMultiBandLayout(bands *color_ext.MultiBandModel) *pixelLayout {
+	p := &pixelLayout{
+		model:       bands,
+		photometric: pBlackIsZero,
+		spp:         len(bands.Band),
+		format:      sfUint,
+		pixSize:     bands.PixelSize(),
+		bands:       bands,
+	}
+	if kind := bands.DataType(); kind != reflect.Invalid {
+		p.bits = bands.Band[0].Size() * 8
+		p.format = uint(sampleFormat(kind))
+	}
+	return p
+}
+
+// sampleSize returns the bytes of the sample k.
+func (p *pixelLayout) sampleSize(k int) int {
+	if p.bands != nil {
+		return p.bands.Band[k].Size()
+	}
+	return p.bits / 8
+}
+
+// fileSize returns the bytes of a pixel in the TIFF file.
+func (p *pixelLayout) fileSize() int {
+	if p.bands != nil {
+		return p.bands.PixelSize()
+	}
+	return p.spp * p.bits / 8
+}
+
+// imageOrder returns the byte order of the samples in the image.
+func (p *pixelLayout) imageOrder() binary.ByteOrder {
+	if p.bigEndian {
+		return binary.BigEndian
+	}
+	return nativeOrder{}
+}
+
+// newImage returns a new image for r, with its pixels and stride.
+func (p *pixelLayout) newImage(r image.Rectangle) (m image.Image, pix []byte, stride int) {
+	switch {
+	case p.bands != nil:
+		m = image_ext.NewMultiBand(r, p.bands)
+	case p.palette != nil:
+		m = image.NewPaletted(r, p.palette)
+	default:
+		switch p.model {
+		case color.GrayModel:
+			m = image.NewGray(r)
+		case color.Gray16Model:
+			m = image.NewGray16(r)
+		case color_ext.Gray16sModel:
+			m = image_ext.NewGray16s(r)
+		case color_ext.Gray32iModel:
+			m = image_ext.NewGray32i(r)
+		case color_ext.Gray32fModel:
+			m = image_ext.NewGray32f(r)
+		case color_ext.Gray64fModel:
+			m = image_ext.NewGray64f(r)
+		case color_ext.RGBModel:
+			m = image_ext.NewRGB(r)
+		case color_ext.RGB48Model:
+			m = image_ext.NewRGB48(r)
+		case color_ext.RGB48sModel:
+			m = image_ext.NewRGB48s(r)
+		case color_ext.RGB96iModel:
+			m = image_ext.NewRGB96i(r)
+		case color_ext.RGB96fModel:
+			m = image_ext.NewRGB96f(r)
+		case color_ext.RGB192fModel:
+			m = image_ext.NewRGB192f(r)
+		case color.RGBAModel:
+			m = image.NewRGBA(r)
+		case color.NRGBAModel:
+			m = image.NewNRGBA(r)
+		case color.RGBA64Model:
+			m = image.NewRGBA64(r)
+		case color.NRGBA64Model:
+			m = image.NewNRGBA64(r)
+		case color_ext.RGBA128fModel:
+			m = image_ext.NewRGBA128f(r)
+		default:
+			panic("image/tiff: newImage, unreachable!")
+		}
+	}
+	pix, stride, _ = imagePix(m)
+	return
+}
+
+// imagePix returns the pixels and the stride of m, or false if m is not a
+// standard image type.
+func imagePix(m image.Image) (pix []byte, stride int, ok bool) {
+	switch m := m.(type) {
+	case *image.Gray:
+		return m.Pix, m.Stride, true
+	case *image.Gray16:
+		return m.Pix, m.Stride, true
+	case *image_ext.Gray16s:
+		return m.Pix, m.Stride, true
+	case *image_ext.Gray32i:
+		return m.Pix, m.Stride, true
+	case *image_ext.Gray32f:
+		return m.Pix, m.Stride, true
+	case *image_ext.Gray64f:
+		return m.Pix, m.Stride, true
+	case *image_ext.RGB:
+		return m.Pix, m.Stride, true
+	case *image_ext.RGB48:
+		return m.Pix, m.Stride, true
+	case *image_ext.RGB48s:
+		return m.Pix, m.Stride, true
+	case *image_ext.RGB96i:
+		return m.Pix, m.Stride, true
+	case *image_ext.RGB96f:
+		return m.Pix, m.Stride, true
+	case *image_ext.RGB192f:
+		return m.Pix, m.Stride, true
+	case *image.RGBA:
+		return m.Pix, m.Stride, true
+	case *image.NRGBA:
+		return m.Pix, m.Stride, true
+	case *image.RGBA64:
+		return m.Pix, m.Stride, true
+	case *image.NRGBA64:
+		return m.Pix, m.Stride, true
+	case *image_ext.RGBA128f:
+		return m.Pix, m.Stride, true
+	case *image.Paletted:
+		return m.Pix, m.Stride, true
+	case *image_ext.MultiBand:
+		return m.Pix, m.Stride, true
+	}
+	return nil, 0, false
+}
+
+// decodeRow converts the samples of the TIFF file in src to the pixels of
+// the image in dst.
+func (p *pixelLayout) decodeRow(dst, src []byte, order binary.ByteOrder) {
+	p.convertRow(dst, p.pixSize, p.imageOrder(), src, p.fileSize(), order)
+}
+
+// encodeRow converts the pixels of the image in src to the samples of the
+// TIFF file in dst.
+func (p *pixelLayout) encodeRow(dst, src []byte, order binary.ByteOrder) {
+	p.convertRow(dst, p.fileSize(), order, src, p.pixSize, p.imageOrder())
+}
+
+// convertRow copies the samples of a row, and changes their byte order and
+// the padding of the pixels.
+func (p *pixelLayout) convertRow(dst []byte, dstSize int, dstOrder binary.ByteOrder, src []byte, srcSize int, srcOrder binary.ByteOrder) {
+	if p.bits == 8 && dstSize == srcSize {
+		copy(dst, src)
+		return
+	}
+	for i, j := 0, 0; i+srcSize <= len(src) && j+dstSize <= len(dst); i, j = i+srcSize, j+dstSize {
+		s, d := src[i:], dst[j:]
+		for k := 0; k < p.spp; k++ {
+			size := p.sampleSize(k)
+			switch size {
+			case 1:
+				d[0] = s[0]
+			case 2:
+				dstOrder.PutUint16(d, srcOrder.Uint16(s))
+			case 4:
+				dstOrder.PutUint32(d, srcOrder.Uint32(s))
+			case 8:
+				dstOrder.PutUint64(d, srcOrder.Uint64(s))
+			}
+			s, d = s[size:], d[size:]
+		}
+	}
+}
+
+// nativeOrder is the byte order of the samples of the image_ext types.
+type nativeOrder struct{}
+
+func (nativeOrder) Uint16(b []byte) uint16       { return builtin.Uint16(b) }
+func (nativeOrder) Uint32(b []byte) uint32       { return builtin.Uint32(b) }
+func (nativeOrder) Uint64(b []byte) uint64       { return builtin.Uint64(b) }
+func (nativeOrder) PutUint16(b []byte, v uint16) { builtin.PutUint16(b, v) }
+func (nativeOrder) PutUint32(b []byte, v uint32) { builtin.PutUint32(b, v) }
+func (nativeOrder) PutUint64(b []byte, v uint64) { builtin.PutUint64(b, v) }
+func (nativeOrder) String() string               { return "nativeOrder" }
@@ -0,0 +1,81 @@
+// Copyright 2014 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tiff
+
+// The LZW codes of TIFF (see p. 57-62 of the spec).
+const (
+	lzwClear    = 256
+	lzwEOI      = 257
+	lzwMaxWidth = 12
+	lzwMaxCode  = 4093 // the last code before the table is cleared
+)
+
+// lzwWriter writes the MSB first codes of the TIFF LZW compression.
+type lzwWriter struct {
+	out   []byte
+	bits  uint32
+	nbits uint
+	width uint
+}
+
+func (w *lzwWriter) writeCode(code uint32) {
+	w.bits = w.bits<<w.width | code
+	w.nbits += w.width
+	for w.nbits >= 8 {
+		w.out = append(w.out, byte(w.bits>>(w.nbits-8)))
+		w.nbits -= 8
+	}
+	w.bits &= 1<<w.nbits - 1
+}
+
+// compressLZW compresses data with the TIFF LZW compression. The code
+// width of TIFF is increased one code earlier than the compress/lzw
+// package, which is used by GIF and PDF.
+func compressLZW(data []byte) []byte {
+	w := &lzwWriter{width: 9}
+	w.writeCode(lzwClear)
+	if len(data) == 0 {
+		w.writeCode(lzwEOI)
+		return w.flush()
+	}
+
+	table := make(map[uint32]uint32)
+	hi := uint32(lzwEOI)
+	code := uint32(data[0])
+	for _, c := range data[1:] {
+		key := code<<8 | uint32(c)
+		if v, ok := table[key]; ok {
+			code = v
+			continue
+		}
+		w.writeCode(code)
+		code = uint32(c)
+		hi++
+		table[key] = hi
+		if hi+1 >= 1<<w.width && w.width < lzwMaxWidth {
+			w.width++
+		}
+		if hi >= lzwMaxCode {
+			w.writeCode(lzwClear)
+			table = make(map[uint32]uint32)
+			hi, w.width = lzwEOI, 9
+		}
+	}
+	w.writeCode(code)
+	if hi++; hi+1 >= 1<<w.width && w.width < lzwMaxWidth {
+		w.width++
+	}
+	w.writeCode(lzwEOI)
+	return w.flush()
+}
+
+// flush writes the remaining bits, and returns the compressed data.
+func (w *lzwWriter) flush() []byte {
+	if w.nbits > 0 {
+		w.out = append(w.out, byte(w.bits<<(8-w.nbits)))
+		w.nbits = 0
+	}
+	return w.out
+}
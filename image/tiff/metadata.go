@@ -0,0 +1,306 @@
+// Copyright 2014 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tiff
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"io"
+	"io/ioutil"
+	"math"
+	"sort"
+
+	image_ext "github.com/chai2010/gopkg/image"
+)
+
+// DecodeWithMetadata reads a TIFF image and its EXIF/XMP/ICC/GeoTIFF
+// metadata from r. The EXIF data is a little endian TIFF stream whose first
+// IFD holds the tags of the EXIF IFD.
+func DecodeWithMetadata(r io.Reader, opt *Options) (m image.Image, meta *image_ext.Metadata, err error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return
+	}
+	d, err := readIFD(bytes.NewReader(data))
+	if err != nil {
+		return
+	}
+	meta = readMetadata(bytes.NewReader(data), d)
+	if m, err = Decode(bytes.NewReader(data), opt); err != nil {
+		return
+	}
+	return
+}
+
+// EncodeWithMetadata writes the image m and its metadata to w in TIFF format.
+// The tags of the first IFD of the EXIF data are written to the EXIF IFD,
+// the EXIF data is dropped if it is malformed, its name is returned.
+func EncodeWithMetadata(w io.Writer, m image.Image, meta *image_ext.Metadata, opt *Options) (dropped []string, err error) {
+	var tags []ifdTag
+	if meta != nil {
+		tags, dropped = makeMetadataTags(meta)
+	}
+	err = encodePages(w, []page{{m: m, tags: tags}}, opt)
+	return
+}
+
+// readMetadata reads the EXIF IFD, and the XMP, ICC and GeoTIFF tags of d.
+// The malformed EXIF IFD is ignored.
+func readMetadata(r io.ReaderAt, d *ifd) *image_ext.Metadata {
+	meta := new(image_ext.Metadata)
+	if off := d.subIFDOffset(tExifIFD); off != 0 {
+		if exif, err := readIFDAt(r, d.order, d.big, off); err == nil {
+			if tags, err := readExifTags(r, exif, 0); err == nil {
+				meta.Exif = makeExif(tags)
+			}
+		}
+	}
+	if e, ok := d.raw[tXMP]; ok {
+		meta.XMP = append([]byte(nil), e.data...)
+	}
+	if e, ok := d.raw[tICCProfile]; ok {
+		meta.ICC = append([]byte(nil), e.data...)
+	}
+
+	geo := &image_ext.GeoTIFF{
+		ModelPixelScale:     d.doubles(tModelPixelScale),
+		ModelTiepoint:       d.doubles(tModelTiepoint),
+		ModelTransformation: d.doubles(tModelTransformation),
+		GeoDoubleParams:     d.doubles(tGeoDoubleParams),
+	}
+	for _, v := range d.entries[tGeoKeyDirectory] {
+		geo.GeoKeyDirectory = append(geo.GeoKeyDirectory, uint16(v))
+	}
+	if e, ok := d.raw[tGeoAsciiParams]; ok && e.datatype == dtASCII {
+		geo.GeoAsciiParams = string(bytes.TrimRight(e.data, "\x00"))
+	}
+	if !geo.IsEmpty() {
+		meta.GeoTIFF = geo
+	}
+	return meta
+}
+
+// doubles returns the DOUBLE values of the entry with the given tag.
+func (p *ifd) doubles(tag int) []float64 {
+	e, ok := p.raw[tag]
+	if !ok || e.datatype != dtDouble {
+		return nil
+	}
+	v := make([]float64, e.count)
+	for i := range v {
+		v[i] = math.Float64frombits(p.order.Uint64(e.data[8*i:]))
+	}
+	return v
+}
+
+// ifdTag is a new IFD entry, data is in the byte order of the file. If sub
+// is not nil, the entry points to the sub IFD of the tags.
+type ifdTag struct {
+	tag      int
+	datatype uint16
+	count    uint32
+	data     []byte
+	sub      []ifdTag
+}
+
+// makeMetadataTags returns the little endian EXIF IFD, XMP, ICC and GeoTIFF
+// tags of meta.
+func makeMetadataTags(meta *image_ext.Metadata) (tags []ifdTag, dropped []string) {
+	order := binary.LittleEndian
+	doubles := func(tag int, v []float64) {
+		if len(v) == 0 {
+			return
+		}
+		data := make([]byte, 8*len(v))
+		for i, x := range v {
+			order.PutUint64(data[8*i:], math.Float64bits(x))
+		}
+		tags = append(tags, ifdTag{tag, dtDouble, uint32(len(v)), data, nil})
+	}
+
+	if len(meta.XMP) != 0 {
+		tags = append(tags, ifdTag{tXMP, dtByte, uint32(len(meta.XMP)), meta.XMP, nil})
+	}
+	if len(meta.ICC) != 0 {
+		tags = append(tags, ifdTag{tICCProfile, dtUndefined, uint32(len(meta.ICC)), meta.ICC, nil})
+	}
+	if geo := meta.GeoTIFF; !geo.IsEmpty() {
+		doubles(tModelPixelScale, geo.ModelPixelScale)
+		doubles(tModelTiepoint, geo.ModelTiepoint)
+		doubles(tModelTransformation, geo.ModelTransformation)
+		if len(geo.GeoKeyDirectory) != 0 {
+			data := make([]byte, 2*len(geo.GeoKeyDirectory))
+			for i, x := range geo.GeoKeyDirectory {
+				order.PutUint16(data[2*i:], x)
+			}
+			tags = append(tags, ifdTag{tGeoKeyDirectory, dtShort, uint32(len(geo.GeoKeyDirectory)), data, nil})
+		}
+		doubles(tGeoDoubleParams, geo.GeoDoubleParams)
+		if len(geo.GeoAsciiParams) != 0 {
+			data := []byte(geo.GeoAsciiParams + "\x00")
+			tags = append(tags, ifdTag{tGeoAsciiParams, dtASCII, uint32(len(data)), data, nil})
+		}
+	}
+	if len(meta.Exif) != 0 {
+		if exif, err := parseExif(meta.Exif); err == nil {
+			tags = append(tags, ifdTag{tExifIFD, dtLong, 1, nil, exif})
+		} else {
+			dropped = append(dropped, image_ext.MetadataExif)
+		}
+	}
+	return
+}
+
+// exifMaxDepth is the max depth of the sub IFDs of the EXIF data, the
+// deeper IFDs are dropped, so the loops of the IFDs are stopped.
+const exifMaxDepth = 4
+
+// parseExif returns the little endian tags of the first IFD of the EXIF
+// data, which is a TIFF stream.
+func parseExif(data []byte) ([]ifdTag, error) {
+	r := bytes.NewReader(data)
+	order, big, off, err := readHeader(r)
+	if err != nil {
+		return nil, err
+	}
+	d, err := readIFDAt(r, order, big, off)
+	if err != nil {
+		return nil, err
+	}
+	return readExifTags(r, d, 0)
+}
+
+// readExifTags returns the little endian tags of the EXIF IFD d, the GPS
+// and interoperability IFDs are read as the sub IFDs. The BigTIFF types
+// are dropped, they can't be stored in the EXIF data.
+func readExifTags(r io.ReaderAt, d *ifd, depth int) (tags []ifdTag, err error) {
+	keys := make([]int, 0, len(d.raw))
+	for k := range d.raw {
+		keys = append(keys, k)
+	}
+	sort.Ints(keys)
+
+	// the tags of the empty IFD are not nil, see ifdTag
+	tags = make([]ifdTag, 0, len(keys))
+	for _, k := range keys {
+		e := d.raw[k]
+		switch k {
+		case tExifIFD, tGPSIFD, tInteropIFD:
+			off := d.subIFDOffset(k)
+			if off == 0 || depth >= exifMaxDepth {
+				continue
+			}
+			sub, err := readIFDAt(r, d.order, d.big, off)
+			if err != nil {
+				return nil, err
+			}
+			subTags, err := readExifTags(r, sub, depth+1)
+			if err != nil {
+				return nil, err
+			}
+			tags = append(tags, ifdTag{k, dtLong, 1, nil, subTags})
+			continue
+		}
+		if e.datatype > dtIFD {
+			continue
+		}
+		tags = append(tags, ifdTag{k, e.datatype, e.count, littleEndian(d.order, e), nil})
+	}
+	return
+}
+
+// littleEndian returns the little endian values of the entry.
+func littleEndian(order binary.ByteOrder, e ifdEntry) []byte {
+	data := append([]byte(nil), e.data...)
+	if order == binary.LittleEndian {
+		return data
+	}
+	size := int(lengths[e.datatype])
+	if e.datatype == dtRational || e.datatype == dtSRational {
+		// the numerator and the denominator
+		size = 4
+	}
+	for i := 0; i+size <= len(data); i += size {
+		for j, k := i, i+size-1; j < k; j, k = j+1, k-1 {
+			data[j], data[k] = data[k], data[j]
+		}
+	}
+	return data
+}
+
+// makeExif returns the EXIF data of the little endian tags, it's a little
+// endian TIFF stream whose first IFD holds the tags.
+func makeExif(tags []ifdTag) []byte {
+	buf := append([]byte(leHeader), 8, 0, 0, 0)
+	return appendExifIFD(buf, tags)
+}
+
+// appendExifIFD appends the IFD of the tags, and its values and sub IFDs
+// after it.
+func appendExifIFD(buf []byte, tags []ifdTag) []byte {
+	order := binary.LittleEndian
+	if len(buf)%2 != 0 {
+		buf = append(buf, 0)
+	}
+	off := len(buf)
+	buf = append(buf, make([]byte, 2+12*len(tags)+4)...)
+	order.PutUint16(buf[off:], uint16(len(tags)))
+	for i, t := range tags {
+		entry := off + 2 + 12*i
+		order.PutUint16(buf[entry:], uint16(t.tag))
+		order.PutUint16(buf[entry+2:], t.datatype)
+		order.PutUint32(buf[entry+4:], t.count)
+		switch {
+		case t.sub != nil:
+			if len(buf)%2 != 0 {
+				buf = append(buf, 0)
+			}
+			order.PutUint32(buf[entry+8:], uint32(len(buf)))
+			buf = appendExifIFD(buf, t.sub)
+		case len(t.data) <= 4:
+			copy(buf[entry+8:entry+12], t.data)
+		default:
+			if len(buf)%2 != 0 {
+				buf = append(buf, 0)
+			}
+			order.PutUint32(buf[entry+8:], uint32(len(buf)))
+			buf = append(buf, t.data...)
+		}
+	}
+	return buf
+}
+
+// subIFDOffset returns the offset of the sub IFD of the entry with the
+// given tag, or 0 if the tag does not exist.
+func (p *ifd) subIFDOffset(tag int) int64 {
+	e, ok := p.raw[tag]
+	if !ok || e.count != 1 {
+		return 0
+	}
+	switch e.datatype {
+	case dtLong, dtIFD:
+		return int64(p.order.Uint32(e.data))
+	case dtLong8, dtIFD8:
+		return int64(p.order.Uint64(e.data))
+	}
+	return 0
+}
+
+func imageExtDecodeWithMetadata(r io.Reader, opt *image_ext.Options) (image.Image, *image_ext.Metadata, error) {
+	p, err := newOptions(opt)
+	if err != nil {
+		return nil, nil, err
+	}
+	return DecodeWithMetadata(r, p)
+}
+
+func imageExtEncodeWithMetadata(w io.Writer, m image.Image, meta *image_ext.Metadata, opt *image_ext.Options) ([]string, error) {
+	p, err := newEncodeOptions(opt)
+	if err != nil {
+		return nil, err
+	}
+	return EncodeWithMetadata(w, m, meta, p)
+}
@@ -0,0 +1,168 @@
+// Copyright 2014 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tiff
+
+import (
+	"bytes"
+	"encoding/xml"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+
+	color_ext "github.com/chai2010/gopkg/image/color"
+)
+
+// GDAL tags, the band names and the nodata value of multi-band images.
+const (
+	tGDALMetadata = 42112
+	tGDALNoData   = 42113
+)
+
+// Sample formats (see p. 80 of the TIFF 6 spec).
+const (
+	sfUint  = 1
+	sfInt   = 2
+	sfFloat = 3
+)
+
+// multiBandModel returns the model of the multi-sample images, such as the
+// multispectral images with more than 4 bands, or false if d is not a
+// multi-sample image. The images of a standard image type are checked by
+// the caller first.
+func multiBandModel(d *ifd) (model *color_ext.MultiBandModel, ok bool) {
+	spp := int(d.firstVal(tSamplesPerPixel, 1))
+	photometric := d.firstVal(tPhotometricInterpretation, pBlackIsZero)
+	if spp <= 1 || (photometric != pBlackIsZero && photometric != pRGB) {
+		return nil, false
+	}
+
+	bits := d.entries[tBitsPerSample]
+	formats := d.entries[tSampleFormat]
+	if len(bits) != spp || (len(formats) != 0 && len(formats) != 1 && len(formats) != spp) {
+		return nil, false
+	}
+	band := make([]color_ext.BandInfo, spp)
+	for i := range band {
+		format := uint(sfUint)
+		switch len(formats) {
+		case 1:
+			format = formats[0]
+		case spp:
+			format = formats[i]
+		}
+		if band[i].DataType = sampleKind(bits[i], format); band[i].DataType == reflect.Invalid {
+			return nil, false
+		}
+	}
+	readGDALMetadata(d, band)
+	return color_ext.NewMultiBandModel(band...), true
+}
+
+// sampleKind returns the data type of the samples.
+func sampleKind(bits, format uint) reflect.Kind {
+	switch {
+	case bits == 8 && format == sfUint:
+		return reflect.Uint8
+	case bits == 16 && format == sfUint:
+		return reflect.Uint16
+	case bits == 16 && format == sfInt:
+		return reflect.Int16
+	case bits == 32 && format == sfInt:
+		return reflect.Int32
+	case bits == 32 && format == sfFloat:
+		return reflect.Float32
+	case bits == 64 && format == sfFloat:
+		return reflect.Float64
+	}
+	return reflect.Invalid
+}
+
+// sampleFormat returns the SampleFormat tag value of the data type.
+func sampleFormat(kind reflect.Kind) uint16 {
+	switch kind {
+	case reflect.Int16, reflect.Int32:
+		return sfInt
+	case reflect.Float32, reflect.Float64:
+		return sfFloat
+	}
+	return sfUint
+}
+
+// gdalMetadata is the XML value of the GDAL_METADATA tag.
+type gdalMetadata struct {
+	XMLName xml.Name           `xml:"GDALMetadata"`
+	Item    []gdalMetadataItem `xml:"Item"`
+}
+
+type gdalMetadataItem struct {
+	Name   string `xml:"name,attr"`
+	Sample int    `xml:"sample,attr"`
+	Role   string `xml:"role,attr,omitempty"`
+	Value  string `xml:",chardata"`
+}
+
+// readGDALMetadata reads the band names and the nodata value of d.
+func readGDALMetadata(d *ifd, band []color_ext.BandInfo) {
+	if e, ok := d.raw[tGDALNoData]; ok && e.datatype == dtASCII {
+		s := strings.TrimSpace(string(bytes.TrimRight(e.data, "\x00")))
+		if v, err := strconv.ParseFloat(s, 64); err == nil {
+			for i := range band {
+				band[i].NoData, band[i].HasNoData = v, true
+			}
+		}
+	}
+	if e, ok := d.raw[tGDALMetadata]; ok && e.datatype == dtASCII {
+		var meta gdalMetadata
+		if err := xml.Unmarshal(bytes.TrimRight(e.data, "\x00"), &meta); err != nil {
+			return
+		}
+		for _, item := range meta.Item {
+			if item.Name == "DESCRIPTION" && item.Sample >= 0 && item.Sample < len(band) {
+				band[item.Sample].Name = item.Value
+			}
+		}
+	}
+}
+
+// makeGDALTags returns the GDAL tags of the band names and the nodata
+// value. GDAL has only one nodata value for all the bands, the nodata
+// values are dropped if the bands have different nodata values.
+func makeGDALTags(model *color_ext.MultiBandModel) (tags []ifdTag) {
+	var meta gdalMetadata
+	for i, b := range model.Band {
+		if b.Name != "" {
+			meta.Item = append(meta.Item, gdalMetadataItem{
+				Name:   "DESCRIPTION",
+				Sample: i,
+				Role:   "description",
+				Value:  b.Name,
+			})
+		}
+	}
+	if len(meta.Item) != 0 {
+		if data, err := xml.Marshal(&meta); err == nil {
+			data = append(data, 0)
+			tags = append(tags, ifdTag{tGDALMetadata, dtASCII, uint32(len(data)), data, nil})
+		}
+	}
+
+	var noData *float64
+	for i, b := range model.Band {
+		if !b.HasNoData {
+			return
+		}
+		if i == 0 {
+			noData = &model.Band[0].NoData
+		} else if b.NoData != *noData && !(math.IsNaN(b.NoData) && math.IsNaN(*noData)) {
+			return
+		}
+	}
+	if noData != nil {
+		data := []byte(strconv.FormatFloat(*noData, 'g', -1, 64) + "\x00")
+		tags = append(tags, ifdTag{tGDALNoData, dtASCII, uint32(len(data)), data, nil})
+	}
+	return
+}
@@ -0,0 +1,298 @@
+// Copyright 2014 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tiff
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"io"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"runtime"
+	"testing"
+
+	"code.google.com/p/go.image/tiff"
+)
+
+const testdataDir = "../testdata/"
+
+var tTestdataList = []string{
+	"video-001.tiff",
+	"video-001-16bit.tiff",
+	"video-001-gray.tiff",
+	"video-001-gray-16bit.tiff",
+	"video-001-paletted.tiff",
+	"video-001-strip-64.tiff",
+	"video-001-tile-64x64.tiff",
+	"video-001-uncompressed.tiff",
+	"blue-purple-pink.lzwcompressed.tiff",
+	"bw-deflate.tiff",
+	"bw-packbits.tiff",
+	"no_compress.tiff",
+	"no_rps.tiff",
+}
+
+func compare(t *testing.T, img0, img1 image.Image) {
+	b := img1.Bounds()
+	if !b.Eq(img0.Bounds()) {
+		t.Fatalf("wrong image size: want %s, got %s", img0.Bounds(), b)
+	}
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			c0 := img0.At(x, y)
+			c1 := img1.At(x, y)
+			r0, g0, b0, a0 := c0.RGBA()
+			r1, g1, b1, a1 := c1.RGBA()
+			if r0 != r1 || g0 != g1 || b0 != b1 || a0 != a1 {
+				t.Fatalf("pixel at (%d, %d) has wrong color: want %v, got %v", x, y, c0, c1)
+			}
+		}
+	}
+}
+
+// TestDecode tests that the images decoded by the Reader have the same
+// colors as the images decoded by code.google.com/p/go.image/tiff.
+func TestDecode(t *testing.T) {
+	for _, name := range tTestdataList {
+		data, err := ioutil.ReadFile(testdataDir + name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		m0, err := tiff.Decode(bytes.NewReader(data))
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		m1, err := Decode(bytes.NewReader(data), nil)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		compare(t, m0, m1)
+	}
+}
+
+func TestReader_tiles(t *testing.T) {
+	for _, v := range []struct {
+		Name         string
+		Tiled        bool
+		TileW, TileH int
+		Across, Down int
+	}{
+		{"video-001-tile-64x64.tiff", true, 64, 64, 3, 2},
+		{"video-001-strip-64.tiff", false, 150, 64, 1, 2},
+	} {
+		f, err := os.Open(testdataDir + v.Name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+		p, err := NewReader(f, nil)
+		if err != nil {
+			t.Fatalf("%s: %v", v.Name, err)
+		}
+		if got := p.Tiled(); got != v.Tiled {
+			t.Fatalf("%s: Tiled: got %v, want %v", v.Name, got, v.Tiled)
+		}
+		if w, h := p.TileSize(); w != v.TileW || h != v.TileH {
+			t.Fatalf("%s: TileSize: got %dx%d, want %dx%d", v.Name, w, h, v.TileW, v.TileH)
+		}
+		across, down := p.Tiles()
+		if across != v.Across || down != v.Down {
+			t.Fatalf("%s: Tiles: got %dx%d, want %dx%d", v.Name, across, down, v.Across, v.Down)
+		}
+
+		golden, err := p.ReadRect(p.bounds, nil)
+		if err != nil {
+			t.Fatalf("%s: %v", v.Name, err)
+		}
+		for ty := 0; ty < down; ty++ {
+			for tx := 0; tx < across; tx++ {
+				m, err := p.ReadTile(tx, ty)
+				if err != nil {
+					t.Fatalf("%s: ReadTile(%d, %d): %v", v.Name, tx, ty, err)
+				}
+				r := image.Rect(tx*v.TileW, ty*v.TileH, (tx+1)*v.TileW, (ty+1)*v.TileH).Intersect(p.bounds)
+				compare(t, golden.(interface {
+					SubImage(r image.Rectangle) image.Image
+				}).SubImage(r), m)
+			}
+		}
+		if _, err := p.ReadTile(across, 0); err == nil {
+			t.Fatalf("%s: ReadTile out of the image: expect error", v.Name)
+		}
+	}
+}
+
+func TestNewReader_unsupported(t *testing.T) {
+	// the bilevel images are decoded by code.google.com/p/go.image/tiff
+	f, err := os.Open(testdataDir + "bw-deflate.tiff")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if _, err := NewReader(f, nil); err == nil {
+		t.Fatalf("expect UnsupportedError")
+	} else if _, ok := err.(UnsupportedError); !ok {
+		t.Fatalf("expect UnsupportedError, got %v", err)
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := NewTileReader(f, fi.Size(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.ReadRect(image.Rect(0, 0, 8, 8), nil); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// tEntryOffset returns the offset of the value of the tag in the first IFD
+// of the little endian TIFF file in data.
+func tEntryOffset(data []byte, tag int) int {
+	off := int(binary.LittleEndian.Uint32(data[4:]))
+	n := int(binary.LittleEndian.Uint16(data[off:]))
+	for i := 0; i < n; i++ {
+		e := data[off+2+i*12:]
+		if int(binary.LittleEndian.Uint16(e)) == tag {
+			return off + 2 + i*12 + 8
+		}
+	}
+	return -1
+}
+
+func TestDecode_corrupt(t *testing.T) {
+	m0 := image.NewRGBA(image.Rect(0, 0, 40, 30))
+	var buf bytes.Buffer
+	if err := Encode(&buf, m0, &Options{Compression: Deflate}); err != nil {
+		t.Fatal(err)
+	}
+	data := buf.Bytes()
+
+	for i, v := range []struct {
+		Tag   int
+		Value uint32
+	}{
+		{tStripByteCounts, 0xffffffff},
+		{tStripOffsets, 0xfffffff0},
+		{tImageWidth, 0x7fffffff},
+		{tImageLength, 0x7fffffff},
+	} {
+		bad := append([]byte(nil), data...)
+		off := tEntryOffset(bad, v.Tag)
+		if off < 0 {
+			t.Fatalf("%d: tag %d not found", i, v.Tag)
+		}
+		binary.LittleEndian.PutUint32(bad[off:], v.Value)
+		if _, err := Decode(bytes.NewReader(bad), nil); err == nil {
+			t.Fatalf("%d: tag %d: expect error", i, v.Tag)
+		}
+	}
+
+	// the truncated files, the missing offset of the next IFD at the end
+	// of the file is ignored
+	for n := 0; n < len(data)-4; n++ {
+		if _, err := Decode(bytes.NewReader(data[:n]), nil); err == nil {
+			t.Fatalf("truncated at %d: expect error", n)
+		}
+	}
+
+	// the size of the ReaderAt is unknown
+	bad := append([]byte(nil), data...)
+	binary.LittleEndian.PutUint32(bad[tEntryOffset(bad, tStripByteCounts):], 0xffffffff)
+	p, err := NewReader(struct{ io.ReaderAt }{bytes.NewReader(bad)}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.ReadRect(p.bounds, nil); err == nil {
+		t.Fatalf("expect error")
+	}
+}
+
+func TestDecode_corruptEntry(t *testing.T) {
+	var buf bytes.Buffer
+	if err := Encode(&buf, image.NewGray(image.Rect(0, 0, 40, 30)), nil); err != nil {
+		t.Fatal(err)
+	}
+	bad := buf.Bytes()
+
+	// 1<<27 doubles of the strip byte counts are 1GB
+	off := tEntryOffset(bad, tStripByteCounts)
+	binary.LittleEndian.PutUint16(bad[off-6:], dtDouble)
+	binary.LittleEndian.PutUint32(bad[off-4:], 1<<27)
+
+	var m0, m1 runtime.MemStats
+	runtime.ReadMemStats(&m0)
+	if _, err := readIFD(bytes.NewReader(bad)); err == nil {
+		t.Fatalf("expect error")
+	} else if _, ok := err.(FormatError); !ok {
+		t.Fatalf("expect FormatError, got %v", err)
+	}
+	if _, err := readIFD(struct{ io.ReaderAt }{bytes.NewReader(bad)}); err == nil {
+		t.Fatalf("unknown size: expect error")
+	}
+	if runtime.ReadMemStats(&m1); m1.TotalAlloc-m0.TotalAlloc > 1<<26 {
+		t.Fatalf("bad alloc size: %d", m1.TotalAlloc-m0.TotalAlloc)
+	}
+}
+
+// tCountReaderAt counts the bytes read by ReadAt.
+type tCountReaderAt struct {
+	r io.ReaderAt
+	n int
+}
+
+func (p *tCountReaderAt) Read(b []byte) (int, error) {
+	return 0, fmt.Errorf("unexpected Read")
+}
+
+func (p *tCountReaderAt) ReadAt(b []byte, off int64) (n int, err error) {
+	n, err = p.r.ReadAt(b, off)
+	p.n += n
+	return
+}
+
+func TestDecode_reader(t *testing.T) {
+	m0 := image.NewRGBA(image.Rect(0, 0, 400, 300))
+	for i := range m0.Pix {
+		m0.Pix[i] = uint8(i * 7)
+	}
+	var buf bytes.Buffer
+	if err := Encode(&buf, m0, nil); err != nil {
+		t.Fatal(err)
+	}
+	data := buf.Bytes()
+
+	// only the header and the first IFD are read
+	r := &tCountReaderAt{r: bytes.NewReader(data)}
+	config, err := DecodeConfig(r)
+	if err != nil {
+		t.Fatalf("DecodeConfig: %v", err)
+	}
+	if config.Width != 400 || config.Height != 300 || r.n > 4096 {
+		t.Fatalf("DecodeConfig: bad config %v, %d bytes read", config, r.n)
+	}
+
+	// the io.Reader is buffered
+	for _, r := range []io.Reader{bytes.NewReader(data), struct{ io.Reader }{bytes.NewReader(data)}} {
+		config, err := DecodeConfig(r)
+		if err != nil || config.Width != 400 || config.Height != 300 {
+			t.Fatalf("DecodeConfig(%T): %v, %v", r, err, config)
+		}
+	}
+	m1, err := Decode(struct{ io.Reader }{bytes.NewReader(data)}, nil)
+	if err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+	if !reflect.DeepEqual(m0, m1) {
+		t.Fatalf("Decode: bad image")
+	}
+	if _, err = Decode(struct{ io.Reader }{bytes.NewReader(data[:len(data)/2])}, nil); err == nil {
+		t.Fatalf("Decode: expect error")
+	}
+}
@@ -2,17 +2,17 @@
 // Use of this source code is governed by a BSD-style
 // license that can be found in the LICENSE file.
 
-// Package tiff implements a TIFF image decoder and encoder.
+// Package tiff implements a TIFF and BigTIFF image decoder and encoder.
 //
 // The TIFF specification is at http://partners.adobe.com/public/developer/en/tiff/TIFF6.pdf
+// The BigTIFF specification is at http://www.awaresystems.be/imaging/tiff/bigtiff.html
 package tiff
 
-// BUG(chai2010): support Gray32f/RGB/RGB48/RGB96f/RGBA128f.
-
 import (
 	"image"
 	"image/color"
 	"io"
+	"math"
 
 	"code.google.com/p/go.image/tiff"
 	image_ext "github.com/chai2010/gopkg/image"
@@ -20,71 +20,162 @@ import (
 )
 
 const (
-	leHeader = "II\x2A\x00" // Header for little-endian files.
-	beHeader = "MM\x00\x2A" // Header for big-endian files.
+	leHeader    = "II\x2A\x00" // Header for little-endian files.
+	beHeader    = "MM\x00\x2A" // Header for big-endian files.
+	bigLEHeader = "II\x2B\x00" // Header for little-endian BigTIFF files.
+	bigBEHeader = "MM\x00\x2B" // Header for big-endian BigTIFF files.
 )
 
+// DefaultQuality is the quality of the JPEG compression if Quality is zero.
+const DefaultQuality = 90
+
 // Options are the encoding and decoding parameters.
 type Options struct {
-	*tiff.Options
-	ColorModel color.Model
+	ColorModel   color.Model  // convert the image to ColorModel
+	Compression  CompressType // the compression of Encode, Uncompressed if zero
+	Predictor    bool         // use the predictor with Deflate and LZW, the floating point predictor for the float samples
+	Quality      float32      // 1 ~ 100 of the JPEG compression, DefaultQuality if zero
+	TileWidth    int          // the tile width, a multiple of 16, 0 writes the strips
+	TileHeight   int          // the tile height, a multiple of 16, TileWidth if zero
+	RowsPerStrip int          // the rows of the strips, the strips are about 8KB if zero
+	Planar       bool         // store every sample in its own plane
+	BigTIFF      bool         // write BigTIFF, it's used anyway if the pixels are larger than 4GB
+}
+
+// A FormatError reports that the input is not a valid TIFF image.
+type FormatError string
+
+func (e FormatError) Error() string {
+	return "image/tiff: invalid format: " + string(e)
+}
+
+// An UnsupportedError reports that the image uses a valid but unimplemented
+// TIFF feature.
+type UnsupportedError string
+
+func (e UnsupportedError) Error() string {
+	return "image/tiff: unsupported feature: " + string(e)
 }
 
 // DecodeConfig returns the color model and dimensions of a TIFF image without
-// decoding the entire image.
+// decoding the entire image. Only the header and the first IFD are read.
 func DecodeConfig(r io.Reader) (config image.Config, err error) {
-	return tiff.DecodeConfig(r)
+	ra := newReaderAt(r)
+	p, err := NewReader(ra, nil)
+	if _, ok := err.(UnsupportedError); ok {
+		return tiff.DecodeConfig(io.NewSectionReader(ra, 0, math.MaxInt64))
+	}
+	if err != nil {
+		return
+	}
+	config = p.Config()
+	return
 }
 
-// Decode reads a TIFF image from r and returns it as an image.Image.
-// The type of Image returned depends on the contents of the TIFF.
+// Decode reads a TIFF or BigTIFF image from r and returns it as an
+// image.Image. The type of Image returned depends on the contents of the
+// TIFF, see NewReader. The multi-sample images which have no standard image
+// type, such as the multispectral images, are returned as image.MultiBand,
+// with the band names and nodata value in the GDAL tags.
 func Decode(r io.Reader, opt *Options) (m image.Image, err error) {
-	if m, err = tiff.Decode(r); err != nil {
+	ra := newReaderAt(r)
+	p, err := NewReader(ra, opt)
+	if _, ok := err.(UnsupportedError); ok {
+		if m, err = tiff.Decode(io.NewSectionReader(ra, 0, math.MaxInt64)); err != nil {
+			return
+		}
+		if opt != nil && opt.ColorModel != nil {
+			m = convert.ColorModel(m, opt.ColorModel)
+		}
 		return
 	}
-	if opt != nil && opt.ColorModel != nil {
-		m = convert.ColorModel(m, opt.ColorModel)
+	if err != nil {
+		return
 	}
-	return
+	return p.ReadRect(p.bounds, nil)
 }
 
-// Encode writes the image m to w. opt determines the options used for
-// encoding, such as the compression type. If opt is nil, an uncompressed
-// image is written.
-func Encode(w io.Writer, m image.Image, opt *Options) error {
-	if opt != nil && opt.ColorModel != nil {
-		m = convert.ColorModel(m, opt.ColorModel)
+func imageDecode(r io.Reader) (image.Image, error) {
+	return Decode(r, nil)
+}
+
+// newOptions converts the common options to the tiff options.
+func newOptions(opt *image_ext.Options) (*Options, error) {
+	var p Options
+	if ok, err := image_ext.ConvertOptions("tiff", opt, &p); !ok {
+		return nil, err
 	}
-	if opt != nil && opt.Options != nil {
-		return tiff.Encode(w, m, opt.Options)
-	} else {
-		return tiff.Encode(w, m, nil)
+	return &p, nil
+}
+
+// newEncodeOptions converts the common options to the tiff options,
+// the Quality is used by the lossy JPEG compression.
+func newEncodeOptions(opt *image_ext.Options) (*Options, error) {
+	var p Options
+	ok, err := image_ext.ConvertEncodeOptions("tiff", opt, &p, image_ext.EncodeSupport{
+		Quality: true,
+		Compression: []image_ext.Compression{
+			image_ext.CompressionNone,
+			image_ext.CompressionDeflate,
+			image_ext.CompressionLZW,
+			image_ext.CompressionPackBits,
+		},
+	})
+	if !ok {
+		return nil, err
+	}
+	if opt.Quality != 0 {
+		if opt.Lossless || opt.Compression != image_ext.CompressionDefault {
+			return nil, image_ext.NewUnsupportedOptionError("tiff", "Quality with lossless compression")
+		}
+		p.Compression = JPEG
+		p.Quality = opt.Quality
 	}
+	switch opt.Compression {
+	case image_ext.CompressionNone:
+		p.Compression = Uncompressed
+	case image_ext.CompressionDeflate:
+		p.Compression = Deflate
+	case image_ext.CompressionLZW:
+		p.Compression = LZW
+	case image_ext.CompressionPackBits:
+		p.Compression = PackBits
+	}
+	return &p, nil
 }
 
-func imageExtDecode(r io.Reader, opt interface{}) (image.Image, error) {
-	if opt, ok := opt.(*Options); ok {
-		return Decode(r, opt)
-	} else {
-		return Decode(r, nil)
+func imageExtDecode(r io.Reader, opt *image_ext.Options) (image.Image, error) {
+	p, err := newOptions(opt)
+	if err != nil {
+		return nil, err
 	}
+	return Decode(r, p)
 }
 
-func imageExtEncode(w io.Writer, m image.Image, opt interface{}) error {
-	if opt, ok := opt.(*Options); ok {
-		return Encode(w, m, opt)
-	} else {
-		return Encode(w, m, nil)
+func imageExtEncode(w io.Writer, m image.Image, opt *image_ext.Options) error {
+	p, err := newEncodeOptions(opt)
+	if err != nil {
+		return err
 	}
+	return Encode(w, m, p)
 }
 
 func init() {
+	// the TIFF headers are registered by code.google.com/p/go.image/tiff
+	image.RegisterFormat("tiff", bigLEHeader, imageDecode, DecodeConfig)
+	image.RegisterFormat("tiff", bigBEHeader, imageDecode, DecodeConfig)
+
 	image_ext.RegisterFormat(image_ext.Format{
-		Name:         "tiff",
-		Extensions:   []string{".tiff", ".tif"},
-		Magics:       []string{leHeader, beHeader},
-		DecodeConfig: DecodeConfig,
-		Decode:       imageExtDecode,
-		Encode:       imageExtEncode,
+		Name:               "tiff",
+		Extensions:         []string{".tiff", ".tif"},
+		Magics:             []string{leHeader, beHeader, bigLEHeader, bigBEHeader},
+		DecodeConfig:       DecodeConfig,
+		Decode:             imageExtDecode,
+		Encode:             imageExtEncode,
+		NewTileReader:      imageExtNewTileReader,
+		DecodeWithMetadata: imageExtDecodeWithMetadata,
+		EncodeWithMetadata: imageExtEncodeWithMetadata,
+		DecodeAll:          imageExtDecodeAll,
+		EncodeAll:          imageExtEncodeAll,
 	})
 }
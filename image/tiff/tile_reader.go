@@ -0,0 +1,587 @@
+// Copyright 2014 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tiff
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"io"
+	"io/ioutil"
+	"os"
+
+	"code.google.com/p/go.image/tiff/lzw"
+	image_ext "github.com/chai2010/gopkg/image"
+	"github.com/chai2010/gopkg/image/convert"
+)
+
+// Reader reads the rectangles, the strips and the tiles of a TIFF image
+// without decoding the entire image, only the strips or tiles inside the
+// rectangles are read and decompressed. The Reader reads r with ReadAt
+// only, it's safe for concurrent use.
+type Reader struct {
+	r      io.ReaderAt
+	size   int64 // the size of r, or -1 if unknown
+	opt    *Options
+	order  binary.ByteOrder
+	config image.Config
+	bounds image.Rectangle
+	layout *pixelLayout
+
+	compression uint
+	predictor   uint
+	planar      bool   // every sample is stored in its own plane
+	jpegTables  []byte // the JPEG tables shared by the JPEG strips or tiles
+
+	tiled          bool
+	blockW, blockH int
+	blocksAcross   int
+	blocksDown     int
+	offsets        []uint
+	counts         []uint
+}
+
+// maxCompressionRatio is the largest plausible ratio of the pixel data size
+// to the compressed data size, which is larger than the ratios of the
+// deflate, LZW, PackBits and JPEG compressions.
+const maxCompressionRatio = 1 << 12
+
+// NewReader returns a Reader for the first page of the TIFF or BigTIFF
+// image stored in r. The images are read into the standard types, or the
+// image_ext types like *image_ext.Gray32f, *image_ext.RGB48 and
+// *image_ext.RGB96f, or *image_ext.MultiBand if there is no standard type.
+// An UnsupportedError is returned if the image layout is not supported,
+// such as the bilevel images and the CCITT compression.
+func NewReader(r io.ReaderAt, opt *Options) (p *Reader, err error) {
+	d, err := readIFD(r)
+	if err != nil {
+		return
+	}
+	return newReader(r, readerSize(r), d, opt)
+}
+
+// readerSize returns the size of r, or -1 if it's unknown.
+func readerSize(r io.ReaderAt) int64 {
+	switch r := r.(type) {
+	case interface {
+		Size() int64
+	}:
+		return r.Size()
+	case interface {
+		Stat() (os.FileInfo, error)
+	}:
+		if fi, err := r.Stat(); err == nil {
+			return fi.Size()
+		}
+	}
+	return -1
+}
+
+// NewTileReader returns a TileReader for the TIFF image stored in r.
+// The images supported by NewReader are read strip by strip or tile by
+// tile, other images are decoded once and the rectangles are taken from it.
+func NewTileReader(r io.ReaderAt, size int64, opt *Options) (p image_ext.TileReader, err error) {
+	d, err := readIFD(r)
+	if err != nil {
+		return
+	}
+	tr, err := newReader(r, size, d, opt)
+	if _, ok := err.(UnsupportedError); ok {
+		var m image.Image
+		if m, err = Decode(io.NewSectionReader(r, 0, size), opt); err != nil {
+			return
+		}
+		p = image_ext.NewImageTileReader(m)
+		return
+	}
+	if err != nil {
+		return
+	}
+	p = tr
+	return
+}
+
+// newReader returns a Reader for the image of d, size is the size of r or
+// -1 if it's unknown.
+func newReader(r io.ReaderAt, size int64, d *ifd, opt *Options) (p *Reader, err error) {
+	p = &Reader{
+		r:           r,
+		size:        size,
+		opt:         opt,
+		order:       d.order,
+		compression: d.firstVal(tCompression, cNone),
+		predictor:   d.firstVal(tPredictor, prNone),
+		planar:      d.firstVal(tPlanarConfiguration, 1) == 2,
+	}
+	width := int(d.firstVal(tImageWidth, 0))
+	height := int(d.firstVal(tImageLength, 0))
+	if width <= 0 || height <= 0 {
+		return nil, fmt.Errorf("image/tiff: bad image size: %dx%d", width, height)
+	}
+	p.bounds = image.Rect(0, 0, width, height)
+
+	switch p.compression {
+	case cNone, cDeflate, cDeflateNew, cLZW, cPackBits:
+	case cJPEG:
+		p.predictor = prNone
+		if e, ok := d.raw[tJPEGTables]; ok {
+			p.jpegTables = e.data
+		}
+	default:
+		return nil, UnsupportedError(fmt.Sprintf("compression value %d", p.compression))
+	}
+
+	if p.layout, err = readPixelLayout(d, p.compression); err != nil {
+		return nil, err
+	}
+	if p.compression == cJPEG {
+		if p.layout.bits != 8 || p.layout.palette != nil || (!p.planar && p.layout.spp != 1 && p.layout.spp != 3) {
+			return nil, UnsupportedError("JPEG compression of the samples other than 8 bits Gray or RGB")
+		}
+	}
+	switch p.predictor {
+	case prNone:
+	case prHorizontal:
+		if p.layout.bits == 0 {
+			return nil, UnsupportedError("predictor with the samples of different sizes")
+		}
+	case prFloatingPoint:
+		if p.layout.bits == 0 || p.layout.format != sfFloat {
+			return nil, UnsupportedError("floating point predictor with the integer samples")
+		}
+	default:
+		return nil, UnsupportedError(fmt.Sprintf("predictor value %d", p.predictor))
+	}
+
+	p.config = image.Config{ColorModel: p.layout.model, Width: width, Height: height}
+	if opt != nil && opt.ColorModel != nil {
+		p.config.ColorModel = opt.ColorModel
+	}
+
+	if _, p.tiled = d.entries[tTileWidth]; p.tiled {
+		p.blockW = int(d.firstVal(tTileWidth, 0))
+		p.blockH = int(d.firstVal(tTileLength, 0))
+		p.offsets = d.entries[tTileOffsets]
+		p.counts = d.entries[tTileByteCounts]
+	} else {
+		p.blockW = width
+		p.blockH = int(d.firstVal(tRowsPerStrip, uint(height)))
+		p.offsets = d.entries[tStripOffsets]
+		p.counts = d.entries[tStripByteCounts]
+	}
+	if p.blockW <= 0 || p.blockH <= 0 {
+		return nil, fmt.Errorf("image/tiff: bad strip or tile size: %dx%d", p.blockW, p.blockH)
+	}
+	if !p.tiled && p.blockH > height {
+		p.blockH = height
+	}
+	p.blocksAcross = (width + p.blockW - 1) / p.blockW
+	p.blocksDown = (height + p.blockH - 1) / p.blockH
+	n := p.blocksAcross * p.blocksDown
+	if p.planar {
+		n *= p.layout.spp
+	}
+	if len(p.offsets) < n || len(p.counts) < n {
+		return nil, fmt.Errorf("image/tiff: not enough strip or tile offsets: %d < %d", len(p.offsets), n)
+	}
+
+	// the corrupt offsets and sizes are rejected before any pixels are
+	// allocated
+	var dataSize float64
+	for i := 0; i < n; i++ {
+		if size >= 0 && (p.counts[i] > uint(size) || p.offsets[i] > uint(size)-p.counts[i]) {
+			return nil, fmt.Errorf("image/tiff: strip or tile %d out of the file: offset %d, size %d", i, p.offsets[i], p.counts[i])
+		}
+		dataSize += float64(p.counts[i])
+	}
+	if float64(width)*float64(height)*float64(p.layout.fileSize()) > dataSize*maxCompressionRatio {
+		return nil, fmt.Errorf("image/tiff: image size %dx%d exceeds the pixel data size %.0f", width, height, dataSize)
+	}
+	return p, nil
+}
+
+// readPixelLayout returns the layout of the samples of d.
+func readPixelLayout(d *ifd, compression uint) (layout *pixelLayout, err error) {
+	photometric := d.firstVal(tPhotometricInterpretation, pBlackIsZero)
+	spp := int(d.firstVal(tSamplesPerPixel, 1))
+	extra := d.firstVal(tExtraSamples, 0)
+	if photometric == pYCbCr && compression == cJPEG {
+		// the JPEG decoder converts YCbCr to RGB
+		photometric = pRGB
+	}
+
+	bits, ok := uniformValue(d.entries[tBitsPerSample], spp, 1)
+	if !ok {
+		if bands, ok := multiBandModel(d); ok {
+			return newMultiBandLayout(bands), nil
+		}
+		return nil, UnsupportedError("samples of different sizes")
+	}
+	format, ok := uniformValue(d.entries[tSampleFormat], spp, sfUint)
+	if !ok {
+		if bands, ok := multiBandModel(d); ok {
+			return newMultiBandLayout(bands), nil
+		}
+		return nil, UnsupportedError("samples of different formats")
+	}
+
+	if photometric == pPaletted {
+		if spp != 1 || bits != 8 {
+			return nil, UnsupportedError(fmt.Sprintf("paletted image of %d bits", bits))
+		}
+		val := d.entries[tColorMap]
+		numcolors := len(val) / 3
+		if len(val)%3 != 0 || numcolors <= 0 || numcolors > 256 {
+			return nil, fmt.Errorf("image/tiff: bad ColorMap length: %d", len(val))
+		}
+		palette := make(color.Palette, numcolors)
+		for i := 0; i < numcolors; i++ {
+			palette[i] = color.RGBA64{
+				uint16(val[i]),
+				uint16(val[i+numcolors]),
+				uint16(val[i+2*numcolors]),
+				0xffff,
+			}
+		}
+		return newPalettedLayout(palette), nil
+	}
+	if layout, ok = findPixelLayout(photometric, spp, int(bits), format, extra); ok {
+		return layout, nil
+	}
+	if bands, ok := multiBandModel(d); ok {
+		return newMultiBandLayout(bands), nil
+	}
+	return nil, UnsupportedError(fmt.Sprintf(
+		"photometric value %d with %d samples of %d bits", photometric, spp, bits,
+	))
+}
+
+// uniformValue returns the value shared by the n values of a tag, which
+// may have one value for all the samples, or def if there is no value.
+func uniformValue(val []uint, n int, def uint) (v uint, ok bool) {
+	switch {
+	case len(val) == 0:
+		return def, true
+	case len(val) != 1 && len(val) != n:
+		return 0, false
+	}
+	for _, x := range val[1:] {
+		if x != val[0] {
+			return 0, false
+		}
+	}
+	return val[0], true
+}
+
+func (p *Reader) Config() image.Config {
+	return p.config
+}
+
+// Tiled reports whether the image is stored in tiles, or in strips.
+func (p *Reader) Tiled() bool {
+	return p.tiled
+}
+
+// TileSize returns the size of the tiles, or the image width and the rows
+// per strip of the striped images.
+func (p *Reader) TileSize() (width, height int) {
+	return p.blockW, p.blockH
+}
+
+// Tiles returns the number of the tiles or the strips across and down the
+// image.
+func (p *Reader) Tiles() (across, down int) {
+	return p.blocksAcross, p.blocksDown
+}
+
+// ReadTile reads the tile or the strip at column tx and row ty, the tiles
+// on the right and the bottom edges are cut to the image bounds.
+func (p *Reader) ReadTile(tx, ty int) (m image.Image, err error) {
+	if tx < 0 || tx >= p.blocksAcross || ty < 0 || ty >= p.blocksDown {
+		err = fmt.Errorf("image/tiff: ReadTile, bad tile: (%d, %d)", tx, ty)
+		return
+	}
+	return p.ReadRect(image.Rect(
+		tx*p.blockW, ty*p.blockH,
+		(tx+1)*p.blockW, (ty+1)*p.blockH,
+	), nil)
+}
+
+func (p *Reader) ReadRect(r image.Rectangle, buf image_ext.ImageBuffer) (m image.Image, err error) {
+	r = r.Intersect(p.bounds)
+	if r.Empty() {
+		err = fmt.Errorf("image/tiff: ReadRect, empty rect: %v", r)
+		return
+	}
+
+	m, pix, stride := p.newImage(r, buf)
+	fileSize := p.layout.fileSize()
+	for by := r.Min.Y / p.blockH; by*p.blockH < r.Max.Y; by++ {
+		for bx := r.Min.X / p.blockW; bx*p.blockW < r.Max.X; bx++ {
+			br := image.Rect(
+				bx*p.blockW, by*p.blockH,
+				(bx+1)*p.blockW, (by+1)*p.blockH,
+			).Intersect(p.bounds)
+			ir := br.Intersect(r)
+
+			var data []byte
+			if data, err = p.readBlock(by*p.blocksAcross+bx, br); err != nil {
+				return
+			}
+			for y := ir.Min.Y; y < ir.Max.Y; y++ {
+				src := data[((y-br.Min.Y)*p.blockW+(ir.Min.X-br.Min.X))*fileSize:][:ir.Dx()*fileSize]
+				dst := pix[(y-r.Min.Y)*stride+(ir.Min.X-r.Min.X)*p.layout.pixSize:]
+				p.layout.decodeRow(dst, src, p.order)
+			}
+		}
+	}
+
+	// convert color model
+	if p.opt != nil && p.opt.ColorModel != nil {
+		m = convert.ColorModel(m, p.opt.ColorModel)
+	}
+	return
+}
+
+func (p *Reader) Close() error {
+	return nil
+}
+
+// newImage returns the image for r, and the pixels and stride from r.Min.
+func (p *Reader) newImage(r image.Rectangle, buf image_ext.ImageBuffer) (m image.Image, pix []byte, stride int) {
+	if p.opt != nil && p.opt.ColorModel != nil {
+		buf = nil
+	}
+	// the palettes are not comparable
+	if buf != nil && p.layout.palette == nil && r.In(buf.Bounds()) && buf.ColorModel() == p.config.ColorModel {
+		sub := buf.SubImage(r)
+		if pix, stride, ok := imagePix(sub); ok {
+			return sub, pix, stride
+		}
+	}
+	return p.layout.newImage(r)
+}
+
+// readBlock reads the strip or tile i, br is its bounds. The samples of
+// the pixels are interleaved and in the byte order of the file.
+func (p *Reader) readBlock(i int, br image.Rectangle) (data []byte, err error) {
+	rows := p.blockH
+	if !p.tiled {
+		// the last strip may be shorter
+		rows = br.Dy()
+	}
+	if !p.planar {
+		return p.readChunk(i, rows, p.layout.spp, p.layout.bits, p.layout.fileSize())
+	}
+
+	// interleave the planes of the samples
+	pixSize := p.layout.fileSize()
+	off := 0
+	for k := 0; k < p.layout.spp; k++ {
+		size := p.layout.sampleSize(k)
+		var plane []byte
+		if plane, err = p.readChunk(k*p.blocksAcross*p.blocksDown+i, rows, 1, size*8, size); err != nil {
+			return
+		}
+		if data == nil {
+			data = make([]byte, rows*p.blockW*pixSize)
+		}
+		for j, x := 0, off; j+size <= len(plane); j, x = j+size, x+pixSize {
+			copy(data[x:x+size], plane[j:j+size])
+		}
+		off += size
+	}
+	return
+}
+
+// readChunk reads and decompresses the i-th chunk of the strip or tile
+// offsets, which has rows rows of p.blockW pixels of spp samples, and
+// undoes the predictor.
+func (p *Reader) readChunk(i, rows, spp, bits, pixSize int) (data []byte, err error) {
+	rowSize := p.blockW * pixSize
+
+	// the size of the file is unknown, only the bytes in the file are
+	// allocated
+	var compressed []byte
+	if p.size < 0 {
+		compressed, err = ioutil.ReadAll(io.NewSectionReader(p.r, int64(p.offsets[i]), int64(p.counts[i])))
+	} else {
+		compressed = make([]byte, p.counts[i])
+		var n int
+		n, err = p.r.ReadAt(compressed, int64(p.offsets[i]))
+		if err == io.EOF && n == len(compressed) {
+			err = nil
+		}
+	}
+	if err == nil && uint(len(compressed)) < p.counts[i] {
+		err = io.ErrUnexpectedEOF
+	}
+	if err != nil {
+		err = fmt.Errorf("image/tiff: ReadRect, read block %d: %v", i, err)
+		return
+	}
+
+	if p.compression == cNone && float64(rows)*float64(rowSize) > float64(len(compressed)) ||
+		float64(rows)*float64(rowSize) > float64(len(compressed))*maxCompressionRatio {
+		err = fmt.Errorf("image/tiff: ReadRect, not enough pixel data in block %d", i)
+		return
+	}
+	data = make([]byte, rows*rowSize)
+	switch p.compression {
+	case cNone:
+		copy(data, compressed)
+	case cDeflate, cDeflateNew:
+		var zr io.ReadCloser
+		if zr, err = zlib.NewReader(bytes.NewReader(compressed)); err != nil {
+			break
+		}
+		_, err = io.ReadFull(zr, data)
+		zr.Close()
+	case cLZW:
+		zr := lzw.NewReader(bytes.NewReader(compressed), lzw.MSB, 8)
+		_, err = io.ReadFull(zr, data)
+		zr.Close()
+	case cPackBits:
+		err = unpackBits(data, compressed)
+	case cJPEG:
+		err = p.decodeJPEG(data, compressed, rowSize, spp)
+	}
+	if err != nil {
+		err = fmt.Errorf("image/tiff: ReadRect, decompress block %d: %v", i, err)
+		return
+	}
+
+	switch p.predictor {
+	case prHorizontal:
+		for y := 0; y < rows; y++ {
+			undoHorizontal(data[y*rowSize:][:rowSize], spp, bits/8, p.order)
+		}
+	case prFloatingPoint:
+		tmp := make([]byte, rowSize)
+		for y := 0; y < rows; y++ {
+			undoFloatingPoint(data[y*rowSize:][:rowSize], tmp, spp, bits/8, p.order)
+		}
+	}
+	return
+}
+
+// decodeJPEG decodes the JPEG strip or tile in src to the 8 bits Gray or
+// RGB samples in dst.
+func (p *Reader) decodeJPEG(dst, src []byte, rowSize, spp int) error {
+	if len(p.jpegTables) >= 4 && len(src) >= 2 {
+		// the tables are an abbreviated JPEG stream, SOI, tables and EOI
+		stream := make([]byte, 0, len(p.jpegTables)+len(src)-4)
+		stream = append(stream, p.jpegTables[:len(p.jpegTables)-2]...)
+		src = append(stream, src[2:]...)
+	}
+	m, err := jpeg.Decode(bytes.NewReader(src))
+	if err != nil {
+		return err
+	}
+
+	var pix []byte
+	var stride int
+	if spp == 1 {
+		gray := convert.Gray(m)
+		pix, stride = gray.Pix, gray.Stride
+	} else {
+		rgb := convert.RGB(m)
+		pix, stride = rgb.Pix, rgb.Stride
+	}
+	b := m.Bounds()
+	n := b.Dx() * spp
+	if n > rowSize {
+		n = rowSize
+	}
+	for y := 0; y < b.Dy() && (y+1)*rowSize <= len(dst); y++ {
+		copy(dst[y*rowSize:][:n], pix[y*stride:])
+	}
+	return nil
+}
+
+// undoHorizontal undoes the horizontal differencing of a row of samples.
+func undoHorizontal(row []byte, spp, size int, order binary.ByteOrder) {
+	switch size {
+	case 1:
+		for x := spp; x < len(row); x++ {
+			row[x] += row[x-spp]
+		}
+	case 2:
+		for x := 2 * spp; x+2 <= len(row); x += 2 {
+			order.PutUint16(row[x:], order.Uint16(row[x:])+order.Uint16(row[x-2*spp:]))
+		}
+	case 4:
+		for x := 4 * spp; x+4 <= len(row); x += 4 {
+			order.PutUint32(row[x:], order.Uint32(row[x:])+order.Uint32(row[x-4*spp:]))
+		}
+	case 8:
+		for x := 8 * spp; x+8 <= len(row); x += 8 {
+			order.PutUint64(row[x:], order.Uint64(row[x:])+order.Uint64(row[x-8*spp:]))
+		}
+	}
+}
+
+// undoFloatingPoint undoes the floating point predictor of a row of
+// samples. The predictor stores the bytes of the samples from the most
+// significant bytes to the least significant bytes, and differences them
+// byte by byte. tmp has the size of row.
+func undoFloatingPoint(row, tmp []byte, spp, size int, order binary.ByteOrder) {
+	for x := spp; x < len(row); x++ {
+		row[x] += row[x-spp]
+	}
+	copy(tmp, row)
+	n := len(row) / size
+	for i := 0; i < n; i++ {
+		for b := 0; b < size; b++ {
+			if order == binary.BigEndian {
+				row[i*size+b] = tmp[b*n+i]
+			} else {
+				row[i*size+size-1-b] = tmp[b*n+i]
+			}
+		}
+	}
+}
+
+// unpackBits decodes the PackBits-compressed data in src into dst.
+func unpackBits(dst, src []byte) error {
+	for len(dst) > 0 {
+		if len(src) == 0 {
+			return io.ErrUnexpectedEOF
+		}
+		code := int(int8(src[0]))
+		src = src[1:]
+		switch {
+		case code >= 0:
+			n := code + 1
+			if len(src) < n || len(dst) < n {
+				return io.ErrUnexpectedEOF
+			}
+			copy(dst, src[:n])
+			dst, src = dst[n:], src[n:]
+		case code != -128:
+			n := 1 - code
+			if len(src) < 1 || len(dst) < n {
+				return io.ErrUnexpectedEOF
+			}
+			for i := 0; i < n; i++ {
+				dst[i] = src[0]
+			}
+			dst, src = dst[n:], src[1:]
+		}
+	}
+	return nil
+}
+
+func imageExtNewTileReader(r io.ReaderAt, size int64, opt *image_ext.Options) (image_ext.TileReader, error) {
+	p, err := newOptions(opt)
+	if err != nil {
+		return nil, err
+	}
+	return NewTileReader(r, size, p)
+}
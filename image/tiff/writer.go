@@ -0,0 +1,664 @@
+// Copyright 2014 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tiff
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/draw"
+	"image/jpeg"
+	"io"
+	"math"
+	"sort"
+
+	image_ext "github.com/chai2010/gopkg/image"
+	color_ext "github.com/chai2010/gopkg/image/color"
+	"github.com/chai2010/gopkg/image/convert"
+)
+
+// CompressType is the compression of the images written by Encode.
+type CompressType int
+
+const (
+	Uncompressed CompressType = iota
+	Deflate
+	LZW
+	PackBits
+	JPEG // lossy, the images are converted to 8 bits Gray or RGB
+)
+
+// specValue returns the Compression tag value of c.
+func (c CompressType) specValue() uint {
+	switch c {
+	case Deflate:
+		return cDeflate
+	case LZW:
+		return cLZW
+	case PackBits:
+		return cPackBits
+	case JPEG:
+		return cJPEG
+	}
+	return cNone
+}
+
+// stripSize is the size of the strips in bytes if RowsPerStrip is zero.
+const stripSize = 8 << 10
+
+// bigTIFFSize is the size of the pixels in bytes which needs BigTIFF, some
+// space is left for the compression overhead and the IFDs.
+const bigTIFFSize = math.MaxUint32 - 64<<20
+
+// page is an image to encode, and the extra tags of its IFD.
+type page struct {
+	m    image.Image
+	tags []ifdTag
+}
+
+// Encode writes the image m to w in TIFF format. opt determines the
+// options used for encoding, such as the compression type and the tile
+// size. If opt is nil, an uncompressed striped image is written.
+//
+// The standard images, the image_ext images like *image_ext.Gray32f,
+// *image_ext.RGB48 and *image_ext.RGB96f, and the image_ext.MultiBand
+// images are written with their own samples, the others are converted to
+// *image_ext.RGB or *image.NRGBA.
+func Encode(w io.Writer, m image.Image, opt *Options) error {
+	return encodePages(w, []page{{m: m}}, opt)
+}
+
+// encoder writes the pages of a TIFF file to buf, the files are little
+// endian.
+type encoder struct {
+	opt     Options
+	big     bool   // BigTIFF
+	buf     []byte // the file
+	nextIFD int    // the offset of the next IFD offset of the last IFD
+}
+
+// encodePages writes the pages as a TIFF file to w.
+func encodePages(w io.Writer, pages []page, opt *Options) error {
+	e, err := newEncoder(opt)
+	if err != nil {
+		return err
+	}
+
+	images := make([]image.Image, len(pages))
+	layouts := make([]*pixelLayout, len(pages))
+	var size int64
+	for i, pg := range pages {
+		m := pg.m
+		if e.opt.ColorModel != nil {
+			m = convert.ColorModel(m, e.opt.ColorModel)
+		}
+		images[i], layouts[i] = adjustImage(m, e.opt.Compression)
+		b := images[i].Bounds()
+		size += int64(b.Dx()) * int64(b.Dy()) * int64(layouts[i].fileSize())
+	}
+
+	// use BigTIFF if the pixels are too large for TIFF
+	e.big = e.opt.BigTIFF || size > bigTIFFSize
+	if e.big {
+		e.buf = append(e.buf, bigLEHeader...)
+		e.buf = append(e.buf, 8, 0, 0, 0)
+		e.nextIFD = len(e.buf)
+		e.buf = append(e.buf, 0, 0, 0, 0, 0, 0, 0, 0)
+	} else {
+		e.buf = append(e.buf, leHeader...)
+		e.nextIFD = len(e.buf)
+		e.buf = append(e.buf, 0, 0, 0, 0)
+	}
+
+	for i, pg := range pages {
+		if err = e.encodePage(images[i], layouts[i], pg.tags); err != nil {
+			return err
+		}
+	}
+	if !e.big && len(e.buf) > math.MaxUint32 {
+		return fmt.Errorf("image/tiff: Encode, the file is larger than 4GB, use BigTIFF")
+	}
+	_, err = w.Write(e.buf)
+	return err
+}
+
+// newEncoder checks the options and returns an encoder.
+func newEncoder(opt *Options) (e *encoder, err error) {
+	e = new(encoder)
+	if opt != nil {
+		e.opt = *opt
+	}
+	switch e.opt.Compression {
+	case Uncompressed, Deflate, LZW, PackBits:
+	case JPEG:
+		if e.opt.Quality == 0 {
+			e.opt.Quality = DefaultQuality
+		}
+		if e.opt.Quality < 1 || e.opt.Quality > 100 {
+			return nil, fmt.Errorf("image/tiff: Encode, bad Quality: %v", e.opt.Quality)
+		}
+	default:
+		return nil, fmt.Errorf("image/tiff: Encode, unsupported compression: %v", e.opt.Compression)
+	}
+	if e.opt.TileWidth == 0 {
+		e.opt.TileWidth = e.opt.TileHeight
+	}
+	if e.opt.TileHeight == 0 {
+		e.opt.TileHeight = e.opt.TileWidth
+	}
+	if e.opt.TileWidth < 0 || e.opt.TileWidth%16 != 0 || e.opt.TileHeight < 0 || e.opt.TileHeight%16 != 0 {
+		return nil, fmt.Errorf("image/tiff: Encode, the tile size must be a multiple of 16: %dx%d",
+			e.opt.TileWidth, e.opt.TileHeight,
+		)
+	}
+	if e.opt.RowsPerStrip < 0 {
+		return nil, fmt.Errorf("image/tiff: Encode, bad RowsPerStrip: %d", e.opt.RowsPerStrip)
+	}
+	return e, nil
+}
+
+// adjustImage converts m to the images supported by the encoder, and
+// returns its pixel layout.
+func adjustImage(m image.Image, compression CompressType) (image.Image, *pixelLayout) {
+	if masked, ok := m.(*image_ext.MaskedImage); ok {
+		// the nodata pixels are zero
+		m = masked.Image
+	}
+	if compression == JPEG {
+		if layout, ok := modelPixelLayout(m.ColorModel()); ok && layout.spp == 1 {
+			m = convert.Gray(m)
+		} else {
+			m = convert.RGB(m)
+		}
+		layout, _ := modelPixelLayout(m.ColorModel())
+		return m, layout
+	}
+
+	switch m := m.(type) {
+	case *image.Paletted:
+		if n := len(m.Palette); n > 0 && n <= 256 {
+			return m, newPalettedLayout(m.Palette)
+		}
+	case *image_ext.MultiBand:
+		return m, newMultiBandLayout(m.Model)
+	}
+	if _, _, ok := imagePix(m); ok {
+		if layout, ok := modelPixelLayout(m.ColorModel()); ok {
+			return m, layout
+		}
+	}
+	if p, ok := m.(interface {
+		Opaque() bool
+	}); ok && p.Opaque() {
+		layout, _ := modelPixelLayout(color_ext.RGBModel)
+		return convert.RGB(m), layout
+	}
+	nrgba := image.NewNRGBA(m.Bounds())
+	draw.Draw(nrgba, nrgba.Rect, m, m.Bounds().Min, draw.Src)
+	layout, _ := modelPixelLayout(nrgba.ColorModel())
+	return nrgba, layout
+}
+
+// encodePage writes the strips or the tiles of m, and its IFD with the
+// extra tags.
+func (e *encoder) encodePage(m image.Image, layout *pixelLayout, extraTags []ifdTag) error {
+	b := m.Bounds()
+	if b.Empty() {
+		return fmt.Errorf("image/tiff: Encode, empty image: %v", b)
+	}
+	if layout.bands != nil {
+		if err := layout.bands.Valid(); err != nil {
+			return err
+		}
+	}
+	if layout.spp > math.MaxUint16 {
+		return fmt.Errorf("image/tiff: Encode, too many samples: %d", layout.spp)
+	}
+	pix, stride, _ := imagePix(m)
+	width, height := b.Dx(), b.Dy()
+	pixSize := layout.fileSize()
+
+	blockW, blockH := e.opt.TileWidth, e.opt.TileHeight
+	tiled := blockW != 0
+	if !tiled {
+		blockW, blockH = width, e.rowsPerStrip(width*pixSize)
+		if blockH > height {
+			blockH = height
+		}
+	}
+	across := (width + blockW - 1) / blockW
+	down := (height + blockH - 1) / blockH
+	planes := 1
+	if e.opt.Planar && layout.spp > 1 {
+		planes = layout.spp
+	}
+	predictor := e.predictor(layout)
+
+	n := across * down
+	offsets := make([]uint64, n*planes)
+	counts := make([]uint64, n*planes)
+	block := make([]byte, blockW*blockH*pixSize)
+	var plane []byte
+	if planes > 1 {
+		plane = make([]byte, blockW*blockH*8)
+	}
+	for by := 0; by < down; by++ {
+		for bx := 0; bx < across; bx++ {
+			br := image.Rect(
+				bx*blockW, by*blockH,
+				(bx+1)*blockW, (by+1)*blockH,
+			).Intersect(image.Rect(0, 0, width, height))
+			rows := blockH
+			if !tiled {
+				// the last strip may be shorter
+				rows = br.Dy()
+			}
+
+			// the pixels outside the image are zero
+			data := block[:rows*blockW*pixSize]
+			if br.Dx() < blockW || br.Dy() < rows {
+				for i := range data {
+					data[i] = 0
+				}
+			}
+			for y := br.Min.Y; y < br.Max.Y; y++ {
+				src := pix[y*stride+br.Min.X*layout.pixSize:][:br.Dx()*layout.pixSize]
+				layout.encodeRow(data[(y-br.Min.Y)*blockW*pixSize:], src, binary.LittleEndian)
+			}
+
+			i := by*across + bx
+			if planes == 1 {
+				if err := e.writeChunk(&offsets[i], &counts[i], data, blockW, rows, layout.spp, layout.bits, predictor); err != nil {
+					return err
+				}
+				continue
+			}
+			off := 0
+			for k := 0; k < planes; k++ {
+				size := layout.sampleSize(k)
+				chunk := plane[:blockW*rows*size]
+				for j, x := 0, off; j < len(chunk); j, x = j+size, x+pixSize {
+					copy(chunk[j:j+size], data[x:x+size])
+				}
+				if err := e.writeChunk(&offsets[k*n+i], &counts[k*n+i], chunk, blockW, rows, 1, size*8, predictor); err != nil {
+					return err
+				}
+				off += size
+			}
+		}
+	}
+
+	return e.writeIFD(e.makeTags(layout, width, height, blockW, blockH, tiled, planes, predictor, offsets, counts), extraTags)
+}
+
+// rowsPerStrip returns the rows of the strips of rowSize bytes.
+func (e *encoder) rowsPerStrip(rowSize int) int {
+	rows := e.opt.RowsPerStrip
+	if rows == 0 {
+		if rows = stripSize / rowSize; rows < 1 {
+			rows = 1
+		}
+	}
+	if e.opt.Compression == JPEG {
+		// the rows of the JPEG strips are a multiple of the MCU height
+		rows = (rows + 15) / 16 * 16
+	}
+	return rows
+}
+
+// predictor returns the predictor of the samples of layout.
+func (e *encoder) predictor(layout *pixelLayout) uint {
+	if !e.opt.Predictor || layout.bits == 0 {
+		return prNone
+	}
+	if e.opt.Compression != Deflate && e.opt.Compression != LZW {
+		return prNone
+	}
+	if layout.format == sfFloat {
+		return prFloatingPoint
+	}
+	return prHorizontal
+}
+
+// writeChunk compresses a strip or a tile, or a plane of them, which has
+// rows rows of width pixels of spp samples, and appends it to the file.
+func (e *encoder) writeChunk(offset, count *uint64, data []byte, width, rows, spp, bits int, predictor uint) (err error) {
+	rowSize := len(data) / rows
+	switch predictor {
+	case prHorizontal:
+		for y := 0; y < rows; y++ {
+			applyHorizontal(data[y*rowSize:][:rowSize], spp, bits/8)
+		}
+	case prFloatingPoint:
+		tmp := make([]byte, rowSize)
+		for y := 0; y < rows; y++ {
+			applyFloatingPoint(data[y*rowSize:][:rowSize], tmp, spp, bits/8)
+		}
+	}
+
+	compressed := data
+	switch e.opt.Compression {
+	case Deflate:
+		var buf bytes.Buffer
+		zw := zlib.NewWriter(&buf)
+		if _, err = zw.Write(data); err != nil {
+			return
+		}
+		if err = zw.Close(); err != nil {
+			return
+		}
+		compressed = buf.Bytes()
+	case LZW:
+		compressed = compressLZW(data)
+	case PackBits:
+		// the rows are packed separately
+		compressed = nil
+		for y := 0; y < rows; y++ {
+			compressed = packBits(compressed, data[y*rowSize:][:rowSize])
+		}
+	case JPEG:
+		if compressed, err = e.encodeJPEG(data, width, rows, spp); err != nil {
+			return
+		}
+	}
+
+	e.align()
+	*offset, *count = uint64(len(e.buf)), uint64(len(compressed))
+	e.buf = append(e.buf, compressed...)
+	return
+}
+
+// encodeJPEG compresses the 8 bits Gray or RGB samples with JPEG, the RGB
+// samples are stored as YCbCr.
+func (e *encoder) encodeJPEG(data []byte, width, rows, spp int) ([]byte, error) {
+	r := image.Rect(0, 0, width, rows)
+	var m image.Image
+	if spp == 1 {
+		m = &image.Gray{Pix: data, Stride: width, Rect: r}
+	} else {
+		rgba := image.NewRGBA(r)
+		for i, j := 0, 0; i+3 <= len(data); i, j = i+3, j+4 {
+			rgba.Pix[j+0] = data[i+0]
+			rgba.Pix[j+1] = data[i+1]
+			rgba.Pix[j+2] = data[i+2]
+			rgba.Pix[j+3] = 0xff
+		}
+		m = rgba
+	}
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, m, &jpeg.Options{Quality: int(e.opt.Quality)}); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// makeTags returns the tags of the image layout.
+func (e *encoder) makeTags(layout *pixelLayout, width, height, blockW, blockH int, tiled bool, planes int, predictor uint, offsets, counts []uint64) []ifdTag {
+	spp := layout.spp
+	bits := make([]uint64, spp)
+	formats := make([]uint64, spp)
+	for k := range bits {
+		bits[k] = uint64(layout.sampleSize(k) * 8)
+		formats[k] = uint64(layout.format)
+		if layout.bands != nil {
+			formats[k] = uint64(sampleFormat(layout.bands.Band[k].DataType))
+		}
+	}
+	photometric := layout.photometric
+	if e.opt.Compression == JPEG && planes == 1 && spp == 3 {
+		photometric = pYCbCr
+	}
+	offsetType := uint16(dtLong)
+	if e.big {
+		offsetType = dtLong8
+	}
+	planar := uint64(1)
+	if planes > 1 {
+		planar = 2
+	}
+
+	tags := []ifdTag{
+		makeTag(tImageWidth, dtLong, uint64(width)),
+		makeTag(tImageLength, dtLong, uint64(height)),
+		makeTag(tBitsPerSample, dtShort, bits...),
+		makeTag(tCompression, dtShort, uint64(e.opt.Compression.specValue())),
+		makeTag(tPhotometricInterpretation, dtShort, uint64(photometric)),
+		makeTag(tSamplesPerPixel, dtShort, uint64(spp)),
+		makeTag(tPlanarConfiguration, dtShort, planar),
+	}
+	if tiled {
+		tags = append(tags,
+			makeTag(tTileWidth, dtLong, uint64(blockW)),
+			makeTag(tTileLength, dtLong, uint64(blockH)),
+			makeTag(tTileOffsets, offsetType, offsets...),
+			makeTag(tTileByteCounts, offsetType, counts...),
+		)
+	} else {
+		tags = append(tags,
+			makeTag(tStripOffsets, offsetType, offsets...),
+			makeTag(tRowsPerStrip, dtLong, uint64(blockH)),
+			makeTag(tStripByteCounts, offsetType, counts...),
+		)
+	}
+	if predictor != prNone {
+		tags = append(tags, makeTag(tPredictor, dtShort, uint64(predictor)))
+	}
+	if layout.palette != nil {
+		// the color map has 256 colors of 8 bits images
+		colors := make([]uint64, 3*256)
+		for i, c := range layout.palette {
+			r, g, b, _ := c.RGBA()
+			colors[i], colors[i+256], colors[i+512] = uint64(r), uint64(g), uint64(b)
+		}
+		tags = append(tags, makeTag(tColorMap, dtShort, colors...))
+	}
+	switch {
+	case layout.extra != 0:
+		tags = append(tags, makeTag(tExtraSamples, dtShort, uint64(layout.extra)))
+	case layout.bands != nil && spp > 1:
+		// the extra samples are unspecified data
+		tags = append(tags, makeTag(tExtraSamples, dtShort, make([]uint64, spp-1)...))
+	}
+	if layout.bands != nil || layout.format != sfUint {
+		tags = append(tags, makeTag(tSampleFormat, dtShort, formats...))
+	}
+	if photometric == pYCbCr {
+		// the chroma of the JPEG encoder is subsampled 2x2
+		tags = append(tags, makeTag(tYCbCrSubSampling, dtShort, 2, 2))
+	}
+	if layout.bands != nil {
+		tags = append(tags, makeGDALTags(layout.bands)...)
+	}
+	return tags
+}
+
+// makeTag returns a little endian SHORT, LONG or LONG8 tag of the values.
+func makeTag(tag int, datatype uint16, values ...uint64) ifdTag {
+	order := binary.LittleEndian
+	size := int(lengths[datatype])
+	data := make([]byte, size*len(values))
+	for i, v := range values {
+		switch datatype {
+		case dtShort:
+			order.PutUint16(data[size*i:], uint16(v))
+		case dtLong:
+			order.PutUint32(data[size*i:], uint32(v))
+		case dtLong8:
+			order.PutUint64(data[size*i:], v)
+		}
+	}
+	return ifdTag{tag, datatype, uint32(len(values)), data, nil}
+}
+
+// writeIFD appends an IFD of the tags and the extra tags, which replace
+// the tags of the same number, and links it to the previous IFD.
+func (e *encoder) writeIFD(tags, extraTags []ifdTag) error {
+	off, err := e.appendIFD(append(tags, extraTags...))
+	if err != nil {
+		return err
+	}
+	e.putOffset(e.buf[e.nextIFD:], off)
+	e.nextIFD = len(e.buf) - e.offsetLen()
+	return nil
+}
+
+// appendIFD appends an IFD of the tags, the later tags replace the tags of
+// the same number. The offset of the next IFD is zero.
+func (e *encoder) appendIFD(tags []ifdTag) (off int, err error) {
+	order := binary.LittleEndian
+	entries := make(map[int]ifdTag)
+	for _, t := range tags {
+		entries[t.tag] = t
+	}
+	keys := make([]int, 0, len(entries))
+	for k := range entries {
+		keys = append(keys, k)
+	}
+	sort.Ints(keys)
+
+	// the values which don't fit the entries and the sub IFDs are written
+	// before the IFD
+	valueLen, entryLen := e.offsetLen(), 12
+	if e.big {
+		entryLen = 20
+	}
+	ifd := make([]byte, 0, len(keys)*entryLen)
+	for _, k := range keys {
+		t := entries[k]
+		if t.sub != nil {
+			sub, err := e.appendIFD(t.sub)
+			if err != nil {
+				return 0, err
+			}
+			t.datatype, t.count, t.data = dtLong, 1, make([]byte, valueLen)
+			if e.big {
+				t.datatype = dtIFD8
+			}
+			e.putOffset(t.data, sub)
+		}
+		entry := make([]byte, entryLen)
+		order.PutUint16(entry[0:2], uint16(t.tag))
+		order.PutUint16(entry[2:4], t.datatype)
+		value := entry[8:12]
+		if e.big {
+			order.PutUint64(entry[4:12], uint64(t.count))
+			value = entry[12:20]
+		} else {
+			order.PutUint32(entry[4:8], t.count)
+		}
+		if len(t.data) <= valueLen {
+			copy(value, t.data)
+		} else {
+			e.align()
+			e.putOffset(value, len(e.buf))
+			e.buf = append(e.buf, t.data...)
+		}
+		ifd = append(ifd, entry...)
+	}
+
+	e.align()
+	off = len(e.buf)
+	if e.big {
+		var n [8]byte
+		order.PutUint64(n[:], uint64(len(keys)))
+		e.buf = append(e.buf, n[:]...)
+	} else {
+		if len(keys) > math.MaxUint16 {
+			return 0, fmt.Errorf("image/tiff: Encode, too many tags: %d", len(keys))
+		}
+		e.buf = append(e.buf, byte(len(keys)), byte(len(keys)>>8))
+	}
+	e.buf = append(e.buf, ifd...)
+	e.buf = append(e.buf, make([]byte, valueLen)...)
+	return
+}
+
+// offsetLen returns the size of the file offsets in bytes.
+func (e *encoder) offsetLen() int {
+	if e.big {
+		return 8
+	}
+	return 4
+}
+
+// putOffset writes the file offset to b.
+func (e *encoder) putOffset(b []byte, off int) {
+	if e.big {
+		binary.LittleEndian.PutUint64(b, uint64(off))
+	} else {
+		binary.LittleEndian.PutUint32(b, uint32(off))
+	}
+}
+
+// align aligns the end of the file to a word boundary.
+func (e *encoder) align() {
+	if len(e.buf)%2 != 0 {
+		e.buf = append(e.buf, 0)
+	}
+}
+
+// applyHorizontal applies the horizontal differencing to a row of little
+// endian samples.
+func applyHorizontal(row []byte, spp, size int) {
+	order := binary.LittleEndian
+	switch size {
+	case 1:
+		for x := len(row) - 1; x >= spp; x-- {
+			row[x] -= row[x-spp]
+		}
+	case 2:
+		for x := len(row)/2*2 - 2; x >= 2*spp; x -= 2 {
+			order.PutUint16(row[x:], order.Uint16(row[x:])-order.Uint16(row[x-2*spp:]))
+		}
+	case 4:
+		for x := len(row)/4*4 - 4; x >= 4*spp; x -= 4 {
+			order.PutUint32(row[x:], order.Uint32(row[x:])-order.Uint32(row[x-4*spp:]))
+		}
+	case 8:
+		for x := len(row)/8*8 - 8; x >= 8*spp; x -= 8 {
+			order.PutUint64(row[x:], order.Uint64(row[x:])-order.Uint64(row[x-8*spp:]))
+		}
+	}
+}
+
+// applyFloatingPoint applies the floating point predictor to a row of
+// little endian samples, see undoFloatingPoint. tmp has the size of row.
+func applyFloatingPoint(row, tmp []byte, spp, size int) {
+	n := len(row) / size
+	for i := 0; i < n; i++ {
+		for b := 0; b < size; b++ {
+			tmp[b*n+i] = row[i*size+size-1-b]
+		}
+	}
+	copy(row, tmp)
+	for x := len(row) - 1; x >= spp; x-- {
+		row[x] -= row[x-spp]
+	}
+}
+
+// packBits appends the PackBits-compressed src to dst.
+func packBits(dst, src []byte) []byte {
+	for len(src) > 0 {
+		run := 1
+		for run < len(src) && run < 128 && src[run] == src[0] {
+			run++
+		}
+		if run > 1 {
+			dst = append(dst, byte(1-run), src[0])
+			src = src[run:]
+			continue
+		}
+		n := 1
+		for n < len(src) && n < 128 && !(n+1 < len(src) && src[n] == src[n+1]) {
+			n++
+		}
+		dst = append(dst, byte(n-1))
+		dst = append(dst, src[:n]...)
+		src = src[n:]
+	}
+	return dst
+}
@@ -0,0 +1,344 @@
+// Copyright 2014 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tiff
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"io/ioutil"
+	"math/rand"
+	"reflect"
+	"testing"
+
+	"code.google.com/p/go.image/tiff/lzw"
+	image_ext "github.com/chai2010/gopkg/image"
+	color_ext "github.com/chai2010/gopkg/image/color"
+)
+
+// tNewImage returns a gradient image of the pixel layout.
+func tNewImage(r image.Rectangle, layout *pixelLayout) image.Image {
+	m, _, _ := layout.newImage(r)
+	buf := m.(image_ext.ImageBuffer)
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			v := uint16(x*997 + y*331)
+			buf.Set(x, y, color.NRGBA64{v, v * 7, uint16(y * 512), 0xffff - uint16(x*256)})
+		}
+	}
+	return m
+}
+
+// tSmoothImage returns a smooth image of the pixel layout for the lossy
+// compressions.
+func tSmoothImage(r image.Rectangle, layout *pixelLayout) image.Image {
+	m, _, _ := layout.newImage(r)
+	buf := m.(image_ext.ImageBuffer)
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			buf.Set(x, y, color.RGBA{uint8(x * 2), uint8(y * 3), uint8(x + y), 0xff})
+		}
+	}
+	return m
+}
+
+// tLayouts returns the pixel layouts of all the image types of Encode.
+func tLayouts() []*pixelLayout {
+	var list []*pixelLayout
+	for i := range pixelLayouts {
+		layout := pixelLayouts[i]
+		list = append(list, &layout)
+	}
+	list = append(list,
+		newPalettedLayout(color.Palette{color.Black, color.White, color.RGBA{0xff, 0, 0, 0xff}}),
+		newMultiBandLayout(color_ext.NewUniformMultiBandModel(5, reflect.Float32)),
+		newMultiBandLayout(color_ext.NewMultiBandModel(
+			color_ext.BandInfo{Name: "a", DataType: reflect.Uint8},
+			color_ext.BandInfo{Name: "b", DataType: reflect.Int16},
+			color_ext.BandInfo{Name: "c", DataType: reflect.Float64},
+		)),
+	)
+	return list
+}
+
+// comparePix checks that m1 has the type and the pixels of m0.
+func comparePix(t *testing.T, name string, m0, m1 image.Image) {
+	if reflect.TypeOf(m0) != reflect.TypeOf(m1) {
+		t.Fatalf("%s: wrong image type: want %T, got %T", name, m0, m1)
+	}
+	if !m0.Bounds().Eq(m1.Bounds()) {
+		t.Fatalf("%s: wrong image size: want %s, got %s", name, m0.Bounds(), m1.Bounds())
+	}
+	pix0, stride0, _ := imagePix(m0)
+	pix1, stride1, _ := imagePix(m1)
+	b := m0.Bounds()
+	rowSize := len(pix0) / b.Dy()
+	for y := 0; y < b.Dy(); y++ {
+		if !bytes.Equal(pix0[y*stride0:][:rowSize], pix1[y*stride1:][:rowSize]) {
+			t.Fatalf("%s: row %d has wrong pixels", name, y)
+		}
+	}
+}
+
+func TestEncode_pixelFormats(t *testing.T) {
+	r := image.Rect(0, 0, 75, 53)
+	for i, opt := range []*Options{
+		nil,
+		{Compression: Deflate, Predictor: true},
+		{Compression: LZW, Predictor: true, RowsPerStrip: 7},
+		{Compression: PackBits},
+		{Compression: LZW, TileWidth: 32, TileHeight: 16},
+		{Compression: Deflate, Predictor: true, TileWidth: 16, Planar: true},
+		{Compression: LZW, Predictor: true, Planar: true, BigTIFF: true},
+	} {
+		for _, layout := range tLayouts() {
+			m0 := tNewImage(r, layout)
+			var buf bytes.Buffer
+			if err := Encode(&buf, m0, opt); err != nil {
+				t.Fatalf("%d: %T, Encode: %v", i, m0, err)
+			}
+			m1, err := Decode(bytes.NewReader(buf.Bytes()), nil)
+			if err != nil {
+				t.Fatalf("%d: %T, Decode: %v", i, m0, err)
+			}
+			if layout.palette != nil {
+				// the color map of the file has 256 colors
+				compare(t, m0, m1)
+				continue
+			}
+			comparePix(t, reflect.TypeOf(m0).String(), m0, m1)
+		}
+	}
+}
+
+func TestEncode_jpeg(t *testing.T) {
+	r := image.Rect(0, 0, 100, 70)
+	gray, _ := modelPixelLayout(color.GrayModel)
+	rgb, _ := modelPixelLayout(color_ext.RGBModel)
+	for i, v := range []struct {
+		Layout *pixelLayout
+		Opt    *Options
+	}{
+		{gray, &Options{Compression: JPEG}},
+		{rgb, &Options{Compression: JPEG}},
+		{rgb, &Options{Compression: JPEG, Quality: 95, TileWidth: 32}},
+		{rgb, &Options{Compression: JPEG, Planar: true, RowsPerStrip: 20}},
+	} {
+		m0 := tSmoothImage(r, v.Layout)
+		var buf bytes.Buffer
+		if err := Encode(&buf, m0, v.Opt); err != nil {
+			t.Fatalf("%d: Encode: %v", i, err)
+		}
+		m1, err := Decode(&buf, nil)
+		if err != nil {
+			t.Fatalf("%d: Decode: %v", i, err)
+		}
+		if reflect.TypeOf(m0) != reflect.TypeOf(m1) {
+			t.Fatalf("%d: wrong image type: want %T, got %T", i, m0, m1)
+		}
+		if got, want := averageDelta(m0, m1), int64(2<<8); got > want {
+			t.Fatalf("%d: average delta too high; got %d, want <= %d", i, got, want)
+		}
+	}
+}
+
+func TestEncode_bigTIFF(t *testing.T) {
+	layout, _ := modelPixelLayout(color_ext.RGB96fModel)
+	m0 := tNewImage(image.Rect(0, 0, 40, 30), layout)
+	var buf bytes.Buffer
+	if err := Encode(&buf, m0, &Options{BigTIFF: true, TileWidth: 16}); err != nil {
+		t.Fatal(err)
+	}
+	if got := string(buf.Bytes()[:4]); got != bigLEHeader {
+		t.Fatalf("wrong header: %q", got)
+	}
+
+	// the BigTIFF header is registered to the standard image package
+	m1, name, err := image.Decode(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if name != "tiff" {
+		t.Fatalf("wrong format: %s", name)
+	}
+	comparePix(t, "BigTIFF", m0, m1)
+
+	frames := &image_ext.Frames{Frame: []image_ext.Frame{
+		{Image: m0, PageName: "a"},
+		{Image: image.NewGray(image.Rect(0, 0, 10, 20)), PageName: "b"},
+	}}
+	buf.Reset()
+	if err := EncodeFrames(&buf, frames, &Options{BigTIFF: true}); err != nil {
+		t.Fatal(err)
+	}
+	frames1, err := DecodeFrames(&buf, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(frames1.Frame) != 2 || frames1.Frame[1].PageName != "b" {
+		t.Fatalf("wrong frames: %v", frames1.Frame)
+	}
+	comparePix(t, "BigTIFF page 0", m0, frames1.Frame[0].Image)
+	comparePix(t, "BigTIFF page 1", frames.Frame[1].Image, frames1.Frame[1].Image)
+}
+
+func TestEncode_badOptions(t *testing.T) {
+	m0 := image.NewGray(image.Rect(0, 0, 10, 10))
+	for i, opt := range []*Options{
+		{TileWidth: 20},
+		{TileWidth: -16},
+		{RowsPerStrip: -1},
+		{Compression: JPEG, Quality: 101},
+		{Compression: JPEG + 1},
+	} {
+		if err := Encode(ioutil.Discard, m0, opt); err == nil {
+			t.Fatalf("%d: expect error", i)
+		}
+	}
+}
+
+func TestEncode_imageExtOptions(t *testing.T) {
+	layout, _ := modelPixelLayout(color_ext.RGBModel)
+	m0 := tSmoothImage(image.Rect(0, 0, 40, 30), layout)
+	for i, v := range []struct {
+		Options   *image_ext.Options
+		Supported bool
+	}{
+		{&image_ext.Options{Compression: image_ext.CompressionLZW}, true},
+		{&image_ext.Options{Compression: image_ext.CompressionPackBits}, true},
+		{&image_ext.Options{Quality: 90}, true},
+		{&image_ext.Options{Quality: 90, Lossless: true}, false},
+		{&image_ext.Options{Quality: 90, Compression: image_ext.CompressionDeflate}, false},
+		{&image_ext.Options{Compression: image_ext.CompressionSnappy}, false},
+	} {
+		var buf bytes.Buffer
+		err := image_ext.Encode("tiff", &buf, m0, v.Options)
+		if !v.Supported {
+			if _, ok := err.(*image_ext.UnsupportedOptionError); !ok {
+				t.Fatalf("%d: expect UnsupportedOptionError, got %v", i, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%d: Encode: %v", i, err)
+		}
+		m1, _, err := image_ext.Decode(&buf, nil)
+		if err != nil {
+			t.Fatalf("%d: Decode: %v", i, err)
+		}
+		if v.Options.Quality == 0 {
+			compare(t, m0, m1)
+		} else if got, want := averageDelta(m0, m1), int64(2<<8); got > want {
+			t.Fatalf("%d: average delta too high; got %d, want <= %d", i, got, want)
+		}
+	}
+}
+
+func TestCompressLZW(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	for _, n := range []int{0, 1, 2, 1000, 200000} {
+		data := make([]byte, n)
+		for i := range data {
+			// repeated and random bytes, the table is cleared many times
+			if i%3 == 0 {
+				data[i] = byte(rnd.Intn(256))
+			} else {
+				data[i] = byte(i / 7)
+			}
+		}
+		zr := lzw.NewReader(bytes.NewReader(compressLZW(data)), lzw.MSB, 8)
+		got, err := ioutil.ReadAll(zr)
+		if err != nil {
+			t.Fatalf("%d: %v", n, err)
+		}
+		if !bytes.Equal(got, data) {
+			t.Fatalf("%d: wrong data", n)
+		}
+	}
+}
+
+// averageDelta returns the average delta in RGB space. The two images must
+// have the same bounds.
+func averageDelta(m0, m1 image.Image) int64 {
+	b := m0.Bounds()
+	var sum, n int64
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			r0, g0, b0, _ := m0.At(x, y).RGBA()
+			r1, g1, b1, _ := m1.At(x, y).RGBA()
+			sum += delta(r0, r1)
+			sum += delta(g0, g1)
+			sum += delta(b0, b1)
+			n += 3
+		}
+	}
+	return sum / n
+}
+
+func delta(u0, u1 uint32) int64 {
+	d := int64(u0) - int64(u1)
+	if d < 0 {
+		return -d
+	}
+	return d
+}
+
+func TestEncodeWithMetadata_exif(t *testing.T) {
+	rational := func(num, den uint32) []byte {
+		data := make([]byte, 8)
+		binary.LittleEndian.PutUint32(data[0:], num)
+		binary.LittleEndian.PutUint32(data[4:], den)
+		return data
+	}
+	exif := makeExif([]ifdTag{
+		{271, dtASCII, 6, []byte("gopkg\x00"), nil},
+		{274, dtShort, 1, []byte{1, 0}, nil},
+		{282, dtRational, 1, rational(72, 1), nil},
+		{tExifIFD, dtLong, 1, nil, []ifdTag{
+			{33434, dtRational, 1, rational(1, 100), nil},
+			{tInteropIFD, dtLong, 1, nil, []ifdTag{
+				{1, dtASCII, 4, []byte("R98\x00"), nil},
+			}},
+		}},
+		{tGPSIFD, dtLong, 1, nil, []ifdTag{
+			{0, dtByte, 4, []byte{2, 2, 0, 0}, nil},
+		}},
+	})
+	// the big endian EXIF data is written as little endian
+	bigEndian := []byte("MM\x00*\x00\x00\x00\x08" +
+		"\x00\x01\x01\x1a\x00\x05\x00\x00\x00\x01\x00\x00\x00\x1a\x00\x00\x00\x00" +
+		"\x00\x00\x00\x48\x00\x00\x00\x01")
+
+	layout, _ := modelPixelLayout(color.GrayModel)
+	m0 := tNewImage(image.Rect(0, 0, 20, 10), layout)
+	for i, v := range []struct {
+		Exif []byte
+		Want []byte
+		Opt  *Options
+	}{
+		{exif, exif, nil},
+		{exif, exif, &Options{BigTIFF: true}},
+		{bigEndian, makeExif([]ifdTag{{282, dtRational, 1, rational(72, 1), nil}}), nil},
+		{[]byte("not a TIFF stream"), nil, nil},
+	} {
+		var buf bytes.Buffer
+		dropped, err := EncodeWithMetadata(&buf, m0, &image_ext.Metadata{Exif: v.Exif}, v.Opt)
+		if err != nil {
+			t.Fatalf("%d: %v", i, err)
+		}
+		if (v.Want == nil) != (len(dropped) != 0) {
+			t.Fatalf("%d: bad dropped: %v", i, dropped)
+		}
+		m1, meta, err := DecodeWithMetadata(&buf, nil)
+		if err != nil {
+			t.Fatalf("%d: %v", i, err)
+		}
+		if !bytes.Equal(meta.Exif, v.Want) {
+			t.Fatalf("%d: bad EXIF: got %q, want %q", i, meta.Exif, v.Want)
+		}
+		comparePix(t, "EXIF", m0, m1)
+	}
+}
@@ -0,0 +1,130 @@
+// Copyright 2014 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package image
+
+import (
+	"bufio"
+	"image"
+	"image/color"
+	"image/draw"
+	"io"
+	"os"
+)
+
+// A TileReader reads arbitrary rectangles of an encoded image without
+// decoding the entire image.
+type TileReader interface {
+	// Config returns the color model and dimensions of the image.
+	Config() image.Config
+
+	// ReadRect decodes the pixels of the image inside r. The bounds of
+	// the returned image is r intersected with the image bounds.
+	// If buf is not nil and covers r, it may be used as the pixels buffer.
+	ReadRect(r image.Rectangle, buf ImageBuffer) (m image.Image, err error)
+
+	// Close releases the resources held by the reader.
+	Close() error
+}
+
+// NewTileReader returns a TileReader for an image that has been encoded in a
+// registered format. The string returned is the format name used during
+// format registration. If the format can't read rectangles directly, the
+// whole image is decoded once and the rectangles are taken from it.
+func NewTileReader(r io.ReaderAt, size int64, opt *Options) (TileReader, string, error) {
+	f := sniffByMagic(bufio.NewReader(io.NewSectionReader(r, 0, size)))
+	if f.NewTileReader != nil {
+		p, err := f.NewTileReader(r, size, opt)
+		return p, f.Name, err
+	}
+	if f.Decode == nil {
+		return nil, "", image.ErrFormat
+	}
+	m, err := f.Decode(io.NewSectionReader(r, 0, size), opt)
+	if err != nil {
+		return nil, f.Name, err
+	}
+	return NewImageTileReader(m), f.Name, nil
+}
+
+// OpenTileReader opens the named file and returns a TileReader for it.
+// The file is closed when the TileReader is closed.
+func OpenTileReader(filename string, opt *Options) (TileReader, string, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, "", err
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, "", err
+	}
+	p, format, err := NewTileReader(f, fi.Size(), opt)
+	if err != nil {
+		f.Close()
+		return nil, format, err
+	}
+	return &fileTileReader{TileReader: p, f: f}, format, nil
+}
+
+// NewImageTileReader returns a TileReader which reads the rectangles from
+// the decoded image m.
+func NewImageTileReader(m image.Image) TileReader {
+	return &imageTileReader{
+		m: m,
+		config: image.Config{
+			ColorModel: m.ColorModel(),
+			Width:      m.Bounds().Dx(),
+			Height:     m.Bounds().Dy(),
+		},
+	}
+}
+
+type imageTileReader struct {
+	m      image.Image
+	config image.Config
+}
+
+func (p *imageTileReader) Config() image.Config {
+	return p.config
+}
+
+func (p *imageTileReader) ReadRect(r image.Rectangle, buf ImageBuffer) (m image.Image, err error) {
+	r = r.Intersect(p.m.Bounds())
+	// the palettes are not comparable
+	_, paletted := p.config.ColorModel.(color.Palette)
+	if buf != nil && !paletted && r.In(buf.Bounds()) && buf.ColorModel() == p.config.ColorModel {
+		draw.Draw(buf, r, p.m, r.Min, draw.Src)
+		m = buf.SubImage(r)
+		return
+	}
+	if sub, ok := p.m.(interface {
+		SubImage(r image.Rectangle) image.Image
+	}); ok {
+		m = sub.SubImage(r)
+		return
+	}
+	rgba := image.NewRGBA64(r)
+	draw.Draw(rgba, r, p.m, r.Min, draw.Src)
+	m = rgba
+	return
+}
+
+func (p *imageTileReader) Close() error {
+	p.m = nil
+	return nil
+}
+
+type fileTileReader struct {
+	TileReader
+	f *os.File
+}
+
+func (p *fileTileReader) Close() error {
+	err := p.TileReader.Close()
+	if errClose := p.f.Close(); err == nil {
+		err = errClose
+	}
+	return err
+}
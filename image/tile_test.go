@@ -0,0 +1,135 @@
+// Copyright 2014 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package image_test
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"testing"
+
+	image_ext "github.com/chai2010/gopkg/image"
+	"github.com/chai2010/gopkg/image/rawp"
+)
+
+var tTileReaderFiles = []string{
+	"video-001.bmp",
+	"video-001.png",
+	"video-001.tiff",
+	"video-001-16bit.tiff",
+	"video-001-gray.tiff",
+	"video-001-gray-16bit.tiff",
+	"video-001-paletted.tiff",
+	"video-001-strip-64.tiff",
+	"video-001-tile-64x64.tiff",
+	"video-001-uncompressed.tiff",
+	"blue-purple-pink.lzwcompressed.tiff",
+	"bw-deflate.tiff",
+	"bw-packbits.tiff",
+}
+
+var tTileReaderRects = []image.Rectangle{
+	image.Rect(0, 0, 1, 1),
+	image.Rect(0, 0, 16, 16),
+	image.Rect(10, 20, 100, 90),
+	image.Rect(60, 60, 70, 70),
+	image.Rect(-10, -10, 1000, 1000),
+}
+
+func TestTileReader(t *testing.T) {
+	for _, name := range tTileReaderFiles {
+		golden, _, err := image_ext.Load("testdata/"+name, nil)
+		if err != nil {
+			t.Fatalf("%s: Load: %v", name, err)
+		}
+		p, _, err := image_ext.OpenTileReader("testdata/"+name, nil)
+		if err != nil {
+			t.Fatalf("%s: OpenTileReader: %v", name, err)
+		}
+		tTestTileReader(t, name, p, golden)
+		if err = p.Close(); err != nil {
+			t.Fatalf("%s: Close: %v", name, err)
+		}
+	}
+}
+
+func TestTileReader_rawp(t *testing.T) {
+	golden, _, err := image_ext.Load("testdata/video-001.png", nil)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	for _, useSnappy := range []bool{false, true} {
+		var buf bytes.Buffer
+		if err = rawp.Encode(&buf, golden, &rawp.Options{UseSnappy: useSnappy}); err != nil {
+			t.Fatalf("rawp.Encode: %v", err)
+		}
+		data := buf.Bytes()
+		p, format, err := image_ext.NewTileReader(bytes.NewReader(data), int64(len(data)), nil)
+		if err != nil {
+			t.Fatalf("NewTileReader: %v", err)
+		}
+		if format != "rawp" {
+			t.Fatalf("NewTileReader: bad format, expect = %q, got = %q", "rawp", format)
+		}
+		tTestTileReader(t, "rawp", p, golden)
+	}
+}
+
+func TestImageTileReader_paletted(t *testing.T) {
+	palette := color.Palette{color.Gray{Y: 10}, color.Gray{Y: 200}}
+	m := image.NewPaletted(image.Rect(0, 0, 40, 30), palette)
+	for i := range m.Pix {
+		m.Pix[i] = uint8(i % 3 % 2)
+	}
+	p := image_ext.NewImageTileReader(m)
+	buf := image.NewPaletted(image.Rect(0, 0, 40, 30), palette)
+	r := image.Rect(5, 6, 25, 16)
+	sub, err := p.ReadRect(r, buf)
+	if err != nil {
+		t.Fatalf("ReadRect: %v", err)
+	}
+	if sub.Bounds() != r {
+		t.Fatalf("ReadRect: bad bounds, expect = %v, got = %v", r, sub.Bounds())
+	}
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			if got, want := sub.At(x, y), m.At(x, y); got != want {
+				t.Fatalf("ReadRect: bad color at (%d, %d), expect = %v, got = %v", x, y, want, got)
+			}
+		}
+	}
+}
+
+func tTestTileReader(t *testing.T, name string, p image_ext.TileReader, golden image.Image) {
+	b := golden.Bounds()
+	if cfg := p.Config(); cfg.Width != b.Dx() || cfg.Height != b.Dy() {
+		t.Fatalf("%s: bad config, expect = %v, got = %dx%d", name, b, cfg.Width, cfg.Height)
+	}
+	for _, r := range tTileReaderRects {
+		m, err := p.ReadRect(r, nil)
+		if err != nil {
+			t.Fatalf("%s: ReadRect(%v): %v", name, r, err)
+		}
+		if want := r.Intersect(b); m.Bounds() != want {
+			t.Fatalf("%s: ReadRect(%v): bad bounds, expect = %v, got = %v", name, r, want, m.Bounds())
+		}
+		tCompareRect(t, name, m, golden)
+	}
+}
+
+func tCompareRect(t *testing.T, name string, m, golden image.Image) {
+	b := m.Bounds()
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			r0, g0, b0, a0 := m.At(x, y).RGBA()
+			r1, g1, b1, a1 := golden.At(x, y).RGBA()
+			if r0 != r1 || g0 != g1 || b0 != b1 || a0 != a1 {
+				t.Fatalf("%s: pixel(%d, %d), expect = %v, got = %v",
+					name, x, y, golden.At(x, y), m.At(x, y),
+				)
+			}
+		}
+	}
+}
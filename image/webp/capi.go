@@ -2,6 +2,9 @@
 // Use of this source code is governed by a BSD-style
 // license that can be found in the LICENSE file.
 
+//go:build cgo
+// +build cgo
+
 package webp
 
 /*
@@ -15,6 +18,9 @@ import (
 	"unsafe"
 )
 
+// hasLossyEncoder reports whether the lossy encoders are supported.
+const hasLossyEncoder = true
+
 func webpGetInfo(data []byte) (width, height int, has_alpha bool, err error) {
 	if len(data) == 0 {
 		err = errors.New("webpGetInfo: bad arguments")
@@ -0,0 +1,69 @@
+// Copyright 2014 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build !cgo
+// +build !cgo
+
+package webp
+
+// Without cgo, the pure Go decoder and lossless encoder are used. The lossy
+// encoders return an *image_ext.UnsupportedOptionError.
+
+// hasLossyEncoder reports whether the lossy encoders are supported.
+const hasLossyEncoder = false
+
+func webpGetInfo(data []byte) (width, height int, has_alpha bool, err error) {
+	return goGetInfo(data)
+}
+
+func webpDecodeGray(data []byte) (pix []byte, width, height int, err error) {
+	return goDecodeGray(data)
+}
+
+func webpDecodeRGB(data []byte) (pix []byte, width, height int, err error) {
+	return goDecodeRGB(data)
+}
+
+func webpDecodeRGBA(data []byte) (pix []byte, width, height int, err error) {
+	return goDecodeRGBA(data)
+}
+
+func webpEncodeGray(
+	pix []byte, width, height, stride int,
+	quality_factor float32,
+) (output []byte, err error) {
+	return nil, errLossyEncoder(quality_factor)
+}
+
+func webpEncodeRGB(
+	pix []byte, width, height, stride int,
+	quality_factor float32,
+) (output []byte, err error) {
+	return nil, errLossyEncoder(quality_factor)
+}
+
+func webpEncodeRGBA(
+	pix []byte, width, height, stride int,
+	quality_factor float32,
+) (output []byte, err error) {
+	return nil, errLossyEncoder(quality_factor)
+}
+
+func webpEncodeLosslessGray(
+	pix []byte, width, height, stride int,
+) (output []byte, err error) {
+	return goEncodeLosslessGray(pix, width, height, stride)
+}
+
+func webpEncodeLosslessRGB(
+	pix []byte, width, height, stride int,
+) (output []byte, err error) {
+	return goEncodeLosslessRGB(pix, width, height, stride)
+}
+
+func webpEncodeLosslessRGBA(
+	pix []byte, width, height, stride int,
+) (output []byte, err error) {
+	return goEncodeLosslessRGBA(pix, width, height, stride)
+}
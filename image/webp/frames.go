@@ -0,0 +1,283 @@
+// Copyright 2014 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package webp
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+	"io/ioutil"
+	"time"
+
+	image_ext "github.com/chai2010/gopkg/image"
+	"github.com/chai2010/gopkg/image/convert"
+)
+
+// VP8X animation flag.
+const vp8xFlagAnimation = 0x02
+
+// ANMF flags.
+const (
+	anmfFlagDispose = 0x01 // dispose to the background color
+	anmfFlagNoBlend = 0x02 // do not blend with the canvas
+)
+
+// DecodeFrames reads an animated WEBP image from r and returns all the
+// frames. A still image returns a single frame.
+func DecodeFrames(r io.Reader, opt *Options) (frames *image_ext.Frames, err error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return
+	}
+	chunks, err := readChunks(data)
+	if err != nil {
+		return
+	}
+
+	var vp8x []byte
+	for _, chunk := range chunks {
+		if chunk.fourCC == "VP8X" && len(chunk.data) >= 10 {
+			vp8x = chunk.data
+		}
+	}
+	if vp8x == nil || vp8x[0]&vp8xFlagAnimation == 0 {
+		var m image.Image
+		if m, err = Decode(bytes.NewReader(data), opt); err != nil {
+			return
+		}
+		frames = image_ext.NewFrames(m)
+		frames.LoopCount = 1
+		return
+	}
+
+	frames = &image_ext.Frames{
+		Config: image.Config{
+			ColorModel: color.RGBAModel,
+			Width:      int(getUint24(vp8x[4:])) + 1,
+			Height:     int(getUint24(vp8x[7:])) + 1,
+		},
+	}
+	if opt != nil && opt.ColorModel != nil {
+		frames.Config.ColorModel = opt.ColorModel
+	}
+	for _, chunk := range chunks {
+		switch chunk.fourCC {
+		case "ANIM":
+			if len(chunk.data) < 6 {
+				err = fmt.Errorf("image/webp: DecodeFrames, bad ANIM chunk")
+				return
+			}
+			bgra := chunk.data[:4]
+			frames.Background = color.RGBA{R: bgra[2], G: bgra[1], B: bgra[0], A: bgra[3]}
+			frames.LoopCount = int(binary.LittleEndian.Uint16(chunk.data[4:6]))
+		case "ANMF":
+			var frame image_ext.Frame
+			if frame, err = decodeFrame(chunk.data, opt); err != nil {
+				return
+			}
+			frames.Frame = append(frames.Frame, frame)
+		}
+	}
+	return
+}
+
+// decodeFrame decodes the ANMF chunk data.
+func decodeFrame(data []byte, opt *Options) (frame image_ext.Frame, err error) {
+	if len(data) < 16 {
+		err = fmt.Errorf("image/webp: DecodeFrames, bad ANMF chunk")
+		return
+	}
+	x := int(getUint24(data[0:])) * 2
+	y := int(getUint24(data[3:])) * 2
+	frame.Delay = time.Duration(getUint24(data[12:])) * time.Millisecond
+	frame.Blend = data[15]&anmfFlagNoBlend == 0
+	if data[15]&anmfFlagDispose != 0 {
+		frame.Disposal = image_ext.DisposalBackground
+	}
+
+	// the frame data is the ALPH/VP8/VP8L chunks of a still image
+	var list []riffChunk
+	var hasAlpha bool
+	for i := 16; i+8 <= len(data); {
+		n := int(binary.LittleEndian.Uint32(data[i+4:]))
+		if n < 0 || i+8+n > len(data) {
+			err = fmt.Errorf("image/webp: DecodeFrames, bad frame chunk size, %d", n)
+			return
+		}
+		chunk := riffChunk{string(data[i : i+4]), data[i+8 : i+8+n]}
+		if chunk.fourCC == "ALPH" {
+			hasAlpha = true
+		}
+		list = append(list, chunk)
+		i += 8 + n + n&1
+	}
+	if hasAlpha {
+		vp8x := make([]byte, 10)
+		vp8x[0] = vp8xFlagAlpha
+		putUint24(vp8x[4:], getUint24(data[6:]))
+		putUint24(vp8x[7:], getUint24(data[9:]))
+		list = append([]riffChunk{{"VP8X", vp8x}}, list...)
+	}
+
+	m, err := Decode(bytes.NewReader(writeChunks(list)), opt)
+	if err != nil {
+		return
+	}
+	var model color.Model = color.RGBAModel
+	if opt != nil && opt.ColorModel != nil {
+		model = opt.ColorModel
+	}
+	frame.Image = translateImage(m, image.Pt(x, y), model)
+	return
+}
+
+// translateImage moves the image m to the point pt of the canvas, the
+// other images are copied in the color model.
+func translateImage(m image.Image, pt image.Point, model color.Model) image.Image {
+	if pt == image.ZP {
+		return m
+	}
+	switch m := m.(type) {
+	case *image.Gray:
+		m.Rect = m.Rect.Add(pt)
+	case *image.RGBA:
+		m.Rect = m.Rect.Add(pt)
+	case *image_ext.RGB:
+		m.Rect = m.Rect.Add(pt)
+	default:
+		return convert.ColorModel(&translatedImage{m, pt}, model)
+	}
+	return m
+}
+
+// translatedImage is the image m moved by pt.
+type translatedImage struct {
+	m  image.Image
+	pt image.Point
+}
+
+func (p *translatedImage) ColorModel() color.Model { return p.m.ColorModel() }
+func (p *translatedImage) Bounds() image.Rectangle { return p.m.Bounds().Add(p.pt) }
+func (p *translatedImage) At(x, y int) color.Color { return p.m.At(x-p.pt.X, y-p.pt.Y) }
+
+// EncodeFrames writes all the frames to w as an animated WEBP image.
+// The frames must be placed at even offsets of the canvas.
+func EncodeFrames(w io.Writer, frames *image_ext.Frames, opt *Options) (err error) {
+	width, height := frames.Config.Width, frames.Config.Height
+	if width <= 0 || height <= 0 {
+		for _, frame := range frames.Frame {
+			b := frame.Image.Bounds()
+			if b.Max.X > width {
+				width = b.Max.X
+			}
+			if b.Max.Y > height {
+				height = b.Max.Y
+			}
+		}
+	}
+
+	var flags byte = vp8xFlagAnimation
+	list := []riffChunk{{"VP8X", nil}, {"ANIM", nil}}
+	for i, frame := range frames.Frame {
+		b := frame.Image.Bounds()
+		if b.Min.X < 0 || b.Min.Y < 0 || b.Min.X%2 != 0 || b.Min.Y%2 != 0 {
+			err = fmt.Errorf("image/webp: EncodeFrames, frame %d, bad offset: %v", i, b.Min)
+			return
+		}
+		if b.Empty() || b.Max.X > width || b.Max.Y > height {
+			err = fmt.Errorf("image/webp: EncodeFrames, frame %d, bad bounds: %v", i, b)
+			return
+		}
+
+		var buf bytes.Buffer
+		if err = Encode(&buf, frame.Image, opt); err != nil {
+			return
+		}
+		var chunks []riffChunk
+		if chunks, err = readChunks(buf.Bytes()); err != nil {
+			return
+		}
+
+		anmf := bytes.NewBuffer(make([]byte, 16))
+		hdr := anmf.Bytes()
+		putUint24(hdr[0:], uint32(b.Min.X/2))
+		putUint24(hdr[3:], uint32(b.Min.Y/2))
+		putUint24(hdr[6:], uint32(b.Dx()-1))
+		putUint24(hdr[9:], uint32(b.Dy()-1))
+		putUint24(hdr[12:], uint32(frame.Delay/time.Millisecond))
+		if !frame.Blend {
+			hdr[15] |= anmfFlagNoBlend
+		}
+		switch frame.Disposal {
+		case image_ext.DisposalNone:
+		case image_ext.DisposalBackground:
+			hdr[15] |= anmfFlagDispose
+		default:
+			err = fmt.Errorf("image/webp: EncodeFrames, bad disposal: %v", frame.Disposal)
+			return
+		}
+		for _, chunk := range chunks {
+			switch chunk.fourCC {
+			case "ALPH":
+				flags |= vp8xFlagAlpha
+			case "VP8L":
+				// the alpha of lossless images is in the bitstream
+				if len(chunk.data) >= 5 && chunk.data[4]&0x10 != 0 {
+					flags |= vp8xFlagAlpha
+				}
+			case "VP8 ":
+			default:
+				continue
+			}
+			anmf.WriteString(chunk.fourCC)
+			binary.Write(anmf, binary.LittleEndian, uint32(len(chunk.data)))
+			anmf.Write(chunk.data)
+			if len(chunk.data)&1 != 0 {
+				anmf.WriteByte(0)
+			}
+		}
+		list = append(list, riffChunk{"ANMF", anmf.Bytes()})
+	}
+
+	vp8x := make([]byte, 10)
+	vp8x[0] = flags
+	putUint24(vp8x[4:], uint32(width-1))
+	putUint24(vp8x[7:], uint32(height-1))
+	list[0].data = vp8x
+
+	anim := make([]byte, 6)
+	if frames.Background != nil {
+		c := color.RGBAModel.Convert(frames.Background).(color.RGBA)
+		anim[0], anim[1], anim[2], anim[3] = c.B, c.G, c.R, c.A
+	}
+	binary.LittleEndian.PutUint16(anim[4:], uint16(frames.LoopCount))
+	list[1].data = anim
+
+	_, err = w.Write(writeChunks(list))
+	return
+}
+
+func getUint24(b []byte) uint32 {
+	return uint32(b[0]) | uint32(b[1])<<8 | uint32(b[2])<<16
+}
+
+func imageExtDecodeAll(r io.Reader, opt *image_ext.Options) (*image_ext.Frames, error) {
+	p, err := newOptions(opt)
+	if err != nil {
+		return nil, err
+	}
+	return DecodeFrames(r, p)
+}
+
+func imageExtEncodeAll(w io.Writer, frames *image_ext.Frames, opt *image_ext.Options) error {
+	p, err := newEncodeOptions(opt)
+	if err != nil {
+		return err
+	}
+	return EncodeFrames(w, frames, p)
+}
@@ -0,0 +1,185 @@
+// Copyright 2014 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package webp
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"io"
+	"io/ioutil"
+
+	image_ext "github.com/chai2010/gopkg/image"
+)
+
+// VP8X flags.
+const (
+	vp8xFlagXMP   = 0x04
+	vp8xFlagEXIF  = 0x08
+	vp8xFlagAlpha = 0x10
+	vp8xFlagICC   = 0x20
+)
+
+type riffChunk struct {
+	fourCC string
+	data   []byte
+}
+
+// DecodeWithMetadata reads a WEBP image and its EXIF/XMP/ICC metadata from r.
+func DecodeWithMetadata(r io.Reader, opt *Options) (m image.Image, meta *image_ext.Metadata, err error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return
+	}
+	chunks, err := readChunks(data)
+	if err != nil {
+		return
+	}
+	meta = new(image_ext.Metadata)
+	for _, chunk := range chunks {
+		switch chunk.fourCC {
+		case "ICCP":
+			meta.ICC = append([]byte(nil), chunk.data...)
+		case "EXIF":
+			meta.Exif = append([]byte(nil), chunk.data...)
+		case "XMP ":
+			meta.XMP = append([]byte(nil), chunk.data...)
+		}
+	}
+	if m, err = Decode(bytes.NewReader(data), opt); err != nil {
+		return
+	}
+	return
+}
+
+// EncodeWithMetadata writes the image m and its metadata to w in WEBP format,
+// the extended file format (VP8X) is used when there is metadata.
+// The GeoTIFF tags are dropped, their name is returned.
+func EncodeWithMetadata(w io.Writer, m image.Image, meta *image_ext.Metadata, opt *Options) (dropped []string, err error) {
+	var buf bytes.Buffer
+	if err = Encode(&buf, m, opt); err != nil {
+		return
+	}
+	data := buf.Bytes()
+
+	if meta != nil && !meta.GeoTIFF.IsEmpty() {
+		dropped = append(dropped, image_ext.MetadataGeoTIFF)
+	}
+	if meta == nil || (len(meta.ICC) == 0 && len(meta.Exif) == 0 && len(meta.XMP) == 0) {
+		_, err = w.Write(data)
+		return
+	}
+
+	chunks, err := readChunks(data)
+	if err != nil {
+		return
+	}
+	width, height, hasAlpha, err := GetInfo(data)
+	if err != nil {
+		return
+	}
+
+	var flags byte
+	var images []riffChunk
+	for _, chunk := range chunks {
+		if chunk.fourCC == "VP8X" {
+			flags = chunk.data[0]
+			continue
+		}
+		images = append(images, chunk)
+	}
+	if hasAlpha {
+		flags |= vp8xFlagAlpha
+	}
+
+	var list []riffChunk
+	if len(meta.ICC) != 0 {
+		flags |= vp8xFlagICC
+		list = append(list, riffChunk{"ICCP", meta.ICC})
+	}
+	list = append(list, images...)
+	if len(meta.Exif) != 0 {
+		flags |= vp8xFlagEXIF
+		list = append(list, riffChunk{"EXIF", meta.Exif})
+	}
+	if len(meta.XMP) != 0 {
+		flags |= vp8xFlagXMP
+		list = append(list, riffChunk{"XMP ", meta.XMP})
+	}
+
+	vp8x := make([]byte, 10)
+	vp8x[0] = flags
+	putUint24(vp8x[4:], uint32(width-1))
+	putUint24(vp8x[7:], uint32(height-1))
+	list = append([]riffChunk{{"VP8X", vp8x}}, list...)
+
+	_, err = w.Write(writeChunks(list))
+	return
+}
+
+// readChunks returns the chunks of the RIFF/WEBP file in data.
+func readChunks(data []byte) (chunks []riffChunk, err error) {
+	if len(data) < 12 || string(data[:4]) != "RIFF" || string(data[8:12]) != "WEBP" {
+		err = fmt.Errorf("image/webp: not a WEBP file")
+		return
+	}
+	size := int(binary.LittleEndian.Uint32(data[4:8])) + 8
+	if size > len(data) {
+		size = len(data)
+	}
+	for i := 12; i+8 <= size; {
+		n := int(binary.LittleEndian.Uint32(data[i+4:]))
+		if n < 0 || i+8+n > size {
+			err = fmt.Errorf("image/webp: bad chunk size, %d", n)
+			return
+		}
+		chunks = append(chunks, riffChunk{
+			fourCC: string(data[i : i+4]),
+			data:   data[i+8 : i+8+n],
+		})
+		i += 8 + n + n&1
+	}
+	return
+}
+
+// writeChunks returns the RIFF/WEBP file of the chunks.
+func writeChunks(chunks []riffChunk) []byte {
+	var buf bytes.Buffer
+	buf.WriteString("RIFF\x00\x00\x00\x00WEBP")
+	for _, chunk := range chunks {
+		buf.WriteString(chunk.fourCC)
+		binary.Write(&buf, binary.LittleEndian, uint32(len(chunk.data)))
+		buf.Write(chunk.data)
+		if len(chunk.data)&1 != 0 {
+			buf.WriteByte(0)
+		}
+	}
+	data := buf.Bytes()
+	binary.LittleEndian.PutUint32(data[4:8], uint32(len(data)-8))
+	return data
+}
+
+func putUint24(b []byte, v uint32) {
+	b[0] = byte(v)
+	b[1] = byte(v >> 8)
+	b[2] = byte(v >> 16)
+}
+
+func imageExtDecodeWithMetadata(r io.Reader, opt *image_ext.Options) (image.Image, *image_ext.Metadata, error) {
+	p, err := newOptions(opt)
+	if err != nil {
+		return nil, nil, err
+	}
+	return DecodeWithMetadata(r, p)
+}
+
+func imageExtEncodeWithMetadata(w io.Writer, m image.Image, meta *image_ext.Metadata, opt *image_ext.Options) ([]string, error) {
+	p, err := newEncodeOptions(opt)
+	if err != nil {
+		return nil, err
+	}
+	return EncodeWithMetadata(w, m, meta, p)
+}
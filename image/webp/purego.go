@@ -0,0 +1,303 @@
+// Copyright 2014 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package webp
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/color"
+
+	"code.google.com/p/go.image/vp8"
+	"code.google.com/p/go.image/vp8l"
+)
+
+// The pure Go versions of the libwebp functions, they are used when cgo is
+// disabled. The lossy (VP8) and lossless (VP8L) images can be decoded, but
+// only the lossless images can be encoded.
+
+func goGetInfo(data []byte) (width, height int, hasAlpha bool, err error) {
+	chunks, err := readChunks(data)
+	if err != nil {
+		return
+	}
+	for _, chunk := range chunks {
+		switch chunk.fourCC {
+		case "VP8X":
+			if len(chunk.data) < 10 {
+				err = fmt.Errorf("image/webp: bad VP8X chunk")
+				return
+			}
+			width = int(getUint24(chunk.data[4:])) + 1
+			height = int(getUint24(chunk.data[7:])) + 1
+			hasAlpha = chunk.data[0]&vp8xFlagAlpha != 0
+			return
+		case "VP8 ":
+			d := vp8.NewDecoder()
+			d.Init(bytes.NewReader(chunk.data), len(chunk.data))
+			fh, err := d.DecodeFrameHeader()
+			if err != nil {
+				return 0, 0, false, err
+			}
+			return fh.Width, fh.Height, false, nil
+		case "VP8L":
+			config, err := vp8l.DecodeConfig(bytes.NewReader(chunk.data))
+			if err != nil {
+				return 0, 0, false, err
+			}
+			hasAlpha = len(chunk.data) >= 5 && chunk.data[4]&0x10 != 0
+			return config.Width, config.Height, hasAlpha, nil
+		}
+	}
+	err = fmt.Errorf("image/webp: no image chunk")
+	return
+}
+
+// goDecode decodes the first image of data, the lossy images are returned
+// as *image.YCbCr with the alpha in a separate plane, the lossless images
+// are returned as *image.NRGBA.
+func goDecode(data []byte) (m image.Image, alpha []byte, err error) {
+	chunks, err := readChunks(data)
+	if err != nil {
+		return
+	}
+	var alph []byte
+	for _, chunk := range chunks {
+		switch chunk.fourCC {
+		case "ALPH":
+			alph = chunk.data
+		case "VP8 ":
+			d := vp8.NewDecoder()
+			d.Init(bytes.NewReader(chunk.data), len(chunk.data))
+			if _, err = d.DecodeFrameHeader(); err != nil {
+				return
+			}
+			var ycbcr *image.YCbCr
+			if ycbcr, err = d.DecodeFrame(); err != nil {
+				return
+			}
+			if alph != nil {
+				b := ycbcr.Bounds()
+				if alpha, err = goDecodeAlpha(alph, b.Dx(), b.Dy()); err != nil {
+					return
+				}
+			}
+			return ycbcr, alpha, nil
+		case "VP8L":
+			m, err = vp8l.Decode(bytes.NewReader(chunk.data))
+			return
+		}
+	}
+	err = fmt.Errorf("image/webp: no image chunk")
+	return
+}
+
+// goDecodeAlpha decodes the ALPH chunk of the lossy images.
+func goDecodeAlpha(data []byte, width, height int) (alpha []byte, err error) {
+	if len(data) < 1 {
+		err = fmt.Errorf("image/webp: bad ALPH chunk")
+		return
+	}
+	compression, filter := data[0]&0x03, (data[0]>>2)&0x03
+	switch compression {
+	case 0:
+		if len(data)-1 < width*height {
+			err = fmt.Errorf("image/webp: bad ALPH chunk size, %d", len(data))
+			return
+		}
+		alpha = append([]byte(nil), data[1:1+width*height]...)
+	case 1:
+		// the VP8L image without header, the alpha is in the green channel
+		stream := make([]byte, 5, 5+len(data)-1)
+		stream[0] = vp8lSignature
+		binary.LittleEndian.PutUint32(stream[1:], uint32(width-1)|uint32(height-1)<<14)
+		stream = append(stream, data[1:]...)
+		m, err := vp8l.Decode(bytes.NewReader(stream))
+		if err != nil {
+			return nil, err
+		}
+		nrgba, ok := m.(*image.NRGBA)
+		if !ok || nrgba.Rect.Dx() != width || nrgba.Rect.Dy() != height {
+			return nil, fmt.Errorf("image/webp: bad ALPH image")
+		}
+		alpha = make([]byte, width*height)
+		for y := 0; y < height; y++ {
+			for x := 0; x < width; x++ {
+				alpha[y*width+x] = nrgba.Pix[y*nrgba.Stride+x*4+1]
+			}
+		}
+	default:
+		err = fmt.Errorf("image/webp: bad ALPH compression, %d", compression)
+		return
+	}
+	goUnfilterAlpha(alpha, width, height, filter)
+	return
+}
+
+// goUnfilterAlpha reverts the horizontal (1), vertical (2) or gradient (3)
+// filter of the alpha plane.
+func goUnfilterAlpha(alpha []byte, width, height int, filter byte) {
+	if filter == 0 {
+		return
+	}
+	for y := 0; y < height; y++ {
+		row := alpha[y*width:][:width]
+		var top []byte
+		if y > 0 {
+			top = alpha[(y-1)*width:][:width]
+		}
+		for x := 0; x < width; x++ {
+			var pred byte
+			switch {
+			case x == 0 && y == 0:
+				pred = 0
+			case y == 0:
+				pred = row[x-1]
+			case x == 0:
+				pred = top[0]
+			case filter == 1:
+				pred = row[x-1]
+			case filter == 2:
+				pred = top[x]
+			default:
+				pred = clampByte(int(row[x-1]) + int(top[x]) - int(top[x-1]))
+			}
+			row[x] += pred
+		}
+	}
+}
+
+// goNRGBAAt returns the non-premultiplied color of the pixel (x, y).
+func goNRGBAAt(m image.Image, alpha []byte, x, y int) color.NRGBA {
+	switch m := m.(type) {
+	case *image.YCbCr:
+		yi, ci := m.YOffset(x, y), m.COffset(x, y)
+		r, g, b := color.YCbCrToRGB(m.Y[yi], m.Cb[ci], m.Cr[ci])
+		a := uint8(0xff)
+		if alpha != nil {
+			a = alpha[(y-m.Rect.Min.Y)*m.Rect.Dx()+x-m.Rect.Min.X]
+		}
+		return color.NRGBA{R: r, G: g, B: b, A: a}
+	case *image.NRGBA:
+		return m.NRGBAAt(x, y)
+	}
+	return color.NRGBAModel.Convert(m.At(x, y)).(color.NRGBA)
+}
+
+func goDecodeGray(data []byte) (pix []byte, width, height int, err error) {
+	m, alpha, err := goDecode(data)
+	if err != nil {
+		return
+	}
+	b := m.Bounds()
+	width, height = b.Dx(), b.Dy()
+	pix = make([]byte, width*height*1)
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			i := (y-b.Min.Y)*width + x - b.Min.X
+			if m, ok := m.(*image.YCbCr); ok {
+				pix[i] = m.Y[m.YOffset(x, y)]
+				continue
+			}
+			c := goNRGBAAt(m, alpha, x, y)
+			pix[i], _, _ = color.RGBToYCbCr(c.R, c.G, c.B)
+		}
+	}
+	return
+}
+
+func goDecodeRGB(data []byte) (pix []byte, width, height int, err error) {
+	m, alpha, err := goDecode(data)
+	if err != nil {
+		return
+	}
+	b := m.Bounds()
+	width, height = b.Dx(), b.Dy()
+	pix = make([]byte, width*height*3)
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			i := ((y-b.Min.Y)*width + x - b.Min.X) * 3
+			c := goNRGBAAt(m, alpha, x, y)
+			pix[i+0] = c.R
+			pix[i+1] = c.G
+			pix[i+2] = c.B
+		}
+	}
+	return
+}
+
+// goDecodeRGBA returns the non-premultiplied pixels, as libwebp.
+func goDecodeRGBA(data []byte) (pix []byte, width, height int, err error) {
+	m, alpha, err := goDecode(data)
+	if err != nil {
+		return
+	}
+	b := m.Bounds()
+	width, height = b.Dx(), b.Dy()
+	pix = make([]byte, width*height*4)
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			i := ((y-b.Min.Y)*width + x - b.Min.X) * 4
+			c := goNRGBAAt(m, alpha, x, y)
+			pix[i+0] = c.R
+			pix[i+1] = c.G
+			pix[i+2] = c.B
+			pix[i+3] = c.A
+		}
+	}
+	return
+}
+
+// goEncodeLossless encodes the pixels with n channels, the gray pixels are
+// stored as RGB.
+func goEncodeLossless(pix []byte, width, height, stride, n int) (output []byte, err error) {
+	if len(pix) == 0 || width <= 0 || height <= 0 || stride < width*n {
+		err = fmt.Errorf("image/webp: goEncodeLossless, bad arguments")
+		return
+	}
+	if len(pix) < (height-1)*stride+width*n {
+		err = fmt.Errorf("image/webp: goEncodeLossless, bad arguments")
+		return
+	}
+	argb := make([]uint32, width*height)
+	hasAlpha := false
+	for y := 0; y < height; y++ {
+		row := pix[y*stride:]
+		for x := 0; x < width; x++ {
+			var r, g, b, a uint32
+			switch n {
+			case 1:
+				r, g, b, a = uint32(row[x]), uint32(row[x]), uint32(row[x]), 0xff
+			case 3:
+				r, g, b, a = uint32(row[x*3+0]), uint32(row[x*3+1]), uint32(row[x*3+2]), 0xff
+			case 4:
+				r, g, b, a = uint32(row[x*4+0]), uint32(row[x*4+1]), uint32(row[x*4+2]), uint32(row[x*4+3])
+			}
+			if a != 0xff {
+				hasAlpha = true
+			}
+			argb[y*width+x] = a<<24 | r<<16 | g<<8 | b
+		}
+	}
+	data, err := vp8lEncode(argb, width, height, hasAlpha)
+	if err != nil {
+		return
+	}
+	output = writeChunks([]riffChunk{{"VP8L", data}})
+	return
+}
+
+func goEncodeLosslessGray(pix []byte, width, height, stride int) (output []byte, err error) {
+	return goEncodeLossless(pix, width, height, stride, 1)
+}
+
+func goEncodeLosslessRGB(pix []byte, width, height, stride int) (output []byte, err error) {
+	return goEncodeLossless(pix, width, height, stride, 3)
+}
+
+func goEncodeLosslessRGBA(pix []byte, width, height, stride int) (output []byte, err error) {
+	return goEncodeLossless(pix, width, height, stride, 4)
+}
@@ -0,0 +1,157 @@
+// Copyright 2014 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package webp
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"io/ioutil"
+	"testing"
+
+	image_ext "github.com/chai2010/gopkg/image"
+	_ "github.com/chai2010/gopkg/image/png"
+)
+
+// tNewRGBA returns a RGBA image with smooth colors, noise and transparent
+// pixels, the pixels are non-premultiplied as libwebp.
+func tNewRGBA(w, h int) *image.RGBA {
+	m := image.NewRGBA(image.Rect(0, 0, w, h))
+	seed := uint32(1)
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			seed = seed*1103515245 + 12345
+			i := m.PixOffset(x, y)
+			m.Pix[i+0] = uint8(x * 3)
+			m.Pix[i+1] = uint8(y*5 + x)
+			m.Pix[i+2] = uint8(seed >> 24)
+			m.Pix[i+3] = uint8(x * y)
+		}
+	}
+	return m
+}
+
+func TestGoEncodeLossless(t *testing.T) {
+	img, _, err := image_ext.Load(testdataDir+"video-001.png", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rgba := tNewRGBA(123, 77)
+	rgb := image_ext.NewRGB(img.Bounds())
+	gray := image.NewGray(img.Bounds())
+	for y := rgb.Rect.Min.Y; y < rgb.Rect.Max.Y; y++ {
+		for x := rgb.Rect.Min.X; x < rgb.Rect.Max.X; x++ {
+			rgb.Set(x, y, img.At(x, y))
+			gray.Set(x, y, img.At(x, y))
+		}
+	}
+
+	for i, v := range []struct {
+		m      image.Image
+		encode func() ([]byte, error)
+	}{
+		{gray, func() ([]byte, error) {
+			return goEncodeLosslessGray(gray.Pix, gray.Rect.Dx(), gray.Rect.Dy(), gray.Stride)
+		}},
+		{rgb, func() ([]byte, error) {
+			return goEncodeLosslessRGB(rgb.Pix, rgb.Rect.Dx(), rgb.Rect.Dy(), rgb.Stride)
+		}},
+		{rgba, func() ([]byte, error) {
+			return goEncodeLosslessRGBA(rgba.Pix, rgba.Rect.Dx(), rgba.Rect.Dy(), rgba.Stride)
+		}},
+		{rgba.SubImage(image.Rect(5, 7, 100, 50)), func() ([]byte, error) {
+			m := rgba.SubImage(image.Rect(5, 7, 100, 50)).(*image.RGBA)
+			return goEncodeLosslessRGBA(m.Pix, m.Rect.Dx(), m.Rect.Dy(), m.Stride)
+		}},
+		{image.NewRGBA(image.Rect(0, 0, 1, 1)), func() ([]byte, error) {
+			return goEncodeLosslessRGBA(make([]byte, 4), 1, 1, 4)
+		}},
+	} {
+		data, err := v.encode()
+		if err != nil {
+			t.Fatalf("%d: %v", i, err)
+		}
+		b := v.m.Bounds()
+		width, height, hasAlpha, err := GetInfo(data)
+		if err != nil {
+			t.Fatalf("%d: %v", i, err)
+		}
+		if width != b.Dx() || height != b.Dy() || hasAlpha != (v.m.ColorModel() == color.RGBAModel) {
+			t.Fatalf("%d: bad info, %d, %d, %v", i, width, height, hasAlpha)
+		}
+
+		// decoded by libwebp when cgo is enabled
+		for k, decode := range []func([]byte) ([]byte, int, int, error){webpDecodeRGBA, goDecodeRGBA} {
+			pix, _, _, err := decode(data)
+			if err != nil {
+				t.Fatalf("%d, %d: %v", i, k, err)
+			}
+			for y := b.Min.Y; y < b.Max.Y; y++ {
+				for x := b.Min.X; x < b.Max.X; x++ {
+					off := ((y-b.Min.Y)*b.Dx() + x - b.Min.X) * 4
+					c0 := color.NRGBAModel.Convert(v.m.At(x, y))
+					if m, ok := v.m.(*image.RGBA); ok {
+						c := m.RGBAAt(x, y)
+						c0 = color.NRGBA{c.R, c.G, c.B, c.A}
+					}
+					c1 := color.NRGBA{pix[off+0], pix[off+1], pix[off+2], pix[off+3]}
+					if c0 != c1 {
+						t.Fatalf("%d, %d: pixel(%d, %d), expect = %v, got = %v", i, k, x, y, c0, c1)
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestGoDecode(t *testing.T) {
+	img0, _, err := image_ext.Load(testdataDir+"video-001.png", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadFile(testdataDir + "video-001.webp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	pix, w, h, err := goDecodeRGB(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	img1 := &image_ext.RGB{Pix: pix, Stride: w * 3, Rect: image.Rect(0, 0, w, h)}
+	if got, want := averageDelta(img0, img1), int64(12<<8); got > want {
+		t.Fatalf("average delta too high; got %d, want <= %d", got, want)
+	}
+
+	pix, w, h, err = goDecodeGray(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gray := &image.Gray{Pix: pix, Stride: w, Rect: image.Rect(0, 0, w, h)}
+	if got, want := averageDelta(img0, gray), int64(64<<8); got > want {
+		t.Fatalf("gray: average delta too high; got %d, want <= %d", got, want)
+	}
+}
+
+// TestGoDecode_alpha decodes the lossy images with alpha, which are written
+// as lossless images without cgo.
+func TestGoDecode_alpha(t *testing.T) {
+	rgba := tNewRGBA(64, 48)
+	var buf bytes.Buffer
+	if err := Encode(&buf, rgba, nil); err != nil {
+		t.Fatal(err)
+	}
+	pix, w, h, err := goDecodeRGBA(buf.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if w != 64 || h != 48 {
+		t.Fatalf("bad size, %d, %d", w, h)
+	}
+	for i := 3; i < len(pix); i += 4 {
+		if pix[i] != rgba.Pix[i] {
+			t.Fatalf("bad alpha, pixel %d, expect = %d, got = %d", i/4, rgba.Pix[i], pix[i])
+		}
+	}
+}
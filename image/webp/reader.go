@@ -21,7 +21,7 @@ const DefaulQuality = 90
 type Options struct {
 	ColorModel color.Model
 	Lossless   bool
-	Quality    float32 // 0 ~ 100
+	Quality    float32 // 0 ~ 100, DefaulQuality if zero
 }
 
 // DecodeConfig returns the color model and dimensions of a WEBP image without
@@ -80,31 +80,64 @@ func imageDecode(r io.Reader) (image.Image, error) {
 	return Decode(r, nil)
 }
 
-func imageExtDecode(r io.Reader, opt interface{}) (image.Image, error) {
-	if opt, ok := opt.(*Options); ok {
-		return Decode(r, opt)
-	} else {
-		return Decode(r, nil)
+// newOptions converts the common options to the webp options.
+func newOptions(opt *image_ext.Options) (*Options, error) {
+	var p Options
+	if ok, err := image_ext.ConvertOptions("webp", opt, &p); !ok {
+		return nil, err
 	}
+	return &p, nil
 }
 
-func imageExtEncode(w io.Writer, m image.Image, opt interface{}) error {
-	if opt, ok := opt.(*Options); ok {
-		return Encode(w, m, opt)
-	} else {
-		return Encode(w, m, nil)
+// newEncodeOptions converts the common options to the webp options.
+func newEncodeOptions(opt *image_ext.Options) (*Options, error) {
+	var p Options
+	ok, err := image_ext.ConvertEncodeOptions("webp", opt, &p, image_ext.EncodeSupport{
+		Quality: true,
+	})
+	if !ok {
+		return nil, err
+	}
+	if opt.Lossless {
+		p.Lossless = true
+	}
+	if opt.Quality != 0 {
+		p.Quality = opt.Quality
+	}
+	return &p, nil
+}
+
+func imageExtDecode(r io.Reader, opt *image_ext.Options) (image.Image, error) {
+	p, err := newOptions(opt)
+	if err != nil {
+		return nil, err
+	}
+	return Decode(r, p)
+}
+
+func imageExtEncode(w io.Writer, m image.Image, opt *image_ext.Options) error {
+	p, err := newEncodeOptions(opt)
+	if err != nil {
+		return err
 	}
+	return Encode(w, m, p)
 }
 
 func init() {
 	image.RegisterFormat("webp", "RIFF????WEBPVP8 ", imageDecode, DecodeConfig)
+	image.RegisterFormat("webp", "RIFF????WEBPVP8L", imageDecode, DecodeConfig)
+	image.RegisterFormat("webp", "RIFF????WEBPVP8X", imageDecode, DecodeConfig)
 
 	image_ext.RegisterFormat(image_ext.Format{
-		Name:         "webp",
-		Extensions:   []string{".webp"},
-		Magics:       []string{"RIFF????WEBPVP8 "},
-		DecodeConfig: DecodeConfig,
-		Decode:       imageExtDecode,
-		Encode:       imageExtEncode,
+		Name:               "webp",
+		Extensions:         []string{".webp"},
+		Magics:             []string{"RIFF????WEBPVP8 ", "RIFF????WEBPVP8L", "RIFF????WEBPVP8X"},
+		DecodeConfig:       DecodeConfig,
+		Decode:             imageExtDecode,
+		Encode:             imageExtEncode,
+		DecodeWithMetadata: imageExtDecodeWithMetadata,
+		EncodeWithMetadata: imageExtEncodeWithMetadata,
+		DecodeAll:          imageExtDecodeAll,
+		EncodeAll:          imageExtEncodeAll,
 	})
 }
@@ -0,0 +1,639 @@
+// Copyright 2014 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package webp
+
+import (
+	"fmt"
+	"sort"
+)
+
+// The VP8L lossless bitstream is defined at:
+// https://developers.google.com/speed/webp/docs/webp_lossless_bitstream_specification
+//
+// The encoder uses the subtract green and the predictor transforms, and
+// codes the pixels with LZ77 and one group of Huffman codes. The color
+// cache and the meta prefix codes are not used.
+const (
+	vp8lSignature     = 0x2f
+	vp8lMaxSize       = 1 << 14
+	vp8lNumLiterals   = 256
+	vp8lNumLengths    = 24
+	vp8lNumDistances  = 40
+	vp8lMaxLength     = 4096
+	vp8lMaxDistance   = 1<<20 - 120 // the largest distance of the 40 distance codes
+	vp8lMinMatch      = 3
+	vp8lHashLog       = 16
+	vp8lMaxChain      = 32 // the matches tried for a pixel
+	vp8lPredictorBits = 4  // the predictor blocks are 16x16 pixels
+	vp8lMaxCodeLength = 15
+)
+
+const (
+	vp8lTransformPredictor     = 0
+	vp8lTransformSubtractGreen = 2
+)
+
+var vp8lCodeLengthOrder = [19]int{17, 18, 0, 1, 2, 3, 4, 5, 16, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15}
+
+// vp8lEncode returns the VP8L bitstream of the ARGB pixels, the pixels are
+// modified by the transforms.
+func vp8lEncode(argb []uint32, width, height int, hasAlpha bool) (data []byte, err error) {
+	if width <= 0 || height <= 0 || width > vp8lMaxSize || height > vp8lMaxSize {
+		err = fmt.Errorf("image/webp: vp8lEncode, bad size, width = %d, height = %d", width, height)
+		return
+	}
+	if len(argb) != width*height {
+		err = fmt.Errorf("image/webp: vp8lEncode, bad pixels size, %d", len(argb))
+		return
+	}
+
+	w := new(vp8lBitWriter)
+	w.writeBits(vp8lSignature, 8)
+	w.writeBits(uint32(width-1), 14)
+	w.writeBits(uint32(height-1), 14)
+	if hasAlpha {
+		w.writeBits(1, 1)
+	} else {
+		w.writeBits(0, 1)
+	}
+	w.writeBits(0, 3) // version
+
+	// the decoder reverts the transforms in the reverse order
+	vp8lSubtractGreen(argb)
+	w.writeBits(1, 1)
+	w.writeBits(vp8lTransformSubtractGreen, 2)
+
+	residuals, modes, mw, mh := vp8lPredict(argb, width, height)
+	w.writeBits(1, 1)
+	w.writeBits(vp8lTransformPredictor, 2)
+	w.writeBits(vp8lPredictorBits-2, 3)
+	vp8lWriteImage(w, modes, mw, mh, false)
+
+	w.writeBits(0, 1) // no more transforms
+	vp8lWriteImage(w, residuals, width, height, true)
+	return w.flush(), nil
+}
+
+type vp8lBitWriter struct {
+	buf   []byte
+	bits  uint64
+	nbits uint
+}
+
+// writeBits writes the n low bits of v, the first bit is the lowest.
+func (w *vp8lBitWriter) writeBits(v uint32, n uint) {
+	w.bits |= uint64(v) << w.nbits
+	w.nbits += n
+	for w.nbits >= 8 {
+		w.buf = append(w.buf, byte(w.bits))
+		w.bits >>= 8
+		w.nbits -= 8
+	}
+}
+
+func (w *vp8lBitWriter) flush() []byte {
+	if w.nbits > 0 {
+		w.buf = append(w.buf, byte(w.bits))
+		w.bits, w.nbits = 0, 0
+	}
+	return w.buf
+}
+
+func vp8lSubtractGreen(argb []uint32) {
+	for i, v := range argb {
+		g := (v >> 8) & 0xff
+		r := (v>>16 - g) & 0xff
+		b := (v - g) & 0xff
+		argb[i] = v&0xff00ff00 | r<<16 | b
+	}
+}
+
+// vp8lPredict chooses the predictor of every block, and returns the
+// residuals and the predictor image.
+func vp8lPredict(argb []uint32, width, height int) (residuals, modes []uint32, mw, mh int) {
+	size := 1 << vp8lPredictorBits
+	mw = (width + size - 1) >> vp8lPredictorBits
+	mh = (height + size - 1) >> vp8lPredictorBits
+	residuals = make([]uint32, len(argb))
+	modes = make([]uint32, mw*mh)
+	for by := 0; by < mh; by++ {
+		for bx := 0; bx < mw; bx++ {
+			x0, y0 := bx*size, by*size
+			x1, y1 := minInt(x0+size, width), minInt(y0+size, height)
+
+			best, bestCost := 0, -1
+			for mode := 0; mode < 14; mode++ {
+				cost := 0
+				for y := y0; y < y1 && (bestCost < 0 || cost < bestCost); y++ {
+					for x := x0; x < x1; x++ {
+						cost += vp8lCost(vp8lSubPixels(argb[y*width+x], vp8lPredictPixel(argb, x, y, width, mode)))
+					}
+				}
+				if bestCost < 0 || cost < bestCost {
+					best, bestCost = mode, cost
+				}
+			}
+
+			// the mode is stored in the green channel
+			modes[by*mw+bx] = 0xff000000 | uint32(best)<<8
+			for y := y0; y < y1; y++ {
+				for x := x0; x < x1; x++ {
+					i := y*width + x
+					residuals[i] = vp8lSubPixels(argb[i], vp8lPredictPixel(argb, x, y, width, best))
+				}
+			}
+		}
+	}
+	return
+}
+
+// vp8lCost returns the sum of the absolute values of the residual channels.
+func vp8lCost(v uint32) (cost int) {
+	for s := uint(0); s < 32; s += 8 {
+		if c := int(byte(v >> s)); c < 128 {
+			cost += c
+		} else {
+			cost += 256 - c
+		}
+	}
+	return
+}
+
+// vp8lPredictPixel returns the prediction of the pixel (x, y), the top row
+// and the left column don't depend on the mode.
+func vp8lPredictPixel(argb []uint32, x, y, width, mode int) uint32 {
+	i := y*width + x
+	switch {
+	case x == 0 && y == 0:
+		return 0xff000000
+	case y == 0:
+		return argb[i-1]
+	case x == 0:
+		return argb[i-width]
+	}
+
+	// the TR of the rightmost pixel is the leftmost pixel of the current row
+	L, T, TL, TR := argb[i-1], argb[i-width], argb[i-width-1], argb[i-width+1]
+	switch mode {
+	case 0:
+		return 0xff000000
+	case 1:
+		return L
+	case 2:
+		return T
+	case 3:
+		return TR
+	case 4:
+		return TL
+	case 5:
+		return vp8lAverage2(vp8lAverage2(L, TR), T)
+	case 6:
+		return vp8lAverage2(L, TL)
+	case 7:
+		return vp8lAverage2(L, T)
+	case 8:
+		return vp8lAverage2(TL, T)
+	case 9:
+		return vp8lAverage2(T, TR)
+	case 10:
+		return vp8lAverage2(vp8lAverage2(L, TL), vp8lAverage2(T, TR))
+	case 11:
+		return vp8lSelect(L, T, TL)
+	case 12:
+		return vp8lClampAddSubtractFull(L, T, TL)
+	case 13:
+		return vp8lClampAddSubtractHalf(vp8lAverage2(L, T), TL)
+	}
+	panic("image/webp: vp8lPredictPixel, unreachable!")
+}
+
+func vp8lAverage2(a, b uint32) uint32 {
+	return (((a ^ b) & 0xfefefefe) >> 1) + (a & b)
+}
+
+func vp8lSubPixels(a, b uint32) (v uint32) {
+	for s := uint(0); s < 32; s += 8 {
+		v |= uint32(byte(a>>s)-byte(b>>s)) << s
+	}
+	return
+}
+
+func vp8lSelect(L, T, TL uint32) uint32 {
+	pL, pT := 0, 0
+	for s := uint(0); s < 32; s += 8 {
+		pL += absInt(int(byte(T>>s)) - int(byte(TL>>s)))
+		pT += absInt(int(byte(L>>s)) - int(byte(TL>>s)))
+	}
+	if pL < pT {
+		return L
+	}
+	return T
+}
+
+func vp8lClampAddSubtractFull(a, b, c uint32) (v uint32) {
+	for s := uint(0); s < 32; s += 8 {
+		v |= uint32(clampByte(int(byte(a>>s))+int(byte(b>>s))-int(byte(c>>s)))) << s
+	}
+	return
+}
+
+func vp8lClampAddSubtractHalf(a, b uint32) (v uint32) {
+	for s := uint(0); s < 32; s += 8 {
+		x, y := int(byte(a>>s)), int(byte(b>>s))
+		v |= uint32(clampByte(x+(x-y)/2)) << s
+	}
+	return
+}
+
+// vp8lToken is a literal pixel, or a backward reference if length > 0.
+type vp8lToken struct {
+	argb     uint32
+	length   int32
+	distCode int32
+}
+
+// vp8lWriteImage writes the entropy coded image, only the main image has
+// the meta prefix codes bit.
+func vp8lWriteImage(w *vp8lBitWriter, argb []uint32, width, height int, isMain bool) {
+	w.writeBits(0, 1) // no color cache
+	if isMain {
+		w.writeBits(0, 1) // no meta prefix codes
+	}
+
+	tokens := vp8lBackwardRefs(argb, width)
+	hist := [5][]int{
+		make([]int, vp8lNumLiterals+vp8lNumLengths),
+		make([]int, vp8lNumLiterals),
+		make([]int, vp8lNumLiterals),
+		make([]int, vp8lNumLiterals),
+		make([]int, vp8lNumDistances),
+	}
+	for _, t := range tokens {
+		if t.length == 0 {
+			hist[0][(t.argb>>8)&0xff]++
+			hist[1][(t.argb>>16)&0xff]++
+			hist[2][t.argb&0xff]++
+			hist[3][t.argb>>24]++
+			continue
+		}
+		code, _, _ := vp8lPrefixCode(int(t.length))
+		hist[0][vp8lNumLiterals+code]++
+		code, _, _ = vp8lPrefixCode(int(t.distCode))
+		hist[4][code]++
+	}
+
+	var codes [5][]uint32
+	var lengths [5][]byte
+	for k := range hist {
+		codes[k], lengths[k] = vp8lWriteHuffmanCode(w, hist[k])
+	}
+	put := func(k int, symbol int) {
+		w.writeBits(codes[k][symbol], uint(lengths[k][symbol]))
+	}
+	for _, t := range tokens {
+		if t.length == 0 {
+			put(0, int((t.argb>>8)&0xff))
+			put(1, int((t.argb>>16)&0xff))
+			put(2, int(t.argb&0xff))
+			put(3, int(t.argb>>24))
+			continue
+		}
+		code, n, extra := vp8lPrefixCode(int(t.length))
+		put(0, vp8lNumLiterals+code)
+		w.writeBits(extra, n)
+		code, n, extra = vp8lPrefixCode(int(t.distCode))
+		put(4, code)
+		w.writeBits(extra, n)
+	}
+}
+
+// vp8lBackwardRefs parses the pixels into literals and backward references.
+func vp8lBackwardRefs(argb []uint32, width int) (tokens []vp8lToken) {
+	n := len(argb)
+	head := make([]int32, 1<<vp8lHashLog) // the last positions + 1
+	chain := make([]int32, n)             // the previous positions + 1
+	hash := func(i int) uint32 {
+		return (argb[i]*0x1e35a7bd ^ argb[i+1]*0x9e3779b1) >> (32 - vp8lHashLog)
+	}
+	insert := func(i int) {
+		if i+1 < n {
+			h := hash(i)
+			chain[i] = head[h]
+			head[h] = int32(i + 1)
+		}
+	}
+	matchLen := func(ref, i int) int {
+		k := 0
+		for k < vp8lMaxLength && i+k < n && argb[ref+k] == argb[i+k] {
+			k++
+		}
+		return k
+	}
+
+	for i := 0; i < n; {
+		bestLen, bestDist := 0, 0
+		// the pixels above and left are the most likely matches
+		for _, d := range [2]int{width, 1} {
+			if d <= i {
+				if l := matchLen(i-d, i); l > bestLen {
+					bestLen, bestDist = l, d
+				}
+			}
+		}
+		if i+1 < n {
+			ref := int(head[hash(i)]) - 1
+			for k := 0; ref >= 0 && i-ref <= vp8lMaxDistance && k < vp8lMaxChain; k++ {
+				if l := matchLen(ref, i); l > bestLen {
+					bestLen, bestDist = l, i-ref
+				}
+				ref = int(chain[ref]) - 1
+			}
+		}
+		if bestLen < vp8lMinMatch {
+			tokens = append(tokens, vp8lToken{argb: argb[i]})
+			insert(i)
+			i++
+			continue
+		}
+		tokens = append(tokens, vp8lToken{
+			length:   int32(bestLen),
+			distCode: int32(vp8lDistanceCode(bestDist, width)),
+		})
+		for end := i + bestLen; i < end; i++ {
+			insert(i)
+		}
+	}
+	return
+}
+
+// vp8lDistanceCode maps the distance to the distance code, the codes 1 and
+// 2 are the pixels above and left, the codes above 120 are the distances.
+func vp8lDistanceCode(dist, width int) int {
+	switch dist {
+	case width:
+		return 1
+	case 1:
+		return 2
+	}
+	return dist + 120
+}
+
+// vp8lPrefixCode returns the prefix code and the extra bits of v >= 1.
+func vp8lPrefixCode(v int) (code int, n uint, extra uint32) {
+	d := v - 1
+	if d < 4 {
+		return d, 0, 0
+	}
+	h := 0
+	for d>>uint(h+1) != 0 {
+		h++
+	}
+	n = uint(h - 1)
+	code = 2*h + (d>>n)&1
+	extra = uint32(d) & (1<<n - 1)
+	return
+}
+
+// vp8lWriteHuffmanCode writes the Huffman code of the histogram, and
+// returns the bit reversed codes and the code lengths of the symbols.
+func vp8lWriteHuffmanCode(w *vp8lBitWriter, hist []int) (codes []uint32, lengths []byte) {
+	var symbols []int
+	for s, n := range hist {
+		if n > 0 {
+			symbols = append(symbols, s)
+		}
+	}
+	lengths = make([]byte, len(hist))
+	codes = make([]uint32, len(hist))
+
+	// the simple code of one symbol takes no bits
+	if len(symbols) == 0 || (len(symbols) == 1 && symbols[0] < 256) {
+		symbol := 0
+		if len(symbols) == 1 {
+			symbol = symbols[0]
+		}
+		w.writeBits(1, 1) // simple code
+		w.writeBits(0, 1) // one symbol
+		if symbol < 2 {
+			w.writeBits(0, 1)
+			w.writeBits(uint32(symbol), 1)
+		} else {
+			w.writeBits(1, 1)
+			w.writeBits(uint32(symbol), 8)
+		}
+		return
+	}
+
+	lengths = vp8lHuffmanLengths(hist, vp8lMaxCodeLength)
+	codes = vp8lCanonicalCodes(lengths)
+
+	// run-length code the lengths with the symbols 0-15, 16, 17 and 18
+	type clToken struct {
+		symbol int
+		extra  uint32
+	}
+	var tokens []clToken
+	prev := byte(8)
+	for i := 0; i < len(lengths); {
+		l := lengths[i]
+		run := 1
+		for i+run < len(lengths) && lengths[i+run] == l {
+			run++
+		}
+		i += run
+		if l == 0 {
+			for run >= 11 {
+				k := minInt(run, 138)
+				tokens = append(tokens, clToken{18, uint32(k - 11)})
+				run -= k
+			}
+			if run >= 3 {
+				tokens = append(tokens, clToken{17, uint32(run - 3)})
+				run = 0
+			}
+		} else {
+			if l != prev {
+				tokens = append(tokens, clToken{int(l), 0})
+				prev = l
+				run--
+			}
+			for run >= 3 {
+				k := minInt(run, 6)
+				tokens = append(tokens, clToken{16, uint32(k - 3)})
+				run -= k
+			}
+		}
+		for ; run > 0; run-- {
+			tokens = append(tokens, clToken{int(l), 0})
+		}
+	}
+
+	clHist := make([]int, len(vp8lCodeLengthOrder))
+	for _, t := range tokens {
+		clHist[t.symbol]++
+	}
+	clLengths := vp8lHuffmanLengths(clHist, 7)
+	clCodes := vp8lCanonicalCodes(clLengths)
+
+	w.writeBits(0, 1) // normal code
+	n := len(vp8lCodeLengthOrder)
+	for n > 4 && clLengths[vp8lCodeLengthOrder[n-1]] == 0 {
+		n--
+	}
+	w.writeBits(uint32(n-4), 4)
+	for _, s := range vp8lCodeLengthOrder[:n] {
+		w.writeBits(uint32(clLengths[s]), 3)
+	}
+	w.writeBits(0, 1) // the lengths of all the symbols follow
+	for _, t := range tokens {
+		w.writeBits(clCodes[t.symbol], uint(clLengths[t.symbol]))
+		switch t.symbol {
+		case 16:
+			w.writeBits(t.extra, 2)
+		case 17:
+			w.writeBits(t.extra, 3)
+		case 18:
+			w.writeBits(t.extra, 7)
+		}
+	}
+	return
+}
+
+// vp8lHuffmanLengths returns the code lengths of the histogram, the lengths
+// are not longer than maxLength. At least two symbols have a code, so the
+// code is complete for the decoders.
+func vp8lHuffmanLengths(hist []int, maxLength int) []byte {
+	lengths := make([]byte, len(hist))
+	var symbols []int
+	for s, n := range hist {
+		if n > 0 {
+			symbols = append(symbols, s)
+		}
+	}
+	switch len(symbols) {
+	case 0:
+		lengths[0], lengths[1] = 1, 1
+		return lengths
+	case 1:
+		lengths[symbols[0]] = 1
+		if symbols[0] == 0 {
+			lengths[1] = 1
+		} else {
+			lengths[0] = 1
+		}
+		return lengths
+	}
+	sort.Stable(vp8lSymbolsByCount{symbols, hist})
+
+	// the rare symbols have larger counts until the code is short enough
+	n := len(symbols)
+	counts := make([]int, 2*n-1)
+	parent := make([]int, 2*n-1)
+	depth := make([]int, 2*n-1)
+	for minCount := 1; ; minCount *= 2 {
+		for i, s := range symbols {
+			counts[i] = maxInt(hist[s], minCount)
+		}
+		// merge the leaves and the inner nodes, both are sorted
+		leaf, inner := 0, n
+		pick := func(next int) int {
+			if leaf < n && (inner >= next || counts[leaf] <= counts[inner]) {
+				leaf++
+				return leaf - 1
+			}
+			inner++
+			return inner - 1
+		}
+		for next := n; next < 2*n-1; next++ {
+			a := pick(next)
+			b := pick(next)
+			counts[next] = counts[a] + counts[b]
+			parent[a], parent[b] = next, next
+		}
+		depth[2*n-2] = 0
+		maxDepth := 0
+		for i := 2*n - 3; i >= 0; i-- {
+			depth[i] = depth[parent[i]] + 1
+			if i < n && depth[i] > maxDepth {
+				maxDepth = depth[i]
+			}
+		}
+		if maxDepth <= maxLength {
+			break
+		}
+	}
+	for i, s := range symbols {
+		lengths[s] = byte(depth[i])
+	}
+	return lengths
+}
+
+type vp8lSymbolsByCount struct {
+	symbols []int
+	hist    []int
+}
+
+func (p vp8lSymbolsByCount) Len() int           { return len(p.symbols) }
+func (p vp8lSymbolsByCount) Less(i, j int) bool { return p.hist[p.symbols[i]] < p.hist[p.symbols[j]] }
+func (p vp8lSymbolsByCount) Swap(i, j int)      { p.symbols[i], p.symbols[j] = p.symbols[j], p.symbols[i] }
+
+// vp8lCanonicalCodes returns the canonical codes of the lengths, the bits
+// of the codes are reversed, because the first bit is the lowest one.
+func vp8lCanonicalCodes(lengths []byte) []uint32 {
+	var count [vp8lMaxCodeLength + 1]uint32
+	for _, l := range lengths {
+		count[l]++
+	}
+	count[0] = 0
+	var next [vp8lMaxCodeLength + 1]uint32
+	for l := 1; l <= vp8lMaxCodeLength; l++ {
+		next[l] = (next[l-1] + count[l-1]) << 1
+	}
+	codes := make([]uint32, len(lengths))
+	for s, l := range lengths {
+		if l == 0 {
+			continue
+		}
+		code := next[l]
+		next[l]++
+		var rev uint32
+		for k := byte(0); k < l; k++ {
+			rev = rev<<1 | (code>>k)&1
+		}
+		codes[s] = rev
+	}
+	return codes
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+func absInt(v int) int {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
+
+func clampByte(v int) byte {
+	if v < 0 {
+		return 0
+	}
+	if v > 255 {
+		return 255
+	}
+	return byte(v)
+}
@@ -6,6 +6,12 @@
 //
 // WEBP is defined at:
 // https://developers.google.com/speed/webp/docs/riff_container
+//
+// The package uses libwebp with cgo. When cgo is disabled, a pure Go
+// implementation is used instead, it decodes the lossy and lossless images,
+// but only encodes lossless images. Encode writes lossless images if the
+// Quality is not set, EncodeGray, EncodeRGB, EncodeRGBA and Encode with a
+// Quality of the lossy images return an *image_ext.UnsupportedOptionError.
 package webp
 
 import (
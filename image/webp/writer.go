@@ -13,13 +13,26 @@ import (
 	"github.com/chai2010/gopkg/image/convert"
 )
 
-// Encode writes the image m to w in WEBP format.
+// Encode writes the image m to w in WEBP format. Without cgo, the images are
+// lossless, see the package doc.
 func Encode(w io.Writer, m image.Image, opt *Options) (err error) {
 	if opt != nil && opt.ColorModel != nil {
 		m = convert.ColorModel(m, opt.ColorModel)
 	}
+	lossless := opt != nil && opt.Lossless
+	quality := float32(DefaulQuality)
+	if opt != nil && opt.Quality != 0 {
+		quality = opt.Quality
+	}
+	if !lossless && !hasLossyEncoder {
+		if opt != nil && opt.Quality != 0 {
+			return errLossyEncoder(quality)
+		}
+		lossless = true
+	}
+
 	var output []byte
-	if opt != nil && opt.Lossless {
+	if lossless {
 		switch m := adjustImage(m).(type) {
 		case *image.Gray:
 			if output, err = EncodeLosslessGray(m); err != nil {
@@ -37,10 +50,6 @@ func Encode(w io.Writer, m image.Image, opt *Options) (err error) {
 			panic("image/webp: Encode, unreachable!")
 		}
 	} else {
-		quality := float32(DefaulQuality)
-		if opt != nil {
-			quality = opt.Quality
-		}
 		switch m := adjustImage(m).(type) {
 		case *image.Gray:
 			if output, err = EncodeGray(m, quality); err != nil {
@@ -62,10 +71,18 @@ func Encode(w io.Writer, m image.Image, opt *Options) (err error) {
 	return
 }
 
+// errLossyEncoder returns the error of the lossy encoders without cgo.
+func errLossyEncoder(quality float32) error {
+	return image_ext.NewUnsupportedOptionError("webp", "lossy Quality %v without cgo", quality)
+}
+
 func adjustImage(m image.Image) image.Image {
 	switch m := m.(type) {
 	case *image.Gray, *image_ext.RGB, *image.RGBA:
 		return m
+	case *image_ext.MaskedImage:
+		// the nodata pixels are zero
+		return adjustImage(m.Image)
 	default:
 		b := m.Bounds()
 		rgba := image.NewRGBA(b)
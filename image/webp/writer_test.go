@@ -6,6 +6,8 @@ package webp
 
 import (
 	"bytes"
+	"image"
+	"image/color"
 	"io/ioutil"
 	"testing"
 
@@ -59,6 +61,12 @@ func TestEncode(t *testing.T) {
 			Lossless: v.Lossless,
 			Quality:  v.Quality,
 		})
+		if !v.Lossless && !hasLossyEncoder {
+			if _, ok := err.(*image_ext.UnsupportedOptionError); !ok {
+				t.Fatalf("%d: expect UnsupportedOptionError, got %v", i, err)
+			}
+			continue
+		}
 		if err != nil {
 			t.Fatalf("%d: %v", i, err)
 		}
@@ -76,6 +84,34 @@ func TestEncode(t *testing.T) {
 	}
 }
 
+func TestEncode_defaultQuality(t *testing.T) {
+	img0, _, err := image_ext.Load(testdataDir+"video-001.png", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, opt := range []*Options{nil, {}, {ColorModel: color.RGBAModel}} {
+		var buf bytes.Buffer
+		if err := Encode(&buf, img0, opt); err != nil {
+			t.Fatalf("%d: %v", i, err)
+		}
+		img1, err := Decode(&buf, nil)
+		if err != nil {
+			t.Fatalf("%d: %v", i, err)
+		}
+		// the images are lossless without cgo
+		want := int64(5 << 8)
+		if !hasLossyEncoder {
+			want = 0
+		}
+		if got := averageDelta(img0, img1); got > want {
+			t.Fatalf("%d: average delta too high; got %d, want <= %d", i, got, want)
+		}
+	}
+	if _, err := EncodeRGBA(image.NewRGBA(image.Rect(0, 0, 8, 8)), 75); !hasLossyEncoder && err == nil {
+		t.Fatalf("EncodeRGBA: expect error without cgo")
+	}
+}
+
 // BenchmarkEncode benchmarks the encoding of an image.
 func BenchmarkEncode(b *testing.B) {
 	img, _, err := image_ext.Load(testdataDir+"video-001.png", nil)
@@ -89,3 +125,47 @@ func BenchmarkEncode(b *testing.B) {
 		Encode(ioutil.Discard, img, nil)
 	}
 }
+
+func TestDecodeFrames_colorModel(t *testing.T) {
+	frames := &image_ext.Frames{Config: image.Config{Width: 20, Height: 16}}
+	for i, r := range []image.Rectangle{
+		image.Rect(0, 0, 20, 16),
+		image.Rect(4, 2, 14, 12),
+	} {
+		m := image.NewGray(r)
+		for j := range m.Pix {
+			m.Pix[j] = uint8(i*50 + j*3)
+		}
+		frames.Frame = append(frames.Frame, image_ext.Frame{Image: m})
+	}
+	var buf bytes.Buffer
+	if err := EncodeFrames(&buf, frames, &Options{Lossless: true}); err != nil {
+		t.Fatalf("EncodeFrames: %v", err)
+	}
+
+	got, err := DecodeFrames(bytes.NewReader(buf.Bytes()), &Options{ColorModel: color.Gray16Model})
+	if err != nil {
+		t.Fatalf("DecodeFrames: %v", err)
+	}
+	if len(got.Frame) != len(frames.Frame) {
+		t.Fatalf("bad frame number: %d", len(got.Frame))
+	}
+	for i, frame := range got.Frame {
+		m, ok := frame.Image.(*image.Gray16)
+		if !ok {
+			t.Fatalf("%d: bad image type: %T", i, frame.Image)
+		}
+		want := frames.Frame[i].Image.(*image.Gray)
+		if m.Bounds() != want.Bounds() {
+			t.Fatalf("%d: bad bounds: %v, want %v", i, m.Bounds(), want.Bounds())
+		}
+		b := want.Bounds()
+		for y := b.Min.Y; y < b.Max.Y; y++ {
+			for x := b.Min.X; x < b.Max.X; x++ {
+				if v, w := m.Gray16At(x, y).Y, uint16(want.GrayAt(x, y).Y)*0x101; v != w {
+					t.Fatalf("%d: bad pixel at (%d, %d): %d, want %d", i, x, y, v, w)
+				}
+			}
+		}
+	}
+}
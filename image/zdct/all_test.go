@@ -3,3 +3,229 @@
 // license that can be found in the LICENSE file.
 
 package zdct
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"io/ioutil"
+	"math/rand"
+	"runtime"
+	"testing"
+
+	image_ext "github.com/chai2010/gopkg/image"
+	color_ext "github.com/chai2010/gopkg/image/color"
+)
+
+// tFillImage fills the image with smooth samples and a little noise, the
+// samples use the full range of the color model.
+func tFillImage(m image_ext.ImageBuffer) image_ext.ImageBuffer {
+	b := m.Bounds()
+	rnd := rand.New(rand.NewSource(1))
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			v := func(k int) uint16 {
+				return uint16((x*977+y*331)*(k+1) + rnd.Intn(1024))
+			}
+			m.Set(x, y, color.RGBA64{v(0), v(1), v(2), 0xffff})
+			switch m := m.(type) {
+			case *image_ext.Gray16s:
+				m.SetGray16s(x, y, color_ext.Gray16s{Y: int16(v(0))})
+			case *image.RGBA:
+				m.Set(x, y, color.NRGBA{uint8(v(0) >> 8), uint8(v(1) >> 8), uint8(v(2) >> 8), uint8(x * y)})
+			case *image.RGBA64:
+				m.Set(x, y, color.NRGBA64{v(0), v(1), v(2), uint16(x * y * 97)})
+			}
+		}
+	}
+	return m
+}
+
+// tMaxDelta returns the max difference of the samples, as the 16 bit RGBA.
+// The image m1 may have a different origin.
+func tMaxDelta(m0, m1 image.Image) (delta int) {
+	b := m0.Bounds()
+	dx, dy := m1.Bounds().Min.X-b.Min.X, m1.Bounds().Min.Y-b.Min.Y
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			if m, ok := m0.(*image_ext.Gray16s); ok {
+				d := int(m.Gray16sAt(x, y).Y) - int(m1.(*image_ext.Gray16s).Gray16sAt(x+dx, y+dy).Y)
+				if d < 0 {
+					d = -d
+				}
+				if d > delta {
+					delta = d
+				}
+				continue
+			}
+			r0, g0, b0, a0 := m0.At(x, y).RGBA()
+			r1, g1, b1, a1 := m1.At(x+dx, y+dy).RGBA()
+			for _, d := range []int{int(r0) - int(r1), int(g0) - int(g1), int(b0) - int(b1), int(a0) - int(a1)} {
+				if d < 0 {
+					d = -d
+				}
+				if d > delta {
+					delta = d
+				}
+			}
+		}
+	}
+	return
+}
+
+func tImages() []image.Image {
+	return []image.Image{
+		tFillImage(image.NewGray(image.Rect(0, 0, 31, 17))),
+		tFillImage(image.NewGray16(image.Rect(0, 0, 8, 8))),
+		tFillImage(image_ext.NewGray16s(image.Rect(0, 0, 19, 40))),
+		tFillImage(image_ext.NewRGB(image.Rect(0, 0, 64, 33))),
+		tFillImage(image_ext.NewRGB48(image.Rect(0, 0, 1, 1))),
+		tFillImage(image.NewRGBA(image.Rect(0, 0, 40, 41))),
+		tFillImage(image.NewRGBA64(image.Rect(0, 0, 27, 9))),
+		tFillImage(image.NewGray(image.Rect(0, 0, 50, 50))).(*image.Gray).SubImage(image.Rect(3, 5, 40, 22)),
+	}
+}
+
+func TestEncodeDecode_lossless(t *testing.T) {
+	for i, m0 := range tImages() {
+		for _, quality := range []float32{1, 50, 100} {
+			var buf bytes.Buffer
+			if err := Encode(&buf, m0, &Options{Quality: quality, Lossless: true}); err != nil {
+				t.Fatalf("%d: %v", i, err)
+			}
+			m1, err := Decode(&buf, nil)
+			if err != nil {
+				t.Fatalf("%d: %v", i, err)
+			}
+			if m1.ColorModel() != m0.ColorModel() || !m1.Bounds().Size().Eq(m0.Bounds().Size()) {
+				t.Fatalf("%d: bad image, %T, %v", i, m1, m1.Bounds())
+			}
+			if d := tMaxDelta(m0, m1); d != 0 {
+				t.Fatalf("%d: quality = %v, max delta = %d", i, quality, d)
+			}
+		}
+	}
+}
+
+func TestEncodeDecode_lossy(t *testing.T) {
+	m0 := tFillImage(image.NewGray16(image.Rect(0, 0, 100, 60)))
+	lastSize, lastDelta := 0, 1<<16
+	for i, quality := range []float32{10, 50, 90, 100} {
+		var buf bytes.Buffer
+		if err := Encode(&buf, m0, &Options{Quality: quality}); err != nil {
+			t.Fatalf("%d: %v", i, err)
+		}
+		size := buf.Len()
+		m1, err := Decode(&buf, nil)
+		if err != nil {
+			t.Fatalf("%d: %v", i, err)
+		}
+		d := tMaxDelta(m0, m1)
+		if size <= lastSize || d > lastDelta {
+			t.Fatalf("%d: quality = %v, size = %d, delta = %d, last size = %d, last delta = %d", i, quality, size, d, lastSize, lastDelta)
+		}
+		lastSize, lastDelta = size, d
+	}
+	if lastDelta > 64 {
+		t.Fatalf("quality 100, max delta too high, %d", lastDelta)
+	}
+}
+
+func TestDecodeConfig(t *testing.T) {
+	for i, m := range tImages() {
+		var buf bytes.Buffer
+		if err := Encode(&buf, m, nil); err != nil {
+			t.Fatalf("%d: %v", i, err)
+		}
+		config, err := DecodeConfig(&buf)
+		if err != nil {
+			t.Fatalf("%d: %v", i, err)
+		}
+		b := m.Bounds()
+		if config.ColorModel != m.ColorModel() || config.Width != b.Dx() || config.Height != b.Dy() {
+			t.Fatalf("%d: bad config, %v", i, config)
+		}
+	}
+}
+
+func TestImageExt(t *testing.T) {
+	m0 := tFillImage(image_ext.NewRGB(image.Rect(0, 0, 20, 30)))
+	var buf bytes.Buffer
+	if err := image_ext.Encode("zdct", &buf, m0, &image_ext.Options{Lossless: true}); err != nil {
+		t.Fatal(err)
+	}
+	m1, name, err := image.Decode(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if name != "zdct" || tMaxDelta(m0, m1) != 0 {
+		t.Fatalf("bad image, %s", name)
+	}
+	if err := image_ext.Encode("zdct", &buf, m0, &image_ext.Options{Compression: image_ext.CompressionDeflate}); err == nil {
+		t.Fatal("expect unsupported option error")
+	}
+}
+
+func TestEncode_progress(t *testing.T) {
+	m := tFillImage(image_ext.NewRGB(image.Rect(0, 0, 20, 30)))
+	var last float64
+	opt := &image_ext.Options{Progress: func(done float64) bool {
+		if done <= last {
+			t.Errorf("bad progress, %v after %v", done, last)
+		}
+		last = done
+		return true
+	}}
+	if err := image_ext.Encode("zdct", ioutil.Discard, m, opt); err != nil {
+		t.Fatal(err)
+	}
+	if last != 1 {
+		t.Fatalf("bad progress: %v", last)
+	}
+	err := Encode(ioutil.Discard, m, &Options{Progress: func(done float64) bool { return done < 0.5 }})
+	if err != image_ext.ErrCanceled {
+		t.Fatalf("expect ErrCanceled, got %v", err)
+	}
+}
+
+func TestDecode_corrupt(t *testing.T) {
+	var buf bytes.Buffer
+	if err := Encode(&buf, tFillImage(image.NewRGBA(image.Rect(0, 0, 20, 20))), nil); err != nil {
+		t.Fatal(err)
+	}
+	data := buf.Bytes()
+	for i, n := range []int{0, 8, zdctHeaderSize, zdctHeaderSize + zdctQuantSize, len(data) - 1} {
+		if _, err := Decode(bytes.NewReader(data[:n]), nil); err == nil {
+			t.Fatalf("%d: expect error, size = %d", i, n)
+		}
+	}
+	for i := 0; i < len(data); i += 7 {
+		bad := append([]byte(nil), data...)
+		bad[i] ^= 0x5a
+		if _, err := Decode(bytes.NewReader(bad), nil); err == nil {
+			t.Fatalf("expect error, byte %d", i)
+		}
+	}
+
+	// the header is valid, but the sizes are out of the data, the planes
+	// of the size are not allocated
+	var m0, m1 runtime.MemStats
+	runtime.ReadMemStats(&m0)
+	for i, fn := range []func(hdr *zdctHeader){
+		func(hdr *zdctHeader) { hdr.HeaderSize = 60000 },
+		func(hdr *zdctHeader) { hdr.Width, hdr.Height = 1<<15, 1<<15 },
+	} {
+		hdr, err := zdctDecodeHeader(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		fn(hdr)
+		bad := append(zdctEncodeHeader(hdr), data[zdctHeaderSize:]...)
+		if _, err := Decode(bytes.NewReader(bad), nil); err == nil {
+			t.Fatalf("%d: expect error", i)
+		}
+	}
+	if runtime.ReadMemStats(&m1); m1.TotalAlloc-m0.TotalAlloc > 1<<26 {
+		t.Fatalf("bad alloc size: %d", m1.TotalAlloc-m0.TotalAlloc)
+	}
+}
@@ -76,3 +76,67 @@ var unscaledQuant = [nQuantIndex][blockSize]byte{
 		99, 99, 99, 99, 99, 99, 99, 99,
 	},
 }
+
+// scaleQuant returns the quantization tables for the quality (1 ~ 100) in
+// zig-zag order, the tables of 16 bit samples are 256 times larger.
+func scaleQuant(quality, depth int) (quant [nQuantIndex][blockSize]uint16) {
+	if quality < 1 {
+		quality = 1
+	} else if quality > 100 {
+		quality = 100
+	}
+	// Convert from a quality rating to a scaling factor.
+	var scale int
+	if quality < 50 {
+		scale = 5000 / quality
+	} else {
+		scale = 200 - quality*2
+	}
+	max, mul := 255, 1
+	if depth == 16 {
+		max, mul = 65535, 256
+	}
+	for i := range quant {
+		for j := range quant[i] {
+			x := (int(unscaledQuant[i][j])*scale*mul + 50) / 100
+			if x < 1 {
+				x = 1
+			} else if x > max {
+				x = max
+			}
+			quant[i][j] = uint16(x)
+		}
+	}
+	return
+}
+
+// quantizeBlock quantizes the coefficients of fdct, which are scaled up by 8.
+func quantizeBlock(b *block, quant *[blockSize]uint16) {
+	for zig := 0; zig < blockSize; zig++ {
+		i, q := unzig[zig], int32(quant[zig])*8
+		if b[i] >= 0 {
+			b[i] = (b[i] + q/2) / q
+		} else {
+			b[i] = -((-b[i] + q/2) / q)
+		}
+	}
+}
+
+// reconstructBlock dequantizes the coefficients, and returns the samples
+// clamped to [lo, hi]. The encoder and decoder must get the same samples
+// for the residuals of the lossless images.
+func reconstructBlock(b *block, quant *[blockSize]uint16, shift, lo, hi int32) {
+	for zig := 0; zig < blockSize; zig++ {
+		b[unzig[zig]] *= int32(quant[zig])
+	}
+	idct(b)
+	for i := range b {
+		v := b[i] + shift
+		if v < lo {
+			v = lo
+		} else if v > hi {
+			v = hi
+		}
+		b[i] = v
+	}
+}
@@ -3,4 +3,48 @@
 // license that can be found in the LICENSE file.
 
 // Package zdct implements a dct for 8bit/16bit image.
+//
+// The samples are coded by 8x8 blocks, like the baseline JPEG, but the 16 bit
+// samples are kept, for the medical and DEM images. The Gray, Gray16, Gray16s,
+// RGB, RGB48, RGBA and RGBA64 images are supported, other images are converted.
+//
+// ZDCT Image Structs (Little Endian):
+//
+//	type ZDCTImage struct {
+//		Sig            [4]byte       // 4Bytes, ZDCT
+//		Magic          uint32        // 4Bytes, 0x1DC7380A
+//		Version        uint16        // 2Bytes, 1
+//		HeaderSize     uint16        // 2Bytes, the offset of the Quant tables, 32
+//		Width          uint32        // 4Bytes, image Width
+//		Height         uint32        // 4Bytes, image Height
+//		Channels       byte          // 1Bytes, 1=Gray, 3=RGB, 4=RGBA
+//		Depth          byte          // 1Bytes, 8/16 bits
+//		Flags          byte          // 1Bytes, 1=Lossless, 2=RCT, 4=Signed
+//		Quality        byte          // 1Bytes, 1 ~ 100
+//		Reserved       [4]byte       // 4Bytes, 0
+//		HeaderCheckSum uint32        // 4Bytes, CRC32 of the header before HeaderCheckSum
+//		Quant          [2][64]uint16 // 256Bytes, luminance and chrominance, zig-zag order
+//		QuantCheckSum  uint32        // 4Bytes, CRC32(ZDCTImage.Quant)
+//		Planes         []Plane       // the planes of the Channels
+//	}
+//	type Plane struct {
+//		DataSize     uint32 // 4Bytes, plane data size (Plane.Data)
+//		DataCheckSum uint32 // 4Bytes, CRC32(Plane.Data[Plane.DataSize])
+//		Data         []byte // ?Bytes, deflate compressed blocks and residuals
+//	}
+//
+// The RGB channels are stored as Y, Cb and Cr of the reversible color transform
+// (RCT), the Cb and Cr planes use the chrominance table. The samples are level
+// shifted to signed values, and the planes are padded to the multiple of 8 by
+// the edge samples.
+//
+// Each block is stored in raster order as varints: the difference of the
+// quantized DC and the DC of the previous block, the pairs of (run+1, value)
+// of the non-zero AC in zig-zag order, and 0 at the end of the block. The
+// lossless images are followed by the differences of the samples and the
+// reconstructed samples, so they are decoded exactly.
+//
+// The quantization tables of quality Q are the tables of the JPEG standard
+// scaled by 5000/Q (Q < 50) or 200-2*Q (Q >= 50) percent, and by 256 for the
+// 16 bit samples.
 package zdct
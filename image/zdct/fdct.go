@@ -3,3 +3,135 @@
 // license that can be found in the LICENSE file.
 
 package zdct
+
+// This file implements a Forward Discrete Cosine Transformation, the same
+// algorithm as image/jpeg (the jfdctint.c of the IJG), but the intermediate
+// values are int64, so the 16 bit samples don't overflow.
+
+// Trigonometric constants in 13-bit fixed point format.
+const (
+	fix_0_298631336 = 2446
+	fix_0_390180644 = 3196
+	fix_0_541196100 = 4433
+	fix_0_765366865 = 6270
+	fix_0_899976223 = 7373
+	fix_1_175875602 = 9633
+	fix_1_501321110 = 12299
+	fix_1_847759065 = 15137
+	fix_1_961570560 = 16069
+	fix_2_053119869 = 16819
+	fix_2_562915447 = 20995
+	fix_3_072711026 = 25172
+)
+
+const (
+	constBits = 13
+	pass1Bits = 2
+)
+
+// fdct performs a forward DCT on an 8x8 block of coefficients, the samples
+// must be level shifted, and the results are scaled up by 8.
+func fdct(b *block) {
+	// Pass 1: process rows.
+	for y := 0; y < 8; y++ {
+		s := b[y*8 : y*8+8]
+		x0, x1, x2, x3 := int64(s[0]), int64(s[1]), int64(s[2]), int64(s[3])
+		x4, x5, x6, x7 := int64(s[4]), int64(s[5]), int64(s[6]), int64(s[7])
+
+		tmp0 := x0 + x7
+		tmp1 := x1 + x6
+		tmp2 := x2 + x5
+		tmp3 := x3 + x4
+
+		tmp10 := tmp0 + tmp3
+		tmp12 := tmp0 - tmp3
+		tmp11 := tmp1 + tmp2
+		tmp13 := tmp1 - tmp2
+
+		tmp0 = x0 - x7
+		tmp1 = x1 - x6
+		tmp2 = x2 - x5
+		tmp3 = x3 - x4
+
+		s[0] = int32((tmp10 + tmp11) << pass1Bits)
+		s[4] = int32((tmp10 - tmp11) << pass1Bits)
+		z1 := (tmp12 + tmp13) * fix_0_541196100
+		z1 += 1 << (constBits - pass1Bits - 1)
+		s[2] = int32((z1 + tmp12*fix_0_765366865) >> (constBits - pass1Bits))
+		s[6] = int32((z1 - tmp13*fix_1_847759065) >> (constBits - pass1Bits))
+
+		tmp10 = tmp0 + tmp3
+		tmp11 = tmp1 + tmp2
+		tmp12 = tmp0 + tmp2
+		tmp13 = tmp1 + tmp3
+		z1 = (tmp12 + tmp13) * fix_1_175875602
+		z1 += 1 << (constBits - pass1Bits - 1)
+		tmp0 *= fix_1_501321110
+		tmp1 *= fix_3_072711026
+		tmp2 *= fix_2_053119869
+		tmp3 *= fix_0_298631336
+		tmp10 *= -fix_0_899976223
+		tmp11 *= -fix_2_562915447
+		tmp12 *= -fix_0_390180644
+		tmp13 *= -fix_1_961570560
+
+		tmp12 += z1
+		tmp13 += z1
+		s[1] = int32((tmp0 + tmp10 + tmp12) >> (constBits - pass1Bits))
+		s[3] = int32((tmp1 + tmp11 + tmp13) >> (constBits - pass1Bits))
+		s[5] = int32((tmp2 + tmp11 + tmp12) >> (constBits - pass1Bits))
+		s[7] = int32((tmp3 + tmp10 + tmp13) >> (constBits - pass1Bits))
+	}
+
+	// Pass 2: process columns.
+	// We remove pass1Bits scaling, but leave results scaled up by an overall factor of 8.
+	for x := 0; x < 8; x++ {
+		x0, x1, x2, x3 := int64(b[0*8+x]), int64(b[1*8+x]), int64(b[2*8+x]), int64(b[3*8+x])
+		x4, x5, x6, x7 := int64(b[4*8+x]), int64(b[5*8+x]), int64(b[6*8+x]), int64(b[7*8+x])
+
+		tmp0 := x0 + x7
+		tmp1 := x1 + x6
+		tmp2 := x2 + x5
+		tmp3 := x3 + x4
+
+		tmp10 := tmp0 + tmp3 + 1<<(pass1Bits-1)
+		tmp12 := tmp0 - tmp3
+		tmp11 := tmp1 + tmp2
+		tmp13 := tmp1 - tmp2
+
+		tmp0 = x0 - x7
+		tmp1 = x1 - x6
+		tmp2 = x2 - x5
+		tmp3 = x3 - x4
+
+		b[0*8+x] = int32((tmp10 + tmp11) >> pass1Bits)
+		b[4*8+x] = int32((tmp10 - tmp11) >> pass1Bits)
+
+		z1 := (tmp12 + tmp13) * fix_0_541196100
+		z1 += 1 << (constBits + pass1Bits - 1)
+		b[2*8+x] = int32((z1 + tmp12*fix_0_765366865) >> (constBits + pass1Bits))
+		b[6*8+x] = int32((z1 - tmp13*fix_1_847759065) >> (constBits + pass1Bits))
+
+		tmp10 = tmp0 + tmp3
+		tmp11 = tmp1 + tmp2
+		tmp12 = tmp0 + tmp2
+		tmp13 = tmp1 + tmp3
+		z1 = (tmp12 + tmp13) * fix_1_175875602
+		z1 += 1 << (constBits + pass1Bits - 1)
+		tmp0 *= fix_1_501321110
+		tmp1 *= fix_3_072711026
+		tmp2 *= fix_2_053119869
+		tmp3 *= fix_0_298631336
+		tmp10 *= -fix_0_899976223
+		tmp11 *= -fix_2_562915447
+		tmp12 *= -fix_0_390180644
+		tmp13 *= -fix_1_961570560
+
+		tmp12 += z1
+		tmp13 += z1
+		b[1*8+x] = int32((tmp0 + tmp10 + tmp12) >> (constBits + pass1Bits))
+		b[3*8+x] = int32((tmp1 + tmp11 + tmp13) >> (constBits + pass1Bits))
+		b[5*8+x] = int32((tmp2 + tmp11 + tmp12) >> (constBits + pass1Bits))
+		b[7*8+x] = int32((tmp3 + tmp10 + tmp13) >> (constBits + pass1Bits))
+	}
+}
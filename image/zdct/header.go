@@ -0,0 +1,228 @@
+// Copyright 2014 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package zdct
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"math"
+
+	color_ext "github.com/chai2010/gopkg/image/color"
+)
+
+const (
+	zdctHeaderSize     = 32
+	zdctQuantSize      = int(nQuantIndex)*blockSize*2 + 4 // Quant + QuantCheckSum
+	zdctPlaneFrameSize = 8                                // DataSize + DataCheckSum
+	zdctSig            = "ZDCT"
+	zdctMagic          = 0x1DC7380A
+	zdctVersion        = 1
+	zdctMaxPixels      = 1 << 30
+)
+
+// flags
+const (
+	zdctFlagLossless = 1 << 0 // the residuals of the samples are stored
+	zdctFlagRCT      = 1 << 1 // the RGB channels are stored as Y, Cb, Cr
+	zdctFlagSigned   = 1 << 2 // the samples are signed integers
+)
+
+// ZDCT Image Spec (Little Endian), 32Bytes.
+type zdctHeader struct {
+	Sig            [4]byte // 4Bytes, ZDCT
+	Magic          uint32  // 4Bytes, 0x1DC7380A
+	Version        uint16  // 2Bytes, 1
+	HeaderSize     uint16  // 2Bytes, the offset of the Quant tables, 32
+	Width          uint32  // 4Bytes, image Width
+	Height         uint32  // 4Bytes, image Height
+	Channels       byte    // 1Bytes, 1=Gray, 3=RGB, 4=RGBA
+	Depth          byte    // 1Bytes, 8/16 bits
+	Flags          byte    // 1Bytes, 1=Lossless, 2=RCT, 4=Signed
+	Quality        byte    // 1Bytes, 1 ~ 100, the quality of the Quant tables
+	Reserved       [4]byte // 4Bytes, 0
+	HeaderCheckSum uint32  // 4Bytes, CRC32 of the header before HeaderCheckSum
+}
+
+func zdctMakeHeader(config image.Config, quality int, lossless bool) (hdr *zdctHeader, err error) {
+	if config.Width <= 0 || config.Width > math.MaxInt32 || config.Height <= 0 || config.Height > math.MaxInt32 {
+		err = fmt.Errorf("image/zdct: image size overflow: width = %v, height = %v", config.Width, config.Height)
+		return
+	}
+	hdr = &zdctHeader{
+		Sig:        [4]byte{'Z', 'D', 'C', 'T'},
+		Magic:      zdctMagic,
+		Version:    zdctVersion,
+		HeaderSize: zdctHeaderSize,
+		Width:      uint32(config.Width),
+		Height:     uint32(config.Height),
+		Quality:    byte(quality),
+	}
+	switch config.ColorModel {
+	case color.GrayModel:
+		hdr.Channels, hdr.Depth = 1, 8
+	case color.Gray16Model:
+		hdr.Channels, hdr.Depth = 1, 16
+	case color_ext.Gray16sModel:
+		hdr.Channels, hdr.Depth, hdr.Flags = 1, 16, zdctFlagSigned
+	case color_ext.RGBModel:
+		hdr.Channels, hdr.Depth, hdr.Flags = 3, 8, zdctFlagRCT
+	case color_ext.RGB48Model:
+		hdr.Channels, hdr.Depth, hdr.Flags = 3, 16, zdctFlagRCT
+	case color.RGBAModel:
+		hdr.Channels, hdr.Depth, hdr.Flags = 4, 8, zdctFlagRCT
+	case color.RGBA64Model:
+		hdr.Channels, hdr.Depth, hdr.Flags = 4, 16, zdctFlagRCT
+	default:
+		return nil, fmt.Errorf("image/zdct: unsupported color model, %T", config.ColorModel)
+	}
+	if lossless {
+		hdr.Flags |= zdctFlagLossless
+	}
+	if err = zdctIsValidHeader(hdr); err != nil {
+		return nil, err
+	}
+	return
+}
+
+func zdctIsValidHeader(hdr *zdctHeader) error {
+	if string(hdr.Sig[:]) != zdctSig {
+		return fmt.Errorf("image/zdct: bad Sig, %v", hdr.Sig)
+	}
+	if hdr.Magic != zdctMagic {
+		return fmt.Errorf("image/zdct: bad Magic, %x", hdr.Magic)
+	}
+	if hdr.Version != zdctVersion {
+		return fmt.Errorf("image/zdct: unsupported Version, %d", hdr.Version)
+	}
+	if hdr.HeaderSize < zdctHeaderSize {
+		return fmt.Errorf("image/zdct: bad HeaderSize, %d", hdr.HeaderSize)
+	}
+	if hdr.Width == 0 || hdr.Height == 0 || uint64(hdr.Width)*uint64(hdr.Height) > zdctMaxPixels {
+		return fmt.Errorf("image/zdct: bad size, width = %d, height = %d", hdr.Width, hdr.Height)
+	}
+	if hdr.Channels != 1 && hdr.Channels != 3 && hdr.Channels != 4 {
+		return fmt.Errorf("image/zdct: bad Channels, %d", hdr.Channels)
+	}
+	if hdr.Depth != 8 && hdr.Depth != 16 {
+		return fmt.Errorf("image/zdct: bad Depth, %d", hdr.Depth)
+	}
+	if hdr.Flags&^(zdctFlagLossless|zdctFlagRCT|zdctFlagSigned) != 0 {
+		return fmt.Errorf("image/zdct: bad Flags, %x", hdr.Flags)
+	}
+	if (hdr.Flags&zdctFlagRCT != 0) != (hdr.Channels != 1) {
+		return fmt.Errorf("image/zdct: bad Flags, %x, channels = %d", hdr.Flags, hdr.Channels)
+	}
+	if hdr.Flags&zdctFlagSigned != 0 && (hdr.Channels != 1 || hdr.Depth != 16) {
+		return fmt.Errorf("image/zdct: signed samples must be 16 bit gray")
+	}
+	if hdr.Quality < 1 || hdr.Quality > 100 {
+		return fmt.Errorf("image/zdct: bad Quality, %d", hdr.Quality)
+	}
+	return nil
+}
+
+func zdctEncodeHeader(hdr *zdctHeader) []byte {
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.LittleEndian, hdr)
+	data := buf.Bytes()
+	hdr.HeaderCheckSum = crc32.ChecksumIEEE(data[:zdctHeaderSize-4])
+	binary.LittleEndian.PutUint32(data[zdctHeaderSize-4:], hdr.HeaderCheckSum)
+	return data
+}
+
+func zdctDecodeHeader(data []byte) (hdr *zdctHeader, err error) {
+	if len(data) < zdctHeaderSize {
+		err = fmt.Errorf("image/zdct: bad header.")
+		return
+	}
+	hdr = new(zdctHeader)
+	if err = binary.Read(bytes.NewReader(data[:zdctHeaderSize]), binary.LittleEndian, hdr); err != nil {
+		return nil, err
+	}
+	if v := crc32.ChecksumIEEE(data[:zdctHeaderSize-4]); v != hdr.HeaderCheckSum {
+		return nil, fmt.Errorf("image/zdct: bad HeaderCheckSum, expect = %x, got = %x", hdr.HeaderCheckSum, v)
+	}
+	if err = zdctIsValidHeader(hdr); err != nil {
+		return nil, err
+	}
+	return
+}
+
+func (p *zdctHeader) colorModel() color.Model {
+	switch {
+	case p.Channels == 1 && p.Depth == 8:
+		return color.GrayModel
+	case p.Channels == 1 && p.Flags&zdctFlagSigned != 0:
+		return color_ext.Gray16sModel
+	case p.Channels == 1:
+		return color.Gray16Model
+	case p.Channels == 3 && p.Depth == 8:
+		return color_ext.RGBModel
+	case p.Channels == 3:
+		return color_ext.RGB48Model
+	case p.Depth == 8:
+		return color.RGBAModel
+	}
+	return color.RGBA64Model
+}
+
+func (p *zdctHeader) lossless() bool {
+	return p.Flags&zdctFlagLossless != 0
+}
+
+// sampleRange returns the range of the samples of the channel c, the Cb and
+// Cr of the RCT are differences of the RGB samples.
+func (p *zdctHeader) sampleRange(c int) (lo, hi int32) {
+	max := int32(1)<<p.Depth - 1
+	switch {
+	case p.Flags&zdctFlagSigned != 0:
+		return math.MinInt16, math.MaxInt16
+	case p.Flags&zdctFlagRCT != 0 && (c == 1 || c == 2):
+		return -max, max
+	}
+	return 0, max
+}
+
+// quantIndex returns the quantization table of the channel c.
+func (p *zdctHeader) quantIndex(c int) quantIndex {
+	if p.Flags&zdctFlagRCT != 0 && (c == 1 || c == 2) {
+		return quantIndexChrominance
+	}
+	return quantIndexLuminance
+}
+
+func zdctEncodeQuant(quant *[nQuantIndex][blockSize]uint16) []byte {
+	data := make([]byte, zdctQuantSize)
+	for i := range quant {
+		for j, v := range quant[i] {
+			binary.LittleEndian.PutUint16(data[(i*blockSize+j)*2:], v)
+		}
+	}
+	binary.LittleEndian.PutUint32(data[zdctQuantSize-4:], crc32.ChecksumIEEE(data[:zdctQuantSize-4]))
+	return data
+}
+
+func zdctDecodeQuant(data []byte) (quant *[nQuantIndex][blockSize]uint16, err error) {
+	if len(data) < zdctQuantSize {
+		return nil, fmt.Errorf("image/zdct: bad Quant tables.")
+	}
+	expect := binary.LittleEndian.Uint32(data[zdctQuantSize-4:])
+	if v := crc32.ChecksumIEEE(data[:zdctQuantSize-4]); v != expect {
+		return nil, fmt.Errorf("image/zdct: bad QuantCheckSum, expect = %x, got = %x", expect, v)
+	}
+	quant = new([nQuantIndex][blockSize]uint16)
+	for i := range quant {
+		for j := range quant[i] {
+			if quant[i][j] = binary.LittleEndian.Uint16(data[(i*blockSize+j)*2:]); quant[i][j] == 0 {
+				return nil, fmt.Errorf("image/zdct: bad Quant tables, zero value")
+			}
+		}
+	}
+	return
+}
@@ -2,16 +2,34 @@
 // Use of this source code is governed by a BSD-style
 // license that can be found in the LICENSE file.
 
+//go:build ignore
 // +build ignore
 
 package main
 
 import (
+	"bytes"
 	"fmt"
+	"image"
+	"log"
 
-	_ "common/zdct"
+	"github.com/chai2010/gopkg/image/zdct"
 )
 
 func main() {
-	fmt.Printf("TODO")
+	m := image.NewGray16(image.Rect(0, 0, 64, 64))
+	for i := range m.Pix {
+		m.Pix[i] = uint8(i * 7)
+	}
+
+	var buf bytes.Buffer
+	if err := zdct.Encode(&buf, m, &zdct.Options{Quality: 90}); err != nil {
+		log.Fatal(err)
+	}
+	size := buf.Len()
+	m1, err := zdct.Decode(&buf, nil)
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Printf("size = %d, bounds = %v, model = %T\n", size, m1.Bounds(), m1.ColorModel())
 }
@@ -3,3 +3,126 @@
 // license that can be found in the LICENSE file.
 
 package zdct
+
+// This file implements an Inverse Discrete Cosine Transformation, the same
+// algorithm as image/jpeg (the Chen-Wang algorithm of the MPEG-2 reference
+// decoder), but the intermediate values are int64, so the 16 bit samples
+// don't overflow. The constants are defined in block.go.
+
+// idct performs a 2-D Inverse Discrete Cosine Transformation, the results
+// are the level shifted samples.
+func idct(src *block) {
+	var tmp [blockSize]int64
+
+	// Horizontal 1-D IDCT.
+	for y := 0; y < 8; y++ {
+		s := src[y*8 : y*8+8]
+		d := tmp[y*8 : y*8+8]
+		// If all the AC components are zero, then the IDCT is trivial.
+		if s[1] == 0 && s[2] == 0 && s[3] == 0 &&
+			s[4] == 0 && s[5] == 0 && s[6] == 0 && s[7] == 0 {
+			dc := int64(s[0]) << 3
+			for i := range d {
+				d[i] = dc
+			}
+			continue
+		}
+
+		// Prescale.
+		x0 := (int64(s[0]) << 11) + 128
+		x1 := int64(s[4]) << 11
+		x2 := int64(s[6])
+		x3 := int64(s[2])
+		x4 := int64(s[1])
+		x5 := int64(s[7])
+		x6 := int64(s[5])
+		x7 := int64(s[3])
+
+		// Stage 1.
+		x8 := w7 * (x4 + x5)
+		x4 = x8 + w1mw7*x4
+		x5 = x8 - w1pw7*x5
+		x8 = w3 * (x6 + x7)
+		x6 = x8 - w3mw5*x6
+		x7 = x8 - w3pw5*x7
+
+		// Stage 2.
+		x8 = x0 + x1
+		x0 -= x1
+		x1 = w6 * (x3 + x2)
+		x2 = x1 - w2pw6*x2
+		x3 = x1 + w2mw6*x3
+		x1 = x4 + x6
+		x4 -= x6
+		x6 = x5 + x7
+		x5 -= x7
+
+		// Stage 3.
+		x7 = x8 + x3
+		x8 -= x3
+		x3 = x0 + x2
+		x0 -= x2
+		x2 = (r2*(x4+x5) + 128) >> 8
+		x4 = (r2*(x4-x5) + 128) >> 8
+
+		// Stage 4.
+		d[0] = (x7 + x1) >> 8
+		d[1] = (x3 + x2) >> 8
+		d[2] = (x0 + x4) >> 8
+		d[3] = (x8 + x6) >> 8
+		d[4] = (x8 - x6) >> 8
+		d[5] = (x0 - x4) >> 8
+		d[6] = (x3 - x2) >> 8
+		d[7] = (x7 - x1) >> 8
+	}
+
+	// Vertical 1-D IDCT.
+	for x := 0; x < 8; x++ {
+		// Prescale.
+		y0 := (tmp[8*0+x] << 8) + 8192
+		y1 := tmp[8*4+x] << 8
+		y2 := tmp[8*6+x]
+		y3 := tmp[8*2+x]
+		y4 := tmp[8*1+x]
+		y5 := tmp[8*7+x]
+		y6 := tmp[8*5+x]
+		y7 := tmp[8*3+x]
+
+		// Stage 1.
+		y8 := w7*(y4+y5) + 4
+		y4 = (y8 + w1mw7*y4) >> 3
+		y5 = (y8 - w1pw7*y5) >> 3
+		y8 = w3*(y6+y7) + 4
+		y6 = (y8 - w3mw5*y6) >> 3
+		y7 = (y8 - w3pw5*y7) >> 3
+
+		// Stage 2.
+		y8 = y0 + y1
+		y0 -= y1
+		y1 = w6*(y3+y2) + 4
+		y2 = (y1 - w2pw6*y2) >> 3
+		y3 = (y1 + w2mw6*y3) >> 3
+		y1 = y4 + y6
+		y4 -= y6
+		y6 = y5 + y7
+		y5 -= y7
+
+		// Stage 3.
+		y7 = y8 + y3
+		y8 -= y3
+		y3 = y0 + y2
+		y0 -= y2
+		y2 = (r2*(y4+y5) + 128) >> 8
+		y4 = (r2*(y4-y5) + 128) >> 8
+
+		// Stage 4.
+		src[8*0+x] = int32((y7 + y1) >> 14)
+		src[8*1+x] = int32((y3 + y2) >> 14)
+		src[8*2+x] = int32((y0 + y4) >> 14)
+		src[8*3+x] = int32((y8 + y6) >> 14)
+		src[8*4+x] = int32((y8 - y6) >> 14)
+		src[8*5+x] = int32((y0 - y4) >> 14)
+		src[8*6+x] = int32((y3 - y2) >> 14)
+		src[8*7+x] = int32((y7 - y1) >> 14)
+	}
+}
@@ -3,3 +3,333 @@
 // license that can be found in the LICENSE file.
 
 package zdct
+
+import (
+	"bufio"
+	"bytes"
+	"compress/flate"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"io"
+	"io/ioutil"
+	"math"
+
+	image_ext "github.com/chai2010/gopkg/image"
+	color_ext "github.com/chai2010/gopkg/image/color"
+	"github.com/chai2010/gopkg/image/convert"
+)
+
+const DefaultQuality = 90
+
+// Options are the encoding and decoding parameters.
+type Options struct {
+	ColorModel color.Model // convert the image to ColorModel
+	Quality    float32     // 1 ~ 100, DefaultQuality if zero
+	Lossless   bool        // store the residuals of the lossy samples
+
+	// Progress reports the progress of Encode by rows of blocks, may be
+	// nil. The encoding is canceled with image_ext.ErrCanceled if it
+	// returns false.
+	Progress image_ext.ProgressFunc
+}
+
+// DecodeConfig returns the color model and dimensions of a ZDCT image
+// without decoding the entire image.
+func DecodeConfig(r io.Reader) (config image.Config, err error) {
+	data := make([]byte, zdctHeaderSize)
+	if _, err = io.ReadFull(r, data); err != nil {
+		return
+	}
+	hdr, err := zdctDecodeHeader(data)
+	if err != nil {
+		return
+	}
+	config = image.Config{ColorModel: hdr.colorModel(), Width: int(hdr.Width), Height: int(hdr.Height)}
+	return
+}
+
+// Decode reads a ZDCT image from r and returns it as an image.Image.
+func Decode(r io.Reader, opt *Options) (m image.Image, err error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return
+	}
+	hdr, err := zdctDecodeHeader(data)
+	if err != nil {
+		return
+	}
+	if int(hdr.HeaderSize) > len(data) {
+		return nil, fmt.Errorf("image/zdct: bad HeaderSize, %d, missing data", hdr.HeaderSize)
+	}
+	data = data[hdr.HeaderSize:]
+	quant, err := zdctDecodeQuant(data)
+	if err != nil {
+		return
+	}
+	data = data[zdctQuantSize:]
+
+	planes := make([][]int32, hdr.Channels)
+	for c := range planes {
+		if len(data) < zdctPlaneFrameSize {
+			return nil, fmt.Errorf("image/zdct: bad plane %d, missing data", c)
+		}
+		size := binary.LittleEndian.Uint32(data[0:])
+		checkSum := binary.LittleEndian.Uint32(data[4:])
+		data = data[zdctPlaneFrameSize:]
+		if uint64(size) > uint64(len(data)) {
+			return nil, fmt.Errorf("image/zdct: bad DataSize, %v, plane %d", size, c)
+		}
+		if v := crc32.ChecksumIEEE(data[:size]); v != checkSum {
+			return nil, fmt.Errorf("image/zdct: bad DataCheckSum, expect = %x, got = %x, plane %d", checkSum, v, c)
+		}
+		if planes[c], err = decodePlane(hdr, c, data[:size], &quant[hdr.quantIndex(c)]); err != nil {
+			return
+		}
+		data = data[size:]
+	}
+	m = planesImage(hdr, planes)
+
+	// convert color model
+	if opt != nil && opt.ColorModel != nil {
+		m = convert.ColorModel(m, opt.ColorModel)
+	}
+	return
+}
+
+// maxDeflateRatio is the max ratio of the inflated size to the deflated
+// size, a 258-byte match takes at least 2 bits.
+const maxDeflateRatio = 1032
+
+// decodePlane decodes the samples of the channel c, see encodePlane.
+func decodePlane(hdr *zdctHeader, c int, data []byte, quant *[blockSize]uint16) (plane []int32, err error) {
+	width, height := int(hdr.Width), int(hdr.Height)
+	lo, hi := hdr.sampleRange(c)
+	shift := (lo + hi + 1) / 2
+
+	// a block takes at least 2 bytes, the DC and the end of the runs, so
+	// the data is too short for the blocks after the max deflate ratio.
+	blocks := uint64((width+7)/8) * uint64((height+7)/8)
+	if blocks*2 > uint64(len(data)+1)*maxDeflateRatio {
+		return nil, fmt.Errorf("image/zdct: bad plane %d, missing data", c)
+	}
+
+	zr := flate.NewReader(bytes.NewReader(data))
+	defer zr.Close()
+	r := &varintReader{r: bufio.NewReader(zr)}
+
+	plane = make([]int32, width*height)
+	var prevDC int32
+	for by := 0; by < height; by += 8 {
+		for bx := 0; bx < width; bx += 8 {
+			var b block
+			b[0] = prevDC + r.int32()
+			prevDC = b[0]
+			for zig := 1; r.err == nil; {
+				run := r.uvarint()
+				if run == 0 {
+					break
+				}
+				if zig += int(run - 1); run > blockSize || zig >= blockSize {
+					return nil, fmt.Errorf("image/zdct: bad block run, plane %d", c)
+				}
+				b[unzig[zig]] = r.int32()
+				zig++
+			}
+			if r.err != nil {
+				return nil, fmt.Errorf("image/zdct: bad plane %d, %v", c, r.err)
+			}
+
+			reconstructBlock(&b, quant, shift, lo, hi)
+			for y := 0; y < 8 && by+y < height; y++ {
+				for x := 0; x < 8 && bx+x < width; x++ {
+					plane[(by+y)*width+bx+x] = b[y*8+x]
+				}
+			}
+		}
+	}
+	if hdr.lossless() {
+		for i := range plane {
+			plane[i] += r.int32()
+		}
+		if r.err != nil {
+			return nil, fmt.Errorf("image/zdct: bad plane %d residuals, %v", c, r.err)
+		}
+	}
+	return
+}
+
+type varintReader struct {
+	r   io.ByteReader
+	err error
+}
+
+func (p *varintReader) uvarint() uint64 {
+	if p.err != nil {
+		return 0
+	}
+	v, err := binary.ReadUvarint(p.r)
+	if err != nil {
+		p.err = err
+	}
+	return v
+}
+
+func (p *varintReader) int32() int32 {
+	if p.err != nil {
+		return 0
+	}
+	v, err := binary.ReadVarint(p.r)
+	if err != nil {
+		p.err = err
+		return 0
+	}
+	if v < math.MinInt32 || v > math.MaxInt32 {
+		p.err = fmt.Errorf("value overflow, %d", v)
+		return 0
+	}
+	return int32(v)
+}
+
+// planesImage returns the image of the samples, the reversible color
+// transform is reverted:
+//
+//	G = Y - ((Cb + Cr) >> 2)
+//	R = Cr + G
+//	B = Cb + G
+func planesImage(hdr *zdctHeader, planes [][]int32) image.Image {
+	width, height := int(hdr.Width), int(hdr.Height)
+	if hdr.Flags&zdctFlagRCT != 0 {
+		lo, hi := hdr.sampleRange(0)
+		for i := range planes[0] {
+			y, cb, cr := planes[0][i], planes[1][i], planes[2][i]
+			g := y - ((cb + cr) >> 2)
+			planes[0][i], planes[1][i], planes[2][i] = clamp(cr+g, lo, hi), clamp(g, lo, hi), clamp(cb+g, lo, hi)
+		}
+	}
+
+	r := image.Rect(0, 0, width, height)
+	switch hdr.colorModel() {
+	case color.GrayModel:
+		m := image.NewGray(r)
+		for i, v := range planes[0] {
+			m.Pix[i] = uint8(v)
+		}
+		return m
+	case color.Gray16Model:
+		m := image.NewGray16(r)
+		for i, v := range planes[0] {
+			m.Pix[i*2+0], m.Pix[i*2+1] = uint8(v>>8), uint8(v)
+		}
+		return m
+	case color_ext.Gray16sModel:
+		m := image_ext.NewGray16s(r)
+		for i, v := range planes[0] {
+			m.SetGray16s(i%width, i/width, color_ext.Gray16s{Y: int16(v)})
+		}
+		return m
+	case color_ext.RGBModel:
+		m := image_ext.NewRGB(r)
+		for i := range planes[0] {
+			m.Pix[i*3+0], m.Pix[i*3+1], m.Pix[i*3+2] = uint8(planes[0][i]), uint8(planes[1][i]), uint8(planes[2][i])
+		}
+		return m
+	case color_ext.RGB48Model:
+		m := image_ext.NewRGB48(r)
+		for i := range planes[0] {
+			for c := 0; c < 3; c++ {
+				v := planes[c][i]
+				m.Pix[i*6+c*2+0], m.Pix[i*6+c*2+1] = uint8(v>>8), uint8(v)
+			}
+		}
+		return m
+	case color.RGBAModel:
+		m := image.NewRGBA(r)
+		for i := range planes[0] {
+			for c := 0; c < 4; c++ {
+				m.Pix[i*4+c] = uint8(planes[c][i])
+			}
+		}
+		return m
+	}
+	m := image.NewRGBA64(r)
+	for i := range planes[0] {
+		for c := 0; c < 4; c++ {
+			v := planes[c][i]
+			m.Pix[i*8+c*2+0], m.Pix[i*8+c*2+1] = uint8(v>>8), uint8(v)
+		}
+	}
+	return m
+}
+
+func clamp(v, lo, hi int32) int32 {
+	if v < lo {
+		return lo
+	}
+	if v > hi {
+		return hi
+	}
+	return v
+}
+
+func imageDecode(r io.Reader) (image.Image, error) {
+	return Decode(r, nil)
+}
+
+// newOptions converts the common options to the zdct options.
+func newOptions(opt *image_ext.Options) (*Options, error) {
+	var p Options
+	if ok, err := image_ext.ConvertOptions("zdct", opt, &p); !ok {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// newEncodeOptions converts the common options to the zdct options.
+func newEncodeOptions(opt *image_ext.Options) (*Options, error) {
+	var p Options
+	ok, err := image_ext.ConvertEncodeOptions("zdct", opt, &p, image_ext.EncodeSupport{
+		Quality: true,
+	})
+	if !ok {
+		return nil, err
+	}
+	if opt.Lossless {
+		p.Lossless = true
+	}
+	if opt.Quality != 0 {
+		p.Quality = opt.Quality
+	}
+	return &p, nil
+}
+
+func imageExtDecode(r io.Reader, opt *image_ext.Options) (image.Image, error) {
+	p, err := newOptions(opt)
+	if err != nil {
+		return nil, err
+	}
+	return Decode(r, p)
+}
+
+func imageExtEncode(w io.Writer, m image.Image, opt *image_ext.Options) error {
+	p, err := newEncodeOptions(opt)
+	if err != nil {
+		return err
+	}
+	return Encode(w, m, p)
+}
+
+func init() {
+	image.RegisterFormat("zdct", "ZDCT\x0A\x38\xC7\x1D", imageDecode, DecodeConfig)
+
+	image_ext.RegisterFormat(image_ext.Format{
+		Name:         "zdct",
+		Extensions:   []string{".zdct"},
+		Magics:       []string{"ZDCT\x0A\x38\xC7\x1D"},
+		DecodeConfig: DecodeConfig,
+		Decode:       imageExtDecode,
+		Encode:       imageExtEncode,
+	})
+}
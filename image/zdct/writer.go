@@ -3,3 +3,244 @@
 // license that can be found in the LICENSE file.
 
 package zdct
+
+import (
+	"bytes"
+	"compress/flate"
+	"encoding/binary"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"io"
+
+	image_ext "github.com/chai2010/gopkg/image"
+	"github.com/chai2010/gopkg/image/convert"
+)
+
+// Encode writes the image m to w in ZDCT format.
+func Encode(w io.Writer, m image.Image, opt *Options) (err error) {
+	quality, lossless := DefaultQuality, false
+	var progressFunc image_ext.ProgressFunc
+	if opt != nil {
+		if opt.ColorModel != nil {
+			m = convert.ColorModel(m, opt.ColorModel)
+		}
+		if opt.Quality > 0 {
+			quality = int(opt.Quality + 0.5)
+		}
+		lossless = opt.Lossless
+		progressFunc = opt.Progress
+	}
+	if quality > 100 {
+		quality = 100
+	}
+
+	m = adjustImage(m)
+	b := m.Bounds()
+	hdr, err := zdctMakeHeader(image.Config{ColorModel: m.ColorModel(), Width: b.Dx(), Height: b.Dy()}, quality, lossless)
+	if err != nil {
+		return
+	}
+	quant := scaleQuant(quality, int(hdr.Depth))
+
+	if _, err = w.Write(zdctEncodeHeader(hdr)); err != nil {
+		return
+	}
+	if _, err = w.Write(zdctEncodeQuant(&quant)); err != nil {
+		return
+	}
+	planes := imagePlanes(m, hdr)
+	progress := image_ext.NewProgress(progressFunc, len(planes)*((int(hdr.Height)+7)/8))
+	for c, plane := range planes {
+		data, err := encodePlane(hdr, c, plane, &quant[hdr.quantIndex(c)], progress)
+		if err != nil {
+			return err
+		}
+		var frame [zdctPlaneFrameSize]byte
+		binary.LittleEndian.PutUint32(frame[0:], uint32(len(data)))
+		binary.LittleEndian.PutUint32(frame[4:], crc32.ChecksumIEEE(data))
+		if _, err = w.Write(frame[:]); err != nil {
+			return err
+		}
+		if _, err = w.Write(data); err != nil {
+			return err
+		}
+	}
+	return
+}
+
+// imagePlanes returns the samples of the channels, the RGB samples are
+// transformed by the reversible color transform:
+//
+//	Y  = (R + 2*G + B) >> 2
+//	Cb = B - G
+//	Cr = R - G
+func imagePlanes(m image.Image, hdr *zdctHeader) (planes [][]int32) {
+	b := m.Bounds()
+	n := b.Dx() * b.Dy()
+	planes = make([][]int32, hdr.Channels)
+	for i := range planes {
+		planes[i] = make([]int32, n)
+	}
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			i := (y-b.Min.Y)*b.Dx() + x - b.Min.X
+			switch m := m.(type) {
+			case *image.Gray:
+				planes[0][i] = int32(m.GrayAt(x, y).Y)
+			case *image.Gray16:
+				planes[0][i] = int32(m.Gray16At(x, y).Y)
+			case *image_ext.Gray16s:
+				planes[0][i] = int32(m.Gray16sAt(x, y).Y)
+			case *image_ext.RGB:
+				c := m.RGBAt(x, y)
+				planes[0][i], planes[1][i], planes[2][i] = int32(c.R), int32(c.G), int32(c.B)
+			case *image_ext.RGB48:
+				c := m.RGB48At(x, y)
+				planes[0][i], planes[1][i], planes[2][i] = int32(c.R), int32(c.G), int32(c.B)
+			case *image.RGBA:
+				c := m.RGBAAt(x, y)
+				planes[0][i], planes[1][i], planes[2][i] = int32(c.R), int32(c.G), int32(c.B)
+				planes[3][i] = int32(c.A)
+			case *image.RGBA64:
+				c := m.RGBA64At(x, y)
+				planes[0][i], planes[1][i], planes[2][i] = int32(c.R), int32(c.G), int32(c.B)
+				planes[3][i] = int32(c.A)
+			}
+		}
+	}
+	if hdr.Flags&zdctFlagRCT != 0 {
+		for i := 0; i < n; i++ {
+			r, g, b := planes[0][i], planes[1][i], planes[2][i]
+			planes[0][i], planes[1][i], planes[2][i] = (r+2*g+b)>>2, b-g, r-g
+		}
+	}
+	return
+}
+
+// encodePlane returns the compressed coefficients of the 8x8 blocks of the
+// channel c, and the residuals of the samples if the image is lossless.
+// The blocks on the right and bottom edges are padded by the edge samples.
+func encodePlane(hdr *zdctHeader, c int, plane []int32, quant *[blockSize]uint16, progress *image_ext.Progress) (data []byte, err error) {
+	width, height := int(hdr.Width), int(hdr.Height)
+	lo, hi := hdr.sampleRange(c)
+	shift := (lo + hi + 1) / 2
+
+	var recon []int32
+	if hdr.lossless() {
+		recon = make([]int32, len(plane))
+	}
+
+	var buf bytes.Buffer
+	zw, err := flate.NewWriter(&buf, flate.DefaultCompression)
+	if err != nil {
+		return
+	}
+	w := &varintWriter{w: zw}
+	var prevDC int32
+	for by := 0; by < height; by += 8 {
+		for bx := 0; bx < width; bx += 8 {
+			var b block
+			for y := 0; y < 8; y++ {
+				sy := minInt(by+y, height-1)
+				for x := 0; x < 8; x++ {
+					sx := minInt(bx+x, width-1)
+					b[y*8+x] = plane[sy*width+sx] - shift
+				}
+			}
+			fdct(&b)
+			quantizeBlock(&b, quant)
+
+			// DC delta, then (run+1, value) pairs of the AC, 0 is the end
+			w.putVarint(int64(b[0] - prevDC))
+			prevDC = b[0]
+			run := 0
+			for zig := 1; zig < blockSize; zig++ {
+				v := b[unzig[zig]]
+				if v == 0 {
+					run++
+					continue
+				}
+				w.putUvarint(uint64(run + 1))
+				w.putVarint(int64(v))
+				run = 0
+			}
+			w.putUvarint(0)
+
+			if recon != nil {
+				reconstructBlock(&b, quant, shift, lo, hi)
+				for y := 0; y < 8 && by+y < height; y++ {
+					for x := 0; x < 8 && bx+x < width; x++ {
+						recon[(by+y)*width+bx+x] = b[y*8+x]
+					}
+				}
+			}
+		}
+		if !progress.Step(1) {
+			return nil, image_ext.ErrCanceled
+		}
+	}
+	for i := range recon {
+		w.putVarint(int64(plane[i] - recon[i]))
+	}
+	if w.err != nil {
+		return nil, w.err
+	}
+	if err = zw.Close(); err != nil {
+		return
+	}
+	data = buf.Bytes()
+	return
+}
+
+type varintWriter struct {
+	w   io.Writer
+	buf [binary.MaxVarintLen64]byte
+	err error
+}
+
+func (p *varintWriter) putUvarint(v uint64) {
+	if p.err == nil {
+		_, p.err = p.w.Write(p.buf[:binary.PutUvarint(p.buf[:], v)])
+	}
+}
+
+func (p *varintWriter) putVarint(v int64) {
+	if p.err == nil {
+		_, p.err = p.w.Write(p.buf[:binary.PutVarint(p.buf[:], v)])
+	}
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func adjustImage(m image.Image) image.Image {
+	switch m := m.(type) {
+	case *image.Gray, *image.Gray16, *image_ext.Gray16s:
+		return m
+	case *image_ext.RGB, *image_ext.RGB48:
+		return m
+	case *image.RGBA, *image.RGBA64:
+		return m
+	case *image_ext.MaskedImage:
+		// the nodata pixels are zero
+		return adjustImage(m.Image)
+	case *image_ext.Gray32i, *image_ext.Gray32f, *image_ext.Gray64f:
+		return convert.ColorModel(m, color.Gray16Model)
+	case *image_ext.RGB48s, *image_ext.RGB96i, *image_ext.RGB96f, *image_ext.RGB192f:
+		return convert.ColorModel(m, color.RGBA64Model)
+	default:
+		b := m.Bounds()
+		rgba := image.NewRGBA(b)
+		for y := b.Min.Y; y < b.Max.Y; y++ {
+			for x := b.Min.X; x < b.Max.X; x++ {
+				rgba.Set(x, y, m.At(x, y))
+			}
+		}
+		return rgba
+	}
+}
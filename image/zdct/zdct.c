@@ -1,5 +0,0 @@
-// Copyright 2013 <chaishushan{AT}gmail.com>. All rights reserved.
-// Use of this source code is governed by a BSD-style
-// license that can be found in the LICENSE file.
-
-#include "zdct.h"